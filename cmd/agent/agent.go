@@ -4,11 +4,13 @@ import (
 	"beszel"
 	"beszel/internal/agent"
 	"beszel/internal/agent/health"
+	"beszel/internal/agent/maintenance"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"strings"
+	"time"
 )
 
 // cli options
@@ -29,7 +31,10 @@ func (opts *cmdOptions) parse() bool {
 		builder.WriteString("\nCommands:\n")
 		builder.WriteString("  health    Check if the agent is running\n")
 		builder.WriteString("  help      Display this help message\n")
-		builder.WriteString("  update    Update to the latest version\n")
+		builder.WriteString("  maintenance [on [duration] | off]\n")
+		builder.WriteString("            Pause monitoring on the hub while the host is under maintenance\n")
+		builder.WriteString("  update [-prerelease] [-channel name]\n")
+		builder.WriteString("            Update to the latest version, optionally including pre-releases of a channel like beta\n")
 		builder.WriteString("\nFlags:\n")
 		fmt.Print(builder.String())
 		flag.PrintDefaults()
@@ -41,14 +46,18 @@ func (opts *cmdOptions) parse() bool {
 	}
 
 	switch subcommand {
-	case "-v", "version":
+	case "-v", "--version", "version":
 		fmt.Println(beszel.AppName+"-agent", beszel.Version)
 		return true
 	case "help":
 		flag.Usage()
 		return true
 	case "update":
-		agent.Update()
+		updateFlags := flag.NewFlagSet("update", flag.ExitOnError)
+		prerelease := updateFlags.Bool("prerelease", false, "Include pre-releases")
+		channel := updateFlags.String("channel", "", "Only include pre-releases of this channel, like beta")
+		_ = updateFlags.Parse(os.Args[2:])
+		agent.Update(*prerelease, *channel)
 		return true
 	case "health":
 		err := health.Check()
@@ -57,12 +66,50 @@ func (opts *cmdOptions) parse() bool {
 		}
 		fmt.Print("ok")
 		return true
+	case "maintenance":
+		if err := handleMaintenance(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return true
 	}
 
 	flag.Parse()
 	return false
 }
 
+// handleMaintenance enables, disables, or prints the agent's maintenance mode.
+// The running agent picks up the change and announces it to the hub.
+func handleMaintenance(args []string) error {
+	if len(args) == 0 {
+		active, until := maintenance.Status()
+		switch {
+		case !active:
+			fmt.Println("off")
+		case until.IsZero():
+			fmt.Println("on")
+		default:
+			fmt.Println("on until", until.Local().Format(time.RFC3339))
+		}
+		return nil
+	}
+
+	switch args[0] {
+	case "on":
+		var until time.Time
+		if len(args) > 1 {
+			duration, err := time.ParseDuration(args[1])
+			if err != nil || duration <= 0 {
+				return fmt.Errorf("invalid maintenance duration: %s", args[1])
+			}
+			until = time.Now().Add(duration)
+		}
+		return maintenance.Start(until)
+	case "off":
+		return maintenance.Stop()
+	}
+	return fmt.Errorf("unknown maintenance command: %s", args[0])
+}
+
 // loadAuthKey loads the base64 authentication key from the command line flag, environment variable, or key file.
 func (opts *cmdOptions) loadAuthKey() (string, error) {
 	var keyData string
@@ -3,16 +3,21 @@ package agent
 
 import (
 	"beszel"
+	"beszel/internal/common"
 	"beszel/internal/entities/system"
+	"cmp"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"log/slog"
+	"net"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/shirou/gopsutil/v4/host"
@@ -31,24 +36,38 @@ type Agent struct {
 	dnsManager        *DnsManager        // Manages DNS lookups
 	httpManager       *HttpManager       // Manages HTTP checks
 	speedtestManager  *SpeedtestManager  // Manages speedtest checks
+	tracerouteManager *TracerouteManager // Manages traceroutes
+	snmpManager       *SnmpManager       // Manages SNMP polling
 	systemInfo        system.Info        // Host system info
 	systemInfoManager *SystemInfoManager // Manages periodic system info refreshes
+	resolver          *net.Resolver      // Optional DoH resolver for target hostnames
+	updating          atomic.Bool        // Whether a self-update requested by a hub is running
+	ipInfo            *ipInfoProvider    // Looks up the public IP, ISP and ASN, nil if disabled
+
+	ipChange atomic.Pointer[common.IPChange] // Latest change of the public IP, reported to the hubs
 
 	cache             *SessionCache      // Cache for system stats based on primary session ID
+	hubResults        hubResults         // Results not yet collected by each hub
 	connectionManager *ConnectionManager // Channel to signal connection events
 	dataDir           string             // Directory for persisting data
 	authKey           string             // Base64 authentication key for hub verification
 
 	// Configuration management
-	configManager     *OptimizedConfigManager // Manages configuration caching and validation
-	lastConfigVersion int64                   // Track last received configuration version
+	configManager     *OptimizedConfigManager                 // Manages configuration caching and validation
+	lastConfigVersion int64                                   // Track last received configuration version
+	configMu          sync.Mutex                              // Serializes configuration updates from several hubs
+	configSource      string                                  // Hub the applied configuration came from
+	appliedConfig     atomic.Pointer[system.MonitoringConfig] // Configuration the managers run, shown by the status server
+
+	statusServer *statusServer // Optional local HTTP server showing the agent's state, nil if disabled
 }
 
 // NewAgent creates a new agent with the given data directory for persisting data.
 // If the data directory is not set, it will attempt to find the optimal directory.
 func NewAgent(dataDir ...string) (agent *Agent, err error) {
 	agent = &Agent{
-		cache: NewSessionCache(69 * time.Second),
+		cache:      NewSessionCache(69 * time.Second),
+		hubResults: hubResults{},
 	}
 
 	// Initialize configuration manager with defaults
@@ -116,10 +135,23 @@ func NewAgent(dataDir ...string) (agent *Agent, err error) {
 	// initialize connection manager
 	agent.connectionManager = newConnectionManager(agent)
 
+	// resolve target hostnames via DoH if configured
+	agent.resolver = newResolverFromEnv()
+
+	// number of uncollected results each manager keeps
+	resultBufferSize := resultBufferSizeFromEnv()
+
+	// run probes in a named network namespace if configured (Linux only)
+	probeNetns := newNetnsFromEnv()
+
 	// initialize ping manager
 	if pm, err := NewPingManager(); err != nil {
 		slog.Debug("Ping manager", "err", err)
 	} else {
+		pm.SetResolver(agent.resolver)
+		pm.SetResultBufferSize(resultBufferSize)
+		pm.SetCidrMaxHosts(pingCidrMaxHostsFromEnv())
+		pm.setNetns(probeNetns)
 		agent.pingManager = pm
 	}
 
@@ -127,13 +159,21 @@ func NewAgent(dataDir ...string) (agent *Agent, err error) {
 	if dm, err := NewDnsManager(); err != nil {
 		slog.Debug("DNS manager", "err", err)
 	} else {
+		dm.SetSourcePortRange(newSourcePortRangeFromEnv())
+		dm.SetResultBufferSize(resultBufferSize)
+		dm.setNetns(probeNetns)
 		agent.dnsManager = dm
+		// the hub learns about source IPs this host doesn't have
+		agent.configManager.validator.isLocalAddr = dm.isLocalAddr
 	}
 
 	// initialize HTTP manager
 	if hm, err := NewHttpManager(); err != nil {
 		slog.Debug("HTTP manager", "err", err)
 	} else {
+		hm.SetResolver(agent.resolver)
+		hm.SetResultBufferSize(resultBufferSize)
+		hm.setNetns(probeNetns)
 		agent.httpManager = hm
 	}
 
@@ -141,9 +181,34 @@ func NewAgent(dataDir ...string) (agent *Agent, err error) {
 	if sm, err := NewSpeedtestManager(); err != nil {
 		slog.Debug("Speedtest manager", "err", err)
 	} else {
+		sm.SetResultBufferSize(resultBufferSize)
+		sm.SetDataDir(agent.dataDir)
+		sm.setNetns(probeNetns)
 		agent.speedtestManager = sm
 	}
 
+	// initialize traceroute manager
+	if tm, err := NewTracerouteManager(); err != nil {
+		slog.Debug("Traceroute manager", "err", err)
+	} else {
+		tm.SetResolver(agent.resolver)
+		tm.SetResultBufferSize(resultBufferSize)
+		tm.setNetns(probeNetns)
+		agent.tracerouteManager = tm
+	}
+
+	// initialize SNMP manager
+	if sm, err := NewSnmpManager(); err != nil {
+		slog.Debug("SNMP manager", "err", err)
+	} else {
+		sm.SetResultBufferSize(resultBufferSize)
+		sm.setNetns(probeNetns)
+		agent.snmpManager = sm
+	}
+
+	// serve the agent's state locally if configured
+	agent.statusServer = newStatusServerFromEnv(agent)
+
 	// if debugging, print stats
 	if agent.debug {
 		slog.Debug("Stats", "data", agent.gatherStats(""))
@@ -169,9 +234,9 @@ func (a *Agent) gatherStats(sessionID string) *system.CombinedData {
 	if isCached {
 		slog.Debug("Using cached system data", "session_id", sessionID, "cache_hit", true)
 
-		// Create a copy of cached data and clear ping results to prevent duplicates
+		// Create a copy of cached data with the results queued for this hub
 		cachedData := *data
-		cachedData.Stats.PingResults = nil
+		a.hubResults.take(sessionID, &cachedData.Stats)
 
 		// Debug log cached speedtest results
 		if cachedData.Stats.SpeedtestResults != nil {
@@ -192,6 +257,9 @@ func (a *Agent) gatherStats(sessionID string) *system.CombinedData {
 		Stats: a.getSystemStats(),
 		Info:  a.systemInfo,
 	}
+	// every hub gets the fresh results, this one along with the ones it hasn't collected yet
+	a.hubResults.add(&data.Stats)
+	a.hubResults.take(sessionID, &data.Stats)
 
 	// Debug log fresh speedtest results before caching
 	if data.Stats.SpeedtestResults != nil {
@@ -217,6 +285,13 @@ func (a *Agent) Start(serverOptions ServerOptions) error {
 		a.systemInfoManager.Start()
 	}
 
+	// a status server that can't listen doesn't keep the agent from monitoring
+	if a.statusServer != nil {
+		if err := a.statusServer.start(); err != nil {
+			slog.Error("Failed to start status server", "err", err)
+		}
+	}
+
 	return a.connectionManager.Start(serverOptions)
 }
 
@@ -288,6 +363,133 @@ func (a *Agent) UpdateSpeedtestConfig(targets []system.SpeedtestTarget, cronExpr
 	}
 }
 
+// UpdateTracerouteConfig updates the traceroute monitoring configuration
+func (a *Agent) UpdateTracerouteConfig(targets []system.TracerouteTarget, cronExpression string) {
+	if a.tracerouteManager != nil {
+		a.tracerouteManager.UpdateConfig(targets, cronExpression)
+		// Clear session cache to prevent stale traceroute results from being sent
+		a.cache.Clear()
+		slog.Debug("Session cache cleared after traceroute config update", "targets_count", len(targets))
+	}
+}
+
+// UpdateSnmpConfig updates the SNMP monitoring configuration
+func (a *Agent) UpdateSnmpConfig(targets []system.SnmpTarget, cronExpression string) {
+	if a.snmpManager != nil {
+		a.snmpManager.UpdateConfig(targets, cronExpression)
+		// Clear session cache to prevent stale SNMP results from being sent
+		a.cache.Clear()
+		slog.Debug("Session cache cleared after SNMP config update", "targets_count", len(targets))
+	}
+}
+
+// RunCheckNow runs the checks of a service in the background, outside of its schedule.
+// The cron schedule is left untouched and results are buffered like scheduled ones,
+// so they are sent to the hub with the next data request.
+func (a *Agent) RunCheckNow(service string) error {
+	var run func()
+	var scheduler *schedulerStatus
+	switch service {
+	case common.ServicePing:
+		if a.pingManager != nil {
+			run = a.pingManager.checkPings
+			scheduler = &a.pingManager.scheduler
+		}
+	case common.ServiceDns:
+		if a.dnsManager != nil {
+			run = a.dnsManager.checkDnsLookups
+			scheduler = &a.dnsManager.scheduler
+		}
+	case common.ServiceHttp:
+		if a.httpManager != nil {
+			run = a.httpManager.performHttpChecks
+			scheduler = &a.httpManager.scheduler
+		}
+	case common.ServiceSpeedtest:
+		if a.speedtestManager != nil {
+			run = a.speedtestManager.performSpeedtestChecks
+			scheduler = &a.speedtestManager.scheduler
+		}
+	case common.ServiceTraceroute:
+		if a.tracerouteManager != nil {
+			run = a.tracerouteManager.checkTraceroutes
+			scheduler = &a.tracerouteManager.scheduler
+		}
+	case common.ServiceSnmp:
+		if a.snmpManager != nil {
+			run = a.snmpManager.checkSnmpTargets
+			scheduler = &a.snmpManager.scheduler
+		}
+	default:
+		return fmt.Errorf("unknown service: %s", service)
+	}
+	if run == nil {
+		return fmt.Errorf("%s checks are not available", service)
+	}
+
+	// a second run while the checks are running, scheduled or not, would only repeat them
+	if !scheduler.start() {
+		return fmt.Errorf("%s checks are already running", service)
+	}
+	go func() {
+		defer scheduler.finish()
+		slog.Info("Running checks on demand", "service", service)
+		run()
+	}()
+	return nil
+}
+
+// schedulerStatuses returns the health of the schedulers of the available monitoring services
+func (a *Agent) schedulerStatuses() []system.SchedulerStatus {
+	var statuses []system.SchedulerStatus
+	if a.pingManager != nil {
+		statuses = append(statuses, a.pingManager.scheduler.report(common.ServicePing))
+	}
+	if a.dnsManager != nil {
+		statuses = append(statuses, a.dnsManager.scheduler.report(common.ServiceDns))
+	}
+	if a.httpManager != nil {
+		statuses = append(statuses, a.httpManager.scheduler.report(common.ServiceHttp))
+	}
+	if a.speedtestManager != nil {
+		statuses = append(statuses, a.speedtestManager.scheduler.report(common.ServiceSpeedtest))
+	}
+	if a.tracerouteManager != nil {
+		statuses = append(statuses, a.tracerouteManager.scheduler.report(common.ServiceTraceroute))
+	}
+	if a.snmpManager != nil {
+		statuses = append(statuses, a.snmpManager.scheduler.report(common.ServiceSnmp))
+	}
+	return statuses
+}
+
+// UpdateHubConfiguration applies a monitoring configuration pushed by one of the agent's hubs.
+//
+// An agent reporting to several hubs runs the configuration with the newest version, the last
+// writer wins. A configuration from another hub than the one the applied configuration came
+// from is rejected unless its version is newer, even if the hub asks for a forced reload.
+// Versions are the Unix time in milliseconds the hub's monitoring configuration was last changed
+// at, and stay the same when a hub sends it again, so the hub whose monitoring configuration was
+// changed last decides what the agent monitors, provided the hubs' clocks are in sync. A hub
+// without a monitoring configuration sends version 0 and can't replace another hub's.
+// Configurations from the hub of the applied one are handled as with a single hub.
+func (a *Agent) UpdateHubConfiguration(hub string, config *system.MonitoringConfig, version int64, clearCache bool, forceReload bool) error {
+	a.configMu.Lock()
+	defer a.configMu.Unlock()
+
+	if a.configSource != "" && hub != a.configSource && version <= a.lastConfigVersion {
+		slog.Debug("Ignoring configuration older than the one from another hub", "hub", hub, "version", version, "applied_hub", a.configSource, "applied_version", a.lastConfigVersion)
+		return fmt.Errorf("configuration version %d is not newer than version %d applied from another hub", version, a.lastConfigVersion)
+	}
+	if err := a.UpdateConfigurationOptimized(config, version, clearCache, forceReload); err != nil {
+		return err
+	}
+	if a.lastConfigVersion == version {
+		a.configSource = hub
+	}
+	return nil
+}
+
 // UpdateConfigurationOptimized updates the agent configuration with caching and validation
 func (a *Agent) UpdateConfigurationOptimized(config *system.MonitoringConfig, version int64, clearCache bool, forceReload bool) error {
 	// Handle cache clearing if requested
@@ -323,14 +525,32 @@ func (a *Agent) UpdateConfigurationOptimized(config *system.MonitoringConfig, ve
 		return fmt.Errorf("configuration validation failed: %w", err)
 	}
 
+	// paused services keep their targets without a schedule, the others keep running
+	paused := func(service string) bool { return slices.Contains(config.Paused, service) }
+
+	// the hostname sets the phases of the targets apart from other agents checking them
+	jitterSeed := ""
+	if config.Jitter {
+		jitterSeed = cmp.Or(a.systemInfo.Hostname, "agent")
+	}
+
 	// Update ping configuration if enabled
 	if config.Enabled.Ping && len(config.Ping.Targets) > 0 {
 		interval := config.Ping.Interval
 		if interval == "" {
 			interval = config.GlobalInterval
 		}
+		if a.pingManager != nil {
+			a.pingManager.SetCronSeconds(config.CronSeconds)
+			a.pingManager.SetJitter(jitterSeed)
+			a.pingManager.SetSmoothing(config.Ping.Smoothing)
+		}
 		a.UpdatePingConfig(config.Ping.Targets, interval)
 		slog.Debug("Updated ping configuration", "targets", len(config.Ping.Targets), "interval", interval)
+	} else if paused(common.ServicePing) && len(config.Ping.Targets) > 0 {
+		// Paused on the hub, keep the targets and their uncollected results but stop the schedule
+		a.UpdatePingConfig(config.Ping.Targets, "")
+		slog.Debug("Paused ping checks")
 	} else {
 		// Disable ping if not enabled or no targets
 		a.UpdatePingConfig([]system.PingTarget{}, "")
@@ -343,8 +563,17 @@ func (a *Agent) UpdateConfigurationOptimized(config *system.MonitoringConfig, ve
 		if interval == "" {
 			interval = config.GlobalInterval
 		}
+		if a.dnsManager != nil {
+			a.dnsManager.SetCronSeconds(config.CronSeconds)
+			a.dnsManager.SetJitter(jitterSeed)
+			a.dnsManager.SetMaxConcurrentLookups(config.Dns.MaxConcurrentLookups)
+		}
 		a.UpdateDnsConfig(config.Dns.Targets, interval)
 		slog.Debug("Updated DNS configuration", "targets", len(config.Dns.Targets), "interval", interval)
+	} else if paused(common.ServiceDns) && len(config.Dns.Targets) > 0 {
+		// Paused on the hub, keep the targets and their uncollected results but stop the schedule
+		a.UpdateDnsConfig(config.Dns.Targets, "")
+		slog.Debug("Paused DNS checks")
 	} else {
 		// Disable DNS if not enabled or no targets
 		a.UpdateDnsConfig([]system.DnsTarget{}, "")
@@ -357,8 +586,17 @@ func (a *Agent) UpdateConfigurationOptimized(config *system.MonitoringConfig, ve
 		if interval == "" {
 			interval = config.GlobalInterval
 		}
+		if a.httpManager != nil {
+			a.httpManager.SetCronSeconds(config.CronSeconds)
+			a.httpManager.SetJitter(jitterSeed)
+			a.httpManager.SetSmoothing(config.Http.Smoothing)
+		}
 		a.UpdateHttpConfig(config.Http.Targets, interval)
 		slog.Debug("Updated HTTP configuration", "targets", len(config.Http.Targets), "interval", interval)
+	} else if paused(common.ServiceHttp) && len(config.Http.Targets) > 0 {
+		// Paused on the hub, keep the targets and their uncollected results but stop the schedule
+		a.UpdateHttpConfig(config.Http.Targets, "")
+		slog.Debug("Paused HTTP checks")
 	} else {
 		// Disable HTTP if not enabled or no targets
 		a.UpdateHttpConfig([]system.HttpTarget{}, "")
@@ -371,16 +609,70 @@ func (a *Agent) UpdateConfigurationOptimized(config *system.MonitoringConfig, ve
 		if interval == "" {
 			interval = config.GlobalInterval
 		}
+		if a.speedtestManager != nil {
+			a.speedtestManager.SetCronSeconds(config.CronSeconds)
+			a.speedtestManager.SetJitter(jitterSeed)
+		}
 		a.UpdateSpeedtestConfig(config.Speedtest.Targets, interval)
 		slog.Debug("Updated speedtest configuration", "targets", len(config.Speedtest.Targets), "interval", interval)
+	} else if paused(common.ServiceSpeedtest) && len(config.Speedtest.Targets) > 0 {
+		// Paused on the hub, keep the targets and their uncollected results but stop the schedule
+		a.UpdateSpeedtestConfig(config.Speedtest.Targets, "")
+		slog.Debug("Paused speedtest checks")
 	} else {
 		// Disable speedtest if not enabled or no targets
 		a.UpdateSpeedtestConfig([]system.SpeedtestTarget{}, "")
 		slog.Debug("Disabled speedtest configuration")
 	}
 
+	// Update traceroute configuration if enabled
+	if config.Enabled.Traceroute && len(config.Traceroute.Targets) > 0 {
+		interval := config.Traceroute.Interval
+		if interval == "" {
+			interval = config.GlobalInterval
+		}
+		if a.tracerouteManager != nil {
+			a.tracerouteManager.SetCronSeconds(config.CronSeconds)
+			a.tracerouteManager.SetJitter(jitterSeed)
+		}
+		a.UpdateTracerouteConfig(config.Traceroute.Targets, interval)
+		slog.Debug("Updated traceroute configuration", "targets", len(config.Traceroute.Targets), "interval", interval)
+	} else if paused(common.ServiceTraceroute) && len(config.Traceroute.Targets) > 0 {
+		// Paused on the hub, keep the targets and their uncollected results but stop the schedule
+		a.UpdateTracerouteConfig(config.Traceroute.Targets, "")
+		slog.Debug("Paused traceroute checks")
+	} else {
+		// Disable traceroute if not enabled or no targets
+		a.UpdateTracerouteConfig([]system.TracerouteTarget{}, "")
+		slog.Debug("Disabled traceroute configuration")
+	}
+
+	// Update SNMP configuration if enabled
+	if config.Enabled.Snmp && len(config.Snmp.Targets) > 0 {
+		interval := config.Snmp.Interval
+		if interval == "" {
+			interval = config.GlobalInterval
+		}
+		if a.snmpManager != nil {
+			a.snmpManager.SetCronSeconds(config.CronSeconds)
+			a.snmpManager.SetJitter(jitterSeed)
+		}
+		a.UpdateSnmpConfig(config.Snmp.Targets, interval)
+		slog.Debug("Updated SNMP configuration", "targets", len(config.Snmp.Targets), "interval", interval)
+	} else if paused(common.ServiceSnmp) && len(config.Snmp.Targets) > 0 {
+		// Paused on the hub, keep the targets and their uncollected results but stop the schedule
+		a.UpdateSnmpConfig(config.Snmp.Targets, "")
+		slog.Debug("Paused SNMP checks")
+	} else {
+		// Disable SNMP if not enabled or no targets
+		a.UpdateSnmpConfig([]system.SnmpTarget{}, "")
+		slog.Debug("Disabled SNMP configuration")
+	}
+
 	// Update version
 	a.lastConfigVersion = version
+	applied := *config
+	a.appliedConfig.Store(&applied)
 	
 	// Always clear session cache after configuration update to ensure fresh results
 	a.cache.Clear()
@@ -422,6 +714,18 @@ func (a *Agent) Stop() {
 		a.dnsManager.Close()
 	}
 
+	if a.tracerouteManager != nil {
+		a.tracerouteManager.Close()
+	}
+
+	if a.snmpManager != nil {
+		a.snmpManager.Close()
+	}
+
+	if a.statusServer != nil {
+		a.statusServer.stop()
+	}
+
 	// Note: HttpManager and SpeedtestManager don't have Close methods
 	// They are managed by their respective cron schedulers
 
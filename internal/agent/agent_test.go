@@ -0,0 +1,48 @@
+package agent
+
+import (
+	"beszel/internal/common"
+	"beszel/internal/entities/system"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_RunCheckNow(t *testing.T) {
+	hm, err := NewHttpManager()
+	require.NoError(t, err)
+	defer hm.Stop()
+	agent := &Agent{httpManager: hm}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	hm.UpdateConfig([]system.HttpTarget{{URL: server.URL, Timeout: 5 * time.Second}}, "0 0 1 1 *")
+	entries := len(hm.cronScheduler.Entries())
+	// wait for the run started by the update
+	require.Eventually(t, func() bool { return !hm.scheduler.isRunning() }, 5*time.Second, 10*time.Millisecond)
+	hm.GetResults()
+
+	require.NoError(t, agent.RunCheckNow(common.ServiceHttp))
+	assert.Eventually(t, func() bool {
+		hm.RLock()
+		defer hm.RUnlock()
+		return hm.results[server.URL] != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool { return !hm.scheduler.isRunning() }, 5*time.Second, 10*time.Millisecond)
+
+	// the schedule is left untouched
+	assert.Equal(t, "0 0 1 1 *", hm.cronExpression)
+	assert.Len(t, hm.cronScheduler.Entries(), entries)
+
+	// a run in progress isn't repeated
+	require.True(t, hm.scheduler.start())
+	assert.ErrorContains(t, agent.RunCheckNow(common.ServiceHttp), "already running")
+	hm.scheduler.finish()
+
+	assert.ErrorContains(t, agent.RunCheckNow(common.ServicePing), "not available")
+	assert.ErrorContains(t, agent.RunCheckNow("portscan"), "unknown service")
+}
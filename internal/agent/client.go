@@ -4,6 +4,10 @@ import (
 	"beszel"
 	"beszel/internal/common"
 	"beszel/internal/entities/system"
+	"bytes"
+	"cmp"
+	"compress/flate"
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -12,6 +16,7 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"slices"
 	"strings"
 	"time"
 
@@ -21,6 +26,8 @@ import (
 
 const (
 	wsDeadline = 70 * time.Second
+	// wsCompressionThreshold is the size from which messages are compressed if the hub supports it
+	wsCompressionThreshold = 512
 )
 
 // WebSocketClient manages the WebSocket connection between the agent and hub.
@@ -31,39 +38,76 @@ type WebSocketClient struct {
 	agent              *Agent                              // Reference to the parent agent
 	Conn               *gws.Conn                           // Active WebSocket connection
 	hubURL             *url.URL                            // Parsed hub URL for connection
+	hub                string                              // Entry of HUB_URL the client connects to, identifies the hub
+	connectionManager  *ConnectionManager                  // Manager the client reports connection events to
 	token              string                              // Authentication token for hub registration
 	fingerprint        string                              // System fingerprint for identification
 	hubRequest         *common.HubRequest[cbor.RawMessage] // Reusable request structure for message parsing
 	lastConnectAttempt time.Time                           // Timestamp of last connection attempt
 	hubVerified        bool                                // Whether the hub has been cryptographically verified
+	compression        bool                                // Whether the hub accepted compressed messages on the current connection
 
 }
 
-// newWebSocketClient creates a new WebSocket client for the given agent.
-// It reads configuration from environment variables and validates the hub URL.
-func newWebSocketClient(agent *Agent) (client *WebSocketClient, err error) {
-	hubURLStr, exists := GetEnv("HUB_URL")
+// newWebSocketClients creates a WebSocket client for each hub of the agent. HUB_URL is a comma
+// separated list of hubs and TOKEN either a single token used for all of them or one per hub.
+func newWebSocketClients(agent *Agent) ([]*WebSocketClient, error) {
+	hubURLs, exists := GetEnv("HUB_URL")
 	if !exists {
 		return nil, errors.New("HUB_URL environment variable not set")
 	}
-
-	client = &WebSocketClient{}
-
-	client.hubURL, err = url.Parse(hubURLStr)
+	// get registration tokens
+	token, err := getToken()
 	if err != nil {
+		return nil, err
+	}
+
+	var hubs, tokens []string
+	for _, hub := range strings.Split(hubURLs, ",") {
+		if hub = strings.TrimSpace(hub); hub != "" {
+			hubs = append(hubs, hub)
+		}
+	}
+	if len(hubs) == 0 {
 		return nil, errors.New("invalid hub URL")
 	}
-	// get registration token
-	client.token, err = getToken()
-	if err != nil {
-		return nil, err
+	if tokens = strings.Split(token, ","); len(tokens) == 1 {
+		tokens = slices.Repeat(tokens, len(hubs))
+	} else if len(tokens) != len(hubs) {
+		return nil, fmt.Errorf("TOKEN has %d tokens for %d hubs, set one for all hubs or one per hub", len(tokens), len(hubs))
 	}
 
-	client.agent = agent
-	client.hubRequest = &common.HubRequest[cbor.RawMessage]{}
-	client.fingerprint = agent.getFingerprint()
+	clients := make([]*WebSocketClient, len(hubs))
+	for i, hub := range hubs {
+		client := &WebSocketClient{
+			hub:               hub,
+			token:             strings.TrimSpace(tokens[i]),
+			agent:             agent,
+			connectionManager: agent.connectionManager,
+			hubRequest:        &common.HubRequest[cbor.RawMessage]{},
+			fingerprint:       agent.getFingerprint(),
+		}
+		if client.hubURL, err = url.Parse(hub); err != nil {
+			return nil, errors.New("invalid hub URL")
+		}
+		clients[i] = client
+	}
+	agent.Lock()
+	for _, client := range clients {
+		agent.hubResults.register(client.hub)
+	}
+	agent.Unlock()
+	return clients, nil
+}
 
-	return client, nil
+// newWebSocketClient creates a WebSocket client for the first hub of the agent.
+// It reads configuration from environment variables and validates the hub URL.
+func newWebSocketClient(agent *Agent) (*WebSocketClient, error) {
+	clients, err := newWebSocketClients(agent)
+	if err != nil {
+		return nil, err
+	}
+	return clients[0], nil
 }
 
 // getToken returns the token for the WebSocket client.
@@ -105,6 +149,8 @@ func (client *WebSocketClient) getOptions() *gws.ClientOption {
 	client.options = &gws.ClientOption{
 		Addr:      client.hubURL.String(),
 		TlsConfig: &tls.Config{InsecureSkipVerify: true},
+		// hubs that don't support permessage-deflate decline it and messages are sent uncompressed
+		PermessageDeflate: gws.PermessageDeflate{Enabled: true, Threshold: wsCompressionThreshold},
 		RequestHeader: http.Header{
 			"User-Agent": []string{getUserAgent()},
 			"X-Token":    []string{client.token},
@@ -122,10 +168,13 @@ func (client *WebSocketClient) Connect() (err error) {
 	// make sure previous connection is closed
 	client.Close()
 
-	client.Conn, _, err = gws.NewClient(client, client.getOptions())
+	var res *http.Response
+	client.Conn, res, err = gws.NewClient(client, client.getOptions())
 	if err != nil {
 		return err
 	}
+	client.compression = strings.Contains(res.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate")
+	slog.Debug("WebSocket connected", "compression", client.compression)
 
 	go client.Conn.ReadLoop()
 
@@ -142,7 +191,7 @@ func (client *WebSocketClient) OnOpen(conn *gws.Conn) {
 // It logs the closure reason and notifies the connection manager.
 func (client *WebSocketClient) OnClose(conn *gws.Conn, err error) {
 	slog.Warn("Connection closed", "err", strings.TrimPrefix(err.Error(), "gws: "))
-	client.agent.connectionManager.eventChan <- WebSocketDisconnect
+	client.connectionManager.eventChan <- WebSocketDisconnect
 }
 
 // OnMessage handles incoming WebSocket messages from the hub.
@@ -155,6 +204,8 @@ func (client *WebSocketClient) OnMessage(conn *gws.Conn, message *gws.Message) {
 		return
 	}
 
+	// the request is reused, clear data left over from the previous message
+	client.hubRequest.Data = nil
 	if err := cbor.NewDecoder(message.Data).Decode(client.hubRequest); err != nil {
 		slog.Error("Error parsing message", "err", err)
 		return
@@ -183,7 +234,7 @@ func (client *WebSocketClient) handleAuthChallenge(msg *common.HubRequest[cbor.R
 	}
 
 	client.hubVerified = true
-	client.agent.connectionManager.eventChan <- WebSocketConnect
+	client.connectionManager.eventChan <- WebSocketConnect
 
 	response := &common.FingerprintResponse{
 		Fingerprint: client.fingerprint,
@@ -226,24 +277,43 @@ func (client *WebSocketClient) handleHubRequest(msg *common.HubRequest[cbor.RawM
 	}
 	switch msg.Action {
 	case common.GetData:
-		return client.sendSystemData()
+		return client.sendSystemData(msg)
 	case common.CheckFingerprint:
 		return client.handleAuthChallenge(msg)
 	case common.UpdateMonitoringConfig:
 		return client.handleMonitoringConfigUpdate(msg)
+	case common.RunCheckNow:
+		return client.handleRunCheckNow(msg)
+	case common.SelfUpdate:
+		return client.handleSelfUpdate(msg)
 	}
 	return nil
 }
 
 // sendSystemData gathers and sends current system statistics to the hub.
-func (client *WebSocketClient) sendSystemData() error {
-	sysStats := client.agent.gatherStats(client.token)
+// The data is signed with the token derived key if the hub requests it.
+func (client *WebSocketClient) sendSystemData(msg *common.HubRequest[cbor.RawMessage]) error {
+	var dataRequest common.DataRequest
+	if len(msg.Data) > 0 {
+		if err := cbor.Unmarshal(msg.Data, &dataRequest); err != nil {
+			return err
+		}
+	}
+
+	sysStats := client.agent.gatherStats(client.hub)
 	
 	slog.Debug("WebSocket sending system data", "speedtest_results_count", len(sysStats.Stats.SpeedtestResults))
 	for serverID, result := range sysStats.Stats.SpeedtestResults {
 		slog.Debug("WebSocket sending speedtest result", "server_id", serverID, "download", result.DownloadSpeed, "upload", result.UploadSpeed, "last_checked", result.LastChecked)
 	}
 	
+	if dataRequest.Signed {
+		data, err := cbor.Marshal(sysStats)
+		if err != nil {
+			return err
+		}
+		return client.sendMessage(common.SignData(common.DataSigningKey(client.token), data))
+	}
 	return client.sendMessage(sysStats)
 }
 
@@ -273,10 +343,83 @@ func (client *WebSocketClient) handleMonitoringConfigUpdate(msg *common.HubReque
 		"http_targets", len(configUpdate.Config.Http.Targets),
 		"speedtest_targets", len(configUpdate.Config.Speedtest.Targets))
 
+	// invalid targets are left out so the others are still applied, the hub learns which ones
+	ack := client.agent.configManager.validator.RejectInvalidTargets(&configUpdate.Config)
+	ack.Version = configUpdate.Version
+	for _, target := range ack.Rejected {
+		slog.Warn("Rejected monitoring target", "service", target.Service, "target", target.Target, "reason", target.Reason)
+	}
+
 	// Use optimized configuration update with cache clearing support
-	return client.agent.UpdateConfigurationOptimized(&configUpdate.Config, configUpdate.Version, configUpdate.ClearCache, configUpdate.ForceReload)
+	err := client.agent.UpdateHubConfiguration(client.hub, &configUpdate.Config, configUpdate.Version, configUpdate.ClearCache, configUpdate.ForceReload)
+	if err != nil {
+		ack.Applied = 0
+		ack.Error = err.Error()
+	}
+	if ackErr := client.sendConfigAck(ack); ackErr != nil {
+		slog.Debug("Failed to send configuration acknowledgement", "err", ackErr)
+	}
+	return err
+}
+
+// handleRunCheckNow runs the checks of the requested service immediately.
+// No response is sent, the results are returned with the next data request.
+func (client *WebSocketClient) handleRunCheckNow(msg *common.HubRequest[cbor.RawMessage]) error {
+	var request common.RunCheckRequest
+	if err := cbor.Unmarshal(msg.Data, &request); err != nil {
+		return err
+	}
+	return client.agent.RunCheckNow(request.Service)
+}
+
+// handleSelfUpdate updates the agent binary in the background, reporting the progress to the hub.
+// Only one update runs at a time, further requests are reported as failed.
+func (client *WebSocketClient) handleSelfUpdate(msg *common.HubRequest[cbor.RawMessage]) error {
+	var request common.SelfUpdateRequest
+	if len(msg.Data) > 0 {
+		if err := cbor.Unmarshal(msg.Data, &request); err != nil {
+			return err
+		}
+	}
+	if !client.agent.updating.CompareAndSwap(false, true) {
+		return client.sendUpdateStatus(common.UpdateStatus{
+			Status:  common.UpdateFailed,
+			Version: request.Version,
+			Error:   "an update is already running",
+		})
+	}
+	go client.runSelfUpdate(request.Version)
+	return nil
 }
 
+// runSelfUpdate installs version, or the latest release if it is empty, and restarts the
+// agent with the new binary, which then reconnects to the hub
+func (client *WebSocketClient) runSelfUpdate(version string) {
+	defer client.agent.updating.Store(false)
+
+	slog.Info("Updating agent as requested by hub", "version", cmp.Or(version, "latest"))
+	_ = client.sendUpdateStatus(common.UpdateStatus{Status: common.UpdateRunning, Version: version})
+	installed, err := selfUpdate(version)
+	status := common.UpdateStatus{Status: common.UpdateSucceeded, Version: installed}
+	switch {
+	case err != nil:
+		slog.Error("Failed to update agent", "version", version, "err", err)
+		status = common.UpdateStatus{Status: common.UpdateFailed, Version: version, Error: err.Error()}
+	case installed == "":
+		status = common.UpdateStatus{Status: common.UpdateCurrent, Version: beszel.Version}
+	}
+	if err := client.sendUpdateStatus(status); err != nil {
+		slog.Debug("Failed to report update status", "err", err)
+	}
+	if status.Status != common.UpdateSucceeded {
+		return
+	}
+
+	slog.Info("Updated agent, restarting", "version", installed)
+	if err := restartAgent(); err != nil {
+		slog.Error("Failed to restart agent, restart it to run the new version", "err", err)
+	}
+}
 
 // sendMessage encodes the given data to CBOR and sends it as a binary message over the WebSocket connection to the hub.
 func (client *WebSocketClient) sendMessage(data any) error {
@@ -287,6 +430,10 @@ func (client *WebSocketClient) sendMessage(data any) error {
 	}
 	
 	slog.Debug("WebSocket sending CBOR message", "size_bytes", len(bytes))
+	if client.compression && len(bytes) >= wsCompressionThreshold && slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		compressed := deflatedSize(bytes)
+		slog.Debug("WebSocket message compression", "size_bytes", len(bytes), "compressed_bytes", compressed, "ratio", fmt.Sprintf("%.2f", float64(len(bytes))/float64(compressed)))
+	}
 	err = client.Conn.WriteMessage(gws.OpcodeBinary, bytes)
 	if err != nil {
 		slog.Debug("WebSocket failed to send message", "error", err)
@@ -296,6 +443,76 @@ func (client *WebSocketClient) sendMessage(data any) error {
 	return err
 }
 
+// sendMaintenance announces the agent's maintenance state to the hub.
+// The message is tagged so the hub can tell it apart from responses to its requests.
+func (client *WebSocketClient) sendMaintenance(active bool, until time.Time) error {
+	request := common.MaintenanceRequest{Enabled: active}
+	if !until.IsZero() {
+		request.Until = until.Unix()
+	}
+	return client.sendMessage(cbor.Tag{
+		Number: common.AgentMessageTag,
+		Content: common.AgentMessage[common.MaintenanceRequest]{
+			Action: common.SetMaintenance,
+			Data:   request,
+		},
+	})
+}
+
+// sendConfigAck reports the targets of a monitoring configuration that were applied to the hub
+func (client *WebSocketClient) sendConfigAck(ack common.ConfigAck) error {
+	return client.sendMessage(cbor.Tag{
+		Number: common.AgentMessageTag,
+		Content: common.AgentMessage[common.ConfigAck]{
+			Action: common.AcknowledgeConfig,
+			Data:   ack,
+		},
+	})
+}
+
+// sendUpdateStatus reports the progress of a self-update to the hub
+func (client *WebSocketClient) sendUpdateStatus(status common.UpdateStatus) error {
+	return client.sendMessage(cbor.Tag{
+		Number: common.AgentMessageTag,
+		Content: common.AgentMessage[common.UpdateStatus]{
+			Action: common.ReportUpdate,
+			Data:   status,
+		},
+	})
+}
+
+// sendIPChange reports a change of the public IP to the hub
+func (client *WebSocketClient) sendIPChange(change common.IPChange) error {
+	return client.sendMessage(cbor.Tag{
+		Number: common.AgentMessageTag,
+		Content: common.AgentMessage[common.IPChange]{
+			Action: common.ReportIPChange,
+			Data:   change,
+		},
+	})
+}
+
+// sendHeartbeat reports the health of the agent's schedulers to the hub
+func (client *WebSocketClient) sendHeartbeat(heartbeat common.Heartbeat) error {
+	return client.sendMessage(cbor.Tag{
+		Number: common.AgentMessageTag,
+		Content: common.AgentMessage[common.Heartbeat]{
+			Action: common.ReportHeartbeat,
+			Data:   heartbeat,
+		},
+	})
+}
+
+// deflatedSize returns the size of data compressed like the WebSocket connection does,
+// measuring the compression of messages for the debug log
+func deflatedSize(data []byte) int {
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.BestSpeed)
+	_, _ = w.Write(data)
+	_ = w.Close()
+	return buf.Len()
+}
+
 // getUserAgent returns one of two User-Agent strings based on current time.
 // This is used to avoid being blocked by Cloudflare or other anti-bot measures.
 func getUserAgent() string {
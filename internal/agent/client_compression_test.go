@@ -0,0 +1,48 @@
+package agent
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lxzan/gws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSocketClientCompression(t *testing.T) {
+	const authKey = "base64:dGVzdC1hdXRoLWtleQ=="
+	agent, err := NewAgent(t.TempDir())
+	require.NoError(t, err)
+	agent.authKey = authKey
+	agent.connectionManager.eventChan = make(chan ConnectionEvent, 1)
+
+	for _, hubCompression := range []bool{true, false} {
+		hub := &mockHub{authKey: authKey, connected: make(chan *gws.Conn, 1)}
+		upgrader := gws.NewUpgrader(hub, &gws.ServerOption{PermessageDeflate: gws.PermessageDeflate{Enabled: hubCompression}})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if conn, err := upgrader.Upgrade(w, r); err == nil {
+				go conn.ReadLoop()
+			}
+		}))
+
+		t.Setenv("BESZEL_AGENT_HUB_URL", server.URL)
+		t.Setenv("BESZEL_AGENT_TOKEN", "test-token")
+		client, err := newWebSocketClient(agent)
+		require.NoError(t, err)
+		require.NoError(t, client.Connect())
+		// hubs without compression support still get the messages, uncompressed
+		assert.Equal(t, hubCompression, client.compression)
+		<-agent.connectionManager.eventChan
+		<-hub.connected
+
+		client.Close()
+		server.Close()
+	}
+}
+
+func TestDeflatedSize(t *testing.T) {
+	data := bytes.Repeat([]byte("example.com@8.8.8.8#A"), 100)
+	assert.Less(t, deflatedSize(data), len(data)/10)
+}
@@ -2,15 +2,25 @@
 package agent
 
 import (
+	"beszel/internal/common"
 	"beszel/internal/entities/system"
+	"cmp"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"math/bits"
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/robfig/cron/v3"
 )
 
 // ConfigCache provides thread-safe caching of monitoring configurations
@@ -125,12 +135,16 @@ func (cc *ConfigCache) calculateConfigHash(config *system.MonitoringConfig) stri
 	// Create a deterministic representation of the config
 	configData := map[string]interface{}{
 		"enabled": map[string]bool{
-			"ping":      config.Enabled.Ping,
-			"dns":       config.Enabled.Dns,
-			"http":      config.Enabled.Http,
-			"speedtest": config.Enabled.Speedtest,
+			"ping":       config.Enabled.Ping,
+			"dns":        config.Enabled.Dns,
+			"http":       config.Enabled.Http,
+			"speedtest":  config.Enabled.Speedtest,
+			"traceroute": config.Enabled.Traceroute,
+			"snmp":       config.Enabled.Snmp,
 		},
 		"global_interval": config.GlobalInterval,
+		"cron_seconds":    config.CronSeconds,
+		"jitter":          config.Jitter,
 		"ping": map[string]interface{}{
 			"targets":  config.Ping.Targets,
 			"interval": config.Ping.Interval,
@@ -147,6 +161,14 @@ func (cc *ConfigCache) calculateConfigHash(config *system.MonitoringConfig) stri
 			"targets":  config.Speedtest.Targets,
 			"interval": config.Speedtest.Interval,
 		},
+		"traceroute": map[string]interface{}{
+			"targets":  config.Traceroute.Targets,
+			"interval": config.Traceroute.Interval,
+		},
+		"snmp": map[string]interface{}{
+			"targets":  config.Snmp.Targets,
+			"interval": config.Snmp.Interval,
+		},
 	}
 
 	// Marshal to JSON for consistent hashing
@@ -166,6 +188,7 @@ type ConfigValidator struct {
 	maxTargets     int
 	maxInterval    time.Duration
 	allowedDomains []string
+	isLocalAddr    func(ip net.IP) bool // Whether a DNS source IP is assigned to this host, nil skips the check
 }
 
 // NewConfigValidator creates a new configuration validator
@@ -185,12 +208,33 @@ func (cv *ConfigValidator) ValidateConfig(config *system.MonitoringConfig) error
 	if len(config.Ping.Targets) > cv.maxTargets {
 		errors = append(errors, fmt.Sprintf("too many ping targets: %d > %d", len(config.Ping.Targets), cv.maxTargets))
 	}
+	for _, target := range config.Ping.Targets {
+		errors = append(errors, pingTargetErrors(target)...)
+	}
+
+	// Validate HTTP targets
+	for _, target := range config.Http.Targets {
+		errors = append(errors, httpTargetErrors(target)...)
+	}
 
 	// Validate DNS targets
 	for _, target := range config.Dns.Targets {
-		if !cv.isAllowedDomain(target.Domain) {
-			errors = append(errors, fmt.Sprintf("domain not allowed: %s", target.Domain))
-		}
+		errors = append(errors, cv.dnsTargetErrors(target)...)
+	}
+
+	// Validate SNMP targets
+	for _, target := range config.Snmp.Targets {
+		errors = append(errors, snmpTargetErrors(target)...)
+	}
+
+	// Validate speedtest targets
+	for _, target := range config.Speedtest.Targets {
+		errors = append(errors, speedtestTargetErrors(target)...)
+	}
+
+	// Validate traceroute targets
+	for _, target := range config.Traceroute.Targets {
+		errors = append(errors, tracerouteTargetErrors(target)...)
 	}
 
 	// Validate global interval (could be cron expression or duration)
@@ -198,7 +242,7 @@ func (cv *ConfigValidator) ValidateConfig(config *system.MonitoringConfig) error
 		// Try to parse as duration first
 		if _, err := time.ParseDuration(config.GlobalInterval); err != nil {
 			// If not a duration, check if it's a valid cron expression
-			if !cv.isValidCronExpression(config.GlobalInterval) {
+			if !cv.isValidCronExpression(config.GlobalInterval, config.CronSeconds) {
 				errors = append(errors, fmt.Sprintf("invalid global interval: %s", config.GlobalInterval))
 			}
 		}
@@ -206,29 +250,48 @@ func (cv *ConfigValidator) ValidateConfig(config *system.MonitoringConfig) error
 
 	// Validate individual service intervals (cron expressions)
 	if config.Ping.Interval != "" {
-		if !cv.isValidCronExpression(config.Ping.Interval) {
+		if !cv.isValidCronExpression(config.Ping.Interval, config.CronSeconds) {
 			errors = append(errors, fmt.Sprintf("invalid ping interval: %s", config.Ping.Interval))
 		}
 	}
 
 	if config.Dns.Interval != "" {
-		if !cv.isValidCronExpression(config.Dns.Interval) {
+		if !cv.isValidCronExpression(config.Dns.Interval, config.CronSeconds) {
 			errors = append(errors, fmt.Sprintf("invalid DNS interval: %s", config.Dns.Interval))
 		}
 	}
 
 	if config.Http.Interval != "" {
-		if !cv.isValidCronExpression(config.Http.Interval) {
+		if !cv.isValidCronExpression(config.Http.Interval, config.CronSeconds) {
 			errors = append(errors, fmt.Sprintf("invalid HTTP interval: %s", config.Http.Interval))
 		}
 	}
 
 	if config.Speedtest.Interval != "" {
-		if !cv.isValidCronExpression(config.Speedtest.Interval) {
+		if !cv.isValidCronExpression(config.Speedtest.Interval, config.CronSeconds) {
 			errors = append(errors, fmt.Sprintf("invalid speedtest interval: %s", config.Speedtest.Interval))
 		}
 	}
 
+	// with a seconds field speedtests could run every few seconds, they may run at most once a minute
+	if config.CronSeconds && config.Enabled.Speedtest && len(config.Speedtest.Targets) > 0 {
+		if interval := cmp.Or(config.Speedtest.Interval, config.GlobalInterval); runsMoreOftenThanMinutely(interval) {
+			errors = append(errors, fmt.Sprintf("speedtest interval runs more than once a minute: %s", interval))
+		}
+	}
+
+	if config.Traceroute.Interval != "" {
+		if !cv.isValidCronExpression(config.Traceroute.Interval, config.CronSeconds) {
+			errors = append(errors, fmt.Sprintf("invalid traceroute interval: %s", config.Traceroute.Interval))
+		}
+	}
+
+	if config.Snmp.Interval != "" {
+		if !cv.isValidCronExpression(config.Snmp.Interval, config.CronSeconds) {
+			errors = append(errors, fmt.Sprintf("invalid SNMP interval: %s", config.Snmp.Interval))
+		}
+	}
+
 	if len(errors) > 0 {
 		return fmt.Errorf("configuration validation failed: %s", strings.Join(errors, "; "))
 	}
@@ -236,6 +299,194 @@ func (cv *ConfigValidator) ValidateConfig(config *system.MonitoringConfig) error
 	return nil
 }
 
+// RejectInvalidTargets removes the targets that fail validation from the configuration, so the
+// valid ones can still be applied, and returns the acknowledgement reporting them to the hub.
+// Ping targets above the maximum are rejected as well. Only targets of enabled services are
+// reported, the others are never applied.
+func (cv *ConfigValidator) RejectInvalidTargets(config *system.MonitoringConfig) common.ConfigAck {
+	var ack common.ConfigAck
+	reject := func(enabled bool, service, target string, reasons []string) bool {
+		if len(reasons) == 0 {
+			return false
+		}
+		if enabled {
+			ack.Rejected = append(ack.Rejected, common.RejectedTarget{Service: service, Target: target, Reason: strings.Join(reasons, "; ")})
+		}
+		return true
+	}
+
+	enabled := config.Enabled
+	config.Ping.Targets = slices.DeleteFunc(config.Ping.Targets, func(target system.PingTarget) bool {
+		return reject(enabled.Ping, common.ServicePing, target.Host, pingTargetErrors(target))
+	})
+	if len(config.Ping.Targets) > cv.maxTargets {
+		for _, target := range config.Ping.Targets[cv.maxTargets:] {
+			reject(enabled.Ping, common.ServicePing, target.Host, []string{fmt.Sprintf("too many ping targets, at most %d are monitored", cv.maxTargets)})
+		}
+		config.Ping.Targets = config.Ping.Targets[:cv.maxTargets]
+	}
+	config.Dns.Targets = slices.DeleteFunc(config.Dns.Targets, func(target system.DnsTarget) bool {
+		return reject(enabled.Dns, common.ServiceDns, dnsTargetKey(target), cv.dnsTargetErrors(target))
+	})
+	config.Http.Targets = slices.DeleteFunc(config.Http.Targets, func(target system.HttpTarget) bool {
+		return reject(enabled.Http, common.ServiceHttp, target.URL, httpTargetErrors(target))
+	})
+	config.Snmp.Targets = slices.DeleteFunc(config.Snmp.Targets, func(target system.SnmpTarget) bool {
+		return reject(enabled.Snmp, common.ServiceSnmp, target.Host, snmpTargetErrors(target))
+	})
+	config.Speedtest.Targets = slices.DeleteFunc(config.Speedtest.Targets, func(target system.SpeedtestTarget) bool {
+		key := speedtestTargetKey(target, cmp.Or(strings.ToLower(target.Provider), speedtestProviderOokla))
+		return reject(enabled.Speedtest, common.ServiceSpeedtest, key, speedtestTargetErrors(target))
+	})
+	config.Traceroute.Targets = slices.DeleteFunc(config.Traceroute.Targets, func(target system.TracerouteTarget) bool {
+		return reject(enabled.Traceroute, common.ServiceTraceroute, target.Host, tracerouteTargetErrors(target))
+	})
+
+	if enabled.Ping {
+		ack.Applied += len(config.Ping.Targets)
+	}
+	if enabled.Dns {
+		ack.Applied += len(config.Dns.Targets)
+	}
+	if enabled.Http {
+		ack.Applied += len(config.Http.Targets)
+	}
+	if enabled.Speedtest {
+		ack.Applied += len(config.Speedtest.Targets)
+	}
+	if enabled.Traceroute {
+		ack.Applied += len(config.Traceroute.Targets)
+	}
+	if enabled.Snmp {
+		ack.Applied += len(config.Snmp.Targets)
+	}
+	ack.Total = ack.Applied + len(ack.Rejected)
+	return ack
+}
+
+// pingTargetErrors returns the problems of a ping target
+func pingTargetErrors(target system.PingTarget) []string {
+	var errors []string
+	if target.PacketSize != 0 && (target.PacketSize < minPingPacketSize || target.PacketSize > maxPingPacketSize) {
+		errors = append(errors, fmt.Sprintf("invalid ping packet size for %s: %d (must be %d-%d)", target.Host, target.PacketSize, minPingPacketSize, maxPingPacketSize))
+	}
+	if target.IntervalMs != 0 && target.IntervalMs < minPingIntervalMs {
+		errors = append(errors, fmt.Sprintf("invalid ping interval for %s: %dms (must be at least %dms)", target.Host, target.IntervalMs, minPingIntervalMs))
+	}
+	return errors
+}
+
+// httpTargetErrors returns the problems of an HTTP target
+func httpTargetErrors(target system.HttpTarget) []string {
+	var errors []string
+	for _, code := range target.ExpectedStatusCodes {
+		if code < 100 || code > 599 {
+			errors = append(errors, fmt.Sprintf("invalid expected status code for %s: %d", target.URL, code))
+		}
+	}
+	if target.BodyMatch != "" {
+		if _, err := regexp.Compile(target.BodyMatch); err != nil {
+			errors = append(errors, fmt.Sprintf("invalid body match for %s: %v", target.URL, err))
+		}
+	}
+	if target.MaxDownloadBytes < 0 {
+		errors = append(errors, fmt.Sprintf("invalid max download bytes for %s: %d", target.URL, target.MaxDownloadBytes))
+	}
+	if target.ProxyURL != "" {
+		if _, err := parseProxyURL(target.ProxyURL); err != nil {
+			errors = append(errors, fmt.Sprintf("invalid proxy for %s: %v", target.URL, err))
+		}
+	}
+	return errors
+}
+
+// snmpTargetErrors returns the problems of an SNMP target
+func snmpTargetErrors(target system.SnmpTarget) []string {
+	if err := snmpTargetError(target); err != nil {
+		return []string{fmt.Sprintf("invalid SNMP target %s: %v", target.Host, err)}
+	}
+	return nil
+}
+
+// speedtestTargetErrors returns the problems of a speedtest target
+func speedtestTargetErrors(target system.SpeedtestTarget) []string {
+	if target.Retries != nil && (*target.Retries < 0 || *target.Retries > maxSpeedtestRetries) {
+		return []string{fmt.Sprintf("invalid speedtest retries: %d (must be 0-%d)", *target.Retries, maxSpeedtestRetries)}
+	}
+	return nil
+}
+
+// tracerouteTargetErrors returns the problems of a traceroute target
+func tracerouteTargetErrors(target system.TracerouteTarget) []string {
+	if target.Host == "" {
+		return []string{"missing traceroute host"}
+	}
+	// the host is an argument of mtr and traceroute, which would read it as an option
+	if strings.HasPrefix(target.Host, "-") {
+		return []string{fmt.Sprintf("invalid traceroute host: %s", target.Host)}
+	}
+	return nil
+}
+
+// dnsTargetErrors returns the problems of a DNS target
+func (cv *ConfigValidator) dnsTargetErrors(target system.DnsTarget) []string {
+	var errors []string
+	if !cv.isAllowedDomain(target.Domain) {
+		errors = append(errors, fmt.Sprintf("domain not allowed: %s", target.Domain))
+	}
+	if err := validateDnsServer(target.Server, target.Protocol); target.Server != "" && err != nil {
+		errors = append(errors, fmt.Sprintf("invalid DNS server for %s: %v", target.Domain, err))
+	}
+	if len(target.Servers) == 1 {
+		errors = append(errors, fmt.Sprintf("resolver comparison for %s needs at least two servers", target.Domain))
+	}
+	for _, server := range target.Servers {
+		if err := validateDnsServer(server, target.Protocol); err != nil {
+			errors = append(errors, fmt.Sprintf("invalid DNS server for %s: %v", target.Domain, err))
+		}
+	}
+	if target.SourceIP != "" {
+		if ip := net.ParseIP(target.SourceIP); ip == nil {
+			errors = append(errors, fmt.Sprintf("invalid source IP for %s: %s", target.Domain, target.SourceIP))
+		} else if cv.isLocalAddr != nil && !cv.isLocalAddr(ip) {
+			errors = append(errors, fmt.Sprintf("source IP for %s not assigned to this host: %s", target.Domain, target.SourceIP))
+		}
+	}
+	return errors
+}
+
+// validateDnsServer checks that a DNS server can be queried over the protocol. DNS over HTTPS
+// needs a URL, the other protocols a host with an optional port.
+func validateDnsServer(server, protocol string) error {
+	switch protocol {
+	case "doh":
+		u, err := url.Parse(server)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("%q is not an http(s) URL", server)
+		}
+		return nil
+	case "", "udp", "tcp", "dot":
+	default:
+		return fmt.Errorf("unknown protocol %q", protocol)
+	}
+
+	host := server
+	if strings.Contains(server, ":") {
+		var port string
+		var err error
+		if host, port, err = net.SplitHostPort(server); err != nil {
+			return fmt.Errorf("%q is not a host with an optional port, IPv6 addresses need brackets", server)
+		}
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("invalid port %q", port)
+		}
+	}
+	if host == "" || strings.ContainsAny(host, " /") {
+		return fmt.Errorf("invalid host %q", host)
+	}
+	return nil
+}
+
 // isAllowedDomain checks if a domain is in the allowed list
 func (cv *ConfigValidator) isAllowedDomain(domain string) bool {
 	if len(cv.allowedDomains) == 0 {
@@ -250,28 +501,22 @@ func (cv *ConfigValidator) isAllowedDomain(domain string) bool {
 	return false
 }
 
-// isValidCronExpression checks if a string is a valid cron expression
-func (cv *ConfigValidator) isValidCronExpression(expression string) bool {
-	// Basic cron expression validation
-	// Cron expressions have 5 or 6 fields: minute hour day month weekday [year]
-	parts := strings.Fields(expression)
-	if len(parts) != 5 && len(parts) != 6 {
-		return false
-	}
+// isValidCronExpression checks if a string is a cron expression the managers can schedule,
+// with a leading seconds field if seconds is set
+func (cv *ConfigValidator) isValidCronExpression(expression string, seconds bool) bool {
+	_, err := cronParser(seconds).Parse(expression)
+	return err == nil
+}
 
-	// Simple validation - check if it looks like a cron expression
-	// This is a basic check, in production you might want more sophisticated validation
-	for _, part := range parts {
-		if part == "" {
-			return false
-		}
-		// Check for common cron patterns: *, /, -, numbers
-		if !strings.ContainsAny(part, "*/0123456789-,") {
-			return false
-		}
+// runsMoreOftenThanMinutely reports whether a cron expression with a seconds field matches
+// more than one second of a minute. Invalid expressions are reported by isValidCronExpression.
+func runsMoreOftenThanMinutely(expression string) bool {
+	schedule, err := cronParser(true).Parse(expression)
+	if err != nil {
+		return false
 	}
-
-	return true
+	spec, ok := schedule.(*cron.SpecSchedule)
+	return ok && bits.OnesCount64(spec.Second&(1<<60-1)) > 1
 }
 
 // ConfigurationVersion tracks configuration changes
@@ -0,0 +1,135 @@
+package agent
+
+import (
+	"beszel/internal/common"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/lxzan/gws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconnectDelay(t *testing.T) {
+	for attempts, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 32 * time.Second, time.Minute} {
+		for range 20 {
+			delay := reconnectDelay(attempts)
+			assert.GreaterOrEqual(t, delay, want/2)
+			assert.LessOrEqual(t, delay, want)
+		}
+	}
+	// the delay stays capped instead of overflowing
+	assert.LessOrEqual(t, reconnectDelay(100), reconnectMaxDelay)
+	assert.GreaterOrEqual(t, reconnectDelay(100), reconnectMaxDelay/2)
+}
+
+// mockHub authenticates agents like the hub and reports the verified connections.
+// Messages initiated by the agent are passed to messages if it is set.
+type mockHub struct {
+	gws.BuiltinEventHandler
+	authKey   string
+	connected chan *gws.Conn
+	messages  chan []byte
+}
+
+func (h *mockHub) OnOpen(conn *gws.Conn) {
+	data, _ := cbor.Marshal(common.HubRequest[common.FingerprintRequest]{
+		Action: common.CheckFingerprint,
+		Data:   common.FingerprintRequest{JWTToken: h.authKey},
+	})
+	_ = conn.WriteMessage(gws.OpcodeBinary, data)
+}
+
+func (h *mockHub) OnMessage(conn *gws.Conn, message *gws.Message) {
+	defer message.Close()
+	if data := message.Data.Bytes(); len(data) > 0 && data[0]>>5 == 6 {
+		if h.messages != nil {
+			h.messages <- bytes.Clone(data)
+		}
+		return
+	}
+	var response common.FingerprintResponse
+	if cbor.Unmarshal(message.Data.Bytes(), &response) == nil && response.Fingerprint != "" {
+		h.connected <- conn
+	}
+}
+
+func TestConnectionManagerReconnects(t *testing.T) {
+	originalBase, originalMax := reconnectBaseDelay, reconnectMaxDelay
+	reconnectBaseDelay, reconnectMaxDelay = 300*time.Millisecond, 600*time.Millisecond
+	t.Cleanup(func() { reconnectBaseDelay, reconnectMaxDelay = originalBase, originalMax })
+
+	const authKey = "base64:dGVzdC1hdXRoLWtleQ=="
+	hub := &mockHub{authKey: authKey, connected: make(chan *gws.Conn, 10)}
+	upgrader := gws.NewUpgrader(hub, &gws.ServerOption{})
+	// while the hub is down, connection attempts are rejected
+	var down atomic.Bool
+	rejected := make(chan struct{}, 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			rejected <- struct{}{}
+			http.Error(w, "hub restarting", http.StatusServiceUnavailable)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		go conn.ReadLoop()
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv("BESZEL_AGENT_HUB_URL", server.URL)
+	t.Setenv("BESZEL_AGENT_TOKEN", "test-token")
+	agent, err := NewAgent(t.TempDir())
+	require.NoError(t, err)
+	agent.authKey = authKey
+	cm := agent.connectionManager
+	cm.wsClient, err = newWebSocketClient(agent)
+	require.NoError(t, err)
+	cm.eventChan = make(chan ConnectionEvent, 1)
+
+	sigChan := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = cm.run(sigChan)
+	}()
+	defer func() {
+		sigChan <- syscall.SIGTERM
+		<-done
+	}()
+
+	waitFor := func(ch <-chan *gws.Conn) *gws.Conn {
+		select {
+		case conn := <-ch:
+			return conn
+		case <-time.After(5 * time.Second):
+			t.Fatal("agent did not connect")
+			return nil
+		}
+	}
+	conn := waitFor(hub.connected)
+
+	// the hub goes down and rejects the agent's attempts to reconnect
+	down.Store(true)
+	_ = conn.WriteClose(1001, nil)
+	for range 2 {
+		select {
+		case <-rejected:
+		case <-time.After(5 * time.Second):
+			t.Fatal("agent did not try to reconnect")
+		}
+	}
+
+	// once the hub is back, the agent connects again
+	down.Store(false)
+	waitFor(hub.connected)
+}
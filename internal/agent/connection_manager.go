@@ -2,16 +2,21 @@ package agent
 
 import (
 	"beszel/internal/agent/health"
+	"beszel/internal/agent/maintenance"
+	"beszel/internal/common"
 	"errors"
 	"log/slog"
+	"math/rand/v2"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 )
 
 // ConnectionManager manages the connection state and events for the agent.
-// It handles WebSocket connections and manages reconnection attempts.
+// It handles WebSocket connections and manages reconnection attempts. An agent reporting
+// to several hubs has a connection manager for each, see Start.
 type ConnectionManager struct {
 	agent        *Agent               // Reference to the parent agent
 	State        ConnectionState      // Current connection state
@@ -19,6 +24,14 @@ type ConnectionManager struct {
 	wsClient     *WebSocketClient     // WebSocket client for hub communication
 	wsTicker     *time.Ticker         // Ticker for WebSocket connection attempts
 	isConnecting bool                 // Prevents multiple simultaneous reconnection attempts
+
+	reconnectAttempts int // Connection attempts since the agent was last connected, for the backoff
+
+	maintenanceSent   bool      // Whether the maintenance state was sent on the current connection
+	maintenanceActive bool      // Last maintenance state sent to the hub
+	maintenanceUntil  time.Time // Last maintenance expiry sent to the hub
+
+	ipChangeSent int64 // Time of the latest public IP change sent to the hub
 }
 
 // ConnectionState represents the current connection state of the agent.
@@ -39,7 +52,18 @@ const (
 	WebSocketDisconnect                        // WebSocket connection lost
 )
 
-const wsTickerInterval = 10 * time.Second
+// Backoff of connection attempts. The delay doubles with each attempt from reconnectBaseDelay up to
+// reconnectMaxDelay and is randomized, so agents don't all reconnect at once after the hub restarts.
+var (
+	reconnectBaseDelay = time.Second
+	reconnectMaxDelay  = time.Minute
+)
+
+// minConnectInterval is the shortest time between connection attempts, closer ones are rejected
+const minConnectInterval = 250 * time.Millisecond
+
+// maintenanceCheckInterval is how often the maintenance file is checked for changes
+const maintenanceCheckInterval = 10 * time.Second
 
 // newConnectionManager creates a new connection manager for the given agent.
 func newConnectionManager(agent *Agent) *ConnectionManager {
@@ -50,13 +74,26 @@ func newConnectionManager(agent *Agent) *ConnectionManager {
 	return cm
 }
 
-// startWsTicker starts or resets the WebSocket connection attempt ticker.
-func (c *ConnectionManager) startWsTicker() {
+// startWsTicker starts or resets the WebSocket connection attempt ticker to the backoff
+// delay of the next attempt and returns the delay.
+func (c *ConnectionManager) startWsTicker() time.Duration {
+	delay := reconnectDelay(c.reconnectAttempts)
 	if c.wsTicker == nil {
-		c.wsTicker = time.NewTicker(wsTickerInterval)
+		c.wsTicker = time.NewTicker(delay)
 	} else {
-		c.wsTicker.Reset(wsTickerInterval)
+		c.wsTicker.Reset(delay)
 	}
+	return delay
+}
+
+// reconnectDelay returns the wait before the connection attempt following the given number of attempts.
+// Half of the delay is random.
+func reconnectDelay(attempts int) time.Duration {
+	delay := reconnectMaxDelay
+	if attempts < 32 {
+		delay = min(reconnectBaseDelay<<attempts, reconnectMaxDelay)
+	}
+	return delay/2 + rand.N(delay/2+1)
 }
 
 // stopWsTicker stops the WebSocket connection attempt ticker.
@@ -68,6 +105,8 @@ func (c *ConnectionManager) stopWsTicker() {
 
 // Start begins connection attempts and enters the main event loop.
 // It handles connection events, periodic health updates, and graceful shutdown.
+// The connection to the first hub is managed by c, further hubs get a connection
+// manager of their own that stops together with c.
 func (c *ConnectionManager) Start(serverOptions ServerOptions) error {
 	if c.eventChan != nil {
 		return errors.New("already started")
@@ -76,11 +115,10 @@ func (c *ConnectionManager) Start(serverOptions ServerOptions) error {
 	// Store the authentication key in the agent
 	c.agent.authKey = serverOptions.AuthKey
 
-	wsClient, err := newWebSocketClient(c.agent)
+	wsClients, err := newWebSocketClients(c.agent)
 	if err != nil {
 		slog.Warn("Error creating WebSocket client", "err", err)
 	}
-	c.wsClient = wsClient
 
 	c.eventChan = make(chan ConnectionEvent, 1)
 
@@ -88,21 +126,58 @@ func (c *ConnectionManager) Start(serverOptions ServerOptions) error {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
-	c.startWsTicker()
+	// the other hubs' managers shut down once stop is closed
+	stop := make(chan os.Signal)
+	var others sync.WaitGroup
+	defer others.Wait()
+	defer close(stop)
+	for i, wsClient := range wsClients {
+		if i == 0 {
+			c.wsClient = wsClient
+			continue
+		}
+		other := newConnectionManager(c.agent)
+		other.wsClient = wsClient
+		other.eventChan = make(chan ConnectionEvent, 1)
+		wsClient.connectionManager = other
+		others.Add(1)
+		go func() {
+			defer others.Done()
+			_ = other.run(stop)
+		}()
+	}
+	if len(wsClients) > 1 {
+		slog.Info("Reporting to several hubs", "hubs", len(wsClients))
+	}
+
+	return c.run(sigChan)
+}
+
+// run connects to the hub and handles connection events, periodic health updates
+// and reconnections until a signal is received on sigChan.
+func (c *ConnectionManager) run(sigChan <-chan os.Signal) error {
 	c.connect()
 
 	// update health status immediately and every 90 seconds
 	_ = health.Update()
 	healthTicker := time.Tick(90 * time.Second)
 
+	maintenanceTicker := time.Tick(maintenanceCheckInterval)
+	heartbeatTicker := time.Tick(heartbeatInterval)
+
 	for {
 		select {
 		case connectionEvent := <-c.eventChan:
 			c.handleEvent(connectionEvent)
 		case <-c.wsTicker.C:
-			_ = c.startWebSocketConnection()
+			c.reconnect()
 		case <-healthTicker:
 			_ = health.Update()
+		case <-maintenanceTicker:
+			c.syncMaintenance()
+		case <-heartbeatTicker:
+			c.sendHeartbeat()
+			c.syncIPChange()
 		case <-sigChan:
 			slog.Info("Shutting down")
 			c.closeWebSocket()
@@ -135,6 +210,13 @@ func (c *ConnectionManager) handleStateChange(newState ConnectionState) {
 		slog.Info("WebSocket connected", "host", c.wsClient.hubURL.Host)
 		c.stopWsTicker()
 		c.isConnecting = false
+		c.reconnectAttempts = 0
+		// the hub sends the monitoring configuration to every agent that connects
+		// always announce the maintenance state on a new connection
+		c.maintenanceSent = false
+		c.syncMaintenance()
+		c.sendHeartbeat()
+		c.syncIPChange()
 	case Disconnected:
 		if c.isConnecting {
 			// Already handling reconnection, avoid duplicate attempts
@@ -144,28 +226,32 @@ func (c *ConnectionManager) handleStateChange(newState ConnectionState) {
 		slog.Warn("Disconnected from hub")
 		// make sure old ws connection is closed
 		c.closeWebSocket()
-		// reconnect
-		go c.connect()
+		// reconnect with the backoff starting over from the base delay
+		c.reconnectAttempts = 0
+		delay := c.startWsTicker()
+		slog.Info("Reconnecting to hub", "retry_in", delay.Round(time.Millisecond))
 	}
 }
 
-// connect handles the connection logic with proper delays.
-// It attempts WebSocket connection only.
+// connect makes a connection attempt right away, further attempts follow the backoff
+// until the agent is connected.
 func (c *ConnectionManager) connect() {
 	c.isConnecting = true
-	defer func() {
-		c.isConnecting = false
-	}()
+	c.reconnect()
+}
 
-	if c.wsClient != nil && time.Since(c.wsClient.lastConnectAttempt) < 5*time.Second {
-		time.Sleep(5 * time.Second)
+// reconnect attempts to connect to the hub and schedules the next attempt with a longer delay.
+// The attempt is only stopped once the hub verified the connection, a connection the hub
+// closes during the handshake is retried as well.
+func (c *ConnectionManager) reconnect() {
+	if c.State != Disconnected {
+		return
 	}
-
-	// Try WebSocket connection
 	err := c.startWebSocketConnection()
+	c.reconnectAttempts++
+	delay := c.startWsTicker()
 	if err != nil {
-		slog.Warn("WebSocket connection failed, will retry", "err", err)
-		c.startWsTicker()
+		slog.Warn("WebSocket connection failed, will retry", "attempt", c.reconnectAttempts, "retry_in", delay.Round(time.Millisecond), "err", err)
 	}
 }
 
@@ -177,13 +263,13 @@ func (c *ConnectionManager) startWebSocketConnection() error {
 	if c.wsClient == nil {
 		return errors.New("WebSocket client not initialized")
 	}
-	if time.Since(c.wsClient.lastConnectAttempt) < 5*time.Second {
+	if time.Since(c.wsClient.lastConnectAttempt) < minConnectInterval {
 		return errors.New("already connecting")
 	}
 
+	slog.Debug("Connecting to hub", "attempt", c.reconnectAttempts+1)
 	err := c.wsClient.Connect()
 	if err != nil {
-		slog.Warn("WebSocket connection failed", "err", err)
 		c.closeWebSocket()
 	}
 	return err
@@ -195,3 +281,50 @@ func (c *ConnectionManager) closeWebSocket() {
 		c.wsClient.Close()
 	}
 }
+
+// sendHeartbeat reports the health of the agent's schedulers to the hub if it is connected
+func (c *ConnectionManager) sendHeartbeat() {
+	if c.State != WebSocketConnected || c.wsClient == nil {
+		return
+	}
+	if err := c.wsClient.sendHeartbeat(common.Heartbeat{Schedulers: c.agent.schedulerStatuses()}); err != nil {
+		slog.Debug("Failed to send heartbeat", "err", err)
+	}
+}
+
+// syncIPChange sends the latest change of the public IP to the hub if it wasn't sent yet
+func (c *ConnectionManager) syncIPChange() {
+	if c.State != WebSocketConnected || c.wsClient == nil {
+		return
+	}
+	change := c.agent.ipChange.Load()
+	if change == nil || change.Time <= c.ipChangeSent {
+		return
+	}
+	if err := c.wsClient.sendIPChange(*change); err != nil {
+		slog.Debug("Failed to send public IP change", "err", err)
+		return
+	}
+	c.ipChangeSent = change.Time
+}
+
+// syncMaintenance sends the maintenance state to the hub if it changed since it was last sent.
+func (c *ConnectionManager) syncMaintenance() {
+	if c.State != WebSocketConnected || c.wsClient == nil {
+		return
+	}
+	active, until := maintenance.Status()
+	if c.maintenanceSent && active == c.maintenanceActive && until.Equal(c.maintenanceUntil) {
+		return
+	}
+	if err := c.wsClient.sendMaintenance(active, until); err != nil {
+		slog.Warn("Failed to send maintenance state", "err", err)
+		return
+	}
+	if active != c.maintenanceActive || !c.maintenanceSent {
+		slog.Info("Maintenance mode", "active", active, "until", until)
+	}
+	c.maintenanceSent = true
+	c.maintenanceActive = active
+	c.maintenanceUntil = until
+}
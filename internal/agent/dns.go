@@ -7,7 +7,10 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/netip"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -23,11 +26,21 @@ type DnsManager struct {
 	ctx            context.Context
 	cancel         context.CancelFunc
 	cronScheduler  *cron.Cron
-	cronExpression string // Cron expression for DNS scheduling
+	cronExpression string          // Cron expression for DNS scheduling
+	cronSeconds    bool            // Whether the cron expression has a leading seconds field
+	sourcePorts    *PortRange      // Local port range for queries, nil uses OS assigned ports
+	buffer         resultBuffer    // Bounds results waiting for the hub
+	netns          *netns          // Network namespace queries are sent from, nil for the host namespace
+	lookupSlots    chan struct{}   // Semaphore bounding the number of concurrent lookups
+	scheduler      schedulerStatus // Health of the cron job, reported in heartbeats
 }
 
+// defaultMaxConcurrentLookups is the number of DNS lookups run at once by default
+const defaultMaxConcurrentLookups = 20
+
 type dnsTarget struct {
 	system.DnsTarget
+	sourceIP   net.IP // Parsed SourceIP, nil lets the OS choose the address
 	lastLookup time.Time
 }
 
@@ -38,9 +51,11 @@ func NewDnsManager() (*DnsManager, error) {
 	dm := &DnsManager{
 		targets:        make(map[string]*dnsTarget),
 		results:        make(map[string]*system.DnsResult),
+		buffer:         newResultBuffer(),
+		lookupSlots:    make(chan struct{}, defaultMaxConcurrentLookups),
 		ctx:            ctx,
 		cancel:         cancel,
-		cronScheduler:  cron.New(cron.WithParser(cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow))),
+		cronScheduler:  cron.New(cron.WithParser(cronParser(false))),
 		cronExpression: "", // Will be set by hub configuration (5-field format: minute hour day month weekday)
 	}
 
@@ -60,26 +75,19 @@ func (dm *DnsManager) UpdateConfig(targets []system.DnsTarget, cronExpression st
 	dm.Lock()
 	defer dm.Unlock()
 
-	oldTargetsCount := len(dm.targets)
-	oldResultsCount := len(dm.results)
-	
-	slog.Debug("UpdateConfig called", "old_targets", oldTargetsCount, "new_targets", len(targets), "cron_expression", cronExpression)
+	slog.Debug("UpdateConfig called", "old_targets", len(dm.targets), "new_targets", len(targets), "cron_expression", cronExpression)
 
 	// Update cron expression
 	dm.cronExpression = cronExpression
 
-	// Clear existing targets and results to prevent stale data
+	// Replace the targets, results are pruned below once the new targets are known
 	dm.targets = make(map[string]*dnsTarget)
-	dm.results = make(map[string]*system.DnsResult)
-	
-	if oldTargetsCount > 0 || oldResultsCount > 0 {
-		slog.Info("Cleared old DNS configuration", "old_targets", oldTargetsCount, "old_results", oldResultsCount)
-	}
+	var localAddrs []net.Addr
 
 	// Add new targets
 	for _, target := range targets {
-		// Fix timeout: if it's less than 1 second, assume it's in seconds and convert
-		if target.Timeout < time.Second {
+		// Fix timeout: older hubs sent seconds as nanoseconds, which no real timeout is as short as
+		if target.Timeout > 0 && target.Timeout < time.Microsecond {
 			target.Timeout = target.Timeout * time.Second
 			slog.Debug("Converted timeout from seconds to duration", "original", target.Timeout/time.Second, "converted", target.Timeout)
 		}
@@ -92,24 +100,138 @@ func (dm *DnsManager) UpdateConfig(targets []system.DnsTarget, cronExpression st
 		if target.Protocol == "" {
 			target.Protocol = "udp" // Default to UDP
 		}
+		if target.ClientSubnet != "" {
+			if _, err := netip.ParsePrefix(target.ClientSubnet); err != nil {
+				slog.Warn("Ignoring invalid DNS client subnet", "domain", target.Domain, "client_subnet", target.ClientSubnet, "err", err)
+				target.ClientSubnet = ""
+			}
+		}
 
-		// Create a unique key for this target
-		key := target.Domain + "@" + target.Server + "#" + target.Type
+		if len(target.Servers) == 1 {
+			slog.Warn("Ignoring DNS resolver comparison with a single server", "domain", target.Domain, "server", target.Servers[0])
+			continue
+		}
 
-		dm.targets[key] = &dnsTarget{
+		var sourceIP net.IP
+		if target.SourceIP != "" {
+			if localAddrs == nil {
+				localAddrs = dm.localAddrs()
+			}
+			if sourceIP = net.ParseIP(target.SourceIP); sourceIP == nil || !hasAddr(localAddrs, sourceIP) {
+				slog.Warn("Ignoring DNS target with a source IP not assigned to this host", "domain", target.Domain, "source_ip", target.SourceIP)
+				continue
+			}
+		}
+
+		dm.targets[dnsTargetKey(target)] = &dnsTarget{
 			DnsTarget:  target,
-			lastLookup: time.Time{}, // Will trigger immediate lookup
+			sourceIP:   sourceIP,
+			lastLookup: time.Time{}, // Not checked yet, the run started below checks it
 		}
 
 		slog.Debug("Added DNS target", "domain", target.Domain, "server", target.Server, "type", target.Type, "protocol", target.Protocol, "timeout", target.Timeout)
 	}
 
+	if dropped := pruneResults(&dm.buffer, dm.results, func(key string) bool { return dm.targets[key] != nil }); dropped > 0 {
+		slog.Info("Dropped results of removed DNS targets", "results", dropped)
+	}
+
 	// Reschedule the DNS job with new cron expression
 	dm.scheduleDnsJob()
 
+	// run the checks right away instead of waiting for the first scheduled run, unless neither the
+	// targets nor the schedule changed
+	if dm.scheduler.changed(targets, cronExpression) && len(dm.targets) > 0 && dm.cronExpression != "" {
+		go dm.scheduler.run(dm.checkDnsLookups)
+	}
+
 	slog.Debug("Updated DNS config", "targets", len(targets), "cron_expression", cronExpression)
 }
 
+// dnsTargetKey returns the key of the target's results. Resolver comparisons get their own
+// prefix, so they never share results with a lookup on a single server. Targets with a source
+// IP end with it, so the same lookup from several addresses keeps a result for each path.
+func dnsTargetKey(target system.DnsTarget) string {
+	key := target.Domain + "@" + target.Server + "#" + target.Type
+	if len(target.Servers) > 0 {
+		key = "compare:" + target.Domain + "@" + strings.Join(target.Servers, ",") + "#" + target.Type
+	}
+	if target.SourceIP != "" {
+		key += "%" + target.SourceIP
+	}
+	return key
+}
+
+// localAddrs returns the addresses of the interfaces in the network namespace queries are sent from.
+// Must be called with the lock held.
+func (dm *DnsManager) localAddrs() []net.Addr {
+	var addrs []net.Addr
+	err := dm.netns.run(func() (err error) {
+		addrs, err = net.InterfaceAddrs()
+		return err
+	})
+	if err != nil {
+		slog.Warn("Failed to list local addresses", "err", err)
+	}
+	return addrs
+}
+
+// isLocalAddr reports whether ip is assigned to an interface in the network namespace queries are sent from
+func (dm *DnsManager) isLocalAddr(ip net.IP) bool {
+	dm.RLock()
+	defer dm.RUnlock()
+	return hasAddr(dm.localAddrs(), ip)
+}
+
+// hasAddr reports whether ip is one of the interface addresses
+func hasAddr(addrs []net.Addr, ip net.IP) bool {
+	for _, addr := range addrs {
+		if prefix, ok := addr.(*net.IPNet); ok && prefix.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetMaxConcurrentLookups sets how many lookups run at once, values below 1 restore the default.
+// Runs already in progress keep their limit.
+func (dm *DnsManager) SetMaxConcurrentLookups(limit int) {
+	dm.Lock()
+	defer dm.Unlock()
+	if limit < 1 {
+		limit = defaultMaxConcurrentLookups
+	}
+	if cap(dm.lookupSlots) != limit {
+		dm.lookupSlots = make(chan struct{}, limit)
+	}
+}
+
+// SetCronSeconds sets whether cron expressions have a leading seconds field, used from the next UpdateConfig
+func (dm *DnsManager) SetCronSeconds(seconds bool) {
+	dm.Lock()
+	defer dm.Unlock()
+	dm.cronSeconds = seconds
+}
+
+// SetJitter sets the seed of the phase offsets spreading the targets of scheduled runs, empty runs them all at once
+func (dm *DnsManager) SetJitter(seed string) {
+	dm.scheduler.setJitter(seed)
+}
+
+// SetResultBufferSize sets how many uncollected results are kept before the oldest are dropped
+func (dm *DnsManager) SetResultBufferSize(size int) {
+	dm.Lock()
+	defer dm.Unlock()
+	dm.buffer.setSize(size)
+}
+
+// DroppedResults returns the number of DNS results dropped because the hub didn't collect them in time
+func (dm *DnsManager) DroppedResults() uint64 {
+	dm.RLock()
+	defer dm.RUnlock()
+	return dm.buffer.dropped
+}
+
 // GetResults returns the current DNS results and clears them after retrieval
 // Returns nil if no results are available (no DNS lookups have run recently)
 func (dm *DnsManager) GetResults() map[string]*system.DnsResult {
@@ -125,12 +247,18 @@ func (dm *DnsManager) GetResults() map[string]*system.DnsResult {
 	results := make(map[string]*system.DnsResult)
 	for key, result := range dm.results {
 		results[key] = &system.DnsResult{
-			Domain:      result.Domain,
-			Server:      result.Server,
-			Status:      result.Status,
-			LookupTime:  result.LookupTime,
-			ErrorCode:   result.ErrorCode,
-			LastChecked: result.LastChecked,
+			Domain:        result.Domain,
+			Server:        result.Server,
+			Type:          result.Type,
+			Status:        result.Status,
+			LookupTime:    result.LookupTime,
+			ErrorCode:     result.ErrorCode,
+			LastChecked:   result.LastChecked,
+			Answers:       result.Answers,
+			TTL:           result.TTL,
+			Authenticated: result.Authenticated,
+			ServerAnswers: result.ServerAnswers,
+			SourceIP:      result.SourceIP,
 		}
 	}
 
@@ -151,22 +279,26 @@ func (dm *DnsManager) Close() {
 func (dm *DnsManager) scheduleDnsJob() {
 	// Remove all existing jobs
 	dm.cronScheduler.Stop()
-	dm.cronScheduler = cron.New(cron.WithParser(cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)))
+	dm.cronScheduler = cron.New(cron.WithParser(cronParser(dm.cronSeconds)))
 	dm.cronScheduler.Start()
 
 	// Only schedule if we have a valid cron expression
 	if dm.cronExpression != "" {
 		entryID, err := dm.cronScheduler.AddFunc(dm.cronExpression, func() {
 			slog.Debug("Cron job triggered - running DNS lookups", "cron_expression", dm.cronExpression)
-			dm.checkDnsLookups()
+			if !dm.scheduler.runScheduled(dm.checkDnsLookups) {
+				slog.Warn("Skipping scheduled DNS lookups, the previous run is still going", "cron_expression", dm.cronExpression)
+			}
 		})
 		if err != nil {
 			slog.Error("Failed to schedule DNS job", "cron_expression", dm.cronExpression, "error", err)
 		} else {
 			slog.Debug("Scheduled DNS job", "cron_expression", dm.cronExpression, "entry_id", entryID)
 		}
+		dm.scheduler.scheduled(dm.cronScheduler.Entry(entryID).Schedule, err)
 	} else {
 		slog.Debug("No cron expression set, DNS job not scheduled")
+		dm.scheduler.scheduled(nil, nil)
 	}
 }
 
@@ -177,14 +309,21 @@ func (dm *DnsManager) checkDnsLookups() {
 	for _, target := range dm.targets {
 		targets = append(targets, target)
 	}
+	slots := dm.lookupSlots
 	dm.RUnlock()
 
-	// Lookup targets concurrently
+	// Lookup targets concurrently, at most as many at once as there are slots. A target
+	// takes its slot once its phase starts, so waiting targets don't hold back others.
 	var wg sync.WaitGroup
 	for _, target := range targets {
 		wg.Add(1)
 		go func(t *dnsTarget) {
 			defer wg.Done()
+			if !dm.scheduler.waitPhase(dm.ctx, dnsTargetKey(t.DnsTarget)) {
+				return
+			}
+			slots <- struct{}{}
+			defer func() { <-slots }()
 			dm.lookupTarget(t)
 		}(target)
 	}
@@ -203,13 +342,27 @@ func (dm *DnsManager) lookupTarget(target *dnsTarget) {
 		Type:        target.Type,
 		Status:      "testing",
 		LastChecked: time.Now(),
+		SourceIP:    target.SourceIP,
+	}
+	if len(target.Servers) > 0 {
+		result.Server = strings.Join(target.Servers, ",")
 	}
 
 	dm.performDnsLookup(target, result)
 }
 
-// performDnsLookup performs a DNS lookup using the appropriate protocol
+// performDnsLookup looks the target up, or compares the answers of its servers, and stores the result
 func (dm *DnsManager) performDnsLookup(target *dnsTarget, result *system.DnsResult) {
+	if len(target.Servers) > 0 {
+		dm.compareResolvers(target, result)
+	} else {
+		dm.resolve(target, result)
+	}
+	dm.updateResult(dnsTargetKey(target.DnsTarget), result)
+}
+
+// resolve performs a DNS lookup on the target's server using the appropriate protocol
+func (dm *DnsManager) resolve(target *dnsTarget, result *system.DnsResult) {
 	protocol := target.Protocol
 	if protocol == "" {
 		protocol = "udp" // Default to UDP
@@ -257,12 +410,173 @@ func (dm *DnsManager) performDnsLookup(target *dnsTarget, result *system.DnsResu
 	} else {
 		result.Status = "success"
 		result.LookupTime = float64(lookupTime)
-		slog.Debug("DNS lookup completed successfully", "domain", target.Domain, "server", target.Server, "protocol", protocol, "lookup_time", lookupTime)
+		qtype := dm.getDnsType(target.Type)
+		result.Answers = answerValues(resp, qtype)
+		result.TTL = minAnswerTTL(resp)
+		result.Authenticated = resp.AuthenticatedData
+		if len(target.ExpectedValues) > 0 && !answersExpected(result.Answers, target.ExpectedValues, qtype) {
+			result.Status = "mismatch"
+			result.ErrorCode = "unexpected answers: " + strings.Join(result.Answers, ", ")
+			slog.Debug("DNS lookup returned unexpected answers", "domain", target.Domain, "server", target.Server, "answers", result.Answers, "expected", target.ExpectedValues)
+		} else if target.DNSSEC && len(resp.Answer) > 0 && !resp.AuthenticatedData {
+			// the resolver didn't validate the data, the zone is unsigned or validation is off
+			result.Status = "insecure"
+			result.ErrorCode = "answer not authenticated"
+			slog.Debug("DNS lookup returned unauthenticated data", "domain", target.Domain, "server", target.Server, "protocol", protocol)
+		} else {
+			slog.Debug("DNS lookup completed successfully", "domain", target.Domain, "server", target.Server, "protocol", protocol, "lookup_time", lookupTime)
+		}
 	}
+}
 
-	// Create a unique key for this result
-	key := target.Domain + "@" + target.Server + "#" + target.Type
-	dm.updateResult(key, result)
+// compareResolvers looks the target up on each of its servers at once and compares the answers.
+// A server answering that the domain doesn't exist answered too, with its rcode as the answer,
+// only servers that couldn't be reached or didn't answer failed. The result is "divergent" when
+// servers answered differently, otherwise an error of a server or the status the servers agreed
+// on. Its answers are those of all servers.
+func (dm *DnsManager) compareResolvers(target *dnsTarget, result *system.DnsResult) {
+	results := make([]*system.DnsResult, len(target.Servers))
+	var wg sync.WaitGroup
+	for i, server := range target.Servers {
+		serverTarget := *target
+		serverTarget.Server = server
+		serverTarget.Servers = nil
+		results[i] = &system.DnsResult{Domain: target.Domain, Server: server, Type: target.Type}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dm.resolve(&serverTarget, results[i])
+		}()
+	}
+	wg.Wait()
+
+	qtype := dm.getDnsType(target.Type)
+	var reference []string // Normalized answers of the first server that answered
+	var divergent bool
+	var failed, answered []*system.DnsResult
+	result.Status = "success"
+	result.Authenticated = true
+	result.ServerAnswers = make(map[string][]string)
+	for _, r := range results {
+		result.LookupTime = max(result.LookupTime, r.LookupTime)
+		answers := r.Answers
+		if r.Status == "error" && r.ErrorCode == dns.RcodeToString[dns.RcodeNameError] {
+			answers = []string{r.ErrorCode}
+		} else if r.Status == "error" || r.Status == "timeout" {
+			failed = append(failed, r)
+			continue
+		}
+		answered = append(answered, r)
+		result.ServerAnswers[r.Server] = answers
+		for _, answer := range r.Answers {
+			if !slices.Contains(result.Answers, answer) {
+				result.Answers = append(result.Answers, answer)
+			}
+		}
+		if result.TTL == 0 || (r.TTL > 0 && r.TTL < result.TTL) {
+			result.TTL = r.TTL
+		}
+		result.Authenticated = result.Authenticated && r.Authenticated
+		if r.Status != "success" && result.Status == "success" {
+			result.Status, result.ErrorCode = r.Status, r.ErrorCode
+		}
+
+		normalized := make([]string, len(answers))
+		for i, answer := range answers {
+			normalized[i] = normalizeAnswer(answer, qtype)
+		}
+		slices.Sort(normalized)
+		normalized = slices.Compact(normalized)
+		if reference == nil {
+			reference = normalized
+		} else if !slices.Equal(reference, normalized) {
+			divergent = true
+		}
+	}
+	result.Authenticated = result.Authenticated && len(answered) > 0
+
+	switch {
+	case divergent:
+		details := make([]string, len(answered))
+		for i, r := range answered {
+			details[i] = r.Server + ": " + strings.Join(result.ServerAnswers[r.Server], ", ")
+		}
+		result.Status = "divergent"
+		result.ErrorCode = "answers differ: " + strings.Join(details, "; ")
+		slog.Debug("DNS resolvers answered differently", "domain", target.Domain, "answers", result.ServerAnswers)
+	case len(failed) > 0:
+		details := make([]string, len(failed))
+		for i, r := range failed {
+			details[i] = r.Server + ": " + r.ErrorCode
+		}
+		result.Status = failed[0].Status
+		result.ErrorCode = strings.Join(details, "; ")
+	}
+}
+
+// answerValues returns the values of the answer records: addresses of A and AAAA records,
+// hosts of CNAME and MX records and the joined strings of TXT records. CNAME records are
+// only included for CNAME queries, as other queries return them for the alias chain.
+func answerValues(resp *dns.Msg, qtype uint16) []string {
+	var values []string
+	for _, rr := range resp.Answer {
+		switch record := rr.(type) {
+		case *dns.A:
+			values = append(values, record.A.String())
+		case *dns.AAAA:
+			values = append(values, record.AAAA.String())
+		case *dns.CNAME:
+			if qtype == dns.TypeCNAME {
+				values = append(values, strings.TrimSuffix(record.Target, "."))
+			}
+		case *dns.MX:
+			values = append(values, strings.TrimSuffix(record.Mx, "."))
+		case *dns.TXT:
+			values = append(values, strings.Join(record.Txt, ""))
+		}
+	}
+	return values
+}
+
+// minAnswerTTL returns the lowest TTL of the answer records, 0 if there are none
+func minAnswerTTL(resp *dns.Msg) uint32 {
+	var ttl uint32
+	for i, rr := range resp.Answer {
+		if i == 0 || rr.Header().Ttl < ttl {
+			ttl = rr.Header().Ttl
+		}
+	}
+	return ttl
+}
+
+// answersExpected reports whether there are answers and each of them is one of the expected values.
+// TXT strings are compared as is, hosts case insensitively and addresses in their canonical form.
+func answersExpected(answers, expected []string, qtype uint16) bool {
+	if len(answers) == 0 {
+		return false
+	}
+	expectedSet := make(map[string]struct{}, len(expected))
+	for _, value := range expected {
+		expectedSet[normalizeAnswer(value, qtype)] = struct{}{}
+	}
+	for _, answer := range answers {
+		if _, ok := expectedSet[normalizeAnswer(answer, qtype)]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeAnswer returns the comparable form of an answer value of a query type
+func normalizeAnswer(value string, qtype uint16) string {
+	if qtype == dns.TypeTXT {
+		return value
+	}
+	value = strings.TrimSpace(value)
+	if addr, err := netip.ParseAddr(value); err == nil {
+		return addr.String()
+	}
+	return strings.ToLower(strings.TrimSuffix(value, "."))
 }
 
 // getDnsType converts string DNS type to miekg/dns type
@@ -293,6 +607,37 @@ func (dm *DnsManager) getDnsType(typeStr string) uint16 {
 	}
 }
 
+// newQuery creates the query message of a target, requesting DNSSEC records if the target validates them
+// and announcing its client subnet if set
+func (dm *DnsManager) newQuery(target *dnsTarget) *dns.Msg {
+	msg := &dns.Msg{}
+	msg.SetQuestion(dns.Fqdn(target.Domain), dm.getDnsType(target.Type))
+	msg.RecursionDesired = true
+	if target.DNSSEC || target.ClientSubnet != "" {
+		msg.SetEdns0(4096, target.DNSSEC)
+	}
+	// the subnet is validated in UpdateConfig
+	if prefix, err := netip.ParsePrefix(target.ClientSubnet); err == nil {
+		msg.IsEdns0().Option = append(msg.IsEdns0().Option, clientSubnetOption(prefix))
+	}
+	return msg
+}
+
+// clientSubnetOption returns the EDNS0 client subnet option (RFC 7871) announcing the prefix
+func clientSubnetOption(prefix netip.Prefix) *dns.EDNS0_SUBNET {
+	prefix = prefix.Masked()
+	family := uint16(1) // IPv4
+	if prefix.Addr().Is6() {
+		family = 2
+	}
+	return &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        family,
+		SourceNetmask: uint8(prefix.Bits()),
+		Address:       prefix.Addr().AsSlice(),
+	}
+}
+
 // performUDPLookup performs a DNS lookup using UDP
 func (dm *DnsManager) performUDPLookup(ctx context.Context, target *dnsTarget) (*dns.Msg, error) {
 	// Add default port (53) if no port is specified
@@ -306,17 +651,15 @@ func (dm *DnsManager) performUDPLookup(ctx context.Context, target *dnsTarget) (
 	client := &dns.Client{
 		Timeout: target.Timeout,
 		Net:     "udp",
+		Dialer:  sourceIPDialer(target, "udp"),
 	}
 
 	// Create a DNS message
-	msg := &dns.Msg{}
-	msg.SetQuestion(dns.Fqdn(target.Domain), dm.getDnsType(target.Type))
-	msg.RecursionDesired = true
+	msg := dm.newQuery(target)
 
 	// Perform the lookup
 	slog.Debug("Attempting UDP DNS lookup", "domain", target.Domain, "server", serverAddr, "timeout", target.Timeout)
-	resp, _, err := client.ExchangeContext(ctx, msg, serverAddr)
-	return resp, err
+	return dm.exchange(ctx, client, msg, serverAddr)
 }
 
 // performTCPLookup performs a DNS lookup using TCP
@@ -332,17 +675,15 @@ func (dm *DnsManager) performTCPLookup(ctx context.Context, target *dnsTarget) (
 	client := &dns.Client{
 		Timeout: target.Timeout,
 		Net:     "tcp",
+		Dialer:  sourceIPDialer(target, "tcp"),
 	}
 
 	// Create a DNS message
-	msg := &dns.Msg{}
-	msg.SetQuestion(dns.Fqdn(target.Domain), dm.getDnsType(target.Type))
-	msg.RecursionDesired = true
+	msg := dm.newQuery(target)
 
 	// Perform the lookup
 	slog.Debug("Attempting TCP DNS lookup", "domain", target.Domain, "server", serverAddr, "timeout", target.Timeout)
-	resp, _, err := client.ExchangeContext(ctx, msg, serverAddr)
-	return resp, err
+	return dm.exchange(ctx, client, msg, serverAddr)
 }
 
 // performDoTLookup performs a DNS lookup using DNS over TLS
@@ -358,26 +699,60 @@ func (dm *DnsManager) performDoTLookup(ctx context.Context, target *dnsTarget) (
 	client := &dns.Client{
 		Timeout: target.Timeout,
 		Net:     "tcp-tls",
+		Dialer:  sourceIPDialer(target, "tcp"),
 	}
 
 	// Create a DNS message
-	msg := &dns.Msg{}
-	msg.SetQuestion(dns.Fqdn(target.Domain), dm.getDnsType(target.Type))
-	msg.RecursionDesired = true
+	msg := dm.newQuery(target)
 
 	// Perform the lookup
 	slog.Debug("Attempting DoT DNS lookup", "domain", target.Domain, "server", serverAddr, "timeout", target.Timeout)
-	resp, _, err := client.ExchangeContext(ctx, msg, serverAddr)
-	return resp, err
+	return dm.exchange(ctx, client, msg, serverAddr)
 }
 
 // performDoHLookup performs a DNS lookup using DNS over HTTPS
 func (dm *DnsManager) performDoHLookup(ctx context.Context, target *dnsTarget) (*dns.Msg, error) {
 	// Create a DNS message
-	msg := &dns.Msg{}
-	msg.SetQuestion(dns.Fqdn(target.Domain), dm.getDnsType(target.Type))
-	msg.RecursionDesired = true
+	msg := dm.newQuery(target)
+
+	// Create HTTP client with timeout
+	client := &http.Client{
+		Timeout: target.Timeout,
+	}
+	dm.RLock()
+	ns := dm.netns
+	dm.RUnlock()
+	if ns != nil || target.sourceIP != nil {
+		dialer := sourceIPDialer(target, "tcp")
+		if dialer == nil {
+			dialer = &net.Dialer{Timeout: target.Timeout}
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.DialContext = ns.dialContext(dialer)
+		client.Transport = transport
+	}
 
+	slog.Debug("Attempting DoH lookup", "domain", target.Domain, "server", target.Server)
+	return exchangeDoH(ctx, client, target.Server, msg)
+}
+
+// sourceIPDialer returns a dialer sending from the target's source IP over the network,
+// or nil if the target has none
+func sourceIPDialer(target *dnsTarget, network string) *net.Dialer {
+	if target.sourceIP == nil {
+		return nil
+	}
+	dialer := &net.Dialer{Timeout: target.Timeout}
+	if network == "udp" {
+		dialer.LocalAddr = &net.UDPAddr{IP: target.sourceIP}
+	} else {
+		dialer.LocalAddr = &net.TCPAddr{IP: target.sourceIP}
+	}
+	return dialer
+}
+
+// exchangeDoH sends a DNS message to a DNS over HTTPS server and returns the response
+func exchangeDoH(ctx context.Context, client *http.Client, server string, msg *dns.Msg) (*dns.Msg, error) {
 	// Encode the DNS message to wire format
 	dnsWire, err := msg.Pack()
 	if err != nil {
@@ -387,14 +762,9 @@ func (dm *DnsManager) performDoHLookup(ctx context.Context, target *dnsTarget) (
 	// Encode to base64 for GET request or use raw bytes for POST
 	dnsBase64 := base64.RawURLEncoding.EncodeToString(dnsWire)
 
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: target.Timeout,
-	}
-
 	// Try GET method first (more widely supported)
-	getURL := target.Server + "?dns=" + dnsBase64
-	slog.Debug("Attempting DoH GET request", "domain", target.Domain, "server", target.Server, "url", getURL)
+	getURL := server + "?dns=" + dnsBase64
+	slog.Debug("Attempting DoH GET request", "server", server, "url", getURL)
 
 	req, err := http.NewRequestWithContext(ctx, "GET", getURL, nil)
 	if err != nil {
@@ -408,9 +778,9 @@ func (dm *DnsManager) performDoHLookup(ctx context.Context, target *dnsTarget) (
 	resp, err := client.Do(req)
 	if err != nil {
 		// If GET fails, try POST method
-		slog.Debug("DoH GET failed, trying POST", "domain", target.Domain, "server", target.Server, "error", err)
+		slog.Debug("DoH GET failed, trying POST", "server", server, "error", err)
 
-		req, err = http.NewRequestWithContext(ctx, "POST", target.Server, strings.NewReader(string(dnsWire)))
+		req, err = http.NewRequestWithContext(ctx, "POST", server, strings.NewReader(string(dnsWire)))
 		if err != nil {
 			return nil, fmt.Errorf("failed to create POST request: %w", err)
 		}
@@ -445,7 +815,7 @@ func (dm *DnsManager) performDoHLookup(ctx context.Context, target *dnsTarget) (
 		return nil, fmt.Errorf("failed to unpack DNS response: %w", err)
 	}
 
-	slog.Debug("DoH lookup completed", "domain", target.Domain, "server", target.Server, "response_rcode", dnsResp.Rcode)
+	slog.Debug("DoH lookup completed", "server", server, "response_rcode", dnsResp.Rcode)
 	return dnsResp, nil
 }
 
@@ -454,6 +824,6 @@ func (dm *DnsManager) updateResult(key string, result *system.DnsResult) {
 	dm.Lock()
 	defer dm.Unlock()
 	slog.Debug("Adding DNS result", "key", key, "status", result.Status, "lookup_time", result.LookupTime, "results_count_before", len(dm.results))
-	dm.results[key] = result
+	bufferResult(&dm.buffer, dm.results, key, result, func(r *system.DnsResult) time.Time { return r.LastChecked })
 	slog.Debug("DNS result updated", "key", key, "status", result.Status, "lookup_time", result.LookupTime, "results_count_after", len(dm.results))
 }
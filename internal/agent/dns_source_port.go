@@ -0,0 +1,150 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/miekg/dns"
+)
+
+// maxSourcePortAttempts limits how many ports in the range are tried when some are in use
+const maxSourcePortAttempts = 10
+
+// PortRange is an inclusive range of local ports
+type PortRange struct {
+	Min int
+	Max int
+}
+
+// ParsePortRange parses a range like "40000-40100" or a single port like "5353"
+func ParsePortRange(value string) (PortRange, error) {
+	minStr, maxStr, found := strings.Cut(strings.TrimSpace(value), "-")
+	if !found {
+		maxStr = minStr
+	}
+	minPort, err := strconv.Atoi(strings.TrimSpace(minStr))
+	if err != nil {
+		return PortRange{}, fmt.Errorf("invalid port range %q: %w", value, err)
+	}
+	maxPort, err := strconv.Atoi(strings.TrimSpace(maxStr))
+	if err != nil {
+		return PortRange{}, fmt.Errorf("invalid port range %q: %w", value, err)
+	}
+	if minPort < 1 || maxPort > 65535 || minPort > maxPort {
+		return PortRange{}, fmt.Errorf("invalid port range %q", value)
+	}
+	return PortRange{Min: minPort, Max: maxPort}, nil
+}
+
+// random returns a random port in the range
+func (r PortRange) random() int {
+	return r.Min + rand.IntN(r.Max-r.Min+1)
+}
+
+// newSourcePortRangeFromEnv reads DNS_SOURCE_PORT_RANGE, returning nil if it is not set or invalid
+func newSourcePortRangeFromEnv() *PortRange {
+	value, exists := GetEnv("DNS_SOURCE_PORT_RANGE")
+	if !exists || value == "" {
+		return nil
+	}
+	portRange, err := ParsePortRange(value)
+	if err != nil {
+		slog.Warn("Ignoring DNS_SOURCE_PORT_RANGE", "err", err)
+		return nil
+	}
+	slog.Info("Sending DNS queries from source ports", "min", portRange.Min, "max", portRange.Max)
+	return &portRange
+}
+
+// SetSourcePortRange binds DNS queries to a local port within the range, nil uses OS assigned ports.
+// DoH queries go through the HTTP client and are not affected.
+func (dm *DnsManager) SetSourcePortRange(portRange *PortRange) {
+	dm.Lock()
+	defer dm.Unlock()
+	dm.sourcePorts = portRange
+}
+
+// setNetns sets the network namespace queries are sent from, nil uses the host namespace.
+func (dm *DnsManager) setNetns(ns *netns) {
+	dm.Lock()
+	defer dm.Unlock()
+	dm.netns = ns
+}
+
+// sourcePortDialer returns a dialer bound to the local port for the DNS client network,
+// keeping the local IP of the template if it has one
+func sourcePortDialer(network string, port int, template *net.Dialer) *net.Dialer {
+	dialer := &net.Dialer{}
+	if template != nil {
+		*dialer = *template
+	}
+	var ip net.IP
+	switch addr := dialer.LocalAddr.(type) {
+	case *net.UDPAddr:
+		ip = addr.IP
+	case *net.TCPAddr:
+		ip = addr.IP
+	}
+	if network == "udp" {
+		dialer.LocalAddr = &net.UDPAddr{IP: ip, Port: port}
+	} else {
+		dialer.LocalAddr = &net.TCPAddr{IP: ip, Port: port}
+	}
+	return dialer
+}
+
+// exchange sends the query with the client, from a source port within the configured range if set
+func (dm *DnsManager) exchange(ctx context.Context, client *dns.Client, msg *dns.Msg, serverAddr string) (*dns.Msg, error) {
+	dm.RLock()
+	portRange := dm.sourcePorts
+	ns := dm.netns
+	dm.RUnlock()
+
+	if portRange == nil {
+		// the client dials in the calling goroutine, so the socket is opened in the namespace
+		var resp *dns.Msg
+		err := ns.run(func() (err error) {
+			resp, _, err = client.ExchangeContext(ctx, msg, serverAddr)
+			return err
+		})
+		return resp, err
+	}
+
+	network := client.Net
+	if network == "" {
+		network = "udp"
+	}
+	network = strings.TrimSuffix(network, "-tls")
+
+	template := client.Dialer
+	if template == nil {
+		template = &net.Dialer{Timeout: client.Timeout}
+	}
+	var conn *dns.Conn
+	var err error
+	for range min(maxSourcePortAttempts, portRange.Max-portRange.Min+1) {
+		client.Dialer = sourcePortDialer(network, portRange.random(), template)
+		err = ns.run(func() (err error) {
+			conn, err = client.DialContext(ctx, serverAddr)
+			return err
+		})
+		// try another port if this one is taken by another socket
+		if err == nil || !errors.Is(err, syscall.EADDRINUSE) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	resp, _, err := client.ExchangeWithConnContext(ctx, msg, conn)
+	return resp, err
+}
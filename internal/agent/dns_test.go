@@ -2,9 +2,15 @@ package agent
 
 import (
 	"beszel/internal/entities/system"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/miekg/dns"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -68,6 +74,38 @@ func TestDnsManager_UpdateConfig(t *testing.T) {
 	assert.Equal(t, "AAAA", target2.Type)
 	assert.Equal(t, 3*time.Second, target2.Timeout)
 	assert.Equal(t, "tcp", target2.Protocol)
+
+	// older hubs sent seconds, sub-second durations are kept
+	dm.UpdateConfig([]system.DnsTarget{
+		{Domain: "old.example.com", Server: "8.8.8.8", Type: "A", Timeout: 10},
+		{Domain: "fast.example.com", Server: "8.8.8.8", Type: "A", Timeout: 500 * time.Millisecond},
+	}, "")
+	assert.Equal(t, 10*time.Second, dm.targets["old.example.com@8.8.8.8#A"].Timeout)
+	assert.Equal(t, 500*time.Millisecond, dm.targets["fast.example.com@8.8.8.8#A"].Timeout)
+}
+
+func TestDnsManager_UpdateConfigKeepsResults(t *testing.T) {
+	dm, err := NewDnsManager()
+	require.NoError(t, err)
+	defer dm.Close()
+
+	dm.UpdateConfig([]system.DnsTarget{
+		{Domain: "google.com", Server: "8.8.8.8", Type: "A"},
+		{Domain: "cloudflare.com", Server: "1.1.1.1", Type: "AAAA"},
+	}, "")
+	dm.results["google.com@8.8.8.8#A"] = &system.DnsResult{Domain: "google.com", Status: "success", LastChecked: time.Now()}
+	dm.results["cloudflare.com@1.1.1.1#AAAA"] = &system.DnsResult{Domain: "cloudflare.com", Status: "success", LastChecked: time.Now()}
+
+	// google.com stays, cloudflare.com is removed and example.com added
+	dm.UpdateConfig([]system.DnsTarget{
+		{Domain: "google.com", Server: "8.8.8.8", Type: "A"},
+		{Domain: "example.com", Server: "8.8.8.8", Type: "A"},
+	}, "")
+
+	results := dm.GetResults()
+	assert.Len(t, results, 1)
+	require.Contains(t, results, "google.com@8.8.8.8#A")
+	assert.Equal(t, "success", results["google.com@8.8.8.8#A"].Status)
 }
 
 func TestDnsManager_GetResults(t *testing.T) {
@@ -221,3 +259,594 @@ func TestDnsManager_ConcurrentAccess(t *testing.T) {
 	assert.NotNil(t, results)
 	assert.Contains(t, results, "test")
 }
+
+func TestParsePortRange(t *testing.T) {
+	portRange, err := ParsePortRange("40000-40100")
+	require.NoError(t, err)
+	assert.Equal(t, PortRange{Min: 40000, Max: 40100}, portRange)
+
+	portRange, err = ParsePortRange("5353")
+	require.NoError(t, err)
+	assert.Equal(t, PortRange{Min: 5353, Max: 5353}, portRange)
+
+	for _, invalid := range []string{"", "abc", "100-50", "0-10", "60000-70000", "1-x"} {
+		_, err := ParsePortRange(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestDnsManager_SourcePortRange(t *testing.T) {
+	// local DNS server that answers with the source port the query came from
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		var port int
+		switch addr := w.RemoteAddr().(type) {
+		case *net.UDPAddr:
+			port = addr.Port
+		case *net.TCPAddr:
+			port = addr.Port
+		}
+		resp := new(dns.Msg)
+		resp.SetReply(r)
+		resp.Answer = append(resp.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+			Txt: []string{strconv.Itoa(port)},
+		})
+		w.WriteMsg(resp)
+	})
+
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	udpServer := &dns.Server{PacketConn: packetConn, Handler: handler}
+	go udpServer.ActivateAndServe()
+	defer udpServer.Shutdown()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	tcpServer := &dns.Server{Listener: listener, Handler: handler}
+	go tcpServer.ActivateAndServe()
+	defer tcpServer.Shutdown()
+
+	dm, err := NewDnsManager()
+	require.NoError(t, err)
+	defer dm.Close()
+
+	portRange := PortRange{Min: 42100, Max: 42199}
+	dm.SetSourcePortRange(&portRange)
+
+	sourcePort := func(t *testing.T, resp *dns.Msg) int {
+		require.NotNil(t, resp)
+		require.Len(t, resp.Answer, 1)
+		port, err := strconv.Atoi(resp.Answer[0].(*dns.TXT).Txt[0])
+		require.NoError(t, err)
+		return port
+	}
+
+	target := &dnsTarget{DnsTarget: system.DnsTarget{Domain: "example.com", Type: "TXT", Timeout: 2 * time.Second}}
+
+	t.Run("udp", func(t *testing.T) {
+		target.Server = packetConn.LocalAddr().String()
+		for range 3 {
+			resp, err := dm.performUDPLookup(context.Background(), target)
+			require.NoError(t, err)
+			port := sourcePort(t, resp)
+			assert.GreaterOrEqual(t, port, portRange.Min)
+			assert.LessOrEqual(t, port, portRange.Max)
+		}
+	})
+
+	t.Run("tcp", func(t *testing.T) {
+		target.Server = listener.Addr().String()
+		for range 3 {
+			resp, err := dm.performTCPLookup(context.Background(), target)
+			require.NoError(t, err)
+			port := sourcePort(t, resp)
+			assert.GreaterOrEqual(t, port, portRange.Min)
+			assert.LessOrEqual(t, port, portRange.Max)
+		}
+	})
+
+	t.Run("dialer binds within range", func(t *testing.T) {
+		dialer := sourcePortDialer("udp", portRange.random(), &net.Dialer{Timeout: time.Second})
+		addr, ok := dialer.LocalAddr.(*net.UDPAddr)
+		require.True(t, ok)
+		assert.GreaterOrEqual(t, addr.Port, portRange.Min)
+		assert.LessOrEqual(t, addr.Port, portRange.Max)
+		assert.Equal(t, time.Second, dialer.Timeout)
+
+		tcpDialer := sourcePortDialer("tcp", 42100, nil)
+		assert.Equal(t, &net.TCPAddr{Port: 42100}, tcpDialer.LocalAddr)
+	})
+
+	t.Run("os assigned by default", func(t *testing.T) {
+		dm.SetSourcePortRange(nil)
+		target.Server = packetConn.LocalAddr().String()
+		resp, err := dm.performUDPLookup(context.Background(), target)
+		require.NoError(t, err)
+		assert.NotZero(t, sourcePort(t, resp))
+	})
+}
+
+func TestAnswerValues(t *testing.T) {
+	a, err := dns.NewRR("example.com. 60 IN A 192.0.2.1")
+	require.NoError(t, err)
+	aaaa, err := dns.NewRR("example.com. 60 IN AAAA 2001:db8::1")
+	require.NoError(t, err)
+	cname, err := dns.NewRR("www.example.com. 60 IN CNAME example.com.")
+	require.NoError(t, err)
+	mx, err := dns.NewRR("example.com. 60 IN MX 10 mail.example.com.")
+	require.NoError(t, err)
+	txt, err := dns.NewRR(`example.com. 60 IN TXT "v=spf1 " "-all"`)
+	require.NoError(t, err)
+
+	resp := &dns.Msg{Answer: []dns.RR{cname, a, aaaa}}
+	assert.Equal(t, []string{"192.0.2.1", "2001:db8::1"}, answerValues(resp, dns.TypeA))
+	assert.Equal(t, []string{"example.com"}, answerValues(&dns.Msg{Answer: []dns.RR{cname}}, dns.TypeCNAME))
+	assert.Equal(t, []string{"mail.example.com"}, answerValues(&dns.Msg{Answer: []dns.RR{mx}}, dns.TypeMX))
+	assert.Equal(t, []string{"v=spf1 -all"}, answerValues(&dns.Msg{Answer: []dns.RR{txt}}, dns.TypeTXT))
+	assert.Empty(t, answerValues(&dns.Msg{}, dns.TypeA))
+}
+
+func TestDnsManager_DNSSEC(t *testing.T) {
+	// local DNS server that validates only secure.example.com and reports whether DNSSEC records were requested
+	var requestedDnssec bool
+	var mu sync.Mutex
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		mu.Lock()
+		requestedDnssec = r.IsEdns0() != nil && r.IsEdns0().Do()
+		mu.Unlock()
+		resp := new(dns.Msg)
+		resp.SetReply(r)
+		resp.AuthenticatedData = r.Question[0].Name == "secure.example.com."
+		resp.Answer = append(resp.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+			A:   net.ParseIP("192.0.2.1"),
+		})
+		w.WriteMsg(resp)
+	})
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &dns.Server{PacketConn: packetConn, Handler: handler}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	dm, err := NewDnsManager()
+	require.NoError(t, err)
+	defer dm.Close()
+
+	lookup := func(domain string, dnssec bool) *system.DnsResult {
+		target := &dnsTarget{DnsTarget: system.DnsTarget{
+			Domain:  domain,
+			Server:  packetConn.LocalAddr().String(),
+			Type:    "A",
+			Timeout: 2 * time.Second,
+			DNSSEC:  dnssec,
+		}}
+		result := &system.DnsResult{Domain: target.Domain, Server: target.Server, Type: target.Type}
+		dm.performDnsLookup(target, result)
+		return result
+	}
+	requested := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return requestedDnssec
+	}
+
+	result := lookup("secure.example.com", true)
+	assert.True(t, requested())
+	assert.Equal(t, "success", result.Status)
+	assert.True(t, result.Authenticated)
+
+	result = lookup("unsigned.example.com", true)
+	assert.Equal(t, "insecure", result.Status)
+	assert.False(t, result.Authenticated)
+
+	// without DNSSEC, unauthenticated answers are fine
+	result = lookup("unsigned.example.com", false)
+	assert.False(t, requested())
+	assert.Equal(t, "success", result.Status)
+}
+
+func TestDnsManager_ClientSubnet(t *testing.T) {
+	// local DNS server that echoes the client subnet of the query in a TXT record
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(r)
+		subnet := "none"
+		if opt := r.IsEdns0(); opt != nil {
+			for _, option := range opt.Option {
+				if ecs, ok := option.(*dns.EDNS0_SUBNET); ok {
+					subnet = fmt.Sprintf("%s/%d", ecs.Address, ecs.SourceNetmask)
+				}
+			}
+		}
+		resp.Answer = append(resp.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+			Txt: []string{subnet},
+		})
+		w.WriteMsg(resp)
+	})
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &dns.Server{PacketConn: packetConn, Handler: handler}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	dm, err := NewDnsManager()
+	require.NoError(t, err)
+	defer dm.Close()
+
+	dm.UpdateConfig([]system.DnsTarget{
+		{Domain: "v4.example.com", Server: packetConn.LocalAddr().String(), Type: "TXT", Timeout: 2 * time.Second, ClientSubnet: "198.51.100.77/24"},
+		{Domain: "v6.example.com", Server: packetConn.LocalAddr().String(), Type: "TXT", Timeout: 2 * time.Second, ClientSubnet: "2001:db8:1234::/48"},
+		{Domain: "invalid.example.com", Server: packetConn.LocalAddr().String(), Type: "TXT", Timeout: 2 * time.Second, ClientSubnet: "not-a-cidr"},
+	}, "")
+
+	tests := map[string]string{
+		"v4.example.com":      "198.51.100.0/24",
+		"v6.example.com":      "2001:db8:1234::/48",
+		"invalid.example.com": "none",
+	}
+	for domain, expected := range tests {
+		target := dm.targets[domain+"@"+packetConn.LocalAddr().String()+"#TXT"]
+		require.NotNil(t, target, domain)
+		result := &system.DnsResult{Domain: target.Domain, Server: target.Server, Type: target.Type}
+		dm.performDnsLookup(target, result)
+		assert.Equal(t, "success", result.Status, domain)
+		assert.Equal(t, []string{expected}, result.Answers, domain)
+	}
+}
+
+func TestDnsManager_SourceIP(t *testing.T) {
+	// local DNS server that answers with the address the query came from
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		host, _, _ := net.SplitHostPort(w.RemoteAddr().String())
+		resp := new(dns.Msg)
+		resp.SetReply(r)
+		resp.Answer = append(resp.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+			Txt: []string{host},
+		})
+		w.WriteMsg(resp)
+	})
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	udpServer := &dns.Server{PacketConn: packetConn, Handler: handler}
+	go udpServer.ActivateAndServe()
+	defer udpServer.Shutdown()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	tcpServer := &dns.Server{Listener: listener, Handler: handler}
+	go tcpServer.ActivateAndServe()
+	defer tcpServer.Shutdown()
+
+	dm, err := NewDnsManager()
+	require.NoError(t, err)
+	defer dm.Close()
+
+	udpAddr, tcpAddr := packetConn.LocalAddr().String(), listener.Addr().String()
+	dm.UpdateConfig([]system.DnsTarget{
+		{Domain: "udp.example.com", Server: udpAddr, Type: "TXT", Timeout: 2 * time.Second, SourceIP: "127.0.0.1"},
+		{Domain: "tcp.example.com", Server: tcpAddr, Type: "TXT", Timeout: 2 * time.Second, Protocol: "tcp", SourceIP: "127.0.0.1"},
+		{Domain: "foreign.example.com", Server: udpAddr, Type: "TXT", Timeout: 2 * time.Second, SourceIP: "192.0.2.55"},
+		{Domain: "invalid.example.com", Server: udpAddr, Type: "TXT", Timeout: 2 * time.Second, SourceIP: "not-an-ip"},
+		// the same lookup without a source IP is a path of its own
+		{Domain: "udp.example.com", Server: udpAddr, Type: "TXT", Timeout: 2 * time.Second},
+	}, "")
+
+	// addresses that aren't assigned locally are skipped
+	assert.Len(t, dm.targets, 3)
+	assert.Contains(t, dm.targets, "udp.example.com@"+udpAddr+"#TXT")
+
+	lookup := func(key string) *system.DnsResult {
+		target := dm.targets[key]
+		require.NotNil(t, target, key)
+		result := &system.DnsResult{Domain: target.Domain, Server: target.Server, Type: target.Type}
+		dm.performDnsLookup(target, result)
+		return result
+	}
+	for _, key := range []string{"udp.example.com@" + udpAddr + "#TXT%127.0.0.1", "tcp.example.com@" + tcpAddr + "#TXT%127.0.0.1"} {
+		result := lookup(key)
+		assert.Equal(t, "success", result.Status, key)
+		assert.Equal(t, []string{"127.0.0.1"}, result.Answers, key)
+	}
+
+	// the source IP is kept when binding to a port of the range
+	dm.SetSourcePortRange(&PortRange{Min: 42200, Max: 42299})
+	result := lookup("udp.example.com@" + udpAddr + "#TXT%127.0.0.1")
+	assert.Equal(t, "success", result.Status)
+	assert.Equal(t, []string{"127.0.0.1"}, result.Answers)
+
+	dialer := sourcePortDialer("tcp", 42200, sourceIPDialer(dm.targets["tcp.example.com@"+tcpAddr+"#TXT%127.0.0.1"], "tcp"))
+	assert.Equal(t, &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 42200}, dialer.LocalAddr)
+}
+
+func TestConfigValidator_RejectsForeignSourceIP(t *testing.T) {
+	dm, err := NewDnsManager()
+	require.NoError(t, err)
+	defer dm.Close()
+	cv := NewConfigValidator(10, time.Hour, nil)
+	cv.isLocalAddr = dm.isLocalAddr
+
+	config := &system.MonitoringConfig{}
+	config.Enabled.Dns = true
+	config.Dns.Targets = []system.DnsTarget{
+		{Domain: "example.com", Server: "8.8.8.8", Type: "A", SourceIP: "127.0.0.1"},
+		{Domain: "example.com", Server: "8.8.8.8", Type: "A", SourceIP: "192.0.2.55"},
+	}
+	ack := cv.RejectInvalidTargets(config)
+	assert.Equal(t, 1, ack.Applied)
+	require.Len(t, ack.Rejected, 1)
+	assert.Equal(t, "example.com@8.8.8.8#A%192.0.2.55", ack.Rejected[0].Target)
+	assert.Contains(t, ack.Rejected[0].Reason, "not assigned to this host")
+}
+
+func TestDnsManager_ResolverComparison(t *testing.T) {
+	// local DNS servers answering the domain with their own address, or that it doesn't exist
+	startServer := func(address string) string {
+		handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			resp := new(dns.Msg)
+			resp.SetReply(r)
+			if address == "" {
+				resp.Rcode = dns.RcodeNameError
+			} else {
+				resp.Answer = append(resp.Answer, &dns.A{
+					Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+					A:   net.ParseIP(address),
+				})
+			}
+			w.WriteMsg(resp)
+		})
+		packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		server := &dns.Server{PacketConn: packetConn, Handler: handler}
+		go server.ActivateAndServe()
+		t.Cleanup(func() { server.Shutdown() })
+		return packetConn.LocalAddr().String()
+	}
+	public := startServer("192.0.2.1")
+	mirror := startServer("192.0.2.1")
+	hijacked := startServer("198.51.100.1")
+	missing := startServer("")
+	alsoMissing := startServer("")
+
+	// a closed port, queries to it fail
+	closed, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	unreachable := closed.LocalAddr().String()
+	closed.Close()
+
+	dm, err := NewDnsManager()
+	require.NoError(t, err)
+	defer dm.Close()
+
+	dm.UpdateConfig([]system.DnsTarget{
+		{Domain: "agree.example.com", Server: public, Timeout: 1 * time.Second},
+		{Domain: "agree.example.com", Servers: []string{public, mirror}, Timeout: 1 * time.Second},
+		{Domain: "differ.example.com", Servers: []string{public, hijacked}, Timeout: 1 * time.Second},
+		{Domain: "failing.example.com", Servers: []string{public, unreachable}, Timeout: 1 * time.Second},
+		{Domain: "single.example.com", Servers: []string{public}, Timeout: 1 * time.Second},
+		{Domain: "filtered.example.com", Servers: []string{public, missing}, Timeout: 1 * time.Second},
+		{Domain: "gone.example.com", Servers: []string{missing, alsoMissing}, Timeout: 1 * time.Second},
+	}, "")
+	// comparisons have their own keys and need at least two servers
+	require.Len(t, dm.targets, 6)
+
+	lookup := func(domain string, servers ...string) *system.DnsResult {
+		target := dm.targets[dnsTargetKey(system.DnsTarget{Domain: domain, Servers: servers, Type: "A"})]
+		require.NotNil(t, target, domain)
+		dm.lookupTarget(target)
+		return dm.GetResults()[dnsTargetKey(target.DnsTarget)]
+	}
+
+	result := lookup("agree.example.com", public, mirror)
+	require.NotNil(t, result)
+	assert.Equal(t, "success", result.Status, result.ErrorCode)
+	assert.Equal(t, public+","+mirror, result.Server)
+	assert.Equal(t, []string{"192.0.2.1"}, result.Answers)
+	assert.Equal(t, map[string][]string{public: {"192.0.2.1"}, mirror: {"192.0.2.1"}}, result.ServerAnswers)
+	assert.EqualValues(t, 60, result.TTL)
+
+	result = lookup("differ.example.com", public, hijacked)
+	require.NotNil(t, result)
+	assert.Equal(t, "divergent", result.Status)
+	assert.Contains(t, result.ErrorCode, hijacked+": 198.51.100.1")
+	assert.ElementsMatch(t, []string{"192.0.2.1", "198.51.100.1"}, result.Answers)
+	assert.Equal(t, map[string][]string{public: {"192.0.2.1"}, hijacked: {"198.51.100.1"}}, result.ServerAnswers)
+
+	result = lookup("failing.example.com", public, unreachable)
+	require.NotNil(t, result)
+	assert.Contains(t, []string{"error", "timeout"}, result.Status)
+	assert.Contains(t, result.ErrorCode, unreachable+": ")
+	assert.Equal(t, map[string][]string{public: {"192.0.2.1"}}, result.ServerAnswers)
+
+	// a server answering that the domain doesn't exist answered differently, it didn't fail
+	result = lookup("filtered.example.com", public, missing)
+	require.NotNil(t, result)
+	assert.Equal(t, "divergent", result.Status)
+	assert.Contains(t, result.ErrorCode, missing+": NXDOMAIN")
+	assert.Equal(t, []string{"192.0.2.1"}, result.Answers)
+	assert.Equal(t, map[string][]string{public: {"192.0.2.1"}, missing: {"NXDOMAIN"}}, result.ServerAnswers)
+
+	result = lookup("gone.example.com", missing, alsoMissing)
+	require.NotNil(t, result)
+	assert.Equal(t, "error", result.Status)
+	assert.Equal(t, "NXDOMAIN", result.ErrorCode)
+	assert.Empty(t, result.Answers)
+}
+
+func TestDnsManager_MaxConcurrentLookups(t *testing.T) {
+	// local DNS server that tracks how many queries it handles at once
+	var mu sync.Mutex
+	var inFlight, maxInFlight, handled int
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		handled++
+		mu.Unlock()
+		resp := new(dns.Msg)
+		resp.SetReply(r)
+		w.WriteMsg(resp)
+	})
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &dns.Server{PacketConn: packetConn, Handler: handler}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	dm, err := NewDnsManager()
+	require.NoError(t, err)
+	defer dm.Close()
+	assert.Equal(t, defaultMaxConcurrentLookups, cap(dm.lookupSlots))
+
+	var targets []system.DnsTarget
+	for i := range 6 {
+		targets = append(targets, system.DnsTarget{Domain: fmt.Sprintf("host%d.example.com", i), Server: packetConn.LocalAddr().String(), Timeout: 2 * time.Second})
+	}
+	dm.UpdateConfig(targets, "")
+	dm.SetMaxConcurrentLookups(2)
+
+	dm.checkDnsLookups()
+	mu.Lock()
+	assert.Equal(t, 6, handled, "all lookups finish before the check returns")
+	assert.Equal(t, 2, maxInFlight)
+	mu.Unlock()
+
+	// invalid values restore the default
+	dm.SetMaxConcurrentLookups(0)
+	assert.Equal(t, defaultMaxConcurrentLookups, cap(dm.lookupSlots))
+}
+
+func TestMinAnswerTTL(t *testing.T) {
+	cname, err := dns.NewRR("www.example.com. 3600 IN CNAME example.com.")
+	require.NoError(t, err)
+	a1, err := dns.NewRR("example.com. 300 IN A 192.0.2.1")
+	require.NoError(t, err)
+	a2, err := dns.NewRR("example.com. 120 IN A 192.0.2.2")
+	require.NoError(t, err)
+
+	assert.Equal(t, uint32(120), minAnswerTTL(&dns.Msg{Answer: []dns.RR{cname, a1, a2}}))
+	assert.Equal(t, uint32(3600), minAnswerTTL(&dns.Msg{Answer: []dns.RR{cname}}))
+	assert.Zero(t, minAnswerTTL(&dns.Msg{}))
+}
+
+func TestAnswersExpected(t *testing.T) {
+	tests := []struct {
+		name     string
+		answers  []string
+		expected []string
+		qtype    uint16
+		ok       bool
+	}{
+		{"all expected", []string{"192.0.2.1", "192.0.2.2"}, []string{"192.0.2.2", "192.0.2.1", "192.0.2.3"}, dns.TypeA, true},
+		{"unexpected address", []string{"192.0.2.1", "198.51.100.1"}, []string{"192.0.2.1"}, dns.TypeA, false},
+		{"no answers", nil, []string{"192.0.2.1"}, dns.TypeA, false},
+		{"canonical ipv6", []string{"2001:db8::1"}, []string{"2001:DB8:0::1"}, dns.TypeAAAA, true},
+		{"host case and trailing dot", []string{"mail.example.com"}, []string{"Mail.Example.com."}, dns.TypeMX, true},
+		{"cname", []string{"cdn.example.net"}, []string{"example.com"}, dns.TypeCNAME, false},
+		{"txt exact", []string{"v=spf1 -all"}, []string{"v=spf1 -all"}, dns.TypeTXT, true},
+		{"txt case sensitive", []string{"token=AbC"}, []string{"token=abc"}, dns.TypeTXT, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.ok, answersExpected(tt.answers, tt.expected, tt.qtype))
+		})
+	}
+}
+
+func TestDnsManager_ExpectedValues(t *testing.T) {
+	// local DNS server that answers with a hijacked address
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(r)
+		resp.Answer = append(resp.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+			A:   net.ParseIP("198.51.100.7"),
+		})
+		w.WriteMsg(resp)
+	})
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &dns.Server{PacketConn: packetConn, Handler: handler}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	dm, err := NewDnsManager()
+	require.NoError(t, err)
+	defer dm.Close()
+
+	target := &dnsTarget{DnsTarget: system.DnsTarget{
+		Domain:         "example.com",
+		Server:         packetConn.LocalAddr().String(),
+		Type:           "A",
+		Timeout:        2 * time.Second,
+		ExpectedValues: []string{"192.0.2.1"},
+	}}
+
+	result := &system.DnsResult{Domain: target.Domain, Server: target.Server, Type: target.Type}
+	dm.performDnsLookup(target, result)
+	assert.Equal(t, "mismatch", result.Status)
+	assert.Equal(t, "unexpected answers: 198.51.100.7", result.ErrorCode)
+	assert.Equal(t, []string{"198.51.100.7"}, result.Answers)
+	assert.Equal(t, uint32(60), result.TTL)
+
+	target.ExpectedValues = []string{"192.0.2.1", "198.51.100.7"}
+	result = &system.DnsResult{Domain: target.Domain, Server: target.Server, Type: target.Type}
+	dm.performDnsLookup(target, result)
+	assert.Equal(t, "success", result.Status)
+	assert.Empty(t, result.ErrorCode)
+}
+
+func TestValidateDnsServer(t *testing.T) {
+	for _, server := range []string{"8.8.8.8", "8.8.8.8:5353", "dns.example.com", "[2001:4860:4860::8888]:53"} {
+		assert.NoError(t, validateDnsServer(server, "udp"), server)
+	}
+	assert.NoError(t, validateDnsServer("https://dns.google/dns-query", "doh"))
+	assert.NoError(t, validateDnsServer("1.1.1.1", "dot"))
+
+	assert.ErrorContains(t, validateDnsServer("2001:4860:4860::8888", "udp"), "IPv6 addresses need brackets")
+	assert.ErrorContains(t, validateDnsServer("8.8.8.8:99999", "tcp"), "invalid port")
+	assert.ErrorContains(t, validateDnsServer("8.8.8.8", "doh"), "not an http(s) URL")
+	assert.ErrorContains(t, validateDnsServer("8.8.8.8", "quic"), "unknown protocol")
+	assert.ErrorContains(t, validateDnsServer("dns example com", ""), "invalid host")
+}
+
+func TestDnsManager_UpdateConfigRunsLookups(t *testing.T) {
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(r)
+		resp.Answer = append(resp.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+			A:   net.ParseIP("192.0.2.1"),
+		})
+		w.WriteMsg(resp)
+	})
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &dns.Server{PacketConn: packetConn, Handler: handler}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	dm, err := NewDnsManager()
+	require.NoError(t, err)
+	defer dm.Close()
+
+	// the schedule won't fire during the test, results come from the run started by the update
+	dm.UpdateConfig([]system.DnsTarget{{Domain: "example.com", Server: packetConn.LocalAddr().String(), Type: "A", Timeout: 2 * time.Second}}, "0 0 1 1 *")
+
+	var results map[string]*system.DnsResult
+	require.Eventually(t, func() bool {
+		results = dm.GetResults()
+		return results != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Len(t, results, 1)
+	for _, result := range results {
+		assert.Equal(t, "success", result.Status)
+		assert.Equal(t, []string{"192.0.2.1"}, result.Answers)
+	}
+}
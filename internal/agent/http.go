@@ -3,10 +3,19 @@ package agent
 import (
 	"beszel/internal/entities/system"
 	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"log/slog"
+	"math"
+	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -22,12 +31,61 @@ type HttpManager struct {
 	cancel          context.CancelFunc
 	cronScheduler   *cron.Cron
 	cronExpression  string
+	cronSeconds     bool            // Whether the cron expression has a leading seconds field
+	resolver        *net.Resolver   // Optional resolver for target hostnames (nil uses the OS resolver)
+	tlsConfig       *tls.Config     // Base TLS config for checks, nil uses the defaults. Only set by tests, to trust their servers.
+	smoother        *sampleSmoother // Median of recent response times per target, nil if smoothing is disabled
+	buffer          resultBuffer    // Bounds results waiting for the hub
+	netns           *netns          // Network namespace checks connect from, nil for the host namespace
+	scheduler       schedulerStatus // Health of the cron job, reported in heartbeats
 }
 
 type httpTarget struct {
-	URL       string
-	Timeout   time.Duration
-	lastCheck time.Time
+	URL        string
+	Timeout    time.Duration
+	ServerName string // TLS SNI override
+	Host       string // Host header override
+	CheckOcsp  bool   // Record OCSP stapling and SCT status
+	Method     string
+	Headers    map[string]string
+	Body       string
+	// Assertions on the response, a response failing them is an error
+	ExpectedStatusCodes []int
+	BodyMatch           *regexp.Regexp
+	FollowRedirects     bool
+	// Bytes of the body read to measure the download speed, 0 if throughput isn't measured
+	ThroughputBytes int64
+	// Proxy for the checks, nil uses the proxy environment variables
+	Proxy *url.URL
+	// Whether checks share a client keeping its connections alive, created by the first check
+	ReuseConnection bool
+	client          *http.Client
+	lastCheck       time.Time
+}
+
+// maxHttpBodyMatchSize is how much of a response body is matched against a target's BodyMatch
+const maxHttpBodyMatchSize = 1 << 20
+
+// maxHttpRedirects is how many redirects a check follows, the same as the default client
+const maxHttpRedirects = 10
+
+// Download size and timeout limits of targets measuring throughput
+const (
+	defaultHttpThroughputBytes   = 100 << 20 // Bytes read unless the target sets its own limit
+	maxHttpThroughputBytes       = 1 << 30
+	defaultHttpThroughputTimeout = 60 * time.Second // Downloads take longer than other checks
+	maxHttpThroughputTimeout     = 300 * time.Second
+)
+
+// httpMethods are the request methods HTTP checks can use
+var httpMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodOptions,
 }
 
 // NewHttpManager creates a new HTTP manager
@@ -37,9 +95,10 @@ func NewHttpManager() (*HttpManager, error) {
 	hm := &HttpManager{
 		targets:        make(map[string]*httpTarget),
 		results:        make(map[string]*system.HttpResult),
+		buffer:         newResultBuffer(),
 		ctx:            ctx,
 		cancel:         cancel,
-		cronScheduler:  cron.New(cron.WithParser(cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow))),
+		cronScheduler:  cron.New(cron.WithParser(cronParser(false))),
 		cronExpression: "",
 	}
 
@@ -59,42 +118,179 @@ func (hm *HttpManager) UpdateConfig(targets []system.HttpTarget, cronExpression
 	hm.Lock()
 	defer hm.Unlock()
 
-	oldTargetsCount := len(hm.targets)
-	oldResultsCount := len(hm.results)
-	
-	slog.Debug("UpdateConfig called", "old_targets", oldTargetsCount, "new_targets", len(targets), "cron_expression", cronExpression)
+	slog.Debug("UpdateConfig called", "old_targets", len(hm.targets), "new_targets", len(targets), "cron_expression", cronExpression)
 
 	// Use cron expression directly
 	hm.cronExpression = cronExpression
 
-	// Clear existing targets and results to prevent stale data
+	// Replace the targets, results are pruned below once the new targets are known
+	hm.closeIdleConnections()
 	hm.targets = make(map[string]*httpTarget)
-	hm.results = make(map[string]*system.HttpResult)
-	
-	if oldTargetsCount > 0 || oldResultsCount > 0 {
-		slog.Info("Cleared old HTTP configuration", "old_targets", oldTargetsCount, "old_results", oldResultsCount)
-	}
 
 	// Add new targets
 	for _, target := range targets {
 		timeout := target.Timeout
+		var throughputBytes int64
+		if target.MeasureThroughput {
+			if timeout <= 0 {
+				timeout = defaultHttpThroughputTimeout
+			}
+			timeout = min(timeout, maxHttpThroughputTimeout)
+			throughputBytes = defaultHttpThroughputBytes
+			if target.MaxDownloadBytes > 0 {
+				throughputBytes = min(target.MaxDownloadBytes, maxHttpThroughputBytes)
+			}
+		}
 		if timeout <= 0 {
-			timeout = 10 // Default 10 seconds
+			timeout = 10 * time.Second // Default 10 seconds
+		}
+		method := strings.ToUpper(target.Method)
+		if method == "" {
+			method = http.MethodGet
+		}
+		if !slices.Contains(httpMethods, method) {
+			slog.Warn("Ignoring HTTP target with unknown method", "url", target.URL, "method", target.Method)
+			continue
+		}
+		var bodyMatch *regexp.Regexp
+		if target.BodyMatch != "" {
+			var err error
+			if bodyMatch, err = regexp.Compile(target.BodyMatch); err != nil {
+				slog.Warn("Ignoring HTTP target with invalid body match", "url", target.URL, "body_match", target.BodyMatch, "err", err)
+				continue
+			}
+		}
+
+		var proxy *url.URL
+		if target.ProxyURL != "" {
+			var err error
+			if proxy, err = parseProxyURL(target.ProxyURL); err != nil {
+				slog.Warn("Ignoring HTTP target with invalid proxy", "url", target.URL, "err", err)
+				continue
+			}
 		}
 
 		hm.targets[target.URL] = &httpTarget{
-			URL:       target.URL,
-			Timeout:   time.Duration(timeout) * time.Second,
-			lastCheck: time.Time{}, // Will trigger immediate check
+			URL:        target.URL,
+			Timeout:    timeout,
+			ServerName: target.ServerName,
+			Host:       target.Host,
+			CheckOcsp:  target.CheckOcsp,
+			Method:     method,
+			Headers:    target.Headers,
+			Body:       target.Body,
+			lastCheck:  time.Time{}, // Not checked yet, the run started below checks it
+
+			ExpectedStatusCodes: target.ExpectedStatusCodes,
+			BodyMatch:           bodyMatch,
+			FollowRedirects:     target.FollowRedirects == nil || *target.FollowRedirects,
+			ThroughputBytes:     throughputBytes,
+			Proxy:               proxy,
+			ReuseConnection:     target.ReuseConnection,
 		}
 	}
 
+	if dropped := pruneResults(&hm.buffer, hm.results, func(url string) bool { return hm.targets[url] != nil }); dropped > 0 {
+		slog.Info("Dropped results of removed HTTP targets", "results", dropped)
+	}
+	if hm.smoother != nil {
+		hm.smoother.prune(func(url string) bool { return hm.targets[url] != nil })
+	}
+
 	// Reschedule the HTTP job with new cron expression
 	hm.scheduleHttpJob()
 
+	// run the checks right away instead of waiting for the first scheduled run, unless neither the
+	// targets nor the schedule changed
+	if hm.scheduler.changed(targets, cronExpression) && len(hm.targets) > 0 && hm.cronExpression != "" {
+		go hm.scheduler.run(hm.performHttpChecks)
+	}
+
 	slog.Debug("Updated HTTP config", "targets", len(targets))
 }
 
+// parseProxyURL parses the proxy URL of a target, which needs an http, https or socks5 scheme and a host
+func parseProxyURL(rawURL string) (*url.URL, error) {
+	proxy, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch proxy.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", proxy.Scheme)
+	}
+	if proxy.Host == "" {
+		return nil, fmt.Errorf("proxy %q has no host", proxy.Redacted())
+	}
+	return proxy, nil
+}
+
+// usedProxyKey is the context key of the string a check's proxy function records the proxy in
+type usedProxyKey struct{}
+
+// recordProxy wraps a transport's proxy function to record the proxy of each request
+// in the string stored in its context under usedProxyKey
+func recordProxy(proxy func(*http.Request) (*url.URL, error)) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		if proxy == nil {
+			return nil, nil
+		}
+		proxyURL, err := proxy(req)
+		if used, ok := req.Context().Value(usedProxyKey{}).(*string); ok && proxyURL != nil {
+			*used = proxyURL.Scheme + "://" + proxyURL.Host
+		}
+		return proxyURL, err
+	}
+}
+
+// SetResolver sets the resolver used for target hostnames
+func (hm *HttpManager) SetResolver(resolver *net.Resolver) {
+	hm.Lock()
+	defer hm.Unlock()
+	hm.resolver = resolver
+}
+
+// setNetns sets the network namespace checks connect from, nil uses the host namespace
+func (hm *HttpManager) setNetns(ns *netns) {
+	hm.Lock()
+	defer hm.Unlock()
+	hm.netns = ns
+}
+
+// SetSmoothing sets the number of samples the smoothed response time is the median of, 0 or 1 disables smoothing
+func (hm *HttpManager) SetSmoothing(samples int) {
+	hm.Lock()
+	defer hm.Unlock()
+	hm.smoother = updateSmoother(hm.smoother, samples)
+}
+
+// SetCronSeconds sets whether cron expressions have a leading seconds field, used from the next UpdateConfig
+func (hm *HttpManager) SetCronSeconds(seconds bool) {
+	hm.Lock()
+	defer hm.Unlock()
+	hm.cronSeconds = seconds
+}
+
+// SetJitter sets the seed of the phase offsets spreading the targets of scheduled runs, empty runs them all at once
+func (hm *HttpManager) SetJitter(seed string) {
+	hm.scheduler.setJitter(seed)
+}
+
+// SetResultBufferSize sets how many uncollected results are kept before the oldest are dropped
+func (hm *HttpManager) SetResultBufferSize(size int) {
+	hm.Lock()
+	defer hm.Unlock()
+	hm.buffer.setSize(size)
+}
+
+// DroppedResults returns the number of HTTP results dropped because the hub didn't collect them in time
+func (hm *HttpManager) DroppedResults() uint64 {
+	hm.RLock()
+	defer hm.RUnlock()
+	return hm.buffer.dropped
+}
+
 // GetResults returns the current HTTP results
 func (hm *HttpManager) GetResults() map[string]*system.HttpResult {
 	hm.Lock()
@@ -109,12 +305,28 @@ func (hm *HttpManager) GetResults() map[string]*system.HttpResult {
 	results := make(map[string]*system.HttpResult)
 	for url, result := range hm.results {
 		results[url] = &system.HttpResult{
-			URL:          result.URL,
-			Status:       result.Status,
-			ResponseTime: result.ResponseTime,
-			StatusCode:   result.StatusCode,
-			ErrorCode:    result.ErrorCode,
-			LastChecked:  result.LastChecked,
+			URL:                  result.URL,
+			Status:               result.Status,
+			ResponseTime:         result.ResponseTime,
+			StatusCode:           result.StatusCode,
+			ErrorCode:            result.ErrorCode,
+			LastChecked:          result.LastChecked,
+			SmoothedResponseTime: result.SmoothedResponseTime,
+			TcpRetransmits:       result.TcpRetransmits,
+			TcpRttVar:            result.TcpRttVar,
+			OcspStatus:           result.OcspStatus,
+			SctPresent:           result.SctPresent,
+			DNSTime:              result.DNSTime,
+			ConnectTime:          result.ConnectTime,
+			TLSTime:              result.TLSTime,
+			TTFB:                 result.TTFB,
+			TotalTime:            result.TotalTime,
+			CertExpiryDays:       result.CertExpiryDays,
+			RedirectCount:        result.RedirectCount,
+			FinalURL:             result.FinalURL,
+			ThroughputMbps:       result.ThroughputMbps,
+			ConnectionReused:     result.ConnectionReused,
+			Proxy:                result.Proxy,
 		}
 	}
 
@@ -129,22 +341,26 @@ func (hm *HttpManager) GetResults() map[string]*system.HttpResult {
 func (hm *HttpManager) scheduleHttpJob() {
 	// Remove all existing jobs by creating a new scheduler
 	hm.cronScheduler.Stop()
-	hm.cronScheduler = cron.New(cron.WithParser(cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow))) // 5-field format
+	hm.cronScheduler = cron.New(cron.WithParser(cronParser(hm.cronSeconds)))
 	hm.cronScheduler.Start()
 
 	// Only schedule if we have a valid cron expression
 	if hm.cronExpression != "" {
-		_, err := hm.cronScheduler.AddFunc(hm.cronExpression, func() {
+		id, err := hm.cronScheduler.AddFunc(hm.cronExpression, func() {
 			slog.Debug("Running HTTP checks")
-			hm.performHttpChecks()
+			if !hm.scheduler.runScheduled(hm.performHttpChecks) {
+				slog.Warn("Skipping scheduled HTTP checks, the previous run is still going", "cron_expression", hm.cronExpression)
+			}
 		})
 		if err != nil {
 			slog.Error("Failed to schedule HTTP job", "cron_expression", hm.cronExpression, "error", err)
 		} else {
 			slog.Debug("HTTP job scheduled", "expression", hm.cronExpression)
 		}
+		hm.scheduler.scheduled(hm.cronScheduler.Entry(id).Schedule, err)
 	} else {
 		slog.Debug("No cron expression set, HTTP job not scheduled")
+		hm.scheduler.scheduled(nil, nil)
 	}
 }
 
@@ -165,10 +381,17 @@ func (hm *HttpManager) performHttpChecks() {
 		wg.Add(1)
 		go func(t *httpTarget) {
 			defer wg.Done()
+			if !hm.scheduler.waitPhase(hm.ctx, t.URL) {
+				return
+			}
 			result := hm.performHttpCheck(t)
 
 			hm.Lock()
-			hm.results[t.URL] = result
+			// failed checks have no meaningful response time to smooth
+			if hm.smoother != nil && result.Status == "success" {
+				result.SmoothedResponseTime = hm.smoother.add(t.URL, result.ResponseTime)
+			}
+			bufferResult(&hm.buffer, hm.results, t.URL, result, func(r *system.HttpResult) time.Time { return r.LastChecked })
 			hm.lastResultsTime = time.Now()
 			hm.Unlock()
 
@@ -187,12 +410,29 @@ func (hm *HttpManager) performHttpCheck(target *httpTarget) *system.HttpResult {
 	startTime := time.Now()
 
 	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: target.Timeout,
+	client := hm.httpClient(target)
+	var redirects int
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if !target.FollowRedirects {
+			return http.ErrUseLastResponse
+		}
+		if len(via) >= maxHttpRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxHttpRedirects)
+		}
+		redirects++
+		return nil
 	}
 
 	// Create request
-	req, err := http.NewRequest("GET", target.URL, nil)
+	var body io.Reader
+	if target.Body != "" {
+		body = strings.NewReader(target.Body)
+	}
+	method := target.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequest(method, target.URL, body)
 	if err != nil {
 		return &system.HttpResult{
 			URL:          target.URL,
@@ -203,6 +443,46 @@ func (hm *HttpManager) performHttpCheck(target *httpTarget) *system.HttpResult {
 			LastChecked:  time.Now(),
 		}
 	}
+	for name, value := range target.Headers {
+		req.Header.Set(name, value)
+	}
+	if target.Host != "" {
+		req.Host = target.Host
+	}
+
+	// Remember the connection to read its retransmit counter before and after the request,
+	// as kept-alive connections carry counts from earlier checks
+	var conn net.Conn
+	var retransmitsBefore uint32
+	timings := &httpTimings{}
+	trace := timings.clientTrace(startTime)
+	var reused bool
+	trace.GotConn = func(info httptrace.GotConnInfo) {
+		conn = info.Conn
+		reused = info.Reused
+		retransmitsBefore, _, _ = tcpInfo(conn)
+	}
+	// without keep-alive the connection may close before the body is read, so the TCP info is
+	// also taken at the first response byte and replaced by the one after the body if it's still open
+	var retransmitsAfter uint32
+	var rttVar time.Duration
+	var tcpMeasured bool
+	measureTcp := func() {
+		if conn == nil {
+			return
+		}
+		if retransmits, variance, ok := tcpInfo(conn); ok {
+			retransmitsAfter, rttVar, tcpMeasured = retransmits, variance, true
+		}
+	}
+	gotFirstResponseByte := trace.GotFirstResponseByte
+	trace.GotFirstResponseByte = func() {
+		gotFirstResponseByte()
+		measureTcp()
+	}
+	var proxy string
+	ctx := context.WithValue(httptrace.WithClientTrace(req.Context(), trace), usedProxyKey{}, &proxy)
+	req = req.WithContext(ctx)
 
 	// Perform the request
 	resp, err := client.Do(req)
@@ -216,12 +496,30 @@ func (hm *HttpManager) performHttpCheck(target *httpTarget) *system.HttpResult {
 			StatusCode:   0,
 			ErrorCode:    fmt.Sprintf("request_failed: %v", err),
 			LastChecked:  time.Now(),
+			Proxy:        proxy,
 		}
 	}
 	defer resp.Body.Close()
 
-	// Read response body
-	_, err = io.Copy(io.Discard, resp.Body)
+	// Read response body, keeping its start if it's matched. Targets measuring throughput
+	// stop reading at their download limit.
+	bodyStart := time.Now()
+	var respBody []byte
+	var bodyBytes int64
+	if target.BodyMatch != nil {
+		respBody, err = io.ReadAll(io.LimitReader(resp.Body, maxHttpBodyMatchSize))
+		bodyBytes = int64(len(respBody))
+	}
+	if err == nil {
+		var rest io.Reader = resp.Body
+		if target.ThroughputBytes > 0 {
+			rest = io.LimitReader(resp.Body, max(target.ThroughputBytes-bodyBytes, 0))
+		}
+		var n int64
+		n, err = io.Copy(io.Discard, rest)
+		bodyBytes += n
+	}
+	bodyTime := time.Since(bodyStart)
 	if err != nil {
 		return &system.HttpResult{
 			URL:          target.URL,
@@ -233,23 +531,231 @@ func (hm *HttpManager) performHttpCheck(target *httpTarget) *system.HttpResult {
 		}
 	}
 
-	// Always consider it successful if we get a response
+	// Any response is successful unless it fails the target's assertions
 	status := "success"
 	errorCode := ""
+	if len(target.ExpectedStatusCodes) > 0 && !slices.Contains(target.ExpectedStatusCodes, resp.StatusCode) {
+		status = "error"
+		errorCode = fmt.Sprintf("unexpected_status: got %d, expected %s", resp.StatusCode, joinInts(target.ExpectedStatusCodes))
+	} else if target.BodyMatch != nil && !target.BodyMatch.Match(respBody) {
+		status = "error"
+		errorCode = fmt.Sprintf("body_mismatch: body doesn't match %q", target.BodyMatch.String())
+	}
+
+	measureTcp()
+	var retransmits int
+	if tcpMeasured && retransmitsAfter >= retransmitsBefore {
+		retransmits = int(retransmitsAfter - retransmitsBefore)
+	}
+
+	result := &system.HttpResult{
+		URL:            target.URL,
+		Status:         status,
+		ResponseTime:   float64(responseTime),
+		StatusCode:     resp.StatusCode,
+		ErrorCode:      errorCode,
+		LastChecked:    time.Now(),
+		TcpRetransmits: retransmits,
+		TcpRttVar:      float64(rttVar.Microseconds()) / 1000,
+		RedirectCount:  redirects,
+		FinalURL:       resp.Request.URL.String(),
+		// a reused connection skipped DNS, connect and TLS, so their times are 0
+		ConnectionReused: reused,
+		Proxy:            proxy,
+	}
+	timings.apply(result, time.Since(startTime))
+	if target.ThroughputBytes > 0 {
+		result.ThroughputMbps = throughputMbps(bodyBytes, bodyTime)
+	}
+	if resp.TLS != nil {
+		result.CertExpiryDays = certExpiryDays(resp.TLS, time.Now())
+	}
+	if target.CheckOcsp && resp.TLS != nil {
+		result.OcspStatus = ocspStatus(resp.TLS, time.Now())
+		result.SctPresent = sctPresent(resp.TLS)
+	}
+	return result
+}
+
+// throughputMbps returns the speed a body was downloaded at in Mbps, rounded to hundredths
+func throughputMbps(bytes int64, elapsed time.Duration) float64 {
+	if bytes <= 0 || elapsed <= 0 {
+		return 0
+	}
+	return math.Round(float64(bytes)*8/elapsed.Seconds()/1e6*100) / 100
+}
+
+// certExpiryDays returns the whole days until the leaf certificate of a TLS connection expires,
+// negative once it has expired, or nil if the server sent no certificate
+func certExpiryDays(state *tls.ConnectionState, now time.Time) *int {
+	if len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	days := int(math.Floor(state.PeerCertificates[0].NotAfter.Sub(now).Hours() / 24))
+	return &days
+}
+
+// joinInts formats values as a comma separated list
+func joinInts(values []int) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		parts[i] = strconv.Itoa(value)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// httpTimings collects the phases of a request from its client trace. The hooks may run on
+// the transport's goroutines, and redirects run each phase again, so durations add up.
+type httpTimings struct {
+	sync.Mutex
+	dnsStart, connectStart, tlsStart time.Time
+	dns, connect, tls                time.Duration
+	ttfb                             time.Duration
+}
+
+// clientTrace returns a trace recording the request's phases, with the time to the
+// first response byte measured from start
+func (t *httpTimings) clientTrace(start time.Time) *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.Lock()
+			t.dnsStart = time.Now()
+			t.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.Lock()
+			t.dns += time.Since(t.dnsStart)
+			t.Unlock()
+		},
+		ConnectStart: func(string, string) {
+			t.Lock()
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+			t.Unlock()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			// Happy eyeballs may dial several addresses at once, only the winner counts
+			if err != nil {
+				return
+			}
+			t.Lock()
+			t.connect += time.Since(t.connectStart)
+			t.connectStart = time.Time{}
+			t.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			t.Lock()
+			t.tlsStart = time.Now()
+			t.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.Lock()
+			t.tls += time.Since(t.tlsStart)
+			t.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			t.Lock()
+			t.ttfb = time.Since(start)
+			t.Unlock()
+		},
+	}
+}
+
+// apply sets the recorded phases on result, with ResponseTime reporting the time to the first byte
+func (t *httpTimings) apply(result *system.HttpResult, total time.Duration) {
+	t.Lock()
+	defer t.Unlock()
+	result.DNSTime = durationMs(t.dns)
+	result.ConnectTime = durationMs(t.connect)
+	result.TLSTime = durationMs(t.tls)
+	result.TTFB = durationMs(t.ttfb)
+	result.TotalTime = durationMs(total)
+	if t.ttfb > 0 {
+		result.ResponseTime = result.TTFB
+	}
+}
+
+// durationMs returns d in milliseconds with microsecond precision
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// httpClient returns the client for a check of the target. Targets reusing connections
+// share a client created by their first check, the others get a new one for each check.
+// The client is a copy, so a check can set its redirect policy without affecting others.
+func (hm *HttpManager) httpClient(target *httpTarget) *http.Client {
+	if !target.ReuseConnection {
+		return hm.newHttpClient(target)
+	}
+	hm.Lock()
+	if target.client == nil {
+		hm.Unlock()
+		client := hm.newHttpClient(target)
+		hm.Lock()
+		if target.client == nil {
+			target.client = client
+		}
+	}
+	client := *target.client
+	hm.Unlock()
+	return &client
+}
+
+// closeIdleConnections closes the kept-alive connections of the current targets.
+// Must be called with the lock held.
+func (hm *HttpManager) closeIdleConnections() {
+	for _, target := range hm.targets {
+		if target.client != nil {
+			target.client.CloseIdleConnections()
+		}
+	}
+}
+
+// newHttpClient creates an HTTP client for a check, dialing through the configured
+// resolver and presenting the target's SNI override if set
+func (hm *HttpManager) newHttpClient(target *httpTarget) *http.Client {
+	client := &http.Client{
+		Timeout: target.Timeout,
+	}
+
+	hm.RLock()
+	resolver := hm.resolver
+	tlsConfig := hm.tlsConfig
+	ns := hm.netns
+	hm.RUnlock()
 
-	return &system.HttpResult{
-		URL:          target.URL,
-		Status:       status,
-		ResponseTime: float64(responseTime),
-		StatusCode:   resp.StatusCode,
-		ErrorCode:    errorCode,
-		LastChecked:  time.Now(),
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// without reuse every check opens its own connection, so its timings include the setup
+	transport.DisableKeepAlives = !target.ReuseConnection
+	if target.Proxy != nil {
+		transport.Proxy = http.ProxyURL(target.Proxy)
+	}
+	transport.Proxy = recordProxy(transport.Proxy)
+	if resolver != nil || ns != nil {
+		transport.DialContext = ns.dialContext(&net.Dialer{Timeout: target.Timeout, Resolver: resolver})
+	}
+	if tlsConfig != nil || target.ServerName != "" {
+		if tlsConfig != nil {
+			transport.TLSClientConfig = tlsConfig.Clone()
+		} else {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		if target.ServerName != "" {
+			transport.TLSClientConfig.ServerName = target.ServerName
+		}
 	}
+	client.Transport = transport
+
+	return client
 }
 
 // Stop stops the HTTP manager
 func (hm *HttpManager) Stop() {
 	hm.cancel()
+	hm.Lock()
+	hm.closeIdleConnections()
+	hm.Unlock()
 	if hm.cronScheduler != nil {
 		hm.cronScheduler.Stop()
 	}
@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// OCSP stapling states reported for HTTPS targets with OCSP checks enabled
+const (
+	ocspStatusNone    = "none"    // no stapled response
+	ocspStatusGood    = "good"    // stapled response says the certificate is valid
+	ocspStatusRevoked = "revoked" // stapled response says the certificate is revoked
+	ocspStatusUnknown = "unknown" // responder doesn't know the certificate
+	ocspStatusInvalid = "invalid" // stapled response can't be verified or is expired
+)
+
+// oidSignedCertificateTimestampList is the certificate extension embedding SCTs (RFC 6962)
+var oidSignedCertificateTimestampList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// ocspStatus returns the status of the OCSP response stapled in a TLS handshake
+func ocspStatus(state *tls.ConnectionState, now time.Time) string {
+	if len(state.OCSPResponse) == 0 {
+		return ocspStatusNone
+	}
+	leaf, issuer := peerCertificateAndIssuer(state)
+	if leaf == nil || issuer == nil {
+		return ocspStatusInvalid
+	}
+	resp, err := ocsp.ParseResponseForCert(state.OCSPResponse, leaf, issuer)
+	if err != nil {
+		return ocspStatusInvalid
+	}
+	if !resp.NextUpdate.IsZero() && now.After(resp.NextUpdate) {
+		return ocspStatusInvalid
+	}
+	switch resp.Status {
+	case ocsp.Good:
+		return ocspStatusGood
+	case ocsp.Revoked:
+		return ocspStatusRevoked
+	default:
+		return ocspStatusUnknown
+	}
+}
+
+// peerCertificateAndIssuer returns the server certificate and its issuer, preferring the verified chain
+func peerCertificateAndIssuer(state *tls.ConnectionState) (leaf, issuer *x509.Certificate) {
+	chain := state.PeerCertificates
+	if len(state.VerifiedChains) > 0 {
+		chain = state.VerifiedChains[0]
+	}
+	if len(chain) == 0 {
+		return nil, nil
+	}
+	if len(chain) == 1 {
+		return chain[0], nil
+	}
+	return chain[0], chain[1]
+}
+
+// sctPresent reports whether the server provided signed certificate timestamps,
+// either in the TLS handshake or embedded in its certificate
+func sctPresent(state *tls.ConnectionState) bool {
+	if len(state.SignedCertificateTimestamps) > 0 {
+		return true
+	}
+	if len(state.PeerCertificates) == 0 {
+		return false
+	}
+	for _, ext := range state.PeerCertificates[0].Extensions {
+		if ext.Id.Equal(oidSignedCertificateTimestampList) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+)
+
+// testPKI is a CA and a localhost certificate it issued
+type testPKI struct {
+	ca     *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	leaf   *x509.Certificate
+	tlsCrt tls.Certificate
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, ca, &leafKey.PublicKey, caKey)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(leafDER)
+	require.NoError(t, err)
+
+	return &testPKI{
+		ca:     ca,
+		caKey:  caKey,
+		leaf:   leaf,
+		tlsCrt: tls.Certificate{Certificate: [][]byte{leafDER, caDER}, PrivateKey: leafKey, Leaf: leaf},
+	}
+}
+
+// ocspResponse returns an OCSP response for the leaf certificate signed by the CA
+func (p *testPKI) ocspResponse(t *testing.T, status int, nextUpdate time.Time) []byte {
+	resp, err := ocsp.CreateResponse(p.ca, p.ca, ocsp.Response{
+		Status:       status,
+		SerialNumber: p.leaf.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		NextUpdate:   nextUpdate,
+		RevokedAt:    time.Now().Add(-time.Minute),
+	}, p.caKey)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestHttpManager_OcspStapling(t *testing.T) {
+	pki := newTestPKI(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(pki.ca)
+
+	tests := []struct {
+		name   string
+		staple []byte
+		want   string
+	}{
+		{name: "not stapled", staple: nil, want: ocspStatusNone},
+		{name: "good", staple: pki.ocspResponse(t, ocsp.Good, time.Now().Add(time.Hour)), want: ocspStatusGood},
+		{name: "revoked", staple: pki.ocspResponse(t, ocsp.Revoked, time.Now().Add(time.Hour)), want: ocspStatusRevoked},
+		{name: "expired", staple: pki.ocspResponse(t, ocsp.Good, time.Now().Add(-time.Second)), want: ocspStatusInvalid},
+		{name: "garbage", staple: []byte("not an ocsp response"), want: ocspStatusInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			cert := pki.tlsCrt
+			cert.OCSPStaple = tt.staple
+			server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+			server.StartTLS()
+			defer server.Close()
+
+			hm, err := NewHttpManager()
+			require.NoError(t, err)
+			hm.tlsConfig = &tls.Config{RootCAs: roots}
+
+			result := hm.performHttpCheck(&httpTarget{URL: server.URL, Timeout: 5 * time.Second, CheckOcsp: true})
+			assert.Equal(t, "success", result.Status, result.ErrorCode)
+			assert.Equal(t, tt.want, result.OcspStatus)
+			assert.False(t, result.SctPresent)
+
+			// not recorded unless enabled for the target
+			result = hm.performHttpCheck(&httpTarget{URL: server.URL, Timeout: 5 * time.Second})
+			assert.Empty(t, result.OcspStatus)
+		})
+	}
+}
+
+func TestSctPresent(t *testing.T) {
+	assert.False(t, sctPresent(&tls.ConnectionState{}))
+	assert.True(t, sctPresent(&tls.ConnectionState{SignedCertificateTimestamps: [][]byte{{1}}}))
+	assert.True(t, sctPresent(&tls.ConnectionState{PeerCertificates: []*x509.Certificate{{
+		Extensions: []pkix.Extension{{Id: oidSignedCertificateTimestampList, Value: []byte{0}}},
+	}}}))
+}
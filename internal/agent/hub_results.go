@@ -0,0 +1,63 @@
+package agent
+
+import (
+	"beszel/internal/entities/system"
+	"maps"
+)
+
+// hubResults queues the monitoring results of an agent for each hub it reports to. The managers
+// hand out every result once, so the results of a gather are queued for all hubs and each hub
+// takes its queue when it polls, whichever hub triggered the gather. Not thread safe, it's only
+// used from gatherStats which holds the agent's lock.
+type hubResults map[string]*system.Stats
+
+// register adds a hub that gets the results gathered from now on
+func (q hubResults) register(hub string) {
+	if _, ok := q[hub]; !ok {
+		q[hub] = &system.Stats{}
+	}
+}
+
+// add queues results for every registered hub, newer results of a target replace older ones
+func (q hubResults) add(stats *system.Stats) {
+	for _, queued := range q {
+		mergeResults(queued, stats)
+	}
+}
+
+// take sets the results of stats to the ones queued for hub and empties its queue. Results of
+// hubs that aren't registered are left as they are.
+func (q hubResults) take(hub string, stats *system.Stats) {
+	queued, ok := q[hub]
+	if !ok {
+		return
+	}
+	stats.PingResults = queued.PingResults
+	stats.DnsResults = queued.DnsResults
+	stats.HttpResults = queued.HttpResults
+	stats.SpeedtestResults = queued.SpeedtestResults
+	stats.TracerouteResults = queued.TracerouteResults
+	stats.SnmpResults = queued.SnmpResults
+	q[hub] = &system.Stats{}
+}
+
+// mergeResults copies the results of src into dst
+func mergeResults(dst, src *system.Stats) {
+	dst.PingResults = mergeResultMap(dst.PingResults, src.PingResults)
+	dst.DnsResults = mergeResultMap(dst.DnsResults, src.DnsResults)
+	dst.HttpResults = mergeResultMap(dst.HttpResults, src.HttpResults)
+	dst.SpeedtestResults = mergeResultMap(dst.SpeedtestResults, src.SpeedtestResults)
+	dst.TracerouteResults = mergeResultMap(dst.TracerouteResults, src.TracerouteResults)
+	dst.SnmpResults = mergeResultMap(dst.SnmpResults, src.SnmpResults)
+}
+
+func mergeResultMap[T any](dst, src map[string]*T) map[string]*T {
+	if len(src) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[string]*T, len(src))
+	}
+	maps.Copy(dst, src)
+	return dst
+}
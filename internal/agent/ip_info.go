@@ -0,0 +1,286 @@
+package agent
+
+import (
+	"beszel/internal/common"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultIPInfoURL is the provider looked up unless IPINFO_URL is set
+	defaultIPInfoURL = "https://get.geojs.io/v1/ip/geo.json"
+	// defaultIPInfoCacheTTL is how long a lookup is reused on agent start
+	defaultIPInfoCacheTTL = 6 * time.Hour
+	// ipInfoCacheFile is the file in the data directory keeping the latest lookup
+	ipInfoCacheFile = "ip_info.json"
+)
+
+// ipInfo is the public network identity of the host
+type ipInfo struct {
+	IP  string `json:"ip"`
+	ISP string `json:"isp"`
+	ASN string `json:"asn"`
+}
+
+// cachedIPInfo is an ipInfo persisted with the time it was looked up
+type cachedIPInfo struct {
+	ipInfo
+	Updated time.Time `json:"updated"`
+}
+
+// ipInfoParser turns the response of an IP info provider into an ipInfo
+type ipInfoParser func(body []byte) (ipInfo, error)
+
+// ipInfoParsers are the response formats IPINFO_FORMAT can select
+var ipInfoParsers = map[string]ipInfoParser{
+	"geojs":  parseGeoJS,
+	"ipinfo": parseIPInfoIO,
+	"ip-api": parseIPAPI,
+}
+
+// ipInfoProvider looks up the public IP, ISP and ASN of the host and caches the result
+type ipInfoProvider struct {
+	url       string
+	parse     ipInfoParser
+	cachePath string        // File the latest lookup is persisted in, empty keeps it in memory only
+	ttl       time.Duration // How long a cached lookup is used instead of a new one
+	client    *http.Client
+}
+
+// newIPInfoProviderFromEnv creates the provider configured by IPINFO_URL, IPINFO_FORMAT
+// and IPINFO_CACHE_TTL. Setting IPINFO_URL to an empty value or "off" disables lookups.
+// The URL is also read from BESZEL_IPINFO_URL, see ipInfoURLFromEnv.
+func newIPInfoProviderFromEnv(dataDir string) *ipInfoProvider {
+	p := &ipInfoProvider{
+		url:    defaultIPInfoURL,
+		parse:  parseGeoJS,
+		ttl:    defaultIPInfoCacheTTL,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	if url, exists := ipInfoURLFromEnv(); exists {
+		if slices.Contains([]string{"", "off", "false", "none"}, strings.ToLower(strings.TrimSpace(url))) {
+			slog.Info("IP info lookup disabled")
+			return nil
+		}
+		p.url = strings.TrimSpace(url)
+	}
+	if format, exists := GetEnv("IPINFO_FORMAT"); exists {
+		if parse, ok := ipInfoParsers[strings.ToLower(strings.TrimSpace(format))]; ok {
+			p.parse = parse
+		} else {
+			slog.Warn("Unknown IPINFO_FORMAT, using geojs", "format", format)
+		}
+	}
+	if ttlStr, exists := GetEnv("IPINFO_CACHE_TTL"); exists {
+		if ttl, err := time.ParseDuration(ttlStr); err == nil && ttl >= 0 {
+			p.ttl = ttl
+		} else {
+			slog.Warn("Invalid IPINFO_CACHE_TTL, using default", "configured", ttlStr, "default", defaultIPInfoCacheTTL)
+		}
+	}
+	if dataDir != "" {
+		p.cachePath = filepath.Join(dataDir, ipInfoCacheFile)
+	}
+	return p
+}
+
+// ipInfoURLFromEnv reads BESZEL_AGENT_IPINFO_URL, then BESZEL_IPINFO_URL as the URL may be shared
+// with a hub running alongside, and last the unprefixed IPINFO_URL
+func ipInfoURLFromEnv() (string, bool) {
+	if url, exists := os.LookupEnv("BESZEL_AGENT_IPINFO_URL"); exists {
+		return url, exists
+	}
+	if url, exists := os.LookupEnv("BESZEL_IPINFO_URL"); exists {
+		return url, exists
+	}
+	return os.LookupEnv("IPINFO_URL")
+}
+
+// getIPInfo collects public IP, ISP, and ASN information from the configured provider.
+// With useCache, a lookup cached within the TTL is used instead of asking the provider.
+// If the provider fails, the previous values are kept, or the cached ones if there are none.
+func (a *Agent) getIPInfo(useCache bool) {
+	if a.ipInfo == nil {
+		return
+	}
+	// the IP of the previous lookup tells if the IP changed, which is cached on disk after a restart
+	previousIP := a.systemInfo.PublicIP
+	if previousIP == "" {
+		if cached, ok := a.ipInfo.loadCache(); ok {
+			previousIP = cached.IP
+		}
+	}
+
+	now := time.Now()
+	info, err := a.ipInfo.lookup(useCache, now)
+	if err != nil {
+		slog.Debug("Failed to get IP info", "url", a.ipInfo.url, "error", err)
+		if a.systemInfo.PublicIP != "" {
+			return
+		}
+		cached, ok := a.ipInfo.loadCache()
+		if !ok {
+			return
+		}
+		slog.Debug("Using cached IP info", "updated", cached.Updated)
+		info = cached.ipInfo
+	} else if previousIP != "" && info.IP != previousIP {
+		slog.Info("Public IP changed", "old", previousIP, "new", info.IP)
+		a.ipChange.Store(&common.IPChange{Old: previousIP, New: info.IP, Time: now.Unix()})
+	}
+
+	// Set the collected information
+	a.systemInfo.PublicIP = info.IP
+	a.systemInfo.ISP = info.ISP
+	a.systemInfo.ASN = info.ASN
+
+	slog.Debug("IP info collected",
+		"ip", a.systemInfo.PublicIP,
+		"isp", a.systemInfo.ISP,
+		"asn", a.systemInfo.ASN)
+}
+
+// lookup returns the cached info if useCache is set and it is younger than the TTL,
+// else asks the provider and caches the answer
+func (p *ipInfoProvider) lookup(useCache bool, now time.Time) (ipInfo, error) {
+	if useCache {
+		if cached, ok := p.loadCache(); ok && now.Sub(cached.Updated) < p.ttl {
+			return cached.ipInfo, nil
+		}
+	}
+
+	resp, err := p.client.Get(p.url)
+	if err != nil {
+		return ipInfo{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ipInfo{}, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return ipInfo{}, err
+	}
+	info, err := p.parse(body)
+	if err != nil {
+		return ipInfo{}, err
+	}
+	if info.IP == "" {
+		return ipInfo{}, errors.New("response has no IP")
+	}
+	p.saveCache(cachedIPInfo{ipInfo: info, Updated: now})
+	return info, nil
+}
+
+// loadCache reads the lookup persisted in the data directory
+func (p *ipInfoProvider) loadCache() (cachedIPInfo, bool) {
+	var cached cachedIPInfo
+	if p.cachePath == "" {
+		return cached, false
+	}
+	data, err := os.ReadFile(p.cachePath)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("Failed to read IP info cache", "path", p.cachePath, "err", err)
+		}
+		return cached, false
+	}
+	if err := json.Unmarshal(data, &cached); err != nil || cached.IP == "" {
+		slog.Warn("Ignoring invalid IP info cache", "path", p.cachePath, "err", err)
+		return cachedIPInfo{}, false
+	}
+	return cached, true
+}
+
+// saveCache persists a lookup in the data directory
+func (p *ipInfoProvider) saveCache(cached cachedIPInfo) {
+	if p.cachePath == "" {
+		return
+	}
+	data, err := json.Marshal(cached)
+	if err == nil {
+		err = os.WriteFile(p.cachePath, data, 0644)
+	}
+	if err != nil {
+		slog.Warn("Failed to save IP info cache", "path", p.cachePath, "err", err)
+	}
+}
+
+// GeoJSResponse represents the response from the GeoJS API
+type GeoJSResponse struct {
+	Organization     string `json:"organization"`
+	Country          string `json:"country"`
+	OrganizationName string `json:"organization_name"`
+	CountryCode      string `json:"country_code"`
+	ASN              int    `json:"asn"`
+	Region           string `json:"region"`
+	IP               string `json:"ip"`
+	City             string `json:"city"`
+}
+
+// parseGeoJS parses the response of https://get.geojs.io/v1/ip/geo.json
+func parseGeoJS(body []byte) (ipInfo, error) {
+	var geoInfo GeoJSResponse
+	if err := json.Unmarshal(body, &geoInfo); err != nil {
+		return ipInfo{}, err
+	}
+	info := ipInfo{IP: geoInfo.IP, ISP: geoInfo.OrganizationName}
+	if geoInfo.ASN > 0 {
+		info.ASN = fmt.Sprintf("AS%d", geoInfo.ASN)
+	}
+	return info, nil
+}
+
+// parseIPInfoIO parses the response of https://ipinfo.io/json, whose org is like "AS15169 Google LLC"
+func parseIPInfoIO(body []byte) (ipInfo, error) {
+	var resp struct {
+		IP  string `json:"ip"`
+		Org string `json:"org"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return ipInfo{}, err
+	}
+	asn, isp := splitASN(resp.Org)
+	return ipInfo{IP: resp.IP, ISP: isp, ASN: asn}, nil
+}
+
+// parseIPAPI parses the response of http://ip-api.com/json
+func parseIPAPI(body []byte) (ipInfo, error) {
+	var resp struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+		Query   string `json:"query"`
+		ISP     string `json:"isp"`
+		AS      string `json:"as"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return ipInfo{}, err
+	}
+	if resp.Status == "fail" {
+		return ipInfo{}, fmt.Errorf("ip-api: %s", resp.Message)
+	}
+	asn, _ := splitASN(resp.AS)
+	return ipInfo{IP: resp.Query, ISP: resp.ISP, ASN: asn}, nil
+}
+
+// splitASN splits an organization like "AS15169 Google LLC" into the ASN and the name
+func splitASN(org string) (asn, name string) {
+	first, rest, _ := strings.Cut(strings.TrimSpace(org), " ")
+	if num, ok := strings.CutPrefix(strings.ToUpper(first), "AS"); ok {
+		if _, err := strconv.ParseUint(num, 10, 32); err == nil {
+			return "AS" + num, strings.TrimSpace(rest)
+		}
+	}
+	return "", strings.TrimSpace(org)
+}
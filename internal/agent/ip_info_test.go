@@ -0,0 +1,187 @@
+package agent
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIPInfoParsers(t *testing.T) {
+	tests := []struct {
+		name  string
+		parse ipInfoParser
+		body  string
+		want  ipInfo
+	}{
+		{"geojs", parseGeoJS, `{"ip":"203.0.113.7","organization_name":"Example ISP","asn":64500}`, ipInfo{IP: "203.0.113.7", ISP: "Example ISP", ASN: "AS64500"}},
+		{"ipinfo", parseIPInfoIO, `{"ip":"203.0.113.7","org":"AS64500 Example ISP"}`, ipInfo{IP: "203.0.113.7", ISP: "Example ISP", ASN: "AS64500"}},
+		{"ipinfo without asn", parseIPInfoIO, `{"ip":"203.0.113.7","org":"ASUS Networks"}`, ipInfo{IP: "203.0.113.7", ISP: "ASUS Networks"}},
+		{"ip-api", parseIPAPI, `{"status":"success","query":"203.0.113.7","isp":"Example ISP","as":"AS64500 Example Holding"}`, ipInfo{IP: "203.0.113.7", ISP: "Example ISP", ASN: "AS64500"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := tt.parse([]byte(tt.body))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, info)
+		})
+	}
+
+	_, err := parseIPAPI([]byte(`{"status":"fail","message":"reserved range"}`))
+	assert.ErrorContains(t, err, "reserved range")
+	_, err = parseGeoJS([]byte(`not json`))
+	assert.Error(t, err)
+}
+
+func TestNewIPInfoProviderFromEnv(t *testing.T) {
+	p := newIPInfoProviderFromEnv("")
+	require.NotNil(t, p)
+	assert.Equal(t, defaultIPInfoURL, p.url)
+	assert.Equal(t, defaultIPInfoCacheTTL, p.ttl)
+	assert.Empty(t, p.cachePath)
+
+	t.Setenv("BESZEL_AGENT_IPINFO_URL", "https://ipinfo.io/json")
+	t.Setenv("BESZEL_AGENT_IPINFO_FORMAT", "ipinfo")
+	t.Setenv("BESZEL_AGENT_IPINFO_CACHE_TTL", "1h")
+	dataDir := t.TempDir()
+	p = newIPInfoProviderFromEnv(dataDir)
+	require.NotNil(t, p)
+	assert.Equal(t, "https://ipinfo.io/json", p.url)
+	assert.Equal(t, time.Hour, p.ttl)
+	assert.Equal(t, filepath.Join(dataDir, ipInfoCacheFile), p.cachePath)
+	info, err := p.parse([]byte(`{"ip":"203.0.113.7","org":"AS64500 Example ISP"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "AS64500", info.ASN)
+
+	for _, disabled := range []string{"", "off", "none"} {
+		t.Setenv("BESZEL_AGENT_IPINFO_URL", disabled)
+		assert.Nil(t, newIPInfoProviderFromEnv(dataDir), disabled)
+	}
+}
+
+func TestIPInfoURLFromEnv(t *testing.T) {
+	for _, key := range []string{"BESZEL_AGENT_IPINFO_URL", "BESZEL_IPINFO_URL", "IPINFO_URL"} {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+	_, exists := ipInfoURLFromEnv()
+	assert.False(t, exists)
+
+	t.Setenv("IPINFO_URL", "https://unprefixed.example.com")
+	url, _ := ipInfoURLFromEnv()
+	assert.Equal(t, "https://unprefixed.example.com", url)
+
+	t.Setenv("BESZEL_IPINFO_URL", "https://beszel.example.com")
+	url, _ = ipInfoURLFromEnv()
+	assert.Equal(t, "https://beszel.example.com", url)
+	p := newIPInfoProviderFromEnv("")
+	require.NotNil(t, p)
+	assert.Equal(t, "https://beszel.example.com", p.url)
+
+	t.Setenv("BESZEL_AGENT_IPINFO_URL", "https://agent.example.com")
+	url, _ = ipInfoURLFromEnv()
+	assert.Equal(t, "https://agent.example.com", url)
+}
+
+func TestGetIPInfoCache(t *testing.T) {
+	var requests atomic.Int32
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if failing.Load() {
+			http.Error(w, "blocked", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"ip":"203.0.113.7","organization_name":"Example ISP","asn":64500}`))
+	}))
+	defer server.Close()
+
+	t.Setenv("BESZEL_AGENT_IPINFO_URL", server.URL)
+	dataDir := t.TempDir()
+	newAgent := func() *Agent {
+		a := &Agent{ipInfo: newIPInfoProviderFromEnv(dataDir)}
+		a.getIPInfo(true)
+		return a
+	}
+
+	// the first start asks the provider and caches the result
+	a := newAgent()
+	assert.Equal(t, "203.0.113.7", a.systemInfo.PublicIP)
+	assert.Equal(t, "Example ISP", a.systemInfo.ISP)
+	assert.Equal(t, "AS64500", a.systemInfo.ASN)
+	assert.EqualValues(t, 1, requests.Load())
+	assert.FileExists(t, filepath.Join(dataDir, ipInfoCacheFile))
+
+	// restarts within the TTL use the cache
+	a = newAgent()
+	assert.Equal(t, "203.0.113.7", a.systemInfo.PublicIP)
+	assert.EqualValues(t, 1, requests.Load())
+
+	// refreshes skip the cache, and keep the values if the provider fails
+	failing.Store(true)
+	a.getIPInfo(false)
+	assert.EqualValues(t, 2, requests.Load())
+	assert.Equal(t, "203.0.113.7", a.systemInfo.PublicIP)
+	assert.Equal(t, "AS64500", a.systemInfo.ASN)
+
+	// once the cache expired, a failing provider falls back to the cached values
+	t.Setenv("BESZEL_AGENT_IPINFO_CACHE_TTL", "0s")
+	a = newAgent()
+	assert.EqualValues(t, 3, requests.Load())
+	assert.Equal(t, "203.0.113.7", a.systemInfo.PublicIP)
+	assert.Equal(t, "Example ISP", a.systemInfo.ISP)
+
+	// nothing is looked up when disabled
+	t.Setenv("BESZEL_AGENT_IPINFO_URL", "off")
+	a = newAgent()
+	assert.Empty(t, a.systemInfo.PublicIP)
+	assert.EqualValues(t, 3, requests.Load())
+}
+
+func TestGetIPInfoDetectsChange(t *testing.T) {
+	var ip atomic.Value
+	ip.Store("203.0.113.7")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"ip":%q,"organization_name":"Example ISP","asn":64500}`, ip.Load())
+	}))
+	defer server.Close()
+
+	t.Setenv("BESZEL_AGENT_IPINFO_URL", server.URL)
+	dataDir := t.TempDir()
+	a := &Agent{ipInfo: newIPInfoProviderFromEnv(dataDir)}
+
+	// the first lookup has nothing to compare with
+	a.getIPInfo(true)
+	assert.Nil(t, a.ipChange.Load())
+
+	// refreshes notice the ISP rotating the address
+	ip.Store("203.0.113.8")
+	a.getIPInfo(false)
+	change := a.ipChange.Load()
+	require.NotNil(t, change)
+	assert.Equal(t, "203.0.113.7", change.Old)
+	assert.Equal(t, "203.0.113.8", change.New)
+	assert.NotZero(t, change.Time)
+
+	// so does a restart, comparing with the cached IP
+	ip.Store("203.0.113.9")
+	t.Setenv("BESZEL_AGENT_IPINFO_CACHE_TTL", "0s")
+	a = &Agent{ipInfo: newIPInfoProviderFromEnv(dataDir)}
+	a.getIPInfo(true)
+	change = a.ipChange.Load()
+	require.NotNil(t, change)
+	assert.Equal(t, "203.0.113.8", change.Old)
+	assert.Equal(t, "203.0.113.9", change.New)
+
+	// an unchanged IP is no change
+	a = &Agent{ipInfo: newIPInfoProviderFromEnv(dataDir)}
+	a.getIPInfo(true)
+	assert.Nil(t, a.ipChange.Load())
+}
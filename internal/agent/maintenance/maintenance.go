@@ -0,0 +1,55 @@
+// Package maintenance provides functions to put the agent into maintenance mode.
+// It uses a file in the temp directory containing the optional end of the
+// maintenance window. While the file exists and has not expired, the agent
+// announces maintenance to the hub, which pauses the system instead of marking it down.
+package maintenance
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maintenanceFile is the path to the maintenance file
+var maintenanceFile = filepath.Join(os.TempDir(), "beszel_maintenance")
+
+// Start enables maintenance mode until the given time. A zero time means no expiry.
+func Start(until time.Time) error {
+	var content string
+	if !until.IsZero() {
+		content = until.UTC().Format(time.RFC3339)
+	}
+	return os.WriteFile(maintenanceFile, []byte(content), 0644)
+}
+
+// Stop disables maintenance mode
+func Stop() error {
+	err := os.Remove(maintenanceFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Status returns whether maintenance mode is active and when it ends (zero if no expiry)
+func Status() (active bool, until time.Time) {
+	content, err := os.ReadFile(maintenanceFile)
+	if err != nil {
+		return false, time.Time{}
+	}
+	value := strings.TrimSpace(string(content))
+	if value == "" {
+		return true, time.Time{}
+	}
+	until, err = time.Parse(time.RFC3339, value)
+	if err != nil {
+		// treat an unreadable expiry as maintenance without expiry
+		return true, time.Time{}
+	}
+	if time.Now().After(until) {
+		return false, time.Time{}
+	}
+	return true, until
+}
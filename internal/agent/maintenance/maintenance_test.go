@@ -0,0 +1,50 @@
+package maintenance
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaintenance(t *testing.T) {
+	maintenanceFile = filepath.Join(t.TempDir(), "beszel_maintenance")
+
+	t.Run("inactive without file", func(t *testing.T) {
+		active, until := Status()
+		assert.False(t, active)
+		assert.True(t, until.IsZero())
+	})
+
+	t.Run("active without expiry", func(t *testing.T) {
+		require.NoError(t, Start(time.Time{}))
+		active, until := Status()
+		assert.True(t, active)
+		assert.True(t, until.IsZero())
+	})
+
+	t.Run("active with expiry", func(t *testing.T) {
+		end := time.Now().Add(time.Hour).Truncate(time.Second)
+		require.NoError(t, Start(end))
+		active, until := Status()
+		assert.True(t, active)
+		assert.True(t, end.Equal(until))
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		require.NoError(t, Start(time.Now().Add(-time.Minute)))
+		active, _ := Status()
+		assert.False(t, active)
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		require.NoError(t, Start(time.Time{}))
+		require.NoError(t, Stop())
+		active, _ := Status()
+		assert.False(t, active)
+		// stopping again is not an error
+		assert.NoError(t, Stop())
+	})
+}
@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"beszel/internal/entities/system"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWebSocketClients(t *testing.T) {
+	t.Setenv("BESZEL_AGENT_HUB_URL", "https://hub-a.example.com, https://hub-b.example.com/beszel,")
+	t.Setenv("BESZEL_AGENT_TOKEN", "shared-token")
+	agent, err := NewAgent(t.TempDir())
+	require.NoError(t, err)
+
+	// a single token is used for every hub
+	clients, err := newWebSocketClients(agent)
+	require.NoError(t, err)
+	require.Len(t, clients, 2)
+	assert.Equal(t, "https://hub-a.example.com", clients[0].hub)
+	assert.Equal(t, "hub-b.example.com", clients[1].hubURL.Host)
+	assert.Equal(t, "/beszel", clients[1].hubURL.Path)
+	for _, client := range clients {
+		assert.Equal(t, "shared-token", client.token)
+		assert.Same(t, agent.connectionManager, client.connectionManager)
+	}
+
+	// or one token per hub
+	t.Setenv("BESZEL_AGENT_TOKEN", "token-a, token-b")
+	clients, err = newWebSocketClients(agent)
+	require.NoError(t, err)
+	assert.Equal(t, "token-a", clients[0].token)
+	assert.Equal(t, "token-b", clients[1].token)
+
+	t.Setenv("BESZEL_AGENT_TOKEN", "token-a,token-b,token-c")
+	_, err = newWebSocketClients(agent)
+	assert.ErrorContains(t, err, "3 tokens for 2 hubs")
+
+	// the first hub keeps working with newWebSocketClient
+	t.Setenv("BESZEL_AGENT_TOKEN", "shared-token")
+	client, err := newWebSocketClient(agent)
+	require.NoError(t, err)
+	assert.Equal(t, "https://hub-a.example.com", client.hub)
+}
+
+func TestUpdateHubConfiguration(t *testing.T) {
+	agent, err := NewAgent(t.TempDir())
+	require.NoError(t, err)
+	config := &system.MonitoringConfig{}
+
+	require.NoError(t, agent.UpdateHubConfiguration("hub-a", config, 100, true, true))
+	assert.EqualValues(t, 100, agent.lastConfigVersion)
+
+	// an older configuration of another hub is rejected, even when forced
+	assert.Error(t, agent.UpdateHubConfiguration("hub-b", config, 90, true, true))
+	assert.Error(t, agent.UpdateHubConfiguration("hub-b", config, 100, true, true))
+	assert.EqualValues(t, 100, agent.lastConfigVersion)
+	assert.Equal(t, "hub-a", agent.configSource)
+
+	// the hub of the applied configuration may still force a reload
+	require.NoError(t, agent.UpdateHubConfiguration("hub-a", config, 95, true, true))
+	assert.EqualValues(t, 95, agent.lastConfigVersion)
+
+	// a newer configuration wins and its hub becomes the source
+	require.NoError(t, agent.UpdateHubConfiguration("hub-b", config, 110, true, true))
+	assert.EqualValues(t, 110, agent.lastConfigVersion)
+	assert.Equal(t, "hub-b", agent.configSource)
+	assert.Error(t, agent.UpdateHubConfiguration("hub-a", config, 105, true, true))
+}
+
+func TestGatherStatsMultipleHubs(t *testing.T) {
+	pm, err := NewPingManager()
+	require.NoError(t, err)
+	defer pm.Close()
+	agent := &Agent{cache: NewSessionCache(time.Minute), hubResults: hubResults{}, pingManager: pm}
+	agent.hubResults.register("hub-a")
+	agent.hubResults.register("hub-b")
+	addResult := func(host string) {
+		pm.Lock()
+		pm.results[host] = &system.PingResult{Host: host, LastChecked: time.Now()}
+		pm.lastResultsTime = time.Now()
+		pm.Unlock()
+	}
+
+	// a fresh gather and a cached one hand out the same results
+	addResult("8.8.8.8")
+	first := agent.gatherStats("hub-a").Stats.PingResults
+	require.Contains(t, first, "8.8.8.8")
+	assert.Equal(t, first, agent.gatherStats("hub-b").Stats.PingResults)
+
+	// results gathered for one hub are queued for the other until it polls, after the lease too
+	addResult("1.1.1.1")
+	agent.cache.Clear()
+	second := agent.gatherStats("hub-b").Stats.PingResults
+	assert.Equal(t, []string{"1.1.1.1"}, slices.Collect(maps.Keys(second)))
+	agent.cache.Clear()
+	assert.Equal(t, second, agent.gatherStats("hub-a").Stats.PingResults)
+
+	// each hub gets its results once
+	agent.cache.Clear()
+	assert.Empty(t, agent.gatherStats("hub-b").Stats.PingResults)
+	assert.Empty(t, agent.gatherStats("hub-a").Stats.PingResults)
+}
@@ -0,0 +1,100 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// netnsDir is where iproute2 keeps named network namespaces
+const netnsDir = "/var/run/netns"
+
+// netns is a network namespace that probes run in. A nil *netns is the host namespace.
+type netns struct {
+	name string
+	path string // Namespace file, e.g. /var/run/netns/<name>
+}
+
+// newNetnsFromEnv reads NETNS, the name of a namespace created with `ip netns add` or the
+// path of a namespace file. Returns nil if not set, in which case probes use the host namespace.
+func newNetnsFromEnv() *netns {
+	name, exists := GetEnv("NETNS")
+	if !exists || name == "" {
+		return nil
+	}
+	if runtime.GOOS != "linux" {
+		slog.Warn("Ignoring NETNS, network namespaces are only supported on Linux", "netns", name)
+		return nil
+	}
+	ns := newNetns(name)
+	slog.Info("Running probes in network namespace", "netns", ns.name, "path", ns.path)
+	return ns
+}
+
+// newNetns returns the namespace with the given name or file path
+func newNetns(name string) *netns {
+	path := name
+	if !filepath.IsAbs(name) {
+		path = filepath.Join(netnsDir, name)
+	}
+	return &netns{name: name, path: path}
+}
+
+// run calls fn with the current goroutine in the namespace. Sockets and commands started by fn
+// belong to the namespace, but goroutines started by fn do not.
+func (ns *netns) run(fn func() error) error {
+	if ns == nil {
+		return fn()
+	}
+	return ns.enter(fn)
+}
+
+// dialContext returns a dial function that opens connections in the namespace.
+// Hostnames are resolved with the dialer's resolver, or the namespace's nameservers if it has none.
+func (ns *netns) dialContext(dialer *net.Dialer) func(ctx context.Context, network, address string) (net.Conn, error) {
+	if ns == nil {
+		return dialer.DialContext
+	}
+	nsDialer := *dialer
+	if nsDialer.Resolver == nil {
+		nsDialer.Resolver = &net.Resolver{
+			PreferGo: true,
+			Dial:     ns.dial(&net.Dialer{}),
+		}
+	}
+	return ns.dial(&nsDialer)
+}
+
+// dial returns a dial function that opens connections in the namespace, resolving hostnames with the dialer's resolver
+func (ns *netns) dial(dialer *net.Dialer) func(ctx context.Context, network, address string) (net.Conn, error) {
+	nsDialer := *dialer
+	// racing IPv4 and IPv6 connections dials in other goroutines, which would leave the namespace
+	nsDialer.FallbackDelay = -1
+	return func(ctx context.Context, network, address string) (conn net.Conn, err error) {
+		err = ns.run(func() error {
+			conn, err = nsDialer.DialContext(ctx, network, address)
+			return err
+		})
+		return conn, err
+	}
+}
+
+// combinedOutput runs the command in the namespace and returns its combined stdout and stderr
+func (ns *netns) combinedOutput(cmd *exec.Cmd) ([]byte, error) {
+	if ns == nil {
+		return cmd.CombinedOutput()
+	}
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	// the process inherits the namespace of the thread that starts it
+	if err := ns.run(cmd.Start); err != nil {
+		return nil, err
+	}
+	err := cmd.Wait()
+	return output.Bytes(), err
+}
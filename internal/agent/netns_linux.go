@@ -0,0 +1,40 @@
+//go:build linux
+
+package agent
+
+import (
+	"fmt"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// enter switches the locked OS thread into the namespace for the duration of fn
+func (ns *netns) enter(fn func() error) error {
+	target, err := unix.Open(ns.path, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("open network namespace %s: %w", ns.name, err)
+	}
+	defer unix.Close(target)
+
+	runtime.LockOSThread()
+	original, err := unix.Open(fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid()), unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("open current network namespace: %w", err)
+	}
+	defer unix.Close(original)
+
+	if err := unix.Setns(target, unix.CLONE_NEWNET); err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("enter network namespace %s: %w", ns.name, err)
+	}
+	defer func() {
+		// if the thread can't switch back it stays locked, so it exits with the goroutine
+		if unix.Setns(original, unix.CLONE_NEWNET) == nil {
+			runtime.UnlockOSThread()
+		}
+	}()
+
+	return fn()
+}
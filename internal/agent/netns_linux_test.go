@@ -0,0 +1,143 @@
+//go:build linux
+
+package agent
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// newTestNetns creates a network namespace with the loopback interface up. It lives as long as the test.
+func newTestNetns(t *testing.T) *netns {
+	if os.Geteuid() != 0 {
+		t.Skip("creating a network namespace requires root")
+	}
+
+	paths := make(chan string)
+	errs := make(chan error)
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+
+	go func() {
+		// the thread is never unlocked, so it exits with the goroutine along with the namespace
+		runtime.LockOSThread()
+		if err := unix.Unshare(unix.CLONE_NEWNET); err != nil {
+			errs <- err
+			return
+		}
+		if err := setLoopbackUp(); err != nil {
+			errs <- err
+			return
+		}
+		paths <- fmt.Sprintf("/proc/%d/task/%d/ns/net", os.Getpid(), unix.Gettid())
+		<-done
+	}()
+
+	select {
+	case path := <-paths:
+		return newNetns(path)
+	case err := <-errs:
+		t.Skipf("can't create a network namespace: %v", err)
+		return nil
+	}
+}
+
+// setLoopbackUp brings up the loopback interface of the current thread's namespace
+func setLoopbackUp() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	ifreq, err := unix.NewIfreq("lo")
+	if err != nil {
+		return err
+	}
+	ifreq.SetUint16(unix.IFF_UP | unix.IFF_LOOPBACK | unix.IFF_RUNNING)
+	return unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifreq)
+}
+
+// listenHTTP serves a response naming the server on a loopback port
+func listenHTTP(t *testing.T, listener net.Listener, name string) string {
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(name))
+	})}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return "http://" + listener.Addr().String()
+}
+
+func TestNetnsHttpCheck(t *testing.T) {
+	ns := newTestNetns(t)
+
+	var nsListener net.Listener
+	require.NoError(t, ns.run(func() (err error) {
+		nsListener, err = net.Listen("tcp", "127.0.0.1:0")
+		return err
+	}))
+	nsURL := listenHTTP(t, nsListener, "namespace")
+
+	hostListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	hostURL := listenHTTP(t, hostListener, "host")
+
+	hm := &HttpManager{}
+	hm.setNetns(ns)
+
+	// the server in the namespace is reachable from the probe
+	result := hm.performHttpCheck(&httpTarget{URL: nsURL, Timeout: 5 * time.Second})
+	assert.Equal(t, "success", result.Status)
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+
+	// the host loopback is a different interface, so its server is not
+	result = hm.performHttpCheck(&httpTarget{URL: hostURL, Timeout: 5 * time.Second})
+	assert.Equal(t, "error", result.Status)
+	assert.Contains(t, result.ErrorCode, "connection refused")
+
+	// the host namespace is unaffected
+	hm.setNetns(nil)
+	result = hm.performHttpCheck(&httpTarget{URL: hostURL, Timeout: 5 * time.Second})
+	assert.Equal(t, "success", result.Status)
+}
+
+func TestNetnsCommand(t *testing.T) {
+	ns := newTestNetns(t)
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	threadNetns := fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid())
+
+	hostNetns, err := os.Readlink(threadNetns)
+	require.NoError(t, err)
+	probeNetns, err := os.Readlink(ns.path)
+	require.NoError(t, err)
+	require.NotEqual(t, hostNetns, probeNetns)
+
+	output, err := ns.combinedOutput(exec.Command("readlink", "/proc/self/ns/net"))
+	require.NoError(t, err)
+	assert.Equal(t, probeNetns, strings.TrimSpace(string(output)))
+
+	// the calling thread is back in the host namespace
+	current, err := os.Readlink(threadNetns)
+	require.NoError(t, err)
+	assert.Equal(t, hostNetns, current)
+}
+
+func TestNetnsMissing(t *testing.T) {
+	ns := newNetns("beszel-missing-netns")
+	assert.Equal(t, "/var/run/netns/beszel-missing-netns", ns.path)
+
+	err := ns.run(func() error { return nil })
+	assert.ErrorContains(t, err, "beszel-missing-netns")
+}
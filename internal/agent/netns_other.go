@@ -0,0 +1,10 @@
+//go:build !linux
+
+package agent
+
+import "errors"
+
+// enter is only supported on Linux, where setns is available.
+func (ns *netns) enter(fn func() error) error {
+	return errors.New("network namespaces are only supported on Linux")
+}
@@ -3,9 +3,13 @@ package agent
 import (
 	"beszel/internal/entities/system"
 	"context"
+	"fmt"
 	"log/slog"
+	"math"
+	"net"
 	"os/exec"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -22,7 +26,16 @@ type PingManager struct {
 	ctx             context.Context
 	cancel          context.CancelFunc
 	cronScheduler   *cron.Cron
-	cronExpression  string // Cron expression for ping scheduling
+	cronExpression  string          // Cron expression for ping scheduling
+	cronSeconds     bool            // Whether the cron expression has a leading seconds field
+	resolver        *net.Resolver   // Optional resolver for target hostnames (nil lets fping resolve)
+	mtuProbe        mtuProbeFunc    // Sends a don't fragment probe of a payload size, used in mtu mode
+	smoother        *sampleSmoother // Median of recent samples per target, nil if smoothing is disabled
+	buffer          resultBuffer    // Bounds results waiting for the hub
+	netns           *netns          // Network namespace pings run in, nil for the host namespace
+	cidrMaxHosts    int             // Maximum number of hosts a CIDR target expands to
+	scheduler       schedulerStatus // Health of the cron job, reported in heartbeats
+	fpingMissing    bool            // Whether fping wasn't found at startup
 }
 
 type pingTarget struct {
@@ -30,6 +43,38 @@ type pingTarget struct {
 	lastPing time.Time
 }
 
+// Address families of ping targets
+const (
+	addressFamilyIPv4 = "ipv4"
+	addressFamilyIPv6 = "ipv6"
+)
+
+// Packet size and interval limits of ping targets
+const (
+	defaultPingPacketSize = 56    // fping's default ICMP payload size in bytes
+	minPingPacketSize     = 28    // Smallest payload accepted for ping targets
+	maxPingPacketSize     = 65507 // Largest payload fitting an IPv4 packet
+	defaultPingIntervalMs = 1000  // fping's default interval between pings to a target
+	minPingIntervalMs     = 10    // fping refuses shorter intervals when not run as root
+)
+
+// fpingFamilyFlags are the fping options restricting pings to an address family
+var fpingFamilyFlags = map[string]string{
+	addressFamilyIPv4: "-4",
+	addressFamilyIPv6: "-6",
+}
+
+// fpingUnsupportedOptionRegex matches the error of fping versions without -4 and -6
+var fpingUnsupportedOptionRegex = regexp.MustCompile(`(?i)(invalid|illegal|unknown|unrecognized) option`)
+
+// fpingSummaryRegex matches the summary line of a target, e.g.
+// 192.0.2.1 : xmt/rcv/%loss = 4/4/0%, min/avg/max = 8.91/9.01/9.12
+var fpingSummaryRegex = regexp.MustCompile(`^\s*(\S+)\s+: xmt/rcv/%loss`)
+
+// fpingProbeRegex matches the line fping prints for each reply, e.g.
+// 192.0.2.1 : [0], 64 bytes, 9.12 ms (9.12 avg, 0% loss)
+var fpingProbeRegex = regexp.MustCompile(`^\s*\S+\s+: \[\d+\], \d+ bytes, ([\d.]+) ms`)
+
 // NewPingManager creates a new ping manager
 func NewPingManager() (*PingManager, error) {
 	ctx, cancel := context.WithCancel(context.Background())
@@ -37,10 +82,17 @@ func NewPingManager() (*PingManager, error) {
 	pm := &PingManager{
 		targets:        make(map[string]*pingTarget),
 		results:        make(map[string]*system.PingResult),
+		buffer:         newResultBuffer(),
+		cidrMaxHosts:   defaultPingCidrMaxHosts,
 		ctx:            ctx,
 		cancel:         cancel,
-		cronScheduler:  cron.New(cron.WithParser(cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow))), // 5-field format
-		cronExpression: "",                                                                                                    // Will be set by hub configuration (5-field format: minute hour day month weekday)
+		cronScheduler:  cron.New(cron.WithParser(cronParser(false))),
+		cronExpression: "", // Will be set by hub configuration
+	}
+	pm.mtuProbe = pm.fpingDontFragment
+	if !installed("fping") {
+		pm.fpingMissing = true
+		slog.Warn("fping not installed, ping checks won't run")
 	}
 
 	slog.Debug("Ping manager initialized")
@@ -59,21 +111,13 @@ func (pm *PingManager) UpdateConfig(targets []system.PingTarget, cronExpression
 	pm.Lock()
 	defer pm.Unlock()
 
-	oldTargetsCount := len(pm.targets)
-	oldResultsCount := len(pm.results)
-	
-	slog.Debug("UpdateConfig called", "old_targets", oldTargetsCount, "new_targets", len(targets), "cron_expression", cronExpression)
+	slog.Debug("UpdateConfig called", "old_targets", len(pm.targets), "new_targets", len(targets), "cron_expression", cronExpression)
 
-	// Use cron expression directly - the cron library supports both 5-field and 6-field formats
+	// Use cron expression directly, it has a seconds field if set with SetCronSeconds
 	pm.cronExpression = cronExpression
 
-	// Clear existing targets and results to prevent stale data
+	// Replace the targets, results are pruned below once the new targets are known
 	pm.targets = make(map[string]*pingTarget)
-	pm.results = make(map[string]*system.PingResult)
-	
-	if oldTargetsCount > 0 || oldResultsCount > 0 {
-		slog.Info("Cleared old ping configuration", "old_targets", oldTargetsCount, "old_results", oldResultsCount)
-	}
 
 	// Add new targets
 	for _, target := range targets {
@@ -83,18 +127,117 @@ func (pm *PingManager) UpdateConfig(targets []system.PingTarget, cronExpression
 		if target.Timeout <= 0 {
 			target.Timeout = 5 * time.Second
 		}
+		if target.PacketSize <= 0 {
+			target.PacketSize = defaultPingPacketSize
+		} else if target.PacketSize < minPingPacketSize || target.PacketSize > maxPingPacketSize {
+			slog.Warn("Ping packet size out of range, clamping", "host", target.Host, "packet_size", target.PacketSize)
+			target.PacketSize = min(max(target.PacketSize, minPingPacketSize), maxPingPacketSize)
+		}
+		if target.IntervalMs <= 0 {
+			target.IntervalMs = defaultPingIntervalMs
+		} else if target.IntervalMs < minPingIntervalMs {
+			slog.Warn("Ping interval too short, clamping", "host", target.Host, "interval_ms", target.IntervalMs)
+			target.IntervalMs = minPingIntervalMs
+		}
 
-		pm.targets[target.Host] = &pingTarget{
-			PingTarget: target,
-			lastPing:   time.Time{}, // Will trigger immediate ping
+		// a CIDR range is pinged as one target per usable address
+		hosts := []string{target.Host}
+		if addrs, ok := expandCidr(target.Host, pm.cidrMaxHosts); ok {
+			hosts = addrs
 		}
+		for _, host := range hosts {
+			hostTarget := target
+			hostTarget.Host = host
+			pm.targets[host] = &pingTarget{
+				PingTarget: hostTarget,
+				lastPing:   time.Time{}, // Not checked yet, the run started below checks it
+			}
+		}
+	}
 
+	if dropped := pruneResults(&pm.buffer, pm.results, func(host string) bool { return pm.targets[host] != nil }); dropped > 0 {
+		slog.Info("Dropped results of removed ping targets", "results", dropped)
+	}
+	// a CIDR range can have more hosts than the buffer has room for results
+	pm.buffer.fit(len(pm.targets))
+	if pm.smoother != nil {
+		pm.smoother.prune(func(host string) bool { return pm.targets[host] != nil })
+	}
+
+	if pm.fpingMissing && len(pm.targets) > 0 {
+		pm.scheduler.setMissing("fping")
+	} else {
+		pm.scheduler.setMissing("")
 	}
 
 	// Reschedule the ping job with new cron expression
 	pm.schedulePingJob()
 
-	slog.Debug("Updated ping config", "targets", len(targets))
+	// run the checks right away instead of waiting for the first scheduled run, unless neither the
+	// targets nor the schedule changed
+	if pm.scheduler.changed(targets, cronExpression) && len(pm.targets) > 0 && pm.cronExpression != "" {
+		go pm.scheduler.run(pm.checkPings)
+	}
+
+	slog.Debug("Updated ping config", "targets", len(targets), "hosts", len(pm.targets))
+}
+
+// SetResolver sets the resolver used for target hostnames
+func (pm *PingManager) SetResolver(resolver *net.Resolver) {
+	pm.Lock()
+	defer pm.Unlock()
+	pm.resolver = resolver
+}
+
+// setNetns sets the network namespace pings run in, nil uses the host namespace
+func (pm *PingManager) setNetns(ns *netns) {
+	pm.Lock()
+	defer pm.Unlock()
+	pm.netns = ns
+}
+
+// SetCidrMaxHosts sets the maximum number of hosts a CIDR target expands to, values below 1 restore the default.
+// Takes effect on the next configuration update.
+func (pm *PingManager) SetCidrMaxHosts(maxHosts int) {
+	pm.Lock()
+	defer pm.Unlock()
+	if maxHosts < 1 {
+		maxHosts = defaultPingCidrMaxHosts
+	}
+	pm.cidrMaxHosts = maxHosts
+}
+
+// SetSmoothing sets the number of samples the smoothed RTT is the median of, 0 or 1 disables smoothing
+func (pm *PingManager) SetSmoothing(samples int) {
+	pm.Lock()
+	defer pm.Unlock()
+	pm.smoother = updateSmoother(pm.smoother, samples)
+}
+
+// SetCronSeconds sets whether cron expressions have a leading seconds field, used from the next UpdateConfig
+func (pm *PingManager) SetCronSeconds(seconds bool) {
+	pm.Lock()
+	defer pm.Unlock()
+	pm.cronSeconds = seconds
+}
+
+// SetJitter sets the seed of the phase offsets spreading the targets of scheduled runs, empty runs them all at once
+func (pm *PingManager) SetJitter(seed string) {
+	pm.scheduler.setJitter(seed)
+}
+
+// SetResultBufferSize sets how many uncollected results are kept before the oldest are dropped
+func (pm *PingManager) SetResultBufferSize(size int) {
+	pm.Lock()
+	defer pm.Unlock()
+	pm.buffer.setSize(size)
+}
+
+// DroppedResults returns the number of ping results dropped because the hub didn't collect them in time
+func (pm *PingManager) DroppedResults() uint64 {
+	pm.RLock()
+	defer pm.RUnlock()
+	return pm.buffer.dropped
 }
 
 // GetResults returns the current ping results and keeps them available for a reasonable period
@@ -118,12 +261,18 @@ func (pm *PingManager) GetResults() map[string]*system.PingResult {
 	results := make(map[string]*system.PingResult)
 	for host, result := range pm.results {
 		results[host] = &system.PingResult{
-			Host:        result.Host,
-			PacketLoss:  result.PacketLoss,
-			MinRtt:      result.MinRtt,
-			MaxRtt:      result.MaxRtt,
-			AvgRtt:      result.AvgRtt,
-			LastChecked: result.LastChecked,
+			Host:           result.Host,
+			PacketLoss:     result.PacketLoss,
+			MinRtt:         result.MinRtt,
+			MaxRtt:         result.MaxRtt,
+			AvgRtt:         result.AvgRtt,
+			LastChecked:    result.LastChecked,
+			Mtu:            result.Mtu,
+			SmoothedAvgRtt: result.SmoothedAvgRtt,
+			AddressFamily:  result.AddressFamily,
+			StdDevRtt:      result.StdDevRtt,
+			Samples:        slices.Clone(result.Samples),
+			ErrorCode:      result.ErrorCode,
 		}
 	}
 
@@ -144,22 +293,26 @@ func (pm *PingManager) Close() {
 func (pm *PingManager) schedulePingJob() {
 	// Remove all existing jobs
 	pm.cronScheduler.Stop()
-	pm.cronScheduler = cron.New(cron.WithParser(cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow))) // 5-field format
+	pm.cronScheduler = cron.New(cron.WithParser(cronParser(pm.cronSeconds)))
 	pm.cronScheduler.Start()
 
 	// Only schedule if we have a valid cron expression
 	if pm.cronExpression != "" {
-		_, err := pm.cronScheduler.AddFunc(pm.cronExpression, func() {
+		id, err := pm.cronScheduler.AddFunc(pm.cronExpression, func() {
 			slog.Debug("Running ping tests")
-			pm.checkPings()
+			if !pm.scheduler.runScheduled(pm.checkPings) {
+				slog.Warn("Skipping scheduled ping tests, the previous run is still going", "cron_expression", pm.cronExpression)
+			}
 		})
 		if err != nil {
 			slog.Error("Failed to schedule ping job", "cron_expression", pm.cronExpression, "error", err)
 		} else {
 			slog.Debug("Scheduled ping job")
 		}
+		pm.scheduler.scheduled(pm.cronScheduler.Entry(id).Schedule, err)
 	} else {
 		slog.Debug("No cron expression set, ping job not scheduled")
+		pm.scheduler.scheduled(nil, nil)
 	}
 }
 
@@ -172,12 +325,29 @@ func (pm *PingManager) checkPings() {
 	}
 	pm.RUnlock()
 
+	// without fping no ping gets through, so the hub sees why instead of missing results
+	if pm.fpingMissing {
+		slog.Debug("Skipping ping tests, fping not installed")
+		for _, target := range targets {
+			pm.updateResult(target.Host, &system.PingResult{
+				Host:        target.Host,
+				PacketLoss:  100,
+				ErrorCode:   "fping_not_installed: fping isn't in the PATH",
+				LastChecked: time.Now(),
+			})
+		}
+		return
+	}
+
 	// Ping targets concurrently
 	var wg sync.WaitGroup
 	for _, target := range targets {
 		wg.Add(1)
 		go func(t *pingTarget) {
 			defer wg.Done()
+			if !pm.scheduler.waitPhase(pm.ctx, t.Host) {
+				return
+			}
 			pm.pingTarget(t)
 		}(target)
 	}
@@ -195,6 +365,11 @@ func (pm *PingManager) pingTarget(target *pingTarget) {
 		LastChecked: time.Now(),
 	}
 
+	// discover the MTU first, the result is shared once fping stores it
+	if target.Mode == pingModeMtu {
+		result.Mtu = pm.discoverMtu(target)
+	}
+
 	pm.fping(target, result)
 }
 
@@ -204,22 +379,37 @@ func (pm *PingManager) fping(target *pingTarget, result *system.PingResult) {
 	// Build fping command with options
 	// -c: count of pings
 	// -t: timeout in milliseconds (default is 500ms per ping)
-	// -q: quiet mode (only summary output)
+	// -b: ICMP payload size in bytes
+	// -p: interval between pings in milliseconds
+	// -A: show targets by address, so the summary tells which address family was used
+	// Quiet mode (-q) isn't used as the per-reply lines carry the RTT samples
 	timeoutMs := int(target.Timeout.Milliseconds())
 	if timeoutMs < 1000 {
 		timeoutMs = 1000 // Minimum 1 second timeout
 	}
-	args := []string{"-c", strconv.Itoa(target.Count), "-t", strconv.Itoa(timeoutMs), "-q", target.Host}
 
-	cmd := exec.Command("fping", args...)
+	// Resolve the hostname ourselves if a custom resolver is configured
+	addr, err := pm.resolveHost(target)
+	if err != nil {
+		slog.Debug("Failed to resolve ping target", "host", target.Host, "error", err)
+		return
+	}
+
+	args := []string{
+		"-c", strconv.Itoa(target.Count),
+		"-t", strconv.Itoa(timeoutMs),
+		"-b", strconv.Itoa(target.PacketSize),
+		"-p", strconv.Itoa(target.IntervalMs),
+		"-A", addr,
+	}
 
 	// Set timeout for the entire command - give fping enough time to complete
-	ctx, cancel := context.WithTimeout(context.Background(), target.Timeout*time.Duration(target.Count)+10*time.Second)
+	interval := time.Duration(target.IntervalMs) * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), (target.Timeout+interval)*time.Duration(target.Count)+10*time.Second)
 	defer cancel()
-	cmd = exec.CommandContext(ctx, cmd.Path, cmd.Args[1:]...)
 
 	// Execute fping
-	output, err := cmd.CombinedOutput()
+	output, err := pm.runFping(ctx, target.AddressFamily, args)
 	outputStr := string(output)
 
 	if err != nil {
@@ -227,7 +417,77 @@ func (pm *PingManager) fping(target *pingTarget, result *system.PingResult) {
 	}
 
 	// fping returns non-zero exit code even on successful pings, so we always parse output
-	pm.parseFpingOutput(target.Host, outputStr, result)
+	pm.parseFpingOutput(addr, outputStr, result)
+}
+
+// runFping runs fping restricted to the address family. Older fping versions without -4 and -6
+// only ping IPv4 and come with a separate fping6 binary for IPv6, which is used as a fallback.
+func (pm *PingManager) runFping(ctx context.Context, family string, args []string) ([]byte, error) {
+	pm.RLock()
+	ns := pm.netns
+	pm.RUnlock()
+
+	flag, ok := fpingFamilyFlags[family]
+	if !ok {
+		return ns.combinedOutput(exec.CommandContext(ctx, "fping", args...))
+	}
+	output, err := ns.combinedOutput(exec.CommandContext(ctx, "fping", append([]string{flag}, args...)...))
+	if err == nil || !fpingUnsupportedOptionRegex.Match(output) {
+		return output, err
+	}
+
+	binary := "fping"
+	if family == addressFamilyIPv6 {
+		binary = "fping6"
+	}
+	slog.Debug("fping doesn't support address family options", "option", flag, "fallback", binary)
+	return ns.combinedOutput(exec.CommandContext(ctx, binary, args...))
+}
+
+// resolveHost returns the address to pass to fping for a target.
+// Without a custom resolver the host is returned unchanged.
+func (pm *PingManager) resolveHost(target *pingTarget) (string, error) {
+	pm.RLock()
+	resolver := pm.resolver
+	pm.RUnlock()
+
+	if resolver == nil || net.ParseIP(target.Host) != nil {
+		return target.Host, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), target.Timeout)
+	defer cancel()
+
+	addrs, err := resolver.LookupHost(ctx, target.Host)
+	if err != nil {
+		return "", err
+	}
+	return pickAddress(target, addrs)
+}
+
+// pickAddress returns the first of the resolved addresses of a target in its address family.
+// Without an explicit family the first address is used, like fping would.
+func pickAddress(target *pingTarget, addrs []string) (string, error) {
+	_, restricted := fpingFamilyFlags[target.AddressFamily]
+	for _, addr := range addrs {
+		if !restricted || addressFamily(addr) == target.AddressFamily {
+			return addr, nil
+		}
+	}
+	return "", fmt.Errorf("no addresses found for %s", target.Host)
+}
+
+// addressFamily returns "ipv4" or "ipv6" for an IP address, or an empty string if it isn't one
+func addressFamily(addr string) string {
+	ip := net.ParseIP(addr)
+	switch {
+	case ip == nil:
+		return ""
+	case ip.To4() != nil:
+		return addressFamilyIPv4
+	default:
+		return addressFamilyIPv6
+	}
 }
 
 // parseFpingOutput parses fping output and updates the result
@@ -243,9 +503,14 @@ func (pm *PingManager) parseFpingOutput(host, output string, result *system.Ping
 
 	slog.Debug("Parsing fping output", "host", host, "output", output)
 
+	// fping is run for a single target, so the summary line belongs to it even if it
+	// shows the resolved address instead of the configured host
 	lines := strings.Split(output, "\n")
+	samples := parseFpingSamples(lines)
 	for _, line := range lines {
-		if strings.Contains(line, host) && strings.Contains(line, "xmt/rcv/%loss") {
+		if summary := fpingSummaryRegex.FindStringSubmatch(line); summary != nil {
+			result.AddressFamily = addressFamily(summary[1])
+
 			// Extract statistics
 			statsRegex := regexp.MustCompile(`xmt/rcv/%loss = (\d+)/(\d+)/(\d+)%`)
 			statsMatch := statsRegex.FindStringSubmatch(line)
@@ -270,9 +535,13 @@ func (pm *PingManager) parseFpingOutput(host, output string, result *system.Ping
 						result.AvgRtt = avgRtt
 						result.MaxRtt = maxRtt
 					}
+					if len(samples) > 0 {
+						result.Samples = samples
+						result.StdDevRtt = stdDev(samples)
+					}
 
-					slog.Debug("fping completed", "host", host, "avg_rtt", result.AvgRtt)
-					pm.updateResult(host, result)
+					slog.Debug("fping completed", "host", result.Host, "avg_rtt", result.AvgRtt)
+					pm.updateResult(result.Host, result)
 				}
 				return
 			}
@@ -280,12 +549,49 @@ func (pm *PingManager) parseFpingOutput(host, output string, result *system.Ping
 	}
 }
 
+// parseFpingSamples returns the RTTs of the per-reply lines in fping output, duplicate replies excluded
+func parseFpingSamples(lines []string) []float64 {
+	var samples []float64
+	for _, line := range lines {
+		if strings.Contains(line, "DUP!") {
+			continue
+		}
+		if match := fpingProbeRegex.FindStringSubmatch(line); match != nil {
+			if rtt, err := strconv.ParseFloat(match[1], 64); err == nil {
+				samples = append(samples, rtt)
+			}
+		}
+	}
+	return samples
+}
+
+// stdDev returns the population standard deviation of the values, rounded to microseconds
+func stdDev(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	var variance float64
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	variance /= float64(len(values))
+	return math.Round(math.Sqrt(variance)*1000) / 1000
+}
+
 // updateResult updates the ping result for a host
 func (pm *PingManager) updateResult(host string, result *system.PingResult) {
 	pm.Lock()
 	defer pm.Unlock()
 
-	pm.results[host] = result
+	if pm.smoother != nil && result.ErrorCode == "" {
+		result.SmoothedAvgRtt = pm.smoother.add(host, result.AvgRtt)
+	}
+	bufferResult(&pm.buffer, pm.results, host, result, func(r *system.PingResult) time.Time { return r.LastChecked })
 	pm.lastResultsTime = time.Now() // Update the timestamp when results are modified
 
 }
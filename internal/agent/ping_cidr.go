@@ -0,0 +1,55 @@
+package agent
+
+import (
+	"log/slog"
+	"net/netip"
+	"strconv"
+)
+
+// defaultPingCidrMaxHosts is the number of hosts a CIDR ping target expands to by default
+const defaultPingCidrMaxHosts = 256
+
+// pingCidrMaxHostsFromEnv reads PING_CIDR_MAX_HOSTS, returning 0 if it is not set or invalid
+func pingCidrMaxHostsFromEnv() int {
+	value, exists := GetEnv("PING_CIDR_MAX_HOSTS")
+	if !exists || value == "" {
+		return 0
+	}
+	maxHosts, err := strconv.Atoi(value)
+	if err != nil || maxHosts < 1 {
+		slog.Warn("Ignoring invalid PING_CIDR_MAX_HOSTS", "value", value)
+		return 0
+	}
+	return maxHosts
+}
+
+// expandCidr returns the usable addresses of a CIDR range like "192.168.10.0/28", at most maxHosts of them.
+// The network and broadcast addresses of IPv4 ranges larger than /31 and the subnet-router anycast
+// address of IPv6 ranges larger than /127 are skipped. ok is false if host isn't a CIDR range.
+func expandCidr(host string, maxHosts int) (addrs []string, ok bool) {
+	prefix, err := netip.ParsePrefix(host)
+	if err != nil {
+		return nil, false
+	}
+	prefix = prefix.Masked()
+
+	bits := prefix.Addr().BitLen()
+	skipFirst := bits-prefix.Bits() > 1
+	skipLast := skipFirst && prefix.Addr().Is4()
+
+	addr := prefix.Addr()
+	if skipFirst {
+		addr = addr.Next()
+	}
+	for ; addr.IsValid() && prefix.Contains(addr); addr = addr.Next() {
+		if skipLast && !prefix.Contains(addr.Next()) {
+			break
+		}
+		if len(addrs) == maxHosts {
+			slog.Warn("CIDR ping target has more hosts than allowed, ignoring the rest", "cidr", host, "max_hosts", maxHosts)
+			break
+		}
+		addrs = append(addrs, addr.String())
+	}
+	return addrs, true
+}
@@ -0,0 +1,111 @@
+package agent
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// pingModeMtu is the ping target mode that also discovers the path MTU
+const pingModeMtu = "mtu"
+
+const (
+	// icmpHeaderSize is the IPv4 and ICMP header overhead added to the ping payload
+	icmpHeaderSize = 28
+	// icmpv6HeaderSize is the IPv6 and ICMPv6 header overhead added to the ping payload
+	icmpv6HeaderSize = 48
+	// maxMtu is the largest MTU probed, the usual Ethernet MTU
+	maxMtu = 1500
+	// minMtu is the smallest MTU every IPv4 host must accept
+	minMtu = 576
+	// minMtuIPv6 is the smallest MTU of every IPv6 link
+	minMtuIPv6 = 1280
+	// mtuProbeCount is the number of probes sent per payload size
+	mtuProbeCount = 2
+)
+
+// mtuProbeFunc reports whether a don't fragment ping with the given payload size reached the address
+type mtuProbeFunc func(addr string, payloadSize int, timeout time.Duration) bool
+
+var fpingReceivedRegex = regexp.MustCompile(`xmt/rcv/%loss = \d+/(\d+)/`)
+
+// discoverMtu finds the largest packet size that reaches the target without fragmentation.
+// It returns 0 if even the smallest probe is lost.
+func (pm *PingManager) discoverMtu(target *pingTarget) int {
+	addr, err := pm.resolveMtuHost(target)
+	if err != nil {
+		slog.Debug("Failed to resolve MTU probe target", "host", target.Host, "error", err)
+		return 0
+	}
+	headerSize, minimum := icmpHeaderSize, minMtu
+	if addressFamily(addr) == addressFamilyIPv6 {
+		headerSize, minimum = icmpv6HeaderSize, minMtuIPv6
+	}
+	mtu := findMtu(minimum, func(size int) bool {
+		return pm.mtuProbe(addr, size-headerSize, target.Timeout)
+	})
+	slog.Debug("MTU discovery completed", "host", target.Host, "mtu", mtu)
+	return mtu
+}
+
+// resolveMtuHost returns the address MTU probes are sent to. Unlike pings they need an IP
+// address, as the header overhead and smallest MTU depend on its family.
+func (pm *PingManager) resolveMtuHost(target *pingTarget) (string, error) {
+	addr, err := pm.resolveHost(target)
+	if err != nil || addressFamily(addr) != "" {
+		return addr, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), target.Timeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, addr)
+	if err != nil {
+		return "", err
+	}
+	return pickAddress(target, addrs)
+}
+
+// findMtu searches for the largest packet size between minimum and maxMtu for which probe succeeds.
+// Sizes below the first lost size are assumed to pass, as in a black hole packets only
+// disappear once they exceed the path MTU.
+func findMtu(minimum int, probe func(size int) bool) int {
+	if probe(maxMtu) {
+		return maxMtu
+	}
+	if !probe(minimum) {
+		return 0
+	}
+	// largest passing size is in [low, high)
+	low, high := minimum, maxMtu
+	for high-low > 1 {
+		mid := (low + high) / 2
+		if probe(mid) {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	return low
+}
+
+// fpingDontFragment sends pings with the don't fragment flag set and the given payload size,
+// restricted to the address family of addr
+func (pm *PingManager) fpingDontFragment(addr string, payloadSize int, timeout time.Duration) bool {
+	timeoutMs := max(int(timeout.Milliseconds()), 1000)
+	ctx, cancel := context.WithTimeout(pm.ctx, timeout*mtuProbeCount+10*time.Second)
+	defer cancel()
+
+	// -M: set the don't fragment flag, -b: payload size in bytes
+	args := []string{"-c", strconv.Itoa(mtuProbeCount), "-t", strconv.Itoa(timeoutMs), "-q", "-M", "-b", strconv.Itoa(payloadSize), addr}
+	// fping returns non-zero exit code when packets are lost, so we always parse output
+	output, _ := pm.runFping(ctx, addressFamily(addr), args)
+
+	match := fpingReceivedRegex.FindSubmatch(output)
+	if match == nil {
+		return false
+	}
+	received, _ := strconv.Atoi(string(match[1]))
+	return received > 0
+}
@@ -1,10 +1,19 @@
 package agent
 
 import (
+	"beszel/internal/common"
 	"beszel/internal/entities/system"
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/miekg/dns"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -231,3 +240,432 @@ func TestPingManager_ConcurrentAccess(t *testing.T) {
 	assert.NotNil(t, results)
 	assert.Contains(t, results, "test")
 }
+
+func TestPingManager_DiscoverMtu(t *testing.T) {
+	pm, err := NewPingManager()
+	require.NoError(t, err)
+	defer pm.Close()
+
+	target := &pingTarget{PingTarget: system.PingTarget{Host: "192.0.2.1", Timeout: time.Second, Mode: pingModeMtu}}
+
+	// stub path that silently drops packets larger than the path MTU
+	blackHole := func(addr string, headerSize, pathMtu int) (mtuProbeFunc, *[]int) {
+		var probed []int
+		return func(probeAddr string, payloadSize int, timeout time.Duration) bool {
+			assert.Equal(t, addr, probeAddr)
+			probed = append(probed, payloadSize)
+			return payloadSize+headerSize <= pathMtu
+		}, &probed
+	}
+
+	tests := []struct {
+		name     string
+		pathMtu  int
+		expected int
+	}{
+		{"full ethernet mtu", 1500, 1500},
+		{"pppoe", 1492, 1492},
+		{"wireguard tunnel", 1420, 1420},
+		{"ipsec tunnel", 1387, 1387},
+		{"minimum mtu", 576, 576},
+		{"unreachable", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probe, probed := blackHole("192.0.2.1", icmpHeaderSize, tt.pathMtu)
+			pm.mtuProbe = probe
+			assert.Equal(t, tt.expected, pm.discoverMtu(target))
+			assert.LessOrEqual(t, len(*probed), 12, "search should not probe every size")
+		})
+	}
+
+	// IPv6 headers are larger and no IPv6 link has an MTU below 1280
+	target6 := &pingTarget{PingTarget: system.PingTarget{Host: "2001:db8::1", Timeout: time.Second, Mode: pingModeMtu}}
+	ipv6Tests := []struct {
+		name     string
+		pathMtu  int
+		expected int
+	}{
+		{"full ethernet mtu", 1500, 1500},
+		{"wireguard tunnel", 1420, 1420},
+		{"minimum mtu", 1280, 1280},
+		{"below minimum mtu", 1200, 0},
+	}
+	for _, tt := range ipv6Tests {
+		t.Run("ipv6 "+tt.name, func(t *testing.T) {
+			probe, probed := blackHole("2001:db8::1", icmpv6HeaderSize, tt.pathMtu)
+			pm.mtuProbe = probe
+			assert.Equal(t, tt.expected, pm.discoverMtu(target6))
+			for _, payloadSize := range *probed {
+				assert.GreaterOrEqual(t, payloadSize+icmpv6HeaderSize, minMtuIPv6)
+			}
+		})
+	}
+}
+
+func TestPingManager_GetResultsIncludesMtu(t *testing.T) {
+	pm, err := NewPingManager()
+	require.NoError(t, err)
+	defer pm.Close()
+
+	pm.updateResult("192.0.2.1", &system.PingResult{Host: "192.0.2.1", AvgRtt: 10, Mtu: 1420})
+	results := pm.GetResults()
+	require.Contains(t, results, "192.0.2.1")
+	assert.Equal(t, 1420, results["192.0.2.1"].Mtu)
+}
+
+func TestPingManager_ParseFpingOutputAddressFamily(t *testing.T) {
+	pm, err := NewPingManager()
+	require.NoError(t, err)
+	defer pm.Close()
+
+	tests := []struct {
+		name   string
+		output string
+		family string
+		avgRtt float64
+	}{
+		{"ipv4 address of hostname", "142.250.74.46 : xmt/rcv/%loss = 3/3/0%, min/avg/max = 8.91/9.01/9.12\n", addressFamilyIPv4, 9.01},
+		{"ipv6 address of hostname", "2a00:1450:400e:80f::200e : xmt/rcv/%loss = 3/3/0%, min/avg/max = 10.10/10.52/11.02\n", addressFamilyIPv6, 10.52},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := &system.PingResult{Host: "google.com"}
+			pm.parseFpingOutput("google.com", tt.output, result)
+
+			results := pm.GetResults()
+			require.Contains(t, results, "google.com")
+			assert.Equal(t, tt.family, results["google.com"].AddressFamily)
+			assert.Equal(t, tt.avgRtt, results["google.com"].AvgRtt)
+		})
+	}
+}
+
+func TestPingManager_ParseFpingOutputSamples(t *testing.T) {
+	pm, err := NewPingManager()
+	require.NoError(t, err)
+	defer pm.Close()
+
+	output := `192.0.2.1 : [0], 64 bytes, 8.91 ms (8.91 avg, 0% loss)
+192.0.2.1 : [1], 64 bytes, 9.01 ms (8.96 avg, 0% loss)
+192.0.2.1 : [1], 64 bytes, 9.50 ms (8.96 avg, 0% loss) [DUP!]
+192.0.2.1 : [2], 64 bytes, 9.12 ms (9.01 avg, 0% loss)
+192.0.2.1 : [3], timed out (9.01 avg, 25% loss)
+
+192.0.2.1 : xmt/rcv/%loss = 4/3/25%, min/avg/max = 8.91/9.01/9.12
+`
+	pm.parseFpingOutput("192.0.2.1", output, &system.PingResult{Host: "192.0.2.1"})
+
+	results := pm.GetResults()
+	require.Contains(t, results, "192.0.2.1")
+	assert.Equal(t, []float64{8.91, 9.01, 9.12}, results["192.0.2.1"].Samples)
+	assert.Equal(t, 0.086, results["192.0.2.1"].StdDevRtt)
+	assert.Equal(t, 25.0, results["192.0.2.1"].PacketLoss)
+
+	// quiet output has no samples
+	pm.parseFpingOutput("192.0.2.1", "192.0.2.1 : xmt/rcv/%loss = 3/3/0%, min/avg/max = 8.91/9.01/9.12\n", &system.PingResult{Host: "192.0.2.1"})
+	results = pm.GetResults()
+	assert.Empty(t, results["192.0.2.1"].Samples)
+	assert.Zero(t, results["192.0.2.1"].StdDevRtt)
+}
+
+func TestStdDev(t *testing.T) {
+	assert.Zero(t, stdDev(nil))
+	assert.Zero(t, stdDev([]float64{5}))
+	assert.Equal(t, 2.0, stdDev([]float64{2, 4, 4, 4, 5, 5, 7, 9}))
+}
+
+func TestPingManager_RunFpingFallback(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake fping binaries are shell scripts")
+	}
+
+	// an fping without -4 and -6, which prints its arguments, and an fping6 doing the same
+	dir := t.TempDir()
+	fping := "#!/bin/sh\ncase \"$1\" in -4|-6) echo \"fping: invalid option -- '${1#-}'\" >&2; exit 1;; esac\necho \"fping $*\"\n"
+	fping6 := "#!/bin/sh\necho \"fping6 $*\"\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "fping"), []byte(fping), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "fping6"), []byte(fping6), 0o755))
+	t.Setenv("PATH", dir)
+
+	pm, err := NewPingManager()
+	require.NoError(t, err)
+	defer pm.Close()
+
+	tests := []struct {
+		family   string
+		expected string
+	}{
+		{"", "fping -q host"},
+		{"auto", "fping -q host"},
+		{addressFamilyIPv4, "fping -q host"},
+		{addressFamilyIPv6, "fping6 -q host"},
+	}
+	for _, tt := range tests {
+		output, err := pm.runFping(context.Background(), tt.family, []string{"-q", "host"})
+		require.NoError(t, err, tt.family)
+		assert.Equal(t, tt.expected, strings.TrimSpace(string(output)), tt.family)
+	}
+
+	// fping with -6 support is used directly
+	fping = "#!/bin/sh\necho \"fping $*\"\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "fping"), []byte(fping), 0o755))
+	output, err := pm.runFping(context.Background(), addressFamilyIPv6, []string{"-q", "host"})
+	require.NoError(t, err)
+	assert.Equal(t, "fping -6 -q host", strings.TrimSpace(string(output)))
+
+	// MTU probes are restricted to the family of their address, so IPv6 addresses use -6
+	fping = "#!/bin/sh\n[ \"$1\" = -6 ] && echo \"host : xmt/rcv/%loss = 2/2/0%\"\nexit 0\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "fping"), []byte(fping), 0o755))
+	assert.True(t, pm.fpingDontFragment("2001:db8::1", 1232, time.Second))
+	assert.False(t, pm.fpingDontFragment("192.0.2.1", 1472, time.Second))
+}
+
+func TestPingManager_ResolveHostAddressFamily(t *testing.T) {
+	// local DNS server with an IPv4 and an IPv6 address for every name
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(r)
+		header := dns.RR_Header{Name: r.Question[0].Name, Rrtype: r.Question[0].Qtype, Class: dns.ClassINET, Ttl: 60}
+		switch r.Question[0].Qtype {
+		case dns.TypeA:
+			resp.Answer = append(resp.Answer, &dns.A{Hdr: header, A: net.ParseIP("192.0.2.1")})
+		case dns.TypeAAAA:
+			resp.Answer = append(resp.Answer, &dns.AAAA{Hdr: header, AAAA: net.ParseIP("2001:db8::1")})
+		}
+		w.WriteMsg(resp)
+	})
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &dns.Server{PacketConn: packetConn, Handler: handler}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	pm, err := NewPingManager()
+	require.NoError(t, err)
+	defer pm.Close()
+	pm.SetResolver(&net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "udp", packetConn.LocalAddr().String())
+		},
+	})
+
+	for family, expected := range map[string]string{
+		addressFamilyIPv4: "192.0.2.1",
+		addressFamilyIPv6: "2001:db8::1",
+	} {
+		target := &pingTarget{PingTarget: system.PingTarget{Host: "gateway.example", Timeout: 2 * time.Second, AddressFamily: family}}
+		addr, err := pm.resolveHost(target)
+		require.NoError(t, err, family)
+		assert.Equal(t, expected, addr, family)
+	}
+
+	// without a family any address is used
+	target := &pingTarget{PingTarget: system.PingTarget{Host: "gateway.example", Timeout: 2 * time.Second}}
+	addr, err := pm.resolveHost(target)
+	require.NoError(t, err)
+	assert.Contains(t, []string{"192.0.2.1", "2001:db8::1"}, addr)
+}
+
+func TestPingManager_UpdateConfigPacketSizeAndInterval(t *testing.T) {
+	pm, err := NewPingManager()
+	require.NoError(t, err)
+	defer pm.Close()
+
+	pm.UpdateConfig([]system.PingTarget{
+		{Host: "default"},
+		{Host: "tunnel", PacketSize: 1472, IntervalMs: 200},
+		{Host: "small", PacketSize: 8, IntervalMs: 1},
+		{Host: "large", PacketSize: 70000},
+	}, "")
+
+	assert.Equal(t, defaultPingPacketSize, pm.targets["default"].PacketSize)
+	assert.Equal(t, defaultPingIntervalMs, pm.targets["default"].IntervalMs)
+	assert.Equal(t, 1472, pm.targets["tunnel"].PacketSize)
+	assert.Equal(t, 200, pm.targets["tunnel"].IntervalMs)
+	assert.Equal(t, minPingPacketSize, pm.targets["small"].PacketSize)
+	assert.Equal(t, minPingIntervalMs, pm.targets["small"].IntervalMs)
+	assert.Equal(t, maxPingPacketSize, pm.targets["large"].PacketSize)
+}
+
+func TestPingManager_FpingPacketSizeAndInterval(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake fping binaries are shell scripts")
+	}
+
+	// an fping that records its arguments and reports loss from fragmentation
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	fping := "#!/bin/sh\necho \"$*\" > " + argsFile + "\necho '192.0.2.1 : xmt/rcv/%loss = 4/2/50%, min/avg/max = 10.1/10.2/10.3' >&2\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "fping"), []byte(fping), 0o755))
+	t.Setenv("PATH", dir)
+
+	pm, err := NewPingManager()
+	require.NoError(t, err)
+	defer pm.Close()
+
+	pm.UpdateConfig([]system.PingTarget{{Host: "192.0.2.1", Count: 4, PacketSize: 1472, IntervalMs: 250}}, "")
+
+	result := &system.PingResult{Host: "192.0.2.1"}
+	pm.fping(pm.targets["192.0.2.1"], result)
+
+	args, err := os.ReadFile(argsFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(args), "-b 1472")
+	assert.Contains(t, string(args), "-p 250")
+	assert.Equal(t, 50.0, result.PacketLoss)
+}
+
+func TestConfigValidator_PingPacketSizeAndInterval(t *testing.T) {
+	cv := NewConfigValidator(10, time.Hour, nil)
+
+	config := &system.MonitoringConfig{}
+	config.Ping.Targets = []system.PingTarget{{Host: "192.0.2.1", PacketSize: 1472, IntervalMs: 10}, {Host: "192.0.2.2"}}
+	assert.NoError(t, cv.ValidateConfig(config))
+
+	config.Ping.Targets = []system.PingTarget{{Host: "192.0.2.1", PacketSize: 27}}
+	assert.ErrorContains(t, cv.ValidateConfig(config), "invalid ping packet size")
+
+	config.Ping.Targets = []system.PingTarget{{Host: "192.0.2.1", PacketSize: 65508}}
+	assert.ErrorContains(t, cv.ValidateConfig(config), "invalid ping packet size")
+
+	config.Ping.Targets = []system.PingTarget{{Host: "192.0.2.1", IntervalMs: 9}}
+	assert.ErrorContains(t, cv.ValidateConfig(config), "invalid ping interval")
+}
+
+func TestConfigValidator_RejectInvalidTargets(t *testing.T) {
+	cv := NewConfigValidator(2, time.Hour, nil)
+
+	config := &system.MonitoringConfig{}
+	config.Enabled.Ping, config.Enabled.Dns, config.Enabled.Http = true, true, true
+	config.Ping.Targets = []system.PingTarget{{Host: "192.0.2.1"}, {Host: "192.0.2.2", PacketSize: 27}, {Host: "192.0.2.3"}, {Host: "192.0.2.4"}}
+	config.Dns.Targets = []system.DnsTarget{{Domain: "example.com", Server: "8.8.8.8"}, {Domain: "example.org", Server: "8.8.8.8:99999"}}
+	config.Http.Targets = []system.HttpTarget{{URL: "https://example.com", BodyMatch: "("}}
+	// targets of disabled services are left out without being reported
+	config.Speedtest.Targets = []system.SpeedtestTarget{{ServerID: "1"}}
+
+	ack := cv.RejectInvalidTargets(config)
+	assert.Equal(t, 3, ack.Applied)
+	assert.Equal(t, 7, ack.Total)
+	require.Len(t, ack.Rejected, 4)
+	assert.Equal(t, common.RejectedTarget{Service: "ping", Target: "192.0.2.2", Reason: "invalid ping packet size for 192.0.2.2: 27 (must be 28-65507)"}, ack.Rejected[0])
+	assert.Equal(t, "192.0.2.4", ack.Rejected[1].Target)
+	assert.Contains(t, ack.Rejected[1].Reason, "too many ping targets")
+	assert.Equal(t, "example.org@8.8.8.8:99999#", ack.Rejected[2].Target)
+	assert.Contains(t, ack.Rejected[2].Reason, "invalid port")
+	assert.Equal(t, "https://example.com", ack.Rejected[3].Target)
+	assert.Contains(t, ack.Rejected[3].Reason, "invalid body match")
+
+	assert.Equal(t, []system.PingTarget{{Host: "192.0.2.1"}, {Host: "192.0.2.3"}}, config.Ping.Targets)
+	assert.Len(t, config.Dns.Targets, 1)
+	assert.Empty(t, config.Http.Targets)
+	// the remaining configuration passes validation
+	assert.NoError(t, cv.ValidateConfig(config))
+}
+
+func TestExpandCidr(t *testing.T) {
+	tests := []struct {
+		host     string
+		maxHosts int
+		ok       bool
+		expected []string
+	}{
+		{"192.0.2.1", 256, false, nil},
+		{"example.com", 256, false, nil},
+		{"192.0.2.0/30", 256, true, []string{"192.0.2.1", "192.0.2.2"}},
+		{"192.0.2.5/30", 256, true, []string{"192.0.2.5", "192.0.2.6"}},
+		{"192.0.2.0/31", 256, true, []string{"192.0.2.0", "192.0.2.1"}},
+		{"192.0.2.7/32", 256, true, []string{"192.0.2.7"}},
+		{"2001:db8::/126", 256, true, []string{"2001:db8::1", "2001:db8::2", "2001:db8::3"}},
+		{"192.0.2.0/24", 3, true, []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"}},
+	}
+	for _, tt := range tests {
+		addrs, ok := expandCidr(tt.host, tt.maxHosts)
+		assert.Equal(t, tt.ok, ok, tt.host)
+		assert.Equal(t, tt.expected, addrs, tt.host)
+	}
+
+	addrs, _ := expandCidr("192.168.10.0/28", defaultPingCidrMaxHosts)
+	assert.Len(t, addrs, 14)
+}
+
+func TestPingManager_UpdateConfigCidr(t *testing.T) {
+	pm, err := NewPingManager()
+	require.NoError(t, err)
+	defer pm.Close()
+
+	pm.SetCidrMaxHosts(4)
+	pm.UpdateConfig([]system.PingTarget{
+		{Host: "192.0.2.0/29", Count: 2, Mode: "mtu"},
+		{Host: "198.51.100.1"},
+	}, "")
+
+	assert.Len(t, pm.targets, 5)
+	for _, host := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "192.0.2.4"} {
+		require.Contains(t, pm.targets, host)
+		assert.Equal(t, host, pm.targets[host].Host)
+		assert.Equal(t, 2, pm.targets[host].Count)
+		assert.Equal(t, "mtu", pm.targets[host].Mode)
+	}
+	assert.Contains(t, pm.targets, "198.51.100.1")
+	assert.NotContains(t, pm.targets, "192.0.2.0/29")
+
+	// invalid values restore the default
+	pm.SetCidrMaxHosts(0)
+	assert.Equal(t, defaultPingCidrMaxHosts, pm.cidrMaxHosts)
+}
+
+func TestPingManager_CidrResultsFitBuffer(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake fping binaries are shell scripts")
+	}
+
+	// an fping answering every address, given as the last argument
+	dir := t.TempDir()
+	fping := "#!/bin/sh\neval addr=\\${$#}\necho \"$addr : xmt/rcv/%loss = 1/1/0%, min/avg/max = 1.00/1.00/1.00\"\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "fping"), []byte(fping), 0o755))
+	t.Setenv("PATH", dir)
+
+	pm, err := NewPingManager()
+	require.NoError(t, err)
+	defer pm.Close()
+
+	// a /24 has more hosts than the default buffer has room for
+	pm.UpdateConfig([]system.PingTarget{{Host: "192.0.2.0/24", Count: 1}}, "")
+	require.Len(t, pm.targets, 254)
+	require.Greater(t, len(pm.targets), defaultResultBufferSize)
+
+	pm.checkPings()
+	results := pm.GetResults()
+	assert.Len(t, results, 254)
+	assert.Equal(t, 1.0, results["192.0.2.254"].AvgRtt)
+	assert.Zero(t, pm.DroppedResults())
+}
+
+func TestPingManager_FpingMissing(t *testing.T) {
+	lookPath = func(file string) (string, error) { return "", &exec.Error{Name: file, Err: exec.ErrNotFound} }
+	defer func() { lookPath = exec.LookPath }()
+
+	pm, err := NewPingManager()
+	require.NoError(t, err)
+	defer pm.Close()
+
+	// nothing is reported until ping targets are configured
+	assert.Empty(t, pm.scheduler.report(common.ServicePing).Unavailable)
+
+	pm.UpdateConfig([]system.PingTarget{{Host: "127.0.0.1"}}, "")
+	assert.Equal(t, "fping not installed", pm.scheduler.report(common.ServicePing).Unavailable)
+
+	// fping isn't run, each target gets an error result instead of the raw exec error
+	pm.checkPings()
+	results := pm.GetResults()
+	require.Contains(t, results, "127.0.0.1")
+	assert.Equal(t, "fping_not_installed: fping isn't in the PATH", results["127.0.0.1"].ErrorCode)
+	assert.Equal(t, 100.0, results["127.0.0.1"].PacketLoss)
+	assert.Zero(t, results["127.0.0.1"].AvgRtt)
+
+	pm.UpdateConfig(nil, "")
+	assert.Empty(t, pm.scheduler.report(common.ServicePing).Unavailable)
+}
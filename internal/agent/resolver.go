@@ -0,0 +1,114 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// defaultDoHResolverTimeout is the timeout for a single query to the DoH resolver
+const defaultDoHResolverTimeout = 5 * time.Second
+
+// newResolverFromEnv returns a resolver backed by the DoH server in DOH_RESOLVER.
+// Returns nil if not configured, in which case the OS resolver is used.
+func newResolverFromEnv() *net.Resolver {
+	server, exists := GetEnv("DOH_RESOLVER")
+	if !exists || server == "" {
+		return nil
+	}
+	slog.Info("Resolving target hostnames via DoH", "server", server)
+	return NewDoHResolver(server, defaultDoHResolverTimeout)
+}
+
+// NewDoHResolver creates a net.Resolver that sends every query to the given
+// DNS over HTTPS server instead of the nameservers from the OS configuration.
+func NewDoHResolver(server string, timeout time.Duration) *net.Resolver {
+	// The DoH server itself is resolved with the OS resolver
+	client := &http.Client{Timeout: timeout}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return &dohConn{ctx: ctx, client: client, server: server}, nil
+		},
+	}
+}
+
+// dohConn is a net.Conn that answers DNS queries written by the Go resolver
+// using a DoH server. It does not implement net.PacketConn, so the resolver
+// uses TCP framing (two byte length prefix) for messages.
+type dohConn struct {
+	ctx    context.Context
+	client *http.Client
+	server string
+	wbuf   bytes.Buffer // Pending query bytes written by the resolver
+	rbuf   bytes.Buffer // Framed responses waiting to be read
+}
+
+// Write buffers the query and performs the DoH exchange once a full message is received
+func (c *dohConn) Write(b []byte) (int, error) {
+	c.wbuf.Write(b)
+
+	for c.wbuf.Len() >= 2 {
+		size := int(binary.BigEndian.Uint16(c.wbuf.Bytes()[:2]))
+		if c.wbuf.Len() < 2+size {
+			break
+		}
+		query := make([]byte, size)
+		c.wbuf.Next(2)
+		c.wbuf.Read(query)
+
+		if err := c.exchange(query); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// exchange sends a single wire format query and queues the framed response
+func (c *dohConn) exchange(query []byte) error {
+	msg := &dns.Msg{}
+	if err := msg.Unpack(query); err != nil {
+		return err
+	}
+
+	resp, err := exchangeDoH(c.ctx, c.client, c.server, msg)
+	if err != nil {
+		return err
+	}
+
+	answer, err := resp.Pack()
+	if err != nil {
+		return err
+	}
+	if len(answer) > 0xffff {
+		return errors.New("DoH response too large")
+	}
+
+	c.rbuf.Write(binary.BigEndian.AppendUint16(nil, uint16(len(answer))))
+	c.rbuf.Write(answer)
+	return nil
+}
+
+// Read returns buffered responses
+func (c *dohConn) Read(b []byte) (int, error) {
+	if c.rbuf.Len() == 0 {
+		return 0, io.EOF
+	}
+	return c.rbuf.Read(b)
+}
+
+func (c *dohConn) Close() error                       { return nil }
+func (c *dohConn) LocalAddr() net.Addr                { return nil }
+func (c *dohConn) RemoteAddr() net.Addr               { return nil }
+func (c *dohConn) SetDeadline(t time.Time) error      { return nil }
+func (c *dohConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *dohConn) SetWriteDeadline(t time.Time) error { return nil }
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package agent
+
+import (
+	"os"
+	"syscall"
+)
+
+// restartAgent replaces the agent process with the binary at its path, keeping its arguments
+// and environment. A variable so tests can replace it.
+var restartAgent = func() error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(executable, os.Args, os.Environ())
+}
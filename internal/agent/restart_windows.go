@@ -0,0 +1,12 @@
+//go:build windows
+
+package agent
+
+import "os"
+
+// restartAgent exits so the service manager starts the agent with the new binary,
+// Windows can't replace a running process. A variable so tests can replace it.
+var restartAgent = func() error {
+	os.Exit(1)
+	return nil
+}
@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// defaultResultBufferSize is the number of uncollected results a manager keeps by default
+const defaultResultBufferSize = 100
+
+// resultBuffer bounds the results a manager keeps until the hub collects them,
+// so a hub that is slow to request data causes data loss instead of memory growth
+type resultBuffer struct {
+	size      int                 // Maximum number of uncollected results
+	targets   int                 // Configured targets, the buffer keeps at least one result of each
+	dropped   uint64              // Results dropped since the agent started
+	collected map[string]struct{} // Keys of results the hub collected that the manager keeps, see markCollected
+	latest    map[string]any      // Latest result of each key whether the hub collected it or not, for the status server
+}
+
+func newResultBuffer() resultBuffer {
+	return resultBuffer{size: defaultResultBufferSize}
+}
+
+// setSize changes the maximum number of uncollected results, values below 1 restore the default
+func (b *resultBuffer) setSize(size int) {
+	if size < 1 {
+		size = defaultResultBufferSize
+	}
+	b.size = size
+}
+
+// fit makes the buffer keep at least one result per target, so a single run of many targets,
+// like a CIDR range, doesn't drop results while the hub collects them in time
+func (b *resultBuffer) fit(targets int) {
+	b.targets = targets
+}
+
+// limit returns the maximum number of uncollected results, the size unless there are more targets
+func (b *resultBuffer) limit() int {
+	return max(b.size, b.targets)
+}
+
+// bufferResult stores a result that is waiting for the hub. A previous result for the same key
+// is replaced, and the oldest results are dropped when the buffer is full. Both count as dropped
+// results unless the hub already collected them.
+func bufferResult[T any](b *resultBuffer, results map[string]T, key string, result T, lastChecked func(T) time.Time) {
+	if _, exists := results[key]; exists {
+		b.drop(key)
+		delete(results, key)
+	}
+	for len(results) >= b.limit() {
+		var oldestKey string
+		var oldest time.Time
+		for k, r := range results {
+			if checked := lastChecked(r); oldestKey == "" || checked.Before(oldest) {
+				oldestKey, oldest = k, checked
+			}
+		}
+		delete(results, oldestKey)
+		b.drop(oldestKey)
+	}
+	results[key] = result
+	if b.latest == nil {
+		b.latest = make(map[string]any)
+	}
+	b.latest[key] = result
+}
+
+// drop counts the removal of the result of key as dropped if the hub didn't collect it
+func (b *resultBuffer) drop(key string) {
+	if _, ok := b.collected[key]; ok {
+		delete(b.collected, key)
+		return
+	}
+	b.dropped++
+}
+
+// markCollected records that the hub collected the results, for managers that keep their
+// results after the hub collected them instead of clearing them
+func markCollected[T any](b *resultBuffer, results map[string]T) {
+	b.collected = make(map[string]struct{}, len(results))
+	for key := range results {
+		b.collected[key] = struct{}{}
+	}
+}
+
+// pruneResults drops the uncollected results of targets that aren't configured anymore and
+// returns how many it dropped, so a configuration update keeps the results of unchanged targets.
+// Their latest results are forgotten as well.
+func pruneResults[T any](b *resultBuffer, results map[string]T, configured func(key string) bool) int {
+	for key := range b.latest {
+		if !configured(key) {
+			delete(b.latest, key)
+		}
+	}
+	var dropped int
+	for key := range results {
+		if !configured(key) {
+			delete(results, key)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// resultBufferSizeFromEnv reads RESULT_BUFFER_SIZE, returning 0 if it is not set or invalid
+func resultBufferSizeFromEnv() int {
+	value, exists := GetEnv("RESULT_BUFFER_SIZE")
+	if !exists || value == "" {
+		return 0
+	}
+	size, err := strconv.Atoi(value)
+	if err != nil || size < 1 {
+		slog.Warn("Ignoring invalid RESULT_BUFFER_SIZE", "value", value)
+		return 0
+	}
+	return size
+}
@@ -0,0 +1,100 @@
+package agent
+
+import (
+	"beszel/internal/entities/system"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultBuffer_DropsOldest(t *testing.T) {
+	pm, err := NewPingManager()
+	require.NoError(t, err)
+	defer pm.Close()
+	pm.SetResultBufferSize(3)
+
+	start := time.Now()
+	for i := range 5 {
+		host := fmt.Sprintf("10.0.0.%d", i)
+		pm.updateResult(host, &system.PingResult{Host: host, AvgRtt: float64(i), LastChecked: start.Add(time.Duration(i) * time.Second)})
+	}
+	assert.Equal(t, uint64(2), pm.DroppedResults())
+
+	// an uncollected result replaced by a newer one for the same target is dropped too
+	pm.updateResult("10.0.0.4", &system.PingResult{Host: "10.0.0.4", AvgRtt: 40, LastChecked: start.Add(5 * time.Second)})
+	assert.Equal(t, uint64(3), pm.DroppedResults())
+
+	results := pm.GetResults()
+	require.Len(t, results, 3)
+	assert.NotContains(t, results, "10.0.0.0")
+	assert.NotContains(t, results, "10.0.0.1")
+	assert.Contains(t, results, "10.0.0.2")
+	assert.Contains(t, results, "10.0.0.3")
+	assert.Equal(t, 40.0, results["10.0.0.4"].AvgRtt)
+
+	// collected results don't count as dropped
+	pm.updateResult("10.0.0.4", &system.PingResult{Host: "10.0.0.4", LastChecked: start.Add(6 * time.Second)})
+	assert.Equal(t, uint64(3), pm.DroppedResults())
+}
+
+func TestResultBuffer_KeptCollectedResults(t *testing.T) {
+	buffer := newResultBuffer()
+	results := map[string]*system.SpeedtestResult{}
+	lastChecked := func(r *system.SpeedtestResult) time.Time { return r.LastChecked }
+	bufferResult(&buffer, results, "1234", &system.SpeedtestResult{LastChecked: time.Now()}, lastChecked)
+
+	// replacing a result the hub collected, but the manager kept, isn't a drop
+	markCollected(&buffer, results)
+	bufferResult(&buffer, results, "1234", &system.SpeedtestResult{LastChecked: time.Now()}, lastChecked)
+	assert.Zero(t, buffer.dropped)
+
+	// the new result wasn't collected yet
+	bufferResult(&buffer, results, "1234", &system.SpeedtestResult{LastChecked: time.Now()}, lastChecked)
+	assert.Equal(t, uint64(1), buffer.dropped)
+}
+
+func TestResultBuffer_SetSize(t *testing.T) {
+	buffer := newResultBuffer()
+	assert.Equal(t, defaultResultBufferSize, buffer.size)
+
+	buffer.setSize(2)
+	assert.Equal(t, 2, buffer.size)
+	buffer.setSize(0)
+	assert.Equal(t, defaultResultBufferSize, buffer.size, "invalid sizes restore the default")
+
+	// shrinking the buffer drops the oldest results on the next add
+	buffer.setSize(3)
+	results := map[string]*system.DnsResult{}
+	lastChecked := func(r *system.DnsResult) time.Time { return r.LastChecked }
+	start := time.Now()
+	for i := range 3 {
+		key := fmt.Sprintf("example%d.com", i)
+		bufferResult(&buffer, results, key, &system.DnsResult{Domain: key, LastChecked: start.Add(time.Duration(i) * time.Second)}, lastChecked)
+	}
+	buffer.setSize(1)
+	bufferResult(&buffer, results, "example3.com", &system.DnsResult{Domain: "example3.com", LastChecked: start.Add(3 * time.Second)}, lastChecked)
+	assert.Len(t, results, 1)
+	assert.Contains(t, results, "example3.com")
+	assert.Equal(t, uint64(3), buffer.dropped)
+	// the latest results are kept for the status server even when dropped
+	assert.Len(t, buffer.latest, 4)
+
+	// pruning forgets the latest results of removed targets as well
+	assert.Equal(t, 0, pruneResults(&buffer, results, func(key string) bool { return key != "example0.com" }))
+	assert.Len(t, buffer.latest, 3)
+	assert.NotContains(t, buffer.latest, "example0.com")
+}
+
+func TestResultBufferSizeFromEnv(t *testing.T) {
+	t.Setenv("BESZEL_AGENT_RESULT_BUFFER_SIZE", "")
+	assert.Equal(t, 0, resultBufferSizeFromEnv())
+
+	t.Setenv("BESZEL_AGENT_RESULT_BUFFER_SIZE", "250")
+	assert.Equal(t, 250, resultBufferSizeFromEnv())
+
+	t.Setenv("BESZEL_AGENT_RESULT_BUFFER_SIZE", "-1")
+	assert.Equal(t, 0, resultBufferSizeFromEnv())
+}
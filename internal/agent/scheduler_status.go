@@ -0,0 +1,209 @@
+package agent
+
+import (
+	"beszel/internal/entities/system"
+	"context"
+	"hash/fnv"
+	"math"
+	"os/exec"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// heartbeatInterval is how often the agent reports the health of its schedulers to the hub
+const heartbeatInterval = time.Minute
+
+// lookPath finds the tools the checks run. A variable so tests can replace it.
+var lookPath = exec.LookPath
+
+// installed reports whether a tool the checks run is in the PATH
+func installed(tool string) bool {
+	_, err := lookPath(tool)
+	return err == nil
+}
+
+// schedulerStatus tracks a manager's cron job for the heartbeat. It has its own lock
+// because jobs record their runs while the manager may be locked.
+type schedulerStatus struct {
+	mu         sync.Mutex
+	active     bool          // Whether the job is scheduled
+	lastRun    time.Time     // When the job last ran
+	lastErr    string        // Why the job couldn't be scheduled
+	running    bool          // Whether the checks are running, scheduled or not
+	missing    string        // Tool the configured checks need that isn't installed
+	schedule   cron.Schedule // Schedule of the job, nil if it isn't scheduled
+	jitterSeed string        // Identifies the agent in the phase offsets of targets, empty disables jitter
+	phaseStart time.Time     // Start of the scheduled run delaying its targets, zero otherwise
+	phaseSpan  time.Duration // Span the phase offsets of the current run are spread over
+	configured any           // Targets and cron expression of the last configuration update, see changed
+}
+
+// scheduled records the outcome of scheduling the job, schedule is nil if there is no job
+func (s *schedulerStatus) scheduled(schedule cron.Schedule, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active = schedule != nil && err == nil
+	s.schedule = schedule
+	s.lastErr = ""
+	if err != nil {
+		s.lastErr = err.Error()
+	}
+}
+
+// changed records the targets and cron expression of a configuration update and reports whether
+// they differ from the previous update's, so an update that leaves a service as it was, like the
+// configuration pushed when the agent reconnects, doesn't run its checks right away
+func (s *schedulerStatus) changed(targets any, cronExpression string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	configured := struct {
+		targets        any
+		cronExpression string
+	}{targets, cronExpression}
+	if reflect.DeepEqual(s.configured, configured) {
+		return false
+	}
+	s.configured = configured
+	return true
+}
+
+// setJitter sets the seed of the phase offsets of targets in scheduled runs, empty disables them
+func (s *schedulerStatus) setJitter(seed string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jitterSeed = seed
+}
+
+// ran records that the job ran, see runScheduled
+func (s *schedulerStatus) ran() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastRun = time.Now()
+}
+
+// setMissing records a tool the configured checks need that isn't installed, empty if none is missing
+func (s *schedulerStatus) setMissing(tool string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.missing = tool
+}
+
+// start marks the checks as running, returning false if they already are
+func (s *schedulerStatus) start() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return false
+	}
+	s.running = true
+	return true
+}
+
+// finish marks the checks as no longer running
+func (s *schedulerStatus) finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = false
+}
+
+// isRunning reports whether the checks are running
+func (s *schedulerStatus) isRunning() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+// run runs the checks unless they are already running, so a scheduled run can't
+// overlap a previous one that took longer than the interval, the run started by a
+// configuration update or one requested by the hub. Returns whether they ran.
+func (s *schedulerStatus) run(checks func()) bool {
+	if !s.start() {
+		return false
+	}
+	defer s.finish()
+	checks()
+	return true
+}
+
+// runScheduled runs the checks of a cron tick like run, recording the run only if the checks
+// start. With jitter the checks of each target wait for their phase, see phase, over the first
+// half of the time until the next tick, so they finish before it.
+func (s *schedulerStatus) runScheduled(checks func()) bool {
+	return s.run(func() {
+		s.ran()
+		s.mu.Lock()
+		if s.jitterSeed != "" && s.schedule != nil {
+			s.phaseStart = time.Now()
+			s.phaseSpan = s.schedule.Next(s.phaseStart).Sub(s.phaseStart) / 2
+		}
+		s.mu.Unlock()
+		defer func() {
+			s.mu.Lock()
+			s.phaseStart, s.phaseSpan = time.Time{}, 0
+			s.mu.Unlock()
+		}()
+		checks()
+	})
+}
+
+// phase returns when the checks of a target start in the current run, zero if they start at
+// once. The offset from the start of the run is a hash of the agent and the target, so each
+// target keeps its place in the interval while agents checking the same target with the same
+// schedule don't all check it in the same second. Its results are that much later than the
+// schedule says, up to half the interval, which makes the time of a check less predictable.
+func (s *schedulerStatus) phase(target string) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.phaseStart.IsZero() || s.phaseSpan <= 0 {
+		return time.Time{}
+	}
+	h := fnv.New64a()
+	h.Write([]byte(s.jitterSeed))
+	h.Write([]byte{0})
+	h.Write([]byte(target))
+	// a fraction of the span, so the offset barely moves with the few milliseconds the span varies by
+	fraction := float64(h.Sum64()) / math.MaxUint64
+	return s.phaseStart.Add(time.Duration(fraction * float64(s.phaseSpan)))
+}
+
+// waitPhase waits until the phase of a target, returning false if ctx is done first
+func (s *schedulerStatus) waitPhase(ctx context.Context, target string) bool {
+	wait := time.Until(s.phase(target))
+	if wait <= 0 {
+		return true
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// report returns the status as sent to the hub
+func (s *schedulerStatus) report(service string) system.SchedulerStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := system.SchedulerStatus{Service: service, Active: s.active, LastError: s.lastErr}
+	if s.missing != "" {
+		status.Unavailable = s.missing + " not installed"
+	}
+	if !s.lastRun.IsZero() {
+		status.LastRun = s.lastRun.Unix()
+	}
+	return status
+}
+
+// cronParser parses the cron expressions of the managers' jobs, with a leading seconds
+// field if seconds is set so checks can run more often than once a minute
+func cronParser(seconds bool) cron.Parser {
+	if seconds {
+		return cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+	}
+	return cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+}
@@ -0,0 +1,184 @@
+package agent
+
+import (
+	"beszel/internal/common"
+	"beszel/internal/entities/system"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedulerStatus(t *testing.T) {
+	dm, err := NewDnsManager()
+	require.NoError(t, err)
+	defer dm.Close()
+
+	// no cron expression, nothing scheduled
+	assert.Equal(t, system.SchedulerStatus{Service: common.ServiceDns}, dm.scheduler.report(common.ServiceDns))
+
+	dm.UpdateConfig(nil, "*/5 * * * *")
+	assert.Equal(t, system.SchedulerStatus{Service: common.ServiceDns, Active: true}, dm.scheduler.report(common.ServiceDns))
+
+	dm.scheduler.ran()
+	assert.NotZero(t, dm.scheduler.report(common.ServiceDns).LastRun)
+
+	// an invalid expression leaves the job unscheduled with the error
+	dm.UpdateConfig(nil, "bogus")
+	status := dm.scheduler.report(common.ServiceDns)
+	assert.False(t, status.Active)
+	assert.NotEmpty(t, status.LastError)
+	assert.NotZero(t, status.LastRun)
+
+	dm.UpdateConfig(nil, "*/5 * * * *")
+	assert.Empty(t, dm.scheduler.report(common.ServiceDns).LastError)
+}
+
+func TestAgentSchedulerStatuses(t *testing.T) {
+	a := &Agent{}
+	assert.Empty(t, a.schedulerStatuses())
+
+	pm, err := NewPingManager()
+	require.NoError(t, err)
+	defer pm.Close()
+	pm.UpdateConfig(nil, "* * * * *")
+	a.pingManager = pm
+	assert.Equal(t, []system.SchedulerStatus{{Service: common.ServicePing, Active: true}}, a.schedulerStatuses())
+}
+
+func TestSchedulerStatusRun(t *testing.T) {
+	var s schedulerStatus
+	started, release := make(chan struct{}), make(chan struct{})
+	done := make(chan bool)
+	go func() {
+		done <- s.run(func() {
+			close(started)
+			<-release
+		})
+	}()
+	<-started
+	assert.True(t, s.isRunning())
+
+	// a run while the checks are running is skipped
+	assert.False(t, s.run(func() { t.Error("overlapping run") }))
+	close(release)
+	assert.True(t, <-done)
+	assert.False(t, s.isRunning())
+
+	ran := false
+	assert.True(t, s.run(func() { ran = true }))
+	assert.True(t, ran)
+	// runs that aren't scheduled don't count as runs of the job
+	assert.Zero(t, s.report(common.ServiceDns).LastRun)
+}
+
+func TestSchedulerStatusRunScheduledRecordsStartedRuns(t *testing.T) {
+	var s schedulerStatus
+	started, release := make(chan struct{}), make(chan struct{})
+	done := make(chan bool)
+	go func() {
+		done <- s.run(func() {
+			close(started)
+			<-release
+		})
+	}()
+	<-started
+
+	// a skipped tick isn't recorded as a run
+	assert.False(t, s.runScheduled(func() { t.Error("overlapping run") }))
+	assert.Zero(t, s.report(common.ServiceDns).LastRun)
+	close(release)
+	<-done
+
+	assert.True(t, s.runScheduled(func() {
+		assert.NotZero(t, s.report(common.ServiceDns).LastRun, "the run is recorded when the checks start")
+	}))
+}
+
+func TestCronSeconds(t *testing.T) {
+	dm, err := NewDnsManager()
+	require.NoError(t, err)
+	defer dm.Close()
+
+	// 6-field expressions need the seconds field enabled
+	dm.UpdateConfig(nil, "*/10 * * * * *")
+	assert.NotEmpty(t, dm.scheduler.report(common.ServiceDns).LastError)
+
+	dm.SetCronSeconds(true)
+	dm.UpdateConfig(nil, "*/10 * * * * *")
+	status := dm.scheduler.report(common.ServiceDns)
+	assert.True(t, status.Active)
+	assert.Empty(t, status.LastError)
+	entries := dm.cronScheduler.Entries()
+	require.Len(t, entries, 1)
+	assert.Equal(t, 10*time.Second, entries[0].Schedule.Next(time.Date(2025, 1, 1, 0, 0, 10, 0, time.UTC)).Sub(time.Date(2025, 1, 1, 0, 0, 10, 0, time.UTC)))
+
+	// 5-field expressions don't parse with it
+	dm.UpdateConfig(nil, "*/5 * * * *")
+	assert.NotEmpty(t, dm.scheduler.report(common.ServiceDns).LastError)
+}
+
+func TestConfigValidator_CronSeconds(t *testing.T) {
+	cv := NewConfigValidator(10, time.Hour, nil)
+
+	config := &system.MonitoringConfig{}
+	config.Ping.Interval = "*/10 * * * * *"
+	assert.ErrorContains(t, cv.ValidateConfig(config), "invalid ping interval")
+	config.CronSeconds = true
+	assert.NoError(t, cv.ValidateConfig(config))
+	config.Dns.Interval = "*/5 * * * *"
+	assert.ErrorContains(t, cv.ValidateConfig(config), "invalid DNS interval")
+	config.Dns.Interval = ""
+
+	// speedtests run at most once a minute, also through the global interval
+	config.Enabled.Speedtest = true
+	config.Speedtest.Targets = []system.SpeedtestTarget{{ServerID: "1"}}
+	config.GlobalInterval = "*/10 * * * * *"
+	assert.ErrorContains(t, cv.ValidateConfig(config), "speedtest interval runs more than once a minute")
+	config.Speedtest.Interval = "0,30 * * * * *"
+	assert.ErrorContains(t, cv.ValidateConfig(config), "speedtest interval runs more than once a minute")
+	config.Speedtest.Interval = "30 */5 * * * *"
+	assert.NoError(t, cv.ValidateConfig(config))
+}
+
+func TestSchedulerStatusPhase(t *testing.T) {
+	var s schedulerStatus
+	s.scheduled(cron.ConstantDelaySchedule{Delay: time.Minute}, nil)
+	offset := func(target string) time.Duration {
+		return s.phase(target).Sub(s.phaseStart)
+	}
+
+	// without jitter the targets of scheduled runs start at once
+	s.runScheduled(func() { assert.Zero(t, s.phase("192.0.2.1")) })
+
+	s.setJitter("agent-a")
+	var offsetA time.Duration
+	s.runScheduled(func() {
+		offsetA = offset("192.0.2.1")
+		// offsets are fixed per target and within the first half of the interval
+		for _, target := range []string{"192.0.2.1", "192.0.2.2", "example.com"} {
+			assert.GreaterOrEqual(t, offset(target), time.Duration(0))
+			assert.Less(t, offset(target), 30*time.Second)
+		}
+		assert.NotEqual(t, offsetA, offset("192.0.2.2"))
+
+		// waiting stops with the context
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.Equal(t, offset("example.com") == 0, s.waitPhase(ctx, "example.com"))
+	})
+	s.runScheduled(func() { assert.InDelta(t, offsetA, offset("192.0.2.1"), float64(time.Second)) })
+
+	// other agents check the target at another offset
+	s.setJitter("agent-b")
+	s.runScheduled(func() { assert.NotEqual(t, offsetA, offset("192.0.2.1")) })
+
+	// runs outside the schedule aren't delayed
+	s.run(func() {
+		assert.Zero(t, s.phase("192.0.2.1"))
+		assert.True(t, s.waitPhase(context.Background(), "192.0.2.1"))
+	})
+}
@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"beszel"
+	"beszel/internal/common"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/lxzan/gws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelfUpdateFromHub(t *testing.T) {
+	const authKey = "base64:dGVzdC1hdXRoLWtleQ=="
+	hub := &mockHub{authKey: authKey, connected: make(chan *gws.Conn, 1), messages: make(chan []byte, 10)}
+	upgrader := gws.NewUpgrader(hub, &gws.ServerOption{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conn, err := upgrader.Upgrade(w, r); err == nil {
+			go conn.ReadLoop()
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv("BESZEL_AGENT_HUB_URL", server.URL)
+	t.Setenv("BESZEL_AGENT_TOKEN", "test-token")
+	agent, err := NewAgent(t.TempDir())
+	require.NoError(t, err)
+	agent.authKey = authKey
+	agent.connectionManager.eventChan = make(chan ConnectionEvent, 1)
+	client, err := newWebSocketClient(agent)
+	require.NoError(t, err)
+	require.NoError(t, client.Connect())
+	t.Cleanup(client.Close)
+	<-agent.connectionManager.eventChan
+	conn := <-hub.connected
+
+	// the update itself and the restart are replaced
+	originalUpdate, originalRestart := selfUpdate, restartAgent
+	t.Cleanup(func() { selfUpdate, restartAgent = originalUpdate, originalRestart })
+	var updateResult string
+	var updateErr error
+	restarted := make(chan struct{}, 1)
+	release := make(chan struct{})
+	selfUpdate = func(version string) (string, error) {
+		<-release
+		return updateResult, updateErr
+	}
+	restartAgent = func() error {
+		restarted <- struct{}{}
+		return nil
+	}
+
+	requestUpdate := func(version string) {
+		data, err := cbor.Marshal(common.HubRequest[common.SelfUpdateRequest]{
+			Action: common.SelfUpdate,
+			Data:   common.SelfUpdateRequest{Version: version},
+		})
+		require.NoError(t, err)
+		require.NoError(t, conn.WriteMessage(gws.OpcodeBinary, data))
+	}
+	nextStatus := func() common.UpdateStatus {
+		select {
+		case data := <-hub.messages:
+			var tag cbor.RawTag
+			require.NoError(t, cbor.Unmarshal(data, &tag))
+			var msg common.AgentMessage[common.UpdateStatus]
+			require.NoError(t, cbor.Unmarshal(tag.Content, &msg))
+			require.Equal(t, common.ReportUpdate, msg.Action)
+			return msg.Data
+		case <-time.After(5 * time.Second):
+			t.Fatal("no update status received")
+			return common.UpdateStatus{}
+		}
+	}
+
+	// a successful update is reported before the agent restarts
+	updateResult = "1.2.3"
+	requestUpdate("1.2.3")
+	assert.Equal(t, common.UpdateStatus{Status: common.UpdateRunning, Version: "1.2.3"}, nextStatus())
+	// only one update runs at a time
+	requestUpdate("1.2.4")
+	assert.Equal(t, common.UpdateStatus{Status: common.UpdateFailed, Version: "1.2.4", Error: "an update is already running"}, nextStatus())
+	release <- struct{}{}
+	assert.Equal(t, common.UpdateStatus{Status: common.UpdateSucceeded, Version: "1.2.3"}, nextStatus())
+	select {
+	case <-restarted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("agent did not restart")
+	}
+
+	// failures and rollbacks are reported with their reason, without a restart
+	updateResult, updateErr = "", errors.New("new binary failed to run, restored the previous version: exit status 1")
+	requestUpdate("")
+	assert.Equal(t, common.UpdateRunning, nextStatus().Status)
+	release <- struct{}{}
+	assert.Equal(t, common.UpdateStatus{Status: common.UpdateFailed, Error: updateErr.Error()}, nextStatus())
+
+	// as is an agent that already runs the latest version
+	updateErr = nil
+	requestUpdate("")
+	assert.Equal(t, common.UpdateRunning, nextStatus().Status)
+	release <- struct{}{}
+	assert.Equal(t, common.UpdateStatus{Status: common.UpdateCurrent, Version: beszel.Version}, nextStatus())
+	assert.Empty(t, restarted)
+}
@@ -0,0 +1,62 @@
+package agent
+
+import "slices"
+
+// sampleSmoother keeps the last samples of each target to report a median
+// alongside the raw value, so a single noisy sample doesn't trip alerts.
+// It is not safe for concurrent use, callers hold their manager's lock.
+type sampleSmoother struct {
+	size    int                  // Number of samples the median is taken over
+	samples map[string][]float64 // Recent samples per target, oldest first
+}
+
+// newSampleSmoother returns a smoother over the last size samples, or nil if
+// size is too small for smoothing to have an effect.
+func newSampleSmoother(size int) *sampleSmoother {
+	if size <= 1 {
+		return nil
+	}
+	return &sampleSmoother{size: size, samples: make(map[string][]float64)}
+}
+
+// add records a sample for the key and returns the median of its recent samples
+func (s *sampleSmoother) add(key string, value float64) float64 {
+	samples := append(s.samples[key], value)
+	if len(samples) > s.size {
+		samples = samples[len(samples)-s.size:]
+	}
+	s.samples[key] = samples
+	return median(samples)
+}
+
+// prune drops the samples of keys that are no longer monitored
+func (s *sampleSmoother) prune(keep func(key string) bool) {
+	for key := range s.samples {
+		if !keep(key) {
+			delete(s.samples, key)
+		}
+	}
+}
+
+// median returns the median of the values without modifying them
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// updateSmoother returns the smoother to use for the configured window,
+// keeping the current one and its samples if the window didn't change.
+func updateSmoother(current *sampleSmoother, size int) *sampleSmoother {
+	if current != nil && current.size == size {
+		return current
+	}
+	return newSampleSmoother(size)
+}
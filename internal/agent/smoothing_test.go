@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"beszel/internal/entities/system"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMedian(t *testing.T) {
+	assert.Equal(t, 0.0, median(nil))
+	assert.Equal(t, 5.0, median([]float64{5}))
+	assert.Equal(t, 3.0, median([]float64{9, 1, 3}))
+	assert.Equal(t, 2.5, median([]float64{4, 1, 2, 3}))
+
+	values := []float64{3, 1, 2}
+	median(values)
+	assert.Equal(t, []float64{3, 1, 2}, values, "median should not reorder the samples")
+}
+
+func TestSampleSmoother(t *testing.T) {
+	assert.Nil(t, newSampleSmoother(0), "0 disables smoothing")
+	assert.Nil(t, newSampleSmoother(1), "a single sample is the raw value")
+
+	smoother := newSampleSmoother(3)
+	require.NotNil(t, smoother)
+
+	assert.Equal(t, 10.0, smoother.add("a", 10))
+	assert.Equal(t, 15.0, smoother.add("a", 20))
+	// a single spike doesn't move the median far
+	assert.Equal(t, 20.0, smoother.add("a", 500))
+	// only the last 3 samples count: 20, 500, 12
+	assert.Equal(t, 20.0, smoother.add("a", 12))
+	// 500, 12, 11
+	assert.Equal(t, 12.0, smoother.add("a", 11))
+
+	// targets are smoothed independently
+	assert.Equal(t, 100.0, smoother.add("b", 100))
+
+	smoother.prune(func(key string) bool { return key == "b" })
+	assert.NotContains(t, smoother.samples, "a")
+	assert.Contains(t, smoother.samples, "b")
+
+	assert.Same(t, smoother, updateSmoother(smoother, 3), "same window keeps the samples")
+	assert.NotSame(t, smoother, updateSmoother(smoother, 5))
+	assert.Nil(t, updateSmoother(smoother, 0))
+}
+
+func TestPingManager_Smoothing(t *testing.T) {
+	pm, err := NewPingManager()
+	require.NoError(t, err)
+	defer pm.Close()
+
+	pm.SetSmoothing(5)
+	samples := []float64{12, 14, 250, 11, 13, 15}
+	var smoothed float64
+	for _, rtt := range samples {
+		pm.updateResult("1.1.1.1", &system.PingResult{Host: "1.1.1.1", AvgRtt: rtt})
+		results := pm.GetResults()
+		require.Contains(t, results, "1.1.1.1")
+		assert.Equal(t, rtt, results["1.1.1.1"].AvgRtt, "raw value should be reported unchanged")
+		smoothed = results["1.1.1.1"].SmoothedAvgRtt
+	}
+	// median of the last 5 samples: 14, 250, 11, 13, 15
+	assert.Equal(t, median(samples[1:]), smoothed)
+	assert.Equal(t, 14.0, smoothed)
+
+	pm.SetSmoothing(0)
+	pm.updateResult("1.1.1.1", &system.PingResult{Host: "1.1.1.1", AvgRtt: 20})
+	assert.Zero(t, pm.GetResults()["1.1.1.1"].SmoothedAvgRtt)
+}
@@ -0,0 +1,545 @@
+package agent
+
+import (
+	"beszel/internal/entities/system"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/robfig/cron/v3"
+)
+
+type SnmpManager struct {
+	sync.RWMutex
+	targets        map[string]*snmpTarget
+	results        map[string]*system.SnmpResult
+	ctx            context.Context
+	cancel         context.CancelFunc
+	cronScheduler  *cron.Cron
+	cronExpression string          // Cron expression for SNMP polling
+	cronSeconds    bool            // Whether the cron expression has a leading seconds field
+	buffer         resultBuffer    // Bounds results waiting for the hub
+	netns          *netns          // Network namespace devices are polled from, nil for the host namespace
+	scheduler      schedulerStatus // Health of the cron job, reported in heartbeats
+}
+
+type snmpTarget struct {
+	system.SnmpTarget
+	oids     []snmpOID             // OIDs to poll, the configured ones followed by the interface counters
+	previous map[string]snmpSample // Latest sample of each counter by OID, for its rate
+	lastPoll time.Time
+}
+
+// snmpOID is an OID to poll and the name its value is reported with
+type snmpOID struct {
+	oid  string
+	name string
+}
+
+// snmpSample is a counter value and when it was polled
+type snmpSample struct {
+	value uint64
+	at    time.Time
+}
+
+// Defaults of SNMP targets
+const (
+	defaultSnmpPort      = 161
+	defaultSnmpVersion   = "2c"
+	defaultSnmpCommunity = "public"
+	defaultSnmpTimeout   = 5 * time.Second // Wait for the reply
+)
+
+// snmpInterfaceCounters are the IF-MIB 64-bit counters polled for each configured interface,
+// the interface index is appended to the OIDs
+var snmpInterfaceCounters = []snmpOID{
+	{oid: "1.3.6.1.2.1.31.1.1.1.6", name: "in_octets"},    // ifHCInOctets
+	{oid: "1.3.6.1.2.1.31.1.1.1.10", name: "out_octets"},  // ifHCOutOctets
+	{oid: "1.3.6.1.2.1.31.1.1.1.7", name: "in_packets"},   // ifHCInUcastPkts
+	{oid: "1.3.6.1.2.1.31.1.1.1.11", name: "out_packets"}, // ifHCOutUcastPkts
+}
+
+// snmpInterfaceCounters32 are the IF-MIB 32-bit counters polled instead for SNMPv1 targets,
+// which can't return 64-bit counters
+var snmpInterfaceCounters32 = []snmpOID{
+	{oid: "1.3.6.1.2.1.2.2.1.10", name: "in_octets"},   // ifInOctets
+	{oid: "1.3.6.1.2.1.2.2.1.16", name: "out_octets"},  // ifOutOctets
+	{oid: "1.3.6.1.2.1.2.2.1.11", name: "in_packets"},  // ifInUcastPkts
+	{oid: "1.3.6.1.2.1.2.2.1.17", name: "out_packets"}, // ifOutUcastPkts
+}
+
+var snmpVersions = map[string]gosnmp.SnmpVersion{
+	"1":  gosnmp.Version1,
+	"2c": gosnmp.Version2c,
+	"3":  gosnmp.Version3,
+}
+
+var snmpAuthProtocols = map[string]gosnmp.SnmpV3AuthProtocol{
+	"MD5":    gosnmp.MD5,
+	"SHA":    gosnmp.SHA,
+	"SHA224": gosnmp.SHA224,
+	"SHA256": gosnmp.SHA256,
+	"SHA384": gosnmp.SHA384,
+	"SHA512": gosnmp.SHA512,
+}
+
+var snmpPrivProtocols = map[string]gosnmp.SnmpV3PrivProtocol{
+	"DES":     gosnmp.DES,
+	"AES":     gosnmp.AES,
+	"AES192":  gosnmp.AES192,
+	"AES256":  gosnmp.AES256,
+	"AES192C": gosnmp.AES192C,
+	"AES256C": gosnmp.AES256C,
+}
+
+// snmpOIDRegex matches a numeric OID, with or without a leading dot
+var snmpOIDRegex = regexp.MustCompile(`^\.?\d+(\.\d+)+$`)
+
+// NewSnmpManager creates a new SNMP manager
+func NewSnmpManager() (*SnmpManager, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sm := &SnmpManager{
+		targets:        make(map[string]*snmpTarget),
+		results:        make(map[string]*system.SnmpResult),
+		buffer:         newResultBuffer(),
+		ctx:            ctx,
+		cancel:         cancel,
+		cronScheduler:  cron.New(cron.WithParser(cronParser(false))),
+		cronExpression: "", // Will be set by hub configuration (5-field format: minute hour day month weekday)
+	}
+
+	slog.Debug("SNMP manager initialized")
+
+	// Start the cron scheduler
+	sm.cronScheduler.Start()
+
+	// Schedule the SNMP job
+	sm.scheduleSnmpJob()
+
+	return sm, nil
+}
+
+// UpdateConfig updates the SNMP configuration with targets and cron expression
+func (sm *SnmpManager) UpdateConfig(targets []system.SnmpTarget, cronExpression string) {
+	sm.Lock()
+	defer sm.Unlock()
+
+	slog.Debug("UpdateConfig called", "old_targets", len(sm.targets), "new_targets", len(targets), "cron_expression", cronExpression)
+
+	sm.cronExpression = cronExpression
+
+	// Replace the targets, results are pruned below once the new targets are known
+	previousTargets := sm.targets
+	sm.targets = make(map[string]*snmpTarget)
+
+	for _, target := range targets {
+		if err := snmpTargetError(target); err != nil {
+			slog.Warn("Ignoring invalid SNMP target", "host", target.Host, "err", err)
+			continue
+		}
+		if target.Port <= 0 {
+			target.Port = defaultSnmpPort
+		}
+		if target.Version == "" {
+			target.Version = defaultSnmpVersion
+		}
+		if target.Community == "" {
+			target.Community = defaultSnmpCommunity
+		}
+		if target.Timeout <= 0 {
+			target.Timeout = defaultSnmpTimeout
+		}
+
+		// counters keep their previous sample, so the first poll after an update has rates
+		previous := make(map[string]snmpSample)
+		if old := previousTargets[target.Host]; old != nil {
+			previous = old.previous
+		}
+		sm.targets[target.Host] = &snmpTarget{
+			SnmpTarget: target,
+			oids:       snmpTargetOIDs(target),
+			previous:   previous,
+			lastPoll:   time.Time{}, // Not checked yet, the run started below checks it
+		}
+	}
+
+	if dropped := pruneResults(&sm.buffer, sm.results, func(host string) bool { return sm.targets[host] != nil }); dropped > 0 {
+		slog.Info("Dropped results of removed SNMP targets", "results", dropped)
+	}
+
+	// Reschedule the SNMP job with new cron expression
+	sm.scheduleSnmpJob()
+
+	// run the checks right away instead of waiting for the first scheduled run, unless neither the
+	// targets nor the schedule changed
+	if sm.scheduler.changed(targets, cronExpression) && len(sm.targets) > 0 && sm.cronExpression != "" {
+		go sm.scheduler.run(sm.checkSnmpTargets)
+	}
+
+	slog.Debug("Updated SNMP config", "targets", len(sm.targets), "cron_expression", cronExpression)
+}
+
+// snmpTargetError returns why an SNMP target can't be polled, nil if it can
+func snmpTargetError(target system.SnmpTarget) error {
+	if target.Host == "" {
+		return errors.New("missing host")
+	}
+	if target.Port < 0 || target.Port > math.MaxUint16 {
+		return fmt.Errorf("invalid port %d", target.Port)
+	}
+	version := target.Version
+	if version == "" {
+		version = defaultSnmpVersion
+	}
+	if _, ok := snmpVersions[version]; !ok {
+		return fmt.Errorf("unknown version %q (must be 1, 2c or 3)", target.Version)
+	}
+	if version == "3" {
+		if target.Username == "" {
+			return errors.New("missing v3 username")
+		}
+		if target.AuthProtocol == "" && target.PrivProtocol != "" {
+			return errors.New("v3 privacy requires an auth protocol")
+		}
+		if _, ok := snmpAuthProtocols[strings.ToUpper(target.AuthProtocol)]; target.AuthProtocol != "" && !ok {
+			return fmt.Errorf("unknown v3 auth protocol %q", target.AuthProtocol)
+		}
+		if _, ok := snmpPrivProtocols[strings.ToUpper(target.PrivProtocol)]; target.PrivProtocol != "" && !ok {
+			return fmt.Errorf("unknown v3 privacy protocol %q", target.PrivProtocol)
+		}
+	}
+	if len(target.OIDs) == 0 && len(target.Interfaces) == 0 {
+		return errors.New("no OIDs or interfaces to poll")
+	}
+	for _, oid := range target.OIDs {
+		if !snmpOIDRegex.MatchString(oid) {
+			return fmt.Errorf("invalid OID %q (must be numeric)", oid)
+		}
+	}
+	for _, index := range target.Interfaces {
+		if index <= 0 {
+			return fmt.Errorf("invalid interface index %d", index)
+		}
+	}
+	return nil
+}
+
+// snmpTargetOIDs returns the OIDs to poll for a target, the configured ones followed by the
+// counters of its interfaces
+func snmpTargetOIDs(target system.SnmpTarget) []snmpOID {
+	counters := snmpInterfaceCounters
+	if target.Version == "1" {
+		counters = snmpInterfaceCounters32
+	}
+	oids := make([]snmpOID, 0, len(target.OIDs)+len(target.Interfaces)*len(counters))
+	for _, oid := range target.OIDs {
+		oids = append(oids, snmpOID{oid: strings.TrimPrefix(oid, ".")})
+	}
+	for _, index := range target.Interfaces {
+		for _, counter := range counters {
+			oids = append(oids, snmpOID{
+				oid:  counter.oid + "." + strconv.Itoa(index),
+				name: "if" + strconv.Itoa(index) + "_" + counter.name,
+			})
+		}
+	}
+	return oids
+}
+
+// setNetns sets the network namespace devices are polled from, nil uses the host namespace
+func (sm *SnmpManager) setNetns(ns *netns) {
+	sm.Lock()
+	defer sm.Unlock()
+	sm.netns = ns
+}
+
+// SetCronSeconds sets whether cron expressions have a leading seconds field, used from the next UpdateConfig
+func (sm *SnmpManager) SetCronSeconds(seconds bool) {
+	sm.Lock()
+	defer sm.Unlock()
+	sm.cronSeconds = seconds
+}
+
+// SetJitter sets the seed of the phase offsets spreading the targets of scheduled runs, empty runs them all at once
+func (sm *SnmpManager) SetJitter(seed string) {
+	sm.scheduler.setJitter(seed)
+}
+
+// SetResultBufferSize sets how many uncollected results are kept before the oldest are dropped
+func (sm *SnmpManager) SetResultBufferSize(size int) {
+	sm.Lock()
+	defer sm.Unlock()
+	sm.buffer.setSize(size)
+}
+
+// DroppedResults returns the number of SNMP results dropped because the hub didn't collect them in time
+func (sm *SnmpManager) DroppedResults() uint64 {
+	sm.RLock()
+	defer sm.RUnlock()
+	return sm.buffer.dropped
+}
+
+// GetResults returns the current SNMP results and clears them after retrieval
+// Returns nil if no results are available (no devices were polled recently)
+func (sm *SnmpManager) GetResults() map[string]*system.SnmpResult {
+	sm.Lock()
+	defer sm.Unlock()
+
+	if len(sm.results) == 0 {
+		return nil
+	}
+
+	// Create a copy to avoid race conditions
+	results := make(map[string]*system.SnmpResult)
+	for host, result := range sm.results {
+		values := make([]system.SnmpValue, len(result.Values))
+		for i, value := range result.Values {
+			values[i] = value
+			if value.Rate != nil {
+				rate := *value.Rate
+				values[i].Rate = &rate
+			}
+		}
+		results[host] = &system.SnmpResult{
+			Host:        result.Host,
+			Status:      result.Status,
+			Values:      values,
+			ErrorCode:   result.ErrorCode,
+			LastChecked: result.LastChecked,
+			PollTime:    result.PollTime,
+		}
+	}
+
+	// Clear the results after they've been retrieved
+	// This ensures SNMP data is only sent once per poll
+	sm.results = make(map[string]*system.SnmpResult)
+
+	return results
+}
+
+// Close shuts down the SNMP manager
+func (sm *SnmpManager) Close() {
+	sm.cronScheduler.Stop()
+	sm.cancel()
+}
+
+// scheduleSnmpJob schedules the SNMP job with the current cron expression
+func (sm *SnmpManager) scheduleSnmpJob() {
+	// Remove all existing jobs
+	sm.cronScheduler.Stop()
+	sm.cronScheduler = cron.New(cron.WithParser(cronParser(sm.cronSeconds)))
+	sm.cronScheduler.Start()
+
+	// Only schedule if we have a valid cron expression
+	if sm.cronExpression != "" {
+		id, err := sm.cronScheduler.AddFunc(sm.cronExpression, func() {
+			slog.Debug("Polling SNMP targets")
+			if !sm.scheduler.runScheduled(sm.checkSnmpTargets) {
+				slog.Warn("Skipping scheduled SNMP polls, the previous run is still going", "cron_expression", sm.cronExpression)
+			}
+		})
+		if err != nil {
+			slog.Error("Failed to schedule SNMP job", "cron_expression", sm.cronExpression, "error", err)
+		} else {
+			slog.Debug("Scheduled SNMP job")
+		}
+		sm.scheduler.scheduled(sm.cronScheduler.Entry(id).Schedule, err)
+	} else {
+		slog.Debug("No cron expression set, SNMP job not scheduled")
+		sm.scheduler.scheduled(nil, nil)
+	}
+}
+
+// checkSnmpTargets polls all targets
+func (sm *SnmpManager) checkSnmpTargets() {
+	sm.RLock()
+	targets := make([]*snmpTarget, 0, len(sm.targets))
+	for _, target := range sm.targets {
+		targets = append(targets, target)
+	}
+	sm.RUnlock()
+
+	// Poll targets concurrently
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		wg.Add(1)
+		go func(t *snmpTarget) {
+			defer wg.Done()
+			if !sm.scheduler.waitPhase(sm.ctx, t.Host) {
+				return
+			}
+			sm.pollTarget(t)
+		}(target)
+	}
+	wg.Wait()
+}
+
+// pollTarget gets the values of a target's OIDs and the rates of its counters
+func (sm *SnmpManager) pollTarget(target *snmpTarget) {
+	sm.Lock()
+	target.lastPoll = time.Now()
+	ns := sm.netns
+	sm.Unlock()
+
+	result := &system.SnmpResult{
+		Host:        target.Host,
+		LastChecked: time.Now(),
+	}
+
+	client := newSnmpClient(target.SnmpTarget)
+	client.Context = sm.ctx
+	start := time.Now()
+	// the socket belongs to the namespace it was opened in
+	if err := ns.run(client.Connect); err != nil {
+		result.Status = "error"
+		result.ErrorCode = "connect_failed: " + err.Error()
+		sm.updateResult(target.Host, result)
+		return
+	}
+	defer client.Close()
+
+	variables := make(map[string]gosnmp.SnmpPDU, len(target.oids))
+	for chunk := range slices.Chunk(target.oids, gosnmp.MaxOids) {
+		oids := make([]string, len(chunk))
+		for i, oid := range chunk {
+			oids[i] = oid.oid
+		}
+		packet, err := client.Get(oids)
+		if err == nil && packet.Error != gosnmp.NoError {
+			err = fmt.Errorf("%s at index %d", packet.Error, packet.ErrorIndex)
+		}
+		if err != nil {
+			result.Status = "error"
+			result.ErrorCode = "request_failed: " + err.Error()
+			sm.updateResult(target.Host, result)
+			return
+		}
+		for _, variable := range packet.Variables {
+			variables[strings.TrimPrefix(variable.Name, ".")] = variable
+		}
+	}
+	result.PollTime = float64(time.Since(start).Microseconds()) / 1000
+
+	var missing []string
+	sm.Lock()
+	for _, oid := range target.oids {
+		value, ok := snmpValue(oid, variables[oid.oid])
+		if !ok {
+			missing = append(missing, oid.oid)
+			continue
+		}
+		if strings.HasPrefix(value.Type, "counter") {
+			previous, polled := target.previous[oid.oid]
+			if rate, ok := snmpRate(value.Type, previous, value.Value, result.LastChecked); polled && ok {
+				value.Rate = &rate
+			}
+			target.previous[oid.oid] = snmpSample{value: value.Value, at: result.LastChecked}
+		}
+		result.Values = append(result.Values, value)
+	}
+	sm.Unlock()
+
+	switch {
+	case len(missing) == 0:
+		result.Status = "success"
+	case len(result.Values) > 0:
+		result.Status = "partial"
+		result.ErrorCode = "no_value: " + strings.Join(missing, ", ")
+	default:
+		result.Status = "error"
+		result.ErrorCode = "no_value: " + strings.Join(missing, ", ")
+	}
+	sm.updateResult(target.Host, result)
+}
+
+// newSnmpClient returns a client for a validated target with its defaults applied
+func newSnmpClient(target system.SnmpTarget) *gosnmp.GoSNMP {
+	client := &gosnmp.GoSNMP{
+		Target:    target.Host,
+		Port:      uint16(target.Port),
+		Transport: "udp",
+		Community: target.Community,
+		Version:   snmpVersions[target.Version],
+		Timeout:   target.Timeout,
+		Retries:   1,
+		MaxOids:   gosnmp.MaxOids,
+	}
+	if client.Version != gosnmp.Version3 {
+		return client
+	}
+
+	params := &gosnmp.UsmSecurityParameters{UserName: target.Username}
+	client.SecurityModel = gosnmp.UserSecurityModel
+	client.MsgFlags = gosnmp.NoAuthNoPriv
+	if target.AuthProtocol != "" {
+		client.MsgFlags = gosnmp.AuthNoPriv
+		params.AuthenticationProtocol = snmpAuthProtocols[strings.ToUpper(target.AuthProtocol)]
+		params.AuthenticationPassphrase = target.AuthPassword
+	}
+	if target.PrivProtocol != "" {
+		client.MsgFlags = gosnmp.AuthPriv
+		params.PrivacyProtocol = snmpPrivProtocols[strings.ToUpper(target.PrivProtocol)]
+		params.PrivacyPassphrase = target.PrivPassword
+	}
+	client.SecurityParameters = params
+	return client
+}
+
+// snmpValue converts the value of a polled OID, false if the device has no numeric value for it
+func snmpValue(oid snmpOID, variable gosnmp.SnmpPDU) (system.SnmpValue, bool) {
+	value := system.SnmpValue{OID: oid.oid, Name: oid.name}
+	switch variable.Type {
+	case gosnmp.Counter32:
+		value.Type = "counter32"
+	case gosnmp.Counter64:
+		value.Type = "counter64"
+	case gosnmp.Gauge32, gosnmp.Uinteger32:
+		value.Type = "gauge32"
+	case gosnmp.Integer:
+		value.Type = "integer"
+	case gosnmp.TimeTicks:
+		value.Type = "timeticks"
+	default:
+		// no such object or instance, or a value that isn't a number
+		return value, false
+	}
+	number := gosnmp.ToBigInt(variable.Value)
+	if number.Sign() < 0 || !number.IsUint64() {
+		return value, false
+	}
+	value.Value = number.Uint64()
+	return value, true
+}
+
+// snmpRate returns the change per second of a counter since its previous sample. 32-bit
+// counters may have wrapped once, a 64-bit counter going back was reset and has no rate.
+func snmpRate(counterType string, previous snmpSample, value uint64, at time.Time) (float64, bool) {
+	elapsed := at.Sub(previous.at).Seconds()
+	if elapsed <= 0 {
+		return 0, false
+	}
+	delta := value - previous.value
+	if value < previous.value {
+		if counterType != "counter32" || previous.value > math.MaxUint32 {
+			return 0, false
+		}
+		delta = value + math.MaxUint32 + 1 - previous.value
+	}
+	return float64(delta) / elapsed, true
+}
+
+func (sm *SnmpManager) updateResult(host string, result *system.SnmpResult) {
+	sm.Lock()
+	defer sm.Unlock()
+	bufferResult(&sm.buffer, sm.results, host, result, func(r *system.SnmpResult) time.Time { return r.LastChecked })
+}
@@ -0,0 +1,214 @@
+package agent
+
+import (
+	"beszel/internal/entities/system"
+	"math"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startFakeSnmpAgent answers SNMP v2c get requests on a local UDP port. The in octets counter
+// of interface 2 grows by 1000 with each request, OIDs it doesn't know have no such object.
+func startFakeSnmpAgent(t *testing.T) int {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	var requests atomic.Uint64
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			request, err := (&gosnmp.GoSNMP{Version: gosnmp.Version2c}).SnmpDecodePacket(buf[:n])
+			if err != nil {
+				continue
+			}
+			count := requests.Add(1)
+			response := &gosnmp.SnmpPacket{
+				Version:   gosnmp.Version2c,
+				Community: request.Community,
+				PDUType:   gosnmp.GetResponse,
+				RequestID: request.RequestID,
+			}
+			for _, variable := range request.Variables {
+				pdu := gosnmp.SnmpPDU{Name: variable.Name, Type: gosnmp.NoSuchObject}
+				switch strings.TrimPrefix(variable.Name, ".") {
+				case "1.3.6.1.2.1.31.1.1.1.6.2":
+					pdu.Type, pdu.Value = gosnmp.Counter64, count*1000
+				case "1.3.6.1.2.1.31.1.1.1.10.2":
+					pdu.Type, pdu.Value = gosnmp.Counter64, uint64(500)
+				case "1.3.6.1.2.1.1.3.0":
+					pdu.Type, pdu.Value = gosnmp.TimeTicks, uint32(4200)
+				case "1.3.6.1.4.1.2021.10.1.5.1":
+					pdu.Type, pdu.Value = gosnmp.Integer, 42
+				}
+				response.Variables = append(response.Variables, pdu)
+			}
+			out, err := response.MarshalMsg()
+			if err != nil {
+				continue
+			}
+			conn.WriteTo(out, addr)
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestSnmpManager_Poll(t *testing.T) {
+	port := startFakeSnmpAgent(t)
+
+	sm, err := NewSnmpManager()
+	require.NoError(t, err)
+	defer sm.Close()
+
+	sm.UpdateConfig([]system.SnmpTarget{{
+		Host:       "127.0.0.1",
+		Port:       port,
+		Timeout:    1 * time.Second,
+		OIDs:       []string{".1.3.6.1.2.1.1.3.0", "1.3.6.1.4.1.2021.10.1.5.1"},
+		Interfaces: []int{2},
+	}}, "")
+	target := sm.targets["127.0.0.1"]
+	require.NotNil(t, target)
+	assert.Equal(t, "2c", target.Version)
+	assert.Equal(t, "public", target.Community)
+
+	sm.pollTarget(target)
+	results := sm.GetResults()
+	require.Contains(t, results, "127.0.0.1")
+	result := results["127.0.0.1"]
+
+	// the packet counters of the interface are unknown to the fake agent
+	assert.Equal(t, "partial", result.Status)
+	assert.Equal(t, "no_value: 1.3.6.1.2.1.31.1.1.1.7.2, 1.3.6.1.2.1.31.1.1.1.11.2", result.ErrorCode)
+	assert.Positive(t, result.PollTime)
+	assert.Equal(t, []system.SnmpValue{
+		{OID: "1.3.6.1.2.1.1.3.0", Type: "timeticks", Value: 4200},
+		{OID: "1.3.6.1.4.1.2021.10.1.5.1", Type: "integer", Value: 42},
+		{OID: "1.3.6.1.2.1.31.1.1.1.6.2", Name: "if2_in_octets", Type: "counter64", Value: 1000},
+		{OID: "1.3.6.1.2.1.31.1.1.1.10.2", Name: "if2_out_octets", Type: "counter64", Value: 500},
+	}, result.Values)
+
+	// pretend the first poll was 10 seconds ago, counters have rates from the second poll on
+	sm.Lock()
+	for oid, sample := range target.previous {
+		sample.at = sample.at.Add(-10 * time.Second)
+		target.previous[oid] = sample
+	}
+	sm.Unlock()
+
+	sm.pollTarget(target)
+	result = sm.GetResults()["127.0.0.1"]
+	require.NotNil(t, result)
+	require.Len(t, result.Values, 4)
+	assert.Nil(t, result.Values[0].Rate, "timeticks aren't counters")
+	require.NotNil(t, result.Values[2].Rate)
+	assert.InDelta(t, 100, *result.Values[2].Rate, 1)
+	require.NotNil(t, result.Values[3].Rate)
+	assert.Zero(t, *result.Values[3].Rate)
+
+	// the samples outlive a configuration update
+	sm.UpdateConfig([]system.SnmpTarget{{Host: "127.0.0.1", Port: port, Interfaces: []int{2}}}, "")
+	assert.Len(t, sm.targets["127.0.0.1"].previous, 2)
+}
+
+func TestSnmpManager_PollUnreachable(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	sm, err := NewSnmpManager()
+	require.NoError(t, err)
+	defer sm.Close()
+
+	// nothing answers on the port
+	sm.UpdateConfig([]system.SnmpTarget{{Host: "127.0.0.1", Port: conn.LocalAddr().(*net.UDPAddr).Port, Timeout: 1 * time.Second, Interfaces: []int{1}}}, "")
+	sm.pollTarget(sm.targets["127.0.0.1"])
+
+	result := sm.GetResults()["127.0.0.1"]
+	require.NotNil(t, result)
+	assert.Equal(t, "error", result.Status)
+	assert.True(t, strings.HasPrefix(result.ErrorCode, "request_failed: "), result.ErrorCode)
+	assert.Empty(t, result.Values)
+}
+
+func TestSnmpRate(t *testing.T) {
+	now := time.Now()
+	previous := snmpSample{value: 1000, at: now.Add(-10 * time.Second)}
+
+	rate, ok := snmpRate("counter64", previous, 3000, now)
+	assert.True(t, ok)
+	assert.Equal(t, 200.0, rate)
+
+	// a 64-bit counter going back was reset
+	_, ok = snmpRate("counter64", previous, 10, now)
+	assert.False(t, ok)
+
+	// a 32-bit counter going back wrapped
+	rate, ok = snmpRate("counter32", snmpSample{value: math.MaxUint32 - 9, at: previous.at}, 10, now)
+	assert.True(t, ok)
+	assert.Equal(t, 2.0, rate)
+
+	_, ok = snmpRate("counter64", snmpSample{value: 1000, at: now}, 2000, now)
+	assert.False(t, ok)
+}
+
+func TestSnmpTargetOIDs(t *testing.T) {
+	oids := snmpTargetOIDs(system.SnmpTarget{Host: "192.0.2.1", Version: "2c", OIDs: []string{".1.3.6.1.2.1.1.3.0"}, Interfaces: []int{2}})
+	assert.Equal(t, []snmpOID{
+		{oid: "1.3.6.1.2.1.1.3.0"},
+		{oid: "1.3.6.1.2.1.31.1.1.1.6.2", name: "if2_in_octets"},
+		{oid: "1.3.6.1.2.1.31.1.1.1.10.2", name: "if2_out_octets"},
+		{oid: "1.3.6.1.2.1.31.1.1.1.7.2", name: "if2_in_packets"},
+		{oid: "1.3.6.1.2.1.31.1.1.1.11.2", name: "if2_out_packets"},
+	}, oids)
+
+	// SNMPv1 has no 64-bit counters
+	oids = snmpTargetOIDs(system.SnmpTarget{Host: "192.0.2.1", Version: "1", Interfaces: []int{2}})
+	assert.Equal(t, []snmpOID{
+		{oid: "1.3.6.1.2.1.2.2.1.10.2", name: "if2_in_octets"},
+		{oid: "1.3.6.1.2.1.2.2.1.16.2", name: "if2_out_octets"},
+		{oid: "1.3.6.1.2.1.2.2.1.11.2", name: "if2_in_packets"},
+		{oid: "1.3.6.1.2.1.2.2.1.17.2", name: "if2_out_packets"},
+	}, oids)
+}
+
+func TestSnmpTargetError(t *testing.T) {
+	tests := []struct {
+		name   string
+		target system.SnmpTarget
+		err    string
+	}{
+		{"valid", system.SnmpTarget{Host: "192.0.2.1", Interfaces: []int{1}}, ""},
+		{"valid v3", system.SnmpTarget{Host: "192.0.2.1", Version: "3", Username: "monitor", AuthProtocol: "sha256", PrivProtocol: "AES", OIDs: []string{"1.3.6.1.2.1.1.3.0"}}, ""},
+		{"no host", system.SnmpTarget{Interfaces: []int{1}}, "missing host"},
+		{"nothing to poll", system.SnmpTarget{Host: "192.0.2.1"}, "no OIDs or interfaces to poll"},
+		{"version", system.SnmpTarget{Host: "192.0.2.1", Version: "2", Interfaces: []int{1}}, `unknown version "2" (must be 1, 2c or 3)`},
+		{"port", system.SnmpTarget{Host: "192.0.2.1", Port: 70000, Interfaces: []int{1}}, "invalid port 70000"},
+		{"named OID", system.SnmpTarget{Host: "192.0.2.1", OIDs: []string{"sysUpTime.0"}}, `invalid OID "sysUpTime.0" (must be numeric)`},
+		{"interface", system.SnmpTarget{Host: "192.0.2.1", Interfaces: []int{0}}, "invalid interface index 0"},
+		{"v3 user", system.SnmpTarget{Host: "192.0.2.1", Version: "3", Interfaces: []int{1}}, "missing v3 username"},
+		{"v3 privacy without auth", system.SnmpTarget{Host: "192.0.2.1", Version: "3", Username: "monitor", PrivProtocol: "AES", Interfaces: []int{1}}, "v3 privacy requires an auth protocol"},
+		{"v3 auth", system.SnmpTarget{Host: "192.0.2.1", Version: "3", Username: "monitor", AuthProtocol: "SHA1", Interfaces: []int{1}}, `unknown v3 auth protocol "SHA1"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := snmpTargetError(tt.target)
+			if tt.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.err)
+			}
+		})
+	}
+}
@@ -2,11 +2,14 @@ package agent
 
 import (
 	"beszel/internal/entities/system"
+	"cmp"
 	"context"
 	"encoding/json"
 	"fmt"
 	"log/slog"
 	"os/exec"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
@@ -17,17 +20,67 @@ type SpeedtestManager struct {
 	sync.RWMutex
 	targets         map[string]*speedtestTarget
 	results         map[string]*system.SpeedtestResult
+	resultTargets   map[string]string // Key of the target each result is from, results of auto-selected servers are stored under the server ID
 	lastResultsTime time.Time
 	ctx             context.Context
 	cancel          context.CancelFunc
 	cronScheduler   *cron.Cron
 	cronExpression  string
+	cronSeconds     bool            // Whether the cron expression has a leading seconds field
+	buffer          resultBuffer    // Bounds results waiting for the hub
+	netns           *netns          // Network namespace speedtests run in, nil for the host namespace
+	usage           *speedtestUsage // Bytes each target transferred this month, for their budgets
+	scheduler       schedulerStatus // Health of the cron job, reported in heartbeats
+	cliMissing      bool            // Whether the Ookla speedtest CLI wasn't found at startup
 }
 
 type speedtestTarget struct {
-	ServerID  string
-	Timeout   time.Duration
-	lastCheck time.Time
+	key        string // Identifies the target, results without a server ID are reported under it
+	ServerID   string // Empty lets the Ookla CLI pick a server
+	ServerHost string // Ookla server host, used if there's no server ID
+	Timeout    time.Duration
+	MinSpeed   float64 // Plausibility bounds in Mbps, 0 disables a bound
+	MaxSpeed   float64
+	Provider   string // One of the speedtestProviders, never empty
+	URL        string // Endpoint of providers that don't use a fixed one
+	Retries    int    // Times a failed speedtest is retried
+	Budget     int64  // Bytes the target may transfer per calendar month, 0 is unlimited
+	lastCheck  time.Time
+
+	// Plausibility bounds of a single direction in Mbps, 0 uses MinSpeed and MaxSpeed
+	MinDownload, MaxDownload float64
+	MinUpload, MaxUpload     float64
+}
+
+// defaultSpeedtestRetries is how often a failed speedtest is retried if the target doesn't say
+const defaultSpeedtestRetries = 1
+
+// maxSpeedtestRetries caps the retries of a failed speedtest, each one waits twice as long as the one before
+const maxSpeedtestRetries = 5
+
+// speedtestRetryDelay is the wait before the first retry of a failed speedtest, doubling for each further retry
+var speedtestRetryDelay = 10 * time.Second
+
+// Speedtest providers, each measuring speeds in its own way
+const (
+	speedtestProviderOokla      = "ookla"
+	speedtestProviderCloudflare = "cloudflare"
+	speedtestProviderLibrespeed = "librespeed"
+	speedtestProviderHTTP       = "http"
+)
+
+// speedtestProvider measures the speeds of a target. ns is the network namespace
+// to run in, nil for the host namespace.
+type speedtestProvider interface {
+	run(ctx context.Context, target *speedtestTarget, ns *netns) (*system.SpeedtestResult, error)
+}
+
+// speedtestProviders maps provider names to their implementation
+var speedtestProviders = map[string]speedtestProvider{
+	speedtestProviderOokla:      ooklaSpeedtest{},
+	speedtestProviderCloudflare: cloudflareSpeedtest,
+	speedtestProviderLibrespeed: librespeedSpeedtest,
+	speedtestProviderHTTP:       httpFileSpeedtest,
 }
 
 // NewSpeedtestManager creates a new speedtest manager
@@ -37,12 +90,20 @@ func NewSpeedtestManager() (*SpeedtestManager, error) {
 	sm := &SpeedtestManager{
 		targets:        make(map[string]*speedtestTarget),
 		results:        make(map[string]*system.SpeedtestResult),
+		resultTargets:  make(map[string]string),
+		buffer:         newResultBuffer(),
+		usage:          loadSpeedtestUsage(""),
 		ctx:            ctx,
 		cancel:         cancel,
-		cronScheduler:  cron.New(cron.WithParser(cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow))),
+		cronScheduler:  cron.New(cron.WithParser(cronParser(false))),
 		cronExpression: "",
 	}
 
+	if !installed("speedtest") {
+		sm.cliMissing = true
+		slog.Debug("Ookla speedtest CLI not installed, only other providers can run")
+	}
+
 	slog.Debug("Speedtest manager initialized")
 
 	// Start the cron scheduler
@@ -59,21 +120,13 @@ func (sm *SpeedtestManager) UpdateConfig(targets []system.SpeedtestTarget, cronE
 	sm.Lock()
 	defer sm.Unlock()
 
-	oldTargetsCount := len(sm.targets)
-	oldResultsCount := len(sm.results)
-	
-	slog.Debug("UpdateConfig called", "old_targets", oldTargetsCount, "new_targets", len(targets), "cron_expression", cronExpression)
+	slog.Debug("UpdateConfig called", "old_targets", len(sm.targets), "new_targets", len(targets), "cron_expression", cronExpression)
 
 	// Use cron expression directly
 	sm.cronExpression = cronExpression
 
-	// Clear existing targets and results to prevent stale data
+	// Replace the targets, results are pruned below once the new targets are known
 	sm.targets = make(map[string]*speedtestTarget)
-	sm.results = make(map[string]*system.SpeedtestResult)
-	
-	if oldTargetsCount > 0 || oldResultsCount > 0 {
-		slog.Info("Cleared old speedtest configuration", "old_targets", oldTargetsCount, "old_results", oldResultsCount)
-	}
 
 	// Add new targets
 	for _, target := range targets {
@@ -81,20 +134,129 @@ func (sm *SpeedtestManager) UpdateConfig(targets []system.SpeedtestTarget, cronE
 		if timeout <= 0 {
 			timeout = 60 * time.Second // Default 60 seconds for speedtest
 		}
+		provider := strings.ToLower(target.Provider)
+		if provider == "" {
+			provider = speedtestProviderOokla
+		}
+		if _, ok := speedtestProviders[provider]; !ok {
+			slog.Warn("Ignoring speedtest target with unknown provider", "server_id", target.ServerID, "provider", target.Provider)
+			continue
+		}
+		if target.URL == "" && (provider == speedtestProviderLibrespeed || provider == speedtestProviderHTTP) {
+			slog.Warn("Ignoring speedtest target without URL", "server_id", target.ServerID, "provider", provider)
+			continue
+		}
+		key := speedtestTargetKey(target, provider)
+		retries := defaultSpeedtestRetries
+		if target.Retries != nil {
+			retries = min(max(*target.Retries, 0), maxSpeedtestRetries)
+		}
 
-		sm.targets[target.ServerID] = &speedtestTarget{
-			ServerID:  target.ServerID,
-			Timeout:   time.Duration(timeout) * time.Second,
-			lastCheck: time.Time{}, // Will trigger immediate check
+		sm.targets[key] = &speedtestTarget{
+			key:        key,
+			ServerID:   target.ServerID,
+			ServerHost: target.ServerHost,
+			Timeout:    timeout,
+			MinSpeed:   target.MinSpeed,
+			MaxSpeed:   target.MaxSpeed,
+			Provider:   provider,
+			URL:        target.URL,
+			Retries:    retries,
+			Budget:     target.MonthlyByteBudget,
+			lastCheck:  time.Time{}, // Not checked yet, the next scheduled run checks it
+
+			MinDownload: target.MinDownload,
+			MaxDownload: target.MaxDownload,
+			MinUpload:   target.MinUpload,
+			MaxUpload:   target.MaxUpload,
+		}
+	}
+
+	// results of auto-selected servers are stored under the server ID, not the target key
+	dropped := pruneResults(&sm.buffer, sm.results, func(key string) bool { return sm.targets[cmp.Or(sm.resultTargets[key], key)] != nil })
+	if dropped > 0 {
+		slog.Info("Dropped results of removed speedtest targets", "results", dropped)
+	}
+	for key := range sm.resultTargets {
+		if sm.results[key] == nil {
+			delete(sm.resultTargets, key)
+		}
+	}
+
+	sm.scheduler.setMissing("")
+	if sm.cliMissing {
+		for _, target := range sm.targets {
+			if target.Provider == speedtestProviderOokla {
+				slog.Warn("Ookla speedtest CLI not installed, speedtests using it won't run")
+				sm.scheduler.setMissing("speedtest")
+				break
+			}
 		}
 	}
 
 	// Reschedule the speedtest job with new cron expression
 	sm.scheduleSpeedtestJob()
 
+	// speedtests wait for their schedule, a configuration update or restart running them would
+	// use up data on metered links. The hub can request a run.
 	slog.Debug("Updated speedtest config", "targets", len(targets))
 }
 
+// speedtestTargetKey returns a key telling targets apart, made of the server and URL a target tests
+// against. Targets with only a server ID keep it as their key, those without any use the provider.
+func speedtestTargetKey(target system.SpeedtestTarget, provider string) string {
+	var parts []string
+	for _, part := range []string{target.ServerID, target.ServerHost, target.URL} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return provider
+	}
+	return strings.Join(parts, "|")
+}
+
+// SetCronSeconds sets whether cron expressions have a leading seconds field, used from the next UpdateConfig
+func (sm *SpeedtestManager) SetCronSeconds(seconds bool) {
+	sm.Lock()
+	defer sm.Unlock()
+	sm.cronSeconds = seconds
+}
+
+// SetJitter sets the seed of the phase offsets spreading the targets of scheduled runs, empty runs them all at once
+func (sm *SpeedtestManager) SetJitter(seed string) {
+	sm.scheduler.setJitter(seed)
+}
+
+// SetResultBufferSize sets how many uncollected results are kept before the oldest are dropped
+func (sm *SpeedtestManager) SetResultBufferSize(size int) {
+	sm.Lock()
+	defer sm.Unlock()
+	sm.buffer.setSize(size)
+}
+
+// SetDataDir sets the directory the monthly data usage of targets is persisted in, empty keeps it in memory
+func (sm *SpeedtestManager) SetDataDir(dataDir string) {
+	sm.Lock()
+	defer sm.Unlock()
+	sm.usage = loadSpeedtestUsage(dataDir)
+}
+
+// setNetns sets the network namespace speedtests run in, nil uses the host namespace
+func (sm *SpeedtestManager) setNetns(ns *netns) {
+	sm.Lock()
+	defer sm.Unlock()
+	sm.netns = ns
+}
+
+// DroppedResults returns the number of speedtest results dropped because the hub didn't collect them in time
+func (sm *SpeedtestManager) DroppedResults() uint64 {
+	sm.RLock()
+	defer sm.RUnlock()
+	return sm.buffer.dropped
+}
+
 // GetResults returns the current speedtest results
 func (sm *SpeedtestManager) GetResults() map[string]*system.SpeedtestResult {
 	sm.Lock()
@@ -144,6 +306,8 @@ func (sm *SpeedtestManager) GetResults() map[string]*system.SpeedtestResult {
 			ServerIP:              result.ServerIP,
 		}
 	}
+	// results are kept until the next run replaces them, which doesn't drop them anymore
+	markCollected(&sm.buffer, sm.results)
 
 	return results
 }
@@ -152,22 +316,26 @@ func (sm *SpeedtestManager) GetResults() map[string]*system.SpeedtestResult {
 func (sm *SpeedtestManager) scheduleSpeedtestJob() {
 	// Remove all existing jobs by creating a new scheduler
 	sm.cronScheduler.Stop()
-	sm.cronScheduler = cron.New(cron.WithParser(cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow))) // 5-field format
+	sm.cronScheduler = cron.New(cron.WithParser(cronParser(sm.cronSeconds)))
 	sm.cronScheduler.Start()
 
 	// Only schedule if we have a valid cron expression
 	if sm.cronExpression != "" {
-		_, err := sm.cronScheduler.AddFunc(sm.cronExpression, func() {
+		id, err := sm.cronScheduler.AddFunc(sm.cronExpression, func() {
 			slog.Debug("Running speedtest checks")
-			sm.performSpeedtestChecks()
+			if !sm.scheduler.runScheduled(sm.performSpeedtestChecks) {
+				slog.Warn("Skipping scheduled speedtest checks, the previous run is still going", "cron_expression", sm.cronExpression)
+			}
 		})
 		if err != nil {
 			slog.Error("Failed to schedule speedtest job", "cron_expression", sm.cronExpression, "error", err)
 		} else {
 			slog.Debug("Speedtest job scheduled", "expression", sm.cronExpression)
 		}
+		sm.scheduler.scheduled(sm.cronScheduler.Entry(id).Schedule, err)
 	} else {
 		slog.Debug("No cron expression set, speedtest job not scheduled")
+		sm.scheduler.scheduled(nil, nil)
 	}
 }
 
@@ -182,17 +350,39 @@ func (sm *SpeedtestManager) performSpeedtestChecks() {
 	
 	slog.Debug("Performing speedtest checks", "targets", len(targets))
 
-	// Check targets sequentially (one after another)
+	// Check targets sequentially (one after another), in the order of their phases
+	slices.SortFunc(targets, func(a, b *speedtestTarget) int {
+		return sm.scheduler.phase(a.key).Compare(sm.scheduler.phase(b.key))
+	})
 	for _, target := range targets {
-		result := sm.performSpeedtestCheck(target)
+		if !sm.scheduler.waitPhase(sm.ctx, target.key) {
+			return
+		}
+		var result *system.SpeedtestResult
+		if used, exhausted := sm.budgetExhausted(target); exhausted {
+			slog.Debug("Skipping speedtest, monthly budget exhausted", "target", target.key, "used", used, "budget", target.Budget)
+			result = &system.SpeedtestResult{
+				ServerURL:   target.key,
+				Status:      "skipped_budget",
+				ErrorCode:   fmt.Sprintf("budget_exhausted: %d of %d bytes used this month", used, target.Budget),
+				LastChecked: time.Now(),
+			}
+		} else {
+			result = sm.performSpeedtestCheck(target)
+			target.checkPlausibility(result)
+		}
 
 		sm.Lock()
-		sm.results[target.ServerID] = result
+		sm.usage.add(target.key, result.DownloadBytes+result.UploadBytes, time.Now())
+		// auto-selected servers report their ID, which results are stored under
+		key := cmp.Or(result.ServerURL, target.key)
+		bufferResult(&sm.buffer, sm.results, key, result, func(r *system.SpeedtestResult) time.Time { return r.LastChecked })
+		sm.resultTargets[key] = target.key
 		sm.lastResultsTime = time.Now()
 		sm.Unlock()
 
 		slog.Debug("Speedtest check completed",
-			"server_id", target.ServerID,
+			"target", target.key,
 			"status", result.Status,
 			"download_speed", result.DownloadSpeed,
 			"upload_speed", result.UploadSpeed,
@@ -200,6 +390,14 @@ func (sm *SpeedtestManager) performSpeedtestChecks() {
 	}
 }
 
+// budgetExhausted reports whether the target used up its monthly budget, and the bytes it used
+func (sm *SpeedtestManager) budgetExhausted(target *speedtestTarget) (used int64, exhausted bool) {
+	sm.Lock()
+	defer sm.Unlock()
+	used = sm.usage.used(target.key, time.Now())
+	return used, target.Budget > 0 && used >= target.Budget
+}
+
 // SpeedtestCLIResult represents the JSON output from speedtest CLI
 type SpeedtestCLIResult struct {
 	Type      string `json:"type"`
@@ -257,48 +455,84 @@ type SpeedtestCLIResult struct {
 	} `json:"result"`
 }
 
-// performSpeedtestCheck performs a single speedtest check
+// performSpeedtestCheck performs a single speedtest check with the target's provider,
+// retrying failures so transient network errors don't end up in the averages
 func (sm *SpeedtestManager) performSpeedtestCheck(target *speedtestTarget) *system.SpeedtestResult {
-	// Build speedtest command
-	args := []string{"-f", "json", "--accept-gdpr", "--accept-license"}
-	if target.ServerID != "" {
-		args = append(args, "--server-id", target.ServerID)
+	provider, ok := speedtestProviders[target.Provider]
+	if !ok {
+		provider = ooklaSpeedtest{}
 	}
 
-	cmd := exec.Command("speedtest", args...)
-
-	// Set timeout for the command
-	ctx, cancel := context.WithTimeout(context.Background(), target.Timeout)
-	defer cancel()
-	cmd = exec.CommandContext(ctx, cmd.Path, cmd.Args[1:]...)
+	sm.RLock()
+	ns := sm.netns
+	cliMissing := sm.cliMissing
+	sm.RUnlock()
 
-	// Execute speedtest
-	output, err := cmd.CombinedOutput()
+	// retrying won't install the CLI
+	if _, ookla := provider.(ooklaSpeedtest); ookla && cliMissing {
+		return &system.SpeedtestResult{
+			ServerURL:   target.key,
+			Status:      "error",
+			ErrorCode:   "speedtest_not_installed: the Ookla speedtest CLI isn't in the PATH",
+			LastChecked: time.Now(),
+		}
+	}
 
-	if err != nil {
+	for attempt := 0; ; attempt++ {
+		result, err := runSpeedtest(provider, target, ns)
+		if err == nil {
+			return result
+		}
+		if attempt < target.Retries {
+			delay := speedtestRetryDelay << attempt
+			slog.Warn("Speedtest failed, retrying", "target", target.key, "attempt", attempt+1, "delay", delay, "err", err)
+			select {
+			case <-time.After(delay):
+				continue
+			case <-sm.ctx.Done():
+			}
+		}
 		return &system.SpeedtestResult{
-			ServerURL:     target.ServerID,
+			ServerURL:     target.key,
 			Status:        "error",
 			DownloadSpeed: 0,
 			UploadSpeed:   0,
 			Latency:       0,
-			ErrorCode:     fmt.Sprintf("speedtest_failed: %v", err),
+			ErrorCode:     err.Error(),
 			LastChecked:   time.Now(),
 		}
 	}
+}
+
+// runSpeedtest runs a single attempt of a speedtest, limited to the target's timeout
+func runSpeedtest(provider speedtestProvider, target *speedtestTarget, ns *netns) (*system.SpeedtestResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), target.Timeout)
+	defer cancel()
+	return provider.run(ctx, target, ns)
+}
+
+// ooklaSpeedtest runs the Ookla speedtest CLI
+type ooklaSpeedtest struct{}
+
+func (ooklaSpeedtest) run(ctx context.Context, target *speedtestTarget, ns *netns) (*system.SpeedtestResult, error) {
+	// Build speedtest command
+	args := []string{"-f", "json", "--accept-gdpr", "--accept-license"}
+	if target.ServerID != "" {
+		args = append(args, "--server-id", target.ServerID)
+	} else if target.ServerHost != "" {
+		args = append(args, "--host", target.ServerHost)
+	}
+
+	// Execute speedtest
+	output, err := ns.combinedOutput(exec.CommandContext(ctx, "speedtest", args...))
+	if err != nil {
+		return nil, fmt.Errorf("speedtest_failed: %w", err)
+	}
 
 	// Parse JSON output
 	var cliResult SpeedtestCLIResult
 	if err := json.Unmarshal(output, &cliResult); err != nil {
-		return &system.SpeedtestResult{
-			ServerURL:     target.ServerID,
-			Status:        "error",
-			DownloadSpeed: 0,
-			UploadSpeed:   0,
-			Latency:       0,
-			ErrorCode:     fmt.Sprintf("json_parse_error: %v", err),
-			LastChecked:   time.Now(),
-		}
+		return nil, fmt.Errorf("json_parse_error: %w", err)
 	}
 
 	// Convert bandwidth from bytes per second to Mbps
@@ -337,6 +571,38 @@ func (sm *SpeedtestManager) performSpeedtestCheck(target *speedtestTarget) *syst
 		ServerCountry:         cliResult.Server.Country,
 		ServerHost:            cliResult.Server.Host,
 		ServerIP:              cliResult.Server.IP,
+	}, nil
+}
+
+// checkPlausibility marks a successful result as implausible if a speed is outside the target's bounds,
+// which happens when the CLI glitches and would otherwise skew averages and alerts. The bounds of a
+// direction take precedence over those of both.
+func (target *speedtestTarget) checkPlausibility(result *system.SpeedtestResult) {
+	if result.Status != "success" {
+		return
+	}
+	for _, speed := range []struct {
+		name     string
+		value    float64
+		min, max float64
+	}{
+		{"download", result.DownloadSpeed, cmp.Or(target.MinDownload, target.MinSpeed), cmp.Or(target.MaxDownload, target.MaxSpeed)},
+		{"upload", result.UploadSpeed, cmp.Or(target.MinUpload, target.MinSpeed), cmp.Or(target.MaxUpload, target.MaxSpeed)},
+	} {
+		// the http provider only downloads
+		if speed.name == "upload" && target.Provider == speedtestProviderHTTP {
+			continue
+		}
+		if speed.min > 0 && speed.value < speed.min {
+			result.Status = "implausible"
+			result.ErrorCode = fmt.Sprintf("%s_below_min: %.2f Mbps", speed.name, speed.value)
+			return
+		}
+		if speed.max > 0 && speed.value > speed.max {
+			result.Status = "implausible"
+			result.ErrorCode = fmt.Sprintf("%s_above_max: %.2f Mbps", speed.name, speed.value)
+			return
+		}
 	}
 }
 
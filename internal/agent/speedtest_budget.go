@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// speedtestUsageFile is the file in the data directory keeping the bytes speedtests used this month
+const speedtestUsageFile = "speedtest_usage.json"
+
+// speedtestUsage counts the bytes each speedtest target transferred in the current calendar month
+type speedtestUsage struct {
+	Month string           `json:"month"` // Month the counts are for, like "2025-01"
+	Bytes map[string]int64 `json:"bytes"` // Bytes transferred by target key
+	path  string           // File the usage is persisted in, empty keeps it in memory only
+}
+
+// loadSpeedtestUsage reads the usage persisted in the data directory, starting over if there is none.
+// An empty dataDir keeps the usage in memory only.
+func loadSpeedtestUsage(dataDir string) *speedtestUsage {
+	usage := &speedtestUsage{Bytes: make(map[string]int64)}
+	if dataDir == "" {
+		return usage
+	}
+	usage.path = filepath.Join(dataDir, speedtestUsageFile)
+
+	data, err := os.ReadFile(usage.path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("Failed to read speedtest usage", "path", usage.path, "err", err)
+		}
+		return usage
+	}
+	if err := json.Unmarshal(data, usage); err != nil {
+		slog.Warn("Ignoring invalid speedtest usage", "path", usage.path, "err", err)
+	}
+	if usage.Bytes == nil {
+		usage.Bytes = make(map[string]int64)
+	}
+	return usage
+}
+
+// used returns the bytes the target transferred in the month of now
+func (u *speedtestUsage) used(key string, now time.Time) int64 {
+	u.resetIfNewMonth(now)
+	return u.Bytes[key]
+}
+
+// add counts n more bytes for the target in the month of now and persists the usage
+func (u *speedtestUsage) add(key string, n int64, now time.Time) {
+	if n <= 0 {
+		return
+	}
+	u.resetIfNewMonth(now)
+	u.Bytes[key] += n
+	if u.path == "" {
+		return
+	}
+	data, err := json.Marshal(u)
+	if err == nil {
+		err = os.WriteFile(u.path, data, 0644)
+	}
+	if err != nil {
+		slog.Warn("Failed to save speedtest usage", "path", u.path, "err", err)
+	}
+}
+
+// resetIfNewMonth clears the counts when now is in a later month than they are for
+func (u *speedtestUsage) resetIfNewMonth(now time.Time) {
+	if month := now.Format("2006-01"); u.Month != month {
+		u.Month = month
+		clear(u.Bytes)
+	}
+}
@@ -0,0 +1,179 @@
+package agent
+
+import (
+	"beszel/internal/entities/system"
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	speedtestDownloadBytes  = 25_000_000 // Size of the download of HTTP based speedtests
+	speedtestUploadBytes    = 10_000_000 // Size of the upload of HTTP based speedtests
+	speedtestLatencySamples = 5          // Requests the latency of HTTP based speedtests is the median of
+)
+
+// defaultCloudflareSpeedtestURL is the endpoint of the cloudflare provider if the target has no URL
+const defaultCloudflareSpeedtestURL = "https://speed.cloudflare.com"
+
+// httpSpeedtest measures speeds by timing plain HTTP transfers, which needs no CLI
+type httpSpeedtest struct {
+	name string // Reported as the server name, empty uses the download host
+	// endpoints returns the URLs of the target's latency, download and upload tests, an empty URL skips its test
+	endpoints func(target *speedtestTarget) (latencyURL, downloadURL, uploadURL string)
+}
+
+// cloudflareSpeedtest uses the endpoints behind speed.cloudflare.com
+var cloudflareSpeedtest = &httpSpeedtest{
+	name: "Cloudflare",
+	endpoints: func(target *speedtestTarget) (string, string, string) {
+		base := strings.TrimSuffix(cmp.Or(target.URL, defaultCloudflareSpeedtestURL), "/")
+		return base + "/__down?bytes=0", fmt.Sprintf("%s/__down?bytes=%d", base, speedtestDownloadBytes), base + "/__up"
+	},
+}
+
+// librespeedSpeedtest uses the backend of a librespeed server at the target's URL
+var librespeedSpeedtest = &httpSpeedtest{
+	endpoints: func(target *speedtestTarget) (string, string, string) {
+		base := strings.TrimSuffix(target.URL, "/")
+		// garbage.php sends chunks of 1 MiB
+		chunks := int(math.Ceil(speedtestDownloadBytes / float64(1<<20)))
+		return base + "/empty.php", fmt.Sprintf("%s/garbage.php?ckSize=%d", base, chunks), base + "/empty.php"
+	},
+}
+
+// httpFileSpeedtest downloads the file at the target's URL, measuring the download speed only
+var httpFileSpeedtest = &httpSpeedtest{
+	endpoints: func(target *speedtestTarget) (string, string, string) {
+		return "", target.URL, ""
+	},
+}
+
+func (p *httpSpeedtest) run(ctx context.Context, target *speedtestTarget, ns *netns) (*system.SpeedtestResult, error) {
+	latencyURL, downloadURL, uploadURL := p.endpoints(target)
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = ns.dialContext(&net.Dialer{Timeout: 10 * time.Second})
+	// compressed transfers would count fewer bytes than were sent
+	transport.DisableCompression = true
+	client := &http.Client{Transport: transport}
+	defer client.CloseIdleConnections()
+
+	result := &system.SpeedtestResult{
+		ServerURL:  target.key,
+		Status:     "success",
+		ServerName: p.name,
+	}
+	if u, err := url.Parse(downloadURL); err == nil {
+		result.ServerHost = u.Host
+		result.ServerName = cmp.Or(result.ServerName, u.Hostname())
+	}
+
+	if latencyURL != "" {
+		samples, err := speedtestLatency(ctx, client, latencyURL)
+		if err != nil {
+			return nil, fmt.Errorf("latency_failed: %w", err)
+		}
+		result.Latency = median(samples)
+		result.PingLow = slices.Min(samples)
+		result.PingHigh = slices.Max(samples)
+		result.PingJitter = speedtestJitter(samples)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, downloadURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("download_failed: %w", err)
+	}
+	downloaded, elapsed, err := speedtestTransfer(client, req)
+	if err != nil {
+		return nil, fmt.Errorf("download_failed: %w", err)
+	}
+	result.DownloadBytes = downloaded
+	result.DownloadElapsed = elapsed.Milliseconds()
+	result.DownloadSpeed = speedtestMbps(downloaded, elapsed)
+
+	if uploadURL != "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, uploadURL, bytes.NewReader(make([]byte, speedtestUploadBytes)))
+		if err != nil {
+			return nil, fmt.Errorf("upload_failed: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/octet-stream")
+		if _, elapsed, err = speedtestTransfer(client, req); err != nil {
+			return nil, fmt.Errorf("upload_failed: %w", err)
+		}
+		result.UploadBytes = speedtestUploadBytes
+		result.UploadElapsed = elapsed.Milliseconds()
+		result.UploadSpeed = speedtestMbps(speedtestUploadBytes, elapsed)
+	}
+
+	result.LastChecked = time.Now()
+	return result, nil
+}
+
+// speedtestLatency returns the round trip times of requests to url in milliseconds.
+// A first request sets up the connection, so the samples don't include the handshakes.
+func speedtestLatency(ctx context.Context, client *http.Client, url string) ([]float64, error) {
+	samples := make([]float64, 0, speedtestLatencySamples)
+	for i := 0; i <= speedtestLatencySamples; i++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		_, elapsed, err := speedtestTransfer(client, req)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			samples = append(samples, durationMs(elapsed))
+		}
+	}
+	return samples, nil
+}
+
+// speedtestTransfer sends req and reads the response body, returning its size
+// and the time from sending the request to the end of the body
+func speedtestTransfer(client *http.Client, req *http.Request) (int64, time.Duration, error) {
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return 0, 0, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	n, err := io.Copy(io.Discard, resp.Body)
+	if err != nil {
+		return 0, 0, err
+	}
+	return n, time.Since(start), nil
+}
+
+// speedtestMbps returns the speed of transferring n bytes in elapsed time in Mbps
+func speedtestMbps(n int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(n) * 8 / elapsed.Seconds() / 1000000
+}
+
+// speedtestJitter returns the mean difference between consecutive latency samples
+func speedtestJitter(samples []float64) float64 {
+	if len(samples) < 2 {
+		return 0
+	}
+	var sum float64
+	for i := 1; i < len(samples); i++ {
+		sum += math.Abs(samples[i] - samples[i-1])
+	}
+	return sum / float64(len(samples)-1)
+}
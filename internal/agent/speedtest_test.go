@@ -1,7 +1,18 @@
 package agent
 
 import (
+	"beszel/internal/common"
 	"beszel/internal/entities/system"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -50,14 +61,58 @@ func TestSpeedtestManager_UpdateConfig(t *testing.T) {
 	target1, exists := sm.targets["52365"]
 	assert.True(t, exists)
 	assert.Equal(t, "52365", target1.ServerID)
-	// Note: The speedtest manager has a bug in timeout conversion
-	// It does time.Duration(timeout) * time.Second which is incorrect
-	// We'll skip the timeout assertion for now
+	assert.Equal(t, 60*time.Second, target1.Timeout)
 
 	target2, exists := sm.targets["12345"]
 	assert.True(t, exists)
 	assert.Equal(t, "12345", target2.ServerID)
-	// We'll skip the timeout assertion for now due to the bug
+	assert.Equal(t, 30*time.Second, target2.Timeout)
+
+	// targets without a timeout use the default
+	sm.UpdateConfig([]system.SpeedtestTarget{{ServerID: "52365"}}, "")
+	assert.Equal(t, 60*time.Second, sm.targets["52365"].Timeout)
+}
+
+func TestSpeedtestManager_UpdateConfigWaitsForSchedule(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer server.Close()
+
+	sm, err := NewSpeedtestManager()
+	require.NoError(t, err)
+	defer sm.Stop()
+
+	// unlike the other checks, a configuration update doesn't run speedtests
+	sm.UpdateConfig([]system.SpeedtestTarget{{Provider: "http", URL: server.URL + "/file.bin"}}, "0 0 1 1 *")
+	time.Sleep(100 * time.Millisecond)
+	assert.Zero(t, requests.Load())
+	assert.Nil(t, sm.GetResults())
+}
+
+func TestSpeedtestManager_UpdateConfigKeepsResults(t *testing.T) {
+	sm, err := NewSpeedtestManager()
+	require.NoError(t, err)
+	defer sm.Stop()
+
+	sm.UpdateConfig([]system.SpeedtestTarget{{ServerID: "52365"}, {}, {ServerID: "12345"}}, "")
+	sm.results["52365"] = &system.SpeedtestResult{ServerURL: "52365", Status: "success", LastChecked: time.Now()}
+	sm.results["12345"] = &system.SpeedtestResult{ServerURL: "12345", Status: "success", LastChecked: time.Now()}
+	// the auto-selected server's result is stored under the ID of the server it picked
+	sm.results["99999"] = &system.SpeedtestResult{ServerURL: "99999", Status: "success", LastChecked: time.Now()}
+	sm.resultTargets["99999"] = speedtestProviderOokla
+
+	sm.UpdateConfig([]system.SpeedtestTarget{{ServerID: "52365"}, {}}, "")
+
+	results := sm.GetResults()
+	assert.Len(t, results, 2)
+	assert.Contains(t, results, "52365")
+	assert.Contains(t, results, "99999")
+
+	sm.UpdateConfig([]system.SpeedtestTarget{{ServerID: "52365"}}, "")
+	assert.NotContains(t, sm.GetResults(), "99999")
+	assert.Empty(t, sm.resultTargets)
 }
 
 func TestSpeedtestManager_GetResults(t *testing.T) {
@@ -306,3 +361,356 @@ func TestSpeedtestManager_DetailedMetrics(t *testing.T) {
 	assert.Equal(t, "speedtest.example.com", result.ServerHost)
 	assert.Equal(t, "203.0.113.1", result.ServerIP)
 }
+
+func TestSpeedtestTarget_CheckPlausibility(t *testing.T) {
+	target := &speedtestTarget{ServerID: "52365", MinSpeed: 1, MaxSpeed: 1000}
+
+	tests := []struct {
+		name      string
+		result    system.SpeedtestResult
+		status    string
+		errorCode string
+	}{
+		{"within bounds", system.SpeedtestResult{Status: "success", DownloadSpeed: 95.2, UploadSpeed: 20.1}, "success", ""},
+		{"download above max", system.SpeedtestResult{Status: "success", DownloadSpeed: 50000, UploadSpeed: 20.1}, "implausible", "download_above_max: 50000.00 Mbps"},
+		{"upload below min", system.SpeedtestResult{Status: "success", DownloadSpeed: 95.2, UploadSpeed: 0.2}, "implausible", "upload_below_min: 0.20 Mbps"},
+		{"failed result unchanged", system.SpeedtestResult{Status: "error", ErrorCode: "speedtest_failed"}, "error", "speedtest_failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tt.result
+			target.checkPlausibility(&result)
+			assert.Equal(t, tt.status, result.Status)
+			assert.Equal(t, tt.errorCode, result.ErrorCode)
+		})
+	}
+
+	t.Run("no bounds", func(t *testing.T) {
+		result := system.SpeedtestResult{Status: "success", DownloadSpeed: 50000, UploadSpeed: 0.1}
+		(&speedtestTarget{ServerID: "52365"}).checkPlausibility(&result)
+		assert.Equal(t, "success", result.Status)
+	})
+
+	t.Run("bounds per direction", func(t *testing.T) {
+		// an asymmetric link, the bounds of both directions apply where a direction has none
+		target := &speedtestTarget{ServerID: "52365", MinSpeed: 1, MaxSpeed: 1000, MinDownload: 500, MaxUpload: 50}
+
+		result := system.SpeedtestResult{Status: "success", DownloadSpeed: 900, UploadSpeed: 40}
+		target.checkPlausibility(&result)
+		assert.Equal(t, "success", result.Status, result.ErrorCode)
+
+		result = system.SpeedtestResult{Status: "success", DownloadSpeed: 40, UploadSpeed: 40}
+		target.checkPlausibility(&result)
+		assert.Equal(t, "download_below_min: 40.00 Mbps", result.ErrorCode)
+
+		result = system.SpeedtestResult{Status: "success", DownloadSpeed: 900, UploadSpeed: 900}
+		target.checkPlausibility(&result)
+		assert.Equal(t, "upload_above_max: 900.00 Mbps", result.ErrorCode)
+
+		result = system.SpeedtestResult{Status: "success", DownloadSpeed: 900, UploadSpeed: 0.5}
+		target.checkPlausibility(&result)
+		assert.Equal(t, "upload_below_min: 0.50 Mbps", result.ErrorCode)
+	})
+}
+
+func TestSpeedtestManager_UpdateConfigProviders(t *testing.T) {
+	sm, err := NewSpeedtestManager()
+	require.NoError(t, err)
+	defer sm.Stop()
+
+	sm.UpdateConfig([]system.SpeedtestTarget{
+		{ServerID: "52365"},
+		{Provider: "Cloudflare"},
+		{Provider: "librespeed", URL: "https://librespeed.example.com"},
+		{Provider: "librespeed"},
+		{Provider: "http", URL: "https://example.com/100MB.bin", ServerID: "mirror"},
+		{Provider: "fast"},
+	}, "")
+
+	require.Len(t, sm.targets, 4, "targets with unknown providers or missing URLs are rejected")
+	assert.Equal(t, speedtestProviderOokla, sm.targets["52365"].Provider)
+	assert.Equal(t, speedtestProviderCloudflare, sm.targets["cloudflare"].Provider)
+	assert.Equal(t, speedtestProviderLibrespeed, sm.targets["https://librespeed.example.com"].Provider)
+	assert.Equal(t, "https://example.com/100MB.bin", sm.targets["mirror|https://example.com/100MB.bin"].URL)
+}
+
+func TestSpeedtestManager_HttpProviders(t *testing.T) {
+	var uploaded atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/__down", "/garbage.php":
+			size, _ := strconv.Atoi(r.URL.Query().Get("bytes"))
+			if chunks := r.URL.Query().Get("ckSize"); chunks != "" {
+				n, _ := strconv.Atoi(chunks)
+				size = n << 20
+			}
+			w.Write(make([]byte, size))
+		case "/__up", "/empty.php":
+			n, _ := io.Copy(io.Discard, r.Body)
+			uploaded.Add(n)
+		case "/file.bin":
+			w.Write(make([]byte, 1<<20))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	sm, err := NewSpeedtestManager()
+	require.NoError(t, err)
+	defer sm.Stop()
+
+	t.Run("cloudflare", func(t *testing.T) {
+		uploaded.Store(0)
+		result := sm.performSpeedtestCheck(&speedtestTarget{key: "cloudflare", Provider: speedtestProviderCloudflare, URL: server.URL, Timeout: 30 * time.Second})
+		require.Equal(t, "success", result.Status, result.ErrorCode)
+		assert.Equal(t, "cloudflare", result.ServerURL)
+		assert.Equal(t, "Cloudflare", result.ServerName)
+		assert.EqualValues(t, speedtestDownloadBytes, result.DownloadBytes)
+		assert.EqualValues(t, speedtestUploadBytes, result.UploadBytes)
+		assert.EqualValues(t, speedtestUploadBytes, uploaded.Load())
+		assert.Positive(t, result.DownloadSpeed)
+		assert.Positive(t, result.UploadSpeed)
+		assert.Positive(t, result.Latency)
+		assert.LessOrEqual(t, result.PingLow, result.Latency)
+		assert.GreaterOrEqual(t, result.PingHigh, result.Latency)
+		assert.Empty(t, result.ISP, "Ookla-specific fields are left empty")
+	})
+
+	t.Run("librespeed", func(t *testing.T) {
+		result := sm.performSpeedtestCheck(&speedtestTarget{key: server.URL, Provider: speedtestProviderLibrespeed, URL: server.URL + "/", Timeout: 30 * time.Second})
+		require.Equal(t, "success", result.Status, result.ErrorCode)
+		assert.EqualValues(t, 24<<20, result.DownloadBytes)
+		assert.Positive(t, result.UploadSpeed)
+		assert.Equal(t, "127.0.0.1", result.ServerName)
+	})
+
+	t.Run("http", func(t *testing.T) {
+		target := &speedtestTarget{key: "file", Provider: speedtestProviderHTTP, URL: server.URL + "/file.bin", Timeout: 30 * time.Second, MinSpeed: 1}
+		result := sm.performSpeedtestCheck(target)
+		require.Equal(t, "success", result.Status, result.ErrorCode)
+		assert.EqualValues(t, 1<<20, result.DownloadBytes)
+		assert.Positive(t, result.DownloadSpeed)
+		assert.Zero(t, result.UploadSpeed)
+		assert.Zero(t, result.Latency)
+
+		// the missing upload doesn't make the result implausible
+		target.checkPlausibility(result)
+		assert.Equal(t, "success", result.Status, result.ErrorCode)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		result := sm.performSpeedtestCheck(&speedtestTarget{key: "missing", Provider: speedtestProviderHTTP, URL: server.URL + "/missing.bin", Timeout: 30 * time.Second})
+		assert.Equal(t, "error", result.Status)
+		assert.Equal(t, "download_failed: status 404", result.ErrorCode)
+	})
+}
+
+func TestSpeedtestJitter(t *testing.T) {
+	assert.Zero(t, speedtestJitter([]float64{10}))
+	assert.Equal(t, 2.0, speedtestJitter([]float64{10, 12, 10, 12}))
+	assert.Equal(t, 100.0, speedtestMbps(12_500_000, time.Second))
+}
+
+// flakySpeedtest fails until it ran failures times, recording the time each attempt had
+type flakySpeedtest struct {
+	failures int
+	attempts []time.Duration
+}
+
+func (f *flakySpeedtest) run(ctx context.Context, target *speedtestTarget, ns *netns) (*system.SpeedtestResult, error) {
+	deadline, _ := ctx.Deadline()
+	f.attempts = append(f.attempts, time.Until(deadline))
+	if len(f.attempts) <= f.failures {
+		return nil, errors.New("speedtest_failed: network unreachable")
+	}
+	return &system.SpeedtestResult{ServerURL: target.key, Status: "success", DownloadSpeed: 100, DownloadBytes: 500, UploadBytes: 200}, nil
+}
+
+func TestSpeedtestManager_Retries(t *testing.T) {
+	delay := speedtestRetryDelay
+	speedtestRetryDelay = 20 * time.Millisecond
+	t.Cleanup(func() {
+		speedtestRetryDelay = delay
+		delete(speedtestProviders, "flaky")
+	})
+
+	sm, err := NewSpeedtestManager()
+	require.NoError(t, err)
+	defer sm.Stop()
+
+	none, three, hundred := 0, 3, 100
+	sm.UpdateConfig([]system.SpeedtestTarget{
+		{ServerID: "default"},
+		{ServerID: "none", Retries: &none},
+		{ServerID: "three", Retries: &three},
+		{ServerID: "hundred", Retries: &hundred},
+	}, "")
+	assert.Equal(t, 1, sm.targets["default"].Retries)
+	assert.Equal(t, 0, sm.targets["none"].Retries)
+	assert.Equal(t, 3, sm.targets["three"].Retries)
+	// the delay doubles for each retry, so there can't be too many of them
+	assert.Equal(t, maxSpeedtestRetries, sm.targets["hundred"].Retries)
+
+	t.Run("recovers", func(t *testing.T) {
+		flaky := &flakySpeedtest{failures: 2}
+		speedtestProviders["flaky"] = flaky
+		target := &speedtestTarget{key: "flaky", Provider: "flaky", Timeout: time.Minute, Retries: 3}
+
+		start := time.Now()
+		result := sm.performSpeedtestCheck(target)
+		assert.Equal(t, "success", result.Status)
+		assert.Len(t, flaky.attempts, 3)
+		// 20ms, then 40ms of backoff
+		assert.GreaterOrEqual(t, time.Since(start), 60*time.Millisecond)
+		// every attempt gets the full timeout
+		for _, remaining := range flaky.attempts {
+			assert.Greater(t, remaining, 59*time.Second)
+		}
+	})
+
+	t.Run("gives up", func(t *testing.T) {
+		flaky := &flakySpeedtest{failures: 5}
+		speedtestProviders["flaky"] = flaky
+		target := &speedtestTarget{key: "flaky", Provider: "flaky", Timeout: time.Minute, Retries: 1}
+
+		result := sm.performSpeedtestCheck(target)
+		assert.Equal(t, "error", result.Status)
+		assert.Equal(t, "speedtest_failed: network unreachable", result.ErrorCode)
+		assert.Len(t, flaky.attempts, 2)
+	})
+}
+
+func TestSpeedtestManager_ServerSelection(t *testing.T) {
+	// fake CLI reporting the server it was pointed at, or 4242 if it picked one
+	dir := t.TempDir()
+	cli := `#!/bin/sh
+id=4242
+while [ $# -gt 0 ]; do
+	case "$1" in --server-id) id=$2;; --host) id=7777;; esac
+	shift
+done
+echo "{\"server\": {\"id\": $id}, \"download\": {\"bandwidth\": 12500000}}"
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "speedtest"), []byte(cli), 0o755))
+	t.Setenv("PATH", dir)
+
+	sm, err := NewSpeedtestManager()
+	require.NoError(t, err)
+	defer sm.Stop()
+
+	sm.UpdateConfig([]system.SpeedtestTarget{
+		{ServerID: "52365", Timeout: 5 * time.Second},
+		{ServerHost: "speedtest.example.com:8080", Timeout: 5 * time.Second},
+		{Timeout: 5 * time.Second},
+		{ServerID: "52365", ServerHost: "speedtest.example.com:8080", Timeout: 5 * time.Second},
+	}, "")
+	require.Len(t, sm.targets, 4, "targets without a server ID don't collide")
+	assert.Contains(t, sm.targets, "52365")
+	assert.Contains(t, sm.targets, "speedtest.example.com:8080")
+	assert.Contains(t, sm.targets, "ookla")
+	assert.Contains(t, sm.targets, "52365|speedtest.example.com:8080")
+
+	sm.performSpeedtestChecks()
+
+	results := sm.GetResults()
+	require.Len(t, results, 3, "the target with both a server ID and host tests the same server")
+	assert.Equal(t, 100.0, results["52365"].DownloadSpeed)
+	assert.Contains(t, results, "7777", "results of a host are stored under the ID of its server")
+	assert.Contains(t, results, "4242", "results of auto-selected servers are stored under their ID")
+}
+
+func TestSpeedtestUsage(t *testing.T) {
+	dir := t.TempDir()
+	january := time.Date(2025, 1, 31, 23, 0, 0, 0, time.Local)
+
+	usage := loadSpeedtestUsage(dir)
+	usage.add("52365", 1000, january)
+	usage.add("52365", 500, january)
+	usage.add("cloudflare", 0, january)
+	assert.EqualValues(t, 1500, usage.used("52365", january))
+
+	// the usage survives restarts
+	usage = loadSpeedtestUsage(dir)
+	assert.EqualValues(t, 1500, usage.used("52365", january))
+
+	// and starts over in a new month
+	assert.Zero(t, usage.used("52365", january.Add(2*time.Hour)))
+	usage = loadSpeedtestUsage(dir)
+	usage.add("52365", 10, january.Add(2*time.Hour))
+	assert.EqualValues(t, 10, loadSpeedtestUsage(dir).used("52365", january.Add(2*time.Hour)))
+
+	// without a data directory the usage is only kept in memory
+	usage = loadSpeedtestUsage("")
+	usage.add("52365", 1000, january)
+	assert.EqualValues(t, 1000, usage.used("52365", january))
+}
+
+func TestSpeedtestManager_MonthlyByteBudget(t *testing.T) {
+	t.Cleanup(func() { delete(speedtestProviders, "flaky") })
+	speedtestProviders["flaky"] = &flakySpeedtest{}
+
+	sm, err := NewSpeedtestManager()
+	require.NoError(t, err)
+	defer sm.Stop()
+	sm.SetDataDir(t.TempDir())
+
+	sm.UpdateConfig([]system.SpeedtestTarget{{ServerID: "metered", Provider: "flaky", Timeout: 5 * time.Second, MonthlyByteBudget: 1500}}, "")
+	sm.usage.add("metered", 1000, time.Now())
+
+	sm.performSpeedtestChecks()
+	result := sm.GetResults()["metered"]
+	require.NotNil(t, result)
+	assert.Equal(t, "success", result.Status)
+	assert.EqualValues(t, 1700, sm.usage.used("metered", time.Now()))
+
+	sm.performSpeedtestChecks()
+	result = sm.GetResults()["metered"]
+	require.NotNil(t, result)
+	assert.Equal(t, "skipped_budget", result.Status)
+	assert.Equal(t, "budget_exhausted: 1700 of 1500 bytes used this month", result.ErrorCode)
+	assert.EqualValues(t, 1700, sm.usage.used("metered", time.Now()), "skipped runs use no data")
+}
+
+func TestSpeedtestManager_CliMissing(t *testing.T) {
+	lookPath = func(file string) (string, error) { return "", &exec.Error{Name: file, Err: exec.ErrNotFound} }
+	defer func() { lookPath = exec.LookPath }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 1024))
+	}))
+	defer server.Close()
+
+	sm, err := NewSpeedtestManager()
+	require.NoError(t, err)
+	defer sm.Stop()
+
+	// other providers don't need the CLI
+	sm.UpdateConfig([]system.SpeedtestTarget{{ServerID: "file", Provider: speedtestProviderHTTP, URL: server.URL}}, "")
+	assert.Empty(t, sm.scheduler.report("speedtest").Unavailable)
+
+	sm.UpdateConfig([]system.SpeedtestTarget{{ServerID: "52365"}}, "")
+	assert.Equal(t, "speedtest not installed", sm.scheduler.report("speedtest").Unavailable)
+
+	result := sm.performSpeedtestCheck(sm.targets["52365"])
+	assert.Equal(t, "error", result.Status)
+	assert.Equal(t, "speedtest_not_installed: the Ookla speedtest CLI isn't in the PATH", result.ErrorCode)
+}
+
+func TestConfigValidator_RejectsSpeedtestRetries(t *testing.T) {
+	cv := NewConfigValidator(10, time.Hour, nil)
+
+	three, hundred := 3, 100
+	config := &system.MonitoringConfig{}
+	config.Enabled.Speedtest = true
+	config.Speedtest.Targets = []system.SpeedtestTarget{{ServerID: "1", Retries: &three}, {ServerID: "2", Retries: &hundred}}
+	assert.Error(t, cv.ValidateConfig(config))
+
+	ack := cv.RejectInvalidTargets(config)
+	assert.Equal(t, 1, ack.Applied)
+	assert.Equal(t, []common.RejectedTarget{
+		{Service: common.ServiceSpeedtest, Target: "2", Reason: "invalid speedtest retries: 100 (must be 0-5)"},
+	}, ack.Rejected)
+	assert.Equal(t, []system.SpeedtestTarget{{ServerID: "1", Retries: &three}}, config.Speedtest.Targets)
+	assert.NoError(t, cv.ValidateConfig(config))
+}
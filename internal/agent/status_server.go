@@ -0,0 +1,226 @@
+package agent
+
+import (
+	"beszel/internal/agent/health"
+	"beszel/internal/common"
+	"beszel/internal/entities/system"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+)
+
+// redactedHeaderValue replaces the values of HTTP target headers, proxy URLs that don't parse and
+// SNMP credentials in the status server's configuration, as they may carry secrets
+const redactedHeaderValue = "REDACTED"
+
+// statusServer is an optional local HTTP server showing what the agent is doing,
+// independently of its hub connections
+type statusServer struct {
+	agent  *Agent
+	server *http.Server
+}
+
+// serviceStatus is what the status server reports about a monitoring service
+type serviceStatus struct {
+	Scheduler system.SchedulerStatus `json:"scheduler"`
+	Pending   any                    `json:"pending"` // Results waiting for a hub to collect them
+	Latest    map[string]any         `json:"latest"`  // Latest result of each target, collected or not
+	Dropped   uint64                 `json:"dropped"` // Results dropped since the agent started
+}
+
+// newStatusServerFromEnv creates the status server listening on STATUS_LISTEN,
+// or returns nil if it isn't set
+func newStatusServerFromEnv(a *Agent) *statusServer {
+	addr, exists := GetEnv("STATUS_LISTEN")
+	if !exists || addr == "" {
+		return nil
+	}
+	s := &statusServer{agent: a}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.handleHealth)
+	mux.HandleFunc("GET /config", s.handleConfig)
+	mux.HandleFunc("GET /results", s.handleResults)
+	s.server = &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return s
+}
+
+// start listens on the configured address and serves requests in the background
+func (s *statusServer) start() error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+	if host, _, err := net.SplitHostPort(s.server.Addr); err == nil {
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			slog.Warn("Status server is reachable from other hosts", "addr", s.server.Addr)
+		}
+	}
+	slog.Info("Status server listening", "addr", listener.Addr().String())
+	go func() {
+		if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			slog.Error("Status server stopped", "err", err)
+		}
+	}()
+	return nil
+}
+
+// stop shuts the server down, waiting briefly for requests in progress
+func (s *statusServer) stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = s.server.Shutdown(ctx)
+}
+
+// handleHealth reports whether the agent's connection loop is running, like the health command
+func (s *statusServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if err := health.Check(); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
+
+// handleConfig returns the monitoring configuration the agent applied, with credentials redacted
+func (s *statusServer) handleConfig(w http.ResponseWriter, r *http.Request) {
+	a := s.agent
+	a.configMu.Lock()
+	response := map[string]any{
+		"version": a.lastConfigVersion,
+		"source":  a.configSource,
+		"config":  nil,
+	}
+	a.configMu.Unlock()
+	if config := a.appliedConfig.Load(); config != nil {
+		response["config"] = redactConfig(*config)
+	}
+	writeStatusJSON(w, response)
+}
+
+// handleResults returns the scheduler status and the uncollected and latest results of each monitoring service
+func (s *statusServer) handleResults(w http.ResponseWriter, r *http.Request) {
+	writeStatusJSON(w, s.agent.serviceStatuses())
+}
+
+// serviceStatuses returns the status of the available monitoring services by service name.
+// Results are copied without collecting them, so they are still sent to the hub.
+func (a *Agent) serviceStatuses() map[string]serviceStatus {
+	statuses := make(map[string]serviceStatus)
+	if pm := a.pingManager; pm != nil {
+		statuses[common.ServicePing] = peekStatus(&pm.RWMutex, &pm.results, &pm.buffer, pm.scheduler.report(common.ServicePing))
+	}
+	if dm := a.dnsManager; dm != nil {
+		statuses[common.ServiceDns] = peekStatus(&dm.RWMutex, &dm.results, &dm.buffer, dm.scheduler.report(common.ServiceDns))
+	}
+	if hm := a.httpManager; hm != nil {
+		status := peekStatus(&hm.RWMutex, &hm.results, &hm.buffer, hm.scheduler.report(common.ServiceHttp))
+		// HTTP results are keyed by their target's URL, which may hold a password
+		status.Pending = redactHttpResults(status.Pending.(map[string]*system.HttpResult))
+		status.Latest = redactHttpResults(status.Latest)
+		statuses[common.ServiceHttp] = status
+	}
+	if sm := a.speedtestManager; sm != nil {
+		statuses[common.ServiceSpeedtest] = peekStatus(&sm.RWMutex, &sm.results, &sm.buffer, sm.scheduler.report(common.ServiceSpeedtest))
+	}
+	if tm := a.tracerouteManager; tm != nil {
+		statuses[common.ServiceTraceroute] = peekStatus(&tm.RWMutex, &tm.results, &tm.buffer, tm.scheduler.report(common.ServiceTraceroute))
+	}
+	if sm := a.snmpManager; sm != nil {
+		statuses[common.ServiceSnmp] = peekStatus(&sm.RWMutex, &sm.results, &sm.buffer, sm.scheduler.report(common.ServiceSnmp))
+	}
+	return statuses
+}
+
+// peekStatus copies the uncollected and latest results of a manager and its dropped count under
+// its lock. Stored results aren't modified anymore, so the copies share them.
+func peekStatus[T any](lock *sync.RWMutex, results *map[string]T, buffer *resultBuffer, scheduler system.SchedulerStatus) serviceStatus {
+	lock.RLock()
+	defer lock.RUnlock()
+	return serviceStatus{
+		Scheduler: scheduler,
+		Pending:   maps.Clone(*results),
+		Latest:    maps.Clone(buffer.latest),
+		Dropped:   buffer.dropped,
+	}
+}
+
+// redactHttpResults returns a copy of HTTP results whose keys and URLs don't hold passwords.
+// The results are shared with the manager, so the redacted ones are copies.
+func redactHttpResults[T any](results map[string]T) map[string]T {
+	if results == nil {
+		return nil
+	}
+	redacted := make(map[string]T, len(results))
+	for key, value := range results {
+		if result, ok := any(value).(*system.HttpResult); ok && result != nil {
+			copied := *result
+			copied.URL = redactURL(result.URL)
+			if result.FinalURL != "" {
+				copied.FinalURL = redactURL(result.FinalURL)
+			}
+			value = any(&copied).(T)
+		}
+		redacted[redactURL(key)] = value
+	}
+	return redacted
+}
+
+// redactURL returns the URL with the password of its userinfo masked. A URL that
+// doesn't parse could still hold a password, so it is replaced as a whole.
+func redactURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return redactedHeaderValue
+	}
+	return parsed.Redacted()
+}
+
+// redactConfig returns a copy of the configuration without the values of HTTP target headers,
+// the passwords of their URLs and proxies and SNMP credentials
+func redactConfig(config system.MonitoringConfig) system.MonitoringConfig {
+	config.Http.Targets = slices.Clone(config.Http.Targets)
+	for i, target := range config.Http.Targets {
+		config.Http.Targets[i].URL = redactURL(target.URL)
+		if target.ProxyURL != "" {
+			config.Http.Targets[i].ProxyURL = redactURL(target.ProxyURL)
+		}
+		if len(target.Headers) == 0 {
+			continue
+		}
+		headers := make(map[string]string, len(target.Headers))
+		for name := range target.Headers {
+			headers[name] = redactedHeaderValue
+		}
+		config.Http.Targets[i].Headers = headers
+	}
+	config.Snmp.Targets = slices.Clone(config.Snmp.Targets)
+	for i, target := range config.Snmp.Targets {
+		for _, secret := range []*string{&target.Community, &target.AuthPassword, &target.PrivPassword} {
+			if *secret != "" {
+				*secret = redactedHeaderValue
+			}
+		}
+		config.Snmp.Targets[i] = target
+	}
+	return config
+}
+
+// writeStatusJSON writes an indented JSON response
+func writeStatusJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		slog.Debug("Failed to write status response", "err", err)
+	}
+}
@@ -3,15 +3,15 @@ package agent
 import (
 	"beszel"
 	"beszel/internal/entities/system"
-	"encoding/json"
 	"fmt"
-	"io"
 	"log/slog"
-	"net/http"
+	"net"
 	"os"
+	"strconv"
 	"strings"
 
 	ghwnet "github.com/jaypipes/ghw/pkg/net"
+	"github.com/jaypipes/ghw/pkg/option"
 )
 
 // Sets initial / non-changing values about the host system
@@ -19,103 +19,61 @@ func (a *Agent) initializeSystemInfo() {
 	a.systemInfo.AgentVersion = beszel.Version
 	a.systemInfo.Hostname, _ = os.Hostname()
 
-	// Get public IP, ISP, and ASN information
-	a.getIPInfo()
-}
+	// Get public IP, ISP, and ASN information, from the cache if it is recent
+	a.ipInfo = newIPInfoProviderFromEnv(a.dataDir)
+	a.getIPInfo(true)
 
-// GeoJSResponse represents the response from the GeoJS API
-type GeoJSResponse struct {
-	Organization     string `json:"organization"`
-	Country          string `json:"country"`
-	OrganizationName string `json:"organization_name"`
-	CountryCode      string `json:"country_code"`
-	ASN              int    `json:"asn"`
-	Region           string `json:"region"`
-	IP               string `json:"ip"`
-	City             string `json:"city"`
+	a.systemInfo.Interfaces = a.getAllNetworkInterfaces()
 }
 
-// getIPInfo collects public IP, ISP, and ASN information using GeoJS API
-func (a *Agent) getIPInfo() {
-	// Make HTTP request to GeoJS API
-	resp, err := http.Get("https://get.geojs.io/v1/ip/geo.json")
+// getAllNetworkInterfaces returns the network interfaces of the host that are up,
+// leaving out loopback interfaces
+func (a *Agent) getAllNetworkInterfaces() []system.NetworkInterface {
+	netInfo, err := ghwnet.New(option.WithNullAlerter())
 	if err != nil {
-		slog.Debug("Failed to get IP info from GeoJS", "error", err)
-		return
-	}
-	defer resp.Body.Close()
-
-	// Read response body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		slog.Debug("Failed to read GeoJS response", "error", err)
-		return
-	}
-
-	// Parse JSON response
-	var geoInfo GeoJSResponse
-	if err := json.Unmarshal(body, &geoInfo); err != nil {
-		slog.Debug("Failed to parse GeoJS response", "error", err)
-		return
-	}
-
-	// Set the collected information
-	a.systemInfo.PublicIP = geoInfo.IP
-	a.systemInfo.ISP = geoInfo.OrganizationName
-	if geoInfo.ASN > 0 {
-		a.systemInfo.ASN = fmt.Sprintf("AS%d", geoInfo.ASN)
+		slog.Debug("Failed to get network info", "error", err)
+		return nil
 	}
-
-	slog.Debug("IP info collected from GeoJS",
-		"ip", a.systemInfo.PublicIP,
-		"isp", a.systemInfo.ISP,
-		"asn", a.systemInfo.ASN,
-		"city", geoInfo.City,
-		"country", geoInfo.Country)
-}
-
-// getAllNetworkInterfaces returns information about all network interfaces
-// This can be used for debugging or future enhancements
-func (a *Agent) getAllNetworkInterfaces() []struct {
-	Name      string `json:"name"`
-	Speed     uint64 `json:"speed_mbps"`
-	IsVirtual bool   `json:"is_virtual"`
-} {
-	netInfo, err := ghwnet.New()
+	links, err := net.Interfaces()
 	if err != nil {
-		slog.Debug("Failed to get network info", "error", err)
+		slog.Debug("Failed to get network interface flags", "error", err)
 		return nil
 	}
+	return a.activeInterfaces(netInfo.NICs, links)
+}
 
-	var interfaces []struct {
-		Name      string `json:"name"`
-		Speed     uint64 `json:"speed_mbps"`
-		IsVirtual bool   `json:"is_virtual"`
+// activeInterfaces returns the NICs whose link is up and not a loopback
+func (a *Agent) activeInterfaces(nics []*ghwnet.NIC, links []net.Interface) []system.NetworkInterface {
+	up := make(map[string]bool, len(links))
+	for _, link := range links {
+		up[link.Name] = link.Flags&net.FlagUp != 0 && link.Flags&net.FlagLoopback == 0
 	}
 
-	for _, nic := range netInfo.NICs {
+	var interfaces []system.NetworkInterface
+	for _, nic := range nics {
+		if !up[nic.Name] {
+			continue
+		}
 		speedMbps := uint64(0)
 		if nic.Speed != "" {
 			speedMbps = a.parseSpeedString(nic.Speed)
 		}
-
-		interfaces = append(interfaces, struct {
-			Name      string `json:"name"`
-			Speed     uint64 `json:"speed_mbps"`
-			IsVirtual bool   `json:"is_virtual"`
-		}{
+		interfaces = append(interfaces, system.NetworkInterface{
 			Name:      nic.Name,
 			Speed:     speedMbps,
 			IsVirtual: nic.IsVirtual,
 		})
 	}
-
 	return interfaces
 }
 
 // parseSpeedString parses speed strings like "1000Mb/s" or "1Gb/s" and returns Mbps
 func (a *Agent) parseSpeedString(speed string) uint64 {
 	// Common speed patterns: "1000Mb/s", "1Gb/s", "100Mb/s", etc.
+	// sysfs reports plain Mbps like "1000", or -1 if the speed is unknown
+	if mbps, err := strconv.ParseInt(speed, 10, 64); err == nil {
+		return uint64(max(mbps, 0))
+	}
 	var value float64
 	var unit string
 
@@ -202,6 +160,42 @@ func (a *Agent) getSystemStats() system.Stats {
 		slog.Debug("No speedtest manager available")
 	}
 
+	// get traceroute results if traceroute manager is available
+	if a.tracerouteManager != nil {
+		if tracerouteResults := a.tracerouteManager.GetResults(); tracerouteResults != nil {
+			systemStats.TracerouteResults = tracerouteResults
+			slog.Debug("Traceroute results collected", "count", len(systemStats.TracerouteResults))
+		}
+	}
+
+	// get SNMP results if SNMP manager is available
+	if a.snmpManager != nil {
+		if snmpResults := a.snmpManager.GetResults(); snmpResults != nil {
+			systemStats.SnmpResults = snmpResults
+			slog.Debug("SNMP results collected", "count", len(systemStats.SnmpResults))
+		}
+	}
+
+	// report results the managers had to drop because the hub didn't collect them in time
+	if a.pingManager != nil {
+		systemStats.DroppedResults += a.pingManager.DroppedResults()
+	}
+	if a.dnsManager != nil {
+		systemStats.DroppedResults += a.dnsManager.DroppedResults()
+	}
+	if a.httpManager != nil {
+		systemStats.DroppedResults += a.httpManager.DroppedResults()
+	}
+	if a.speedtestManager != nil {
+		systemStats.DroppedResults += a.speedtestManager.DroppedResults()
+	}
+	if a.tracerouteManager != nil {
+		systemStats.DroppedResults += a.tracerouteManager.DroppedResults()
+	}
+	if a.snmpManager != nil {
+		systemStats.DroppedResults += a.snmpManager.DroppedResults()
+	}
+
 	slog.Debug("sysinfo", "data", a.systemInfo)
 
 	return systemStats
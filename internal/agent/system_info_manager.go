@@ -2,6 +2,7 @@ package agent
 
 import (
 	"log/slog"
+	"slices"
 	"sync"
 	"time"
 )
@@ -56,22 +57,29 @@ func (sim *SystemInfoManager) refreshSystemInfo() {
 	oldIP := sim.agent.systemInfo.PublicIP
 	oldISP := sim.agent.systemInfo.ISP
 	oldASN := sim.agent.systemInfo.ASN
+	oldInterfaces := sim.agent.systemInfo.Interfaces
 
 	slog.Debug("Starting system info refresh")
 
-	// Refresh IP info
-	sim.agent.getIPInfo()
+	// Refresh IP info, skipping the cache to notice a changed IP
+	sim.agent.getIPInfo(false)
+
+	// Refresh network interfaces, link speeds may have been renegotiated
+	sim.agent.systemInfo.Interfaces = sim.agent.getAllNetworkInterfaces()
+	interfacesChanged := !slices.Equal(oldInterfaces, sim.agent.systemInfo.Interfaces)
 
 	// Check if anything changed
 	changed := oldIP != sim.agent.systemInfo.PublicIP ||
 		oldISP != sim.agent.systemInfo.ISP ||
-		oldASN != sim.agent.systemInfo.ASN
+		oldASN != sim.agent.systemInfo.ASN ||
+		interfacesChanged
 
 	if changed {
 		slog.Info("System info updated",
 			"ip_changed", oldIP != sim.agent.systemInfo.PublicIP,
 			"isp_changed", oldISP != sim.agent.systemInfo.ISP,
 			"asn_changed", oldASN != sim.agent.systemInfo.ASN,
+			"interfaces_changed", interfacesChanged,
 			"new_ip", sim.agent.systemInfo.PublicIP,
 			"new_isp", sim.agent.systemInfo.ISP)
 
@@ -1,7 +1,12 @@
 package agent
 
 import (
+	"beszel/internal/entities/system"
+	"net"
 	"testing"
+
+	ghwnet "github.com/jaypipes/ghw/pkg/net"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestGetAllNetworkInterfaces(t *testing.T) {
@@ -33,3 +38,42 @@ func TestGetAllNetworkInterfaces(t *testing.T) {
 		t.Error("No valid network interfaces found")
 	}
 }
+
+func TestActiveInterfaces(t *testing.T) {
+	agent := &Agent{}
+	nics := []*ghwnet.NIC{
+		{Name: "lo", IsVirtual: true},
+		{Name: "eth0", Speed: "100"},
+		{Name: "eth1", Speed: "1000Mb/s"},
+		{Name: "eth2", Speed: "-1"},
+		{Name: "docker0", IsVirtual: true, Speed: "10000"},
+		{Name: "wlan0"},
+	}
+	links := []net.Interface{
+		{Name: "lo", Flags: net.FlagUp | net.FlagLoopback},
+		{Name: "eth0", Flags: net.FlagUp},
+		{Name: "eth1"},
+		{Name: "eth2", Flags: net.FlagUp},
+		{Name: "docker0", Flags: net.FlagUp},
+	}
+
+	// loopback, down and unknown interfaces are left out
+	assert.Equal(t, []system.NetworkInterface{
+		{Name: "eth0", Speed: 100},
+		{Name: "eth2"},
+		{Name: "docker0", Speed: 10000, IsVirtual: true},
+	}, agent.activeInterfaces(nics, links))
+}
+
+func TestParseSpeedString(t *testing.T) {
+	agent := &Agent{}
+	for speed, want := range map[string]uint64{
+		"1000Mb/s": 1000,
+		"2.5Gb/s":  2500,
+		"100":      100,
+		"-1":       0,
+		"Unknown!": 0,
+	} {
+		assert.Equal(t, want, agent.parseSpeedString(speed), speed)
+	}
+}
@@ -0,0 +1,39 @@
+//go:build linux
+
+package agent
+
+import (
+	"crypto/tls"
+	"net"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// tcpInfo returns the total number of retransmitted segments of a TCP connection and the
+// variance of its round trip time as smoothed by the kernel.
+// It reports false if the connection is not a TCP socket.
+func tcpInfo(conn net.Conn) (uint32, time.Duration, bool) {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	sysConn, ok := conn.(syscall.Conn)
+	if !ok {
+		return 0, 0, false
+	}
+	rawConn, err := sysConn.SyscallConn()
+	if err != nil {
+		return 0, 0, false
+	}
+
+	var info *unix.TCPInfo
+	var infoErr error
+	if err := rawConn.Control(func(fd uintptr) {
+		info, infoErr = unix.GetsockoptTCPInfo(int(fd), unix.IPPROTO_TCP, unix.TCP_INFO)
+	}); err != nil || infoErr != nil {
+		return 0, 0, false
+	}
+	// the kernel reports the variance in microseconds
+	return info.Total_retrans, time.Duration(info.Rttvar) * time.Microsecond, true
+}
@@ -0,0 +1,76 @@
+//go:build linux
+
+package agent
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTcpInfo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	t.Run("tcp connection", func(t *testing.T) {
+		conn, err := net.Dial("tcp", server.Listener.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+
+		// the kernel only has an RTT sample after data was acknowledged
+		_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		require.NoError(t, err)
+		_, err = conn.Read(make([]byte, 1024))
+		require.NoError(t, err)
+
+		retransmits, rttVar, ok := tcpInfo(conn)
+		assert.True(t, ok)
+		assert.Zero(t, retransmits, "no retransmits expected on loopback")
+		assert.Positive(t, rttVar, "the kernel starts with half the first RTT sample as variance")
+	})
+
+	t.Run("non tcp connection", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer client.Close()
+		defer server.Close()
+
+		_, _, ok := tcpInfo(client)
+		assert.False(t, ok)
+	})
+
+	t.Run("http check", func(t *testing.T) {
+		hm, err := NewHttpManager()
+		require.NoError(t, err)
+
+		result := hm.performHttpCheck(&httpTarget{URL: server.URL, Timeout: 5 * time.Second})
+		assert.Equal(t, "success", result.Status, result.ErrorCode)
+		assert.Zero(t, result.TcpRetransmits)
+		assert.Positive(t, result.TcpRttVar)
+	})
+}
+
+func TestTcpInfo_TLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	conn, err := tls.Dial("tcp", server.Listener.Addr().String(), &tls.Config{RootCAs: roots, ServerName: "example.com"})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, _, ok := tcpInfo(conn)
+	assert.True(t, ok, "TLS connections should be unwrapped to the TCP socket")
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package agent
+
+import (
+	"net"
+	"time"
+)
+
+// tcpInfo is only supported on Linux, where TCP_INFO is available.
+func tcpInfo(conn net.Conn) (uint32, time.Duration, bool) {
+	return 0, 0, false
+}
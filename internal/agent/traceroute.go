@@ -0,0 +1,497 @@
+package agent
+
+import (
+	"beszel/internal/entities/system"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+type TracerouteManager struct {
+	sync.RWMutex
+	targets        map[string]*tracerouteTarget
+	results        map[string]*system.TracerouteResult
+	ctx            context.Context
+	cancel         context.CancelFunc
+	cronScheduler  *cron.Cron
+	cronExpression string          // Cron expression for traceroute scheduling
+	cronSeconds    bool            // Whether the cron expression has a leading seconds field
+	resolver       *net.Resolver   // Optional resolver for target hostnames (nil uses the system resolver)
+	buffer         resultBuffer    // Bounds results waiting for the hub
+	netns          *netns          // Network namespace traceroutes run in, nil for the host namespace
+	scheduler      schedulerStatus // Health of the cron job, reported in heartbeats
+}
+
+type tracerouteTarget struct {
+	system.TracerouteTarget
+	lastTrace time.Time
+}
+
+// Tools measuring the path to a traceroute target
+const (
+	tracerouteToolMtr        = "mtr"
+	tracerouteToolTraceroute = "traceroute"
+)
+
+// Defaults and limits of traceroute targets
+const (
+	defaultTracerouteCount   = 5  // Probes sent to each hop
+	defaultTracerouteMaxHops = 30 // traceroute's default maximum TTL
+	maxTracerouteMaxHops     = 64
+	defaultTracerouteTimeout = 2 * time.Second // Wait for the reply to a probe
+)
+
+// tracerouteHeaderRegex matches the first line of traceroute output, e.g.
+// traceroute to example.com (192.0.2.1), 30 hops max, 60 byte packets
+var tracerouteHeaderRegex = regexp.MustCompile(`^traceroute6? to \S+ \(([^)]+)\)`)
+
+// tracerouteHopRegex matches the number at the start of a hop line
+var tracerouteHopRegex = regexp.MustCompile(`^\s*(\d+)\s+(.*)$`)
+
+// NewTracerouteManager creates a new traceroute manager
+func NewTracerouteManager() (*TracerouteManager, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	tm := &TracerouteManager{
+		targets:        make(map[string]*tracerouteTarget),
+		results:        make(map[string]*system.TracerouteResult),
+		buffer:         newResultBuffer(),
+		ctx:            ctx,
+		cancel:         cancel,
+		cronScheduler:  cron.New(cron.WithParser(cronParser(false))),
+		cronExpression: "", // Will be set by hub configuration (5-field format: minute hour day month weekday)
+	}
+
+	slog.Debug("Traceroute manager initialized")
+
+	// Start the cron scheduler
+	tm.cronScheduler.Start()
+
+	// Schedule the traceroute job
+	tm.scheduleTracerouteJob()
+
+	return tm, nil
+}
+
+// UpdateConfig updates the traceroute configuration with targets and cron expression
+func (tm *TracerouteManager) UpdateConfig(targets []system.TracerouteTarget, cronExpression string) {
+	tm.Lock()
+	defer tm.Unlock()
+
+	slog.Debug("UpdateConfig called", "old_targets", len(tm.targets), "new_targets", len(targets), "cron_expression", cronExpression)
+
+	tm.cronExpression = cronExpression
+
+	// Replace the targets, results are pruned below once the new targets are known
+	tm.targets = make(map[string]*tracerouteTarget)
+
+	for _, target := range targets {
+		if target.Count <= 0 {
+			target.Count = defaultTracerouteCount
+		}
+		if target.MaxHops <= 0 {
+			target.MaxHops = defaultTracerouteMaxHops
+		} else if target.MaxHops > maxTracerouteMaxHops {
+			slog.Warn("Traceroute max hops out of range, clamping", "host", target.Host, "max_hops", target.MaxHops)
+			target.MaxHops = maxTracerouteMaxHops
+		}
+		if target.Timeout <= 0 {
+			target.Timeout = defaultTracerouteTimeout
+		}
+		if target.Tool != "" && target.Tool != tracerouteToolMtr && target.Tool != tracerouteToolTraceroute {
+			slog.Warn("Unknown traceroute tool, detecting it instead", "host", target.Host, "tool", target.Tool)
+			target.Tool = ""
+		}
+
+		tm.targets[target.Host] = &tracerouteTarget{
+			TracerouteTarget: target,
+			lastTrace:        time.Time{}, // Not checked yet, the run started below checks it
+		}
+	}
+
+	if dropped := pruneResults(&tm.buffer, tm.results, func(host string) bool { return tm.targets[host] != nil }); dropped > 0 {
+		slog.Info("Dropped results of removed traceroute targets", "results", dropped)
+	}
+
+	// Reschedule the traceroute job with new cron expression
+	tm.scheduleTracerouteJob()
+
+	// run the checks right away instead of waiting for the first scheduled run, unless neither the
+	// targets nor the schedule changed
+	if tm.scheduler.changed(targets, cronExpression) && len(tm.targets) > 0 && tm.cronExpression != "" {
+		go tm.scheduler.run(tm.checkTraceroutes)
+	}
+
+	slog.Debug("Updated traceroute config", "targets", len(tm.targets), "cron_expression", cronExpression)
+}
+
+// SetResolver sets the resolver used for target hostnames
+func (tm *TracerouteManager) SetResolver(resolver *net.Resolver) {
+	tm.Lock()
+	defer tm.Unlock()
+	tm.resolver = resolver
+}
+
+// setNetns sets the network namespace traceroutes run in, nil uses the host namespace
+func (tm *TracerouteManager) setNetns(ns *netns) {
+	tm.Lock()
+	defer tm.Unlock()
+	tm.netns = ns
+}
+
+// SetCronSeconds sets whether cron expressions have a leading seconds field, used from the next UpdateConfig
+func (tm *TracerouteManager) SetCronSeconds(seconds bool) {
+	tm.Lock()
+	defer tm.Unlock()
+	tm.cronSeconds = seconds
+}
+
+// SetJitter sets the seed of the phase offsets spreading the targets of scheduled runs, empty runs them all at once
+func (tm *TracerouteManager) SetJitter(seed string) {
+	tm.scheduler.setJitter(seed)
+}
+
+// SetResultBufferSize sets how many uncollected results are kept before the oldest are dropped
+func (tm *TracerouteManager) SetResultBufferSize(size int) {
+	tm.Lock()
+	defer tm.Unlock()
+	tm.buffer.setSize(size)
+}
+
+// DroppedResults returns the number of traceroute results dropped because the hub didn't collect them in time
+func (tm *TracerouteManager) DroppedResults() uint64 {
+	tm.RLock()
+	defer tm.RUnlock()
+	return tm.buffer.dropped
+}
+
+// GetResults returns the current traceroute results and clears them after retrieval
+// Returns nil if no results are available (no traceroutes have run recently)
+func (tm *TracerouteManager) GetResults() map[string]*system.TracerouteResult {
+	tm.Lock()
+	defer tm.Unlock()
+
+	if len(tm.results) == 0 {
+		return nil
+	}
+
+	// Create a copy to avoid race conditions
+	results := make(map[string]*system.TracerouteResult)
+	for host, result := range tm.results {
+		results[host] = &system.TracerouteResult{
+			Host:        result.Host,
+			Status:      result.Status,
+			Hops:        slices.Clone(result.Hops),
+			ErrorCode:   result.ErrorCode,
+			LastChecked: result.LastChecked,
+			Tool:        result.Tool,
+		}
+	}
+
+	// Clear the results after they've been retrieved
+	// This ensures traceroute data is only sent once per run
+	tm.results = make(map[string]*system.TracerouteResult)
+
+	return results
+}
+
+// Close shuts down the traceroute manager
+func (tm *TracerouteManager) Close() {
+	tm.cronScheduler.Stop()
+	tm.cancel()
+}
+
+// scheduleTracerouteJob schedules the traceroute job with the current cron expression
+func (tm *TracerouteManager) scheduleTracerouteJob() {
+	// Remove all existing jobs
+	tm.cronScheduler.Stop()
+	tm.cronScheduler = cron.New(cron.WithParser(cronParser(tm.cronSeconds)))
+	tm.cronScheduler.Start()
+
+	// Only schedule if we have a valid cron expression
+	if tm.cronExpression != "" {
+		id, err := tm.cronScheduler.AddFunc(tm.cronExpression, func() {
+			slog.Debug("Running traceroutes")
+			if !tm.scheduler.runScheduled(tm.checkTraceroutes) {
+				slog.Warn("Skipping scheduled traceroutes, the previous run is still going", "cron_expression", tm.cronExpression)
+			}
+		})
+		if err != nil {
+			slog.Error("Failed to schedule traceroute job", "cron_expression", tm.cronExpression, "error", err)
+		} else {
+			slog.Debug("Scheduled traceroute job")
+		}
+		tm.scheduler.scheduled(tm.cronScheduler.Entry(id).Schedule, err)
+	} else {
+		slog.Debug("No cron expression set, traceroute job not scheduled")
+		tm.scheduler.scheduled(nil, nil)
+	}
+}
+
+// checkTraceroutes runs the traceroutes of all targets
+func (tm *TracerouteManager) checkTraceroutes() {
+	tm.RLock()
+	targets := make([]*tracerouteTarget, 0, len(tm.targets))
+	for _, target := range tm.targets {
+		targets = append(targets, target)
+	}
+	tm.RUnlock()
+
+	// Trace targets concurrently
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		wg.Add(1)
+		go func(t *tracerouteTarget) {
+			defer wg.Done()
+			if !tm.scheduler.waitPhase(tm.ctx, t.Host) {
+				return
+			}
+			tm.traceTarget(t)
+		}(target)
+	}
+	wg.Wait()
+}
+
+// traceTarget measures the path to a target with mtr or traceroute
+func (tm *TracerouteManager) traceTarget(target *tracerouteTarget) {
+	tm.Lock()
+	target.lastTrace = time.Now()
+	ns := tm.netns
+	tm.Unlock()
+
+	result := &system.TracerouteResult{
+		Host:        target.Host,
+		LastChecked: time.Now(),
+	}
+
+	tool, err := tracerouteTool(target.Tool)
+	if err != nil {
+		tm.failResult(result, err)
+		return
+	}
+	result.Tool = tool
+
+	addr, err := tm.resolveHost(target)
+	if err != nil {
+		tm.failResult(result, err)
+		return
+	}
+
+	// worst case every probe of every hop times out one after the other
+	ctx, cancel := context.WithTimeout(tm.ctx, time.Duration(target.Count*target.MaxHops)*target.Timeout+10*time.Second)
+	defer cancel()
+
+	var output []byte
+	var hops []system.TracerouteHop
+	var dst string
+	if tool == tracerouteToolMtr {
+		// --json implies report mode, -n skips reverse lookups of the hops
+		output, err = ns.combinedOutput(exec.CommandContext(ctx, "mtr", "--json", "-n",
+			"-c", strconv.Itoa(target.Count),
+			"-m", strconv.Itoa(target.MaxHops),
+			addr))
+		if err == nil {
+			dst, hops, err = parseMtrOutput(output)
+		}
+	} else {
+		output, err = ns.combinedOutput(exec.CommandContext(ctx, "traceroute", "-n",
+			"-q", strconv.Itoa(target.Count),
+			"-w", strconv.FormatFloat(target.Timeout.Seconds(), 'f', -1, 64),
+			"-m", strconv.Itoa(target.MaxHops),
+			addr))
+		if err == nil {
+			dst, hops = parseTracerouteOutput(string(output))
+		}
+	}
+	if err != nil {
+		slog.Debug("Traceroute failed", "host", target.Host, "tool", tool, "error", err, "output", string(output))
+		tm.failResult(result, err)
+		return
+	}
+
+	result.Hops = hops
+	result.Status = "incomplete"
+	if reachedDestination(hops, dst) {
+		result.Status = "success"
+	}
+	slog.Debug("Traceroute completed", "host", target.Host, "tool", tool, "hops", len(hops), "status", result.Status)
+	tm.updateResult(target.Host, result)
+}
+
+// failResult stores a result of a traceroute that couldn't run
+func (tm *TracerouteManager) failResult(result *system.TracerouteResult, err error) {
+	result.Status = "error"
+	result.ErrorCode = err.Error()
+	tm.updateResult(result.Host, result)
+}
+
+// tracerouteTool returns the tool to use, mtr if it is installed and traceroute otherwise
+// unless one is configured
+func tracerouteTool(configured string) (string, error) {
+	candidates := []string{tracerouteToolMtr, tracerouteToolTraceroute}
+	if configured != "" {
+		candidates = []string{configured}
+	}
+	for _, tool := range candidates {
+		if _, err := exec.LookPath(tool); err == nil {
+			return tool, nil
+		}
+	}
+	return "", fmt.Errorf("%s not found", strings.Join(candidates, " or "))
+}
+
+// resolveHost returns the address to trace for a target. Hostnames are resolved here rather than
+// by the tool, as the tools report the destination by the name they were given while the hops
+// are addresses, and a trace could never be seen to reach its destination.
+func (tm *TracerouteManager) resolveHost(target *tracerouteTarget) (string, error) {
+	tm.RLock()
+	resolver := cmp.Or(tm.resolver, net.DefaultResolver)
+	tm.RUnlock()
+
+	if net.ParseIP(target.Host) != nil {
+		return target.Host, nil
+	}
+
+	ctx, cancel := context.WithTimeout(tm.ctx, target.Timeout)
+	defer cancel()
+
+	addrs, err := resolver.LookupHost(ctx, target.Host)
+	if err != nil {
+		return "", err
+	}
+	if len(addrs) == 0 {
+		return "", fmt.Errorf("no addresses found for %s", target.Host)
+	}
+	return addrs[0], nil
+}
+
+// reachedDestination reports whether the last hop is the destination and it replied
+func reachedDestination(hops []system.TracerouteHop, dst string) bool {
+	if len(hops) == 0 || dst == "" {
+		return false
+	}
+	last := hops[len(hops)-1]
+	return last.Host == dst && last.Loss < 100
+}
+
+// mtrReport is the output of mtr --json
+type mtrReport struct {
+	Report struct {
+		Mtr struct {
+			Dst string `json:"dst"`
+		} `json:"mtr"`
+		Hubs []struct {
+			Host  string  `json:"host"`
+			Loss  float64 `json:"Loss%"`
+			Sent  int     `json:"Snt"`
+			Avg   float64 `json:"Avg"`
+			Best  float64 `json:"Best"`
+			Worst float64 `json:"Wrst"`
+		} `json:"hubs"`
+	} `json:"report"`
+}
+
+// parseMtrOutput returns the destination address and the hops of mtr --json output.
+// Hops without replies are reported by mtr as "???" and have no host.
+func parseMtrOutput(output []byte) (string, []system.TracerouteHop, error) {
+	var report mtrReport
+	if err := json.Unmarshal(output, &report); err != nil {
+		return "", nil, fmt.Errorf("invalid mtr output: %w", err)
+	}
+	if len(report.Report.Hubs) == 0 {
+		return "", nil, errors.New("mtr reported no hops")
+	}
+	hops := make([]system.TracerouteHop, 0, len(report.Report.Hubs))
+	for i, hub := range report.Report.Hubs {
+		hop := system.TracerouteHop{
+			Hop:  i + 1,
+			Loss: hub.Loss,
+			Sent: hub.Sent,
+		}
+		if hub.Host != "???" {
+			hop.Host = hub.Host
+		}
+		if hub.Loss < 100 {
+			hop.AvgRtt = hub.Avg
+			hop.BestRtt = hub.Best
+			hop.WorstRtt = hub.Worst
+		}
+		hops = append(hops, hop)
+	}
+	return report.Report.Mtr.Dst, hops, nil
+}
+
+// parseTracerouteOutput returns the destination address and the hops of traceroute -n output.
+// A hop line lists the replying addresses, the RTT of each reply and a "*" for each lost probe, e.g.
+// 3  10.0.0.1  5.102 ms 10.0.0.2  6.215 ms *
+func parseTracerouteOutput(output string) (string, []system.TracerouteHop) {
+	var dst string
+	var hops []system.TracerouteHop
+	for _, line := range strings.Split(output, "\n") {
+		if header := tracerouteHeaderRegex.FindStringSubmatch(line); header != nil {
+			dst = header[1]
+			continue
+		}
+		match := tracerouteHopRegex.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		number, _ := strconv.Atoi(match[1])
+		hop := system.TracerouteHop{Hop: number}
+
+		var rtts []float64
+		lost := 0
+		for _, field := range strings.Fields(match[2]) {
+			switch {
+			case field == "*":
+				lost++
+			case field == "ms", strings.HasPrefix(field, "!"):
+				// units and annotations like !H for unreachable hosts
+			case net.ParseIP(field) != nil:
+				if hop.Host == "" {
+					hop.Host = field
+				}
+			default:
+				if rtt, err := strconv.ParseFloat(field, 64); err == nil {
+					rtts = append(rtts, rtt)
+				}
+			}
+		}
+
+		hop.Sent = len(rtts) + lost
+		if hop.Sent > 0 {
+			hop.Loss = float64(lost) * 100 / float64(hop.Sent)
+		}
+		if len(rtts) > 0 {
+			var sum float64
+			for _, rtt := range rtts {
+				sum += rtt
+			}
+			hop.AvgRtt = sum / float64(len(rtts))
+			hop.BestRtt = slices.Min(rtts)
+			hop.WorstRtt = slices.Max(rtts)
+		}
+		hops = append(hops, hop)
+	}
+	return dst, hops
+}
+
+// updateResult updates the traceroute result for a host
+func (tm *TracerouteManager) updateResult(host string, result *system.TracerouteResult) {
+	tm.Lock()
+	defer tm.Unlock()
+	bufferResult(&tm.buffer, tm.results, host, result, func(r *system.TracerouteResult) time.Time { return r.LastChecked })
+}
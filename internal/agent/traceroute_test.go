@@ -0,0 +1,150 @@
+package agent
+
+import (
+	"beszel/internal/common"
+	"beszel/internal/entities/system"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMtrOutput(t *testing.T) {
+	output := `{"report":{"mtr":{"src":"host","dst":"192.0.2.1","tos":0,"tests":5,"psize":"64","bitpattern":"0x00"},
+"hubs":[{"count":1,"host":"10.0.0.1","Loss%":0.0,"Snt":5,"Last":0.6,"Avg":0.5,"Best":0.4,"Wrst":0.7,"StDev":0.1},
+{"count":"2","host":"???","Loss%":100.0,"Snt":5,"Last":0.0,"Avg":0.0,"Best":0.0,"Wrst":0.0,"StDev":0.0},
+{"count":3,"host":"192.0.2.1","Loss%":20.0,"Snt":5,"Last":9.1,"Avg":9.0,"Best":8.8,"Wrst":9.3,"StDev":0.2}]}}`
+
+	dst, hops, err := parseMtrOutput([]byte(output))
+	require.NoError(t, err)
+	assert.Equal(t, "192.0.2.1", dst)
+	assert.Equal(t, []system.TracerouteHop{
+		{Hop: 1, Host: "10.0.0.1", Loss: 0, Sent: 5, AvgRtt: 0.5, BestRtt: 0.4, WorstRtt: 0.7},
+		{Hop: 2, Loss: 100, Sent: 5},
+		{Hop: 3, Host: "192.0.2.1", Loss: 20, Sent: 5, AvgRtt: 9.0, BestRtt: 8.8, WorstRtt: 9.3},
+	}, hops)
+	assert.True(t, reachedDestination(hops, dst))
+
+	_, _, err = parseMtrOutput([]byte("mtr: Failure to open IPv4 sockets"))
+	assert.Error(t, err)
+	_, _, err = parseMtrOutput([]byte(`{"report":{"mtr":{"dst":"192.0.2.1"},"hubs":[]}}`))
+	assert.Error(t, err)
+}
+
+func TestParseTracerouteOutput(t *testing.T) {
+	output := `traceroute to example.com (192.0.2.1), 30 hops max, 60 byte packets
+ 1  10.0.0.1  0.512 ms  0.470 ms  0.455 ms
+ 2  * * *
+ 3  10.0.1.1  5.000 ms 10.0.1.2  7.000 ms *
+ 4  192.0.2.1  9.000 ms !H  9.000 ms  9.000 ms
+`
+	dst, hops := parseTracerouteOutput(output)
+	assert.Equal(t, "192.0.2.1", dst)
+	require.Len(t, hops, 4)
+
+	assert.Equal(t, "10.0.0.1", hops[0].Host)
+	assert.Equal(t, 3, hops[0].Sent)
+	assert.Zero(t, hops[0].Loss)
+	assert.InDelta(t, 0.479, hops[0].AvgRtt, 0.001)
+	assert.Equal(t, 0.455, hops[0].BestRtt)
+	assert.Equal(t, 0.512, hops[0].WorstRtt)
+
+	assert.Equal(t, system.TracerouteHop{Hop: 2, Loss: 100, Sent: 3}, hops[1])
+
+	// the first replying router is the hop's host when the probes took different paths
+	assert.Equal(t, "10.0.1.1", hops[2].Host)
+	assert.InDelta(t, 33.333, hops[2].Loss, 0.001)
+	assert.Equal(t, 6.0, hops[2].AvgRtt)
+
+	assert.Equal(t, system.TracerouteHop{Hop: 4, Host: "192.0.2.1", Sent: 3, AvgRtt: 9, BestRtt: 9, WorstRtt: 9}, hops[3])
+	assert.True(t, reachedDestination(hops, dst))
+}
+
+func TestReachedDestination(t *testing.T) {
+	hops := []system.TracerouteHop{{Hop: 1, Host: "10.0.0.1"}, {Hop: 2, Loss: 100, Sent: 3}}
+	assert.False(t, reachedDestination(hops, "192.0.2.1"))
+	assert.False(t, reachedDestination(nil, "192.0.2.1"))
+	assert.False(t, reachedDestination([]system.TracerouteHop{{Hop: 1, Host: "192.0.2.1"}}, ""))
+	assert.True(t, reachedDestination([]system.TracerouteHop{{Hop: 1, Host: "192.0.2.1", Sent: 3}}, "192.0.2.1"))
+}
+
+func TestTracerouteHostnameReachesDestination(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake mtr binaries are shell scripts")
+	}
+
+	// an mtr that reports its destination as given, like mtr does, and with -n only addresses
+	// as hops, the destination's address being the last one
+	dir := t.TempDir()
+	mtr := `#!/bin/sh
+for arg; do dst=$arg; done
+case "$dst" in *[!0-9a-f.:]*) last=192.0.2.1;; *) last=$dst;; esac
+echo "{\"report\":{\"mtr\":{\"dst\":\"$dst\"},\"hubs\":[{\"host\":\"10.0.0.1\",\"Loss%\":0,\"Snt\":3},{\"host\":\"$last\",\"Loss%\":0,\"Snt\":3}]}}"
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "mtr"), []byte(mtr), 0o755))
+	t.Setenv("PATH", dir)
+
+	tm, err := NewTracerouteManager()
+	require.NoError(t, err)
+	defer tm.Close()
+	tm.UpdateConfig([]system.TracerouteTarget{{Host: "localhost", Tool: tracerouteToolMtr}}, "")
+	tm.traceTarget(tm.targets["localhost"])
+
+	result := tm.GetResults()["localhost"]
+	require.NotNil(t, result)
+	assert.Equal(t, "success", result.Status, result.ErrorCode)
+	assert.Equal(t, "localhost", result.Host)
+	require.Len(t, result.Hops, 2)
+	assert.NotEqual(t, "192.0.2.1", result.Hops[1].Host, "mtr should trace the address of the host")
+}
+
+func TestConfigValidator_RejectsTracerouteTargets(t *testing.T) {
+	cv := NewConfigValidator(10, time.Hour, nil)
+
+	config := &system.MonitoringConfig{}
+	config.Enabled.Traceroute = true
+	config.Traceroute.Targets = []system.TracerouteTarget{{Host: "192.0.2.1"}, {Host: ""}, {Host: "-fexample.com"}}
+	assert.Error(t, cv.ValidateConfig(config))
+
+	ack := cv.RejectInvalidTargets(config)
+	assert.Equal(t, 1, ack.Applied)
+	assert.Equal(t, []common.RejectedTarget{
+		{Service: common.ServiceTraceroute, Target: "", Reason: "missing traceroute host"},
+		{Service: common.ServiceTraceroute, Target: "-fexample.com", Reason: "invalid traceroute host: -fexample.com"},
+	}, ack.Rejected)
+	assert.Equal(t, []system.TracerouteTarget{{Host: "192.0.2.1"}}, config.Traceroute.Targets)
+	assert.NoError(t, cv.ValidateConfig(config))
+}
+
+func TestTracerouteUpdateConfigDefaults(t *testing.T) {
+	tm, err := NewTracerouteManager()
+	require.NoError(t, err)
+	defer tm.Close()
+
+	tm.UpdateConfig([]system.TracerouteTarget{
+		{Host: "192.0.2.1"},
+		{Host: "192.0.2.2", Count: 10, MaxHops: 200, Timeout: 1 * time.Second, Tool: "ping"},
+	}, "*/5 * * * *")
+
+	first := tm.targets["192.0.2.1"]
+	require.NotNil(t, first)
+	assert.Equal(t, defaultTracerouteCount, first.Count)
+	assert.Equal(t, defaultTracerouteMaxHops, first.MaxHops)
+	assert.Equal(t, defaultTracerouteTimeout, first.Timeout)
+
+	second := tm.targets["192.0.2.2"]
+	require.NotNil(t, second)
+	assert.Equal(t, 10, second.Count)
+	assert.Equal(t, maxTracerouteMaxHops, second.MaxHops)
+	assert.Equal(t, time.Second, second.Timeout)
+	assert.Empty(t, second.Tool)
+
+	// results of removed targets are dropped
+	tm.updateResult("192.0.2.2", &system.TracerouteResult{Host: "192.0.2.2", Status: "success"})
+	tm.UpdateConfig([]system.TracerouteTarget{{Host: "192.0.2.1"}}, "*/5 * * * *")
+	assert.Nil(t, tm.GetResults())
+}
@@ -8,13 +8,12 @@ import (
 	"os/exec"
 )
 
-// Update updates beszel-agent to the latest version
-func Update() {
-	config := ghupdate.Config{
-		Repo:    "svenvg93/lightspeed", // Update this to your repository
-		Current: beszel.Version,
-		Filters: []string{"beszel-agent"},
-	}
+// Update updates beszel-agent to the latest version. Pre-releases are included if prerelease
+// is set or a channel is given, see ghupdate.Config.
+func Update(prerelease bool, channel string) {
+	config := updateConfig()
+	config.AllowPrerelease = prerelease
+	config.Channel = channel
 
 	ghupdate.PrintUpdateInfo("beszel-agent", beszel.Version, "")
 
@@ -52,17 +51,71 @@ func Update() {
 		os.Exit(1)
 	}
 
-	// Perform the update
-	err = ghupdate.UpdateBinary(asset, binaryPath)
+	// Perform the update, verifying the download against the release's checksum
+	err = ghupdate.UpdateBinary(asset, release.FindChecksum(asset), binaryPath)
 	if err != nil {
 		fmt.Printf("Please try rerunning with sudo. Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Set ownership to beszel:beszel if possible (similar to original beszel implementation)
+	setBinaryOwner(binaryPath)
+
+	ghupdate.PrintUpdateSuccess(latestVersion.String(), release.Body)
+}
+
+// updateConfig returns the release configuration of the agent's binaries
+func updateConfig() ghupdate.Config {
+	return ghupdate.Config{
+		Repo:    "svenvg93/lightspeed", // Update this to your repository
+		Current: beszel.Version,
+		Filters: []string{"beszel-agent"},
+	}
+}
+
+// setBinaryOwner sets the ownership of the binary to beszel:beszel if possible (similar to original beszel implementation)
+func setBinaryOwner(binaryPath string) {
 	if chownPath, err := exec.LookPath("chown"); err == nil {
 		exec.Command(chownPath, "beszel:beszel", binaryPath).Run()
 	}
+}
 
-	ghupdate.PrintUpdateSuccess(latestVersion.String(), release.Body)
+// selfUpdate replaces the running binary with the release of version, or with the latest
+// stable release if version is empty. It returns the installed version, which is empty if
+// the agent already runs it. A variable so tests can replace it.
+var selfUpdate = func(version string) (string, error) {
+	config := updateConfig()
+	var release *ghupdate.Release
+	if version == "" {
+		latest, hasUpdate, err := ghupdate.CheckForUpdate(config)
+		if err != nil || !hasUpdate {
+			return "", err
+		}
+		release = latest
+	} else {
+		var err error
+		if release, err = ghupdate.GetRelease(config.Repo, version); err != nil {
+			return "", err
+		}
+	}
+	releaseVersion, err := release.Version()
+	if err != nil {
+		return "", fmt.Errorf("invalid release version: %w", err)
+	}
+	if releaseVersion.String() == beszel.Version {
+		return "", nil
+	}
+
+	asset := release.FindAsset(config.Filters)
+	if asset == nil {
+		return "", fmt.Errorf("release %s has no binary for this platform", releaseVersion)
+	}
+	binaryPath, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if err := ghupdate.UpdateBinary(asset, release.FindChecksum(asset), binaryPath); err != nil {
+		return "", err
+	}
+	setBinaryOwner(binaryPath)
+	return releaseVersion.String(), nil
 }
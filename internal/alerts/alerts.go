@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/mail"
 	"net/url"
+	"os"
 	"sync"
 	"time"
 
@@ -24,19 +25,37 @@ type AlertManager struct {
 	alertQueue    chan alertTask
 	stopChan      chan struct{}
 	pendingAlerts sync.Map
+	syslog        *syslogSink   // Optional syslog sink, nil if BESZEL_SYSLOG_ADDR is not set
+	dedupWindow   time.Duration // Alerts with the same key within this window update the previous notification, 0 disables
+	sentMessages  sync.Map      // Editable notifications by alert key and notification URL
+	digest        *alertDigest  // Collects triggered alerts into periodic summaries, nil sends them immediately
+	downSince     sync.Map      // Time each down system went down by system id, for the downtime in recovery alerts
 }
 
 type AlertMessageData struct {
 	UserID   string
+	Type     string // Alert name like "PingLatency" users can turn off, empty sends it to every user
 	Title    string
 	Message  string
 	Link     string
 	LinkText string
+	Severity Severity     // Used for syslog, defaults to warning
+	Resolved bool         // Whether the alert reports a recovery
+	Key      string       // Identifies the alert so repeated notifications can update the previous one, empty disables
+	System   string       // Name of the system the alert is about, used to group digests
+	Metric   *AlertMetric // Value that triggered the alert, nil if the alert has none
 }
 
 type UserNotificationSettings struct {
-	Emails   []string `json:"emails"`
-	Webhooks []string `json:"webhooks"`
+	Emails   []string                    `json:"emails"`
+	Webhooks []string                    `json:"webhooks"`
+	Channels []NotificationChannelConfig `json:"channels"` // Chat services alerts are pushed to
+	// Webhook receiving triggered and resolved alerts as JSON, bypassing digests but not the preferences below
+	AlertWebhook AlertWebhookSettings `json:"alert_webhook"`
+	// Alert types the user gets notified of by name, false turns a type off and missing types are sent
+	Alerts map[string]bool `json:"alerts"`
+	// Time range without notifications, nil if the user gets them at any time
+	QuietHours *QuietHours `json:"quietHours"`
 }
 
 type SystemAlertData struct {
@@ -51,7 +70,10 @@ type SystemAlertData struct {
 	count        uint8
 	min          uint8
 	mapSums      map[string]float32
-	descriptor   string // override descriptor in notification body (for temp sensor, disk partition, etc)
+	descriptor   string  // override descriptor in notification body (for temp sensor, disk partition, etc)
+	details      string  // extra context for the notification body, like the offending values
+	aggregation  string  // "max" or "any" if the alert was evaluated per target, empty for averages
+	plan         float64 // Plan speed in Mbps a speedtest value is a percentage of, zero for absolute values
 }
 
 // notification services that support title param
@@ -80,8 +102,26 @@ func NewAlertManager(app hubLike) *AlertManager {
 		alertQueue: make(chan alertTask),
 		stopChan:   make(chan struct{}),
 	}
+	syslog, err := newSyslogSinkFromEnv()
+	if err != nil {
+		app.Logger().Error("Invalid syslog configuration", "err", err)
+	}
+	am.syslog = syslog
+	dedupWindow, err := newDedupWindowFromEnv()
+	if err != nil {
+		app.Logger().Error("Invalid alert deduplication configuration", "err", err)
+	}
+	am.dedupWindow = dedupWindow
+	digest, err := newAlertDigestFromEnv()
+	if err != nil {
+		app.Logger().Error("Invalid alert digest configuration", "err", err)
+	}
+	am.digest = digest
 	am.bindEvents()
 	go am.startWorker()
+	if am.digest != nil {
+		go am.startDigest()
+	}
 	return am
 }
 
@@ -89,6 +129,10 @@ func NewAlertManager(app hubLike) *AlertManager {
 func (am *AlertManager) bindEvents() {
 	am.hub.OnRecordAfterUpdateSuccess("alerts").BindFunc(updateHistoryOnAlertUpdate)
 	am.hub.OnRecordAfterDeleteSuccess("alerts").BindFunc(resolveHistoryOnAlertDelete)
+	am.hub.OnRecordAfterUpdateSuccess("systems").BindFunc(am.recordStatusHistory)
+	if am.syslog != nil && os.Getenv("BESZEL_SYSLOG_STATUS_CHANGES") == "true" {
+		am.hub.OnRecordAfterUpdateSuccess("systems").BindFunc(am.sendStatusChangeToSyslog)
+	}
 }
 
 // SendAlert sends an alert to all users with notification settings
@@ -96,6 +140,39 @@ func (am *AlertManager) SendAlert(data AlertMessageData) error {
 	// Debug logging
 	am.hub.Logger().Info("SendAlert called", "title", data.Title)
 
+	// syslog receives every alert regardless of user settings
+	if am.syslog != nil {
+		if err := am.syslog.Send(data); err != nil {
+			am.hub.Logger().Error("Failed to send syslog alert", "err", err)
+		}
+	}
+
+	// alert webhooks receive every alert as it happens
+	am.sendAlertWebhooks(data)
+
+	// in digest mode triggered alerts wait for the next summary
+	if am.digest != nil {
+		if !data.Resolved {
+			am.digest.add(data)
+			return nil
+		}
+		if am.digest.resolve(data.Key) {
+			return nil
+		}
+	}
+
+	return am.notifyUsers(data)
+}
+
+// notifyUsers sends an alert to the webhooks and email addresses of all users whose
+// notification preferences allow it
+func (am *AlertManager) notifyUsers(data AlertMessageData) error {
+	return am.notifyEachUser(func(UserNotificationSettings) (AlertMessageData, bool) { return data, true })
+}
+
+// notifyEachUser sends each user the alert message returns for their settings, like notifyUsers.
+// Users for whom message returns false aren't notified.
+func (am *AlertManager) notifyEachUser(message func(UserNotificationSettings) (AlertMessageData, bool)) error {
 	// get all user settings
 	records, err := am.hub.FindAllRecords("user_settings", nil)
 	if err != nil {
@@ -119,17 +196,42 @@ func (am *AlertManager) SendAlert(data AlertMessageData) error {
 			am.hub.Logger().Error("Failed to unmarshal user settings", "err", err)
 			continue
 		}
+		data, ok := message(userAlertSettings)
+		if !ok {
+			continue
+		}
+
+		// the alert's state is already saved, the user just doesn't get notified
+		reason, err := userAlertSettings.holdBackReason(data, time.Now())
+		if err != nil {
+			am.hub.Logger().Error("Invalid notification preferences", "userID", record.GetString("user"), "err", err)
+		}
+		if reason != "" {
+			am.hub.Logger().Info("Alert notification held back by user preferences", "userID", record.GetString("user"), "type", data.Type, "reason", reason)
+			continue
+		}
 
 		// Debug logging
 		am.hub.Logger().Info("User notification settings", "userID", record.GetString("user"), "emails", userAlertSettings.Emails, "webhooks", userAlertSettings.Webhooks)
 
 		// send alerts via webhooks
 		for _, webhook := range userAlertSettings.Webhooks {
-			if err := am.SendShoutrrrAlert(webhook, data.Title, data.Message, data.Link, data.LinkText); err != nil {
+			if err := am.sendWebhookAlert(webhook, data); err != nil {
 				am.hub.Logger().Error("Failed to send shoutrrr alert", "err", err)
 			}
 		}
 
+		// send alerts to chat channels
+		for _, config := range userAlertSettings.Channels {
+			channel, err := newNotificationChannel(config)
+			if err == nil {
+				err = channel.Send(data)
+			}
+			if err != nil {
+				am.hub.Logger().Error("Failed to send channel alert", "type", config.Type, "err", err)
+			}
+		}
+
 		// send alerts via email
 		if len(userAlertSettings.Emails) > 0 {
 			addresses := []mail.Address{}
@@ -0,0 +1,169 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// telegramAPIURL is the Telegram Bot API, a variable so tests can point it to a fake server
+var telegramAPIURL = "https://api.telegram.org"
+
+// channelAttempts is how often a channel request is sent when the service answers with a 5xx status
+const channelAttempts = 3
+
+// channelRetryDelay is the wait before retrying a channel request, doubling for each further attempt
+var channelRetryDelay = time.Second
+
+// Discord embed colors of triggered and resolved alerts
+const (
+	discordColorTriggered = 0xe5484d
+	discordColorResolved  = 0x30a46c
+)
+
+// NotificationChannel delivers alerts to a chat service
+type NotificationChannel interface {
+	Send(data AlertMessageData) error
+}
+
+// NotificationChannelConfig configures a notification channel in the user settings
+type NotificationChannelConfig struct {
+	Type       string `json:"type"`                  // "discord", "slack" or "telegram"
+	WebhookURL string `json:"webhook_url,omitempty"` // Discord and Slack webhook
+	BotToken   string `json:"bot_token,omitempty"`   // Telegram bot
+	ChatID     string `json:"chat_id,omitempty"`     // Telegram chat the bot posts to
+}
+
+// newNotificationChannel returns the channel described by a configuration
+func newNotificationChannel(config NotificationChannelConfig) (NotificationChannel, error) {
+	switch config.Type {
+	case "discord", "slack":
+		if config.WebhookURL == "" {
+			return nil, fmt.Errorf("%s channel has no webhook URL", config.Type)
+		}
+		if config.Type == "discord" {
+			return &discordChannel{webhookURL: config.WebhookURL}, nil
+		}
+		return &slackChannel{webhookURL: config.WebhookURL}, nil
+	case "telegram":
+		if config.BotToken == "" || config.ChatID == "" {
+			return nil, fmt.Errorf("telegram channel needs a bot token and chat id")
+		}
+		return &telegramChannel{botToken: config.BotToken, chatID: config.ChatID}, nil
+	default:
+		return nil, fmt.Errorf("unknown notification channel type: %q", config.Type)
+	}
+}
+
+// discordChannel posts alerts as embeds to a Discord webhook
+type discordChannel struct {
+	webhookURL string
+}
+
+func (c *discordChannel) Send(data AlertMessageData) error {
+	color := discordColorTriggered
+	if data.Resolved {
+		color = discordColorResolved
+	}
+	embed := map[string]any{
+		"title":       data.Title,
+		"description": data.Message,
+		"color":       color,
+		"timestamp":   time.Now().UTC().Format(time.RFC3339),
+	}
+	if data.Link != "" {
+		embed["url"] = data.Link
+	}
+	return postChannelJSON(c.webhookURL, map[string]any{"embeds": []map[string]any{embed}})
+}
+
+// slackChannel posts alerts to a Slack incoming webhook
+type slackChannel struct {
+	webhookURL string
+}
+
+func (c *slackChannel) Send(data AlertMessageData) error {
+	text := fmt.Sprintf("*%s*\n%s", data.Title, data.Message)
+	if data.Link != "" {
+		text += fmt.Sprintf("\n<%s|%s>", data.Link, linkText(data))
+	}
+	return postChannelJSON(c.webhookURL, map[string]any{"text": text})
+}
+
+// telegramChannel sends alerts to a Telegram chat through a bot
+type telegramChannel struct {
+	botToken string
+	chatID   string
+}
+
+func (c *telegramChannel) Send(data AlertMessageData) error {
+	text := data.Title + "\n\n" + data.Message
+	if data.Link != "" {
+		text += "\n\n" + data.Link
+	}
+	return postChannelJSON(fmt.Sprintf("%s/bot%s/sendMessage", telegramAPIURL, url.PathEscape(c.botToken)), map[string]any{
+		"chat_id":                  c.chatID,
+		"text":                     text,
+		"disable_web_page_preview": true,
+	})
+}
+
+// linkText returns the text shown for the alert's link
+func linkText(data AlertMessageData) string {
+	if data.LinkText != "" {
+		return data.LinkText
+	}
+	return data.Link
+}
+
+// postChannelJSON posts payload as JSON to a channel's endpoint
+func postChannelJSON(endpoint string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return postChannel(endpoint, body)
+}
+
+// postChannel posts a JSON body to a channel's endpoint, retrying when the service answers
+// with a 5xx status. All attempts together are limited to webhookTimeout.
+func postChannel(endpoint string, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			// the endpoint contains credentials, keep it out of the logs
+			if urlErr, ok := err.(*url.Error); ok {
+				return urlErr.Err
+			}
+			return err
+		}
+		io.Copy(io.Discard, io.LimitReader(res.Body, 1<<20))
+		res.Body.Close()
+
+		switch {
+		case res.StatusCode >= 200 && res.StatusCode <= 299:
+			return nil
+		case res.StatusCode >= 500 && attempt < channelAttempts:
+			select {
+			case <-time.After(channelRetryDelay << (attempt - 1)):
+			case <-ctx.Done():
+				return fmt.Errorf("channel returned %d: %w", res.StatusCode, ctx.Err())
+			}
+		default:
+			return fmt.Errorf("channel returned %d", res.StatusCode)
+		}
+	}
+}
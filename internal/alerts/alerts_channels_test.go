@@ -0,0 +1,191 @@
+package alerts
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeChannel records the JSON payloads posted to it, failing the first failures requests with status
+type fakeChannel struct {
+	sync.Mutex
+	paths    []string
+	payloads []map[string]any
+	failures int
+	status   int
+}
+
+func (f *fakeChannel) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	var payload map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.paths = append(f.paths, r.URL.Path)
+	f.payloads = append(f.payloads, payload)
+	if len(f.payloads) <= f.failures {
+		w.WriteHeader(f.status)
+	}
+}
+
+func newFakeChannel(t *testing.T) (*fakeChannel, string) {
+	fake := &fakeChannel{}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server.URL
+}
+
+func TestNewNotificationChannel(t *testing.T) {
+	channel, err := newNotificationChannel(NotificationChannelConfig{Type: "discord", WebhookURL: "https://example.com"})
+	require.NoError(t, err)
+	assert.IsType(t, &discordChannel{}, channel)
+
+	channel, err = newNotificationChannel(NotificationChannelConfig{Type: "slack", WebhookURL: "https://example.com"})
+	require.NoError(t, err)
+	assert.IsType(t, &slackChannel{}, channel)
+
+	channel, err = newNotificationChannel(NotificationChannelConfig{Type: "telegram", BotToken: "123:abc", ChatID: "42"})
+	require.NoError(t, err)
+	assert.IsType(t, &telegramChannel{}, channel)
+
+	_, err = newNotificationChannel(NotificationChannelConfig{Type: "slack"})
+	assert.ErrorContains(t, err, "no webhook URL")
+	_, err = newNotificationChannel(NotificationChannelConfig{Type: "telegram", BotToken: "123:abc"})
+	assert.ErrorContains(t, err, "bot token and chat id")
+	_, err = newNotificationChannel(NotificationChannelConfig{Type: "irc"})
+	assert.ErrorContains(t, err, "unknown notification channel type")
+}
+
+func TestNotificationChannels(t *testing.T) {
+	data := AlertMessageData{
+		Title:    "web-1 CPU above threshold",
+		Message:  "CPU averaged 95% for the previous 5 minutes.",
+		Link:     "https://beszel.example.com/system/web-1",
+		LinkText: "View web-1",
+	}
+
+	t.Run("discord", func(t *testing.T) {
+		fake, url := newFakeChannel(t)
+		require.NoError(t, (&discordChannel{webhookURL: url + "/api/webhooks/1/token"}).Send(data))
+
+		require.Len(t, fake.payloads, 1)
+		embeds := fake.payloads[0]["embeds"].([]any)
+		require.Len(t, embeds, 1)
+		embed := embeds[0].(map[string]any)
+		assert.Equal(t, data.Title, embed["title"])
+		assert.Equal(t, data.Message, embed["description"])
+		assert.Equal(t, data.Link, embed["url"])
+		assert.EqualValues(t, discordColorTriggered, embed["color"])
+
+		resolved := data
+		resolved.Resolved = true
+		require.NoError(t, (&discordChannel{webhookURL: url}).Send(resolved))
+		assert.EqualValues(t, discordColorResolved, fake.payloads[1]["embeds"].([]any)[0].(map[string]any)["color"])
+	})
+
+	t.Run("slack", func(t *testing.T) {
+		fake, url := newFakeChannel(t)
+		require.NoError(t, (&slackChannel{webhookURL: url}).Send(data))
+
+		require.Len(t, fake.payloads, 1)
+		assert.Equal(t, "*web-1 CPU above threshold*\nCPU averaged 95% for the previous 5 minutes.\n<https://beszel.example.com/system/web-1|View web-1>", fake.payloads[0]["text"])
+	})
+
+	t.Run("telegram", func(t *testing.T) {
+		fake, url := newFakeChannel(t)
+		originalURL := telegramAPIURL
+		telegramAPIURL = url
+		t.Cleanup(func() { telegramAPIURL = originalURL })
+
+		require.NoError(t, (&telegramChannel{botToken: "123:abc", chatID: "-1001"}).Send(data))
+
+		require.Len(t, fake.payloads, 1)
+		assert.Equal(t, "/bot123:abc/sendMessage", fake.paths[0])
+		assert.Equal(t, "-1001", fake.payloads[0]["chat_id"])
+		assert.Equal(t, data.Title+"\n\n"+data.Message+"\n\n"+data.Link, fake.payloads[0]["text"])
+	})
+}
+
+func TestPostChannelJSONRetries(t *testing.T) {
+	originalDelay := channelRetryDelay
+	channelRetryDelay = time.Millisecond
+	t.Cleanup(func() { channelRetryDelay = originalDelay })
+
+	// server errors are retried
+	fake, url := newFakeChannel(t)
+	fake.failures, fake.status = 2, http.StatusBadGateway
+	require.NoError(t, postChannelJSON(url, map[string]any{"text": "hi"}))
+	assert.Len(t, fake.payloads, 3)
+
+	// until the attempts run out
+	fake, url = newFakeChannel(t)
+	fake.failures, fake.status = channelAttempts, http.StatusServiceUnavailable
+	assert.ErrorContains(t, postChannelJSON(url, map[string]any{"text": "hi"}), "channel returned 503")
+	assert.Len(t, fake.payloads, channelAttempts)
+
+	// client errors aren't retried
+	fake, url = newFakeChannel(t)
+	fake.failures, fake.status = 1, http.StatusNotFound
+	assert.ErrorContains(t, postChannelJSON(url, map[string]any{"text": "hi"}), "channel returned 404")
+	assert.Len(t, fake.payloads, 1)
+}
+
+func TestAlertWebhook(t *testing.T) {
+	data := AlertMessageData{
+		Title:   `web-1 "prod" CPU above threshold`,
+		Message: "CPU averaged 95% for the previous 5 minutes.",
+		Link:    "https://beszel.example.com/system/web-1",
+		System:  `web-1 "prod"`,
+		Metric:  &AlertMetric{Name: "CPU", Value: 95, Threshold: 80, Unit: "%"},
+	}
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("default template", func(t *testing.T) {
+		body, err := renderAlertWebhook("", newAlertWebhookEvent(data, now))
+		require.NoError(t, err)
+
+		fake, url := newFakeChannel(t)
+		require.NoError(t, postChannel(url, body))
+		require.Len(t, fake.payloads, 1)
+		payload := fake.payloads[0]
+		assert.Equal(t, data.System, payload["system"])
+		assert.Equal(t, "CPU", payload["metric"])
+		assert.EqualValues(t, 95, payload["value"])
+		assert.EqualValues(t, 80, payload["threshold"])
+		assert.Equal(t, true, payload["triggered"])
+		assert.Equal(t, "2025-01-02T03:04:05Z", payload["timestamp"])
+		assert.Equal(t, data.Link, payload["link"])
+	})
+
+	t.Run("resolved status alert", func(t *testing.T) {
+		resolved := data
+		resolved.Metric, resolved.Resolved = nil, true
+		body, err := renderAlertWebhook("", newAlertWebhookEvent(resolved, now))
+		require.NoError(t, err)
+		var payload map[string]any
+		require.NoError(t, json.Unmarshal(body, &payload))
+		assert.Equal(t, "Status", payload["metric"])
+		assert.Equal(t, false, payload["triggered"])
+	})
+
+	t.Run("custom template", func(t *testing.T) {
+		body, err := renderAlertWebhook(`{"text": {{json .Title}}, "severity": "{{if .Triggered}}critical{{else}}ok{{end}}"}`, newAlertWebhookEvent(data, now))
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"text": "web-1 \"prod\" CPU above threshold", "severity": "critical"}`, string(body))
+	})
+
+	t.Run("invalid templates", func(t *testing.T) {
+		_, err := renderAlertWebhook(`{"system": {{json .System}`, newAlertWebhookEvent(data, now))
+		assert.Error(t, err)
+		_, err = renderAlertWebhook(`{"system": "{{.System}}"}`, newAlertWebhookEvent(data, now))
+		assert.ErrorContains(t, err, "valid JSON")
+	})
+}
@@ -0,0 +1,107 @@
+//go:build testing
+// +build testing
+
+package alerts_test
+
+import (
+	"beszel/internal/entities/system"
+	"beszel/internal/tests"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlertCooldown(t *testing.T) {
+	// receive alert messages through the syslog sink
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	t.Setenv("BESZEL_SYSLOG_ADDR", "udp://"+listener.LocalAddr().String())
+
+	hub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer hub.Cleanup()
+
+	user, err := tests.CreateUser(hub, "test@test.com", "testtesttest")
+	require.NoError(t, err)
+	systemRecord, err := tests.CreateRecord(hub, "systems", map[string]any{
+		"name":  "ping-system",
+		"host":  "localhost",
+		"port":  "45876",
+		"users": []string{user.Id},
+	})
+	require.NoError(t, err)
+
+	alert, err := tests.CreateRecord(hub, "alerts", map[string]any{
+		"name":     "PingLatency",
+		"system":   systemRecord.Id,
+		"user":     user.Id,
+		"value":    100,
+		"min":      1,
+		"cooldown": 60,
+	})
+	require.NoError(t, err)
+
+	pingData := func(latency float64) *system.CombinedData {
+		return &system.CombinedData{Stats: system.Stats{PingResults: map[string]*system.PingResult{
+			"1.1.1.1": {Host: "1.1.1.1", AvgRtt: latency, LastChecked: time.Now()},
+		}}}
+	}
+	readMessage := func(timeout time.Duration) (string, error) {
+		buf := make([]byte, 4096)
+		require.NoError(t, listener.SetReadDeadline(time.Now().Add(timeout)))
+		n, _, err := listener.ReadFrom(buf)
+		return string(buf[:n]), err
+	}
+	current := func() *core.Record {
+		record, err := hub.FindRecordById("alerts", alert.Id)
+		require.NoError(t, err)
+		return record
+	}
+	triggered := func() bool { return current().GetBool("triggered") }
+
+	// the first trigger notifies and starts the cooldown
+	require.NoError(t, hub.HandleSystemAlerts(systemRecord, pingData(150)))
+	message, err := readMessage(5 * time.Second)
+	require.NoError(t, err)
+	assert.Contains(t, message, "ping-system pinglatency above threshold")
+	assert.Eventually(t, triggered, time.Second, 10*time.Millisecond)
+	lastNotified := current().GetDateTime("last_notified")
+	assert.False(t, lastNotified.IsZero())
+
+	// resolving the notified trigger notifies, but doesn't reset the cooldown
+	require.NoError(t, hub.HandleSystemAlerts(systemRecord, pingData(50)))
+	message, err = readMessage(5 * time.Second)
+	require.NoError(t, err)
+	assert.Contains(t, message, "ping-system pinglatency below threshold")
+	assert.Eventually(t, func() bool { return !triggered() }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, lastNotified, current().GetDateTime("last_notified"))
+
+	// a flapping alert within the cooldown holds back its triggers and their resolves,
+	// but still updates the record
+	for range 3 {
+		require.NoError(t, hub.HandleSystemAlerts(systemRecord, pingData(150)))
+		_, err = readMessage(200 * time.Millisecond)
+		assert.Error(t, err, "repeated trigger should not notify")
+		assert.Eventually(t, triggered, time.Second, 10*time.Millisecond)
+
+		require.NoError(t, hub.HandleSystemAlerts(systemRecord, pingData(50)))
+		_, err = readMessage(200 * time.Millisecond)
+		assert.Error(t, err, "resolve of a held back trigger should not notify")
+		assert.Eventually(t, func() bool { return !triggered() }, time.Second, 10*time.Millisecond)
+		assert.Equal(t, lastNotified, current().GetDateTime("last_notified"))
+	}
+
+	// once the cooldown passed the next trigger notifies again
+	record := current()
+	record.Set("last_notified", time.Now().Add(-2*time.Hour))
+	require.NoError(t, hub.Save(record))
+	require.NoError(t, hub.HandleSystemAlerts(systemRecord, pingData(150)))
+	message, err = readMessage(5 * time.Second)
+	require.NoError(t, err)
+	assert.Contains(t, message, "ping-system pinglatency above threshold")
+}
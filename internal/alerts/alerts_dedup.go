@@ -0,0 +1,160 @@
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// discordWebhooksURL is the Discord webhook API, a variable so tests can point it to a fake server
+var discordWebhooksURL = "https://discord.com/api/webhooks"
+
+// errEditNotSupported is returned for notification URLs whose messages can't be edited
+var errEditNotSupported = errors.New("notification service doesn't support editing messages")
+
+const webhookTimeout = 10 * time.Second
+
+// sentMessage is a notification that later alerts with the same key and state can update
+type sentMessage struct {
+	id       string    // Message id returned by the notification service
+	sent     time.Time // When the message was first posted
+	resolved bool      // Whether the message reports a recovery
+}
+
+// editableWebhook posts notifications that can be edited later
+type editableWebhook struct {
+	apiURL string // Webhook API URL including credentials
+}
+
+// newDedupWindowFromEnv reads BESZEL_ALERT_DEDUP_WINDOW, a duration like 1h in which
+// alerts with the same key update the previous notification. It returns 0 if not set.
+func newDedupWindowFromEnv() (time.Duration, error) {
+	value := os.Getenv("BESZEL_ALERT_DEDUP_WINDOW")
+	if value == "" {
+		return 0, nil
+	}
+	window, err := time.ParseDuration(value)
+	if err != nil || window < 0 {
+		return 0, fmt.Errorf("invalid alert dedup window: %s", value)
+	}
+	return window, nil
+}
+
+// newEditableWebhook returns the editable webhook for a notification URL.
+// Only Discord webhooks (discord://token@id) are supported.
+func newEditableWebhook(notificationURL string) (*editableWebhook, error) {
+	parsedURL, err := url.Parse(notificationURL)
+	if err != nil || parsedURL.Scheme != "discord" || parsedURL.Host == "" || parsedURL.User.Username() == "" {
+		return nil, errEditNotSupported
+	}
+	return &editableWebhook{
+		apiURL: fmt.Sprintf("%s/%s/%s", discordWebhooksURL, url.PathEscape(parsedURL.Host), url.PathEscape(parsedURL.User.Username())),
+	}, nil
+}
+
+// post sends a new message and returns its id
+func (w *editableWebhook) post(data AlertMessageData) (string, error) {
+	body, err := w.do(http.MethodPost, w.apiURL+"?wait=true", data)
+	if err != nil {
+		return "", err
+	}
+	var message struct {
+		Id string `json:"id"`
+	}
+	if err := json.Unmarshal(body, &message); err != nil || message.Id == "" {
+		return "", fmt.Errorf("webhook response has no message id")
+	}
+	return message.Id, nil
+}
+
+// edit replaces the content of a previously posted message
+func (w *editableWebhook) edit(messageID string, data AlertMessageData) error {
+	_, err := w.do(http.MethodPatch, w.apiURL+"/messages/"+url.PathEscape(messageID), data)
+	return err
+}
+
+func (w *editableWebhook) do(method, requestURL string, data AlertMessageData) ([]byte, error) {
+	description := data.Message
+	if data.Link != "" {
+		description += "\n\n" + data.Link
+	}
+	payload, err := json.Marshal(map[string]any{
+		"embeds": []map[string]any{{
+			"title":       data.Title,
+			"description": description,
+			"timestamp":   time.Now().UTC().Format(time.RFC3339),
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(method, requestURL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := &http.Client{Timeout: webhookTimeout}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("webhook returned %d", res.StatusCode)
+	}
+	return body, nil
+}
+
+// sendWebhookAlert sends an alert to a notification URL. If deduplication is enabled and a
+// message for the same alert key and state was posted within the window, that message is edited
+// instead, so a recovery or an alert triggering again after one is always a new message.
+// Services that don't support editing receive a new message through shoutrrr.
+func (am *AlertManager) sendWebhookAlert(notificationURL string, data AlertMessageData) error {
+	if am.dedupWindow <= 0 || data.Key == "" {
+		return am.SendShoutrrrAlert(notificationURL, data.Title, data.Message, data.Link, data.LinkText)
+	}
+	webhook, err := newEditableWebhook(notificationURL)
+	if err != nil {
+		return am.SendShoutrrrAlert(notificationURL, data.Title, data.Message, data.Link, data.LinkText)
+	}
+
+	am.pruneSentMessages()
+	messageKey := data.Key + "\x00" + notificationURL
+	if value, ok := am.sentMessages.Load(messageKey); ok {
+		previous := value.(sentMessage)
+		if time.Since(previous.sent) < am.dedupWindow && previous.resolved == data.Resolved {
+			if err := webhook.edit(previous.id, data); err == nil {
+				return nil
+			}
+			// the message may have been deleted, post a new one
+		}
+	}
+
+	messageID, err := webhook.post(data)
+	if err != nil {
+		return err
+	}
+	am.sentMessages.Store(messageKey, sentMessage{id: messageID, sent: time.Now(), resolved: data.Resolved})
+	return nil
+}
+
+// pruneSentMessages forgets the messages posted before the dedup window, they can't be edited anymore
+func (am *AlertManager) pruneSentMessages() {
+	am.sentMessages.Range(func(key, value any) bool {
+		if time.Since(value.(sentMessage).sent) >= am.dedupWindow {
+			am.sentMessages.Delete(key)
+		}
+		return true
+	})
+}
@@ -0,0 +1,169 @@
+package alerts
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDiscord records webhook requests and answers like the Discord API
+type fakeDiscord struct {
+	sync.Mutex
+	requests   []string
+	failEdits  bool
+	messageIDs int
+}
+
+func (f *fakeDiscord) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+
+	var payload struct {
+		Embeds []struct {
+			Title string `json:"title"`
+		} `json:"embeds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || len(payload.Embeds) != 1 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Query().Get("wait") == "true":
+		f.messageIDs++
+		fmt.Fprintf(w, `{"id":"msg%d"}`, f.messageIDs)
+	case r.Method == http.MethodPatch && !f.failEdits:
+		w.Write([]byte(`{}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newFakeDiscord(t *testing.T) *fakeDiscord {
+	fake := &fakeDiscord{}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	originalURL := discordWebhooksURL
+	discordWebhooksURL = server.URL
+	t.Cleanup(func() { discordWebhooksURL = originalURL })
+	return fake
+}
+
+func TestSendWebhookAlertEditsOnRetrigger(t *testing.T) {
+	fake := newFakeDiscord(t)
+	am := &AlertManager{dedupWindow: time.Hour}
+	data := AlertMessageData{Title: "Ping above threshold", Message: "Average RTT is 120 ms", Key: "alert1"}
+
+	require.NoError(t, am.sendWebhookAlert("discord://token@12345", data))
+	require.NoError(t, am.sendWebhookAlert("discord://token@12345", data))
+
+	assert.Equal(t, []string{
+		"POST /12345/token",
+		"PATCH /12345/token/messages/msg1",
+	}, fake.requests)
+
+	// a different alert gets its own message
+	data.Key = "alert2"
+	require.NoError(t, am.sendWebhookAlert("discord://token@12345", data))
+	assert.Equal(t, "POST /12345/token", fake.requests[2])
+}
+
+func TestSendWebhookAlertNewMessageAfterWindow(t *testing.T) {
+	fake := newFakeDiscord(t)
+	am := &AlertManager{dedupWindow: time.Hour}
+	data := AlertMessageData{Title: "Ping above threshold", Key: "alert1"}
+
+	require.NoError(t, am.sendWebhookAlert("discord://token@12345", data))
+	am.sentMessages.Store("alert1\x00discord://token@12345", sentMessage{id: "msg1", sent: time.Now().Add(-2 * time.Hour)})
+	require.NoError(t, am.sendWebhookAlert("discord://token@12345", data))
+
+	assert.Equal(t, []string{"POST /12345/token", "POST /12345/token"}, fake.requests)
+}
+
+func TestSendWebhookAlertNewMessageOnStateChange(t *testing.T) {
+	fake := newFakeDiscord(t)
+	am := &AlertManager{dedupWindow: time.Hour}
+	data := AlertMessageData{Title: "Ping above threshold", Key: "alert1"}
+
+	// triggered, triggered again, resolved, resolved again, then triggered after the recovery
+	for _, resolved := range []bool{false, false, true, true, false} {
+		data.Resolved = resolved
+		require.NoError(t, am.sendWebhookAlert("discord://token@12345", data))
+	}
+
+	assert.Equal(t, []string{
+		"POST /12345/token",
+		"PATCH /12345/token/messages/msg1",
+		"POST /12345/token",
+		"PATCH /12345/token/messages/msg2",
+		"POST /12345/token",
+	}, fake.requests)
+}
+
+func TestSendWebhookAlertPrunesOldMessages(t *testing.T) {
+	newFakeDiscord(t)
+	am := &AlertManager{dedupWindow: time.Hour}
+	am.sentMessages.Store("old\x00discord://token@12345", sentMessage{id: "msg1", sent: time.Now().Add(-2 * time.Hour)})
+
+	require.NoError(t, am.sendWebhookAlert("discord://token@12345", AlertMessageData{Title: "Ping above threshold", Key: "alert1"}))
+
+	_, ok := am.sentMessages.Load("old\x00discord://token@12345")
+	assert.False(t, ok, "messages older than the window should be forgotten")
+	_, ok = am.sentMessages.Load("alert1\x00discord://token@12345")
+	assert.True(t, ok)
+}
+
+func TestSendWebhookAlertFallsBackWhenEditFails(t *testing.T) {
+	fake := newFakeDiscord(t)
+	fake.failEdits = true
+	am := &AlertManager{dedupWindow: time.Hour}
+	data := AlertMessageData{Title: "Ping above threshold", Key: "alert1"}
+
+	require.NoError(t, am.sendWebhookAlert("discord://token@12345", data))
+	require.NoError(t, am.sendWebhookAlert("discord://token@12345", data))
+	require.NoError(t, am.sendWebhookAlert("discord://token@12345", data))
+
+	assert.Equal(t, []string{
+		"POST /12345/token",
+		"PATCH /12345/token/messages/msg1",
+		"POST /12345/token",
+		"PATCH /12345/token/messages/msg2",
+		"POST /12345/token",
+	}, fake.requests)
+}
+
+func TestNewEditableWebhook(t *testing.T) {
+	_, err := newEditableWebhook("slack://token@channel")
+	assert.ErrorIs(t, err, errEditNotSupported)
+	_, err = newEditableWebhook("discord://12345")
+	assert.ErrorIs(t, err, errEditNotSupported)
+
+	webhook, err := newEditableWebhook("discord://token@12345")
+	require.NoError(t, err)
+	assert.Equal(t, discordWebhooksURL+"/12345/token", webhook.apiURL)
+}
+
+func TestDedupWindowFromEnv(t *testing.T) {
+	t.Setenv("BESZEL_ALERT_DEDUP_WINDOW", "")
+	window, err := newDedupWindowFromEnv()
+	require.NoError(t, err)
+	assert.Zero(t, window)
+
+	t.Setenv("BESZEL_ALERT_DEDUP_WINDOW", "30m")
+	window, err = newDedupWindowFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Minute, window)
+
+	t.Setenv("BESZEL_ALERT_DEDUP_WINDOW", "soon")
+	_, err = newDedupWindowFromEnv()
+	assert.Error(t, err)
+}
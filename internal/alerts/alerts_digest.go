@@ -0,0 +1,248 @@
+package alerts
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// digestTemplate renders the digest body, grouped by severity and then by system
+var digestTemplate = template.Must(template.New("digest").Funcs(template.FuncMap{
+	"upper": func(s Severity) string { return strings.ToUpper(string(s)) },
+	"plural": func(count int, word string) string {
+		if count == 1 {
+			return fmt.Sprintf("%d %s", count, word)
+		}
+		return fmt.Sprintf("%d %ss", count, word)
+	},
+}).Parse(`{{range $i, $group := .Severities}}{{if $i}}
+{{end}}{{upper $group.Severity}} ({{plural $group.Count "alert"}})
+{{range $group.Systems}}  {{.Name}}
+{{range .Metrics}}    {{.Name}}: {{plural .Count "alert"}}{{if .HasValue}}, worst {{printf "%.2f" .Worst}}{{.Unit}}{{end}}
+{{end}}{{end}}{{end}}`))
+
+// AlertMetric is the measured value that triggered an alert
+type AlertMetric struct {
+	Name         string
+	Value        float64
+	Unit         string  // Appended to the value, e.g. " ms" or "%"
+	LowerIsWorse bool    // Whether lower values are worse, e.g. for speeds
+	Threshold    float64 // Value the alert triggers at
+}
+
+// alertDigest collects triggered alerts and sends them as one summary per interval
+type alertDigest struct {
+	sync.Mutex
+	interval time.Duration
+	alerts   []AlertMessageData
+}
+
+type digestSeverity struct {
+	Severity Severity
+	Count    int
+	Systems  []*digestSystem
+}
+
+type digestSystem struct {
+	Name    string
+	Metrics []*digestMetric
+}
+
+type digestMetric struct {
+	Name     string
+	Count    int
+	HasValue bool
+	Worst    float64
+	Unit     string
+}
+
+// newAlertDigestFromEnv reads BESZEL_ALERT_DIGEST_INTERVAL, a duration like 15m over which triggered
+// alerts are collected into a single notification. It returns nil if not set.
+func newAlertDigestFromEnv() (*alertDigest, error) {
+	value := os.Getenv("BESZEL_ALERT_DIGEST_INTERVAL")
+	if value == "" {
+		return nil, nil
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval <= 0 {
+		return nil, fmt.Errorf("invalid alert digest interval: %s", value)
+	}
+	return &alertDigest{interval: interval}, nil
+}
+
+// add queues a triggered alert for the next digest
+func (d *alertDigest) add(data AlertMessageData) {
+	d.Lock()
+	defer d.Unlock()
+	d.alerts = append(d.alerts, data)
+}
+
+// resolve removes queued alerts with the key, returning whether any were queued.
+// Alerts that resolve before the digest is sent are left out of it entirely.
+func (d *alertDigest) resolve(key string) bool {
+	if key == "" {
+		return false
+	}
+	d.Lock()
+	defer d.Unlock()
+	count := len(d.alerts)
+	d.alerts = slices.DeleteFunc(d.alerts, func(data AlertMessageData) bool { return data.Key == key })
+	return len(d.alerts) < count
+}
+
+// take returns the queued alerts and clears the queue
+func (d *alertDigest) take() []AlertMessageData {
+	d.Lock()
+	defer d.Unlock()
+	alerts := d.alerts
+	d.alerts = nil
+	return alerts
+}
+
+// severityRank orders severities from most to least severe, unknown severities count as warnings
+func severityRank(severity Severity) int {
+	if rank, ok := syslogSeverities[severity]; ok {
+		return rank
+	}
+	return syslogSeverities[SeverityWarning]
+}
+
+// groupDigest groups alerts by severity (most severe first), then system and metric,
+// keeping the alert count and worst value of each metric
+func groupDigest(alerts []AlertMessageData) []*digestSeverity {
+	var groups []*digestSeverity
+	for _, data := range alerts {
+		severity := data.Severity
+		if _, ok := syslogSeverities[severity]; !ok {
+			severity = SeverityWarning
+		}
+		i := slices.IndexFunc(groups, func(g *digestSeverity) bool { return g.Severity == severity })
+		if i < 0 {
+			groups = append(groups, &digestSeverity{Severity: severity})
+			i = len(groups) - 1
+		}
+		group := groups[i]
+		group.Count++
+
+		systemName := data.System
+		if systemName == "" {
+			systemName = "Other"
+		}
+		j := slices.IndexFunc(group.Systems, func(s *digestSystem) bool { return s.Name == systemName })
+		if j < 0 {
+			group.Systems = append(group.Systems, &digestSystem{Name: systemName})
+			j = len(group.Systems) - 1
+		}
+		system := group.Systems[j]
+
+		metricName := data.Title
+		if data.Metric != nil {
+			metricName = data.Metric.Name
+		}
+		k := slices.IndexFunc(system.Metrics, func(m *digestMetric) bool { return m.Name == metricName })
+		if k < 0 {
+			system.Metrics = append(system.Metrics, &digestMetric{Name: metricName})
+			k = len(system.Metrics) - 1
+		}
+		metric := system.Metrics[k]
+		metric.Count++
+		if data.Metric != nil {
+			worse := data.Metric.Value > metric.Worst
+			if data.Metric.LowerIsWorse {
+				worse = data.Metric.Value < metric.Worst
+			}
+			if !metric.HasValue || worse {
+				metric.Worst = data.Metric.Value
+				metric.Unit = data.Metric.Unit
+				metric.HasValue = true
+			}
+		}
+	}
+
+	slices.SortFunc(groups, func(a, b *digestSeverity) int { return severityRank(a.Severity) - severityRank(b.Severity) })
+	for _, group := range groups {
+		slices.SortFunc(group.Systems, func(a, b *digestSystem) int { return strings.Compare(a.Name, b.Name) })
+		for _, system := range group.Systems {
+			slices.SortFunc(system.Metrics, func(a, b *digestMetric) int { return strings.Compare(a.Name, b.Name) })
+		}
+	}
+	return groups
+}
+
+// buildDigest renders the notification summarizing the alerts
+func buildDigest(alerts []AlertMessageData) (AlertMessageData, error) {
+	groups := groupDigest(alerts)
+
+	var body strings.Builder
+	if err := digestTemplate.Execute(&body, map[string]any{"Severities": groups}); err != nil {
+		return AlertMessageData{}, err
+	}
+
+	systems := map[string]struct{}{}
+	for _, data := range alerts {
+		systems[data.System] = struct{}{}
+	}
+	title := fmt.Sprintf("%d alerts triggered on %d systems", len(alerts), len(systems))
+	if len(alerts) == 1 {
+		title = "1 alert triggered on 1 system"
+	} else if len(systems) == 1 {
+		title = fmt.Sprintf("%d alerts triggered on 1 system", len(alerts))
+	}
+
+	return AlertMessageData{
+		Title:    title,
+		Message:  strings.TrimSuffix(body.String(), "\n"),
+		Severity: groups[0].Severity,
+	}, nil
+}
+
+// startDigest sends the collected alerts every digest interval until the manager stops
+func (am *AlertManager) startDigest() {
+	ticker := time.NewTicker(am.digest.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-am.stopChan:
+			return
+		case <-ticker.C:
+			am.flushDigest()
+		}
+	}
+}
+
+// flushDigest sends each user a summary of the alerts triggered since the last digest,
+// leaving out the alert types they turned off
+func (am *AlertManager) flushDigest() {
+	alerts := am.digest.take()
+	if len(alerts) == 0 {
+		return
+	}
+	err := am.notifyEachUser(func(settings UserNotificationSettings) (AlertMessageData, bool) {
+		enabled := settings.enabledAlerts(alerts)
+		if len(enabled) == 0 {
+			return AlertMessageData{}, false
+		}
+		data, err := buildDigest(enabled)
+		if err != nil {
+			am.hub.Logger().Error("Failed to build alert digest", "err", err)
+			return AlertMessageData{}, false
+		}
+		data.Link = am.hub.MakeLink()
+		data.LinkText = "View Beszel"
+		return data, true
+	})
+	if err != nil {
+		am.hub.Logger().Error("Failed to send alert digest", "err", err)
+	}
+}
+
+// enabledAlerts returns the alerts of a digest whose types the user gets notified of
+func (s UserNotificationSettings) enabledAlerts(alerts []AlertMessageData) []AlertMessageData {
+	return slices.DeleteFunc(slices.Clone(alerts), func(data AlertMessageData) bool {
+		return !s.alertEnabled(data.Type)
+	})
+}
@@ -0,0 +1,111 @@
+package alerts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildDigest(t *testing.T) {
+	alerts := []AlertMessageData{
+		{Title: "web latency", System: "web", Severity: SeverityWarning, Metric: &AlertMetric{Name: "PingLatency", Value: 120, Unit: " ms"}},
+		{Title: "Connection to db is down", System: "db", Severity: SeverityCritical},
+		{Title: "web download", System: "web", Severity: SeverityWarning, Metric: &AlertMetric{Name: "SpeedtestDownload", Value: 80, Unit: " Mbps", LowerIsWorse: true}},
+		{Title: "api latency", System: "api", Severity: SeverityWarning, Metric: &AlertMetric{Name: "PingLatency", Value: 95.5, Unit: " ms"}},
+		{Title: "web latency", System: "web", Severity: SeverityWarning, Metric: &AlertMetric{Name: "PingLatency", Value: 310, Unit: " ms"}},
+		{Title: "web download", System: "web", Severity: SeverityWarning, Metric: &AlertMetric{Name: "SpeedtestDownload", Value: 42, Unit: " Mbps", LowerIsWorse: true}},
+		{Title: "web latency", System: "web", Severity: SeverityWarning, Metric: &AlertMetric{Name: "PingLatency", Value: 150, Unit: " ms"}},
+		{Title: "SLO burning", System: "api", Severity: SeverityNotice, Metric: &AlertMetric{Name: "SLO uptime burn rate", Value: 14.4, Unit: "x"}},
+		{Title: "Connection to api is down", System: "api", Severity: SeverityCritical},
+	}
+
+	digest, err := buildDigest(alerts)
+	require.NoError(t, err)
+
+	assert.Equal(t, "9 alerts triggered on 3 systems", digest.Title)
+	assert.Equal(t, SeverityCritical, digest.Severity)
+	assert.Equal(t, `CRITICAL (2 alerts)
+  api
+    Connection to api is down: 1 alert
+  db
+    Connection to db is down: 1 alert
+
+WARNING (6 alerts)
+  api
+    PingLatency: 1 alert, worst 95.50 ms
+  web
+    PingLatency: 3 alerts, worst 310.00 ms
+    SpeedtestDownload: 2 alerts, worst 42.00 Mbps
+
+NOTICE (1 alert)
+  api
+    SLO uptime burn rate: 1 alert, worst 14.40x`, digest.Message)
+}
+
+func TestBuildDigestSingleAlert(t *testing.T) {
+	digest, err := buildDigest([]AlertMessageData{
+		{Title: "web CPU above threshold", System: "web", Metric: &AlertMetric{Name: "CPU", Value: 97, Unit: "%"}},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "1 alert triggered on 1 system", digest.Title)
+	// alerts without a severity are warnings
+	assert.Equal(t, SeverityWarning, digest.Severity)
+	assert.Equal(t, "WARNING (1 alert)\n  web\n    CPU: 1 alert, worst 97.00%", digest.Message)
+}
+
+func TestAlertDigestResolve(t *testing.T) {
+	digest := &alertDigest{interval: time.Minute}
+	digest.add(AlertMessageData{Title: "a", Key: "alert1"})
+	digest.add(AlertMessageData{Title: "b", Key: "alert2"})
+
+	assert.True(t, digest.resolve("alert1"))
+	assert.False(t, digest.resolve("alert1"))
+	assert.False(t, digest.resolve(""))
+
+	alerts := digest.take()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "b", alerts[0].Title)
+	assert.Empty(t, digest.take())
+}
+
+func TestDigestEnabledAlerts(t *testing.T) {
+	alerts := []AlertMessageData{
+		{Title: "a", Type: "SpeedtestDownload", System: "web"},
+		{Title: "b", Type: "PingLatency", System: "web"},
+		{Title: "c", System: "db"},
+	}
+	settings := UserNotificationSettings{Alerts: map[string]bool{"SpeedtestDownload": false, "PingLatency": true}}
+
+	enabled := settings.enabledAlerts(alerts)
+	require.Len(t, enabled, 2)
+	assert.Equal(t, "b", enabled[0].Title)
+	assert.Equal(t, "c", enabled[1].Title)
+	// the digest shared by all users keeps its alerts
+	assert.Len(t, alerts, 3)
+
+	digest, err := buildDigest(enabled)
+	require.NoError(t, err)
+	assert.NotContains(t, digest.Message, "SpeedtestDownload")
+	assert.Equal(t, "2 alerts triggered on 2 systems", digest.Title)
+
+	assert.Len(t, UserNotificationSettings{}.enabledAlerts(alerts), 3)
+}
+
+func TestAlertDigestFromEnv(t *testing.T) {
+	t.Setenv("BESZEL_ALERT_DIGEST_INTERVAL", "")
+	digest, err := newAlertDigestFromEnv()
+	require.NoError(t, err)
+	assert.Nil(t, digest)
+
+	t.Setenv("BESZEL_ALERT_DIGEST_INTERVAL", "15m")
+	digest, err = newAlertDigestFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, 15*time.Minute, digest.interval)
+
+	t.Setenv("BESZEL_ALERT_DIGEST_INTERVAL", "0s")
+	_, err = newAlertDigestFromEnv()
+	assert.Error(t, err)
+}
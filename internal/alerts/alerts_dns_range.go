@@ -0,0 +1,114 @@
+package alerts
+
+import (
+	"beszel/internal/entities/system"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// dnsAnswersOutOfRange returns the DNS answers of a system that fall outside the allowed
+// CIDRs of their target, formatted as "domain: ip". It reports false if no result could
+// be checked because no target with allowed CIDRs returned answers.
+func (am *AlertManager) dnsAnswersOutOfRange(systemID string, results map[string]*system.DnsResult) ([]string, bool) {
+	if len(results) == 0 {
+		return nil, false
+	}
+	record, err := am.hub.FindFirstRecordByFilter("monitoring_config", "system = {:system}", map[string]any{"system": systemID})
+	if err != nil {
+		return nil, false
+	}
+	var config struct {
+		Targets []system.DnsTarget `json:"targets"`
+	}
+	if err := record.UnmarshalJSONField("dns", &config); err != nil {
+		return nil, false
+	}
+
+	allowed := make(map[string][]netip.Prefix, len(config.Targets))
+	for _, target := range config.Targets {
+		if len(target.AllowedCidrs) == 0 {
+			continue
+		}
+		if target.Type == "" {
+			target.Type = "A"
+		}
+		prefixes, err := parseCidrs(target.AllowedCidrs)
+		if err != nil {
+			am.hub.Logger().Warn("Ignoring invalid allowed CIDRs", "system", systemID, "domain", target.Domain, "err", err)
+			continue
+		}
+		allowed[dnsTargetKey(target)] = prefixes
+	}
+
+	var outOfRange []string
+	checked := false
+	for key, result := range results {
+		prefixes, ok := allowed[key]
+		// unexpected, unauthenticated or divergent answers are still resolved answers to check
+		if !ok || (result.Status != "success" && result.Status != "mismatch" && result.Status != "insecure" && result.Status != "divergent") || len(result.Answers) == 0 {
+			continue
+		}
+		for _, answer := range result.Answers {
+			// answers of other record types are hosts or text
+			if _, err := netip.ParseAddr(answer); err != nil {
+				continue
+			}
+			checked = true
+			if !ipInPrefixes(answer, prefixes) {
+				outOfRange = append(outOfRange, fmt.Sprintf("%s: %s", result.Domain, answer))
+			}
+		}
+	}
+	return outOfRange, checked
+}
+
+// dnsTargetKey identifies a DNS target the same way the agent keys its results, so the results
+// of resolver comparisons and of lookups from each source IP are checked on their own
+func dnsTargetKey(target system.DnsTarget) string {
+	key := target.Domain + "@" + target.Server + "#" + target.Type
+	if len(target.Servers) > 0 {
+		key = "compare:" + target.Domain + "@" + strings.Join(target.Servers, ",") + "#" + target.Type
+	}
+	if target.SourceIP != "" {
+		key += "%" + target.SourceIP
+	}
+	return key
+}
+
+// parseCidrs parses CIDRs like 192.0.2.0/24, single addresses are treated as a /32 or /128
+func parseCidrs(cidrs []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if !strings.Contains(cidr, "/") {
+			addr, err := netip.ParseAddr(cidr)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// ipInPrefixes reports whether an IP address is in any of the prefixes. Unparsable addresses are out of range.
+func ipInPrefixes(ip string, prefixes []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+//go:build testing
+// +build testing
+
+package alerts_test
+
+import (
+	"beszel/internal/entities/system"
+	"beszel/internal/tests"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSAnswerOutOfRangeAlert(t *testing.T) {
+	// receive alert messages through the syslog sink
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	t.Setenv("BESZEL_SYSLOG_ADDR", "udp://"+listener.LocalAddr().String())
+
+	hub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer hub.Cleanup()
+
+	user, err := tests.CreateUser(hub, "test@test.com", "testtesttest")
+	require.NoError(t, err)
+	systemRecord, err := tests.CreateRecord(hub, "systems", map[string]any{
+		"name":  "dns-system",
+		"host":  "localhost",
+		"port":  "45876",
+		"users": []string{user.Id},
+	})
+	require.NoError(t, err)
+
+	_, err = tests.CreateRecord(hub, "monitoring_config", map[string]any{
+		"system": systemRecord.Id,
+		"dns": map[string]any{
+			"targets": []map[string]any{
+				{"domain": "example.com", "server": "1.1.1.1", "type": "A", "allowed_cidrs": []string{"192.0.2.0/24", "198.51.100.7"}},
+				{"domain": "unrestricted.com", "server": "1.1.1.1", "type": "A"},
+				{"domain": "split.example.com", "servers": []string{"1.1.1.1", "192.168.1.1"}, "allowed_cidrs": []string{"192.0.2.0/24", "198.51.100.7"}},
+				{"domain": "sourced.example.com", "server": "1.1.1.1", "source_ip": "192.0.2.53", "allowed_cidrs": []string{"192.0.2.0/24", "198.51.100.7"}},
+				{"domain": "sourced.example.com", "server": "1.1.1.1"},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	alert, err := tests.CreateRecord(hub, "alerts", map[string]any{
+		"name":   "DNSAnswerOutOfRange",
+		"system": systemRecord.Id,
+		"user":   user.Id,
+		"value":  0,
+		"min":    1,
+	})
+	require.NoError(t, err)
+
+	dnsData := func(answers ...string) *system.CombinedData {
+		return &system.CombinedData{Stats: system.Stats{DnsResults: map[string]*system.DnsResult{
+			"example.com@1.1.1.1#A": {
+				Domain: "example.com", Server: "1.1.1.1", Type: "A", Status: "success", Answers: answers, LastChecked: time.Now(),
+			},
+			"unrestricted.com@1.1.1.1#A": {
+				Domain: "unrestricted.com", Server: "1.1.1.1", Type: "A", Status: "success", Answers: []string{"203.0.113.50"}, LastChecked: time.Now(),
+			},
+			// resolver comparisons are checked with the answers of all their servers
+			"compare:split.example.com@1.1.1.1,192.168.1.1#A": {
+				Domain: "split.example.com", Server: "1.1.1.1,192.168.1.1", Type: "A", Status: "divergent", Answers: answers, LastChecked: time.Now(),
+			},
+			// lookups from a source IP are checked apart from the same lookup without one
+			"sourced.example.com@1.1.1.1#A%192.0.2.53": {
+				Domain: "sourced.example.com", Server: "1.1.1.1", Type: "A", Status: "success", Answers: answers, LastChecked: time.Now(),
+			},
+			"sourced.example.com@1.1.1.1#A": {
+				Domain: "sourced.example.com", Server: "1.1.1.1", Type: "A", Status: "success", Answers: []string{"203.0.113.51"}, LastChecked: time.Now(),
+			},
+		}}}
+	}
+	readMessage := func() string {
+		buf := make([]byte, 4096)
+		require.NoError(t, listener.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, _, err := listener.ReadFrom(buf)
+		require.NoError(t, err)
+		return string(buf[:n])
+	}
+	triggered := func() bool {
+		record, err := hub.FindRecordById("alerts", alert.Id)
+		require.NoError(t, err)
+		return record.GetBool("triggered")
+	}
+
+	// answers in the allowed ranges don't trigger, other targets aren't restricted
+	require.NoError(t, hub.HandleSystemAlerts(systemRecord, dnsData("192.0.2.10", "198.51.100.7")))
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, triggered())
+
+	// an answer outside the allowed ranges triggers with the offending IP
+	require.NoError(t, hub.HandleSystemAlerts(systemRecord, dnsData("192.0.2.10", "203.0.113.99")))
+	message := readMessage()
+	assert.Contains(t, message, "dns-system dnsansweroutofrange above threshold")
+	assert.Contains(t, message, "example.com: 203.0.113.99")
+	assert.Contains(t, message, "split.example.com: 203.0.113.99")
+	assert.Contains(t, message, "sourced.example.com: 203.0.113.99")
+	assert.NotContains(t, message, "203.0.113.51", "the lookup without a source IP isn't restricted")
+	assert.False(t, strings.Contains(message, "192.0.2.10"), "allowed answers are not reported")
+	assert.Eventually(t, triggered, time.Second, 10*time.Millisecond)
+
+	// back in range resolves the alert
+	require.NoError(t, hub.HandleSystemAlerts(systemRecord, dnsData("198.51.100.7")))
+	message = readMessage()
+	assert.Contains(t, message, "All DNS answers are within the allowed IP ranges again")
+	assert.Eventually(t, func() bool { return !triggered() }, time.Second, 10*time.Millisecond)
+}
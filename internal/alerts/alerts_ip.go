@@ -0,0 +1,26 @@
+package alerts
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// HandleIPChangeAlert notifies that the public IP of a system changed, like a dynamic IP
+// rotated by the ISP. Maintenance windows hold the notification back.
+func (am *AlertManager) HandleIPChangeAlert(systemRecord *core.Record, oldIP, newIP string) error {
+	systemName := systemRecord.GetString("name")
+	if am.IsInMaintenance(systemRecord.Id) {
+		am.hub.Logger().Info("Public IP change alert held back by maintenance window", "system", systemName)
+		return nil
+	}
+	return am.SendAlert(AlertMessageData{
+		Type:     "IPChange",
+		Title:    fmt.Sprintf("%s public IP changed", systemName),
+		Message:  fmt.Sprintf("System %s public IP changed from %s to %s.", systemName, oldIP, newIP),
+		Link:     am.hub.MakeLink("system", systemName),
+		LinkText: "View " + systemName,
+		Severity: SeverityNotice,
+		System:   systemName,
+	})
+}
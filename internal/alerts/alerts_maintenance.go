@@ -0,0 +1,172 @@
+package alerts
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/robfig/cron/v3"
+)
+
+// maintenanceScheduleParser parses the 5-field cron expressions of recurring maintenance windows
+var maintenanceScheduleParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+
+// maintenanceWindow is a period alert notifications of a system are held back in. It is either
+// fixed from start to end, or recurring at the times of a cron schedule for a duration.
+type maintenanceWindow struct {
+	start    time.Time
+	end      time.Time
+	schedule cron.Schedule
+	duration time.Duration
+}
+
+// MaintenanceWindow is a maintenance window as returned and accepted by the API
+type MaintenanceWindow struct {
+	Id       string    `json:"id,omitempty"`
+	System   string    `json:"system"`
+	Start    time.Time `json:"start,omitzero"`
+	End      time.Time `json:"end,omitzero"`
+	Schedule string    `json:"schedule,omitempty"` // Cron expression of the start times, evaluated in UTC
+	Duration int       `json:"duration,omitempty"` // Minutes each scheduled window lasts
+	Note     string    `json:"note,omitempty"`
+	Active   bool      `json:"active"`
+}
+
+// parseMaintenanceWindow validates a window. Recurring windows need a schedule and a duration,
+// fixed windows a start before their end. Times are in UTC.
+func parseMaintenanceWindow(w MaintenanceWindow) (*maintenanceWindow, error) {
+	if strings.TrimSpace(w.Schedule) != "" {
+		schedule, err := maintenanceScheduleParser.Parse(strings.TrimSpace(w.Schedule))
+		if err != nil {
+			return nil, err
+		}
+		if w.Duration <= 0 {
+			return nil, errors.New("recurring maintenance window needs a duration")
+		}
+		return &maintenanceWindow{schedule: schedule, duration: time.Duration(w.Duration) * time.Minute}, nil
+	}
+	if w.Start.IsZero() || w.End.IsZero() || !w.Start.Before(w.End) {
+		return nil, errors.New("maintenance window needs a start before its end, or a schedule")
+	}
+	return &maintenanceWindow{start: w.Start.UTC(), end: w.End.UTC()}, nil
+}
+
+// active reports whether t is inside the window
+func (w *maintenanceWindow) active(t time.Time) bool {
+	t = t.UTC()
+	if w.schedule == nil {
+		return !t.Before(w.start) && t.Before(w.end)
+	}
+	// a recurring window is active if it started less than its duration ago
+	return !w.schedule.Next(t.Add(-w.duration)).After(t)
+}
+
+// maintenanceWindowFromRecord converts a maintenance_windows record
+func maintenanceWindowFromRecord(record *core.Record) MaintenanceWindow {
+	return MaintenanceWindow{
+		Id:       record.Id,
+		System:   record.GetString("system"),
+		Start:    record.GetDateTime("start").Time(),
+		End:      record.GetDateTime("end").Time(),
+		Schedule: record.GetString("schedule"),
+		Duration: record.GetInt("duration"),
+		Note:     record.GetString("note"),
+	}
+}
+
+// IsInMaintenance reports whether a maintenance window of the system is active.
+// Invalid windows are ignored.
+func (am *AlertManager) IsInMaintenance(systemID string) bool {
+	records, err := am.hub.FindAllRecords("maintenance_windows", dbx.HashExp{"system": systemID})
+	if err != nil {
+		return false
+	}
+	now := time.Now().UTC()
+	for _, record := range records {
+		window, err := parseMaintenanceWindow(maintenanceWindowFromRecord(record))
+		if err != nil {
+			am.hub.Logger().Warn("Ignoring invalid maintenance window", "id", record.Id, "err", err)
+			continue
+		}
+		if window.active(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetMaintenanceWindows handles GET /api/beszel/systems/{id}/maintenance-windows
+func (am *AlertManager) GetMaintenanceWindows(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+
+	systemID := e.Request.PathValue("id")
+	if _, err := am.hub.FindRecordById("systems", systemID); err != nil {
+		return apis.NewNotFoundError("System not found", nil)
+	}
+	records, err := am.hub.FindRecordsByFilter("maintenance_windows", "system = {:system}", "-created", 0, 0, dbx.Params{"system": systemID})
+	if err != nil {
+		return e.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	now := time.Now().UTC()
+	windows := make([]MaintenanceWindow, 0, len(records))
+	for _, record := range records {
+		w := maintenanceWindowFromRecord(record)
+		if window, err := parseMaintenanceWindow(w); err == nil {
+			w.Active = window.active(now)
+		}
+		windows = append(windows, w)
+	}
+	return e.JSON(http.StatusOK, windows)
+}
+
+// CreateMaintenanceWindow handles POST /api/beszel/systems/{id}/maintenance-windows
+func (am *AlertManager) CreateMaintenanceWindow(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil || info.Auth.GetString("role") != "admin" {
+		return apis.NewForbiddenError("Admin access required", nil)
+	}
+
+	systemID := e.Request.PathValue("id")
+	if _, err := am.hub.FindRecordById("systems", systemID); err != nil {
+		return apis.NewNotFoundError("System not found", nil)
+	}
+	var w MaintenanceWindow
+	if err := e.BindBody(&w); err != nil {
+		return apis.NewBadRequestError("Invalid maintenance window", err)
+	}
+	w.System = systemID
+	window, err := parseMaintenanceWindow(w)
+	if err != nil {
+		return apis.NewBadRequestError(err.Error(), nil)
+	}
+
+	collection, err := am.hub.FindCachedCollectionByNameOrId("maintenance_windows")
+	if err != nil {
+		return e.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	record := core.NewRecord(collection)
+	record.Set("system", systemID)
+	if window.schedule != nil {
+		record.Set("schedule", strings.TrimSpace(w.Schedule))
+		record.Set("duration", w.Duration)
+	} else {
+		record.Set("start", w.Start.UTC())
+		record.Set("end", w.End.UTC())
+	}
+	record.Set("note", w.Note)
+	if err := am.hub.Save(record); err != nil {
+		return apis.NewBadRequestError("Failed to save maintenance window", err)
+	}
+
+	created := maintenanceWindowFromRecord(record)
+	created.Active = window.active(time.Now().UTC())
+	return e.JSON(http.StatusOK, created)
+}
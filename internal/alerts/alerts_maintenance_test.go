@@ -0,0 +1,51 @@
+package alerts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaintenanceWindow(t *testing.T) {
+	at := func(value string) time.Time {
+		parsed, err := time.Parse(time.RFC3339, value)
+		require.NoError(t, err)
+		return parsed
+	}
+
+	t.Run("fixed", func(t *testing.T) {
+		window, err := parseMaintenanceWindow(MaintenanceWindow{Start: at("2025-03-01T02:00:00Z"), End: at("2025-03-01T04:00:00Z")})
+		require.NoError(t, err)
+		assert.False(t, window.active(at("2025-03-01T01:59:59Z")))
+		assert.True(t, window.active(at("2025-03-01T02:00:00Z")))
+		assert.True(t, window.active(at("2025-03-01T03:59:59Z")))
+		assert.False(t, window.active(at("2025-03-01T04:00:00Z")))
+		// other zones are the same instant in UTC
+		assert.True(t, window.active(at("2025-03-01T04:30:00+02:00")))
+	})
+
+	t.Run("recurring", func(t *testing.T) {
+		// sundays from 02:00 UTC for 90 minutes
+		window, err := parseMaintenanceWindow(MaintenanceWindow{Schedule: "0 2 * * 0", Duration: 90})
+		require.NoError(t, err)
+		assert.False(t, window.active(at("2025-03-02T01:59:00Z")))
+		assert.True(t, window.active(at("2025-03-02T02:00:00Z")))
+		assert.True(t, window.active(at("2025-03-02T03:29:59Z")))
+		assert.False(t, window.active(at("2025-03-02T03:30:00Z")))
+		assert.False(t, window.active(at("2025-03-03T02:30:00Z")), "mondays aren't in the window")
+		assert.True(t, window.active(at("2025-03-09T02:30:00Z")))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := parseMaintenanceWindow(MaintenanceWindow{Schedule: "0 2 * *", Duration: 60})
+		assert.Error(t, err)
+		_, err = parseMaintenanceWindow(MaintenanceWindow{Schedule: "0 2 * * 0"})
+		assert.ErrorContains(t, err, "needs a duration")
+		_, err = parseMaintenanceWindow(MaintenanceWindow{Start: at("2025-03-01T04:00:00Z"), End: at("2025-03-01T02:00:00Z")})
+		assert.ErrorContains(t, err, "start before its end")
+		_, err = parseMaintenanceWindow(MaintenanceWindow{})
+		assert.Error(t, err)
+	})
+}
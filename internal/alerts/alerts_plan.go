@@ -0,0 +1,39 @@
+package alerts
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// thresholdModePlan makes the threshold of a speedtest alert a percentage of the speed
+// of the system's internet plan instead of an absolute speed
+const thresholdModePlan = "percent_of_plan"
+
+// planSpeed returns the download or upload speed of the system's plan in Mbps for a speedtest
+// alert in percent of plan mode, or zero if the alert uses absolute thresholds or no plan is set
+func planSpeed(systemRecord, alertRecord *core.Record) float64 {
+	if alertRecord.GetString("threshold_mode") != thresholdModePlan {
+		return 0
+	}
+	switch alertRecord.GetString("name") {
+	case "SpeedtestDownload":
+		return systemRecord.GetFloat("plan_download")
+	case "SpeedtestUpload":
+		return systemRecord.GetFloat("plan_upload")
+	}
+	return 0
+}
+
+// percentOfPlan returns a speed in Mbps as a percentage of the plan, rounded to hundredths
+func percentOfPlan(speed, plan float64) float64 {
+	return math.Round(speed/plan*100*100) / 100
+}
+
+// planAlertBody describes a speedtest alert in percent of plan mode
+func planAlertBody(alert SystemAlertData, minutesLabel string) string {
+	return fmt.Sprintf("Average %s across all speedtest servers was %.2f Mbps, %.2f%% of the %g Mbps plan, for the previous %v %s. The threshold is %g%% of the plan.",
+		strings.ToLower(alert.name), alert.val*alert.plan/100, alert.val, alert.plan, alert.min, minutesLabel, alert.threshold)
+}
@@ -0,0 +1,60 @@
+package alerts
+
+import (
+	"fmt"
+	"time"
+)
+
+// QuietHours is a daily time range in which a user gets no notifications
+type QuietHours struct {
+	Start string `json:"start"` // Like "22:00"
+	End   string `json:"end"`   // Like "07:00", before the start if the range spans midnight
+	TZ    string `json:"tz"`    // IANA time zone of the times, empty uses UTC
+}
+
+// contains reports whether t is within the quiet hours. The start is included, the end isn't.
+func (q QuietHours) contains(t time.Time) (bool, error) {
+	start, err := time.Parse("15:04", q.Start)
+	if err != nil {
+		return false, fmt.Errorf("invalid quiet hours start %q", q.Start)
+	}
+	end, err := time.Parse("15:04", q.End)
+	if err != nil {
+		return false, fmt.Errorf("invalid quiet hours end %q", q.End)
+	}
+	location, err := time.LoadLocation(q.TZ)
+	if err != nil {
+		return false, fmt.Errorf("invalid quiet hours time zone %q", q.TZ)
+	}
+
+	t = t.In(location)
+	minute := t.Hour()*60 + t.Minute()
+	startMinute, endMinute := start.Hour()*60+start.Minute(), end.Hour()*60+end.Minute()
+	if startMinute <= endMinute {
+		return minute >= startMinute && minute < endMinute, nil
+	}
+	return minute >= startMinute || minute < endMinute, nil
+}
+
+// holdBackReason returns why a user's preferences hold back a notification at now,
+// empty if it is sent. Alerts without a type, like digests, are only held back by quiet hours.
+func (s UserNotificationSettings) holdBackReason(data AlertMessageData, now time.Time) (string, error) {
+	if !s.alertEnabled(data.Type) {
+		return "alert type disabled", nil
+	}
+	if s.QuietHours == nil {
+		return "", nil
+	}
+	quiet, err := s.QuietHours.contains(now)
+	if err != nil || !quiet {
+		return "", err
+	}
+	return "quiet hours", nil
+}
+
+// alertEnabled reports whether the user gets notified of an alert type. Types are on unless
+// turned off, and alerts without a type are always on.
+func (s UserNotificationSettings) alertEnabled(alertType string) bool {
+	enabled, ok := s.Alerts[alertType]
+	return enabled || !ok || alertType == ""
+}
@@ -0,0 +1,83 @@
+package alerts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuietHours(t *testing.T) {
+	at := func(hour, minute int) time.Time { return time.Date(2025, 1, 2, hour, minute, 0, 0, time.UTC) }
+
+	daytime := QuietHours{Start: "12:00", End: "13:30"}
+	for _, tt := range []struct {
+		time  time.Time
+		quiet bool
+	}{
+		{at(11, 59), false},
+		{at(12, 0), true},
+		{at(13, 29), true},
+		{at(13, 30), false},
+	} {
+		quiet, err := daytime.contains(tt.time)
+		require.NoError(t, err)
+		assert.Equal(t, tt.quiet, quiet, tt.time.Format("15:04"))
+	}
+
+	// the range spans midnight, in the user's time zone
+	overnight := QuietHours{Start: "22:00", End: "07:00", TZ: "Europe/Amsterdam"}
+	for _, tt := range []struct {
+		time  time.Time
+		quiet bool
+	}{
+		{at(20, 59), false}, // 21:59 in Amsterdam
+		{at(21, 0), true},
+		{at(2, 0), true},
+		{at(5, 59), true},
+		{at(6, 0), false},
+	} {
+		quiet, err := overnight.contains(tt.time)
+		require.NoError(t, err)
+		assert.Equal(t, tt.quiet, quiet, tt.time.Format("15:04"))
+	}
+
+	_, err := QuietHours{Start: "10pm", End: "07:00"}.contains(at(0, 0))
+	assert.Error(t, err)
+	_, err = QuietHours{Start: "22:00", End: "07:00", TZ: "Mars/Olympus"}.contains(at(0, 0))
+	assert.Error(t, err)
+}
+
+func TestHoldBackReason(t *testing.T) {
+	night := time.Date(2025, 1, 2, 23, 0, 0, 0, time.UTC)
+	day := time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC)
+	settings := UserNotificationSettings{
+		Alerts:     map[string]bool{"PingLatency": false, "CPU": true},
+		QuietHours: &QuietHours{Start: "22:00", End: "07:00"},
+	}
+
+	reason, err := settings.holdBackReason(AlertMessageData{Type: "PingLatency"}, day)
+	require.NoError(t, err)
+	assert.Equal(t, "alert type disabled", reason)
+
+	// types the user didn't choose are sent
+	for _, alertType := range []string{"CPU", "Memory", ""} {
+		reason, err = settings.holdBackReason(AlertMessageData{Type: alertType}, day)
+		require.NoError(t, err)
+		assert.Empty(t, reason, alertType)
+	}
+
+	// quiet hours hold back every alert, digests included
+	for _, alertType := range []string{"CPU", ""} {
+		reason, err = settings.holdBackReason(AlertMessageData{Type: alertType}, night)
+		require.NoError(t, err)
+		assert.Equal(t, "quiet hours", reason)
+	}
+
+	// invalid quiet hours don't hold anything back
+	settings.QuietHours.Start = "late"
+	reason, err = settings.holdBackReason(AlertMessageData{Type: "CPU"}, night)
+	assert.Error(t, err)
+	assert.Empty(t, reason)
+}
@@ -0,0 +1,105 @@
+package alerts
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cast"
+)
+
+// AlertSimulation is the outcome of running a metric value through the trigger logic of an alert
+type AlertSimulation struct {
+	Name        string  `json:"name"`
+	Value       float64 `json:"value"` // The value as compared to the threshold, a percentage of the plan in percent of plan mode
+	Unit        string  `json:"unit"`
+	Threshold   float64 `json:"threshold"`
+	Triggered   bool    `json:"triggered"`    // Whether the alert is triggered at the value
+	StateChange bool    `json:"state_change"` // Whether the value changes the alert's current state, which sends a notification
+	Subject     string  `json:"subject"`      // Notification subject for the state at the value
+	Body        string  `json:"body"`         // Notification body for the state at the value
+}
+
+// simulateRequest is the body of POST /api/beszel/alerts/{id}/simulate
+type simulateRequest struct {
+	Value   *float64 `json:"value"`   // Metric value, the average over the alert's minutes or the worst target
+	Details string   `json:"details"` // Optional context of the value, like the offending target
+}
+
+// SimulateSystemAlert runs value through the trigger logic of HandleSystemAlerts for the alert
+// and returns the notification it would send. Nothing is saved or sent.
+func (am *AlertManager) SimulateSystemAlert(alertRecord *core.Record, value float64, details string) (AlertSimulation, error) {
+	name := alertRecord.GetString("name")
+	unit, ok := alertUnits[name]
+	if !ok {
+		return AlertSimulation{}, fmt.Errorf("%s alerts can't be simulated", name)
+	}
+	systemRecord, err := am.hub.FindRecordById("systems", alertRecord.GetString("system"))
+	if err != nil {
+		return AlertSimulation{}, err
+	}
+
+	plan := planSpeed(systemRecord, alertRecord)
+	if alertRecord.GetString("threshold_mode") == thresholdModePlan && plan <= 0 {
+		return AlertSimulation{}, fmt.Errorf("system has no plan speed for %s", name)
+	}
+	if plan > 0 {
+		value = percentOfPlan(value, plan)
+		unit = "% of plan"
+	}
+
+	alert := SystemAlertData{
+		systemRecord: systemRecord,
+		alertRecord:  alertRecord,
+		name:         name,
+		unit:         unit,
+		val:          value,
+		threshold:    alertRecord.GetFloat("value"),
+		min:          max(1, cast.ToUint8(alertRecord.Get("min"))),
+		details:      details,
+		plan:         plan,
+	}
+	if aggregation := alertRecord.GetString("aggregation"); perTargetAggregation(aggregation, name) {
+		alert.aggregation = aggregation
+	}
+	alert.triggered = crossesThreshold(name, value, alert.threshold)
+	subject, body := systemAlertMessage(alert)
+
+	return AlertSimulation{
+		Name:        name,
+		Value:       value,
+		Unit:        unit,
+		Threshold:   alert.threshold,
+		Triggered:   alert.triggered,
+		StateChange: alert.triggered != alertRecord.GetBool("triggered"),
+		Subject:     subject,
+		Body:        body,
+	}, nil
+}
+
+// SimulateAlert handles POST /api/beszel/alerts/{id}/simulate
+func (am *AlertManager) SimulateAlert(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+
+	alertRecord, err := am.hub.FindRecordById("alerts", e.Request.PathValue("id"))
+	if err != nil {
+		return apis.NewNotFoundError("Alert not found", nil)
+	}
+	var req simulateRequest
+	if err := e.BindBody(&req); err != nil {
+		return apis.NewBadRequestError("Invalid simulation", err)
+	}
+	if req.Value == nil {
+		return apis.NewBadRequestError("Value is required", nil)
+	}
+
+	simulation, err := am.SimulateSystemAlert(alertRecord, *req.Value, req.Details)
+	if err != nil {
+		return apis.NewBadRequestError(err.Error(), nil)
+	}
+	return e.JSON(http.StatusOK, simulation)
+}
@@ -0,0 +1,92 @@
+//go:build testing
+// +build testing
+
+package alerts_test
+
+import (
+	"beszel/internal/tests"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimulateSystemAlert(t *testing.T) {
+	// a simulation must not send anything to the syslog sink
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	t.Setenv("BESZEL_SYSLOG_ADDR", "udp://"+listener.LocalAddr().String())
+
+	hub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer hub.Cleanup()
+
+	user, err := tests.CreateUser(hub, "test@test.com", "testtesttest")
+	require.NoError(t, err)
+	systemRecord, err := tests.CreateRecord(hub, "systems", map[string]any{
+		"name":          "sim-system",
+		"host":          "localhost",
+		"port":          "45876",
+		"users":         []string{user.Id},
+		"plan_download": 1000,
+	})
+	require.NoError(t, err)
+	createAlert := func(fields map[string]any) string {
+		fields["system"] = systemRecord.Id
+		fields["user"] = user.Id
+		record, err := tests.CreateRecord(hub, "alerts", fields)
+		require.NoError(t, err)
+		return record.Id
+	}
+	latencyID := createAlert(map[string]any{"name": "PingLatency", "value": 100, "min": 5})
+	downloadID := createAlert(map[string]any{"name": "SpeedtestDownload", "value": 80, "min": 1, "threshold_mode": "percent_of_plan"})
+	uploadID := createAlert(map[string]any{"name": "SpeedtestUpload", "value": 80, "min": 1, "threshold_mode": "percent_of_plan"})
+	statusID := createAlert(map[string]any{"name": "Status"})
+
+	simulate := func(id string, value float64) (bool, bool, string, string) {
+		record, err := hub.FindRecordById("alerts", id)
+		require.NoError(t, err)
+		simulation, err := hub.SimulateSystemAlert(record, value, "")
+		require.NoError(t, err)
+		return simulation.Triggered, simulation.StateChange, simulation.Subject, simulation.Body
+	}
+
+	// latency alerts trigger above the threshold
+	triggered, stateChange, subject, body := simulate(latencyID, 250)
+	assert.True(t, triggered)
+	assert.True(t, stateChange)
+	assert.Equal(t, "sim-system pinglatency above threshold", subject)
+	assert.Equal(t, "Average latency across all ping targets was 250.00 ms for the previous 5 minutes.", body)
+	triggered, stateChange, subject, _ = simulate(latencyID, 50)
+	assert.False(t, triggered)
+	assert.False(t, stateChange, "the alert isn't triggered yet")
+	assert.Equal(t, "sim-system pinglatency below threshold", subject)
+
+	// speed alerts trigger below the threshold, here in percent of the plan
+	triggered, _, subject, body = simulate(downloadID, 640)
+	assert.True(t, triggered)
+	assert.Equal(t, "sim-system speedtestdownload below threshold", subject)
+	assert.Contains(t, body, "was 640.00 Mbps, 64.00% of the 1000 Mbps plan")
+	triggered, _, _, _ = simulate(downloadID, 900)
+	assert.False(t, triggered)
+
+	// alerts that can't be evaluated can't be simulated
+	for _, id := range []string{uploadID, statusID} {
+		record, err := hub.FindRecordById("alerts", id)
+		require.NoError(t, err)
+		_, err = hub.SimulateSystemAlert(record, 1, "")
+		assert.Error(t, err)
+	}
+
+	// nothing is saved or sent
+	record, err := hub.FindRecordById("alerts", latencyID)
+	require.NoError(t, err)
+	assert.False(t, record.GetBool("triggered"))
+	assert.True(t, record.GetDateTime("last_notified").IsZero())
+	require.NoError(t, listener.SetReadDeadline(time.Now().Add(200*time.Millisecond)))
+	_, _, err = listener.ReadFrom(make([]byte, 4096))
+	assert.Error(t, err, "no notification is sent")
+}
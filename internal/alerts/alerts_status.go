@@ -48,7 +48,7 @@ func (am *AlertManager) startWorker() {
 				info := value.(*alertInfo)
 				if now.After(info.expireTime) {
 					// Downtime delay has passed, process alert
-					am.sendStatusAlert("down", info.systemName, info.alertRecord)
+					am.sendStatusAlert("down", info.systemName, info.alertRecord, 0)
 					am.pendingAlerts.Delete(key)
 				}
 			}
@@ -67,6 +67,14 @@ func (am *AlertManager) HandleStatusAlerts(newStatus string, systemRecord *core.
 		return nil
 	}
 
+	// remember when the system went down, recovery alerts report how long it was down
+	var downtime time.Duration
+	if newStatus == "down" {
+		am.downSince.Store(systemRecord.Id, time.Now())
+	} else {
+		downtime = am.downtime(systemRecord)
+	}
+
 	alertRecords, err := am.getSystemStatusAlerts(systemRecord.Id)
 	if err != nil {
 		return err
@@ -79,11 +87,52 @@ func (am *AlertManager) HandleStatusAlerts(newStatus string, systemRecord *core.
 	if newStatus == "down" {
 		am.handleSystemDown(systemName, alertRecords)
 	} else {
-		am.handleSystemUp(systemName, alertRecords)
+		am.handleSystemUp(systemName, alertRecords, downtime)
 	}
 	return nil
 }
 
+// recordStatusHistory logs transitions of systems to up or down into status_history, which the
+// uptime of the systems is computed from. Unlike status alerts, which only follow systems going
+// from up to down and back, transitions from any other status are logged too, like a new system
+// coming up or a paused one being resumed.
+func (am *AlertManager) recordStatusHistory(e *core.RecordEvent) error {
+	status := e.Record.GetString("status")
+	if (status == "up" || status == "down") && status != e.Record.Original().GetString("status") {
+		if err := am.recordStatusChange(e.Record.Id, status); err != nil {
+			am.hub.Logger().Error("Failed to record status change", "system", e.Record.Id, "err", err)
+		}
+	}
+	return e.Next()
+}
+
+// recordStatusChange logs a transition of the system to the status into status_history
+func (am *AlertManager) recordStatusChange(systemID, status string) error {
+	collection, err := am.hub.FindCachedCollectionByNameOrId("status_history")
+	if err != nil {
+		return err
+	}
+	record := core.NewRecord(collection)
+	record.Set("system", systemID)
+	record.Set("status", status)
+	return am.hub.Save(record)
+}
+
+// downtime returns how long a recovered system was down. If the hub restarted since the system went
+// down, the last update of the system record before its recovery, which set it down, is used instead.
+func (am *AlertManager) downtime(systemRecord *core.Record) time.Duration {
+	var since time.Time
+	if value, ok := am.downSince.LoadAndDelete(systemRecord.Id); ok {
+		since = value.(time.Time)
+	} else {
+		since = systemRecord.Original().GetDateTime("updated").Time()
+	}
+	if since.IsZero() {
+		return 0
+	}
+	return max(0, time.Since(since)).Round(time.Second)
+}
+
 // getSystemStatusAlerts retrieves all "Status" alert records for a given system ID.
 func (am *AlertManager) getSystemStatusAlerts(systemID string) ([]*core.Record, error) {
 	alertRecords, err := am.hub.FindAllRecords("alerts", dbx.HashExp{
@@ -116,7 +165,7 @@ func (am *AlertManager) handleSystemDown(systemName string, alertRecords []*core
 
 // handleSystemUp manages the logic when a system status changes to "up".
 // It cancels any pending alerts and sends "up" alerts.
-func (am *AlertManager) handleSystemUp(systemName string, alertRecords []*core.Record) {
+func (am *AlertManager) handleSystemUp(systemName string, alertRecords []*core.Record, downtime time.Duration) {
 	for _, alertRecord := range alertRecords {
 		alertRecordID := alertRecord.Id
 		// If alert exists for record, delete and continue (down alert not sent)
@@ -128,14 +177,15 @@ func (am *AlertManager) handleSystemUp(systemName string, alertRecords []*core.R
 			continue
 		}
 		// No alert scheduled for this record, send "up" alert
-		if err := am.sendStatusAlert("up", systemName, alertRecord); err != nil {
+		if err := am.sendStatusAlert("up", systemName, alertRecord, downtime); err != nil {
 			am.hub.Logger().Error("Failed to send alert", "err", err)
 		}
 	}
 }
 
 // sendStatusAlert sends a status alert ("up" or "down") to the users associated with the alert records.
-func (am *AlertManager) sendStatusAlert(alertStatus string, systemName string, alertRecord *core.Record) error {
+// The downtime of "up" alerts is included in the message, 0 leaves it out.
+func (am *AlertManager) sendStatusAlert(alertStatus string, systemName string, alertRecord *core.Record, downtime time.Duration) error {
 	switch alertStatus {
 	case "up":
 		alertRecord.Set("triggered", false)
@@ -144,6 +194,12 @@ func (am *AlertManager) sendStatusAlert(alertStatus string, systemName string, a
 	}
 	am.hub.Save(alertRecord)
 
+	// maintenance windows hold back the notification, the triggered state is saved regardless
+	if am.IsInMaintenance(alertRecord.GetString("system")) {
+		am.hub.Logger().Info("Status alert held back by maintenance window", "system", systemName, "status", alertStatus)
+		return nil
+	}
+
 	var emoji string
 	if alertStatus == "up" {
 		emoji = "\u2705" // Green checkmark emoji
@@ -153,6 +209,9 @@ func (am *AlertManager) sendStatusAlert(alertStatus string, systemName string, a
 
 	title := fmt.Sprintf("Connection to %s is %s %v", systemName, alertStatus, emoji)
 	message := strings.TrimSuffix(title, emoji)
+	if alertStatus == "up" && downtime > 0 {
+		message = fmt.Sprintf("%s was down for %s.", systemName, downtime)
+	}
 
 	// if errs := am.hub.ExpandRecord(alertRecord, []string{"user"}, nil); len(errs) > 0 {
 	// 	return errs["user"]
@@ -162,11 +221,21 @@ func (am *AlertManager) sendStatusAlert(alertStatus string, systemName string, a
 	// 	return nil
 	// }
 
+	severity := SeverityCritical
+	if alertStatus == "up" {
+		severity = SeverityInfo
+	}
+
 	return am.SendAlert(AlertMessageData{
 		UserID:   alertRecord.GetString("user"),
+		Type:     "Status",
 		Title:    title,
 		Message:  message,
 		Link:     am.hub.MakeLink("system", systemName),
 		LinkText: "View " + systemName,
+		Severity: severity,
+		Resolved: alertStatus == "up",
+		Key:      alertRecord.Id,
+		System:   systemName,
 	})
 }
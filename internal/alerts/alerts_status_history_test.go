@@ -0,0 +1,63 @@
+//go:build testing
+// +build testing
+
+package alerts_test
+
+import (
+	"beszel/internal/tests"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusHistory(t *testing.T) {
+	hub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer hub.Cleanup()
+
+	user, err := tests.CreateUser(hub, "test@test.com", "testtesttest")
+	require.NoError(t, err)
+	systemRecord, err := tests.CreateRecord(hub, "systems", map[string]any{
+		"name":  "history-system",
+		"host":  "localhost",
+		"port":  "45876",
+		"users": []string{user.Id},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "pending", systemRecord.GetString("status"))
+
+	history := func() []string {
+		records, err := hub.FindRecordsByFilter("status_history", "system = {:system}", "created", 0, 0, map[string]any{"system": systemRecord.Id})
+		require.NoError(t, err)
+		statuses := make([]string, len(records))
+		for i, record := range records {
+			statuses[i] = record.GetString("status")
+		}
+		return statuses
+	}
+	// the hub saves the status of a freshly loaded record, its original has the previous status
+	setStatus := func(status string) {
+		systemRecord, err = hub.FindRecordById("systems", systemRecord.Id)
+		require.NoError(t, err)
+		systemRecord.Set("status", status)
+		require.NoError(t, hub.Save(systemRecord))
+	}
+
+	// a new system coming up is logged, though no status alert follows pending systems
+	setStatus("up")
+	assert.Equal(t, []string{"up"}, history())
+
+	// saving the system without a status change logs nothing
+	systemRecord, err = hub.FindRecordById("systems", systemRecord.Id)
+	require.NoError(t, err)
+	systemRecord.Set("name", "renamed-system")
+	require.NoError(t, hub.Save(systemRecord))
+	assert.Equal(t, []string{"up"}, history())
+
+	// paused and pending systems aren't up or down, resuming a down system logs it down again
+	setStatus("down")
+	setStatus("paused")
+	setStatus("down")
+	assert.Equal(t, []string{"up", "down", "down"}, history())
+}
@@ -0,0 +1,33 @@
+package alerts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDowntime(t *testing.T) {
+	collection := core.NewBaseCollection("systems")
+	collection.Fields.Add(&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true})
+	systemRecord := core.NewRecord(collection)
+	systemRecord.Id = "system1"
+
+	am := &AlertManager{}
+
+	// the time the system went down is remembered
+	am.downSince.Store(systemRecord.Id, time.Now().Add(-(4*time.Minute + 12*time.Second)))
+	assert.Equal(t, 4*time.Minute+12*time.Second, am.downtime(systemRecord))
+	_, ok := am.downSince.Load(systemRecord.Id)
+	assert.False(t, ok, "recovery forgets the down time")
+
+	// after a hub restart the last update of the record, when it went down, is used
+	systemRecord.SetRaw("updated", time.Now().Add(-time.Hour).UTC().Format(time.RFC3339Nano))
+	require.NoError(t, systemRecord.PostScan())
+	assert.Equal(t, time.Hour, am.downtime(systemRecord))
+
+	// without either the downtime is unknown
+	assert.Zero(t, am.downtime(core.NewRecord(collection)))
+}
@@ -0,0 +1,177 @@
+package alerts
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Severity of an alert, mapped to the syslog severity
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityNotice   Severity = "notice"
+	SeverityWarning  Severity = "warning"
+	SeverityError    Severity = "error"
+	SeverityCritical Severity = "critical"
+)
+
+// syslogSeverities maps alert severities to RFC 5424 severity codes
+var syslogSeverities = map[Severity]int{
+	SeverityCritical: 2,
+	SeverityError:    3,
+	SeverityWarning:  4,
+	SeverityNotice:   5,
+	SeverityInfo:     6,
+}
+
+// syslogFacilities maps facility names to RFC 5424 facility codes
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+const (
+	syslogAppName = "beszel"
+	syslogTimeout = 5 * time.Second
+	// syslogMaxMessage keeps UDP datagrams below the size every receiver must accept
+	syslogMaxMessage = 2048
+)
+
+// syslogSink sends alerts to a syslog server in RFC 5424 format
+type syslogSink struct {
+	network  string // udp or tcp
+	addr     string
+	facility int
+	hostname string
+}
+
+// newSyslogSinkFromEnv creates a syslog sink from BESZEL_SYSLOG_ADDR and BESZEL_SYSLOG_FACILITY.
+// It returns nil if BESZEL_SYSLOG_ADDR is not set.
+func newSyslogSinkFromEnv() (*syslogSink, error) {
+	addr := os.Getenv("BESZEL_SYSLOG_ADDR")
+	if addr == "" {
+		return nil, nil
+	}
+	facility := os.Getenv("BESZEL_SYSLOG_FACILITY")
+	if facility == "" {
+		facility = "daemon"
+	}
+	return newSyslogSink(addr, facility)
+}
+
+// newSyslogSink creates a syslog sink for an address like udp://host:514 or tcp://host:601.
+// Addresses without a scheme use udp.
+func newSyslogSink(addr, facility string) (*syslogSink, error) {
+	network := "udp"
+	if scheme, rest, ok := strings.Cut(addr, "://"); ok {
+		network, addr = strings.ToLower(scheme), rest
+	}
+	if network != "udp" && network != "tcp" {
+		return nil, fmt.Errorf("unsupported syslog network: %s", network)
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("invalid syslog address: %w", err)
+	}
+	facilityCode, ok := syslogFacilities[strings.ToLower(facility)]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility: %s", facility)
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	return &syslogSink{network: network, addr: addr, facility: facilityCode, hostname: hostname}, nil
+}
+
+// format returns the RFC 5424 message for an alert
+func (s *syslogSink) format(data AlertMessageData, now time.Time) string {
+	severity, ok := syslogSeverities[data.Severity]
+	if !ok {
+		severity = syslogSeverities[SeverityWarning]
+	}
+	msgID := "alert"
+	if data.Resolved {
+		msgID = "resolved"
+	}
+
+	msg := data.Title
+	if data.Message != "" {
+		msg += ": " + data.Message
+	}
+	if data.Link != "" {
+		msg += " " + data.Link
+	}
+	// syslog messages are single lines
+	msg = strings.Join(strings.Fields(msg), " ")
+
+	// <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+	line := fmt.Sprintf("<%d>1 %s %s %s %d %s - %s",
+		s.facility*8+severity,
+		now.UTC().Format("2006-01-02T15:04:05.000Z07:00"),
+		s.hostname,
+		syslogAppName,
+		os.Getpid(),
+		msgID,
+		msg,
+	)
+	for len(line) > syslogMaxMessage {
+		_, size := utf8.DecodeLastRuneInString(line)
+		line = line[:len(line)-size]
+	}
+	return line
+}
+
+// Send delivers an alert to the syslog server
+func (s *syslogSink) Send(data AlertMessageData) error {
+	conn, err := net.DialTimeout(s.network, s.addr, syslogTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_ = conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+
+	line := s.format(data, time.Now())
+	if s.network == "tcp" {
+		// octet counting framing (RFC 6587)
+		line = fmt.Sprintf("%d %s", len(line), line)
+	}
+	_, err = conn.Write([]byte(line))
+	return err
+}
+
+// sendStatusChangeToSyslog sends system status changes to syslog, enabled with BESZEL_SYSLOG_STATUS_CHANGES=true
+func (am *AlertManager) sendStatusChangeToSyslog(e *core.RecordEvent) error {
+	newStatus := e.Record.GetString("status")
+	oldStatus := e.Record.Original().GetString("status")
+	if newStatus == oldStatus || am.syslog == nil {
+		return e.Next()
+	}
+
+	severity := SeverityInfo
+	switch newStatus {
+	case "down":
+		severity = SeverityError
+	case "paused":
+		severity = SeverityNotice
+	}
+	systemName := e.Record.GetString("name")
+	data := AlertMessageData{
+		Title:    fmt.Sprintf("%s status changed to %s", systemName, newStatus),
+		Message:  fmt.Sprintf("Previous status was %s.", oldStatus),
+		Link:     am.hub.MakeLink("system", systemName),
+		Severity: severity,
+		Resolved: newStatus == "up",
+	}
+	if err := am.syslog.Send(data); err != nil {
+		am.hub.Logger().Error("Failed to send status change to syslog", "err", err)
+	}
+	return e.Next()
+}
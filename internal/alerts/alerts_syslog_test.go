@@ -0,0 +1,121 @@
+package alerts
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rfc5424Regex matches <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+var rfc5424Regex = regexp.MustCompile(`^<(\d{1,3})>1 (\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{3}Z) (\S+) beszel (\d+) (\S+) - (.+)$`)
+
+func TestSyslogSinkUDP(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	sink, err := newSyslogSink("udp://"+listener.LocalAddr().String(), "local0")
+	require.NoError(t, err)
+
+	err = sink.Send(AlertMessageData{
+		Title:    "web-1 ping latency above threshold",
+		Message:  "Average latency across all ping targets was 120.00 ms\nfor the previous 1 minute.",
+		Link:     "https://hub.example.com/system/web-1",
+		Severity: SeverityWarning,
+	})
+	require.NoError(t, err)
+
+	buf := make([]byte, 4096)
+	require.NoError(t, listener.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := listener.ReadFrom(buf)
+	require.NoError(t, err)
+
+	match := rfc5424Regex.FindStringSubmatch(string(buf[:n]))
+	require.NotNil(t, match, "message should be RFC 5424: %q", string(buf[:n]))
+	// local0 (16) * 8 + warning (4)
+	assert.Equal(t, "132", match[1])
+	_, err = time.Parse(time.RFC3339Nano, match[2])
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprint(os.Getpid()), match[4])
+	assert.Equal(t, "alert", match[5])
+	assert.Equal(t, "web-1 ping latency above threshold: Average latency across all ping targets was 120.00 ms for the previous 1 minute. https://hub.example.com/system/web-1", match[6])
+}
+
+func TestSyslogSinkTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		var length int
+		if _, err := fmt.Fscanf(reader, "%d ", &length); err != nil {
+			return
+		}
+		buf := make([]byte, length)
+		if _, err := reader.Read(buf); err != nil {
+			return
+		}
+		received <- string(buf)
+	}()
+
+	sink, err := newSyslogSink("tcp://"+listener.Addr().String(), "daemon")
+	require.NoError(t, err)
+	require.NoError(t, sink.Send(AlertMessageData{
+		Title:    "Connection to web-1 is up",
+		Severity: SeverityInfo,
+		Resolved: true,
+	}))
+
+	select {
+	case message := <-received:
+		match := rfc5424Regex.FindStringSubmatch(message)
+		require.NotNil(t, match, "message should be RFC 5424: %q", message)
+		// daemon (3) * 8 + info (6)
+		assert.Equal(t, "30", match[1])
+		assert.Equal(t, "resolved", match[5])
+		assert.Equal(t, "Connection to web-1 is up", match[6])
+	case <-time.After(5 * time.Second):
+		t.Fatal("no syslog message received")
+	}
+}
+
+func TestSyslogSinkConfig(t *testing.T) {
+	sink, err := newSyslogSink("127.0.0.1:514", "LOCAL7")
+	require.NoError(t, err)
+	assert.Equal(t, "udp", sink.network)
+	assert.Equal(t, 23, sink.facility)
+
+	_, err = newSyslogSink("http://127.0.0.1:514", "daemon")
+	assert.Error(t, err)
+	_, err = newSyslogSink("udp://127.0.0.1", "daemon")
+	assert.Error(t, err)
+	_, err = newSyslogSink("udp://127.0.0.1:514", "nope")
+	assert.Error(t, err)
+
+	t.Setenv("BESZEL_SYSLOG_ADDR", "")
+	sink, err = newSyslogSinkFromEnv()
+	assert.NoError(t, err)
+	assert.Nil(t, sink, "syslog should be disabled by default")
+
+	// unknown severity falls back to warning and long messages are truncated
+	sink, err = newSyslogSink("127.0.0.1:514", "daemon")
+	require.NoError(t, err)
+	line := sink.format(AlertMessageData{Title: strings.Repeat("x", 5000)}, time.Now())
+	assert.True(t, strings.HasPrefix(line, "<28>1 "))
+	assert.Len(t, line, syslogMaxMessage)
+}
@@ -4,6 +4,7 @@ import (
 	"beszel/internal/entities/system"
 	"fmt"
 	"math"
+	"slices"
 	"strings"
 	"time"
 
@@ -13,6 +14,37 @@ import (
 	"github.com/spf13/cast"
 )
 
+// alertUnits is the unit of the values of each metric, as shown in notifications
+var alertUnits = map[string]string{
+	"PingPacketLoss":      "%",
+	"PingLatency":         " ms",
+	"PingJitter":          " ms",
+	"PingQuality":         "",
+	"PingMtu":             " bytes",
+	"SpeedtestDownload":   " Mbps",
+	"SpeedtestUpload":     " Mbps",
+	"HTTPResponseTime":    " ms",
+	"HTTPRetransmits":     "",
+	"HTTPOcspStapling":    "",
+	"SSLCertExpiry":       " days",
+	"DNSAnswerOutOfRange": "",
+	"HTTPFailures":        "% failed",
+	"HTTPErrorRate":       "% errors",
+	"DNSTime":             " ms",
+	"DNSFailures":         "% failed",
+}
+
+// crossesThreshold reports whether val triggers the alert. Speed, quality, MTU and certificate
+// expiry alerts trigger below their threshold, all other alerts above it.
+func crossesThreshold(name string, val, threshold float64) bool {
+	switch name {
+	case "SpeedtestDownload", "SpeedtestUpload", "PingQuality", "PingMtu", "SSLCertExpiry":
+		return val < threshold
+	default:
+		return val > threshold
+	}
+}
+
 func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, data *system.CombinedData) error {
 	alertRecords, err := am.hub.FindAllRecords("alerts",
 		dbx.NewExp("system={:system} AND name!='Status'", dbx.Params{"system": systemRecord.Id}),
@@ -29,7 +61,8 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, data *syst
 	for _, alertRecord := range alertRecords {
 		name := alertRecord.GetString("name")
 		var val float64
-		unit := "%"
+		var details string
+		unit := alertUnits[name]
 
 		switch name {
 		case "PingPacketLoss":
@@ -43,7 +76,6 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, data *syst
 				}
 				if hostCount > 0 {
 					val = totalPacketLoss / float64(hostCount)
-					unit = "%"
 				} else {
 					continue
 				}
@@ -57,13 +89,70 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, data *syst
 				var hostCount int
 				for _, result := range data.Stats.PingResults {
 					if result.AvgRtt > 0 { // Only include hosts that responded
-						totalLatency += result.AvgRtt
+						// prefer the smoothed value so a single noisy sample doesn't trigger
+						if result.SmoothedAvgRtt > 0 {
+							totalLatency += result.SmoothedAvgRtt
+						} else {
+							totalLatency += result.AvgRtt
+						}
 						hostCount++
 					}
 				}
 				if hostCount > 0 {
 					val = totalLatency / float64(hostCount)
-					unit = " ms"
+				} else {
+					continue
+				}
+			} else {
+				continue
+			}
+		case "PingJitter":
+			// Check average jitter across all ping targets
+			if data.Stats.PingResults != nil {
+				var totalJitter float64
+				var hostCount int
+				for _, result := range data.Stats.PingResults {
+					if result.AvgRtt > 0 { // Only include hosts that responded
+						totalJitter += result.AlertJitter()
+						hostCount++
+					}
+				}
+				if hostCount > 0 {
+					val = totalJitter / float64(hostCount)
+				} else {
+					continue
+				}
+			} else {
+				continue
+			}
+		case "PingQuality":
+			// Check average link quality index across all ping targets
+			if data.Stats.PingResults != nil {
+				var totalQuality float64
+				var hostCount int
+				for _, result := range data.Stats.PingResults {
+					totalQuality += result.QualityIndex()
+					hostCount++
+				}
+				if hostCount > 0 {
+					val = totalQuality / float64(hostCount)
+				} else {
+					continue
+				}
+			} else {
+				continue
+			}
+		case "PingMtu":
+			// Check the smallest discovered path MTU across ping targets in mtu mode
+			if data.Stats.PingResults != nil {
+				var lowestMtu int
+				for _, result := range data.Stats.PingResults {
+					if result.Mtu > 0 && (lowestMtu == 0 || result.Mtu < lowestMtu) {
+						lowestMtu = result.Mtu
+					}
+				}
+				if lowestMtu > 0 {
+					val = float64(lowestMtu)
 				} else {
 					continue
 				}
@@ -83,7 +172,6 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, data *syst
 				}
 				if serverCount > 0 {
 					val = totalDownload / float64(serverCount)
-					unit = " Mbps"
 				} else {
 					continue
 				}
@@ -91,19 +179,18 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, data *syst
 				continue
 			}
 		case "SpeedtestUpload":
-			// Check average upload speed across all speedtest servers
+			// Check average upload speed across all speedtest servers, leaving out download-only tests
 			if data.Stats.SpeedtestResults != nil {
 				var totalUpload float64
 				var serverCount int
 				for _, result := range data.Stats.SpeedtestResults {
-					if result.Status == "success" {
+					if result.Status == "success" && result.UploadSpeed > 0 {
 						totalUpload += result.UploadSpeed
 						serverCount++
 					}
 				}
 				if serverCount > 0 {
 					val = totalUpload / float64(serverCount)
-					unit = " Mbps"
 				} else {
 					continue
 				}
@@ -117,19 +204,71 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, data *syst
 				var requestCount int
 				for _, result := range data.Stats.HttpResults {
 					if result.Status == "success" && result.ResponseTime > 0 {
-						totalResponseTime += result.ResponseTime
+						// prefer the smoothed value so a single noisy sample doesn't trigger
+						if result.SmoothedResponseTime > 0 {
+							totalResponseTime += result.SmoothedResponseTime
+						} else {
+							totalResponseTime += result.ResponseTime
+						}
 						requestCount++
 					}
 				}
 				if requestCount > 0 {
 					val = totalResponseTime / float64(requestCount)
-					unit = " ms"
 				} else {
 					continue
 				}
 			} else {
 				continue
 			}
+		case "HTTPRetransmits":
+			// Check total TCP retransmits across all HTTP targets, only reported by Linux agents
+			if data.Stats.HttpResults != nil {
+				var totalRetransmits int
+				for _, result := range data.Stats.HttpResults {
+					totalRetransmits += result.TcpRetransmits
+				}
+				val = float64(totalRetransmits)
+			} else {
+				continue
+			}
+		case "HTTPOcspStapling":
+			// Count HTTPS targets with OCSP checks enabled that lack a good stapled OCSP response
+			var checked, missing int
+			for _, result := range data.Stats.HttpResults {
+				if result.Status != "success" || result.OcspStatus == "" {
+					continue
+				}
+				checked++
+				if result.OcspStatus != "good" {
+					missing++
+				}
+			}
+			if checked == 0 {
+				continue
+			}
+			val = float64(missing)
+		case "SSLCertExpiry":
+			// Check the fewest days until a certificate of the HTTPS targets expires
+			var lowestDays *int
+			for url, result := range data.Stats.HttpResults {
+				if result.CertExpiryDays != nil && (lowestDays == nil || *result.CertExpiryDays < *lowestDays) {
+					lowestDays = result.CertExpiryDays
+					details = url
+				}
+			}
+			if lowestDays == nil {
+				continue
+			}
+			val = float64(*lowestDays)
+		case "DNSAnswerOutOfRange":
+			// Count DNS answers outside the allowed CIDRs of their target
+			outOfRange, ok := am.dnsAnswersOutOfRange(systemRecord.Id, data.Stats.DnsResults)
+			if !ok {
+				continue
+			}
+			val = float64(len(outOfRange))
+			details = strings.Join(outOfRange, ", ")
 		case "HTTPFailures":
 			// Check HTTP response failures (same as HTTP but with different name)
 			if data.Stats.HttpResults != nil {
@@ -143,13 +282,26 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, data *syst
 				}
 				if totalRequests > 0 {
 					val = float64(len(failedRequests)) / float64(totalRequests) * 100
-					unit = "% failed"
 				} else {
 					continue
 				}
 			} else {
 				continue
 			}
+		case "HTTPErrorRate":
+			// Check the share of HTTP targets answering with a 4xx or 5xx status
+			if len(data.Stats.HttpResults) == 0 {
+				continue
+			}
+			var errorURLs []string
+			for url, result := range data.Stats.HttpResults {
+				if result.StatusCode >= 400 {
+					errorURLs = append(errorURLs, fmt.Sprintf("%s (%d)", url, result.StatusCode))
+				}
+			}
+			slices.Sort(errorURLs)
+			val = float64(len(errorURLs)) / float64(len(data.Stats.HttpResults)) * 100
+			details = strings.Join(errorURLs, ", ")
 		case "DNSTime":
 			// Check average DNS lookup time across all DNS targets
 			if data.Stats.DnsResults != nil {
@@ -163,7 +315,6 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, data *syst
 				}
 				if lookupCount > 0 {
 					val = totalLookupTime / float64(lookupCount)
-					unit = " ms"
 				} else {
 					continue
 				}
@@ -183,7 +334,6 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, data *syst
 				}
 				if totalLookups > 0 {
 					val = float64(len(failedLookups)) / float64(totalLookups) * 100
-					unit = "% failed"
 				} else {
 					continue
 				}
@@ -195,28 +345,33 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, data *syst
 			continue
 		}
 
+		// speeds of alerts in percent of plan mode are compared as a percentage of the plan
+		plan := planSpeed(systemRecord, alertRecord)
+		if alertRecord.GetString("threshold_mode") == thresholdModePlan && plan <= 0 {
+			continue
+		}
+		if plan > 0 {
+			val = percentOfPlan(val, plan)
+			unit = "% of plan"
+		}
+
 		triggered := alertRecord.GetBool("triggered")
 		threshold := alertRecord.GetFloat("value")
 
-		// Determine if we should trigger based on metric type
-		var shouldTrigger bool
-		switch name {
-		case "SpeedtestDownload", "SpeedtestUpload":
-			// For speed metrics, alert when value is BELOW threshold
-			shouldTrigger = (!triggered && val < threshold) || (triggered && val >= threshold)
-			// Debug logging
-
-		case "DNSFailures", "HTTPFailures", "PingPacketLoss", "PingLatency":
-			// For failure/performance metrics, alert when value is ABOVE threshold
-			shouldTrigger = (!triggered && val > threshold) || (triggered && val <= threshold)
-		case "DNSTime", "HTTPResponseTime":
-			// For time-based metrics, alert when value is ABOVE threshold
-			shouldTrigger = (!triggered && val > threshold) || (triggered && val <= threshold)
-		default:
-			// For other metrics, use existing logic
-			shouldTrigger = (!triggered && val <= threshold) || (triggered && val > threshold)
+		// per target modes replace the average with the worst target
+		aggregation := alertRecord.GetString("aggregation")
+		perTarget := perTargetAggregation(aggregation, name)
+		if perTarget {
+			values := alertTargetValues(name, &data.Stats)
+			if len(values) == 0 {
+				continue
+			}
+			val, details = worstTarget(values, aggregation, threshold, name == "PingQuality")
 		}
 
+		// the alert changes state if the value is on the other side of the threshold
+		shouldTrigger := crossesThreshold(name, val, threshold) != triggered
+
 		// CONTINUE
 		// IF alert should not trigger
 		if !shouldTrigger {
@@ -235,25 +390,17 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, data *syst
 			threshold:    threshold,
 			triggered:    triggered,
 			min:          min,
+			details:      details,
+			plan:         plan,
+		}
+		if perTarget {
+			alert.aggregation = aggregation
 		}
 
 		// send alert immediately if min is 1 - no need to sum up values.
-		if min == 1 {
-			// Determine if alert should be triggered based on metric type
-			switch alert.name {
-			case "SpeedtestDownload", "SpeedtestUpload":
-				// For speed metrics, alert when value is below threshold
-				alert.triggered = val < threshold
-			case "DNSFailures", "HTTPFailures", "PingPacketLoss", "PingLatency":
-				// For failure/performance metrics, alert when value is above threshold
-				alert.triggered = val > threshold
-			case "DNSTime", "HTTPResponseTime":
-				// For time-based metrics, alert when value is above threshold
-				alert.triggered = val > threshold
-			default:
-				// For other metrics, use existing logic
-				alert.triggered = val > threshold
-			}
+		// MTU changes, retransmit counts, OCSP stapling, certificate expiry, DNS answers and per target values are not averaged, so they are always sent immediately.
+		if min == 1 || perTarget || name == "PingMtu" || name == "HTTPRetransmits" || name == "HTTPOcspStapling" || name == "SSLCertExpiry" || name == "DNSAnswerOutOfRange" {
+			alert.triggered = crossesThreshold(alert.name, val, threshold)
 			go am.sendSystemAlert(alert)
 			continue
 		}
@@ -266,21 +413,29 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, data *syst
 		validAlerts = append(validAlerts, alert)
 	}
 
+	// all alerts were sent immediately, nothing to average
+	if len(validAlerts) == 0 {
+		return nil
+	}
+
 	// Query system_averages collection for historical data
 	systemAverages := []struct {
 		PingLatency     *float64       `db:"ping_latency"`
 		PingPacketLoss  *float64       `db:"ping_packet_loss"`
+		PingQuality     *float64       `db:"ping_quality"`
+		PingJitter      *float64       `db:"ping_jitter"`
 		DnsLatency      *float64       `db:"dns_latency"`
 		DnsFailureRate  *float64       `db:"dns_failure_rate"`
 		HttpLatency     *float64       `db:"http_latency"`
 		HttpFailureRate *float64       `db:"http_failure_rate"`
+		HttpErrorRate   *float64       `db:"http_error_rate"`
 		DownloadSpeed   *float64       `db:"download_speed"`
 		UploadSpeed     *float64       `db:"upload_speed"`
 		Created         types.DateTime `db:"created"`
 	}{}
 
 	err = am.hub.DB().NewQuery(`
-		SELECT ping_latency, ping_packet_loss, dns_latency, dns_failure_rate, http_latency, http_failure_rate, download_speed, upload_speed, created
+		SELECT ping_latency, ping_packet_loss, ping_quality, ping_jitter, dns_latency, dns_failure_rate, http_latency, http_failure_rate, http_error_rate, download_speed, upload_speed, created
 		FROM system_averages 
 		WHERE system = {:system} AND created > {:created}
 		ORDER BY created
@@ -330,7 +485,8 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, data *syst
 
 					}
 				case "SpeedtestUpload":
-					if avg.UploadSpeed != nil {
+					// averages of download-only tests have no upload speed
+					if avg.UploadSpeed != nil && *avg.UploadSpeed > 0 {
 						metricValue = *avg.UploadSpeed
 						hasValue = true
 					}
@@ -344,6 +500,16 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, data *syst
 						metricValue = *avg.PingLatency
 						hasValue = true
 					}
+				case "PingJitter":
+					if avg.PingJitter != nil {
+						metricValue = *avg.PingJitter
+						hasValue = true
+					}
+				case "PingQuality":
+					if avg.PingQuality != nil {
+						metricValue = *avg.PingQuality
+						hasValue = true
+					}
 				case "HTTPResponseTime":
 					if avg.HttpLatency != nil {
 						metricValue = *avg.HttpLatency
@@ -354,6 +520,11 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, data *syst
 						metricValue = *avg.HttpFailureRate
 						hasValue = true
 					}
+				case "HTTPErrorRate":
+					if avg.HttpErrorRate != nil {
+						metricValue = *avg.HttpErrorRate
+						hasValue = true
+					}
 				case "DNSTime":
 					if avg.DnsLatency != nil {
 						metricValue = *avg.DnsLatency
@@ -375,25 +546,12 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, data *syst
 
 		if count > 0 {
 			averageValue := math.Round((sum/float64(count))*100) / 100
+			if alert.plan > 0 {
+				averageValue = percentOfPlan(sum/float64(count), alert.plan)
+			}
 			alert.val = averageValue
 
-			// Determine if alert should be triggered based on metric type
-			switch alert.name {
-			case "SpeedtestDownload", "SpeedtestUpload":
-				// For speed metrics, alert when average is below threshold
-				alert.triggered = averageValue < alert.threshold
-				// Debug logging
-				fmt.Printf("Final SpeedtestDownload: average=%.2f, threshold=%.2f, triggered=%v\n", averageValue, alert.threshold, alert.triggered)
-			case "DNSFailures", "HTTPFailures", "PingPacketLoss", "PingLatency":
-				// For failure/performance metrics, alert when average is above threshold
-				alert.triggered = averageValue > alert.threshold
-			case "DNSTime", "HTTPResponseTime":
-				// For time-based metrics, alert when average is above threshold
-				alert.triggered = averageValue > alert.threshold
-			default:
-				// For other metrics, use existing logic
-				alert.triggered = averageValue > alert.threshold
-			}
+			alert.triggered = crossesThreshold(alert.name, averageValue, alert.threshold)
 
 			go am.sendSystemAlert(alert)
 		}
@@ -406,9 +564,69 @@ func (am *AlertManager) sendSystemAlert(alert SystemAlertData) {
 	// Debug logging
 	am.hub.Logger().Info("sendSystemAlert called", "alertName", alert.name, "value", alert.val, "threshold", alert.threshold, "triggered", alert.triggered)
 
+	systemName := alert.systemRecord.GetString("name")
+	subject, body := systemAlertMessage(alert)
+
+	// maintenance windows hold back all notifications, the cooldown triggers within it of the
+	// last notified one along with their resolves, so a flapping alert notifies once per
+	// cooldown. The triggered state is saved regardless.
+	inMaintenance := am.IsInMaintenance(alert.systemRecord.Id)
+	notify := !inMaintenance
+	if alert.triggered {
+		now := time.Now().UTC()
+		cooldown := time.Duration(alert.alertRecord.GetInt("cooldown")) * time.Minute
+		lastNotified := alert.alertRecord.GetDateTime("last_notified").Time()
+		heldBack := cooldown > 0 && !lastNotified.IsZero() && now.Sub(lastNotified) < cooldown
+		alert.alertRecord.Set("held_back", heldBack)
+		if heldBack {
+			notify = false
+		} else if notify {
+			alert.alertRecord.Set("last_notified", now)
+		}
+	} else if alert.alertRecord.GetBool("held_back") {
+		// the trigger wasn't notified, so neither is its resolve
+		alert.alertRecord.Set("held_back", false)
+		notify = false
+	}
+
+	alert.alertRecord.Set("triggered", alert.triggered)
+	if err := am.hub.Save(alert.alertRecord); err != nil {
+		// app.Logger().Error("failed to save alert record", "err", err)
+		return
+	}
+	if !notify {
+		am.hub.Logger().Info("Alert notification held back", "alertName", alert.name, "system", systemName, "maintenance", inMaintenance)
+		return
+	}
+	severity := SeverityWarning
+	if !alert.triggered {
+		severity = SeverityNotice
+	}
+	am.SendAlert(AlertMessageData{
+		UserID:   "", // Not used anymore - sends to all users
+		Type:     alert.alertRecord.GetString("name"),
+		Title:    subject,
+		Message:  body,
+		Link:     am.hub.MakeLink("system", systemName),
+		LinkText: "View " + systemName,
+		Severity: severity,
+		Resolved: !alert.triggered,
+		Key:      alert.alertRecord.Id,
+		System:   systemName,
+		Metric: &AlertMetric{
+			Name:         alert.name,
+			Value:        alert.val,
+			Unit:         alert.unit,
+			LowerIsWorse: slices.Contains([]string{"SpeedtestDownload", "SpeedtestUpload", "PingQuality", "PingMtu", "SSLCertExpiry"}, alert.name),
+			Threshold:    alert.threshold,
+		},
+	})
+}
+
+// systemAlertMessage returns the notification subject and body of a system alert
+func systemAlertMessage(alert SystemAlertData) (subject, body string) {
 	systemName := alert.systemRecord.GetString("name")
 
-	// change Disk to Disk usage
 	if alert.name == "Disk" {
 		alert.name += " usage"
 	}
@@ -423,15 +641,14 @@ func (am *AlertManager) sendSystemAlert(alert SystemAlertData) {
 		titleAlertName = strings.ToLower(titleAlertName)
 	}
 
-	var subject string
 	if alert.triggered {
 		// Determine the appropriate message based on metric type
 		switch alert.name {
-		case "SpeedtestDownload", "SpeedtestUpload":
+		case "SpeedtestDownload", "SpeedtestUpload", "PingQuality", "PingMtu", "SSLCertExpiry":
 			subject = fmt.Sprintf("%s %s below threshold", systemName, titleAlertName)
-		case "DNSFailures", "HTTPFailures", "PingPacketLoss", "PingLatency":
+		case "DNSFailures", "HTTPFailures", "HTTPErrorRate", "PingPacketLoss", "PingLatency", "PingJitter":
 			subject = fmt.Sprintf("%s %s above threshold", systemName, titleAlertName)
-		case "DNSTime", "HTTPResponseTime":
+		case "DNSTime", "HTTPResponseTime", "HTTPRetransmits", "HTTPOcspStapling", "DNSAnswerOutOfRange":
 			subject = fmt.Sprintf("%s %s above threshold", systemName, titleAlertName)
 		default:
 			subject = fmt.Sprintf("%s %s above threshold", systemName, titleAlertName)
@@ -439,11 +656,11 @@ func (am *AlertManager) sendSystemAlert(alert SystemAlertData) {
 	} else {
 		// Determine the appropriate message based on metric type
 		switch alert.name {
-		case "SpeedtestDownload", "SpeedtestUpload":
+		case "SpeedtestDownload", "SpeedtestUpload", "PingQuality", "PingMtu", "SSLCertExpiry":
 			subject = fmt.Sprintf("%s %s above threshold", systemName, titleAlertName)
-		case "DNS", "HTTP", "DNSFailures", "HTTPFailures", "PingPacketLoss", "PingLatency":
+		case "DNS", "HTTP", "DNSFailures", "HTTPFailures", "HTTPErrorRate", "PingPacketLoss", "PingLatency", "PingJitter":
 			subject = fmt.Sprintf("%s %s below threshold", systemName, titleAlertName)
-		case "DNSTime", "HTTPResponseTime":
+		case "DNSTime", "HTTPResponseTime", "HTTPRetransmits", "HTTPOcspStapling", "DNSAnswerOutOfRange":
 			subject = fmt.Sprintf("%s %s below threshold", systemName, titleAlertName)
 		default:
 			subject = fmt.Sprintf("%s %s below threshold", systemName, titleAlertName)
@@ -458,9 +675,12 @@ func (am *AlertManager) sendSystemAlert(alert SystemAlertData) {
 	}
 
 	// Create appropriate message body based on metric type
-	var body string
 	switch alert.name {
 	case "SpeedtestDownload", "SpeedtestUpload":
+		if alert.plan > 0 {
+			body = planAlertBody(alert, minutesLabel)
+			break
+		}
 		body = fmt.Sprintf("Average %s across all speedtest servers was %.2f%s for the previous %v %s.",
 			strings.ToLower(alert.name), alert.val, alert.unit, alert.min, minutesLabel)
 	case "PingPacketLoss":
@@ -469,6 +689,15 @@ func (am *AlertManager) sendSystemAlert(alert SystemAlertData) {
 	case "PingLatency":
 		body = fmt.Sprintf("Average latency across all ping targets was %.2f%s for the previous %v %s.",
 			alert.val, alert.unit, alert.min, minutesLabel)
+	case "PingJitter":
+		body = fmt.Sprintf("Average jitter across all ping targets was %.2f%s for the previous %v %s.",
+			alert.val, alert.unit, alert.min, minutesLabel)
+	case "PingQuality":
+		body = fmt.Sprintf("Average link quality index across all ping targets was %.2f for the previous %v %s.",
+			alert.val, alert.min, minutesLabel)
+	case "PingMtu":
+		body = fmt.Sprintf("Smallest discovered path MTU across ping targets is %.0f%s, expected at least %.0f%s. Larger packets are dropped, which often indicates a tunnel or fragmentation issue.",
+			alert.val, alert.unit, alert.threshold, alert.unit)
 	case "DNSTime":
 		body = fmt.Sprintf("Average DNS lookup time across all targets was %.2f%s for the previous %v %s.",
 			alert.val, alert.unit, alert.min, minutesLabel)
@@ -478,24 +707,49 @@ func (am *AlertManager) sendSystemAlert(alert SystemAlertData) {
 	case "HTTPResponseTime":
 		body = fmt.Sprintf("Average HTTP response time across all targets was %.2f%s for the previous %v %s.",
 			alert.val, alert.unit, alert.min, minutesLabel)
+	case "DNSAnswerOutOfRange":
+		if alert.triggered {
+			body = fmt.Sprintf("DNS answers outside the allowed IP ranges: %s. This may indicate a hijack or an unexpected failover.", alert.details)
+		} else {
+			body = "All DNS answers are within the allowed IP ranges again."
+		}
+	case "HTTPRetransmits":
+		body = fmt.Sprintf("HTTP checks across all targets retransmitted %.0f TCP segments, above the threshold of %.0f. This often indicates packet loss on the path.",
+			alert.val, alert.threshold)
+	case "HTTPOcspStapling":
+		body = fmt.Sprintf("%.0f HTTPS targets are missing a good stapled OCSP response. Stapling often stops working after a certificate renewal.",
+			alert.val)
+	case "SSLCertExpiry":
+		if alert.triggered {
+			body = fmt.Sprintf("The certificate of %s expires in %.0f%s, fewer than the threshold of %.0f%s.",
+				alert.details, alert.val, alert.unit, alert.threshold, alert.unit)
+		} else {
+			body = fmt.Sprintf("All HTTPS certificates expire in at least %.0f%s again.", alert.threshold, alert.unit)
+		}
 	case "HTTPFailures":
 		body = fmt.Sprintf("HTTP request failures averaged %.2f%s for the previous %v %s.",
 			alert.val, alert.unit, alert.min, minutesLabel)
+	case "HTTPErrorRate":
+		body = fmt.Sprintf("HTTP 4xx and 5xx responses averaged %.2f%s for the previous %v %s.",
+			alert.val, alert.unit, alert.min, minutesLabel)
+		if alert.details != "" {
+			body += " Failing URLs: " + alert.details + "."
+		}
 	default:
 		body = fmt.Sprintf("%s averaged %.2f%s for the previous %v %s.",
 			alert.descriptor, alert.val, alert.unit, alert.min, minutesLabel)
 	}
 
-	alert.alertRecord.Set("triggered", alert.triggered)
-	if err := am.hub.Save(alert.alertRecord); err != nil {
-		// app.Logger().Error("failed to save alert record", "err", err)
-		return
+	// per target alerts name the offending targets instead of an average
+	if alert.aggregation != "" {
+		if alert.triggered {
+			body = fmt.Sprintf("%s crossed the threshold of %.2f%s on %s. The worst target was at %.2f%s.",
+				targetMetricLabels[alert.name], alert.threshold, alert.unit, alert.details, alert.val, alert.unit)
+		} else {
+			body = fmt.Sprintf("%s is within the threshold of %.2f%s on all targets again. The worst target, %s, is at %.2f%s.",
+				targetMetricLabels[alert.name], alert.threshold, alert.unit, alert.details, alert.val, alert.unit)
+		}
 	}
-	am.SendAlert(AlertMessageData{
-		UserID:   "", // Not used anymore - sends to all users
-		Title:    subject,
-		Message:  body,
-		Link:     am.hub.MakeLink("system", systemName),
-		LinkText: "View " + systemName,
-	})
+
+	return subject, body
 }
@@ -0,0 +1,403 @@
+//go:build testing
+// +build testing
+
+package alerts_test
+
+import (
+	"beszel/internal/entities/system"
+	"beszel/internal/tests"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPerTargetAlert(t *testing.T) {
+	// receive alert messages through the syslog sink
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	t.Setenv("BESZEL_SYSLOG_ADDR", "udp://"+listener.LocalAddr().String())
+
+	hub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer hub.Cleanup()
+
+	user, err := tests.CreateUser(hub, "test@test.com", "testtesttest")
+	require.NoError(t, err)
+	systemRecord, err := tests.CreateRecord(hub, "systems", map[string]any{
+		"name":  "ping-system",
+		"host":  "localhost",
+		"port":  "45876",
+		"users": []string{user.Id},
+	})
+	require.NoError(t, err)
+
+	// a time window would average, per target alerts are evaluated right away
+	alert, err := tests.CreateRecord(hub, "alerts", map[string]any{
+		"name":        "PingLatency",
+		"system":      systemRecord.Id,
+		"user":        user.Id,
+		"value":       100,
+		"min":         10,
+		"aggregation": "any",
+	})
+	require.NoError(t, err)
+
+	pingData := func(slowLatency float64) *system.CombinedData {
+		return &system.CombinedData{Stats: system.Stats{PingResults: map[string]*system.PingResult{
+			"1.1.1.1": {Host: "1.1.1.1", AvgRtt: 20, LastChecked: time.Now()},
+			"9.9.9.9": {Host: "9.9.9.9", AvgRtt: 25, LastChecked: time.Now()},
+			"8.8.8.8": {Host: "8.8.8.8", AvgRtt: slowLatency, LastChecked: time.Now()},
+		}}}
+	}
+	readMessage := func() string {
+		buf := make([]byte, 4096)
+		require.NoError(t, listener.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, _, err := listener.ReadFrom(buf)
+		require.NoError(t, err)
+		return string(buf[:n])
+	}
+	triggered := func() bool {
+		record, err := hub.FindRecordById("alerts", alert.Id)
+		require.NoError(t, err)
+		return record.GetBool("triggered")
+	}
+
+	// one slow host triggers although the average of 98.33 ms is below the threshold
+	require.NoError(t, hub.HandleSystemAlerts(systemRecord, pingData(250)))
+	message := readMessage()
+	assert.Contains(t, message, "ping-system pinglatency above threshold")
+	assert.Contains(t, message, "Ping latency crossed the threshold of 100.00 ms on 8.8.8.8 (250.00)")
+	assert.Eventually(t, triggered, time.Second, 10*time.Millisecond)
+
+	// and resolves once it recovers
+	require.NoError(t, hub.HandleSystemAlerts(systemRecord, pingData(40)))
+	message = readMessage()
+	assert.Contains(t, message, "within the threshold of 100.00 ms on all targets again. The worst target, 8.8.8.8, is at 40.00 ms")
+	assert.Eventually(t, func() bool { return !triggered() }, time.Second, 10*time.Millisecond)
+}
+
+func TestHTTPErrorRateAlert(t *testing.T) {
+	// receive alert messages through the syslog sink
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	t.Setenv("BESZEL_SYSLOG_ADDR", "udp://"+listener.LocalAddr().String())
+
+	hub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer hub.Cleanup()
+
+	user, err := tests.CreateUser(hub, "test@test.com", "testtesttest")
+	require.NoError(t, err)
+	systemRecord, err := tests.CreateRecord(hub, "systems", map[string]any{
+		"name":  "http-system",
+		"host":  "localhost",
+		"port":  "45876",
+		"users": []string{user.Id},
+	})
+	require.NoError(t, err)
+
+	_, err = tests.CreateRecord(hub, "alerts", map[string]any{
+		"name":   "HTTPErrorRate",
+		"system": systemRecord.Id,
+		"user":   user.Id,
+		"value":  20,
+		"min":    1,
+	})
+	require.NoError(t, err)
+
+	// error responses are successful checks without expected status codes
+	data := &system.CombinedData{Stats: system.Stats{HttpResults: map[string]*system.HttpResult{
+		"https://ok.example.com":      {URL: "https://ok.example.com", Status: "success", StatusCode: 200, LastChecked: time.Now()},
+		"https://missing.example.com": {URL: "https://missing.example.com", Status: "success", StatusCode: 404, LastChecked: time.Now()},
+		"https://broken.example.com":  {URL: "https://broken.example.com", Status: "success", StatusCode: 503, LastChecked: time.Now()},
+		"https://down.example.com":    {URL: "https://down.example.com", Status: "error", LastChecked: time.Now()},
+	}}}
+	require.NoError(t, hub.HandleSystemAlerts(systemRecord, data))
+
+	buf := make([]byte, 4096)
+	require.NoError(t, listener.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := listener.ReadFrom(buf)
+	require.NoError(t, err)
+	message := string(buf[:n])
+	assert.Contains(t, message, "http-system httperrorrate above threshold")
+	assert.Contains(t, message, "HTTP 4xx and 5xx responses averaged 50.00% errors")
+	assert.Contains(t, message, "Failing URLs: https://broken.example.com (503), https://missing.example.com (404).")
+}
+
+func TestMaintenanceWindowHoldsBackAlerts(t *testing.T) {
+	// receive alert messages through the syslog sink
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	t.Setenv("BESZEL_SYSLOG_ADDR", "udp://"+listener.LocalAddr().String())
+
+	hub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer hub.Cleanup()
+
+	user, err := tests.CreateUser(hub, "test@test.com", "testtesttest")
+	require.NoError(t, err)
+	systemRecord, err := tests.CreateRecord(hub, "systems", map[string]any{
+		"name":  "ping-system",
+		"host":  "localhost",
+		"port":  "45876",
+		"users": []string{user.Id},
+	})
+	require.NoError(t, err)
+
+	alert, err := tests.CreateRecord(hub, "alerts", map[string]any{
+		"name":   "PingLatency",
+		"system": systemRecord.Id,
+		"user":   user.Id,
+		"value":  100,
+		"min":    1,
+	})
+	require.NoError(t, err)
+
+	window, err := tests.CreateRecord(hub, "maintenance_windows", map[string]any{
+		"system": systemRecord.Id,
+		"start":  time.Now().UTC().Add(-time.Minute),
+		"end":    time.Now().UTC().Add(time.Hour),
+	})
+	require.NoError(t, err)
+	assert.True(t, hub.IsInMaintenance(systemRecord.Id))
+
+	pingData := func(latency float64) *system.CombinedData {
+		return &system.CombinedData{Stats: system.Stats{PingResults: map[string]*system.PingResult{
+			"1.1.1.1": {Host: "1.1.1.1", AvgRtt: latency, LastChecked: time.Now()},
+		}}}
+	}
+	readMessage := func(timeout time.Duration) (string, error) {
+		buf := make([]byte, 4096)
+		require.NoError(t, listener.SetReadDeadline(time.Now().Add(timeout)))
+		n, _, err := listener.ReadFrom(buf)
+		return string(buf[:n]), err
+	}
+	triggered := func() bool {
+		record, err := hub.FindRecordById("alerts", alert.Id)
+		require.NoError(t, err)
+		return record.GetBool("triggered")
+	}
+
+	// in the window the alert triggers without a notification
+	require.NoError(t, hub.HandleSystemAlerts(systemRecord, pingData(250)))
+	assert.Eventually(t, triggered, time.Second, 10*time.Millisecond)
+	_, err = readMessage(200 * time.Millisecond)
+	assert.Error(t, err, "no notification during maintenance")
+
+	// after the window notifications are sent again
+	require.NoError(t, hub.Delete(window))
+	assert.False(t, hub.IsInMaintenance(systemRecord.Id))
+	require.NoError(t, hub.HandleSystemAlerts(systemRecord, pingData(50)))
+	message, err := readMessage(5 * time.Second)
+	require.NoError(t, err)
+	assert.Contains(t, message, "ping-system pinglatency below threshold")
+}
+
+func TestSpeedtestPlanAlert(t *testing.T) {
+	// receive alert messages through the syslog sink
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	t.Setenv("BESZEL_SYSLOG_ADDR", "udp://"+listener.LocalAddr().String())
+
+	hub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer hub.Cleanup()
+
+	user, err := tests.CreateUser(hub, "test@test.com", "testtesttest")
+	require.NoError(t, err)
+	systemRecord, err := tests.CreateRecord(hub, "systems", map[string]any{
+		"name":          "speed-system",
+		"host":          "localhost",
+		"port":          "45876",
+		"users":         []string{user.Id},
+		"plan_download": 1000,
+	})
+	require.NoError(t, err)
+
+	download, err := tests.CreateRecord(hub, "alerts", map[string]any{
+		"name":           "SpeedtestDownload",
+		"system":         systemRecord.Id,
+		"user":           user.Id,
+		"value":          80,
+		"min":            1,
+		"threshold_mode": "percent_of_plan",
+	})
+	require.NoError(t, err)
+	// without an upload plan the alert can't be evaluated
+	upload, err := tests.CreateRecord(hub, "alerts", map[string]any{
+		"name":           "SpeedtestUpload",
+		"system":         systemRecord.Id,
+		"user":           user.Id,
+		"value":          80,
+		"min":            1,
+		"threshold_mode": "percent_of_plan",
+	})
+	require.NoError(t, err)
+
+	speedtestData := func(downloadSpeed float64) *system.CombinedData {
+		return &system.CombinedData{Stats: system.Stats{SpeedtestResults: map[string]*system.SpeedtestResult{
+			"1": {Status: "success", DownloadSpeed: downloadSpeed, UploadSpeed: 1, LastChecked: time.Now()},
+		}}}
+	}
+	readMessage := func() string {
+		buf := make([]byte, 4096)
+		require.NoError(t, listener.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, _, err := listener.ReadFrom(buf)
+		require.NoError(t, err)
+		return string(buf[:n])
+	}
+	triggered := func(id string) bool {
+		record, err := hub.FindRecordById("alerts", id)
+		require.NoError(t, err)
+		return record.GetBool("triggered")
+	}
+
+	// 900 Mbps is 90% of the plan, above the threshold although the threshold is far below the speed
+	require.NoError(t, hub.HandleSystemAlerts(systemRecord, speedtestData(900)))
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, triggered(download.Id))
+
+	// 640 Mbps is 64% of the plan
+	require.NoError(t, hub.HandleSystemAlerts(systemRecord, speedtestData(640)))
+	message := readMessage()
+	assert.Contains(t, message, "speed-system speedtestdownload below threshold")
+	assert.Contains(t, message, "was 640.00 Mbps, 64.00% of the 1000 Mbps plan")
+	assert.Contains(t, message, "The threshold is 80% of the plan")
+	assert.Eventually(t, func() bool { return triggered(download.Id) }, time.Second, 10*time.Millisecond)
+	assert.False(t, triggered(upload.Id))
+
+	require.NoError(t, hub.HandleSystemAlerts(systemRecord, speedtestData(850)))
+	message = readMessage()
+	assert.Contains(t, message, "speed-system speedtestdownload above threshold")
+	assert.Eventually(t, func() bool { return !triggered(download.Id) }, time.Second, 10*time.Millisecond)
+}
+
+func TestSpeedtestUploadSkipsDownloadOnlyTests(t *testing.T) {
+	hub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer hub.Cleanup()
+
+	user, err := tests.CreateUser(hub, "test@test.com", "testtesttest")
+	require.NoError(t, err)
+	systemRecord, err := tests.CreateRecord(hub, "systems", map[string]any{
+		"name":        "speed-system",
+		"host":        "localhost",
+		"port":        "45876",
+		"users":       []string{user.Id},
+		"plan_upload": 100,
+	})
+	require.NoError(t, err)
+	upload, err := tests.CreateRecord(hub, "alerts", map[string]any{
+		"name":           "SpeedtestUpload",
+		"system":         systemRecord.Id,
+		"user":           user.Id,
+		"value":          80,
+		"min":            1,
+		"threshold_mode": "percent_of_plan",
+	})
+	require.NoError(t, err)
+	triggered := func() bool {
+		record, err := hub.FindRecordById("alerts", upload.Id)
+		require.NoError(t, err)
+		return record.GetBool("triggered")
+	}
+
+	// the HTTP file provider measures the download only, its upload of 0 isn't averaged in
+	require.NoError(t, hub.HandleSystemAlerts(systemRecord, &system.CombinedData{Stats: system.Stats{SpeedtestResults: map[string]*system.SpeedtestResult{
+		"1":    {Status: "success", DownloadSpeed: 500, UploadSpeed: 90, LastChecked: time.Now()},
+		"file": {Status: "success", DownloadSpeed: 500, LastChecked: time.Now()},
+	}}}))
+	require.NoError(t, hub.HandleSystemAlerts(systemRecord, &system.CombinedData{Stats: system.Stats{SpeedtestResults: map[string]*system.SpeedtestResult{
+		"file": {Status: "success", DownloadSpeed: 500, LastChecked: time.Now()},
+	}}}))
+	time.Sleep(100 * time.Millisecond)
+	assert.False(t, triggered())
+}
+
+func TestAlertTypeDisabledByUser(t *testing.T) {
+	// receive alert messages through the syslog sink, which gets every alert
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	t.Setenv("BESZEL_SYSLOG_ADDR", "udp://"+listener.LocalAddr().String())
+
+	hub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer hub.Cleanup()
+
+	// each user gets notified through a Slack webhook of their own
+	var mu sync.Mutex
+	received := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		received[r.URL.Path]++
+	}))
+	defer server.Close()
+	notifications := func(path string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return received[path]
+	}
+	createUser := func(email string, settings map[string]any) string {
+		user, err := tests.CreateUser(hub, email, "testtesttest")
+		require.NoError(t, err)
+		record, err := tests.CreateRecord(hub, "user_settings", map[string]any{"user": user.Id})
+		require.NoError(t, err)
+		settings["channels"] = []map[string]any{{"type": "slack", "webhook_url": server.URL + "/" + user.Id}}
+		settings["alert_webhook"] = map[string]any{"url": server.URL + "/alert-webhook/" + user.Id}
+		record.Set("settings", settings)
+		require.NoError(t, hub.Save(record))
+		return user.Id
+	}
+	optedOut := createUser("opted-out@test.com", map[string]any{"alerts": map[string]bool{"PingLatency": false, "PingPacketLoss": true}})
+	subscribed := createUser("subscribed@test.com", map[string]any{"alerts": map[string]bool{"PingPacketLoss": false}})
+
+	systemRecord, err := tests.CreateRecord(hub, "systems", map[string]any{
+		"name":  "ping-system",
+		"host":  "localhost",
+		"port":  "45876",
+		"users": []string{optedOut, subscribed},
+	})
+	require.NoError(t, err)
+	alert, err := tests.CreateRecord(hub, "alerts", map[string]any{
+		"name":   "PingLatency",
+		"system": systemRecord.Id,
+		"user":   optedOut,
+		"value":  100,
+		"min":    1,
+	})
+	require.NoError(t, err)
+
+	pingData := &system.CombinedData{Stats: system.Stats{PingResults: map[string]*system.PingResult{
+		"1.1.1.1": {Host: "1.1.1.1", AvgRtt: 150, LastChecked: time.Now()},
+	}}}
+	require.NoError(t, hub.HandleSystemAlerts(systemRecord, pingData))
+
+	buf := make([]byte, 4096)
+	require.NoError(t, listener.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := listener.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Contains(t, string(buf[:n]), "ping-system pinglatency above threshold")
+
+	assert.Eventually(t, func() bool { return notifications("/"+subscribed) == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Zero(t, notifications("/"+optedOut), "the user turned the alert type off")
+	// alert webhooks follow the preferences as well
+	assert.Eventually(t, func() bool { return notifications("/alert-webhook/"+subscribed) == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Zero(t, notifications("/alert-webhook/"+optedOut), "the user turned the alert type off")
+
+	// the alert is triggered all the same
+	record, err := hub.FindRecordById("alerts", alert.Id)
+	require.NoError(t, err)
+	assert.True(t, record.GetBool("triggered"))
+}
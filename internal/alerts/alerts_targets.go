@@ -0,0 +1,100 @@
+package alerts
+
+import (
+	"beszel/internal/entities/system"
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Aggregation modes of alerts. Averages hide a single failing target behind healthy ones,
+// so "max" and "any" evaluate every target on its own.
+const (
+	aggregationAvg = "avg" // Average across all targets, the default
+	aggregationMax = "max" // Worst single target
+	aggregationAny = "any" // Worst single target, reporting every target past the threshold
+)
+
+// targetMetricLabels names the metrics of alerts that can be evaluated per target
+var targetMetricLabels = map[string]string{
+	"PingLatency":      "Ping latency",
+	"PingPacketLoss":   "Ping packet loss",
+	"PingJitter":       "Ping jitter",
+	"PingQuality":      "Link quality index",
+	"HTTPResponseTime": "HTTP response time",
+	"DNSTime":          "DNS lookup time",
+}
+
+// perTargetAggregation reports whether the alert is evaluated per target
+func perTargetAggregation(aggregation, name string) bool {
+	_, ok := targetMetricLabels[name]
+	return ok && (aggregation == aggregationMax || aggregation == aggregationAny)
+}
+
+// alertTargetValues returns the value of the alert's metric for each target that has one
+func alertTargetValues(name string, stats *system.Stats) map[string]float64 {
+	values := make(map[string]float64)
+	switch name {
+	case "PingLatency", "PingPacketLoss", "PingJitter", "PingQuality":
+		for host, result := range stats.PingResults {
+			switch name {
+			case "PingPacketLoss":
+				values[host] = result.PacketLoss
+			case "PingQuality":
+				values[host] = result.QualityIndex()
+			case "PingLatency":
+				if result.AvgRtt > 0 { // Only include hosts that responded
+					values[host] = cmp.Or(result.SmoothedAvgRtt, result.AvgRtt)
+				}
+			case "PingJitter":
+				if result.AvgRtt > 0 {
+					values[host] = result.AlertJitter()
+				}
+			}
+		}
+	case "HTTPResponseTime":
+		for url, result := range stats.HttpResults {
+			if result.Status == "success" && result.ResponseTime > 0 {
+				values[url] = cmp.Or(result.SmoothedResponseTime, result.ResponseTime)
+			}
+		}
+	case "DNSTime":
+		for key, result := range stats.DnsResults {
+			if result.Status == "success" && result.LookupTime > 0 {
+				values[key] = result.LookupTime
+			}
+		}
+	}
+	return values
+}
+
+// worstTarget returns the worst value of the targets and the target it belongs to. In "any" mode
+// the target is a list of every target past the threshold, if there are any.
+func worstTarget(values map[string]float64, aggregation string, threshold float64, lowerIsWorse bool) (float64, string) {
+	worse := func(a, b float64) bool { return a > b }
+	if lowerIsWorse {
+		worse = func(a, b float64) bool { return a < b }
+	}
+
+	targets := make([]string, 0, len(values))
+	for target := range values {
+		targets = append(targets, target)
+	}
+	slices.Sort(targets)
+
+	var worst string
+	var offending []string
+	for _, target := range targets {
+		if worst == "" || worse(values[target], values[worst]) {
+			worst = target
+		}
+		if worse(values[target], threshold) {
+			offending = append(offending, fmt.Sprintf("%s (%.2f)", target, values[target]))
+		}
+	}
+	if aggregation == aggregationAny && len(offending) > 0 {
+		return values[worst], strings.Join(offending, ", ")
+	}
+	return values[worst], worst
+}
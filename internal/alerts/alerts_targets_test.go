@@ -0,0 +1,61 @@
+package alerts
+
+import (
+	"beszel/internal/entities/system"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPerTargetAggregation(t *testing.T) {
+	assert.True(t, perTargetAggregation("max", "PingLatency"))
+	assert.True(t, perTargetAggregation("any", "DNSTime"))
+	assert.False(t, perTargetAggregation("avg", "PingLatency"))
+	assert.False(t, perTargetAggregation("", "PingLatency"))
+	// metrics without targets are always averaged
+	assert.False(t, perTargetAggregation("any", "SpeedtestDownload"))
+}
+
+func TestAlertTargetValues(t *testing.T) {
+	stats := &system.Stats{
+		PingResults: map[string]*system.PingResult{
+			"1.1.1.1":   {AvgRtt: 20, SmoothedAvgRtt: 18, MinRtt: 15, MaxRtt: 30},
+			"8.8.8.8":   {AvgRtt: 250, MinRtt: 200, MaxRtt: 300, StdDevRtt: 40, PacketLoss: 10},
+			"192.0.2.1": {PacketLoss: 100},
+		},
+		HttpResults: map[string]*system.HttpResult{
+			"https://up.example.com":   {Status: "success", ResponseTime: 120},
+			"https://down.example.com": {Status: "error"},
+		},
+	}
+
+	// hosts that didn't respond have no latency, smoothed values are preferred
+	assert.Equal(t, map[string]float64{"1.1.1.1": 18, "8.8.8.8": 250}, alertTargetValues("PingLatency", stats))
+	assert.Equal(t, map[string]float64{"1.1.1.1": 0, "8.8.8.8": 10, "192.0.2.1": 100}, alertTargetValues("PingPacketLoss", stats))
+	assert.Equal(t, map[string]float64{"1.1.1.1": 15, "8.8.8.8": 40}, alertTargetValues("PingJitter", stats))
+	assert.Equal(t, map[string]float64{"https://up.example.com": 120}, alertTargetValues("HTTPResponseTime", stats))
+	assert.Empty(t, alertTargetValues("DNSTime", stats))
+}
+
+func TestWorstTarget(t *testing.T) {
+	values := map[string]float64{"a": 20, "b": 250, "c": 150}
+
+	val, details := worstTarget(values, "max", 100, false)
+	assert.Equal(t, 250.0, val)
+	assert.Equal(t, "b", details)
+
+	// any lists every target past the threshold
+	val, details = worstTarget(values, "any", 100, false)
+	assert.Equal(t, 250.0, val)
+	assert.Equal(t, "b (250.00), c (150.00)", details)
+
+	// and names the worst target when none is past it
+	val, details = worstTarget(values, "any", 300, false)
+	assert.Equal(t, 250.0, val)
+	assert.Equal(t, "b", details)
+
+	// lower values are worse for quality
+	val, details = worstTarget(values, "any", 100, true)
+	assert.Equal(t, 20.0, val)
+	assert.Equal(t, "a (20.00)", details)
+}
@@ -0,0 +1,119 @@
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"text/template"
+	"time"
+)
+
+// defaultAlertWebhookTemplate renders the payload of alert webhooks without a template of their own
+const defaultAlertWebhookTemplate = `{"system":{{json .System}},"metric":{{json .Metric}},"value":{{json .Value}},"threshold":{{json .Threshold}},"unit":{{json .Unit}},"triggered":{{json .Triggered}},"timestamp":{{json .Timestamp}},"title":{{json .Title}},"message":{{json .Message}},"link":{{json .Link}}}`
+
+// alertWebhookFuncs are the functions available in alert webhook templates.
+// json quotes and escapes values, so templates can't produce broken payloads from odd system names.
+var alertWebhookFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// AlertWebhookSettings configures a webhook that receives a JSON payload for the triggered and resolved alerts
+// the user is notified of
+type AlertWebhookSettings struct {
+	URL      string `json:"url"`
+	Template string `json:"template,omitempty"` // text/template rendering the payload, empty uses the default
+}
+
+// alertWebhookEvent is the data alert webhook templates are executed with
+type alertWebhookEvent struct {
+	System    string
+	Metric    string // Name of the alert, "Status" for alerts without a value
+	Value     float64
+	Threshold float64
+	Unit      string
+	Triggered bool // False when the alert resolved
+	Timestamp time.Time
+	Title     string
+	Message   string
+	Link      string
+}
+
+func newAlertWebhookEvent(data AlertMessageData, now time.Time) alertWebhookEvent {
+	event := alertWebhookEvent{
+		System:    data.System,
+		Metric:    "Status",
+		Triggered: !data.Resolved,
+		Timestamp: now.UTC(),
+		Title:     data.Title,
+		Message:   data.Message,
+		Link:      data.Link,
+	}
+	if data.Metric != nil {
+		event.Metric = data.Metric.Name
+		event.Value = data.Metric.Value
+		event.Threshold = data.Metric.Threshold
+		event.Unit = data.Metric.Unit
+	}
+	return event
+}
+
+// renderAlertWebhook executes the template with the event and checks that the result is valid JSON
+func renderAlertWebhook(text string, event alertWebhookEvent) ([]byte, error) {
+	if text == "" {
+		text = defaultAlertWebhookTemplate
+	}
+	tmpl, err := template.New("alert_webhook").Funcs(alertWebhookFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, event); err != nil {
+		return nil, err
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, errors.New("alert webhook template doesn't render valid JSON")
+	}
+	return buf.Bytes(), nil
+}
+
+// sendAlertWebhooks posts the alert to the alert webhooks of all users whose notification
+// preferences allow it. The settings are read right away and the requests sent in the background,
+// so slow webhooks don't hold up other notifications. Failures are logged only.
+func (am *AlertManager) sendAlertWebhooks(data AlertMessageData) {
+	records, err := am.hub.FindAllRecords("user_settings", nil)
+	if err != nil {
+		am.hub.Logger().Error("Failed to find user settings", "err", err)
+		return
+	}
+
+	now := time.Now()
+	event := newAlertWebhookEvent(data, now)
+	for _, record := range records {
+		var settings UserNotificationSettings
+		if err := record.UnmarshalJSONField("settings", &settings); err != nil || settings.AlertWebhook.URL == "" {
+			continue
+		}
+		userID := record.GetString("user")
+		reason, err := settings.holdBackReason(data, now)
+		if err != nil {
+			am.hub.Logger().Error("Invalid notification preferences", "userID", userID, "err", err)
+		}
+		if reason != "" {
+			am.hub.Logger().Info("Alert webhook held back by user preferences", "userID", userID, "type", data.Type, "reason", reason)
+			continue
+		}
+		body, err := renderAlertWebhook(settings.AlertWebhook.Template, event)
+		if err != nil {
+			am.hub.Logger().Error("Failed to send alert webhook", "userID", userID, "err", err)
+			continue
+		}
+		go func(url string) {
+			if err := postChannel(url, body); err != nil {
+				am.hub.Logger().Error("Failed to send alert webhook", "userID", userID, "err", err)
+			}
+		}(settings.AlertWebhook.URL)
+	}
+}
@@ -0,0 +1,47 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+)
+
+// ErrInvalidSignature is returned when signed data fails verification.
+var ErrInvalidSignature = errors.New("invalid data signature")
+
+// DataRequest holds optional parameters of a GetData request.
+type DataRequest struct {
+	Signed bool `cbor:"0,keyasint,omitempty"` // Respond with SignedData instead of plain CombinedData
+}
+
+// SignedData wraps an encoded payload with an HMAC-SHA256 signature so the
+// hub can detect results altered between the agent and the hub.
+type SignedData struct {
+	Data      []byte `cbor:"0,keyasint"` // CBOR encoded CombinedData
+	Signature []byte `cbor:"1,keyasint"`
+}
+
+// DataSigningKey derives the per-agent signing key from the agent's token.
+// The token itself is never used as the key directly.
+func DataSigningKey(token string) []byte {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write([]byte("beszel data signing"))
+	return mac.Sum(nil)
+}
+
+// SignData returns the payload wrapped with its signature.
+func SignData(key, data []byte) SignedData {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return SignedData{Data: data, Signature: mac.Sum(nil)}
+}
+
+// Verify checks the signature of the payload against the key.
+func (s SignedData) Verify(key []byte) error {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(s.Data)
+	if len(s.Signature) == 0 || !hmac.Equal(mac.Sum(nil), s.Signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
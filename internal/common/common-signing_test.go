@@ -0,0 +1,67 @@
+package common_test
+
+import (
+	"beszel/internal/common"
+	"beszel/internal/entities/system"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignedData(t *testing.T) {
+	key := common.DataSigningKey("agent-token")
+	assert.NotEqual(t, []byte("agent-token"), key, "key should be derived, not the token itself")
+	assert.Equal(t, key, common.DataSigningKey("agent-token"), "key derivation should be deterministic")
+
+	payload, err := cbor.Marshal(system.CombinedData{
+		Stats: system.Stats{PingResults: map[string]*system.PingResult{"1.1.1.1": {Host: "1.1.1.1", AvgRtt: 12.5}}},
+		Info:  system.Info{Hostname: "signed-host"},
+	})
+	require.NoError(t, err)
+
+	decode := func(t *testing.T, key []byte, encoded []byte) (system.CombinedData, error) {
+		var signed common.SignedData
+		var data system.CombinedData
+		require.NoError(t, cbor.Unmarshal(encoded, &signed))
+		if err := signed.Verify(key); err != nil {
+			return data, err
+		}
+		return data, cbor.Unmarshal(signed.Data, &data)
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		encoded, err := cbor.Marshal(common.SignData(key, payload))
+		require.NoError(t, err)
+		data, err := decode(t, key, encoded)
+		require.NoError(t, err)
+		assert.Equal(t, 12.5, data.Stats.PingResults["1.1.1.1"].AvgRtt)
+		assert.Equal(t, "signed-host", data.Info.Hostname)
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		signed := common.SignData(key, payload)
+		tampered, err := cbor.Marshal(system.CombinedData{
+			Stats: system.Stats{PingResults: map[string]*system.PingResult{"1.1.1.1": {Host: "1.1.1.1", AvgRtt: 1}}},
+			Info:  system.Info{Hostname: "signed-host"},
+		})
+		require.NoError(t, err)
+		signed.Data = tampered
+		encoded, err := cbor.Marshal(signed)
+		require.NoError(t, err)
+		_, err = decode(t, key, encoded)
+		assert.ErrorIs(t, err, common.ErrInvalidSignature)
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		encoded, err := cbor.Marshal(common.SignData(common.DataSigningKey("other-token"), payload))
+		require.NoError(t, err)
+		_, err = decode(t, key, encoded)
+		assert.ErrorIs(t, err, common.ErrInvalidSignature)
+	})
+
+	t.Run("missing signature", func(t *testing.T) {
+		assert.ErrorIs(t, common.SignedData{Data: payload}.Verify(key), common.ErrInvalidSignature)
+	})
+}
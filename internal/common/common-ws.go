@@ -1,5 +1,7 @@
 package common
 
+import "beszel/internal/entities/system"
+
 type WebSocketAction = uint8
 
 // Not implemented yet
@@ -12,6 +14,10 @@ const (
 	CheckFingerprint
 	// Send unified monitoring configuration to agent
 	UpdateMonitoringConfig
+	// Run the checks of a service immediately, outside of its schedule
+	RunCheckNow
+	// Update the agent binary and restart the agent
+	SelfUpdate
 )
 
 // HubRequest defines the structure for requests sent from hub to agent.
@@ -21,6 +27,27 @@ type HubRequest[T any] struct {
 	// Error  AgentError      `cbor:"error,omitempty,omitzero"`
 }
 
+// Services whose checks can be run on demand
+const (
+	ServicePing       = "ping"
+	ServiceDns        = "dns"
+	ServiceHttp       = "http"
+	ServiceSpeedtest  = "speedtest"
+	ServiceTraceroute = "traceroute"
+	ServiceSnmp       = "snmp"
+)
+
+// Services lists all services of the monitoring configuration
+var Services = []string{ServicePing, ServiceDns, ServiceHttp, ServiceSpeedtest, ServiceTraceroute, ServiceSnmp}
+
+type RunCheckRequest struct {
+	Service string `cbor:"0,keyasint"` // One of the Service constants
+}
+
+type SelfUpdateRequest struct {
+	Version string `cbor:"0,keyasint,omitempty,omitzero"` // Version to update to, empty for the latest release
+}
+
 type FingerprintRequest struct {
 	JWTToken    string `cbor:"0,keyasint"` // JWT token for authentication
 	NeedSysInfo bool   `cbor:"1,keyasint"` // For universal token system creation
@@ -32,3 +59,77 @@ type FingerprintResponse struct {
 	Hostname string `cbor:"1,keyasint,omitempty,omitzero"`
 	Port     string `cbor:"2,keyasint,omitempty,omitzero"`
 }
+
+// AgentMessageTag is the CBOR tag wrapping messages initiated by the agent.
+// It distinguishes them from responses to hub requests, which are untagged.
+const AgentMessageTag uint64 = 0x62737a
+
+type AgentAction = uint8
+
+const (
+	// Announce that the agent entered or left maintenance mode
+	SetMaintenance AgentAction = iota
+	// Report which targets of a monitoring configuration the agent applied
+	AcknowledgeConfig
+	// Report the health of the agent's schedulers
+	ReportHeartbeat
+	// Report the progress and result of a self-update
+	ReportUpdate
+	// Report that the public IP of the host changed
+	ReportIPChange
+)
+
+// AgentMessage defines the structure for messages sent from agent to hub without a request.
+type AgentMessage[T any] struct {
+	Action AgentAction `cbor:"0,keyasint"`
+	Data   T           `cbor:"1,keyasint,omitempty,omitzero"`
+}
+
+type MaintenanceRequest struct {
+	Enabled bool  `cbor:"0,keyasint"`
+	Until   int64 `cbor:"1,keyasint,omitempty,omitzero"` // Unix seconds, zero if maintenance has no expiry
+}
+
+// ConfigAck reports the targets of a monitoring configuration the agent applied and the ones
+// it rejected. Only targets of enabled services are counted.
+type ConfigAck struct {
+	Version  int64            `cbor:"0,keyasint" json:"version"`
+	Applied  int              `cbor:"1,keyasint" json:"applied"`
+	Total    int              `cbor:"2,keyasint" json:"total"`
+	Rejected []RejectedTarget `cbor:"3,keyasint,omitempty,omitzero" json:"rejected"`
+	// Why the configuration was rejected as a whole, like an invalid interval, empty if it was applied
+	Error string `cbor:"4,keyasint,omitempty,omitzero" json:"error,omitempty"`
+}
+
+type RejectedTarget struct {
+	Service string `cbor:"0,keyasint" json:"service"` // One of the Service constants
+	Target  string `cbor:"1,keyasint" json:"target"`
+	Reason  string `cbor:"2,keyasint" json:"reason"`
+}
+
+// Heartbeat is sent by the agent periodically so the hub can tell when monitoring isn't running
+type Heartbeat struct {
+	Schedulers []system.SchedulerStatus `cbor:"0,keyasint"`
+}
+
+// States of an agent self-update
+const (
+	UpdateRunning   = "updating" // Downloading and installing the new binary
+	UpdateSucceeded = "updated"  // Installed, the agent restarts with the new binary
+	UpdateCurrent   = "current"  // Already running the requested or latest version
+	UpdateFailed    = "failed"   // Not installed or rolled back, see Error
+)
+
+// UpdateStatus reports the progress of a self-update requested by the hub
+type UpdateStatus struct {
+	Status  string `cbor:"0,keyasint" json:"status"`                               // One of the Update constants
+	Version string `cbor:"1,keyasint,omitempty,omitzero" json:"version,omitempty"` // Version being installed
+	Error   string `cbor:"2,keyasint,omitempty,omitzero" json:"error,omitempty"`   // Why the update failed or was rolled back
+}
+
+// IPChange reports that the agent found its public IP changed since the last lookup
+type IPChange struct {
+	Old  string `cbor:"0,keyasint" json:"old"`
+	New  string `cbor:"1,keyasint" json:"new"`
+	Time int64  `cbor:"2,keyasint" json:"time"` // Unix seconds of the lookup that found the change
+}
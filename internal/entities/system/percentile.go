@@ -0,0 +1,19 @@
+package system
+
+import "slices"
+
+// Percentile returns the p-th percentile (0-100) of values, interpolating linearly
+// between the closest ranks. values is sorted in place, and no values return 0.
+func Percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	slices.Sort(values)
+
+	rank := max(0, min(100, p)) / 100 * float64(len(values)-1)
+	lower := int(rank)
+	if lower >= len(values)-1 {
+		return values[len(values)-1]
+	}
+	return values[lower] + (values[lower+1]-values[lower])*(rank-float64(lower))
+}
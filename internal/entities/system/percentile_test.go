@@ -0,0 +1,29 @@
+package system
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   []float64
+		p        float64
+		expected float64
+	}{
+		{name: "no values", values: nil, p: 95, expected: 0},
+		{name: "single value", values: []float64{12}, p: 99, expected: 12},
+		{name: "median", values: []float64{30, 10, 20}, p: 50, expected: 20},
+		{name: "interpolated", values: []float64{10, 20, 30, 40, 50, 60, 70, 80, 90, 100}, p: 95, expected: 95.5},
+		{name: "tail outlier", values: []float64{10, 11, 10, 12, 11, 10, 10, 11, 12, 500}, p: 99, expected: 456.08},
+		{name: "maximum", values: []float64{3, 1, 2}, p: 100, expected: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.expected, Percentile(tt.values, tt.p), 0.001)
+		})
+	}
+}
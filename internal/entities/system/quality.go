@@ -0,0 +1,51 @@
+package system
+
+import "math"
+
+// PingQualityIndex returns a link quality score from 0 (unusable) to 100 (perfect)
+// combining latency, jitter and packet loss. It uses the simplified E-model
+// commonly used for VoIP link monitoring:
+//
+//	effective latency = avgRtt + 2*jitter + 10
+//	R = 93.2 - effective/40           if effective < 160 ms
+//	R = 93.2 - (effective-120)/10     otherwise
+//	index = R - 2.5*packetLoss, clamped to [0, 100]
+//
+// avgRtt and jitter are in milliseconds, packetLoss is a percentage.
+func PingQualityIndex(avgRtt, jitter, packetLoss float64) float64 {
+	effectiveLatency := avgRtt + 2*jitter + 10
+
+	var r float64
+	if effectiveLatency < 160 {
+		r = 93.2 - effectiveLatency/40
+	} else {
+		r = 93.2 - (effectiveLatency-120)/10
+	}
+	r -= 2.5 * packetLoss
+
+	return math.Round(max(0, min(100, r))*100) / 100
+}
+
+// Jitter returns the RTT spread (max - min) in milliseconds. fping only reports
+// summary statistics, so the spread is used as the jitter approximation.
+func (r *PingResult) Jitter() float64 {
+	return max(0, r.MaxRtt-r.MinRtt)
+}
+
+// AlertJitter returns the jitter ping alerts use in milliseconds: the standard deviation
+// of the replies' RTTs, or the RTT spread if the agent doesn't report it
+func (r *PingResult) AlertJitter() float64 {
+	if r.StdDevRtt > 0 {
+		return r.StdDevRtt
+	}
+	return r.Jitter()
+}
+
+// QualityIndex returns the link quality index for this result (see PingQualityIndex)
+func (r *PingResult) QualityIndex() float64 {
+	// a host that never responded has no usable link
+	if r.PacketLoss >= 100 {
+		return 0
+	}
+	return PingQualityIndex(r.AvgRtt, r.Jitter(), r.PacketLoss)
+}
@@ -0,0 +1,62 @@
+package system
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPingQualityIndex(t *testing.T) {
+	tests := []struct {
+		name       string
+		avgRtt     float64
+		jitter     float64
+		packetLoss float64
+		minIndex   float64
+		maxIndex   float64
+	}{
+		{name: "good link", avgRtt: 10, jitter: 1, packetLoss: 0, minIndex: 90, maxIndex: 93.2},
+		{name: "degraded link", avgRtt: 150, jitter: 30, packetLoss: 2, minIndex: 70, maxIndex: 85},
+		{name: "bad link", avgRtt: 300, jitter: 100, packetLoss: 20, minIndex: 0, maxIndex: 10},
+		{name: "total loss", avgRtt: 0, jitter: 0, packetLoss: 100, minIndex: 0, maxIndex: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := PingQualityIndex(tt.avgRtt, tt.jitter, tt.packetLoss)
+			assert.GreaterOrEqual(t, index, tt.minIndex)
+			assert.LessOrEqual(t, index, tt.maxIndex)
+		})
+	}
+}
+
+func TestPingQualityIndex_Ordering(t *testing.T) {
+	good := PingQualityIndex(10, 1, 0)
+	degraded := PingQualityIndex(150, 30, 2)
+	bad := PingQualityIndex(300, 100, 20)
+
+	assert.Greater(t, good, degraded)
+	assert.Greater(t, degraded, bad)
+
+	// more jitter or loss on the same latency lowers the index
+	assert.Greater(t, PingQualityIndex(50, 5, 0), PingQualityIndex(50, 40, 0))
+	assert.Greater(t, PingQualityIndex(50, 5, 0), PingQualityIndex(50, 5, 5))
+}
+
+func TestPingResult_QualityIndex(t *testing.T) {
+	result := &PingResult{MinRtt: 9, AvgRtt: 10, MaxRtt: 12, PacketLoss: 0}
+	assert.Equal(t, 3.0, result.Jitter())
+	assert.Equal(t, PingQualityIndex(10, 3, 0), result.QualityIndex())
+
+	unreachable := &PingResult{PacketLoss: 100}
+	assert.Equal(t, 0.0, unreachable.QualityIndex())
+}
+
+func TestPingResult_AlertJitter(t *testing.T) {
+	// the RTT spread is used when the agent doesn't report a standard deviation
+	result := &PingResult{MinRtt: 9, AvgRtt: 10, MaxRtt: 12}
+	assert.Equal(t, 3.0, result.AlertJitter())
+
+	result.StdDevRtt = 1.2
+	assert.Equal(t, 1.2, result.AlertJitter())
+}
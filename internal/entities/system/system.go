@@ -3,10 +3,13 @@ package system
 import "time"
 
 type Stats struct {
-	PingResults      map[string]*PingResult      `json:"ping,omitempty" cbor:"0,keyasint,omitempty"`
-	DnsResults       map[string]*DnsResult       `json:"dns,omitempty" cbor:"1,keyasint,omitempty"`
-	HttpResults      map[string]*HttpResult      `json:"http,omitempty" cbor:"2,keyasint,omitempty"`
-	SpeedtestResults map[string]*SpeedtestResult `json:"speedtest,omitempty" cbor:"3,keyasint,omitempty"`
+	PingResults       map[string]*PingResult       `json:"ping,omitempty" cbor:"0,keyasint,omitempty"`
+	DnsResults        map[string]*DnsResult        `json:"dns,omitempty" cbor:"1,keyasint,omitempty"`
+	HttpResults       map[string]*HttpResult       `json:"http,omitempty" cbor:"2,keyasint,omitempty"`
+	SpeedtestResults  map[string]*SpeedtestResult  `json:"speedtest,omitempty" cbor:"3,keyasint,omitempty"`
+	DroppedResults    uint64                       `json:"dropped_results,omitempty" cbor:"4,keyasint,omitempty"` // Results dropped by the agent since it started because they weren't collected in time
+	TracerouteResults map[string]*TracerouteResult `json:"traceroute,omitempty" cbor:"5,keyasint,omitempty"`
+	SnmpResults       map[string]*SnmpResult       `json:"snmp,omitempty" cbor:"6,keyasint,omitempty"`
 }
 
 type PingResult struct {
@@ -16,12 +19,28 @@ type PingResult struct {
 	MaxRtt      float64   `json:"max_rtt" cbor:"3,keyasint"` // Milliseconds
 	AvgRtt      float64   `json:"avg_rtt" cbor:"4,keyasint"` // Milliseconds
 	LastChecked time.Time `json:"last_checked" cbor:"5,keyasint"`
+	Mtu         int       `json:"mtu,omitempty" cbor:"6,keyasint,omitempty"` // Discovered path MTU in bytes, 0 if not probed
+	// Median of the recent average RTTs, 0 if smoothing is disabled
+	SmoothedAvgRtt float64 `json:"smoothed_avg_rtt,omitempty" cbor:"7,keyasint,omitempty"`
+	// Address family of the pinged address, "ipv4" or "ipv6"
+	AddressFamily string `json:"address_family,omitempty" cbor:"8,keyasint,omitempty"`
+	// Standard deviation of the replies' RTTs in milliseconds
+	StdDevRtt float64 `json:"std_dev_rtt,omitempty" cbor:"9,keyasint,omitempty"`
+	// RTT of each reply in milliseconds, in the order they were received
+	Samples []float64 `json:"samples,omitempty" cbor:"10,keyasint,omitempty"`
+	// Why the target couldn't be pinged, empty if fping ran
+	ErrorCode string `json:"error_code,omitempty" cbor:"11,keyasint,omitempty"`
 }
 
 type PingTarget struct {
 	Host    string        `json:"host"`
 	Count   int           `json:"count"`
 	Timeout time.Duration `json:"timeout"`
+	Mode    string        `json:"mode,omitempty"` // "mtu" also discovers the path MTU, empty for regular pings
+	// "ipv4" or "ipv6" to ping only addresses of that family, empty or "auto" uses the resolver's choice
+	AddressFamily string `json:"address_family,omitempty"`
+	PacketSize    int    `json:"packet_size,omitempty"` // ICMP payload size in bytes (fping -b), 0 uses the default
+	IntervalMs    int    `json:"interval_ms,omitempty"` // Interval between pings in milliseconds (fping -p), 0 uses the default
 }
 
 type DnsResult struct {
@@ -32,6 +51,14 @@ type DnsResult struct {
 	LookupTime  float64   `json:"lookup_time" cbor:"4,keyasint"` // Milliseconds
 	ErrorCode   string    `json:"error_code,omitempty" cbor:"5,keyasint,omitempty"`
 	LastChecked time.Time `json:"last_checked" cbor:"6,keyasint"`
+	Answers     []string  `json:"answers,omitempty" cbor:"7,keyasint,omitempty"` // Answer values: addresses, CNAME and MX hosts or TXT strings
+	TTL         uint32    `json:"ttl,omitempty" cbor:"8,keyasint,omitempty"`     // Minimum TTL of the answer records in seconds, 0 without answers
+	// Whether the resolver set the AD bit, i.e. validated the answer with DNSSEC
+	Authenticated bool `json:"authenticated,omitempty" cbor:"9,keyasint,omitempty"`
+	// Answers of each server of a resolver comparison, servers that failed are left out
+	ServerAnswers map[string][]string `json:"server_answers,omitempty" cbor:"10,keyasint,omitempty"`
+	// Address the query was sent from, empty if the OS chose it
+	SourceIP string `json:"source_ip,omitempty" cbor:"11,keyasint,omitempty"`
 }
 
 type DnsTarget struct {
@@ -40,25 +67,90 @@ type DnsTarget struct {
 	Type     string        `json:"type"` // "A", "AAAA", "MX", "TXT", etc.
 	Timeout  time.Duration `json:"timeout"`
 	Protocol string        `json:"protocol,omitempty"` // "udp", "tcp", "doh", "dot"
+	// Alert when an answer IP is outside these CIDRs, empty allows any
+	AllowedCidrs []string `json:"allowed_cidrs,omitempty"`
+	// Report a "mismatch" status when an answer is not one of these values, empty accepts any answer
+	ExpectedValues []string `json:"expected_values,omitempty"`
+	// Request DNSSEC records and report an "insecure" status for answers without the AD bit
+	DNSSEC bool `json:"dnssec,omitempty"`
+	// Client subnet (CIDR) sent as EDNS0 option to get the answers for clients in that network
+	ClientSubnet string `json:"client_subnet,omitempty"`
+	// Local address queries are sent from, to test the path through a specific interface.
+	// Targets whose address isn't assigned to the agent are skipped.
+	SourceIP string `json:"source_ip,omitempty"`
+	// Resolver comparison: query the domain on each of these servers instead of Server and
+	// report a "divergent" status when their answers differ
+	Servers []string `json:"servers,omitempty"`
 }
 
 type HttpResult struct {
 	URL          string    `json:"url" cbor:"0,keyasint"`
 	Status       string    `json:"status" cbor:"1,keyasint"`        // "success", "timeout", "error"
-	ResponseTime float64   `json:"response_time" cbor:"2,keyasint"` // Milliseconds
+	ResponseTime float64   `json:"response_time" cbor:"2,keyasint"` // Milliseconds to the first response byte
 	StatusCode   int       `json:"status_code" cbor:"3,keyasint"`
 	ErrorCode    string    `json:"error_code,omitempty" cbor:"4,keyasint,omitempty"`
 	LastChecked  time.Time `json:"last_checked" cbor:"5,keyasint"`
+	// Median of the recent successful response times, 0 if smoothing is disabled
+	SmoothedResponseTime float64 `json:"smoothed_response_time,omitempty" cbor:"6,keyasint,omitempty"`
+	// TCP segments retransmitted during the check (Linux only)
+	TcpRetransmits int `json:"tcp_retransmits,omitempty" cbor:"7,keyasint,omitempty"`
+	// Stapled OCSP response status: "none", "good", "revoked", "unknown" or "invalid", empty if not checked
+	OcspStatus string `json:"ocsp_status,omitempty" cbor:"8,keyasint,omitempty"`
+	// Whether the server provided signed certificate timestamps, only set if OCSP is checked
+	SctPresent bool `json:"sct_present,omitempty" cbor:"9,keyasint,omitempty"`
+	// Phases of the request in milliseconds, phases skipped by a reused connection are 0
+	DNSTime     float64 `json:"dns_time,omitempty" cbor:"10,keyasint,omitempty"`
+	ConnectTime float64 `json:"connect_time,omitempty" cbor:"11,keyasint,omitempty"`
+	TLSTime     float64 `json:"tls_time,omitempty" cbor:"12,keyasint,omitempty"`
+	TTFB        float64 `json:"ttfb,omitempty" cbor:"13,keyasint,omitempty"`       // Time to the first response byte, same as ResponseTime
+	TotalTime   float64 `json:"total_time,omitempty" cbor:"14,keyasint,omitempty"` // Time until the body is fully read
+	// Whole days until the leaf certificate expires, nil for targets not using TLS
+	CertExpiryDays *int `json:"cert_expiry_days,omitempty" cbor:"15,keyasint,omitempty"`
+	// Redirects followed to reach the final URL, whose response the result describes
+	RedirectCount int    `json:"redirect_count,omitempty" cbor:"16,keyasint,omitempty"`
+	FinalURL      string `json:"final_url,omitempty" cbor:"17,keyasint,omitempty"`
+	// Download speed of the body in Mbps, only set for targets measuring throughput
+	ThroughputMbps float64 `json:"throughput_mbps,omitempty" cbor:"18,keyasint,omitempty"`
+	// Whether the check used a connection kept alive from an earlier check
+	ConnectionReused bool `json:"connection_reused,omitempty" cbor:"19,keyasint,omitempty"`
+	// Proxy the request went through as scheme://host, empty for a direct connection.
+	// DNS and connect times of proxied checks measure the connection to the proxy.
+	Proxy string `json:"proxy,omitempty" cbor:"20,keyasint,omitempty"`
+	// Variance of the connection's round trip time in milliseconds as smoothed by the kernel (Linux only)
+	TcpRttVar float64 `json:"tcp_rtt_var,omitempty" cbor:"21,keyasint,omitempty"`
 }
 
 type HttpTarget struct {
-	URL     string `json:"url"`
-	Timeout int    `json:"timeout"` // Timeout in seconds
+	URL        string        `json:"url"`
+	Timeout    time.Duration `json:"timeout"`
+	ServerName string        `json:"server_name,omitempty"` // TLS SNI override, independent of the URL host
+	Host       string        `json:"host,omitempty"`        // Host header override
+	CheckOcsp  bool          `json:"check_ocsp,omitempty"`  // Record OCSP stapling and SCT status of HTTPS targets
+	Method     string        `json:"method,omitempty"`      // Request method, empty uses GET
+	Body       string        `json:"body,omitempty"`        // Request body, sent as is
+	// Request headers, sent as is, e.g. {"Authorization": "Bearer ..."}
+	Headers map[string]string `json:"headers,omitempty"`
+	// Status codes a healthy response has, empty accepts any
+	ExpectedStatusCodes []int `json:"expected_status_codes,omitempty"`
+	// Regular expression the response body must match, empty skips the check
+	BodyMatch string `json:"body_match,omitempty"`
+	// Whether redirects are followed, nil follows them. Otherwise the redirect response is the result.
+	FollowRedirects *bool `json:"follow_redirects,omitempty"`
+	// Whether the download speed of the body is measured, e.g. of a large file on a CDN
+	MeasureThroughput bool `json:"measure_throughput,omitempty"`
+	// Bytes of the body read when measuring throughput, 0 uses the default
+	MaxDownloadBytes int64 `json:"max_download_bytes,omitempty"`
+	// Whether checks keep their connection alive for the next one, so only the first check
+	// includes DNS, connect and TLS setup. Otherwise each check opens a new connection.
+	ReuseConnection bool `json:"reuse_connection,omitempty"`
+	// http, https or socks5 proxy for the check. Otherwise the agent's HTTP_PROXY,
+	// HTTPS_PROXY and NO_PROXY environment variables apply.
+	ProxyURL string `json:"proxy_url,omitempty"`
 }
 
 type SpeedtestResult struct {
 	ServerURL     string    `json:"server_url" cbor:"0,keyasint"`
-	Status        string    `json:"status" cbor:"1,keyasint"`         // "success", "timeout", "error"
+	Status        string    `json:"status" cbor:"1,keyasint"`         // "success", "implausible", "skipped_budget", "timeout", "error"
 	DownloadSpeed float64   `json:"download_speed" cbor:"2,keyasint"` // Mbps
 	UploadSpeed   float64   `json:"upload_speed" cbor:"3,keyasint"`   // Mbps
 	Latency       float64   `json:"latency" cbor:"4,keyasint"`        // Milliseconds
@@ -91,35 +183,150 @@ type SpeedtestResult struct {
 }
 
 type SpeedtestTarget struct {
-	ServerID string        `json:"server_id"`
-	Timeout  time.Duration `json:"timeout"`
+	// Ookla server to test against, empty lets the CLI pick one. Results of targets without
+	// a server ID are stored under the ID of the server the CLI picked.
+	ServerID   string        `json:"server_id"`
+	ServerHost string        `json:"server_host,omitempty"` // Ookla server host, like "speedtest.example.com:8080"
+	Timeout    time.Duration `json:"timeout"`
+	// Plausibility bounds in Mbps, results with a download or upload speed outside them
+	// are reported as "implausible". 0 disables a bound.
+	MinSpeed float64 `json:"min_speed,omitempty"`
+	MaxSpeed float64 `json:"max_speed,omitempty"`
+	// Bounds of the download or upload speed alone in Mbps, as the directions of asymmetric
+	// links differ by far. 0 uses the bound of both directions above.
+	MinDownload float64 `json:"min_download,omitempty"`
+	MaxDownload float64 `json:"max_download,omitempty"`
+	MinUpload   float64 `json:"min_upload,omitempty"`
+	MaxUpload   float64 `json:"max_upload,omitempty"`
+	// How the speedtest runs: "ookla" (the default, needs the speedtest CLI), "cloudflare",
+	// "librespeed" or "http"
+	Provider string `json:"provider,omitempty"`
+	// Base URL of the librespeed server, file downloaded by the http provider,
+	// or an alternative Cloudflare endpoint
+	URL string `json:"url,omitempty"`
+	// Times a failed speedtest is retried with exponential backoff, nil retries once
+	Retries *int `json:"retries,omitempty"`
+	// Bytes the target may transfer per calendar month, further runs are skipped with
+	// status "skipped_budget". 0 disables the budget.
+	MonthlyByteBudget int64 `json:"monthly_byte_budget,omitempty"`
+}
+
+type TracerouteResult struct {
+	Host        string          `json:"host" cbor:"0,keyasint"`
+	Status      string          `json:"status" cbor:"1,keyasint"` // "success" if the host replied, "incomplete" if it didn't, "error"
+	Hops        []TracerouteHop `json:"hops,omitempty" cbor:"2,keyasint,omitempty"`
+	ErrorCode   string          `json:"error_code,omitempty" cbor:"3,keyasint,omitempty"`
+	LastChecked time.Time       `json:"last_checked" cbor:"4,keyasint"`
+	Tool        string          `json:"tool,omitempty" cbor:"5,keyasint,omitempty"` // "mtr" or "traceroute"
+}
+
+// TracerouteHop is a router on the path to a traceroute target and how its replies looked
+type TracerouteHop struct {
+	Hop      int     `json:"hop" cbor:"0,keyasint"`
+	Host     string  `json:"host,omitempty" cbor:"1,keyasint,omitempty"` // Address that replied, empty if no probe got a reply
+	Loss     float64 `json:"loss" cbor:"2,keyasint"`                     // Percentage of unanswered probes
+	Sent     int     `json:"sent" cbor:"3,keyasint"`
+	AvgRtt   float64 `json:"avg_rtt,omitempty" cbor:"4,keyasint,omitempty"` // Milliseconds
+	BestRtt  float64 `json:"best_rtt,omitempty" cbor:"5,keyasint,omitempty"`
+	WorstRtt float64 `json:"worst_rtt,omitempty" cbor:"6,keyasint,omitempty"`
+}
+
+type TracerouteTarget struct {
+	Host    string        `json:"host"`
+	Count   int           `json:"count,omitempty"`    // Probes sent to each hop, 0 uses the default
+	MaxHops int           `json:"max_hops,omitempty"` // Hops probed at most, 0 uses the default
+	Timeout time.Duration `json:"timeout,omitempty"`  // Wait for the reply to a probe, 0 uses the default
+	// "mtr" or "traceroute", empty uses mtr if it is installed and traceroute otherwise
+	Tool string `json:"tool,omitempty"`
+}
+
+type SnmpResult struct {
+	Host        string      `json:"host" cbor:"0,keyasint"`
+	Status      string      `json:"status" cbor:"1,keyasint"` // "success", "partial" if some OIDs had no value, or "error"
+	Values      []SnmpValue `json:"values,omitempty" cbor:"2,keyasint,omitempty"`
+	ErrorCode   string      `json:"error_code,omitempty" cbor:"3,keyasint,omitempty"`
+	LastChecked time.Time   `json:"last_checked" cbor:"4,keyasint"`
+	PollTime    float64     `json:"poll_time,omitempty" cbor:"5,keyasint,omitempty"` // Milliseconds the device took to answer
+}
+
+// SnmpValue is the value of an OID polled from a device
+type SnmpValue struct {
+	OID   string `json:"oid" cbor:"0,keyasint"`
+	Name  string `json:"name,omitempty" cbor:"1,keyasint,omitempty"` // Like "if2_in_octets" for interface counters, empty for other OIDs
+	Type  string `json:"type" cbor:"2,keyasint"`                     // "counter32", "counter64", "gauge32", "integer" or "timeticks"
+	Value uint64 `json:"value" cbor:"3,keyasint"`
+	// Change of a counter per second since the previous poll, missing for the first poll,
+	// after the counter was reset and for values that aren't counters
+	Rate *float64 `json:"rate,omitempty" cbor:"4,keyasint,omitempty"`
+}
+
+type SnmpTarget struct {
+	Host    string        `json:"host"`
+	Port    int           `json:"port,omitempty"`    // 0 uses 161
+	Version string        `json:"version,omitempty"` // "1", "2c" or "3", empty uses 2c
+	Timeout time.Duration `json:"timeout,omitempty"` // Wait for the reply, 0 uses the default
+	// Community of v1 and v2c, empty uses "public"
+	Community string `json:"community,omitempty"`
+	// User of v3 and its credentials. Without an auth protocol requests are neither authenticated
+	// nor encrypted, without a privacy protocol they are authenticated only.
+	Username     string `json:"username,omitempty"`
+	AuthProtocol string `json:"auth_protocol,omitempty"` // "MD5", "SHA", "SHA224", "SHA256", "SHA384" or "SHA512"
+	AuthPassword string `json:"auth_password,omitempty"`
+	PrivProtocol string `json:"priv_protocol,omitempty"` // "DES", "AES", "AES192", "AES256", "AES192C" or "AES256C"
+	PrivPassword string `json:"priv_password,omitempty"`
+	// Numeric OIDs to poll, like 1.3.6.1.2.1.31.1.1.1.6.2
+	OIDs []string `json:"oids,omitempty"`
+	// Indexes of interfaces (ifIndex) to poll the 64-bit byte and packet counters of, in addition to the OIDs
+	Interfaces []int `json:"interfaces,omitempty"`
 }
 
 // Unified monitoring configuration
 type MonitoringConfig struct {
 	Enabled struct {
-		Ping      bool `json:"ping"`
-		Dns       bool `json:"dns"`
-		Http      bool `json:"http,omitempty"`
-		Speedtest bool `json:"speedtest,omitempty"`
+		Ping       bool `json:"ping"`
+		Dns        bool `json:"dns"`
+		Http       bool `json:"http,omitempty"`
+		Speedtest  bool `json:"speedtest,omitempty"`
+		Traceroute bool `json:"traceroute,omitempty"`
+		Snmp       bool `json:"snmp,omitempty"`
 	} `json:"enabled"`
 	GlobalInterval string `json:"global_interval,omitempty"` // Cron expression
-	Ping           struct {
-		Targets  []PingTarget `json:"targets"`
-		Interval string       `json:"interval,omitempty"` // Override global interval
+	// The cron expressions of all intervals have a leading seconds field, for checks
+	// more often than once a minute
+	CronSeconds bool `json:"cron_seconds,omitempty"`
+	// Scheduled checks of each target start at a fixed offset into the first half of the
+	// interval instead of all at once, spreading the load on targets shared by many agents
+	Jitter bool `json:"jitter,omitempty"`
+	// Services paused on the hub, which are also not enabled. Their targets are kept
+	// so resuming them restores the configuration.
+	Paused []string `json:"paused,omitempty"`
+	Ping   struct {
+		Targets   []PingTarget `json:"targets"`
+		Interval  string       `json:"interval,omitempty"`  // Override global interval
+		Smoothing int          `json:"smoothing,omitempty"` // Also report the median of the last N samples, 0 disables
 	} `json:"ping,omitempty"`
 	Dns struct {
-		Targets  []DnsTarget `json:"targets"`
-		Interval string      `json:"interval,omitempty"` // Override global interval
+		Targets              []DnsTarget `json:"targets"`
+		Interval             string      `json:"interval,omitempty"`               // Override global interval
+		MaxConcurrentLookups int         `json:"max_concurrent_lookups,omitempty"` // Lookups run at once, 0 uses the default
 	} `json:"dns,omitempty"`
 	Http struct {
-		Targets  []HttpTarget `json:"targets"`
-		Interval string       `json:"interval,omitempty"` // Override global interval
+		Targets   []HttpTarget `json:"targets"`
+		Interval  string       `json:"interval,omitempty"`  // Override global interval
+		Smoothing int          `json:"smoothing,omitempty"` // Also report the median of the last N samples, 0 disables
 	} `json:"http,omitempty"`
 	Speedtest struct {
 		Targets  []SpeedtestTarget `json:"targets"`
 		Interval string            `json:"interval,omitempty"` // Override global interval
 	} `json:"speedtest,omitempty"`
+	Traceroute struct {
+		Targets  []TracerouteTarget `json:"targets"`
+		Interval string             `json:"interval,omitempty"` // Override global interval
+	} `json:"traceroute,omitempty"`
+	Snmp struct {
+		Targets  []SnmpTarget `json:"targets"`
+		Interval string       `json:"interval,omitempty"` // Override global interval
+	} `json:"snmp,omitempty"`
 }
 
 type Info struct {
@@ -129,6 +336,33 @@ type Info struct {
 	PublicIP string `json:"ip" cbor:"12,keyasint"`  // Public IP address
 	ISP      string `json:"isp" cbor:"13,keyasint"` // Internet Service Provider
 	ASN      string `json:"asn" cbor:"14,keyasint"` // Autonomous System Number
+
+	// Health of the agent's monitoring schedulers, from the latest heartbeat
+	Schedulers []SchedulerStatus `json:"sched,omitempty" cbor:"15,keyasint,omitempty"`
+
+	// Network interfaces that are up, without loopback
+	Interfaces []NetworkInterface `json:"ni,omitempty" cbor:"16,keyasint,omitempty"`
+
+	// Round trip time in milliseconds of the hub's latest WebSocket ping to the agent,
+	// measured by the hub. Zero if no ping was answered yet.
+	WsRtt float64 `json:"rtt,omitempty" cbor:"17,keyasint,omitempty"`
+}
+
+// NetworkInterface describes a network interface of the host and its negotiated link speed
+type NetworkInterface struct {
+	Name      string `json:"n" cbor:"0,keyasint"`
+	Speed     uint64 `json:"s,omitempty" cbor:"1,keyasint,omitempty"` // Link speed in Mbps, zero if unknown
+	IsVirtual bool   `json:"v,omitempty" cbor:"2,keyasint,omitempty"` // Whether the interface is virtual, like a bridge or veth
+}
+
+// SchedulerStatus reports the cron job running the checks of a monitoring service
+type SchedulerStatus struct {
+	Service   string `json:"s" cbor:"0,keyasint"`                     // ping, dns, http, speedtest, traceroute or snmp
+	Active    bool   `json:"a" cbor:"1,keyasint"`                     // Whether the job is scheduled
+	LastRun   int64  `json:"r,omitempty" cbor:"2,keyasint,omitempty"` // Unix seconds, zero if the job hasn't run yet
+	LastError string `json:"e,omitempty" cbor:"3,keyasint,omitempty"` // Why the job couldn't be scheduled
+	// Why the checks can't run although the job is scheduled, like "fping not installed"
+	Unavailable string `json:"u,omitempty" cbor:"4,keyasint,omitempty"`
 }
 
 // Final data structure to return to the hub
@@ -0,0 +1,299 @@
+package system
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// jsonTimeout is the JSON form of target timeouts. It reads a number of seconds, like the
+// hub's UI stores them, or a duration string like "1500ms", and writes a number of seconds.
+// Between hub and agent the timeouts are sent as CBOR, see MarshalCBOR.
+type jsonTimeout time.Duration
+
+func (t jsonTimeout) MarshalJSON() ([]byte, error) {
+	return strconv.AppendFloat(nil, time.Duration(t).Seconds(), 'f', -1, 64), nil
+}
+
+func (t *jsonTimeout) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	if data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid timeout %q: %w", s, err)
+		}
+		*t = jsonTimeout(d)
+		return nil
+	}
+	seconds, err := strconv.ParseFloat(string(data), 64)
+	if err != nil {
+		return fmt.Errorf("invalid timeout %s: must be seconds or a duration string", data)
+	}
+	*t = jsonTimeout(seconds * float64(time.Second))
+	return nil
+}
+
+// The target types below read and write their timeout as a jsonTimeout. The timeout field
+// of the anonymous structs shadows the one of the embedded target.
+
+func (t PingTarget) MarshalJSON() ([]byte, error) {
+	type target PingTarget
+	return json.Marshal(struct {
+		target
+		Timeout jsonTimeout `json:"timeout"`
+	}{target(t), jsonTimeout(t.Timeout)})
+}
+
+func (t *PingTarget) UnmarshalJSON(data []byte) error {
+	type target PingTarget
+	return json.Unmarshal(data, &struct {
+		*target
+		Timeout *jsonTimeout `json:"timeout"`
+	}{(*target)(t), (*jsonTimeout)(&t.Timeout)})
+}
+
+func (t DnsTarget) MarshalJSON() ([]byte, error) {
+	type target DnsTarget
+	return json.Marshal(struct {
+		target
+		Timeout jsonTimeout `json:"timeout"`
+	}{target(t), jsonTimeout(t.Timeout)})
+}
+
+func (t *DnsTarget) UnmarshalJSON(data []byte) error {
+	type target DnsTarget
+	return json.Unmarshal(data, &struct {
+		*target
+		Timeout *jsonTimeout `json:"timeout"`
+	}{(*target)(t), (*jsonTimeout)(&t.Timeout)})
+}
+
+func (t HttpTarget) MarshalJSON() ([]byte, error) {
+	type target HttpTarget
+	return json.Marshal(struct {
+		target
+		Timeout jsonTimeout `json:"timeout"`
+	}{target(t), jsonTimeout(t.Timeout)})
+}
+
+func (t *HttpTarget) UnmarshalJSON(data []byte) error {
+	type target HttpTarget
+	return json.Unmarshal(data, &struct {
+		*target
+		Timeout *jsonTimeout `json:"timeout"`
+	}{(*target)(t), (*jsonTimeout)(&t.Timeout)})
+}
+
+func (t SpeedtestTarget) MarshalJSON() ([]byte, error) {
+	type target SpeedtestTarget
+	return json.Marshal(struct {
+		target
+		Timeout jsonTimeout `json:"timeout"`
+	}{target(t), jsonTimeout(t.Timeout)})
+}
+
+func (t *SpeedtestTarget) UnmarshalJSON(data []byte) error {
+	type target SpeedtestTarget
+	return json.Unmarshal(data, &struct {
+		*target
+		Timeout *jsonTimeout `json:"timeout"`
+	}{(*target)(t), (*jsonTimeout)(&t.Timeout)})
+}
+
+func (t TracerouteTarget) MarshalJSON() ([]byte, error) {
+	type target TracerouteTarget
+	return json.Marshal(struct {
+		target
+		Timeout jsonTimeout `json:"timeout,omitempty"`
+	}{target(t), jsonTimeout(t.Timeout)})
+}
+
+func (t *TracerouteTarget) UnmarshalJSON(data []byte) error {
+	type target TracerouteTarget
+	return json.Unmarshal(data, &struct {
+		*target
+		Timeout *jsonTimeout `json:"timeout,omitempty"`
+	}{(*target)(t), (*jsonTimeout)(&t.Timeout)})
+}
+
+func (t SnmpTarget) MarshalJSON() ([]byte, error) {
+	type target SnmpTarget
+	return json.Marshal(struct {
+		target
+		Timeout jsonTimeout `json:"timeout,omitempty"`
+	}{target(t), jsonTimeout(t.Timeout)})
+}
+
+func (t *SnmpTarget) UnmarshalJSON(data []byte) error {
+	type target SnmpTarget
+	return json.Unmarshal(data, &struct {
+		*target
+		Timeout *jsonTimeout `json:"timeout,omitempty"`
+	}{(*target)(t), (*jsonTimeout)(&t.Timeout)})
+}
+
+// Between hub and agent the timeouts are sent in nanoseconds as "timeout_ns". "timeout" keeps
+// the whole seconds agents and hubs from before timeouts were durations use, so they keep
+// working with newer ones: agents of a newer hub read it, and configurations of an older hub
+// without "timeout_ns" are read from it. Older agents read the ping timeout in nanoseconds.
+
+// legacyTimeout returns the timeout for the "timeout" key in whole seconds, rounded up
+func legacyTimeout(timeout time.Duration) int64 {
+	return int64((timeout + time.Second - 1) / time.Second)
+}
+
+// cborTimeout returns the timeout of a decoded target, from "timeout_ns" or "timeout" seconds
+func cborTimeout(timeoutNs *time.Duration, seconds int64) time.Duration {
+	if timeoutNs != nil {
+		return *timeoutNs
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func (t PingTarget) MarshalCBOR() ([]byte, error) {
+	type target PingTarget
+	return cbor.Marshal(struct {
+		target
+		Timeout   time.Duration `cbor:"timeout"`
+		TimeoutNs time.Duration `cbor:"timeout_ns"`
+	}{target(t), t.Timeout, t.Timeout})
+}
+
+func (t *PingTarget) UnmarshalCBOR(data []byte) error {
+	type target PingTarget
+	v := struct {
+		*target
+		Timeout   int64          `cbor:"timeout"`
+		TimeoutNs *time.Duration `cbor:"timeout_ns"`
+	}{target: (*target)(t)}
+	if err := cbor.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	t.Timeout = cborTimeout(v.TimeoutNs, v.Timeout)
+	return nil
+}
+
+func (t DnsTarget) MarshalCBOR() ([]byte, error) {
+	type target DnsTarget
+	return cbor.Marshal(struct {
+		target
+		Timeout   int64         `cbor:"timeout"`
+		TimeoutNs time.Duration `cbor:"timeout_ns"`
+	}{target(t), legacyTimeout(t.Timeout), t.Timeout})
+}
+
+func (t *DnsTarget) UnmarshalCBOR(data []byte) error {
+	type target DnsTarget
+	v := struct {
+		*target
+		Timeout   int64          `cbor:"timeout"`
+		TimeoutNs *time.Duration `cbor:"timeout_ns"`
+	}{target: (*target)(t)}
+	if err := cbor.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	t.Timeout = cborTimeout(v.TimeoutNs, v.Timeout)
+	return nil
+}
+
+func (t HttpTarget) MarshalCBOR() ([]byte, error) {
+	type target HttpTarget
+	return cbor.Marshal(struct {
+		target
+		Timeout   int64         `cbor:"timeout"`
+		TimeoutNs time.Duration `cbor:"timeout_ns"`
+	}{target(t), legacyTimeout(t.Timeout), t.Timeout})
+}
+
+func (t *HttpTarget) UnmarshalCBOR(data []byte) error {
+	type target HttpTarget
+	v := struct {
+		*target
+		Timeout   int64          `cbor:"timeout"`
+		TimeoutNs *time.Duration `cbor:"timeout_ns"`
+	}{target: (*target)(t)}
+	if err := cbor.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	t.Timeout = cborTimeout(v.TimeoutNs, v.Timeout)
+	return nil
+}
+
+func (t SpeedtestTarget) MarshalCBOR() ([]byte, error) {
+	type target SpeedtestTarget
+	return cbor.Marshal(struct {
+		target
+		Timeout   int64         `cbor:"timeout"`
+		TimeoutNs time.Duration `cbor:"timeout_ns"`
+	}{target(t), legacyTimeout(t.Timeout), t.Timeout})
+}
+
+func (t *SpeedtestTarget) UnmarshalCBOR(data []byte) error {
+	type target SpeedtestTarget
+	v := struct {
+		*target
+		Timeout   int64          `cbor:"timeout"`
+		TimeoutNs *time.Duration `cbor:"timeout_ns"`
+	}{target: (*target)(t)}
+	if err := cbor.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	t.Timeout = cborTimeout(v.TimeoutNs, v.Timeout)
+	return nil
+}
+
+func (t TracerouteTarget) MarshalCBOR() ([]byte, error) {
+	type target TracerouteTarget
+	return cbor.Marshal(struct {
+		target
+		Timeout   int64         `cbor:"timeout,omitempty"`
+		TimeoutNs time.Duration `cbor:"timeout_ns,omitempty"`
+	}{target(t), legacyTimeout(t.Timeout), t.Timeout})
+}
+
+func (t *TracerouteTarget) UnmarshalCBOR(data []byte) error {
+	type target TracerouteTarget
+	v := struct {
+		*target
+		Timeout   int64          `cbor:"timeout,omitempty"`
+		TimeoutNs *time.Duration `cbor:"timeout_ns,omitempty"`
+	}{target: (*target)(t)}
+	if err := cbor.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	t.Timeout = cborTimeout(v.TimeoutNs, v.Timeout)
+	return nil
+}
+
+func (t SnmpTarget) MarshalCBOR() ([]byte, error) {
+	type target SnmpTarget
+	return cbor.Marshal(struct {
+		target
+		Timeout   int64         `cbor:"timeout,omitempty"`
+		TimeoutNs time.Duration `cbor:"timeout_ns,omitempty"`
+	}{target(t), legacyTimeout(t.Timeout), t.Timeout})
+}
+
+func (t *SnmpTarget) UnmarshalCBOR(data []byte) error {
+	type target SnmpTarget
+	v := struct {
+		*target
+		Timeout   int64          `cbor:"timeout,omitempty"`
+		TimeoutNs *time.Duration `cbor:"timeout_ns,omitempty"`
+	}{target: (*target)(t)}
+	if err := cbor.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	t.Timeout = cborTimeout(v.TimeoutNs, v.Timeout)
+	return nil
+}
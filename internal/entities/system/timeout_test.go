@@ -0,0 +1,157 @@
+package system
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJsonTimeout(t *testing.T) {
+	tests := []struct {
+		json    string
+		timeout time.Duration
+	}{
+		{`5`, 5 * time.Second},
+		{`1.5`, 1500 * time.Millisecond},
+		{`0`, 0},
+		{`"5s"`, 5 * time.Second},
+		{`"250ms"`, 250 * time.Millisecond},
+		{`"1m30s"`, 90 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.json, func(t *testing.T) {
+			var timeout jsonTimeout
+			require.NoError(t, json.Unmarshal([]byte(tt.json), &timeout))
+			assert.Equal(t, tt.timeout, time.Duration(timeout))
+		})
+	}
+
+	var timeout jsonTimeout
+	assert.Error(t, json.Unmarshal([]byte(`"5 seconds"`), &timeout))
+	assert.Error(t, json.Unmarshal([]byte(`true`), &timeout))
+
+	data, err := json.Marshal(jsonTimeout(1500 * time.Millisecond))
+	require.NoError(t, err)
+	assert.Equal(t, `1.5`, string(data))
+}
+
+// roundTrip checks that a target reads its timeout from seconds and duration strings,
+// and writes it as seconds without changing its other fields
+func roundTrip[T any](t *testing.T, seconds, duration string, timeout func(T) time.Duration) {
+	var fromSeconds, fromDuration T
+	require.NoError(t, json.Unmarshal([]byte(seconds), &fromSeconds))
+	require.NoError(t, json.Unmarshal([]byte(duration), &fromDuration))
+	assert.Equal(t, 2500*time.Millisecond, timeout(fromSeconds))
+	assert.Equal(t, fromSeconds, fromDuration)
+
+	data, err := json.Marshal(fromDuration)
+	require.NoError(t, err)
+	assert.JSONEq(t, seconds, string(data))
+
+	var again T
+	require.NoError(t, json.Unmarshal(data, &again))
+	assert.Equal(t, fromSeconds, again)
+}
+
+func TestTargetTimeoutRoundTrip(t *testing.T) {
+	t.Run("ping", func(t *testing.T) {
+		roundTrip(t,
+			`{"host":"192.0.2.1","count":3,"timeout":2.5,"packet_size":56}`,
+			`{"host":"192.0.2.1","count":3,"timeout":"2.5s","packet_size":56}`,
+			func(target PingTarget) time.Duration { return target.Timeout })
+	})
+	t.Run("dns", func(t *testing.T) {
+		roundTrip(t,
+			`{"domain":"example.com","server":"1.1.1.1","type":"A","timeout":2.5,"protocol":"udp"}`,
+			`{"domain":"example.com","server":"1.1.1.1","type":"A","timeout":"2500ms","protocol":"udp"}`,
+			func(target DnsTarget) time.Duration { return target.Timeout })
+	})
+	t.Run("http", func(t *testing.T) {
+		roundTrip(t,
+			`{"url":"https://example.com","timeout":2.5,"method":"HEAD"}`,
+			`{"url":"https://example.com","timeout":"2.5s","method":"HEAD"}`,
+			func(target HttpTarget) time.Duration { return target.Timeout })
+	})
+	t.Run("speedtest", func(t *testing.T) {
+		roundTrip(t,
+			`{"server_id":"52365","timeout":2.5,"provider":"ookla"}`,
+			`{"server_id":"52365","timeout":"2.5s","provider":"ookla"}`,
+			func(target SpeedtestTarget) time.Duration { return target.Timeout })
+	})
+	t.Run("traceroute", func(t *testing.T) {
+		roundTrip(t,
+			`{"host":"192.0.2.1","max_hops":20,"timeout":2.5}`,
+			`{"host":"192.0.2.1","max_hops":20,"timeout":"2.5s"}`,
+			func(target TracerouteTarget) time.Duration { return target.Timeout })
+	})
+	t.Run("snmp", func(t *testing.T) {
+		roundTrip(t,
+			`{"host":"192.0.2.1","version":"2c","timeout":2.5,"interfaces":[2]}`,
+			`{"host":"192.0.2.1","version":"2c","timeout":"2.5s","interfaces":[2]}`,
+			func(target SnmpTarget) time.Duration { return target.Timeout })
+	})
+
+	// optional timeouts are left out when unset
+	data, err := json.Marshal(TracerouteTarget{Host: "192.0.2.1"})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"host":"192.0.2.1"}`, string(data))
+
+	// a null timeout keeps the default
+	var target PingTarget
+	require.NoError(t, json.Unmarshal([]byte(`{"host":"192.0.2.1","timeout":null}`), &target))
+	assert.Zero(t, target.Timeout)
+}
+
+func TestCborTimeout(t *testing.T) {
+	// a round trip keeps sub-second timeouts
+	data, err := cbor.Marshal(HttpTarget{URL: "https://example.com", Timeout: 1500 * time.Millisecond})
+	require.NoError(t, err)
+	var target HttpTarget
+	require.NoError(t, cbor.Unmarshal(data, &target))
+	assert.Equal(t, HttpTarget{URL: "https://example.com", Timeout: 1500 * time.Millisecond}, target)
+
+	// agents from before timeouts were durations read whole seconds
+	var legacy struct {
+		URL     string `json:"url"`
+		Timeout int    `json:"timeout"`
+	}
+	require.NoError(t, cbor.Unmarshal(data, &legacy))
+	assert.Equal(t, 2, legacy.Timeout)
+
+	// and configurations of older hubs have the timeout in seconds only
+	legacy.Timeout = 10
+	data, err = cbor.Marshal(legacy)
+	require.NoError(t, err)
+	require.NoError(t, cbor.Unmarshal(data, &target))
+	assert.Equal(t, 10*time.Second, target.Timeout)
+
+	var dns DnsTarget
+	data, err = cbor.Marshal(map[string]any{"domain": "example.com", "timeout": 5})
+	require.NoError(t, err)
+	require.NoError(t, cbor.Unmarshal(data, &dns))
+	assert.Equal(t, DnsTarget{Domain: "example.com", Timeout: 5 * time.Second}, dns)
+
+	// older agents read ping timeouts in nanoseconds
+	data, err = cbor.Marshal(PingTarget{Host: "1.1.1.1", Timeout: 2 * time.Second})
+	require.NoError(t, err)
+	var legacyPing struct {
+		Timeout time.Duration `json:"timeout"`
+	}
+	require.NoError(t, cbor.Unmarshal(data, &legacyPing))
+	assert.Equal(t, 2*time.Second, legacyPing.Timeout)
+
+	// the configuration sent to agents keeps the timeouts
+	config := MonitoringConfig{}
+	config.Snmp.Targets = []SnmpTarget{{Host: "192.0.2.1", Timeout: 3 * time.Second}}
+	config.Traceroute.Targets = []TracerouteTarget{{Host: "192.0.2.2"}}
+	data, err = cbor.Marshal(config)
+	require.NoError(t, err)
+	var decoded MonitoringConfig
+	require.NoError(t, cbor.Unmarshal(data, &decoded))
+	assert.Equal(t, 3*time.Second, decoded.Snmp.Targets[0].Timeout)
+	assert.Zero(t, decoded.Traceroute.Targets[0].Timeout)
+}
@@ -3,12 +3,17 @@ package ghupdate
 import (
 	"archive/tar"
 	"archive/zip"
+	"bufio"
 	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -18,6 +23,12 @@ import (
 	"github.com/fatih/color"
 )
 
+// apiURL is the GitHub API, a variable so tests can point it to a fake server
+var apiURL = "https://api.github.com"
+
+// selfTestTimeout is how long the new binary may take to print its version after an update
+const selfTestTimeout = 10 * time.Second
+
 type Release struct {
 	TagName    string  `json:"tag_name"`
 	Name       string  `json:"name"`
@@ -37,6 +48,11 @@ type Config struct {
 	Repo    string
 	Current string
 	Filters []string
+	// AllowPrerelease also considers pre-releases, picking the highest version of all releases
+	AllowPrerelease bool
+	// Channel pins pre-releases to a channel, like "beta" for 1.2.0-beta.1, and implies AllowPrerelease.
+	// Stable releases are always considered.
+	Channel string
 }
 
 func (r *Release) Version() (semver.Version, error) {
@@ -79,48 +95,127 @@ func (r *Release) FindAsset(filters []string) *Asset {
 	return nil
 }
 
-func CheckForUpdate(config Config) (*Release, bool, error) {
-	url := fmt.Sprintf("https://api.github.com/repos/%s/releases/latest", config.Repo)
-	
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Get(url)
-	if err != nil {
-		return nil, false, fmt.Errorf("failed to fetch release info: %w", err)
-	}
-	defer resp.Body.Close()
-	
-	if resp.StatusCode != http.StatusOK {
-		return nil, false, fmt.Errorf("GitHub API returned status %d", resp.StatusCode)
+// FindChecksum returns the asset holding the SHA256 checksum of asset, either a
+// "<asset>.sha256" file or a checksums file listing all assets of the release
+func (r *Release) FindChecksum(asset *Asset) *Asset {
+	var checksums *Asset
+	for i := range r.Assets {
+		name := strings.ToLower(r.Assets[i].Name)
+		if name == strings.ToLower(asset.Name)+".sha256" {
+			return &r.Assets[i]
+		}
+		if checksums == nil && (strings.Contains(name, "checksums") || strings.Contains(name, "sha256sums")) {
+			checksums = &r.Assets[i]
+		}
 	}
-	
-	var release Release
-	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
-		return nil, false, fmt.Errorf("failed to decode release info: %w", err)
+	return checksums
+}
+
+func CheckForUpdate(config Config) (*Release, bool, error) {
+	var release *Release
+	if config.AllowPrerelease || config.Channel != "" {
+		var releases []Release
+		if err := fetchJSON(fmt.Sprintf("%s/repos/%s/releases?per_page=100", apiURL, config.Repo), &releases); err != nil {
+			return nil, false, err
+		}
+		release = selectRelease(releases, config.Channel)
+	} else {
+		release = &Release{}
+		if err := fetchJSON(fmt.Sprintf("%s/repos/%s/releases/latest", apiURL, config.Repo), release); err != nil {
+			return nil, false, err
+		}
+		// Skip drafts and pre-releases
+		if release.Draft || release.PreRelease {
+			release = nil
+		}
 	}
-	
-	// Skip drafts and pre-releases
-	if release.Draft || release.PreRelease {
+	if release == nil {
 		return nil, false, nil
 	}
-	
+
 	currentVersion, err := semver.Parse(config.Current)
 	if err != nil {
 		return nil, false, fmt.Errorf("invalid current version: %w", err)
 	}
-	
+
 	latestVersion, err := release.Version()
 	if err != nil {
 		return nil, false, fmt.Errorf("invalid release version: %w", err)
 	}
-	
+
 	if latestVersion.GT(currentVersion) {
-		return &release, true, nil
+		return release, true, nil
 	}
-	
-	return &release, false, nil
+
+	return release, false, nil
+}
+
+// GetRelease returns the release of a version, tagged like "v1.2.3"
+func GetRelease(repo, version string) (*Release, error) {
+	release := &Release{}
+	tag := "v" + strings.TrimPrefix(version, "v")
+	if err := fetchJSON(fmt.Sprintf("%s/repos/%s/releases/tags/%s", apiURL, repo, tag), release); err != nil {
+		return nil, err
+	}
+	return release, nil
+}
+
+// selectRelease returns the release with the highest semver, pre-releases included, following
+// the semver ordering of pre-releases. Drafts and releases without a valid version are skipped,
+// as are pre-releases of other channels than channel if it is set.
+func selectRelease(releases []Release, channel string) *Release {
+	var latest *Release
+	var latestVersion semver.Version
+	for i := range releases {
+		release := &releases[i]
+		if release.Draft {
+			continue
+		}
+		version, err := release.Version()
+		if err != nil {
+			continue
+		}
+		if channel != "" && len(version.Pre) > 0 && version.Pre[0].String() != channel {
+			continue
+		}
+		if latest == nil || version.GT(latestVersion) {
+			latest, latestVersion = release, version
+		}
+	}
+	return latest
 }
 
-func UpdateBinary(asset *Asset, targetPath string) error {
+// fetchJSON decodes the JSON response of a GitHub API request into v
+func fetchJSON(url string, v any) error {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("failed to fetch release info: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GitHub API returned status %d", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode release info: %w", err)
+	}
+	return nil
+}
+
+// UpdateBinary downloads asset, verifies it against the SHA256 checksum published in the
+// checksum asset and replaces the binary at targetPath with it. The previous binary is kept
+// as a backup and restored if the new one fails to run with --version.
+func UpdateBinary(asset, checksum *Asset, targetPath string) error {
+	if checksum == nil {
+		return fmt.Errorf("release has no checksum for %s", asset.Name)
+	}
+	expected, err := fetchChecksum(checksum, asset.Name)
+	if err != nil {
+		return fmt.Errorf("failed to get checksum: %w", err)
+	}
+
 	// Create temporary file for download
 	tempFile, err := os.CreateTemp("", "update-*")
 	if err != nil {
@@ -133,6 +228,15 @@ func UpdateBinary(asset *Asset, targetPath string) error {
 	if err := downloadFile(asset.BrowserDownloadURL, tempFile.Name()); err != nil {
 		return fmt.Errorf("failed to download update: %w", err)
 	}
+
+	// Verify the download before extracting anything from it
+	actual, err := fileSHA256(tempFile.Name())
+	if err != nil {
+		return fmt.Errorf("failed to hash update: %w", err)
+	}
+	if actual != expected {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s, the download is corrupted or was tampered with", asset.Name, expected, actual)
+	}
 	
 	// Extract binary from archive if needed
 	binaryPath := tempFile.Name()
@@ -152,24 +256,110 @@ func UpdateBinary(asset *Asset, targetPath string) error {
 		binaryPath = extractedPath
 	}
 	
-	// Make executable
-	if err := os.Chmod(binaryPath, 0755); err != nil {
+	if err := replaceBinary(binaryPath, targetPath); err != nil {
+		return err
+	}
+
+	// Roll back if the new binary doesn't run
+	if err := selfTest(targetPath); err != nil {
+		if rollbackErr := RollbackBinary(targetPath); rollbackErr != nil {
+			return fmt.Errorf("new binary failed to run (%w) and rollback failed: %w", err, rollbackErr)
+		}
+		return fmt.Errorf("new binary failed to run, restored the previous version: %w", err)
+	}
+
+	return nil
+}
+
+// backupPath returns the path the binary at targetPath is backed up to during an update
+func backupPath(targetPath string) string {
+	return targetPath + ".bak"
+}
+
+// replaceBinary moves the binary at binaryPath to targetPath, backing up the current binary.
+// The current binary is renamed aside rather than overwritten, which Windows doesn't allow
+// for a running executable. The new binary is first copied next to the target, so the final
+// rename is atomic even if binaryPath is on another file system.
+func replaceBinary(binaryPath, targetPath string) error {
+	newPath := targetPath + ".new"
+	if err := copyFile(binaryPath, newPath); err != nil {
+		os.Remove(newPath)
+		return fmt.Errorf("failed to copy new binary: %w", err)
+	}
+	if err := os.Chmod(newPath, 0755); err != nil {
+		os.Remove(newPath)
 		return fmt.Errorf("failed to make binary executable: %w", err)
 	}
-	
-	// Replace the current binary
-	if err := os.Rename(binaryPath, targetPath); err != nil {
+
+	backup := backupPath(targetPath)
+	os.Remove(backup)
+	if err := os.Rename(targetPath, backup); err != nil {
+		os.Remove(newPath)
+		return fmt.Errorf("failed to back up current binary: %w", err)
+	}
+	if err := os.Rename(newPath, targetPath); err != nil {
+		os.Remove(newPath)
+		if restoreErr := os.Rename(backup, targetPath); restoreErr != nil {
+			return fmt.Errorf("failed to replace binary (%w), the previous binary is at %s", err, backup)
+		}
 		return fmt.Errorf("failed to replace binary: %w", err)
 	}
-	
-	// Make sure target is executable
-	if err := os.Chmod(targetPath, 0755); err != nil {
-		return fmt.Errorf("failed to make target executable: %w", err)
+	return nil
+}
+
+// RollbackBinary restores the binary at targetPath from the backup made by the last update
+func RollbackBinary(targetPath string) error {
+	backup := backupPath(targetPath)
+	if _, err := os.Stat(backup); err != nil {
+		return fmt.Errorf("no backup to roll back to: %w", err)
+	}
+
+	// rename the failed binary aside, it can't be overwritten on Windows while it runs
+	failedPath := targetPath + ".failed"
+	os.Remove(failedPath)
+	if err := os.Rename(targetPath, failedPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to move new binary aside: %w", err)
+	}
+	if err := os.Rename(backup, targetPath); err != nil {
+		return fmt.Errorf("failed to restore backup: %w", err)
+	}
+	os.Remove(failedPath)
+	return nil
+}
+
+// selfTest runs the binary at path with --version and reports whether it exits cleanly
+func selfTest(path string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), selfTestTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, path, "--version").CombinedOutput()
+	if err != nil {
+		if text := strings.TrimSpace(string(output)); text != "" {
+			return fmt.Errorf("%w: %s", err, text)
+		}
+		return err
 	}
-	
 	return nil
 }
 
+// copyFile copies the file at src to dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
 func downloadFile(url, filepath string) error {
 	client := &http.Client{Timeout: 5 * time.Minute}
 	resp, err := client.Get(url)
@@ -192,6 +382,57 @@ func downloadFile(url, filepath string) error {
 	return err
 }
 
+// fetchChecksum downloads the checksum asset and returns the SHA256 it lists for assetName.
+// A checksum file with a single hash and no file names applies to the asset.
+func fetchChecksum(checksum *Asset, assetName string) (string, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(checksum.BrowserDownloadURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("download of %s failed with status %d", checksum.Name, resp.StatusCode)
+	}
+
+	// lines are "<hash>  <file>", with a "*" before binary mode file names
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, 1<<20))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		switch {
+		case len(fields) == 1 && strings.HasSuffix(strings.ToLower(checksum.Name), ".sha256"):
+		case len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == assetName:
+		default:
+			continue
+		}
+		hash := strings.ToLower(fields[0])
+		if _, err := hex.DecodeString(hash); err != nil || len(hash) != sha256.Size*2 {
+			return "", fmt.Errorf("invalid checksum for %s in %s", assetName, checksum.Name)
+		}
+		return hash, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("%s has no checksum for %s", checksum.Name, assetName)
+}
+
+// fileSHA256 returns the hex encoded SHA256 of the file at path
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
 func extractTarGz(archivePath, binaryName string) (string, error) {
 	file, err := os.Open(archivePath)
 	if err != nil {
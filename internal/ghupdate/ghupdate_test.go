@@ -0,0 +1,178 @@
+package ghupdate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindChecksum(t *testing.T) {
+	asset := Asset{Name: "beszel-agent_linux_x86_64.tar.gz"}
+	release := &Release{Assets: []Asset{
+		{Name: "beszel_0.12.0_checksums.txt"},
+		asset,
+		{Name: "beszel-agent_linux_x86_64.tar.gz.sha256"},
+	}}
+	// a checksum file of the asset itself is preferred
+	assert.Equal(t, "beszel-agent_linux_x86_64.tar.gz.sha256", release.FindChecksum(&asset).Name)
+
+	release.Assets = release.Assets[:2]
+	assert.Equal(t, "beszel_0.12.0_checksums.txt", release.FindChecksum(&asset).Name)
+
+	release.Assets = release.Assets[1:]
+	assert.Nil(t, release.FindChecksum(&asset))
+}
+
+func TestUpdateBinary(t *testing.T) {
+	binary := []byte("#!/bin/sh\necho updated\n")
+	sum := sha256.Sum256(binary)
+	files := map[string]string{
+		"/beszel-agent_linux_x86_64":        string(binary),
+		"/checksums.txt":                    "0123  other-asset\n" + hex.EncodeToString(sum[:]) + " *beszel-agent_linux_x86_64\n",
+		"/beszel-agent_linux_x86_64.sha256": hex.EncodeToString(sum[:]) + "\n",
+		"/bad.sha256":                       "ab4f63f9ac65152575886860dde480a1c2b32575e0ba3f0c8e3b6c6e7b9e7f3a\n",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(content))
+	}))
+	t.Cleanup(server.Close)
+
+	asset := &Asset{Name: "beszel-agent_linux_x86_64", BrowserDownloadURL: server.URL + "/beszel-agent_linux_x86_64"}
+	checksumAsset := func(name string) *Asset {
+		return &Asset{Name: name, BrowserDownloadURL: server.URL + "/" + name}
+	}
+	update := func(checksum *Asset) (string, error) {
+		target := filepath.Join(t.TempDir(), "beszel-agent")
+		require.NoError(t, os.WriteFile(target, []byte("old"), 0755))
+		err := UpdateBinary(asset, checksum, target)
+		content, readErr := os.ReadFile(target)
+		require.NoError(t, readErr)
+		return string(content), err
+	}
+
+	for _, name := range []string{"checksums.txt", "beszel-agent_linux_x86_64.sha256"} {
+		content, err := update(checksumAsset(name))
+		require.NoError(t, err, name)
+		assert.Equal(t, string(binary), content, name)
+	}
+
+	// the binary is kept if the download can't be verified
+	content, err := update(checksumAsset("bad.sha256"))
+	assert.ErrorContains(t, err, "checksum mismatch")
+	assert.Equal(t, "old", content)
+
+	content, err = update(&Asset{Name: "other_checksums.txt", BrowserDownloadURL: server.URL + "/missing"})
+	assert.ErrorContains(t, err, "failed to get checksum")
+	assert.Equal(t, "old", content)
+
+	content, err = update(nil)
+	assert.ErrorContains(t, err, "no checksum")
+	assert.Equal(t, "old", content)
+
+	// a binary that fails to run is rolled back
+	broken := []byte("#!/bin/sh\necho broken >&2\nexit 1\n")
+	brokenSum := sha256.Sum256(broken)
+	files["/beszel-agent_linux_x86_64"] = string(broken)
+	files["/beszel-agent_linux_x86_64.sha256"] = hex.EncodeToString(brokenSum[:])
+	content, err = update(checksumAsset("beszel-agent_linux_x86_64.sha256"))
+	assert.ErrorContains(t, err, "restored the previous version")
+	assert.ErrorContains(t, err, "broken")
+	assert.Equal(t, "old", content)
+}
+
+func TestRollbackBinary(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "beszel-agent")
+	require.NoError(t, os.WriteFile(target, []byte("old"), 0755))
+	newBinary := filepath.Join(t.TempDir(), "new")
+	require.NoError(t, os.WriteFile(newBinary, []byte("new"), 0644))
+
+	require.NoError(t, replaceBinary(newBinary, target))
+	content, err := os.ReadFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(content))
+	info, err := os.Stat(target)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+	backup, err := os.ReadFile(target + ".bak")
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(backup))
+
+	require.NoError(t, RollbackBinary(target))
+	content, err = os.ReadFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(content))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "no backup or failed binary is left behind")
+
+	assert.ErrorContains(t, RollbackBinary(target), "no backup")
+}
+
+func TestCheckForUpdatePrerelease(t *testing.T) {
+	releases := `[
+		{"tag_name": "v1.3.0-rc.1", "prerelease": true},
+		{"tag_name": "v1.3.0-beta.2", "prerelease": true},
+		{"tag_name": "v1.3.0-beta.10", "prerelease": true},
+		{"tag_name": "v1.4.0-alpha", "prerelease": true, "draft": true},
+		{"tag_name": "v1.2.1"},
+		{"tag_name": "nightly", "prerelease": true}
+	]`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/owner/repo/releases":
+			_, _ = w.Write([]byte(releases))
+		case "/repos/owner/repo/releases/latest":
+			_, _ = w.Write([]byte(`{"tag_name": "v1.2.1"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	originalURL := apiURL
+	apiURL = server.URL
+	t.Cleanup(func() { apiURL = originalURL })
+
+	check := func(config Config) (string, bool) {
+		config.Repo = "owner/repo"
+		release, hasUpdate, err := CheckForUpdate(config)
+		require.NoError(t, err)
+		require.NotNil(t, release)
+		return release.TagName, hasUpdate
+	}
+
+	// stable only by default
+	tag, hasUpdate := check(Config{Current: "1.2.0"})
+	assert.Equal(t, "v1.2.1", tag)
+	assert.True(t, hasUpdate)
+
+	// the highest pre-release, rc sorts after beta and drafts are skipped
+	tag, hasUpdate = check(Config{Current: "1.2.0", AllowPrerelease: true})
+	assert.Equal(t, "v1.3.0-rc.1", tag)
+	assert.True(t, hasUpdate)
+
+	// numeric identifiers compare as numbers
+	tag, _ = check(Config{Current: "1.2.0", Channel: "beta"})
+	assert.Equal(t, "v1.3.0-beta.10", tag)
+
+	// a pre-release is older than its release
+	tag, hasUpdate = check(Config{Current: "1.3.0", AllowPrerelease: true})
+	assert.Equal(t, "v1.3.0-rc.1", tag)
+	assert.False(t, hasUpdate)
+
+	// channels without releases fall back to stable
+	tag, _ = check(Config{Current: "1.2.0", Channel: "nightly"})
+	assert.Equal(t, "v1.2.1", tag)
+}
@@ -93,6 +93,10 @@ func (acr *agentConnectRequest) agentConnect() (err error) {
 // JWT token, then adds the system to the system manager.
 func (acr *agentConnectRequest) verifyWsConn(conn *gws.Conn, fpRecords []ws.FingerprintRecord) (err error) {
 	wsConn := ws.NewWsConnection(conn)
+	// reject system data that isn't signed with the key derived from the agent's token
+	if verify, _ := GetEnv("VERIFY_AGENT_DATA"); verify == "true" {
+		wsConn.SetSigningKey(common.DataSigningKey(acr.token))
+	}
 
 	// must set wsConn in connection store before the read loop
 	conn.Session().Store("wsConn", wsConn)
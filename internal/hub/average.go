@@ -1,6 +1,7 @@
 package hub
 
 import (
+	"beszel/internal/entities/system"
 	"fmt"
 	"math"
 
@@ -12,12 +13,36 @@ import (
 type SystemAverages struct {
 	AP  float64 `json:"ap"`  // Average ping latency
 	APL float64 `json:"apl"` // Average ping packet loss
+	APQ float64 `json:"apq"` // Average ping quality index
+	APJ float64 `json:"apj"` // Average ping jitter
 	AD  float64 `json:"ad"`  // Average DNS lookup time
 	ADF float64 `json:"adf"` // Average DNS failure rate
 	AH  float64 `json:"ah"`  // Average HTTP response time
 	AHF float64 `json:"ahf"` // Average HTTP failure rate
+	AHE float64 `json:"ahe"` // Average HTTP error response rate
 	ADL float64 `json:"adl"` // Average download
 	AUL float64 `json:"aul"` // Average upload
+
+	PP95 float64 `json:"pp95"` // 95th percentile ping latency
+	PP99 float64 `json:"pp99"` // 99th percentile ping latency
+	DP95 float64 `json:"dp95"` // 95th percentile DNS lookup time
+	DP99 float64 `json:"dp99"` // 99th percentile DNS lookup time
+	HP95 float64 `json:"hp95"` // 95th percentile HTTP response time
+	HP99 float64 `json:"hp99"` // 99th percentile HTTP response time
+}
+
+// latencyPercentiles are the tail latencies of the sampled records
+type latencyPercentiles struct {
+	P95 float64
+	P99 float64
+}
+
+// newLatencyPercentiles returns the 95th and 99th percentile of the latencies, sorting them in place
+func newLatencyPercentiles(latencies []float64) latencyPercentiles {
+	return latencyPercentiles{
+		P95: math.Round(system.Percentile(latencies, 95)*100) / 100,
+		P99: math.Round(system.Percentile(latencies, 99)*100) / 100,
+	}
 }
 
 // calculateSystemAverages calculates averages from historical data for all systems
@@ -46,10 +71,11 @@ func (h *Hub) calculateSystemAverages() error {
 			h.Logger().Error("Failed to store historical averages", "system", systemID, "err", err)
 		} else {
 			h.Logger().Debug("Stored historical averages", "system", systemID,
-				"ping_latency", averages.AP, "ping_packet_loss", averages.APL,
+				"ping_latency", averages.AP, "ping_packet_loss", averages.APL, "ping_quality", averages.APQ, "ping_jitter", averages.APJ,
 				"dns_latency", averages.AD, "dns_failure_rate", averages.ADF,
-				"http_latency", averages.AH, "http_failure_rate", averages.AHF,
-				"download", averages.ADL, "upload", averages.AUL)
+				"http_latency", averages.AH, "http_failure_rate", averages.AHF, "http_error_rate", averages.AHE,
+				"download", averages.ADL, "upload", averages.AUL,
+				"ping_p95", averages.PP95, "dns_p95", averages.DP95, "http_p95", averages.HP95)
 		}
 	}
 
@@ -62,34 +88,43 @@ func (h *Hub) calculateAveragesForSystem(systemID string) (*SystemAverages, erro
 	averages := &SystemAverages{}
 
 	// Calculate ping average from ping_stats
-	pingAvg, pingLossAvg, err := h.calculatePingAverage(systemID)
+	pingAvg, pingLossAvg, pingQualityAvg, pingJitterAvg, pingPercentiles, err := h.calculatePingAverage(systemID, h.sm.AverageSamples("ping_stats"))
 	if err != nil {
 		h.Logger().Error("Failed to calculate ping average", "system", systemID, "err", err)
 	} else {
 		averages.AP = pingAvg
 		averages.APL = pingLossAvg
+		averages.APQ = pingQualityAvg
+		averages.APJ = pingJitterAvg
+		averages.PP95 = pingPercentiles.P95
+		averages.PP99 = pingPercentiles.P99
 	}
 
 	// Calculate DNS average from dns_stats
-	dnsAvg, dnsFailureAvg, err := h.calculateDNSAverage(systemID)
+	dnsAvg, dnsFailureAvg, dnsPercentiles, err := h.calculateDNSAverage(systemID, h.sm.AverageSamples("dns_stats"))
 	if err != nil {
 		h.Logger().Error("Failed to calculate DNS average", "system", systemID, "err", err)
 	} else {
 		averages.AD = dnsAvg
 		averages.ADF = dnsFailureAvg
+		averages.DP95 = dnsPercentiles.P95
+		averages.DP99 = dnsPercentiles.P99
 	}
 
 	// Calculate HTTP average from http_stats
-	httpAvg, httpFailureAvg, err := h.calculateHTTPAverage(systemID)
+	httpAvg, httpFailureAvg, httpErrorAvg, httpPercentiles, err := h.calculateHTTPAverage(systemID, h.sm.AverageSamples("http_stats"))
 	if err != nil {
 		h.Logger().Error("Failed to calculate HTTP average", "system", systemID, "err", err)
 	} else {
 		averages.AH = httpAvg
 		averages.AHF = httpFailureAvg
+		averages.AHE = httpErrorAvg
+		averages.HP95 = httpPercentiles.P95
+		averages.HP99 = httpPercentiles.P99
 	}
 
 	// Calculate speedtest averages from speedtest_stats
-	downloadAvg, uploadAvg, err := h.calculateSpeedtestAverages(systemID)
+	downloadAvg, uploadAvg, err := h.calculateSpeedtestAverages(systemID, h.sm.AverageSamples("speedtest_stats"))
 	if err != nil {
 		h.Logger().Error("Failed to calculate speedtest averages", "system", systemID, "err", err)
 	} else {
@@ -100,27 +135,34 @@ func (h *Hub) calculateAveragesForSystem(systemID string) (*SystemAverages, erro
 	return averages, nil
 }
 
-// calculatePingAverage calculates the average ping time and packet loss from the last 10 ping_stats records
-func (h *Hub) calculatePingAverage(systemID string) (float64, float64, error) {
+// calculatePingAverage calculates the average ping time, packet loss, quality index and jitter, and the
+// ping time percentiles, from the latest ping_stats records
+func (h *Hub) calculatePingAverage(systemID string, samples int) (float64, float64, float64, float64, latencyPercentiles, error) {
 	var pingStats []struct {
 		AvgRtt     float64 `db:"avg_rtt"`
+		MinRtt     float64 `db:"min_rtt"`
+		MaxRtt     float64 `db:"max_rtt"`
+		StdDevRtt  float64 `db:"std_dev_rtt"`
 		PacketLoss float64 `db:"packet_loss"`
 	}
 
 	err := h.DB().NewQuery(`
-		SELECT avg_rtt, packet_loss
+		SELECT avg_rtt, min_rtt, max_rtt, std_dev_rtt, packet_loss
 		FROM ping_stats
 		WHERE system = {:system}
 		ORDER BY created DESC
-		LIMIT 10
-	`).Bind(dbx.Params{"system": systemID}).All(&pingStats)
+		LIMIT {:samples}
+	`).Bind(dbx.Params{"system": systemID, "samples": samples}).All(&pingStats)
 
 	if err != nil || len(pingStats) == 0 {
-		return 0, 0, err
+		return 0, 0, 0, 0, latencyPercentiles{}, err
 	}
 
+	latencies := make([]float64, 0, len(pingStats))
 	totalLatency := 0.0
 	totalPacketLoss := 0.0
+	totalQuality := 0.0
+	totalJitter := 0.0
 	latencyCount := 0
 	packetLossCount := 0
 
@@ -129,11 +171,21 @@ func (h *Hub) calculatePingAverage(systemID string) (float64, float64, error) {
 		if stat.AvgRtt > 0 {
 			totalLatency += stat.AvgRtt
 			latencyCount++
+			latencies = append(latencies, stat.AvgRtt)
 		}
 
 		// Calculate average packet loss (include all records)
 		totalPacketLoss += stat.PacketLoss
 		packetLossCount++
+
+		// Quality index is computed from the raw values so older rows are included
+		result := system.PingResult{AvgRtt: stat.AvgRtt, MinRtt: stat.MinRtt, MaxRtt: stat.MaxRtt, StdDevRtt: stat.StdDevRtt, PacketLoss: stat.PacketLoss}
+		totalQuality += result.QualityIndex()
+
+		// Jitter only exists for successful pings
+		if stat.AvgRtt > 0 {
+			totalJitter += result.AlertJitter()
+		}
 	}
 
 	avgLatency := 0.0
@@ -146,11 +198,19 @@ func (h *Hub) calculatePingAverage(systemID string) (float64, float64, error) {
 		avgPacketLoss = math.Round((totalPacketLoss/float64(packetLossCount))*100) / 100
 	}
 
-	return avgLatency, avgPacketLoss, nil
+	avgQuality := math.Round((totalQuality/float64(len(pingStats)))*100) / 100
+
+	avgJitter := 0.0
+	if latencyCount > 0 {
+		avgJitter = math.Round((totalJitter/float64(latencyCount))*100) / 100
+	}
+
+	return avgLatency, avgPacketLoss, avgQuality, avgJitter, newLatencyPercentiles(latencies), nil
 }
 
-// calculateDNSAverage calculates the average DNS lookup time and failure rate from the last 10 dns_stats records
-func (h *Hub) calculateDNSAverage(systemID string) (float64, float64, error) {
+// calculateDNSAverage calculates the average DNS lookup time and failure rate, and the lookup time
+// percentiles, from the latest dns_stats records
+func (h *Hub) calculateDNSAverage(systemID string, samples int) (float64, float64, latencyPercentiles, error) {
 	var dnsStats []struct {
 		LookupTime float64 `db:"lookup_time"`
 		Status     string  `db:"status"`
@@ -161,13 +221,14 @@ func (h *Hub) calculateDNSAverage(systemID string) (float64, float64, error) {
 		FROM dns_stats 
 		WHERE system = {:system}
 		ORDER BY created DESC 
-		LIMIT 10
-	`).Bind(dbx.Params{"system": systemID}).All(&dnsStats)
+		LIMIT {:samples}
+	`).Bind(dbx.Params{"system": systemID, "samples": samples}).All(&dnsStats)
 
 	if err != nil || len(dnsStats) == 0 {
-		return 0, 0, err
+		return 0, 0, latencyPercentiles{}, err
 	}
 
+	lookupTimes := make([]float64, 0, len(dnsStats))
 	totalLookupTime := 0.0
 	successfulLookups := 0
 	failedLookups := 0
@@ -177,6 +238,7 @@ func (h *Hub) calculateDNSAverage(systemID string) (float64, float64, error) {
 		if stat.Status == "success" && stat.LookupTime > 0 {
 			totalLookupTime += stat.LookupTime
 			successfulLookups++
+			lookupTimes = append(lookupTimes, stat.LookupTime)
 		}
 
 		// Count failures
@@ -198,43 +260,53 @@ func (h *Hub) calculateDNSAverage(systemID string) (float64, float64, error) {
 		avgFailureRate = math.Round((float64(failedLookups)/float64(totalLookups)*100)*100) / 100
 	}
 
-	return avgLookupTime, avgFailureRate, nil
+	return avgLookupTime, avgFailureRate, newLatencyPercentiles(lookupTimes), nil
 }
 
-// calculateHTTPAverage calculates the average HTTP response time and failure rate from the last 10 http_stats records
-func (h *Hub) calculateHTTPAverage(systemID string) (float64, float64, error) {
+// calculateHTTPAverage calculates the average HTTP response time, failure rate and error response rate,
+// and the response time percentiles, from the latest http_stats records
+func (h *Hub) calculateHTTPAverage(systemID string, samples int) (float64, float64, float64, latencyPercentiles, error) {
 	var httpStats []struct {
 		ResponseTime float64 `db:"response_time"`
 		Status       string  `db:"status"`
+		StatusCode   int     `db:"status_code"`
 	}
 
 	err := h.DB().NewQuery(`
-		SELECT response_time, status
+		SELECT response_time, status, status_code
 		FROM http_stats 
 		WHERE system = {:system}
 		ORDER BY created DESC 
-		LIMIT 10
-	`).Bind(dbx.Params{"system": systemID}).All(&httpStats)
+		LIMIT {:samples}
+	`).Bind(dbx.Params{"system": systemID, "samples": samples}).All(&httpStats)
 
 	if err != nil || len(httpStats) == 0 {
-		return 0, 0, err
+		return 0, 0, 0, latencyPercentiles{}, err
 	}
 
+	responseTimes := make([]float64, 0, len(httpStats))
 	totalResponseTime := 0.0
 	successfulRequests := 0
 	failedRequests := 0
+	errorResponses := 0
 
 	for _, stat := range httpStats {
 		// Calculate average response time (only for successful requests)
 		if stat.Status == "success" && stat.ResponseTime > 0 {
 			totalResponseTime += stat.ResponseTime
 			successfulRequests++
+			responseTimes = append(responseTimes, stat.ResponseTime)
 		}
 
 		// Count failures
 		if stat.Status != "success" {
 			failedRequests++
 		}
+
+		// Count 4xx and 5xx responses, which don't fail a check without expected status codes
+		if stat.StatusCode >= 400 {
+			errorResponses++
+		}
 	}
 
 	// Calculate average response time
@@ -246,15 +318,18 @@ func (h *Hub) calculateHTTPAverage(systemID string) (float64, float64, error) {
 	// Calculate failure rate
 	totalRequests := len(httpStats)
 	avgFailureRate := 0.0
+	avgErrorRate := 0.0
 	if totalRequests > 0 {
 		avgFailureRate = math.Round((float64(failedRequests)/float64(totalRequests)*100)*100) / 100
+		avgErrorRate = math.Round((float64(errorResponses)/float64(totalRequests)*100)*100) / 100
 	}
 
-	return avgResponseTime, avgFailureRate, nil
+	return avgResponseTime, avgFailureRate, avgErrorRate, newLatencyPercentiles(responseTimes), nil
 }
 
-// calculateSpeedtestAverages calculates the average download and upload speeds from the last 10 speedtest_stats records
-func (h *Hub) calculateSpeedtestAverages(systemID string) (float64, float64, error) {
+// calculateSpeedtestAverages calculates the average download and upload speeds from the latest successful speedtest_stats records.
+// Implausible results are left out, as are failed ones. The upload average leaves out download-only tests.
+func (h *Hub) calculateSpeedtestAverages(systemID string, samples int) (float64, float64, error) {
 	var speedtestStats []struct {
 		DownloadSpeed float64 `db:"download_speed"`
 		UploadSpeed   float64 `db:"upload_speed"`
@@ -263,10 +338,10 @@ func (h *Hub) calculateSpeedtestAverages(systemID string) (float64, float64, err
 	err := h.DB().NewQuery(`
 		SELECT download_speed, upload_speed 
 		FROM speedtest_stats 
-		WHERE system = {:system} AND download_speed > 0 AND upload_speed > 0 AND status = 'success' 
+		WHERE system = {:system} AND download_speed > 0 AND status = 'success' 
 		ORDER BY created DESC 
-		LIMIT 10
-	`).Bind(dbx.Params{"system": systemID}).All(&speedtestStats)
+		LIMIT {:samples}
+	`).Bind(dbx.Params{"system": systemID, "samples": samples}).All(&speedtestStats)
 
 	if err != nil || len(speedtestStats) == 0 {
 		return 0, 0, err
@@ -274,13 +349,20 @@ func (h *Hub) calculateSpeedtestAverages(systemID string) (float64, float64, err
 
 	totalDownload := 0.0
 	totalUpload := 0.0
+	uploads := 0
 	for _, stat := range speedtestStats {
 		totalDownload += stat.DownloadSpeed
-		totalUpload += stat.UploadSpeed
+		if stat.UploadSpeed > 0 {
+			totalUpload += stat.UploadSpeed
+			uploads++
+		}
 	}
 
 	avgDownload := math.Round((totalDownload/float64(len(speedtestStats)))*100) / 100
-	avgUpload := math.Round((totalUpload/float64(len(speedtestStats)))*100) / 100
+	avgUpload := 0.0
+	if uploads > 0 {
+		avgUpload = math.Round((totalUpload/float64(uploads))*100) / 100
+	}
 
 	return avgDownload, avgUpload, nil
 }
@@ -301,12 +383,21 @@ func (h *Hub) storeHistoricalAverages(systemID string, averages *SystemAverages)
 	record.Set("system", systemID)
 	record.Set("ping_latency", averages.AP)
 	record.Set("ping_packet_loss", averages.APL)
+	record.Set("ping_quality", averages.APQ)
+	record.Set("ping_jitter", averages.APJ)
 	record.Set("dns_latency", averages.AD)
 	record.Set("dns_failure_rate", averages.ADF)
 	record.Set("http_latency", averages.AH)
 	record.Set("http_failure_rate", averages.AHF)
+	record.Set("http_error_rate", averages.AHE)
 	record.Set("download_speed", averages.ADL)
 	record.Set("upload_speed", averages.AUL)
+	record.Set("ping_p95", averages.PP95)
+	record.Set("ping_p99", averages.PP99)
+	record.Set("dns_p95", averages.DP95)
+	record.Set("dns_p99", averages.DP99)
+	record.Set("http_p95", averages.HP95)
+	record.Set("http_p99", averages.HP99)
 
 	if err := h.Save(record); err != nil {
 		return fmt.Errorf("failed to save historical averages: %w", err)
@@ -0,0 +1,129 @@
+//go:build testing
+// +build testing
+
+package hub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalculateSpeedtestAveragesExcludesImplausible(t *testing.T) {
+	testApp, err := tests.NewTestApp()
+	require.NoError(t, err)
+	defer testApp.Cleanup()
+	h := NewHub(testApp)
+
+	systems, err := h.FindCollectionByNameOrId("systems")
+	require.NoError(t, err)
+	systemRecord := core.NewRecord(systems)
+	systemRecord.Set("name", "test-system")
+	systemRecord.Set("host", "127.0.0.1")
+	require.NoError(t, h.Save(systemRecord))
+
+	speedtestStats, err := h.FindCollectionByNameOrId("speedtest_stats")
+	require.NoError(t, err)
+	for _, result := range []struct {
+		status           string
+		download, upload float64
+	}{
+		{"success", 100, 20},
+		{"implausible", 50000, 20},
+		{"success", 90, 10},
+		// a download-only test counts for the download average only
+		{"success", 80, 0},
+	} {
+		record := core.NewRecord(speedtestStats)
+		record.Set("system", systemRecord.Id)
+		record.Set("server_id", "52365")
+		record.Set("status", result.status)
+		record.Set("download_speed", result.download)
+		record.Set("upload_speed", result.upload)
+		require.NoError(t, h.Save(record))
+	}
+
+	download, upload, err := h.calculateSpeedtestAverages(systemRecord.Id, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 90.0, download)
+	assert.Equal(t, 15.0, upload)
+}
+
+func TestCalculateAveragesSamples(t *testing.T) {
+	t.Setenv("BESZEL_HUB_AVERAGE_SAMPLES_SPEEDTEST", "2")
+	testApp, err := tests.NewTestApp()
+	require.NoError(t, err)
+	defer testApp.Cleanup()
+	h := NewHub(testApp)
+
+	systems, err := h.FindCollectionByNameOrId("systems")
+	require.NoError(t, err)
+	systemRecord := core.NewRecord(systems)
+	systemRecord.Set("name", "test-system")
+	systemRecord.Set("host", "127.0.0.1")
+	require.NoError(t, h.Save(systemRecord))
+
+	speedtestStats, err := h.FindCollectionByNameOrId("speedtest_stats")
+	require.NoError(t, err)
+	now := time.Now().UTC()
+	for i, download := range []float64{300, 100, 80} {
+		record := core.NewRecord(speedtestStats)
+		record.Set("system", systemRecord.Id)
+		record.Set("server_id", "52365")
+		record.Set("status", "success")
+		record.Set("download_speed", download)
+		record.Set("upload_speed", 10)
+		require.NoError(t, h.Save(record))
+		// created is autodate field, so we need to set it manually
+		record.SetRaw("created", now.Add(time.Duration(i-3)*time.Hour).Format(types.DefaultDateLayout))
+		require.NoError(t, h.SaveNoValidate(record))
+	}
+
+	averages, err := h.calculateAveragesForSystem(systemRecord.Id)
+	require.NoError(t, err)
+	// only the latest two speedtests are averaged
+	assert.Equal(t, 90.0, averages.ADL)
+	assert.Equal(t, 10, h.sm.AverageSamples("ping_stats"))
+}
+
+func TestCalculateHTTPAveragePercentiles(t *testing.T) {
+	testApp, err := tests.NewTestApp()
+	require.NoError(t, err)
+	defer testApp.Cleanup()
+	h := NewHub(testApp)
+
+	systems, err := h.FindCollectionByNameOrId("systems")
+	require.NoError(t, err)
+	systemRecord := core.NewRecord(systems)
+	systemRecord.Set("name", "test-system")
+	systemRecord.Set("host", "127.0.0.1")
+	require.NoError(t, h.Save(systemRecord))
+
+	httpStats, err := h.FindCollectionByNameOrId("http_stats")
+	require.NoError(t, err)
+	createStat := func(status string, responseTime float64) {
+		record := core.NewRecord(httpStats)
+		record.Set("system", systemRecord.Id)
+		record.Set("url", "https://example.com")
+		record.Set("status", status)
+		record.Set("response_time", responseTime)
+		require.NoError(t, h.SaveNoValidate(record))
+	}
+	for responseTime := 10.0; responseTime <= 100; responseTime += 10 {
+		createStat("success", responseTime)
+	}
+	// failed requests don't count towards the tail latency
+	createStat("timeout", 10000)
+
+	avg, failureRate, _, percentiles, err := h.calculateHTTPAverage(systemRecord.Id, 20)
+	require.NoError(t, err)
+	assert.Equal(t, 55.0, avg)
+	assert.Equal(t, 9.09, failureRate)
+	assert.Equal(t, 95.5, percentiles.P95)
+	assert.Equal(t, 99.1, percentiles.P99)
+}
@@ -0,0 +1,238 @@
+package hub
+
+import (
+	"beszel/internal/common"
+	"beszel/internal/entities/system"
+	"cmp"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// appliedConfiguration is the configuration an agent applied, derived from the configuration
+// sent to it and the targets its acknowledgement rejected
+type appliedConfiguration struct {
+	Config   system.MonitoringConfig
+	Version  int64
+	Received time.Time
+}
+
+// ServiceDiff lists the targets of a service that differ between the hub and the agent
+type ServiceDiff struct {
+	Added   []string `json:"added"`   // Configured on the hub but not applied by the agent
+	Removed []string `json:"removed"` // Applied by the agent but no longer configured on the hub
+	Changed []string `json:"changed"` // Applied by the agent with other settings than configured
+}
+
+// ConfigDiff compares the configuration of a system on the hub with the one its agent applied
+type ConfigDiff struct {
+	System         string                 `json:"system"`
+	DesiredVersion int64                  `json:"desired_version"`
+	AppliedVersion int64                  `json:"applied_version"`
+	AckReceived    time.Time              `json:"ack_received"`
+	InSync         bool                   `json:"in_sync"`
+	Services       map[string]ServiceDiff `json:"services"` // Only services with differences
+}
+
+// recordAppliedConfig derives the configuration the agent applied from its acknowledgement of
+// the configuration sent to it. A configuration rejected as a whole leaves the previous one applied.
+func (cm *ConfigurationManager) recordAppliedConfig(systemID string, ack common.ConfigAck, received time.Time) {
+	value, ok := cm.sent.Load(systemID)
+	if !ok || ack.Error != "" {
+		return
+	}
+	sent := value.(*CachedConfiguration)
+	if sent.Version != ack.Version {
+		return
+	}
+
+	rejected := make(map[string]bool, len(ack.Rejected))
+	for _, target := range ack.Rejected {
+		rejected[target.Service+" "+target.Target] = true
+	}
+	config := sent.Config
+	config.Ping.Targets = slices.DeleteFunc(slices.Clone(config.Ping.Targets), func(target system.PingTarget) bool {
+		return rejected[common.ServicePing+" "+pingTargetKey(target)]
+	})
+	config.Dns.Targets = slices.DeleteFunc(slices.Clone(config.Dns.Targets), func(target system.DnsTarget) bool {
+		return rejected[common.ServiceDns+" "+dnsTargetKey(target)]
+	})
+	config.Http.Targets = slices.DeleteFunc(slices.Clone(config.Http.Targets), func(target system.HttpTarget) bool {
+		return rejected[common.ServiceHttp+" "+httpTargetKey(target)]
+	})
+	config.Speedtest.Targets = slices.DeleteFunc(slices.Clone(config.Speedtest.Targets), func(target system.SpeedtestTarget) bool {
+		return rejected[common.ServiceSpeedtest+" "+speedtestTargetKey(target)]
+	})
+	config.Traceroute.Targets = slices.DeleteFunc(slices.Clone(config.Traceroute.Targets), func(target system.TracerouteTarget) bool {
+		return rejected[common.ServiceTraceroute+" "+target.Host]
+	})
+	config.Snmp.Targets = slices.DeleteFunc(slices.Clone(config.Snmp.Targets), func(target system.SnmpTarget) bool {
+		return rejected[common.ServiceSnmp+" "+target.Host]
+	})
+	cm.applied.Store(systemID, appliedConfiguration{Config: config, Version: ack.Version, Received: received})
+}
+
+// DiffConfiguration compares the configuration of a system on the hub with the one its agent
+// applied. It returns false if the agent hasn't acknowledged a configuration yet.
+func (cm *ConfigurationManager) DiffConfiguration(systemID string) (ConfigDiff, bool, error) {
+	value, ok := cm.applied.Load(systemID)
+	if !ok {
+		return ConfigDiff{}, false, nil
+	}
+	applied := value.(appliedConfiguration)
+	desired, err := cm.GetConfiguration(systemID)
+	if err != nil {
+		return ConfigDiff{}, false, err
+	}
+
+	diff := ConfigDiff{
+		System:         systemID,
+		DesiredVersion: desired.Version,
+		AppliedVersion: applied.Version,
+		AckReceived:    applied.Received,
+		Services:       diffConfigTargets(desired.Config, applied.Config),
+	}
+	diff.InSync = len(diff.Services) == 0
+	return diff, true, nil
+}
+
+// diffConfigTargets compares the targets of the enabled services of two configurations by key
+func diffConfigTargets(desired, applied system.MonitoringConfig) map[string]ServiceDiff {
+	desiredTargets, appliedTargets := configTargets(desired), configTargets(applied)
+	diffs := make(map[string]ServiceDiff)
+	for _, service := range []string{common.ServicePing, common.ServiceDns, common.ServiceHttp, common.ServiceSpeedtest, common.ServiceTraceroute, common.ServiceSnmp} {
+		var diff ServiceDiff
+		for key, settings := range desiredTargets[service] {
+			appliedSettings, ok := appliedTargets[service][key]
+			switch {
+			case !ok:
+				diff.Added = append(diff.Added, key)
+			case appliedSettings != settings:
+				diff.Changed = append(diff.Changed, key)
+			}
+		}
+		for key := range appliedTargets[service] {
+			if _, ok := desiredTargets[service][key]; !ok {
+				diff.Removed = append(diff.Removed, key)
+			}
+		}
+		if len(diff.Added)+len(diff.Removed)+len(diff.Changed) == 0 {
+			continue
+		}
+		slices.Sort(diff.Added)
+		slices.Sort(diff.Removed)
+		slices.Sort(diff.Changed)
+		diffs[service] = diff
+	}
+	return diffs
+}
+
+// configTargets returns the settings of the targets of the enabled services as JSON, by service and target key
+func configTargets(config system.MonitoringConfig) map[string]map[string]string {
+	targets := make(map[string]map[string]string)
+	add := func(service, key string, target any) {
+		if targets[service] == nil {
+			targets[service] = make(map[string]string)
+		}
+		settings, _ := json.Marshal(target)
+		targets[service][key] = string(settings)
+	}
+	if config.Enabled.Ping {
+		for _, target := range config.Ping.Targets {
+			add(common.ServicePing, pingTargetKey(target), target)
+		}
+	}
+	if config.Enabled.Dns {
+		for _, target := range config.Dns.Targets {
+			add(common.ServiceDns, dnsTargetKey(target), target)
+		}
+	}
+	if config.Enabled.Http {
+		for _, target := range config.Http.Targets {
+			add(common.ServiceHttp, httpTargetKey(target), target)
+		}
+	}
+	if config.Enabled.Speedtest {
+		for _, target := range config.Speedtest.Targets {
+			add(common.ServiceSpeedtest, speedtestTargetKey(target), target)
+		}
+	}
+	if config.Enabled.Traceroute {
+		for _, target := range config.Traceroute.Targets {
+			add(common.ServiceTraceroute, target.Host, target)
+		}
+	}
+	if config.Enabled.Snmp {
+		for _, target := range config.Snmp.Targets {
+			add(common.ServiceSnmp, target.Host, target)
+		}
+	}
+	return targets
+}
+
+// pingTargetKey returns the key the agent reports a rejected ping target with
+func pingTargetKey(target system.PingTarget) string {
+	return target.Host
+}
+
+// dnsTargetKey returns the key the agent reports a rejected DNS target with. Resolver comparisons
+// and lookups from a source IP are keyed like the agent does, so they aren't mixed up with a
+// plain lookup of the same domain.
+func dnsTargetKey(target system.DnsTarget) string {
+	key := target.Domain + "@" + target.Server + "#" + target.Type
+	if len(target.Servers) > 0 {
+		key = "compare:" + target.Domain + "@" + strings.Join(target.Servers, ",") + "#" + target.Type
+	}
+	if target.SourceIP != "" {
+		key += "%" + target.SourceIP
+	}
+	return key
+}
+
+// httpTargetKey returns the key the agent reports a rejected HTTP target with
+func httpTargetKey(target system.HttpTarget) string {
+	return target.URL
+}
+
+// speedtestTargetKey joins the server and URL a speedtest runs against, or is its provider without them
+func speedtestTargetKey(target system.SpeedtestTarget) string {
+	var parts []string
+	for _, part := range []string{target.ServerID, target.ServerHost, target.URL} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return cmp.Or(target.Provider, "ookla")
+	}
+	return strings.Join(parts, "|")
+}
+
+// getConfigurationDiff returns the differences between the configuration of a system on the hub
+// and the one its agent last acknowledged
+func (h *Hub) getConfigurationDiff(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil || info.Auth.GetString("role") != "admin" {
+		return apis.NewForbiddenError("Admin access required", nil)
+	}
+
+	systemID := e.Request.PathValue("id")
+	if _, err := h.FindRecordById("systems", systemID); err != nil {
+		return apis.NewNotFoundError("System not found", nil)
+	}
+	diff, ok, err := h.configManager.DiffConfiguration(systemID)
+	switch {
+	case err != nil:
+		return e.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	case !ok:
+		return apis.NewNotFoundError("The agent has not acknowledged a configuration yet", nil)
+	}
+	return e.JSON(http.StatusOK, diff)
+}
@@ -0,0 +1,132 @@
+//go:build testing
+// +build testing
+
+package hub
+
+import (
+	"beszel/internal/common"
+	"beszel/internal/entities/system"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffConfiguration(t *testing.T) {
+	testApp, err := tests.NewTestApp()
+	require.NoError(t, err)
+	defer testApp.Cleanup()
+	h := NewHub(testApp)
+	cm := h.configManager
+
+	systems, err := h.FindCollectionByNameOrId("systems")
+	require.NoError(t, err)
+	systemRecord := core.NewRecord(systems)
+	systemRecord.Set("name", "test-system")
+	systemRecord.Set("host", "127.0.0.1")
+	require.NoError(t, h.Save(systemRecord))
+	// the system's updater must not outlive the app
+	defer h.sm.RemoveSystem(systemRecord.Id)
+
+	monitoringConfig, err := h.FindCollectionByNameOrId("monitoring_config")
+	require.NoError(t, err)
+	configRecord := core.NewRecord(monitoringConfig)
+	configRecord.Set("system", systemRecord.Id)
+	configRecord.Set("ping", `{"targets": [{"host": "1.1.1.1", "count": 4}, {"host": "8.8.8.8", "count": 4}]}`)
+	configRecord.Set("dns", `{"targets": [{"domain": "example.com", "server": "8.8.8.8", "type": "A"}]}`)
+	require.NoError(t, h.Save(configRecord))
+
+	// nothing to compare before the agent acknowledged a configuration
+	_, ok, err := cm.DiffConfiguration(systemRecord.Id)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// the agent got an older configuration and rejected its DNS target
+	sent := &CachedConfiguration{Version: 5}
+	sent.Config.Enabled.Ping, sent.Config.Enabled.Dns = true, true
+	sent.Config.Ping.Targets = []system.PingTarget{{Host: "1.1.1.1", Count: 3}, {Host: "9.9.9.9", Count: 4}}
+	sent.Config.Dns.Targets = []system.DnsTarget{{Domain: "example.com", Server: "8.8.8.8", Type: "A"}}
+	cm.sent.Store(systemRecord.Id, sent)
+	cm.recordConfigAck(systemRecord.Id, common.ConfigAck{
+		Version:  5,
+		Applied:  2,
+		Total:    3,
+		Rejected: []common.RejectedTarget{{Service: common.ServiceDns, Target: "example.com@8.8.8.8#A", Reason: "domain not allowed: example.com"}},
+	})
+	// acknowledgements of other versions don't change what the agent applied
+	cm.recordConfigAck(systemRecord.Id, common.ConfigAck{Version: 4})
+
+	diff, ok, err := cm.DiffConfiguration(systemRecord.Id)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.False(t, diff.InSync)
+	assert.EqualValues(t, 5, diff.AppliedVersion)
+	assert.Equal(t, map[string]ServiceDiff{
+		common.ServicePing: {Added: []string{"8.8.8.8"}, Removed: []string{"9.9.9.9"}, Changed: []string{"1.1.1.1"}},
+		common.ServiceDns:  {Added: []string{"example.com@8.8.8.8#A"}},
+	}, diff.Services)
+	// the sent configuration is left as it was
+	assert.Len(t, sent.Config.Dns.Targets, 1)
+
+	// a configuration rejected as a whole leaves the previous one applied
+	cm.sent.Store(systemRecord.Id, &CachedConfiguration{Version: 6})
+	cm.recordConfigAck(systemRecord.Id, common.ConfigAck{Version: 6, Error: "invalid global interval"})
+	diff, _, err = cm.DiffConfiguration(systemRecord.Id)
+	require.NoError(t, err)
+	assert.EqualValues(t, 5, diff.AppliedVersion)
+
+	// in sync once the agent applied the current configuration
+	desired, err := cm.GetConfiguration(systemRecord.Id)
+	require.NoError(t, err)
+	cm.sent.Store(systemRecord.Id, desired)
+	cm.recordConfigAck(systemRecord.Id, common.ConfigAck{Version: desired.Version, Applied: 3, Total: 3})
+	diff, _, err = cm.DiffConfiguration(systemRecord.Id)
+	require.NoError(t, err)
+	assert.True(t, diff.InSync)
+	assert.Empty(t, diff.Services)
+}
+
+func TestRecordAppliedConfigRejections(t *testing.T) {
+	cm := &ConfigurationManager{}
+	sent := &CachedConfiguration{Version: 3}
+	sent.Config.Enabled.Traceroute, sent.Config.Enabled.Snmp = true, true
+	sent.Config.Traceroute.Targets = []system.TracerouteTarget{{Host: "192.0.2.1"}, {Host: "-fexample.com"}}
+	sent.Config.Snmp.Targets = []system.SnmpTarget{{Host: "192.0.2.2", Interfaces: []int{1}}, {Host: "192.0.2.3"}}
+	retries := 100
+	sent.Config.Enabled.Speedtest = true
+	sent.Config.Speedtest.Targets = []system.SpeedtestTarget{{ServerID: "1"}, {ServerID: "2", Retries: &retries}}
+	sent.Config.Enabled.Dns = true
+	sent.Config.Dns.Targets = []system.DnsTarget{
+		{Domain: "example.com", Type: "A"},
+		{Domain: "example.com", Type: "A", SourceIP: "192.0.2.53"},
+		{Domain: "example.com", Type: "A", Servers: []string{"1.1.1.1", "bad server"}},
+	}
+	cm.sent.Store("system", sent)
+
+	cm.recordAppliedConfig("system", common.ConfigAck{
+		Version: 3,
+		Applied: 4,
+		Total:   9,
+		Rejected: []common.RejectedTarget{
+			{Service: common.ServiceTraceroute, Target: "-fexample.com", Reason: "invalid traceroute host: -fexample.com"},
+			{Service: common.ServiceSnmp, Target: "192.0.2.3", Reason: "invalid SNMP target 192.0.2.3: no OIDs or interfaces to poll"},
+			{Service: common.ServiceSpeedtest, Target: "2", Reason: "invalid speedtest retries: 100 (must be 0-5)"},
+			{Service: common.ServiceDns, Target: "example.com@#A%192.0.2.53", Reason: "source IP for example.com not assigned to this host: 192.0.2.53"},
+			{Service: common.ServiceDns, Target: "compare:example.com@1.1.1.1,bad server#A", Reason: "invalid DNS server for example.com: bad server"},
+		},
+	}, time.Now())
+
+	value, ok := cm.applied.Load("system")
+	require.True(t, ok)
+	applied := value.(appliedConfiguration)
+	assert.Equal(t, []system.TracerouteTarget{{Host: "192.0.2.1"}}, applied.Config.Traceroute.Targets)
+	assert.Equal(t, []system.SnmpTarget{{Host: "192.0.2.2", Interfaces: []int{1}}}, applied.Config.Snmp.Targets)
+	assert.Equal(t, []system.SpeedtestTarget{{ServerID: "1"}}, applied.Config.Speedtest.Targets)
+	// only the lookup from the source IP and the resolver comparison were rejected
+	assert.Equal(t, []system.DnsTarget{{Domain: "example.com", Type: "A"}}, applied.Config.Dns.Targets)
+	// the sent configuration is left as it was
+	assert.Len(t, sent.Config.Snmp.Targets, 2)
+}
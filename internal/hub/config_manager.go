@@ -1,12 +1,15 @@
 package hub
 
 import (
+	"beszel/internal/common"
 	"beszel/internal/entities/system"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"sort"
 	"sync"
 	"time"
 )
@@ -15,11 +18,17 @@ import (
 type ConfigurationManager struct {
 	hub             *Hub
 	cache           sync.Map                    // Cache for configuration data by system ID
-	versions        sync.Map                    // Track configuration versions by system ID
 	pendingUpdates  sync.Map                    // Track pending configuration updates
+	acks            sync.Map                    // Latest configuration acknowledgement by system ID
+	sent            sync.Map                    // Configuration last sent by system ID, to resolve acknowledgements
+	applied         sync.Map                    // Configuration the agent applied by system ID
 	batchCh         chan ConfigurationUpdate    // Channel for batching configuration updates
 	updateTicker    *time.Ticker               // Ticker for periodic batch processing
 	mutex           sync.RWMutex               // Mutex for configuration operations
+	ctx             context.Context            // Canceled when the manager stops
+	cancel          context.CancelFunc
+	stopOnce        sync.Once
+	done            chan struct{}              // Closed once the batch processing returned
 	
 	// Configuration settings
 	batchSize       int           // Maximum batch size for configuration updates
@@ -47,6 +56,12 @@ type CachedConfiguration struct {
 	LastSent    time.Time               `json:"last_sent"`    // Last time sent to agent
 }
 
+// ConfigAckStatus is the latest acknowledgement of a configuration by an agent, like 3 of 5 targets applied
+type ConfigAckStatus struct {
+	common.ConfigAck
+	Received time.Time `json:"received"`
+}
+
 // NewConfigurationManager creates a new optimized configuration manager
 func NewConfigurationManager(hub *Hub) *ConfigurationManager {
 	cm := &ConfigurationManager{
@@ -56,7 +71,9 @@ func NewConfigurationManager(hub *Hub) *ConfigurationManager {
 		cacheTimeout: 10 * time.Minute,    // Cache configurations for 10 minutes
 		batchCh:      make(chan ConfigurationUpdate, 1000), // Buffer for 1000 updates
 		updateTicker: time.NewTicker(30 * time.Second),
+		done:         make(chan struct{}),
 	}
+	cm.ctx, cm.cancel = context.WithCancel(context.Background())
 
 	// Start batch processing goroutine
 	go cm.processBatchUpdates()
@@ -96,53 +113,18 @@ func (cm *ConfigurationManager) loadConfigurationFromDatabase(systemID string) (
 	monitoringConfigRecord, err := cm.hub.FindFirstRecordByFilter("monitoring_config", "system = {:system}", map[string]any{"system": systemID})
 	
 	var config system.MonitoringConfig
+	var version int64
 	
 	if err != nil {
 		// No monitoring config found, use empty configuration
 		config = system.MonitoringConfig{}
 	} else {
-		// Build the monitoring configuration from the record fields
-		config = system.MonitoringConfig{
-			Enabled: struct {
-				Ping      bool `json:"ping"`
-				Dns       bool `json:"dns"`
-				Http      bool `json:"http,omitempty"`
-				Speedtest bool `json:"speedtest,omitempty"`
-			}{
-				Ping:      monitoringConfigRecord.Get("ping") != nil,
-				Dns:       monitoringConfigRecord.Get("dns") != nil,
-				Http:      monitoringConfigRecord.Get("http") != nil,
-				Speedtest: monitoringConfigRecord.Get("speedtest") != nil,
-			},
-		}
-
-		// Parse individual monitoring configurations
-		if pingData := monitoringConfigRecord.Get("ping"); pingData != nil {
-			if err := json.Unmarshal([]byte(fmt.Sprintf("%v", pingData)), &config.Ping); err != nil {
-				slog.Error("Failed to parse ping config", "system", systemID, "err", err)
-			}
-		}
-
-		if dnsData := monitoringConfigRecord.Get("dns"); dnsData != nil {
-			if err := json.Unmarshal([]byte(fmt.Sprintf("%v", dnsData)), &config.Dns); err != nil {
-				slog.Error("Failed to parse DNS config", "system", systemID, "err", err)
-			}
-		}
-
-		if httpData := monitoringConfigRecord.Get("http"); httpData != nil {
-			if err := json.Unmarshal([]byte(fmt.Sprintf("%v", httpData)), &config.Http); err != nil {
-				slog.Error("Failed to parse HTTP config", "system", systemID, "err", err)
-			}
-		}
-
-		if speedtestData := monitoringConfigRecord.Get("speedtest"); speedtestData != nil {
-			if err := json.Unmarshal([]byte(fmt.Sprintf("%v", speedtestData)), &config.Speedtest); err != nil {
-				slog.Error("Failed to parse speedtest config", "system", systemID, "err", err)
-			}
+		if config, err = monitoringConfigFromRecord(monitoringConfigRecord); err != nil {
+			slog.Error("Failed to parse monitoring config", "system", systemID, "err", err)
 		}
+		version = configVersion(monitoringConfigRecord)
 	}
 
-	version := cm.getNextConfigVersion(systemID)
 	hash := cm.calculateConfigHash(config)
 
 	return &CachedConfiguration{
@@ -155,8 +137,7 @@ func (cm *ConfigurationManager) loadConfigurationFromDatabase(systemID string) (
 }
 
 // QueueConfigurationUpdate queues a configuration update for batch processing
-func (cm *ConfigurationManager) QueueConfigurationUpdate(systemID string, config system.MonitoringConfig, priority int) {
-	version := cm.getNextConfigVersion(systemID)
+func (cm *ConfigurationManager) QueueConfigurationUpdate(systemID string, config system.MonitoringConfig, version int64, priority int) {
 	hash := cm.calculateConfigHash(config)
 
 	update := ConfigurationUpdate{
@@ -168,8 +149,12 @@ func (cm *ConfigurationManager) QueueConfigurationUpdate(systemID string, config
 		Priority:  priority,
 	}
 
-	// Try to send to channel without blocking
+	// Try to send to channel without blocking, updates after stopping are dropped
+	if cm.ctx.Err() != nil {
+		return
+	}
 	select {
+	case <-cm.ctx.Done():
 	case cm.batchCh <- update:
 		slog.Debug("Configuration update queued", "system", systemID, "version", version, "priority", priority)
 	default:
@@ -207,6 +192,8 @@ func (cm *ConfigurationManager) sendConfigToSystemWithCacheClear(systemID string
 
 	// Send config via WebSocket if available
 	if system.WsConn != nil && system.WsConn.IsConnected() {
+		system.WsConn.OnConfigAck(func(ack common.ConfigAck) { cm.recordConfigAck(systemID, ack) })
+		cm.sent.Store(systemID, config)
 		versionedConfig := map[string]interface{}{
 			"config":       config.Config,
 			"version":      config.Version,
@@ -247,14 +234,16 @@ func (cm *ConfigurationManager) SendConfigurationToAllAgents() error {
 			continue
 		}
 
-		cm.QueueConfigurationUpdate(systemID, config.Config, 2) // Normal priority
+		cm.QueueConfigurationUpdate(systemID, config.Config, config.Version, 2) // Normal priority
 	}
 
 	return nil
 }
 
-// processBatchUpdates processes queued configuration updates in batches
+// processBatchUpdates processes queued configuration updates in batches.
+// When the manager stops it processes the updates still queued and returns.
 func (cm *ConfigurationManager) processBatchUpdates() {
+	defer close(cm.done)
 	updates := make([]ConfigurationUpdate, 0, cm.batchSize)
 	
 	for {
@@ -274,6 +263,17 @@ func (cm *ConfigurationManager) processBatchUpdates() {
 				cm.processBatch(updates)
 				updates = updates[:0]
 			}
+
+		case <-cm.ctx.Done():
+			for {
+				select {
+				case update := <-cm.batchCh:
+					updates = append(updates, update)
+				default:
+					cm.processBatch(updates)
+					return
+				}
+			}
 		}
 	}
 }
@@ -287,10 +287,20 @@ func (cm *ConfigurationManager) processBatch(updates []ConfigurationUpdate) {
 	// Sort by priority (high priority first)
 	cm.sortUpdatesByPriority(updates)
 
+	// Only the newest update of a system is sent, so a stale config queued with a higher
+	// priority can't replace a fresher one
+	latest := make(map[string]int64, len(updates))
+	for _, update := range updates {
+		latest[update.SystemID] = max(latest[update.SystemID], update.Version)
+	}
+
 	successful := 0
 	failed := 0
 
 	for _, update := range updates {
+		if update.Version < latest[update.SystemID] {
+			continue
+		}
 		// Update cache
 		cachedConfig := &CachedConfiguration{
 			Config:    update.Config,
@@ -347,6 +357,8 @@ func (cm *ConfigurationManager) sendConfigToSystem(systemID string, config *Cach
 
 	// Send config via WebSocket if available
 	if system.WsConn != nil && system.WsConn.IsConnected() {
+		system.WsConn.OnConfigAck(func(ack common.ConfigAck) { cm.recordConfigAck(systemID, ack) })
+		cm.sent.Store(systemID, config)
 		versionedConfig := map[string]interface{}{
 			"config":  config.Config,
 			"version": config.Version,
@@ -369,6 +381,16 @@ func (cm *ConfigurationManager) sendConfigToSystem(systemID string, config *Cach
 	return fmt.Errorf("system %s not connected via WebSocket", systemID)
 }
 
+// recordConfigAck stores the acknowledgement of a configuration sent to an agent
+func (cm *ConfigurationManager) recordConfigAck(systemID string, ack common.ConfigAck) {
+	received := time.Now()
+	cm.acks.Store(systemID, ConfigAckStatus{ConfigAck: ack, Received: received})
+	cm.recordAppliedConfig(systemID, ack, received)
+	if ack.Error != "" || len(ack.Rejected) > 0 {
+		slog.Warn("Agent did not apply all monitoring targets", "system", systemID, "version", ack.Version, "applied", ack.Applied, "total", ack.Total, "err", ack.Error)
+	}
+}
+
 // hasConfigurationChanged checks if the configuration has actually changed
 func (cm *ConfigurationManager) hasConfigurationChanged(systemID string, newConfig *CachedConfiguration) bool {
 	if cached, ok := cm.cache.Load(systemID); ok {
@@ -390,21 +412,6 @@ func (cm *ConfigurationManager) calculateConfigHash(config system.MonitoringConf
 	return hex.EncodeToString(hash[:16]) // Use first 16 bytes for shorter hash
 }
 
-// getNextConfigVersion generates the next configuration version for a system
-func (cm *ConfigurationManager) getNextConfigVersion(systemID string) int64 {
-	now := time.Now().Unix()
-	
-	// Ensure version always increases
-	if stored, ok := cm.versions.Load(systemID); ok {
-		if lastVersion := stored.(int64); now <= lastVersion {
-			now = lastVersion + 1
-		}
-	}
-	
-	cm.versions.Store(systemID, now)
-	return now
-}
-
 // getAllConnectedSystems returns all system IDs that are currently connected
 func (cm *ConfigurationManager) getAllConnectedSystems() []string {
 	var systems []string
@@ -434,17 +441,15 @@ func (cm *ConfigurationManager) getAllConnectedSystems() []string {
 	return systems
 }
 
-// sortUpdatesByPriority sorts updates by priority (1=high, 2=normal, 3=low)
+// sortUpdatesByPriority sorts updates by priority (1=high, 2=normal, 3=low) and then by version, newest first
 func (cm *ConfigurationManager) sortUpdatesByPriority(updates []ConfigurationUpdate) {
-	// Simple bubble sort by priority
-	n := len(updates)
-	for i := 0; i < n-1; i++ {
-		for j := 0; j < n-i-1; j++ {
-			if updates[j].Priority > updates[j+1].Priority {
-				updates[j], updates[j+1] = updates[j+1], updates[j]
-			}
+	// Newest version first within a priority, updates that are equal on both keep their order
+	sort.SliceStable(updates, func(i, j int) bool {
+		if updates[i].Priority != updates[j].Priority {
+			return updates[i].Priority < updates[j].Priority
 		}
-	}
+		return updates[i].Version > updates[j].Version
+	})
 }
 
 // GetConfigurationStats returns statistics about the configuration manager
@@ -465,13 +470,35 @@ func (cm *ConfigurationManager) GetConfigurationStats() map[string]interface{} {
 	})
 	stats["cached_configs"] = cachedCount
 
+	// Latest acknowledgements by the agents, so the UI can show how many targets were applied
+	acks := make(map[string]ConfigAckStatus)
+	cm.acks.Range(func(key, value interface{}) bool {
+		acks[key.(string)] = value.(ConfigAckStatus)
+		return true
+	})
+	stats["config_acks"] = acks
+
+	// Services paused on their own by system, their checks don't run while the others do
+	paused := make(map[string][]string)
+	if records, err := cm.hub.FindRecordsByFilter("monitoring_config", "paused:length > 0", "", 0, 0); err == nil {
+		for _, record := range records {
+			paused[record.GetString("system")] = record.GetStringSlice("paused")
+		}
+	}
+	stats["paused_monitors"] = paused
+
 	return stats
 }
 
-// Stop gracefully shuts down the configuration manager
+// Stop gracefully shuts down the configuration manager, waiting for the queued updates
+// to be processed. It is safe to call more than once and concurrently with queueing.
 func (cm *ConfigurationManager) Stop() {
-	if cm.updateTicker != nil {
-		cm.updateTicker.Stop()
-	}
-	close(cm.batchCh)
-}
\ No newline at end of file
+	cm.stopOnce.Do(func() {
+		if cm.updateTicker != nil {
+			cm.updateTicker.Stop()
+		}
+		// batchCh stays open, closing it would make concurrent queueing panic
+		cm.cancel()
+		<-cm.done
+	})
+}
@@ -0,0 +1,138 @@
+//go:build testing
+// +build testing
+
+package hub
+
+import (
+	"beszel/internal/entities/system"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigurationManagerStop(t *testing.T) {
+	testApp, err := tests.NewTestApp()
+	require.NoError(t, err)
+	defer testApp.Cleanup()
+	cm := NewHub(testApp).configManager
+
+	// queueing while stopping must not panic, and stopping more than once is fine
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 100 {
+				cm.QueueConfigurationUpdate(fmt.Sprintf("system-%d-%d", i, j), system.MonitoringConfig{}, 1, 1+j%3)
+			}
+		}()
+	}
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cm.Stop()
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case <-cm.done:
+	default:
+		t.Fatal("batch processing should have returned")
+	}
+
+	// updates after stopping are dropped
+	queued := len(cm.batchCh)
+	cm.QueueConfigurationUpdate("system", system.MonitoringConfig{}, 1, 1)
+	assert.Equal(t, queued, len(cm.batchCh))
+}
+
+func TestSortUpdatesByPriority(t *testing.T) {
+	cm := &ConfigurationManager{}
+	updates := []ConfigurationUpdate{
+		{SystemID: "a", Priority: 2, Version: 1},
+		{SystemID: "b", Priority: 1, Version: 1},
+		{SystemID: "c", Priority: 2, Version: 3},
+		{SystemID: "d", Priority: 3, Version: 5},
+		{SystemID: "e", Priority: 2, Version: 1},
+		{SystemID: "f", Priority: 1, Version: 2},
+		{SystemID: "g", Priority: 2, Version: 1},
+	}
+	cm.sortUpdatesByPriority(updates)
+
+	order := make([]string, 0, len(updates))
+	for _, update := range updates {
+		order = append(order, update.SystemID)
+	}
+	// newest first within a priority, a, e and g keep their order
+	assert.Equal(t, []string{"f", "b", "c", "a", "e", "g", "d"}, order)
+}
+
+func TestProcessBatchSendsNewestUpdate(t *testing.T) {
+	testApp, err := tests.NewTestApp()
+	require.NoError(t, err)
+	defer testApp.Cleanup()
+	cm := NewHub(testApp).configManager
+	defer cm.Stop()
+
+	// the stale update has the higher priority but must not replace the fresh one
+	cm.processBatch([]ConfigurationUpdate{
+		{SystemID: "system", Priority: 2, Version: 2, Hash: "fresh"},
+		{SystemID: "system", Priority: 1, Version: 1, Hash: "stale"},
+	})
+	cached, ok := cm.cache.Load("system")
+	require.True(t, ok)
+	assert.Equal(t, "fresh", cached.(*CachedConfiguration).Hash)
+}
+
+func TestConfigurationVersionFollowsRecord(t *testing.T) {
+	testApp, err := tests.NewTestApp()
+	require.NoError(t, err)
+	defer testApp.Cleanup()
+	h := NewHub(testApp)
+	cm := h.configManager
+
+	systems, err := h.FindCollectionByNameOrId("systems")
+	require.NoError(t, err)
+	systemRecord := core.NewRecord(systems)
+	systemRecord.Set("name", "test-system")
+	systemRecord.Set("host", "127.0.0.1")
+	require.NoError(t, h.Save(systemRecord))
+	// the system's updater must not outlive the app
+	defer h.sm.RemoveSystem(systemRecord.Id)
+
+	// without a monitoring configuration the version can't win over another hub's
+	config, err := cm.loadConfigurationFromDatabase(systemRecord.Id)
+	require.NoError(t, err)
+	assert.Zero(t, config.Version)
+
+	monitoringConfig, err := h.FindCollectionByNameOrId("monitoring_config")
+	require.NoError(t, err)
+	configRecord := core.NewRecord(monitoringConfig)
+	configRecord.Set("system", systemRecord.Id)
+	configRecord.Set("ping", `{"targets": [{"host": "1.1.1.1", "count": 4}]}`)
+	require.NoError(t, h.Save(configRecord))
+
+	// loading the configuration again, as on reconnects and cache expiry, keeps its version
+	first, err := cm.loadConfigurationFromDatabase(systemRecord.Id)
+	require.NoError(t, err)
+	assert.Equal(t, configRecord.GetDateTime("updated").Time().UnixMilli(), first.Version)
+	time.Sleep(5 * time.Millisecond)
+	again, err := cm.loadConfigurationFromDatabase(systemRecord.Id)
+	require.NoError(t, err)
+	assert.Equal(t, first.Version, again.Version)
+
+	// changing the configuration makes it newer
+	configRecord.Set("ping", `{"targets": [{"host": "8.8.8.8", "count": 4}]}`)
+	require.NoError(t, h.Save(configRecord))
+	changed, err := cm.loadConfigurationFromDatabase(systemRecord.Id)
+	require.NoError(t, err)
+	assert.Greater(t, changed.Version, first.Version)
+}
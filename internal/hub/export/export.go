@@ -0,0 +1,281 @@
+// Package export streams the historical stats of a system as CSV or JSON.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/search"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// defaultRange is how far back an export goes if it has no start
+const defaultRange = 24 * time.Hour
+
+// collections are the stats collections that can be exported
+var collections = []string{"ping_stats", "dns_stats", "http_stats", "speedtest_stats"}
+
+var (
+	ErrInvalidRequest = errors.New("invalid export request")
+	ErrForbidden      = errors.New("not allowed to list the collection")
+)
+
+type Manager struct {
+	app core.App
+}
+
+// Request selects the rows of an export
+type Request struct {
+	System     string
+	Collection string
+	From       time.Time
+	To         time.Time
+	Format     string // "csv" or "json"
+}
+
+func NewManager(app core.App) *Manager {
+	return &Manager{app: app}
+}
+
+// GetExport handles GET /api/beszel/systems/{id}/export
+func (m *Manager) GetExport(e *core.RequestEvent) error {
+	info, err := e.RequestInfo()
+	if err != nil {
+		return apis.NewBadRequestError("", err)
+	}
+
+	query := e.Request.URL.Query()
+	req := Request{
+		System:     e.Request.PathValue("id"),
+		Collection: query.Get("collection"),
+		Format:     query.Get("format"),
+		To:         time.Now().UTC(),
+	}
+	if req.Format == "" {
+		req.Format = "csv"
+	}
+	if to := query.Get("to"); to != "" {
+		t, err := types.ParseDateTime(to)
+		if err != nil {
+			return apis.NewBadRequestError("Invalid to date", nil)
+		}
+		req.To = t.Time()
+	}
+	req.From = req.To.Add(-defaultRange)
+	if from := query.Get("from"); from != "" {
+		t, err := types.ParseDateTime(from)
+		if err != nil {
+			return apis.NewBadRequestError("Invalid from date", nil)
+		}
+		req.From = t.Time()
+	}
+
+	if _, err := m.app.FindRecordById("systems", req.System); err != nil {
+		return apis.NewNotFoundError("System not found", nil)
+	}
+
+	err = m.Export(e.Response, req, info)
+	switch {
+	case errors.Is(err, ErrInvalidRequest):
+		return apis.NewBadRequestError(err.Error(), nil)
+	case errors.Is(err, ErrForbidden):
+		return apis.NewForbiddenError("Forbidden", nil)
+	case err != nil:
+		// the response may be partly written already, so the error can only be logged
+		m.app.Logger().Error("Failed to export stats", "system", req.System, "collection", req.Collection, "err", err)
+	}
+	return nil
+}
+
+// Export writes the rows of the request to w, limited to the rows the list rule of
+// the collection allows. Nothing is written if the request is invalid or forbidden.
+func (m *Manager) Export(w http.ResponseWriter, req Request, info *core.RequestInfo) error {
+	if !slices.Contains(collections, req.Collection) {
+		return fmt.Errorf("%w: unknown collection %q", ErrInvalidRequest, req.Collection)
+	}
+	if req.Format != "csv" && req.Format != "json" {
+		return fmt.Errorf("%w: unknown format %q", ErrInvalidRequest, req.Format)
+	}
+	if req.To.Before(req.From) {
+		return fmt.Errorf("%w: to is before from", ErrInvalidRequest)
+	}
+
+	collection, err := m.app.FindCachedCollectionByNameOrId(req.Collection)
+	if err != nil {
+		return err
+	}
+	query, err := m.query(collection, req, info)
+	if err != nil {
+		return err
+	}
+
+	// columns follow the order of the collection's fields
+	var fields []string
+	for _, field := range collection.Fields {
+		if !field.GetHidden() || info.HasSuperuserAuth() {
+			fields = append(fields, field.GetName())
+		}
+	}
+
+	rows, err := query.Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	contentType := "text/csv; charset=utf-8"
+	if req.Format == "json" {
+		contentType = "application/json"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s_%s.%s"`, req.System, req.Collection, req.Format))
+	w.WriteHeader(http.StatusOK)
+
+	if req.Format == "json" {
+		return writeJSON(w, rows, collection, fields)
+	}
+	return writeCSV(w, rows, collection, fields)
+}
+
+// query selects the rows of the request the list rule of the collection allows
+func (m *Manager) query(collection *core.Collection, req Request, info *core.RequestInfo) (*dbx.SelectQuery, error) {
+	query := m.app.RecordQuery(collection).
+		AndWhere(dbx.HashExp{collection.Name + ".system": req.System}).
+		AndWhere(dbx.NewExp(
+			fmt.Sprintf("[[%s.created]] >= {:from} AND [[%[1]s.created]] <= {:to}", collection.Name),
+			dbx.Params{"from": req.From.UTC().Format(types.DefaultDateLayout), "to": req.To.UTC().Format(types.DefaultDateLayout)},
+		)).
+		OrderBy(collection.Name + ".created ASC")
+
+	if info.HasSuperuserAuth() {
+		return query, nil
+	}
+	// same as the list API: a nil rule is for superusers only, an empty rule allows everyone
+	if collection.ListRule == nil {
+		return nil, ErrForbidden
+	}
+	if *collection.ListRule != "" {
+		resolver := core.NewRecordFieldResolver(m.app, collection, info, false)
+		expr, err := search.FilterData(*collection.ListRule).BuildExpr(resolver)
+		if err != nil {
+			return nil, err
+		}
+		if err := resolver.UpdateQuery(query); err != nil {
+			return nil, err
+		}
+		query.AndWhere(expr)
+	}
+	return query, nil
+}
+
+// scanner loads the rows of a query into a single record, reused for all rows
+type scanner struct {
+	rows   *dbx.Rows
+	record *core.Record
+	row    dbx.NullStringMap
+	values map[string]any
+}
+
+func newScanner(rows *dbx.Rows, collection *core.Collection) *scanner {
+	return &scanner{rows: rows, record: core.NewRecord(collection), row: dbx.NullStringMap{}, values: map[string]any{}}
+}
+
+// next loads the next row, returning false after the last one
+func (s *scanner) next() (bool, error) {
+	if !s.rows.Next() {
+		return false, s.rows.Err()
+	}
+	clear(s.row)
+	if err := s.rows.ScanMap(s.row); err != nil {
+		return false, err
+	}
+	clear(s.values)
+	for name, value := range s.row {
+		if value.Valid {
+			s.values[name] = value.String
+		} else {
+			s.values[name] = nil
+		}
+	}
+	s.record.Load(s.values)
+	return true, nil
+}
+
+func writeCSV(w io.Writer, rows *dbx.Rows, collection *core.Collection, fields []string) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(fields); err != nil {
+		return err
+	}
+
+	scanner := newScanner(rows, collection)
+	line := make([]string, len(fields))
+	for {
+		ok, err := scanner.next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		for i, field := range fields {
+			line[i] = scanner.record.GetString(field)
+		}
+		if err := writer.Write(line); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeJSON writes the rows as an array of objects, building each object by hand
+// so the keys keep the order of the fields
+func writeJSON(w io.Writer, rows *dbx.Rows, collection *core.Collection, fields []string) error {
+	keys := make([][]byte, len(fields))
+	for i, field := range fields {
+		key, _ := json.Marshal(field)
+		keys[i] = append(key, ':')
+	}
+
+	scanner := newScanner(rows, collection)
+	buf := []byte{'['}
+	for count := 0; ; count++ {
+		ok, err := scanner.next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		if count > 0 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, '{')
+		for i, field := range fields {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			value, err := json.Marshal(scanner.record.Get(field))
+			if err != nil {
+				return err
+			}
+			buf = append(append(buf, keys[i]...), value...)
+		}
+		buf = append(buf, '}')
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+		buf = buf[:0]
+	}
+	_, err := w.Write(append(buf, "]\n"...))
+	return err
+}
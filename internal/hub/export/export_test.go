@@ -0,0 +1,116 @@
+//go:build testing
+// +build testing
+
+package export_test
+
+import (
+	"beszel/internal/hub/export"
+	"beszel/internal/tests"
+	"encoding/csv"
+	"encoding/json"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExport(t *testing.T) {
+	hub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer hub.Cleanup()
+
+	user, err := tests.CreateUser(hub, "test@test.com", "testtesttest")
+	require.NoError(t, err)
+	system, err := tests.CreateRecord(hub, "systems", map[string]any{
+		"name":  "web-1",
+		"host":  "127.0.0.1",
+		"port":  "45876",
+		"users": []string{user.Id},
+	})
+	require.NoError(t, err)
+	other, err := tests.CreateRecord(hub, "systems", map[string]any{
+		"name":  "web-2",
+		"host":  "127.0.0.2",
+		"port":  "45876",
+		"users": []string{user.Id},
+	})
+	require.NoError(t, err)
+
+	for _, avgRtt := range []float64{10, 12.5} {
+		_, err = tests.CreateRecord(hub, "ping_stats", map[string]any{"system": system.Id, "host": "1.1.1.1", "avg_rtt": avgRtt})
+		require.NoError(t, err)
+	}
+	_, err = tests.CreateRecord(hub, "ping_stats", map[string]any{"system": other.Id, "host": "1.1.1.1", "avg_rtt": 99})
+	require.NoError(t, err)
+
+	manager := export.NewManager(hub)
+	now := time.Now().UTC()
+	auth := &core.RequestInfo{Auth: user}
+	req := export.Request{System: system.Id, Collection: "ping_stats", From: now.Add(-time.Hour), To: now.Add(time.Minute), Format: "csv"}
+
+	t.Run("csv", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		require.NoError(t, manager.Export(w, req, auth))
+		assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+
+		lines, err := csv.NewReader(w.Body).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, lines, 3)
+		collection, err := hub.FindCollectionByNameOrId("ping_stats")
+		require.NoError(t, err)
+		assert.Equal(t, collection.Fields.FieldNames(), lines[0])
+		avgRtt := slices.Index(lines[0], "avg_rtt")
+		assert.Equal(t, "10", lines[1][avgRtt])
+		assert.Equal(t, "12.5", lines[2][avgRtt])
+	})
+
+	t.Run("json", func(t *testing.T) {
+		jsonReq := req
+		jsonReq.Format = "json"
+		w := httptest.NewRecorder()
+		require.NoError(t, manager.Export(w, jsonReq, auth))
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		assert.True(t, strings.HasPrefix(w.Body.String(), `[{"id":`))
+
+		var rows []map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rows))
+		require.Len(t, rows, 2)
+		assert.Equal(t, system.Id, rows[0]["system"])
+		assert.EqualValues(t, 10, rows[0]["avg_rtt"])
+		assert.EqualValues(t, 12.5, rows[1]["avg_rtt"])
+	})
+
+	t.Run("date range", func(t *testing.T) {
+		rangeReq := req
+		rangeReq.Format = "json"
+		rangeReq.From, rangeReq.To = now.Add(-48*time.Hour), now.Add(-24*time.Hour)
+		w := httptest.NewRecorder()
+		require.NoError(t, manager.Export(w, rangeReq, auth))
+		assert.Equal(t, "[]\n", w.Body.String())
+	})
+
+	t.Run("list rule", func(t *testing.T) {
+		guestReq := req
+		guestReq.Format = "json"
+		w := httptest.NewRecorder()
+		require.NoError(t, manager.Export(w, guestReq, &core.RequestInfo{}))
+		assert.Equal(t, "[]\n", w.Body.String())
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		invalid := req
+		invalid.Collection = "users"
+		assert.ErrorIs(t, manager.Export(httptest.NewRecorder(), invalid, auth), export.ErrInvalidRequest)
+		invalid = req
+		invalid.Format = "xml"
+		assert.ErrorIs(t, manager.Export(httptest.NewRecorder(), invalid, auth), export.ErrInvalidRequest)
+		invalid = req
+		invalid.From, invalid.To = req.To, req.From
+		assert.ErrorIs(t, manager.Export(httptest.NewRecorder(), invalid, auth), export.ErrInvalidRequest)
+	})
+}
@@ -0,0 +1,181 @@
+// Package federation lets a hub read stats of systems monitored by a remote hub.
+//
+// Remote hubs are registered in the federated_hubs collection with their URL and
+// an auth token of a user on the remote hub. Only read requests are proxied.
+package federation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	requestTimeout = 10 * time.Second
+	defaultLimit   = 60
+	maxLimit       = 500
+)
+
+// statsCollections maps the requested stats type to the remote collection
+var statsCollections = map[string]string{
+	"ping":      "ping_stats",
+	"dns":       "dns_stats",
+	"http":      "http_stats",
+	"speedtest": "speedtest_stats",
+}
+
+// validId matches PocketBase record ids, so they can be used in remote filters safely
+var validId = regexp.MustCompile(`^[a-zA-Z0-9_]{1,64}$`)
+
+var (
+	ErrInvalidRequest = errors.New("invalid federation request")
+	ErrHubNotFound    = errors.New("federated hub not found")
+)
+
+type Manager struct {
+	app    core.App
+	client *http.Client
+}
+
+// RemoteHub is a federated_hubs record
+type RemoteHub struct {
+	Id    string
+	Name  string
+	URL   string
+	Token string
+}
+
+// Stats is the response of a federated stats read
+type Stats struct {
+	Hub    string          `json:"hub"`    // Name of the remote hub
+	Type   string          `json:"type"`   // ping, dns, http or speedtest
+	System json.RawMessage `json:"system"` // Remote system record including current averages
+	Items  json.RawMessage `json:"items"`  // Latest remote stats records, newest first
+}
+
+func NewManager(app core.App) *Manager {
+	return &Manager{
+		app:    app,
+		client: &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// getRemoteHub returns the registered remote hub with the given id
+func (m *Manager) getRemoteHub(hubID string) (*RemoteHub, error) {
+	record, err := m.app.FindRecordById("federated_hubs", hubID)
+	if err != nil {
+		return nil, ErrHubNotFound
+	}
+	return &RemoteHub{
+		Id:    record.Id,
+		Name:  record.GetString("name"),
+		URL:   strings.TrimSuffix(record.GetString("url"), "/"),
+		Token: record.GetString("token"),
+	}, nil
+}
+
+// FetchStats reads a system and its latest stats of the given type from a remote hub
+func (m *Manager) FetchStats(hubID, systemID, statsType string, limit int) (*Stats, error) {
+	collection, ok := statsCollections[statsType]
+	if !ok || !validId.MatchString(systemID) {
+		return nil, ErrInvalidRequest
+	}
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	limit = min(limit, maxLimit)
+
+	remote, err := m.getRemoteHub(hubID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{Hub: remote.Name, Type: statsType}
+
+	stats.System, err = m.get(remote, "/api/collections/systems/records/"+systemID, url.Values{
+		"fields": {"id,name,status,info,current_averages,updated"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var list struct {
+		Items json.RawMessage `json:"items"`
+	}
+	listBody, err := m.get(remote, "/api/collections/"+collection+"/records", url.Values{
+		"filter":    {fmt.Sprintf("system='%s'", systemID)},
+		"sort":      {"-created"},
+		"perPage":   {strconv.Itoa(limit)},
+		"skipTotal": {"true"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(listBody, &list); err != nil {
+		return nil, err
+	}
+	stats.Items = list.Items
+
+	return stats, nil
+}
+
+// get performs an authenticated read request against the remote hub
+func (m *Manager) get(remote *RemoteHub, path string, query url.Values) (json.RawMessage, error) {
+	req, err := http.NewRequest(http.MethodGet, remote.URL+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", remote.Token)
+	req.Header.Set("Accept", "application/json")
+
+	res, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 10<<20))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("remote hub %s returned %d", remote.Name, res.StatusCode)
+	}
+	return body, nil
+}
+
+// GetStats handles GET /api/beszel/federated/{hubId}/stats/{systemId}
+func (m *Manager) GetStats(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+
+	query := e.Request.URL.Query()
+	statsType := query.Get("type")
+	if statsType == "" {
+		statsType = "ping"
+	}
+	limit, _ := strconv.Atoi(query.Get("limit"))
+
+	stats, err := m.FetchStats(e.Request.PathValue("hubId"), e.Request.PathValue("systemId"), statsType, limit)
+	switch {
+	case errors.Is(err, ErrInvalidRequest):
+		return apis.NewBadRequestError("Invalid system id or stats type", nil)
+	case errors.Is(err, ErrHubNotFound):
+		return apis.NewNotFoundError("Federated hub not found", nil)
+	case err != nil:
+		return e.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	return e.JSON(http.StatusOK, stats)
+}
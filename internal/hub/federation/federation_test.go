@@ -0,0 +1,105 @@
+//go:build testing
+// +build testing
+
+package federation_test
+
+import (
+	"beszel/internal/hub/federation"
+	"beszel/internal/tests"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newStubRemoteHub returns a server answering the record API requests of a remote hub
+func newStubRemoteHub(t *testing.T, token string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if r.Header.Get("Authorization") != token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/collections/systems/records/remotesystem1":
+			w.Write([]byte(`{"id":"remotesystem1","name":"eu-west","status":"up","current_averages":{"ap":23.5,"apl":0}}`))
+		case "/api/collections/ping_stats/records":
+			assert.Equal(t, "system='remotesystem1'", r.URL.Query().Get("filter"))
+			assert.Equal(t, "-created", r.URL.Query().Get("sort"))
+			assert.Equal(t, "2", r.URL.Query().Get("perPage"))
+			w.Write([]byte(`{"page":1,"perPage":2,"items":[{"host":"1.1.1.1","avg_rtt":21},{"host":"1.1.1.1","avg_rtt":26}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestFetchStats(t *testing.T) {
+	hub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer hub.Cleanup()
+
+	remote := newStubRemoteHub(t, "remote-token")
+	defer remote.Close()
+
+	remoteHub, err := tests.CreateRecord(hub, "federated_hubs", map[string]any{
+		"name":  "eu",
+		"url":   remote.URL + "/",
+		"token": "remote-token",
+	})
+	require.NoError(t, err)
+
+	manager := federation.NewManager(hub)
+
+	t.Run("remote data", func(t *testing.T) {
+		stats, err := manager.FetchStats(remoteHub.Id, "remotesystem1", "ping", 2)
+		require.NoError(t, err)
+		assert.Equal(t, "eu", stats.Hub)
+		assert.Equal(t, "ping", stats.Type)
+
+		var system struct {
+			Name     string `json:"name"`
+			Averages struct {
+				AP float64 `json:"ap"`
+			} `json:"current_averages"`
+		}
+		require.NoError(t, json.Unmarshal(stats.System, &system))
+		assert.Equal(t, "eu-west", system.Name)
+		assert.Equal(t, 23.5, system.Averages.AP)
+
+		var items []struct {
+			Host   string  `json:"host"`
+			AvgRtt float64 `json:"avg_rtt"`
+		}
+		require.NoError(t, json.Unmarshal(stats.Items, &items))
+		require.Len(t, items, 2)
+		assert.Equal(t, 21.0, items[0].AvgRtt)
+		assert.Equal(t, 26.0, items[1].AvgRtt)
+	})
+
+	t.Run("remote error", func(t *testing.T) {
+		_, err := manager.FetchStats(remoteHub.Id, "missingsystem", "ping", 2)
+		assert.ErrorContains(t, err, "returned 404")
+
+		remoteHub.Set("token", "wrong-token")
+		require.NoError(t, hub.Save(remoteHub))
+		_, err = manager.FetchStats(remoteHub.Id, "remotesystem1", "ping", 2)
+		assert.ErrorContains(t, err, "returned 401")
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		_, err := manager.FetchStats(remoteHub.Id, "remotesystem1", "cpu", 2)
+		assert.ErrorIs(t, err, federation.ErrInvalidRequest)
+		_, err = manager.FetchStats(remoteHub.Id, "x' || system!='", "ping", 2)
+		assert.ErrorIs(t, err, federation.ErrInvalidRequest)
+		_, err = manager.FetchStats("unknownhub", "remotesystem1", "ping", 2)
+		assert.ErrorIs(t, err, federation.ErrHubNotFound)
+	})
+}
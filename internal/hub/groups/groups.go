@@ -0,0 +1,139 @@
+// Package groups aggregates the health and averages of named groups of systems.
+//
+// Groups are stored in the system_groups collection and are only visible to
+// their owner. The collection rules handle CRUD, this package adds the summary.
+package groups
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+var (
+	ErrGroupNotFound = errors.New("system group not found")
+	ErrForbidden     = errors.New("system group belongs to another user")
+)
+
+// rateAverages maps failure and loss rate averages to the latency average of the same checks.
+// A rate of 0 only counts if the system has latency data for those checks.
+var rateAverages = map[string]string{
+	"apl": "ap",
+	"adf": "ad",
+	"ahf": "ah",
+}
+
+type Manager struct {
+	app core.App
+}
+
+// SystemSummary is the state of a system in a group
+type SystemSummary struct {
+	Id     string `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// Summary is the aggregated state of a group's systems
+type Summary struct {
+	Id       string             `json:"id"`
+	Name     string             `json:"name"`
+	Total    int                `json:"total"`    // Systems in the group
+	Status   map[string]int     `json:"status"`   // Systems per status (up, down, paused, pending)
+	Averages map[string]float64 `json:"averages"` // Mean of the systems' current averages, keyed like current_averages
+	Systems  []SystemSummary    `json:"systems"`
+}
+
+func NewManager(app core.App) *Manager {
+	return &Manager{app: app}
+}
+
+// Summary aggregates the systems of a group owned by the given user
+func (m *Manager) Summary(groupID, userID string) (*Summary, error) {
+	group, err := m.app.FindRecordById("system_groups", groupID)
+	if err != nil {
+		return nil, ErrGroupNotFound
+	}
+	if group.GetString("owner") != userID {
+		return nil, ErrForbidden
+	}
+
+	systemIDs := group.GetStringSlice("systems")
+	systems, err := m.app.FindRecordsByIds("systems", systemIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &Summary{
+		Id:       group.Id,
+		Name:     group.GetString("name"),
+		Total:    len(systems),
+		Status:   map[string]int{},
+		Averages: map[string]float64{},
+		Systems:  make([]SystemSummary, 0, len(systems)),
+	}
+
+	sums := map[string]float64{}
+	counts := map[string]int{}
+	for _, system := range systems {
+		status := system.GetString("status")
+		summary.Status[status]++
+		summary.Systems = append(summary.Systems, SystemSummary{
+			Id:     system.Id,
+			Name:   system.GetString("name"),
+			Status: status,
+		})
+
+		var averages map[string]float64
+		if err := json.Unmarshal([]byte(system.GetString("current_averages")), &averages); err != nil {
+			continue
+		}
+		for key, value := range averages {
+			if !hasData(averages, key, value) {
+				continue
+			}
+			sums[key] += value
+			counts[key]++
+		}
+	}
+	for key, sum := range sums {
+		summary.Averages[key] = math.Round(sum/float64(counts[key])*100) / 100
+	}
+
+	return summary, nil
+}
+
+// hasData reports whether an average holds data. Latencies and speeds of 0 mean
+// the system has no results for those checks.
+func hasData(averages map[string]float64, key string, value float64) bool {
+	if value > 0 {
+		return true
+	}
+	if latencyKey, ok := rateAverages[key]; ok {
+		return averages[latencyKey] > 0
+	}
+	return false
+}
+
+// GetSummary handles GET /api/beszel/groups/{id}/summary
+func (m *Manager) GetSummary(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+
+	summary, err := m.Summary(e.Request.PathValue("id"), info.Auth.Id)
+	switch {
+	case errors.Is(err, ErrGroupNotFound):
+		return apis.NewNotFoundError("System group not found", nil)
+	case errors.Is(err, ErrForbidden):
+		return apis.NewForbiddenError("Forbidden", nil)
+	case err != nil:
+		return e.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return e.JSON(http.StatusOK, summary)
+}
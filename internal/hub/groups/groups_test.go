@@ -0,0 +1,83 @@
+//go:build testing
+// +build testing
+
+package groups_test
+
+import (
+	"beszel/internal/hub/groups"
+	"beszel/internal/tests"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummary(t *testing.T) {
+	hub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer hub.Cleanup()
+
+	owner, err := tests.CreateUser(hub, "owner@test.com", "testtesttest")
+	require.NoError(t, err)
+	other, err := tests.CreateUser(hub, "other@test.com", "testtesttest")
+	require.NoError(t, err)
+
+	createSystem := func(name, status string, averages map[string]float64) string {
+		record, err := tests.CreateRecord(hub, "systems", map[string]any{
+			"name":             name,
+			"host":             name,
+			"port":             "45876",
+			"users":            []string{owner.Id},
+			"current_averages": averages,
+		})
+		require.NoError(t, err)
+		// new systems are always pending until the hub connects
+		_, err = hub.DB().NewQuery("UPDATE systems SET status = {:status} WHERE id = {:id}").Bind(map[string]any{
+			"status": status,
+			"id":     record.Id,
+		}).Execute()
+		require.NoError(t, err)
+		return record.Id
+	}
+
+	amsterdam := createSystem("amsterdam", "up", map[string]float64{"ap": 10, "apl": 0, "ah": 200, "ahf": 10, "adl": 0})
+	london := createSystem("london", "up", map[string]float64{"ap": 20, "apl": 2, "ah": 100, "ahf": 0, "adl": 500})
+	paris := createSystem("paris", "down", map[string]float64{"ap": 0, "apl": 0})
+	// not in the group
+	createSystem("berlin", "up", map[string]float64{"ap": 1000})
+
+	group, err := tests.CreateRecord(hub, "system_groups", map[string]any{
+		"name":    "europe",
+		"systems": []string{amsterdam, london, paris},
+		"owner":   owner.Id,
+	})
+	require.NoError(t, err)
+
+	manager := groups.NewManager(hub)
+
+	t.Run("aggregates member systems", func(t *testing.T) {
+		summary, err := manager.Summary(group.Id, owner.Id)
+		require.NoError(t, err)
+		assert.Equal(t, "europe", summary.Name)
+		assert.Equal(t, 3, summary.Total)
+		assert.Equal(t, map[string]int{"up": 2, "down": 1}, summary.Status)
+		assert.Len(t, summary.Systems, 3)
+
+		// paris has no ping data, so only amsterdam and london count
+		assert.Equal(t, 15.0, summary.Averages["ap"])
+		assert.Equal(t, 1.0, summary.Averages["apl"])
+		assert.Equal(t, 150.0, summary.Averages["ah"])
+		assert.Equal(t, 5.0, summary.Averages["ahf"])
+		// only london ran a speedtest
+		assert.Equal(t, 500.0, summary.Averages["adl"])
+		assert.NotContains(t, summary.Averages, "ad")
+	})
+
+	t.Run("ownership", func(t *testing.T) {
+		_, err := manager.Summary(group.Id, other.Id)
+		assert.ErrorIs(t, err, groups.ErrForbidden)
+
+		_, err = manager.Summary("unknowngroup", owner.Id)
+		assert.ErrorIs(t, err, groups.ErrGroupNotFound)
+	})
+}
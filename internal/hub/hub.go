@@ -5,12 +5,22 @@ import (
 	"beszel"
 	"beszel/internal/alerts"
 	"beszel/internal/hub/config"
+	"beszel/internal/hub/export"
+	"beszel/internal/hub/federation"
+	"beszel/internal/hub/groups"
+	"beszel/internal/hub/metrics"
+	"beszel/internal/hub/slo"
+	"beszel/internal/hub/speedtest"
+	"beszel/internal/hub/statuspage"
 	"beszel/internal/hub/systems"
+	"beszel/internal/hub/tags"
+	"beszel/internal/hub/uptime"
 	"beszel/internal/records"
 	"beszel/internal/users"
 	"beszel/site"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log/slog"
@@ -22,6 +32,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/blang/semver"
 	"github.com/google/uuid"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/apis"
@@ -34,6 +45,15 @@ type Hub struct {
 	um            *users.UserManager
 	rm            *records.RecordManager
 	sm            *systems.SystemManager
+	slo           *slo.Manager
+	federation    *federation.Manager
+	groups        *groups.Manager
+	metrics       *metrics.Manager
+	export        *export.Manager
+	speedtest     *speedtest.Manager
+	tags          *tags.Manager
+	statusPages   *statuspage.Manager
+	uptime        *uptime.Manager
 	configManager *ConfigurationManager // Optimized configuration management
 	authKey       string                 // Base64 authentication key for agents
 	appURL        string
@@ -48,6 +68,16 @@ func NewHub(app core.App) *Hub {
 	hub.um = users.NewUserManager(hub)
 	hub.rm = records.NewRecordManager(hub)
 	hub.sm = systems.NewSystemManager(hub)
+	hub.slo = slo.NewManager(hub)
+	hub.federation = federation.NewManager(hub)
+	hub.groups = groups.NewManager(hub)
+	metricsToken, _ := GetEnv("METRICS_TOKEN")
+	hub.metrics = metrics.NewManager(hub, metricsToken)
+	hub.export = export.NewManager(hub)
+	hub.speedtest = speedtest.NewManager(hub)
+	hub.tags = tags.NewManager(hub)
+	hub.statusPages = statuspage.NewManager(hub)
+	hub.uptime = uptime.NewManager(hub)
 	hub.configManager = NewConfigurationManager(hub) // Initialize configuration manager
 	hub.appURL, _ = GetEnv("APP_URL")
 
@@ -163,6 +193,8 @@ func (h *Hub) StartHub() error {
 	// handle default values for user / user_settings creation
 	h.App.OnRecordCreate("users").BindFunc(h.um.InitializeUserRole)
 	h.App.OnRecordCreate("user_settings").BindFunc(h.um.InitializeUserSettings)
+	// group alerts may have a threshold of 0, so the collection can't require one
+	h.App.OnRecordCreateRequest("group_alerts").BindFunc(h.tags.ValidateGroupAlert)
 
 	// handle system record updates (for initial config sending on startup)
 	h.App.OnRecordAfterUpdateSuccess("systems").BindFunc(h.onSystemRecordUpdate)
@@ -334,6 +366,16 @@ func (h *Hub) startServer(se *core.ServeEvent) error {
 func (h *Hub) registerCronJobs(_ *core.ServeEvent) error {
 	// delete old records based on retention policy once every hour
 	h.Cron().MustAdd("delete old records", "8 * * * *", h.rm.DeleteOldRecords)
+	// roll up old stats into hourly aggregates once every hour, before the deletion
+	h.Cron().MustAdd("rollup old records", "3 * * * *", h.rm.RollupOldRecords)
+	// check SLO error budget burn rates every five minutes
+	h.Cron().MustAdd("check slo burn rates", "*/5 * * * *", h.slo.CheckBurnRates)
+	// check the speedtest averages of tagged systems every five minutes
+	h.Cron().MustAdd("check group alerts", "*/5 * * * *", h.tags.CheckGroupAlerts)
+	// store the uptime of the systems over rolling windows every ten minutes
+	h.Cron().MustAdd("update system uptime", "*/10 * * * *", h.uptime.UpdateAll)
+	// measure the round trip time of the agents' WebSocket connections every minute
+	h.Cron().MustAdd("measure agent latency", "* * * * *", h.sm.MeasureAgentLatency)
 	// NOTE: Disabled old batch average calculation system in favor of real-time current_averages
 	// h.Cron().MustAdd("calculate system averages", "*/5 * * * *", func() {
 	// 	if err := h.calculateSystemAverages(); err != nil {
@@ -373,8 +415,39 @@ func (h *Hub) registerApiRoutes(se *core.ServeEvent) error {
 	se.Router.GET("/api/beszel/config-yaml", config.GetYamlConfig)
 	// Configuration management endpoints
 	se.Router.GET("/api/beszel/config/stats", h.getConfigurationStats)
+	se.Router.GET("/api/beszel/config/diff/{id}", h.getConfigurationDiff)
 	se.Router.POST("/api/beszel/config/sync-all", h.syncConfigurationToAllAgents)
 	se.Router.POST("/api/beszel/config/sync/{id}", h.syncConfigurationToAgent)
+	// run checks of a service on an agent immediately
+	se.Router.POST("/api/beszel/systems/{id}/run/{service}", h.runCheckNow)
+	// pause or resume the checks of one service, the others keep running
+	se.Router.POST("/api/beszel/systems/{id}/monitors/{service}/pause", h.setMonitorPaused(true))
+	se.Router.POST("/api/beszel/systems/{id}/monitors/{service}/resume", h.setMonitorPaused(false))
+	// update the agent binary of a system to the latest or a given version
+	se.Router.POST("/api/beszel/systems/{id}/update-agent", h.updateAgent)
+	// pause or resume several systems at once
+	se.Router.POST("/api/beszel/systems/bulk-status", h.bulkSetStatus)
+	// maintenance windows holding back the alert notifications of a system
+	se.Router.GET("/api/beszel/systems/{id}/maintenance-windows", h.GetMaintenanceWindows)
+	se.Router.POST("/api/beszel/systems/{id}/maintenance-windows", h.CreateMaintenanceWindow)
+	// preview whether a metric value would trigger an alert, without saving or sending
+	se.Router.POST("/api/beszel/alerts/{id}/simulate", h.SimulateAlert)
+	// systems filtered by tag, like ?tag=loc:lab
+	se.Router.GET("/api/beszel/systems", h.tags.GetSystems)
+	// historical stats of a system as CSV or JSON
+	se.Router.GET("/api/beszel/systems/{id}/export", h.export.GetExport)
+	// speedtest servers a system used, with their run counts and average speeds
+	se.Router.GET("/api/beszel/systems/{id}/speedtest-servers", h.speedtest.GetServers)
+	// SLO compliance for a system
+	se.Router.GET("/api/beszel/slo/{systemId}", h.slo.GetCompliance)
+	// read-only stats of a system on a federated remote hub
+	se.Router.GET("/api/beszel/federated/{hubId}/stats/{systemId}", h.federation.GetStats)
+	// aggregated health and averages of a system group
+	se.Router.GET("/api/beszel/groups/{id}/summary", h.groups.GetSummary)
+	// public read-only status page of a set of systems, no auth required
+	se.Router.GET("/api/beszel/status/{token}", h.statusPages.GetPage)
+	// current stats of all systems for Prometheus scrapers
+	se.Router.GET("/api/beszel/metrics", h.metrics.GetMetrics)
 	// handle agent websocket connection
 	se.Router.GET("/api/beszel/agent-connect", h.handleAgentConnect)
 	// get or create universal tokens
@@ -511,6 +584,109 @@ func (h *Hub) syncConfigurationToAgent(e *core.RequestEvent) error {
 	})
 }
 
+// runCheckNow asks an agent to run the checks of a service outside of its schedule.
+// Every user who can view the system can, except read-only users.
+func (h *Hub) runCheckNow(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil || info.Auth.GetString("role") == "readonly" {
+		return apis.NewForbiddenError("Read-only users can't run checks", nil)
+	}
+
+	systemID := e.Request.PathValue("id")
+	service := e.Request.PathValue("service")
+	err := h.sm.RunCheckNow(systemID, service)
+	switch {
+	case errors.Is(err, systems.ErrUnknownService):
+		return apis.NewBadRequestError("Unknown service: "+service, nil)
+	case errors.Is(err, systems.ErrSystemNotFound):
+		return apis.NewNotFoundError("System not found", nil)
+	case errors.Is(err, systems.ErrSystemNotConnected):
+		return e.JSON(http.StatusConflict, map[string]string{
+			"error": "System is not connected over WebSocket",
+		})
+	case err != nil:
+		return e.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	return e.JSON(http.StatusAccepted, map[string]string{
+		"status": service + " checks triggered for system " + systemID,
+	})
+}
+
+// updateAgent asks the agent of a system to update its binary. The body may set the
+// version to install, like {"version": "1.2.3"}, else the latest release is installed.
+// The agent reports the progress, which is stored in the system's agent_update field.
+func (h *Hub) updateAgent(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil || info.Auth.GetString("role") != "admin" {
+		return apis.NewForbiddenError("Admin access required", nil)
+	}
+
+	var body struct {
+		Version string `json:"version"`
+	}
+	if e.Request.ContentLength > 0 {
+		if err := e.BindBody(&body); err != nil {
+			return apis.NewBadRequestError("Invalid request body", err)
+		}
+	}
+	if body.Version != "" {
+		if _, err := semver.Parse(strings.TrimPrefix(body.Version, "v")); err != nil {
+			return apis.NewBadRequestError("Invalid version: "+body.Version, nil)
+		}
+	}
+
+	systemID := e.Request.PathValue("id")
+	err := h.sm.UpdateAgent(systemID, body.Version)
+	switch {
+	case errors.Is(err, systems.ErrSystemNotFound):
+		return apis.NewNotFoundError("System not found", nil)
+	case errors.Is(err, systems.ErrSystemNotConnected):
+		return e.JSON(http.StatusConflict, map[string]string{
+			"error": "System is not connected over WebSocket",
+		})
+	case err != nil:
+		return e.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	return e.JSON(http.StatusAccepted, map[string]string{
+		"status": "agent update requested for system " + systemID,
+	})
+}
+
+// bulkSetStatus pauses or resumes several systems at once, reporting the outcome per system
+func (h *Hub) bulkSetStatus(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil || info.Auth.GetString("role") != "admin" {
+		return apis.NewForbiddenError("Admin access required", nil)
+	}
+
+	var body struct {
+		Ids    []string `json:"ids"`
+		Status string   `json:"status"`
+	}
+	if err := e.BindBody(&body); err != nil {
+		return apis.NewBadRequestError("Invalid request body", err)
+	}
+	if len(body.Ids) == 0 {
+		return apis.NewBadRequestError("No systems given", nil)
+	}
+
+	results, err := h.sm.SetStatus(body.Ids, body.Status)
+	if errors.Is(err, systems.ErrInvalidStatus) {
+		return apis.NewBadRequestError("Status must be paused or pending", nil)
+	} else if err != nil {
+		return e.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	}
+	return e.JSON(http.StatusOK, results)
+}
+
 // onMonitoringConfigUpdate handles monitoring configuration updates
 func (h *Hub) onMonitoringConfigUpdate(e *core.RecordEvent) error {
 	systemID := e.Record.GetString("system")
@@ -0,0 +1,273 @@
+// Package metrics exposes the latest stats of all systems in the Prometheus text format.
+//
+// Gauges are read from the newest row per target in the stats collections. The endpoint
+// is guarded by a bearer token if BESZEL_HUB_METRICS_TOKEN is set, else it needs an
+// authenticated user.
+package metrics
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// maxAge is how old the newest row of a target may be to still be exported
+const maxAge = 24 * time.Hour
+
+// contentType is the Prometheus text exposition format
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// bufferPool reuses the buffers responses are written to, since the endpoint is scraped often
+var bufferPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+type Manager struct {
+	app   core.App
+	token string // Bearer token scrapers authenticate with, empty requires a user
+}
+
+type pingRow struct {
+	System     string  `db:"system"`
+	Host       string  `db:"host"`
+	AvgRtt     float64 `db:"avg_rtt"`
+	MinRtt     float64 `db:"min_rtt"`
+	MaxRtt     float64 `db:"max_rtt"`
+	PacketLoss float64 `db:"packet_loss"`
+}
+
+type dnsRow struct {
+	System     string  `db:"system"`
+	Domain     string  `db:"domain"`
+	Server     string  `db:"server"`
+	Status     string  `db:"status"`
+	LookupTime float64 `db:"lookup_time"`
+}
+
+type httpRow struct {
+	System       string  `db:"system"`
+	URL          string  `db:"url"`
+	Status       string  `db:"status"`
+	ResponseTime float64 `db:"response_time"`
+	StatusCode   int     `db:"status_code"`
+}
+
+type speedtestRow struct {
+	System        string  `db:"system"`
+	Server        string  `db:"server_id"`
+	DownloadSpeed float64 `db:"download_speed"`
+	UploadSpeed   float64 `db:"upload_speed"`
+	Latency       float64 `db:"latency"`
+}
+
+type systemRow struct {
+	Name   string `db:"name"`
+	Status string `db:"status"`
+}
+
+func NewManager(app core.App, token string) *Manager {
+	return &Manager{app: app, token: token}
+}
+
+// GetMetrics handles GET /api/beszel/metrics
+func (m *Manager) GetMetrics(e *core.RequestEvent) error {
+	if !m.authorized(e) {
+		return apis.NewUnauthorizedError("Unauthorized", nil)
+	}
+
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer func() {
+		buf.Reset()
+		bufferPool.Put(buf)
+	}()
+	if err := m.Write(buf, time.Now().UTC()); err != nil {
+		return e.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	e.Response.Header().Set("Content-Type", contentType)
+	e.Response.WriteHeader(http.StatusOK)
+	_, err := e.Response.Write(buf.Bytes())
+	return err
+}
+
+// authorized checks the bearer token if one is configured, else that a user is authenticated
+func (m *Manager) authorized(e *core.RequestEvent) bool {
+	if m.token != "" {
+		token, ok := strings.CutPrefix(e.Request.Header.Get("Authorization"), "Bearer ")
+		return ok && subtle.ConstantTimeCompare([]byte(token), []byte(m.token)) == 1
+	}
+	info, err := e.RequestInfo()
+	return err == nil && info.Auth != nil
+}
+
+// Write writes the metrics of all systems to buf
+func (m *Manager) Write(buf *bytes.Buffer, now time.Time) error {
+	params := dbx.Params{"since": now.Add(-maxAge).Format(types.DefaultDateLayout)}
+
+	var systems []systemRow
+	if err := m.app.DB().NewQuery("SELECT name, status FROM systems ORDER BY name").All(&systems); err != nil {
+		return err
+	}
+	writeHeader(buf, "lightspeed_system_up", "Whether the system is up (1) or not (0)")
+	for _, s := range systems {
+		writeSample(buf, "lightspeed_system_up", boolValue(s.Status == "up"), "system", s.Name)
+	}
+
+	// SQLite returns the other columns of the row with the newest created for each group
+	var pings []pingRow
+	if err := m.app.DB().NewQuery(`
+		SELECT s.name AS system, p.host, p.avg_rtt, p.min_rtt, p.max_rtt, p.packet_loss, MAX(p.created)
+		FROM ping_stats p JOIN systems s ON s.id = p.system
+		WHERE p.created > {:since}
+		GROUP BY p.system, p.host
+		ORDER BY s.name, p.host
+	`).Bind(params).All(&pings); err != nil {
+		return err
+	}
+	writeHeader(buf, "lightspeed_ping_avg_rtt", "Average round trip time of the latest ping in milliseconds")
+	for _, p := range pings {
+		writeSample(buf, "lightspeed_ping_avg_rtt", p.AvgRtt, "system", p.System, "host", p.Host)
+	}
+	writeHeader(buf, "lightspeed_ping_min_rtt", "Minimum round trip time of the latest ping in milliseconds")
+	for _, p := range pings {
+		writeSample(buf, "lightspeed_ping_min_rtt", p.MinRtt, "system", p.System, "host", p.Host)
+	}
+	writeHeader(buf, "lightspeed_ping_max_rtt", "Maximum round trip time of the latest ping in milliseconds")
+	for _, p := range pings {
+		writeSample(buf, "lightspeed_ping_max_rtt", p.MaxRtt, "system", p.System, "host", p.Host)
+	}
+	writeHeader(buf, "lightspeed_ping_packet_loss", "Packet loss of the latest ping in percent")
+	for _, p := range pings {
+		writeSample(buf, "lightspeed_ping_packet_loss", p.PacketLoss, "system", p.System, "host", p.Host)
+	}
+
+	var lookups []dnsRow
+	if err := m.app.DB().NewQuery(`
+		SELECT s.name AS system, d.domain, d.server, d.status, d.lookup_time, MAX(d.created)
+		FROM dns_stats d JOIN systems s ON s.id = d.system
+		WHERE d.created > {:since}
+		GROUP BY d.system, d.domain, d.server
+		ORDER BY s.name, d.domain, d.server
+	`).Bind(params).All(&lookups); err != nil {
+		return err
+	}
+	writeHeader(buf, "lightspeed_dns_lookup_time", "Duration of the latest DNS lookup in milliseconds")
+	for _, d := range lookups {
+		writeSample(buf, "lightspeed_dns_lookup_time", d.LookupTime, "system", d.System, "domain", d.Domain, "server", d.Server)
+	}
+	writeHeader(buf, "lightspeed_dns_up", "Whether the latest DNS lookup succeeded (1) or not (0)")
+	for _, d := range lookups {
+		writeSample(buf, "lightspeed_dns_up", boolValue(d.Status == "success"), "system", d.System, "domain", d.Domain, "server", d.Server)
+	}
+
+	var requests []httpRow
+	if err := m.app.DB().NewQuery(`
+		SELECT s.name AS system, h.url, h.status, h.response_time, h.status_code, MAX(h.created)
+		FROM http_stats h JOIN systems s ON s.id = h.system
+		WHERE h.created > {:since}
+		GROUP BY h.system, h.url
+		ORDER BY s.name, h.url
+	`).Bind(params).All(&requests); err != nil {
+		return err
+	}
+	writeHeader(buf, "lightspeed_http_response_time", "Response time of the latest HTTP check in milliseconds")
+	for _, h := range requests {
+		writeSample(buf, "lightspeed_http_response_time", h.ResponseTime, "system", h.System, "url", h.URL)
+	}
+	writeHeader(buf, "lightspeed_http_status_code", "Status code of the latest HTTP check, 0 if there was no response")
+	for _, h := range requests {
+		writeSample(buf, "lightspeed_http_status_code", float64(h.StatusCode), "system", h.System, "url", h.URL)
+	}
+	writeHeader(buf, "lightspeed_http_up", "Whether the latest HTTP check succeeded (1) or not (0)")
+	for _, h := range requests {
+		writeSample(buf, "lightspeed_http_up", boolValue(h.Status == "success"), "system", h.System, "url", h.URL)
+	}
+
+	// failed speedtests have no speeds, so the latest successful one is exported
+	var speedtests []speedtestRow
+	if err := m.app.DB().NewQuery(`
+		SELECT s.name AS system, t.server_id, t.download_speed, t.upload_speed, t.latency, MAX(t.created)
+		FROM speedtest_stats t JOIN systems s ON s.id = t.system
+		WHERE t.created > {:since} AND t.status = 'success'
+		GROUP BY t.system, t.server_id
+		ORDER BY s.name, t.server_id
+	`).Bind(params).All(&speedtests); err != nil {
+		return err
+	}
+	writeHeader(buf, "lightspeed_speedtest_download_mbps", "Download speed of the latest successful speedtest in Mbps")
+	for _, s := range speedtests {
+		writeSample(buf, "lightspeed_speedtest_download_mbps", s.DownloadSpeed, "system", s.System, "server", s.Server)
+	}
+	writeHeader(buf, "lightspeed_speedtest_upload_mbps", "Upload speed of the latest successful speedtest in Mbps")
+	for _, s := range speedtests {
+		writeSample(buf, "lightspeed_speedtest_upload_mbps", s.UploadSpeed, "system", s.System, "server", s.Server)
+	}
+	writeHeader(buf, "lightspeed_speedtest_latency", "Latency of the latest successful speedtest in milliseconds")
+	for _, s := range speedtests {
+		writeSample(buf, "lightspeed_speedtest_latency", s.Latency, "system", s.System, "server", s.Server)
+	}
+
+	return nil
+}
+
+// writeHeader writes the HELP and TYPE lines of a gauge
+func writeHeader(buf *bytes.Buffer, name, help string) {
+	buf.WriteString("# HELP ")
+	buf.WriteString(name)
+	buf.WriteByte(' ')
+	buf.WriteString(help)
+	buf.WriteString("\n# TYPE ")
+	buf.WriteString(name)
+	buf.WriteString(" gauge\n")
+}
+
+// writeSample writes a sample line, labels are pairs of names and values
+func writeSample(buf *bytes.Buffer, name string, value float64, labels ...string) {
+	buf.WriteString(name)
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i == 0 {
+			buf.WriteByte('{')
+		} else {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(labels[i])
+		buf.WriteString(`="`)
+		writeLabelValue(buf, labels[i+1])
+		buf.WriteByte('"')
+	}
+	if len(labels) > 1 {
+		buf.WriteByte('}')
+	}
+	buf.WriteByte(' ')
+	buf.Write(strconv.AppendFloat(buf.AvailableBuffer(), value, 'g', -1, 64))
+	buf.WriteByte('\n')
+}
+
+// writeLabelValue writes a label value, escaping backslashes, quotes and newlines
+func writeLabelValue(buf *bytes.Buffer, value string) {
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '\\':
+			buf.WriteString(`\\`)
+		case '"':
+			buf.WriteString(`\"`)
+		case '\n':
+			buf.WriteString(`\n`)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
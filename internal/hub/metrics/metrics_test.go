@@ -0,0 +1,76 @@
+//go:build testing
+// +build testing
+
+package metrics_test
+
+import (
+	"beszel/internal/hub/metrics"
+	"beszel/internal/tests"
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	hub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer hub.Cleanup()
+
+	user, err := tests.CreateUser(hub, "test@test.com", "testtesttest")
+	require.NoError(t, err)
+	system, err := tests.CreateRecord(hub, "systems", map[string]any{
+		"name":  `web "1"`,
+		"host":  "127.0.0.1",
+		"port":  "45876",
+		"users": []string{user.Id},
+	})
+	require.NoError(t, err)
+
+	for _, avgRtt := range []float64{10, 12.5} {
+		_, err = tests.CreateRecord(hub, "ping_stats", map[string]any{
+			"system": system.Id, "host": "1.1.1.1", "avg_rtt": avgRtt, "min_rtt": 9, "max_rtt": 15, "packet_loss": 0,
+		})
+		require.NoError(t, err)
+		// created has millisecond precision, make sure the second row is newer
+		time.Sleep(5 * time.Millisecond)
+	}
+	_, err = tests.CreateRecord(hub, "dns_stats", map[string]any{
+		"system": system.Id, "domain": "example.com", "server": "8.8.8.8", "status": "timeout", "lookup_time": 0,
+	})
+	require.NoError(t, err)
+	_, err = tests.CreateRecord(hub, "http_stats", map[string]any{
+		"system": system.Id, "url": "https://example.com", "status": "success", "response_time": 120, "status_code": 200,
+	})
+	require.NoError(t, err)
+	_, err = tests.CreateRecord(hub, "speedtest_stats", map[string]any{
+		"system": system.Id, "server_id": "1234", "status": "success", "download_speed": 940.5, "upload_speed": 40, "latency": 3,
+	})
+	require.NoError(t, err)
+	_, err = tests.CreateRecord(hub, "speedtest_stats", map[string]any{
+		"system": system.Id, "server_id": "1234", "status": "error",
+	})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, metrics.NewManager(hub, "").Write(&buf, time.Now().UTC()))
+	out := buf.String()
+
+	assert.Contains(t, out, "# HELP lightspeed_ping_avg_rtt ")
+	assert.Contains(t, out, "# TYPE lightspeed_ping_avg_rtt gauge\n")
+	assert.Contains(t, out, `lightspeed_system_up{system="web \"1\""} 0`+"\n")
+	assert.Contains(t, out, `lightspeed_ping_avg_rtt{system="web \"1\"",host="1.1.1.1"} 12.5`+"\n")
+	assert.NotContains(t, out, `host="1.1.1.1"} 10`+"\n")
+	assert.Contains(t, out, `lightspeed_dns_up{system="web \"1\"",domain="example.com",server="8.8.8.8"} 0`+"\n")
+	assert.Contains(t, out, `lightspeed_http_response_time{system="web \"1\"",url="https://example.com"} 120`+"\n")
+	assert.Contains(t, out, `lightspeed_http_status_code{system="web \"1\"",url="https://example.com"} 200`+"\n")
+	// the failed speedtest doesn't replace the speeds of the successful one
+	assert.Contains(t, out, `lightspeed_speedtest_download_mbps{system="web \"1\"",server="1234"} 940.5`+"\n")
+
+	// rows older than a day aren't exported
+	buf.Reset()
+	require.NoError(t, metrics.NewManager(hub, "").Write(&buf, time.Now().UTC().Add(48*time.Hour)))
+	assert.NotContains(t, buf.String(), "lightspeed_ping_avg_rtt{")
+}
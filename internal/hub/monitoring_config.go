@@ -1,13 +1,19 @@
 package hub
 
 import (
+	"beszel/internal/common"
 	"beszel/internal/entities/system"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
-	"time"
+	"net/http"
+	"slices"
 
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
 )
 
 // SendMonitoringConfigToAgent sends unified monitoring configuration to an agent via WebSocket
@@ -30,54 +36,88 @@ func (h *Hub) sendMonitoringConfigToAgentLegacy(systemRecord *core.Record) error
 	if err != nil {
 		h.Logger().Debug("No monitoring config found for system, sending empty configuration", "system", systemRecord.Id, "err", err)
 		// No monitoring config, send empty configuration
-		return h.sendMonitoringConfigToSystem(systemRecord.Id, system.MonitoringConfig{})
+		return h.sendMonitoringConfigToSystem(systemRecord.Id, system.MonitoringConfig{}, 0)
 	}
 
-	// Build the monitoring configuration from the record fields
-	monitoringConfig := system.MonitoringConfig{
-		Enabled: struct {
-			Ping      bool `json:"ping"`
-			Dns       bool `json:"dns"`
-			Http      bool `json:"http,omitempty"`
-			Speedtest bool `json:"speedtest,omitempty"`
-		}{
-			Ping:      monitoringConfigRecord.Get("ping") != nil,
-			Dns:       monitoringConfigRecord.Get("dns") != nil,
-			Http:      monitoringConfigRecord.Get("http") != nil,
-			Speedtest: monitoringConfigRecord.Get("speedtest") != nil,
-		},
+	monitoringConfig, err := monitoringConfigFromRecord(monitoringConfigRecord)
+	if err != nil {
+		h.Logger().Error("Failed to parse monitoring config", "system", systemRecord.Id, "err", err)
 	}
 
-	// Parse individual monitoring configurations
-	if pingData := monitoringConfigRecord.Get("ping"); pingData != nil {
-		if err := json.Unmarshal([]byte(fmt.Sprintf("%v", pingData)), &monitoringConfig.Ping); err != nil {
-			h.Logger().Error("Failed to parse ping config", "system", systemRecord.Id, "err", err)
-		}
-	}
+	return h.sendMonitoringConfigToSystem(systemRecord.Id, monitoringConfig, configVersion(monitoringConfigRecord))
+}
 
-	if dnsData := monitoringConfigRecord.Get("dns"); dnsData != nil {
-		if err := json.Unmarshal([]byte(fmt.Sprintf("%v", dnsData)), &monitoringConfig.Dns); err != nil {
-			h.Logger().Error("Failed to parse DNS config", "system", systemRecord.Id, "err", err)
-		}
-	}
+// configVersion returns the version of the configuration in a monitoring_config record, the Unix
+// time in milliseconds it was last changed at. Loading the same record again gives the same
+// version, so reloads and reconnects don't make a configuration newer than another hub's.
+// Systems without a monitoring_config record get version 0.
+func configVersion(record *core.Record) int64 {
+	return record.GetDateTime("updated").Time().UnixMilli()
+}
 
-	if httpData := monitoringConfigRecord.Get("http"); httpData != nil {
-		if err := json.Unmarshal([]byte(fmt.Sprintf("%v", httpData)), &monitoringConfig.Http); err != nil {
-			h.Logger().Error("Failed to parse HTTP config", "system", systemRecord.Id, "err", err)
+// monitoringConfigFromRecord builds the monitoring configuration stored in a monitoring_config record.
+// A service is enabled by an "enabled" key in its JSON, or without one if it has targets, so an
+// empty object or null doesn't have the agent schedule checks without targets. Services that
+// fail to parse stay disabled, as do paused services.
+func monitoringConfigFromRecord(record *core.Record) (system.MonitoringConfig, error) {
+	var config system.MonitoringConfig
+	var errs []error
+	parse := func(field string, service any, targets func() int) bool {
+		raw, _ := record.Get(field).(types.JSONRaw)
+		if len(raw) == 0 || string(raw) == "null" {
+			return false
 		}
+		if err := json.Unmarshal(raw, service); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field, err))
+			return false
+		}
+		var explicit struct {
+			Enabled *bool `json:"enabled"`
+		}
+		if err := json.Unmarshal(raw, &explicit); err == nil && explicit.Enabled != nil {
+			return *explicit.Enabled
+		}
+		return targets() > 0
 	}
 
-	if speedtestData := monitoringConfigRecord.Get("speedtest"); speedtestData != nil {
-		if err := json.Unmarshal([]byte(fmt.Sprintf("%v", speedtestData)), &monitoringConfig.Speedtest); err != nil {
-			h.Logger().Error("Failed to parse speedtest config", "system", systemRecord.Id, "err", err)
+	config.Enabled.Ping = parse("ping", &config.Ping, func() int { return len(config.Ping.Targets) })
+	config.Enabled.Dns = parse("dns", &config.Dns, func() int { return len(config.Dns.Targets) })
+	config.Enabled.Http = parse("http", &config.Http, func() int { return len(config.Http.Targets) })
+	config.Enabled.Speedtest = parse("speedtest", &config.Speedtest, func() int { return len(config.Speedtest.Targets) })
+	config.Enabled.Traceroute = parse("traceroute", &config.Traceroute, func() int { return len(config.Traceroute.Targets) })
+	config.Enabled.Snmp = parse("snmp", &config.Snmp, func() int { return len(config.Snmp.Targets) })
+	config.CronSeconds = record.GetBool("cron_seconds")
+	config.Jitter = record.GetBool("jitter")
+	config.Paused = record.GetStringSlice("paused")
+	for _, service := range config.Paused {
+		if enabled := serviceEnabled(&config, service); enabled != nil {
+			*enabled = false
 		}
 	}
+	return config, errors.Join(errs...)
+}
 
-	return h.sendMonitoringConfigToSystem(systemRecord.Id, monitoringConfig)
+// serviceEnabled returns the enabled flag of a service in the configuration, nil for unknown services
+func serviceEnabled(config *system.MonitoringConfig, service string) *bool {
+	switch service {
+	case common.ServicePing:
+		return &config.Enabled.Ping
+	case common.ServiceDns:
+		return &config.Enabled.Dns
+	case common.ServiceHttp:
+		return &config.Enabled.Http
+	case common.ServiceSpeedtest:
+		return &config.Enabled.Speedtest
+	case common.ServiceTraceroute:
+		return &config.Enabled.Traceroute
+	case common.ServiceSnmp:
+		return &config.Enabled.Snmp
+	}
+	return nil
 }
 
 // sendMonitoringConfigToSystem sends monitoring configuration to a specific system
-func (h *Hub) sendMonitoringConfigToSystem(systemId string, config system.MonitoringConfig) error {
+func (h *Hub) sendMonitoringConfigToSystem(systemId string, config system.MonitoringConfig, version int64) error {
 	// Find the system in the system manager
 	if h.sm == nil {
 		slog.Debug("System manager is nil", "system", systemId)
@@ -96,7 +136,7 @@ func (h *Hub) sendMonitoringConfigToSystem(systemId string, config system.Monito
 		// Create versioned configuration structure
 		versionedConfig := map[string]interface{}{
 			"config":  config,
-			"version": h.getNextConfigVersion(systemId),
+			"version": version,
 		}
 
 		err := system.WsConn.SendMonitoringConfig(versionedConfig)
@@ -111,13 +151,6 @@ func (h *Hub) sendMonitoringConfigToSystem(systemId string, config system.Monito
 	return nil
 }
 
-// getNextConfigVersion generates the next configuration version for a system
-func (h *Hub) getNextConfigVersion(systemId string) int64 {
-	// Use Unix timestamp (seconds) for more reasonable version numbers
-	// In a production environment, you might want to use a more sophisticated versioning system
-	return time.Now().Unix()
-}
-
 // onSystemRecordUpdate handles system record updates to detect monitoring config changes
 func (h *Hub) onSystemRecordUpdate(e *core.RecordEvent) error {
 	h.Logger().Debug("System record update detected", "system", e.Record.Id)
@@ -139,3 +172,45 @@ func (h *Hub) onSystemRecordUpdate(e *core.RecordEvent) error {
 
 	return e.Next()
 }
+
+// setMonitorPaused returns the handler of POST /api/beszel/systems/{id}/monitors/{service}/pause
+// or /resume, which pauses or resumes the checks of one service while the others keep running.
+// Saving the monitoring configuration has the ConfigurationManager push it to the agent, which
+// stops or restarts the schedule of that service only.
+func (h *Hub) setMonitorPaused(paused bool) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		info, _ := e.RequestInfo()
+		if info.Auth == nil || info.Auth.GetString("role") != "admin" {
+			return apis.NewForbiddenError("Admin access required", nil)
+		}
+
+		systemID := e.Request.PathValue("id")
+		service := e.Request.PathValue("service")
+		if !slices.Contains(common.Services, service) {
+			return apis.NewBadRequestError("Unknown service: "+service, nil)
+		}
+		record, err := h.FindFirstRecordByFilter("monitoring_config", "system = {:system}", dbx.Params{"system": systemID})
+		if err != nil {
+			return apis.NewNotFoundError("Monitoring configuration not found", nil)
+		}
+
+		services := record.GetStringSlice("paused")
+		if paused != slices.Contains(services, service) {
+			if paused {
+				services = append(services, service)
+			} else {
+				services = slices.DeleteFunc(services, func(s string) bool { return s == service })
+			}
+			record.Set("paused", services)
+			if err := h.Save(record); err != nil {
+				return e.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			}
+		}
+
+		return e.JSON(http.StatusOK, map[string]any{
+			"system":  systemID,
+			"service": service,
+			"paused":  paused,
+		})
+	}
+}
@@ -0,0 +1,61 @@
+//go:build testing
+// +build testing
+
+package hub
+
+import (
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonitoringConfigFromRecord(t *testing.T) {
+	testApp, err := tests.NewTestApp()
+	require.NoError(t, err)
+	defer testApp.Cleanup()
+
+	collection, err := testApp.FindCollectionByNameOrId("monitoring_config")
+	require.NoError(t, err)
+	record := core.NewRecord(collection)
+	// empty object and null don't enable their services
+	record.Set("ping", `{}`)
+	record.Set("dns", nil)
+	// targets enable a service without an enabled key
+	record.Set("http", `{"targets": [{"url": "https://example.com"}]}`)
+	// an enabled key overrides the targets
+	record.Set("speedtest", `{"enabled": false, "targets": [{"server_id": "1234"}]}`)
+
+	config, err := monitoringConfigFromRecord(record)
+	require.NoError(t, err)
+	assert.False(t, config.Enabled.Ping)
+	assert.False(t, config.Enabled.Dns)
+	assert.True(t, config.Enabled.Http)
+	assert.Len(t, config.Http.Targets, 1)
+	assert.False(t, config.Enabled.Speedtest)
+	assert.Len(t, config.Speedtest.Targets, 1)
+	assert.False(t, config.CronSeconds)
+	assert.False(t, config.Jitter)
+
+	record.Set("ping", `{"enabled": true}`)
+	record.Set("cron_seconds", true)
+	record.Set("jitter", true)
+	record.Set("dns", `{"targets": "example.com"}`)
+	config, err = monitoringConfigFromRecord(record)
+	assert.ErrorContains(t, err, "dns")
+	assert.True(t, config.Enabled.Ping)
+	assert.False(t, config.Enabled.Dns)
+	assert.True(t, config.Enabled.Http)
+	assert.True(t, config.CronSeconds)
+	assert.True(t, config.Jitter)
+
+	// a paused service is disabled but keeps its targets
+	record.Set("paused", []string{"http"})
+	config, _ = monitoringConfigFromRecord(record)
+	assert.Equal(t, []string{"http"}, config.Paused)
+	assert.False(t, config.Enabled.Http)
+	assert.Len(t, config.Http.Targets, 1)
+	assert.True(t, config.Enabled.Ping)
+}
@@ -0,0 +1,303 @@
+// Package slo computes service level objective compliance from the stats
+// collections and alerts when the error budget burns too fast.
+package slo
+
+import (
+	"beszel/internal/alerts"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// burnRateWindow is the short window used to compute the current burn rate
+const burnRateWindow = time.Hour
+
+// hubLike defines the hub functionality required by the SLO manager
+type hubLike interface {
+	core.App
+	SendAlert(data alerts.AlertMessageData) error
+	MakeLink(parts ...string) string
+}
+
+type Manager struct {
+	hub hubLike
+}
+
+// Definition is an SLO stored in the slos collection
+type Definition struct {
+	Id                string  `db:"id" json:"id"`
+	System            string  `db:"system" json:"system"`
+	Name              string  `db:"name" json:"name"`
+	Metric            string  `db:"metric" json:"metric"`                           // http, dns, ping or speedtest
+	Target            string  `db:"target" json:"target"`                           // Optional target (url, domain, host, server id), empty for all
+	MaxLatency        float64 `db:"max_latency" json:"max_latency"`                 // Optional latency limit in ms for a check to count as good
+	WindowDays        int     `db:"window_days" json:"window_days"`                 // Compliance window
+	Objective         float64 `db:"objective" json:"objective"`                     // Percentage of good checks, e.g. 99.9
+	BurnRateThreshold float64 `db:"burn_rate_threshold" json:"burn_rate_threshold"` // Alert when the hourly burn rate exceeds this, 0 disables
+	Triggered         bool    `db:"triggered" json:"triggered"`
+}
+
+// Compliance is the computed state of an SLO
+type Compliance struct {
+	Definition
+	Total                int     `json:"total"`                  // Checks in the window
+	Good                 int     `json:"good"`                   // Checks meeting the success condition
+	Compliance           float64 `json:"compliance"`             // Percentage of good checks in the window
+	ErrorBudgetRemaining float64 `json:"error_budget_remaining"` // Percentage of error budget left, may be negative
+	BurnRate             float64 `json:"burn_rate"`              // Error budget burn rate over the last hour
+	Met                  bool    `json:"met"`
+}
+
+// metricQuery describes how to count good checks in a stats collection
+type metricQuery struct {
+	collection   string
+	targetColumn string
+	goodExp      string // condition for a good check
+	latencyExp   string // latency column, empty if not applicable
+}
+
+var metricQueries = map[string]metricQuery{
+	"http":      {collection: "http_stats", targetColumn: "url", goodExp: "status = 'success'", latencyExp: "response_time"},
+	"dns":       {collection: "dns_stats", targetColumn: "domain", goodExp: "status = 'success'", latencyExp: "lookup_time"},
+	"ping":      {collection: "ping_stats", targetColumn: "host", goodExp: "packet_loss < 100", latencyExp: "avg_rtt"},
+	"speedtest": {collection: "speedtest_stats", targetColumn: "server_id", goodExp: "status = 'success'", latencyExp: "latency"},
+}
+
+func NewManager(hub hubLike) *Manager {
+	return &Manager{hub: hub}
+}
+
+// ComplianceRatio returns the percentage of good checks, or 100 if there were no checks
+func ComplianceRatio(total, good int) float64 {
+	if total <= 0 {
+		return 100
+	}
+	return float64(good) / float64(total) * 100
+}
+
+// ErrorBudgetRemaining returns the percentage of the error budget left for the given compliance
+func ErrorBudgetRemaining(compliance, objective float64) float64 {
+	budget := 100 - objective
+	if budget <= 0 {
+		if compliance >= 100 {
+			return 100
+		}
+		return 0
+	}
+	return (1 - (100-compliance)/budget) * 100
+}
+
+// BurnRate returns how fast the error budget is consumed: 1 spends exactly
+// the budget over the window, 2 spends it in half the window, and so on.
+func BurnRate(total, good int, objective float64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	budget := (100 - objective) / 100
+	errorRate := float64(total-good) / float64(total)
+	if budget <= 0 {
+		if errorRate > 0 {
+			return math.Inf(1)
+		}
+		return 0
+	}
+	return errorRate / budget
+}
+
+// Compliance computes the current state of all SLOs of a system
+func (m *Manager) Compliance(systemID string) ([]Compliance, error) {
+	definitions, err := m.definitions(dbx.HashExp{"system": systemID})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Compliance, 0, len(definitions))
+	for _, definition := range definitions {
+		result, err := m.compute(definition, time.Now().UTC())
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// compute calculates compliance and burn rate of a single SLO at the given time
+func (m *Manager) compute(definition Definition, now time.Time) (Compliance, error) {
+	result := Compliance{Definition: definition}
+
+	windowDays := max(1, definition.WindowDays)
+	total, good, err := m.count(definition, now.AddDate(0, 0, -windowDays))
+	if err != nil {
+		return result, err
+	}
+	result.Total = total
+	result.Good = good
+	result.Compliance = math.Round(ComplianceRatio(total, good)*1000) / 1000
+	result.ErrorBudgetRemaining = math.Round(ErrorBudgetRemaining(result.Compliance, definition.Objective)*100) / 100
+	result.Met = result.Compliance >= definition.Objective
+
+	recentTotal, recentGood, err := m.count(definition, now.Add(-burnRateWindow))
+	if err != nil {
+		return result, err
+	}
+	result.BurnRate = math.Round(BurnRate(recentTotal, recentGood, definition.Objective)*100) / 100
+
+	return result, nil
+}
+
+// count returns the total and good checks of an SLO since the given time
+func (m *Manager) count(definition Definition, since time.Time) (total, good int, err error) {
+	query, ok := metricQueries[definition.Metric]
+	if !ok {
+		return 0, 0, fmt.Errorf("unknown SLO metric: %s", definition.Metric)
+	}
+
+	goodExp := query.goodExp
+	if definition.MaxLatency > 0 && query.latencyExp != "" {
+		goodExp += fmt.Sprintf(" AND %s <= {:maxLatency}", query.latencyExp)
+	}
+	where := "system = {:system} AND created >= {:since}"
+	if definition.Target != "" {
+		where += fmt.Sprintf(" AND %s = {:target}", query.targetColumn)
+	}
+
+	var counts struct {
+		Total int `db:"total"`
+		Good  int `db:"good"`
+	}
+	err = m.hub.DB().NewQuery(fmt.Sprintf(`
+		SELECT COUNT(*) AS total, COALESCE(SUM(CASE WHEN %s THEN 1 ELSE 0 END), 0) AS good
+		FROM %s
+		WHERE %s
+	`, goodExp, query.collection, where)).Bind(dbx.Params{
+		"system":     definition.System,
+		"since":      since.UTC().Format(types.DefaultDateLayout),
+		"target":     definition.Target,
+		"maxLatency": definition.MaxLatency,
+	}).One(&counts)
+
+	return counts.Total, counts.Good, err
+}
+
+// definitions returns the SLO definitions matching the expression
+func (m *Manager) definitions(exp dbx.Expression) ([]Definition, error) {
+	records, err := m.hub.FindAllRecords("slos", exp)
+	if err != nil {
+		return nil, err
+	}
+	definitions := make([]Definition, 0, len(records))
+	for _, record := range records {
+		definitions = append(definitions, Definition{
+			Id:                record.Id,
+			System:            record.GetString("system"),
+			Name:              record.GetString("name"),
+			Metric:            record.GetString("metric"),
+			Target:            record.GetString("target"),
+			MaxLatency:        record.GetFloat("max_latency"),
+			WindowDays:        record.GetInt("window_days"),
+			Objective:         record.GetFloat("objective"),
+			BurnRateThreshold: record.GetFloat("burn_rate_threshold"),
+			Triggered:         record.GetBool("triggered"),
+		})
+	}
+	return definitions, nil
+}
+
+// CheckBurnRates sends an alert for each SLO whose burn rate crossed its threshold,
+// and a resolved alert once it drops back below
+func (m *Manager) CheckBurnRates() {
+	definitions, err := m.definitions(dbx.NewExp("burn_rate_threshold > 0"))
+	if err != nil {
+		m.hub.Logger().Error("Failed to get SLO definitions", "err", err)
+		return
+	}
+
+	now := time.Now().UTC()
+	for _, definition := range definitions {
+		result, err := m.compute(definition, now)
+		if err != nil {
+			m.hub.Logger().Error("Failed to compute SLO", "slo", definition.Id, "err", err)
+			continue
+		}
+
+		triggered := result.BurnRate > definition.BurnRateThreshold
+		if triggered == definition.Triggered {
+			continue
+		}
+		if err := m.setTriggered(definition.Id, triggered); err != nil {
+			m.hub.Logger().Error("Failed to save SLO", "slo", definition.Id, "err", err)
+			continue
+		}
+		if err := m.sendBurnRateAlert(result, triggered); err != nil {
+			m.hub.Logger().Error("Failed to send SLO alert", "slo", definition.Id, "err", err)
+		}
+	}
+}
+
+// setTriggered stores the alert state of an SLO
+func (m *Manager) setTriggered(id string, triggered bool) error {
+	record, err := m.hub.FindRecordById("slos", id)
+	if err != nil {
+		return err
+	}
+	record.Set("triggered", triggered)
+	return m.hub.SaveNoValidate(record)
+}
+
+// sendBurnRateAlert notifies users that an SLO's error budget burns too fast or recovered
+func (m *Manager) sendBurnRateAlert(result Compliance, triggered bool) error {
+	systemName := result.System
+	if systemRecord, err := m.hub.FindRecordById("systems", result.System); err == nil {
+		systemName = systemRecord.GetString("name")
+	}
+
+	var title string
+	severity := alerts.SeverityNotice
+	if triggered {
+		severity = alerts.SeverityWarning
+		title = fmt.Sprintf("%s SLO %s error budget burning fast", systemName, result.Name)
+	} else {
+		title = fmt.Sprintf("%s SLO %s burn rate recovered", systemName, result.Name)
+	}
+	message := fmt.Sprintf("Burn rate over the last hour is %.2fx (threshold %.2fx). Compliance over %d days is %.3f%% against an objective of %.3f%%, %.2f%% of the error budget remains.",
+		result.BurnRate, result.BurnRateThreshold, max(1, result.WindowDays), result.Compliance, result.Objective, result.ErrorBudgetRemaining)
+
+	return m.hub.SendAlert(alerts.AlertMessageData{
+		Type:     "SLO",
+		Title:    title,
+		Message:  message,
+		Link:     m.hub.MakeLink("system", systemName),
+		LinkText: "View " + systemName,
+		Severity: severity,
+		Resolved: !triggered,
+		Key:      "slo:" + result.Id,
+		System:   systemName,
+		Metric:   &alerts.AlertMetric{Name: "SLO " + result.Name + " burn rate", Value: result.BurnRate, Unit: "x"},
+	})
+}
+
+// GetCompliance handles GET /api/beszel/slo/{systemId}
+func (m *Manager) GetCompliance(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+
+	systemID := e.Request.PathValue("systemId")
+	if _, err := m.hub.FindRecordById("systems", systemID); err != nil {
+		return apis.NewNotFoundError("System not found", nil)
+	}
+
+	results, err := m.Compliance(systemID)
+	if err != nil {
+		return e.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return e.JSON(http.StatusOK, results)
+}
@@ -0,0 +1,152 @@
+//go:build testing
+// +build testing
+
+package slo_test
+
+import (
+	"beszel/internal/alerts"
+	"beszel/internal/hub/slo"
+	"beszel/internal/tests"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// alertRecorder is a test hub that records sent alerts instead of delivering them
+type alertRecorder struct {
+	*tests.TestHub
+	sent []alerts.AlertMessageData
+}
+
+func (h *alertRecorder) SendAlert(data alerts.AlertMessageData) error {
+	h.sent = append(h.sent, data)
+	return nil
+}
+
+func TestComplianceCalculation(t *testing.T) {
+	assert.Equal(t, 100.0, slo.ComplianceRatio(0, 0), "no checks should be fully compliant")
+	assert.Equal(t, 99.0, slo.ComplianceRatio(100, 99))
+	assert.Equal(t, 0.0, slo.ComplianceRatio(10, 0))
+
+	// 99% objective leaves a 1% budget, 99.5% compliance spends half of it
+	assert.InDelta(t, 50.0, slo.ErrorBudgetRemaining(99.5, 99), 0.0001)
+	assert.InDelta(t, 100.0, slo.ErrorBudgetRemaining(100, 99), 0.0001)
+	assert.InDelta(t, -100.0, slo.ErrorBudgetRemaining(98, 99), 0.0001)
+	assert.Equal(t, 100.0, slo.ErrorBudgetRemaining(100, 100))
+	assert.Equal(t, 0.0, slo.ErrorBudgetRemaining(99.9, 100))
+
+	assert.Equal(t, 0.0, slo.BurnRate(0, 0, 99), "no checks should not burn budget")
+	assert.InDelta(t, 1.0, slo.BurnRate(100, 99, 99), 0.0001)
+	assert.InDelta(t, 10.0, slo.BurnRate(10, 9, 99), 0.0001)
+	assert.Equal(t, 0.0, slo.BurnRate(10, 10, 100))
+	assert.True(t, math.IsInf(slo.BurnRate(10, 9, 100), 1))
+}
+
+func TestSLO(t *testing.T) {
+	testHub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer testHub.Cleanup()
+	hub := &alertRecorder{TestHub: testHub}
+	manager := slo.NewManager(hub)
+
+	user, err := tests.CreateUser(hub, "test@test.com", "testtesttest")
+	require.NoError(t, err)
+	system, err := tests.CreateRecord(hub, "systems", map[string]any{
+		"name":  "slo-system",
+		"host":  "localhost",
+		"port":  "45876",
+		"users": []string{user.Id},
+	})
+	require.NoError(t, err)
+
+	definition, err := tests.CreateRecord(hub, "slos", map[string]any{
+		"system":              system.Id,
+		"name":                "homepage",
+		"metric":              "http",
+		"target":              "https://example.com",
+		"max_latency":         500,
+		"window_days":         7,
+		"objective":           99,
+		"burn_rate_threshold": 2,
+	})
+	require.NoError(t, err)
+
+	now := time.Now().UTC()
+	addResult := func(url, status string, responseTime float64, age time.Duration) {
+		record, err := tests.CreateRecord(hub, "http_stats", map[string]any{
+			"system":        system.Id,
+			"url":           url,
+			"status":        status,
+			"response_time": responseTime,
+		})
+		require.NoError(t, err)
+		// autodate fields can't be set through Save
+		_, err = hub.DB().NewQuery("UPDATE http_stats SET created = {:created} WHERE id = {:id}").Bind(map[string]any{
+			"created": now.Add(-age).Format(types.DefaultDateLayout),
+			"id":      record.Id,
+		}).Execute()
+		require.NoError(t, err)
+	}
+
+	// older results in the window: 96 good, 1 failed, 1 too slow
+	for range 96 {
+		addResult("https://example.com", "success", 120, 48*time.Hour)
+	}
+	addResult("https://example.com", "error", 0, 48*time.Hour)
+	addResult("https://example.com", "success", 900, 48*time.Hour)
+	// outside the window and for another target, both ignored
+	addResult("https://example.com", "error", 0, 10*24*time.Hour)
+	addResult("https://other.example.com", "error", 0, time.Hour/2)
+	// two good results in the last hour
+	addResult("https://example.com", "success", 100, 10*time.Minute)
+	addResult("https://example.com", "success", 100, 5*time.Minute)
+
+	t.Run("compliance", func(t *testing.T) {
+		results, err := manager.Compliance(system.Id)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		result := results[0]
+		assert.Equal(t, definition.Id, result.Id)
+		assert.Equal(t, 100, result.Total)
+		assert.Equal(t, 98, result.Good)
+		assert.Equal(t, 98.0, result.Compliance)
+		assert.Equal(t, -100.0, result.ErrorBudgetRemaining)
+		assert.False(t, result.Met)
+		assert.Equal(t, 0.0, result.BurnRate)
+	})
+
+	t.Run("burn rate alert", func(t *testing.T) {
+		manager.CheckBurnRates()
+		assert.Empty(t, hub.sent, "no alert while the recent burn rate is low")
+
+		// one failure out of three recent checks burns the 1% budget 33x faster
+		addResult("https://example.com", "timeout", 0, time.Minute)
+		manager.CheckBurnRates()
+		require.Len(t, hub.sent, 1)
+		assert.Contains(t, hub.sent[0].Title, "slo-system SLO homepage error budget burning fast")
+		assert.Contains(t, hub.sent[0].Message, "33.33x")
+		definition, err = hub.FindRecordById("slos", definition.Id)
+		require.NoError(t, err)
+		assert.True(t, definition.GetBool("triggered"))
+
+		// still burning, no duplicate alert
+		manager.CheckBurnRates()
+		assert.Len(t, hub.sent, 1)
+
+		// move the failure out of the burn rate window
+		_, err = hub.DB().NewQuery("UPDATE http_stats SET created = {:created} WHERE status = 'timeout'").Bind(map[string]any{
+			"created": now.Add(-2 * time.Hour).Format(types.DefaultDateLayout),
+		}).Execute()
+		require.NoError(t, err)
+		manager.CheckBurnRates()
+		require.Len(t, hub.sent, 2)
+		assert.Contains(t, hub.sent[1].Title, "burn rate recovered")
+		definition, err = hub.FindRecordById("slos", definition.Id)
+		require.NoError(t, err)
+		assert.False(t, definition.GetBool("triggered"))
+	})
+}
@@ -0,0 +1,110 @@
+// Package speedtest reports which speedtest servers a system used, so users can
+// see how often auto-selection switches servers and whether to pin one.
+package speedtest
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// defaultRange is how far back the server history goes if it has no start
+const defaultRange = 30 * 24 * time.Hour
+
+type Manager struct {
+	app core.App
+}
+
+// Server is the usage of a speedtest server over a time range
+type Server struct {
+	ServerID    string         `db:"server_id" json:"server_id"`
+	Name        string         `db:"server_name" json:"server_name"`
+	Location    string         `db:"server_location" json:"server_location"`
+	Country     string         `db:"server_country" json:"server_country"`
+	Host        string         `db:"server_host" json:"server_host"`
+	Runs        int            `db:"runs" json:"runs"`                 // Speedtests run against the server
+	Successful  int            `db:"successful" json:"successful"`     // Runs with a successful result
+	AvgDownload float64        `db:"avg_download" json:"avg_download"` // Mbps, successful runs only
+	AvgUpload   float64        `db:"avg_upload" json:"avg_upload"`     // Mbps, successful runs only
+	AvgLatency  float64        `db:"avg_latency" json:"avg_latency"`   // Milliseconds, successful runs only
+	FirstUsed   types.DateTime `db:"first_used" json:"first_used"`
+	LastUsed    types.DateTime `db:"last_used" json:"last_used"`
+}
+
+func NewManager(app core.App) *Manager {
+	return &Manager{app: app}
+}
+
+// GetServers handles GET /api/beszel/systems/{id}/speedtest-servers
+func (m *Manager) GetServers(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+
+	systemID := e.Request.PathValue("id")
+	if _, err := m.app.FindRecordById("systems", systemID); err != nil {
+		return apis.NewNotFoundError("System not found", nil)
+	}
+
+	query := e.Request.URL.Query()
+	to := time.Now().UTC()
+	if value := query.Get("to"); value != "" {
+		t, err := types.ParseDateTime(value)
+		if err != nil {
+			return apis.NewBadRequestError("Invalid to date", nil)
+		}
+		to = t.Time()
+	}
+	from := to.Add(-defaultRange)
+	if value := query.Get("from"); value != "" {
+		t, err := types.ParseDateTime(value)
+		if err != nil {
+			return apis.NewBadRequestError("Invalid from date", nil)
+		}
+		from = t.Time()
+	}
+	if to.Before(from) {
+		return apis.NewBadRequestError("to is before from", nil)
+	}
+
+	servers, err := m.Servers(systemID, from, to)
+	if err != nil {
+		return e.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return e.JSON(http.StatusOK, servers)
+}
+
+// Servers returns the distinct servers the system ran speedtests against between
+// from and to, the most used first
+func (m *Manager) Servers(systemID string, from, to time.Time) ([]Server, error) {
+	servers := []Server{}
+	err := m.app.DB().NewQuery(`
+		SELECT
+			server_id,
+			MAX(server_name) AS server_name,
+			MAX(server_location) AS server_location,
+			MAX(server_country) AS server_country,
+			MAX(server_host) AS server_host,
+			COUNT(*) AS runs,
+			SUM(status = 'success') AS successful,
+			COALESCE(AVG(CASE WHEN status = 'success' THEN download_speed END), 0) AS avg_download,
+			COALESCE(AVG(CASE WHEN status = 'success' AND upload_speed > 0 THEN upload_speed END), 0) AS avg_upload,
+			COALESCE(AVG(CASE WHEN status = 'success' THEN latency END), 0) AS avg_latency,
+			MIN(created) AS first_used,
+			MAX(created) AS last_used
+		FROM speedtest_stats
+		WHERE system = {:system} AND created >= {:from} AND created <= {:to}
+		GROUP BY server_id
+		ORDER BY runs DESC, last_used DESC
+	`).Bind(dbx.Params{
+		"system": systemID,
+		"from":   from.UTC().Format(types.DefaultDateLayout),
+		"to":     to.UTC().Format(types.DefaultDateLayout),
+	}).All(&servers)
+	return servers, err
+}
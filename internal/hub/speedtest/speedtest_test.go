@@ -0,0 +1,76 @@
+//go:build testing
+// +build testing
+
+package speedtest_test
+
+import (
+	"beszel/internal/hub/speedtest"
+	"beszel/internal/tests"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServers(t *testing.T) {
+	hub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer hub.Cleanup()
+
+	user, err := tests.CreateUser(hub, "test@test.com", "testtesttest")
+	require.NoError(t, err)
+	system, err := tests.CreateRecord(hub, "systems", map[string]any{
+		"name":  "web-1",
+		"host":  "127.0.0.1",
+		"port":  "45876",
+		"users": []string{user.Id},
+	})
+	require.NoError(t, err)
+	other, err := tests.CreateRecord(hub, "systems", map[string]any{
+		"name":  "web-2",
+		"host":  "127.0.0.2",
+		"port":  "45876",
+		"users": []string{user.Id},
+	})
+	require.NoError(t, err)
+
+	runs := []map[string]any{
+		{"system": system.Id, "server_id": "52365", "server_name": "Amsterdam", "server_country": "NL", "status": "success", "download_speed": 900, "upload_speed": 400, "latency": 4},
+		{"system": system.Id, "server_id": "52365", "server_name": "Amsterdam", "server_country": "NL", "status": "success", "download_speed": 800, "upload_speed": 300, "latency": 6},
+		{"system": system.Id, "server_id": "52365", "server_name": "Amsterdam", "server_country": "NL", "status": "error"},
+		{"system": system.Id, "server_id": "12345", "server_name": "Frankfurt", "server_country": "DE", "status": "success", "download_speed": 500, "upload_speed": 200, "latency": 12},
+		{"system": other.Id, "server_id": "99999", "server_name": "Paris", "status": "success", "download_speed": 100},
+	}
+	for _, run := range runs {
+		_, err = tests.CreateRecord(hub, "speedtest_stats", run)
+		require.NoError(t, err)
+	}
+
+	manager := speedtest.NewManager(hub)
+	now := time.Now().UTC()
+
+	servers, err := manager.Servers(system.Id, now.Add(-time.Hour), now.Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, servers, 2)
+
+	assert.Equal(t, "52365", servers[0].ServerID)
+	assert.Equal(t, "Amsterdam", servers[0].Name)
+	assert.Equal(t, "NL", servers[0].Country)
+	assert.Equal(t, 3, servers[0].Runs)
+	assert.Equal(t, 2, servers[0].Successful)
+	assert.Equal(t, 850.0, servers[0].AvgDownload)
+	assert.Equal(t, 350.0, servers[0].AvgUpload)
+	assert.Equal(t, 5.0, servers[0].AvgLatency)
+	assert.False(t, servers[0].FirstUsed.IsZero())
+	assert.False(t, servers[0].LastUsed.Time().Before(servers[0].FirstUsed.Time()))
+
+	assert.Equal(t, "12345", servers[1].ServerID)
+	assert.Equal(t, 1, servers[1].Runs)
+	assert.Equal(t, 500.0, servers[1].AvgDownload)
+
+	// nothing was run in the range
+	servers, err = manager.Servers(system.Id, now.Add(-48*time.Hour), now.Add(-24*time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, servers)
+}
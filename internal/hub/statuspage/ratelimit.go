@@ -0,0 +1,34 @@
+package statuspage
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter allows each client a number of requests per fixed window
+type rateLimiter struct {
+	mu       sync.Mutex
+	max      int
+	interval time.Duration
+	start    time.Time      // Start of the current window
+	counts   map[string]int // Requests per client in the current window
+}
+
+func newRateLimiter(max int, interval time.Duration) *rateLimiter {
+	return &rateLimiter{max: max, interval: interval, counts: make(map[string]int)}
+}
+
+// allow counts a request of the client and reports whether it is within the limit
+func (l *rateLimiter) allow(client string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.start) >= l.interval {
+		l.start = now
+		clear(l.counts)
+	}
+	if l.counts[client] >= l.max {
+		return false
+	}
+	l.counts[client]++
+	return true
+}
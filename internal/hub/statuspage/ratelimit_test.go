@@ -0,0 +1,21 @@
+package statuspage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(2, time.Minute)
+	now := time.Now()
+
+	assert.True(t, limiter.allow("1.2.3.4", now))
+	assert.True(t, limiter.allow("1.2.3.4", now))
+	assert.False(t, limiter.allow("1.2.3.4", now.Add(30*time.Second)))
+	// clients are limited separately
+	assert.True(t, limiter.allow("5.6.7.8", now))
+	// the next window starts over
+	assert.True(t, limiter.allow("1.2.3.4", now.Add(time.Minute)))
+}
@@ -0,0 +1,111 @@
+// Package statuspage serves read-only status pages of a set of systems to viewers without an account.
+//
+// Pages are stored in the status_pages collection and are managed by their owner through
+// the collection rules. Anyone with a page's token can read the status and uptime of its
+// systems, so the response holds system names only, never hosts or addresses. The uptime
+// is the one the uptime package stores on the system records.
+package statuspage
+
+import (
+	"beszel/internal/hub/uptime"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+var ErrPageNotFound = errors.New("status page not found")
+
+// Requests a client may make to status pages per rateLimitInterval
+const (
+	rateLimitRequests = 60
+	rateLimitInterval = time.Minute
+)
+
+type Manager struct {
+	app     core.App
+	limiter *rateLimiter
+}
+
+// SystemStatus is the public state of a system on a status page
+type SystemStatus struct {
+	Name   string        `json:"name"`
+	Status string        `json:"status"` // up, down, paused or pending
+	Uptime uptime.Uptime `json:"uptime"` // Percentage of each window the system was up, null without data
+}
+
+// Page is the public view of a status page
+type Page struct {
+	Name    string         `json:"name"`
+	Systems []SystemStatus `json:"systems"`
+	Updated time.Time      `json:"updated"`
+}
+
+func NewManager(app core.App) *Manager {
+	return &Manager{app: app, limiter: newRateLimiter(rateLimitRequests, rateLimitInterval)}
+}
+
+// Page returns the status page with the given token
+func (m *Manager) Page(token string, now time.Time) (*Page, error) {
+	if token == "" {
+		return nil, ErrPageNotFound
+	}
+	record, err := m.app.FindFirstRecordByData("status_pages", "token", token)
+	if err != nil {
+		return nil, ErrPageNotFound
+	}
+
+	systems, err := m.app.FindRecordsByIds("systems", record.GetStringSlice("systems"))
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(systems, func(a, b *core.Record) int {
+		return strings.Compare(a.GetString("name"), b.GetString("name"))
+	})
+
+	page := &Page{
+		Name:    record.GetString("name"),
+		Systems: make([]SystemStatus, 0, len(systems)),
+		Updated: now,
+	}
+	for _, system := range systems {
+		page.Systems = append(page.Systems, SystemStatus{
+			Name:   system.GetString("name"),
+			Status: system.GetString("status"),
+			Uptime: systemUptime(system),
+		})
+	}
+	return page, nil
+}
+
+// systemUptime returns the uptime stored on a system record, with null for missing windows
+func systemUptime(system *core.Record) uptime.Uptime {
+	stored := uptime.Uptime{}
+	_ = system.UnmarshalJSONField("uptime", &stored)
+	result := make(uptime.Uptime, len(uptime.Windows))
+	for _, window := range uptime.Windows {
+		result[window.Key] = stored[window.Key]
+	}
+	return result
+}
+
+// GetPage handles GET /api/beszel/status/{token}, which needs no authentication
+func (m *Manager) GetPage(e *core.RequestEvent) error {
+	if !m.limiter.allow(e.RealIP(), time.Now()) {
+		return apis.NewTooManyRequestsError("Too many requests", nil)
+	}
+
+	page, err := m.Page(e.Request.PathValue("token"), time.Now().UTC())
+	switch {
+	case errors.Is(err, ErrPageNotFound):
+		return apis.NewNotFoundError("Status page not found", nil)
+	case err != nil:
+		m.app.Logger().Error("Failed to build status page", "err", err)
+		return e.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to build status page"})
+	}
+	return e.JSON(http.StatusOK, page)
+}
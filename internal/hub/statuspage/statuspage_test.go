@@ -0,0 +1,107 @@
+//go:build testing
+// +build testing
+
+package statuspage_test
+
+import (
+	"beszel/internal/hub/statuspage"
+	"beszel/internal/hub/uptime"
+	"beszel/internal/tests"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPage(t *testing.T) {
+	hub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer hub.Cleanup()
+
+	owner, err := tests.CreateUser(hub, "owner@test.com", "testtesttest")
+	require.NoError(t, err)
+
+	createSystem := func(name, status string) string {
+		record, err := tests.CreateRecord(hub, "systems", map[string]any{
+			"name":  name,
+			"host":  "10.0.0." + name[:1],
+			"port":  "45876",
+			"users": []string{owner.Id},
+		})
+		require.NoError(t, err)
+		// new systems are always pending until the hub connects
+		_, err = hub.DB().NewQuery("UPDATE systems SET status = {:status} WHERE id = {:id}").Bind(map[string]any{
+			"status": status,
+			"id":     record.Id,
+		}).Execute()
+		require.NoError(t, err)
+		return record.Id
+	}
+	web := createSystem("web", "up")
+	db := createSystem("db", "down")
+	createSystem("internal", "up")
+
+	// the uptime cron stored the uptime of web, db has none yet
+	_, err = hub.DB().NewQuery("UPDATE systems SET uptime = {:uptime} WHERE id = {:id}").Bind(map[string]any{
+		"uptime": `{"24h": 100, "7d": 99.95, "30d": 98.5}`,
+		"id":     web,
+	}).Execute()
+	require.NoError(t, err)
+	now := time.Now().UTC()
+
+	page, err := tests.CreateRecord(hub, "status_pages", map[string]any{
+		"name":    "Public services",
+		"systems": []string{web, db},
+		"owner":   owner.Id,
+	})
+	require.NoError(t, err)
+	token := page.GetString("token")
+	require.Len(t, token, 32)
+
+	manager := statuspage.NewManager(hub)
+
+	t.Run("status and uptime", func(t *testing.T) {
+		result, err := manager.Page(token, now)
+		require.NoError(t, err)
+		assert.Equal(t, "Public services", result.Name)
+		require.Len(t, result.Systems, 2)
+
+		dbStatus, webStatus := result.Systems[0], result.Systems[1]
+		assert.Equal(t, "db", dbStatus.Name)
+		assert.Equal(t, "down", dbStatus.Status)
+		assert.Equal(t, uptime.Uptime{"24h": nil, "7d": nil, "30d": nil}, dbStatus.Uptime)
+
+		assert.Equal(t, "web", webStatus.Name)
+		assert.Equal(t, "up", webStatus.Status)
+		assert.Equal(t, 100.0, *webStatus.Uptime["24h"])
+		assert.Equal(t, 99.95, *webStatus.Uptime["7d"])
+		assert.Equal(t, 98.5, *webStatus.Uptime["30d"])
+	})
+
+	t.Run("unknown token", func(t *testing.T) {
+		_, err := manager.Page("unknowntoken", now)
+		assert.ErrorIs(t, err, statuspage.ErrPageNotFound)
+		_, err = manager.Page("", now)
+		assert.ErrorIs(t, err, statuspage.ErrPageNotFound)
+	})
+
+	t.Run("only admins can change pages", func(t *testing.T) {
+		collection, err := hub.FindCollectionByNameOrId("status_pages")
+		require.NoError(t, err)
+		requestInfo := &core.RequestInfo{Auth: owner, Body: map[string]any{"name": "Everything"}}
+
+		owner.Set("role", "admin")
+		require.NoError(t, hub.Save(owner))
+		canUpdate, err := hub.CanAccessRecord(page, requestInfo, collection.UpdateRule)
+		require.NoError(t, err)
+		assert.True(t, canUpdate)
+
+		owner.Set("role", "user")
+		require.NoError(t, hub.Save(owner))
+		canUpdate, err = hub.CanAccessRecord(page, requestInfo, collection.UpdateRule)
+		require.NoError(t, err)
+		assert.False(t, canUpdate)
+	})
+}
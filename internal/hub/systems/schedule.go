@@ -0,0 +1,80 @@
+package systems
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/robfig/cron/v3"
+)
+
+// scheduleParser parses 5-field cron expressions, optionally prefixed with CRON_TZ=<zone>
+var scheduleParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+
+// activeSchedule is a set of cron expressions matching the minutes a system is expected
+// to be online, e.g. "* 8-18 * * 1-5" for work hours on weekdays. Multiple windows are
+// separated by semicolons or newlines.
+type activeSchedule []cron.Schedule
+
+// parseActiveSchedule parses an active schedule, an empty value is always active
+func parseActiveSchedule(value string) (activeSchedule, error) {
+	var schedule activeSchedule
+	for _, expression := range strings.FieldsFunc(value, func(r rune) bool { return r == ';' || r == '\n' }) {
+		expression = strings.TrimSpace(expression)
+		if expression == "" {
+			continue
+		}
+		window, err := scheduleParser.Parse(expression)
+		if err != nil {
+			return nil, err
+		}
+		schedule = append(schedule, window)
+	}
+	return schedule, nil
+}
+
+// active reports whether the minute of t is in any window of the schedule
+func (s activeSchedule) active(t time.Time) bool {
+	if len(s) == 0 {
+		return true
+	}
+	minute := t.Truncate(time.Minute)
+	for _, window := range s {
+		if window.Next(minute.Add(-time.Second)).Equal(minute) {
+			return true
+		}
+	}
+	return false
+}
+
+// outsideActiveSchedule returns true if the system has an active schedule that doesn't include the current time.
+// Invalid schedules are ignored so a typo doesn't stop monitoring.
+func (sys *System) outsideActiveSchedule(record *core.Record) bool {
+	schedule, err := parseActiveSchedule(record.GetString("active_schedule"))
+	if err != nil {
+		sys.manager.hub.Logger().Warn("Ignoring invalid active schedule", "system", record.GetString("name"), "err", err)
+		return false
+	}
+	return !schedule.active(time.Now())
+}
+
+// pauseForSchedule pauses a system outside its active schedule so it is not marked down
+// and its alerts are deactivated. The system resumes once the schedule is active again.
+func (sys *System) pauseForSchedule(record *core.Record) error {
+	sys.manager.hub.Logger().Info("System paused outside its active schedule", "system", record.GetString("name"))
+	record.Set("schedule_paused", true)
+	record.Set("status", paused)
+	return sys.manager.hub.SaveNoValidate(record)
+}
+
+// resumeSchedule resumes monitoring of a system paused by its active schedule once the
+// schedule is active again. It returns false if the system should stay paused.
+func (sys *System) resumeSchedule() (bool, error) {
+	record, err := sys.getRecord()
+	if err != nil || !record.GetBool("schedule_paused") || sys.outsideActiveSchedule(record) {
+		return false, err
+	}
+	sys.manager.hub.Logger().Info("System resumed in its active schedule", "system", record.GetString("name"))
+	record.Set("status", pending)
+	return true, sys.manager.hub.SaveNoValidate(record)
+}
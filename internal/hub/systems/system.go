@@ -1,12 +1,15 @@
 package systems
 
 import (
+	"beszel/internal/common"
 	"beszel/internal/entities/system"
 	"beszel/internal/hub/ws"
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"math/rand"
+	"slices"
 	"time"
 
 	"github.com/blang/semver"
@@ -15,20 +18,23 @@ import (
 )
 
 type System struct {
-	Id                string               `db:"id"`
-	Host              string               `db:"host"`
-	Status            string               `db:"status"`
-	manager           *SystemManager       // Manager that this system belongs to
-	data              *system.CombinedData // system data from agent
-	ctx               context.Context      // Context for stopping the updater
-	cancel            context.CancelFunc   // Stops and removes system from updater
-	WsConn            *ws.WsConn           // Handler for agent WebSocket connection
-	agentVersion      semver.Version       // Agent version
-	updateTicker      *time.Ticker         // Ticker for updating the system
-	lastPingTime      time.Time            // Track when ping records were last created
-	lastDnsTime       time.Time            // Track when DNS records were last created
-	lastHttpTime      time.Time            // Track when HTTP records were last created
-	lastSpeedtestTime time.Time            // Track when speedtest records were last created
+	Id                 string                   `db:"id"`
+	Host               string                   `db:"host"`
+	Status             string                   `db:"status"`
+	manager            *SystemManager           // Manager that this system belongs to
+	data               *system.CombinedData     // system data from agent
+	ctx                context.Context          // Context for stopping the updater
+	cancel             context.CancelFunc       // Stops and removes system from updater
+	WsConn             *ws.WsConn               // Handler for agent WebSocket connection
+	agentVersion       semver.Version           // Agent version
+	updateTicker       *time.Ticker             // Ticker for updating the system
+	lastPingTime       time.Time                // Track when ping records were last created
+	lastDnsTime        time.Time                // Track when DNS records were last created
+	lastHttpTime       time.Time                // Track when HTTP records were last created
+	lastSpeedtestTime  time.Time                // Track when speedtest records were last created
+	lastTracerouteTime time.Time                // Track when traceroute records were last created
+	lastSnmpTime       time.Time                // Track when SNMP records were last created
+	schedulers         []system.SchedulerStatus // Scheduler health from the agent's latest heartbeat
 }
 
 func (sm *SystemManager) NewSystem(systemId string) *System {
@@ -47,6 +53,14 @@ func (sys *System) StartUpdater() {
 	// Channel that can be used to set the system down. Currently only used to
 	// allow a short delay for reconnection after websocket connection is closed.
 	var downChan chan struct{}
+	// Channel for maintenance mode announcements from the agent
+	var maintenanceChan chan common.MaintenanceRequest
+	// Channel for the agent's heartbeats
+	var heartbeatChan chan common.Heartbeat
+	// Channel for the progress of agent self-updates
+	var updateChan chan common.UpdateStatus
+	// Channel for changes of the agent's public IP
+	var ipChangeChan chan common.IPChange
 
 	// Add random jitter to first WebSocket connection to prevent
 	// clustering if all agents are started at the same time.
@@ -55,6 +69,10 @@ func (sys *System) StartUpdater() {
 		jitter = getJitter()
 		// use the websocket connection's down channel to set the system down
 		downChan = sys.WsConn.DownChan
+		maintenanceChan = sys.WsConn.MaintenanceChan
+		heartbeatChan = sys.WsConn.HeartbeatChan
+		updateChan = sys.WsConn.UpdateChan
+		ipChangeChan = sys.WsConn.IPChangeChan
 	} else {
 		// if the system does not have a websocket connection, wait before updating
 		// to allow the agent to connect via websocket (makes sure fingerprint is set).
@@ -66,7 +84,7 @@ func (sys *System) StartUpdater() {
 		// Add a small delay to allow the WebSocket connection to fully establish
 		time.Sleep(1 * time.Second)
 		if err := sys.update(); err != nil {
-			_ = sys.setDown(err)
+			sys.handleUpdateError(err)
 		}
 	}
 
@@ -80,16 +98,36 @@ func (sys *System) StartUpdater() {
 			return
 		case <-sys.updateTicker.C:
 			if err := sys.update(); err != nil {
-				_ = sys.setDown(err)
+				sys.handleUpdateError(err)
 			}
 		case <-downChan:
 			sys.WsConn = nil
 			downChan = nil
+			maintenanceChan = nil
+			heartbeatChan = nil
+			updateChan = nil
+			ipChangeChan = nil
 			_ = sys.setDown(nil)
+		case request := <-maintenanceChan:
+			if err := sys.setMaintenance(request); err != nil {
+				sys.manager.hub.Logger().Error("Failed to set maintenance", "system", sys.Id, "err", err)
+			}
+		case heartbeat := <-heartbeatChan:
+			if err := sys.handleHeartbeat(heartbeat); err != nil {
+				sys.manager.hub.Logger().Error("Failed to save scheduler health", "system", sys.Id, "err", err)
+			}
+		case status := <-updateChan:
+			if err := sys.handleUpdateStatus(status); err != nil {
+				sys.manager.hub.Logger().Error("Failed to save agent update status", "system", sys.Id, "err", err)
+			}
+		case change := <-ipChangeChan:
+			if err := sys.handleIPChange(change); err != nil {
+				sys.manager.hub.Logger().Error("Failed to save public IP change", "system", sys.Id, "err", err)
+			}
 		case <-jitter:
 			sys.updateTicker.Reset(time.Duration(interval) * time.Millisecond)
 			if err := sys.update(); err != nil {
-				_ = sys.setDown(err)
+				sys.handleUpdateError(err)
 			}
 		}
 	}
@@ -98,9 +136,18 @@ func (sys *System) StartUpdater() {
 // update updates the system data and records.
 func (sys *System) update() error {
 	if sys.Status == paused {
+		if sys.maintenanceExpired() {
+			return sys.endMaintenance()
+		}
+		if resumed, err := sys.resumeSchedule(); resumed || err != nil {
+			return err
+		}
 		sys.handlePaused()
 		return nil
 	}
+	if record, err := sys.getRecord(); err == nil && sys.outsideActiveSchedule(record) {
+		return sys.pauseForSchedule(record)
+	}
 	data, err := sys.fetchDataFromAgent()
 	if err == nil {
 		_, err = sys.createRecords(data)
@@ -108,6 +155,65 @@ func (sys *System) update() error {
 	return err
 }
 
+// handleUpdateError marks the system down after a failed update, unless the agent
+// responded and only saving its data failed
+func (sys *System) handleUpdateError(err error) {
+	var saveErr *saveError
+	if errors.As(err, &saveErr) {
+		sys.manager.hub.Logger().Error("Failed to save system data", "system", sys.Id, "err", err)
+		return
+	}
+	_ = sys.setDown(err)
+}
+
+// saveWithRetry saves a record, retrying with backoff so transient errors like a locked
+// database don't discard results fetched from the agent. The final error is a *saveError.
+func (sys *System) saveWithRetry(record *core.Record, save func(core.Model) error) error {
+	return sys.retrySave(record.Collection().Name, func() error {
+		return save(record)
+	})
+}
+
+// saveAllWithRetry saves new stats records in a single transaction, retrying it like saveWithRetry
+func (sys *System) saveAllWithRetry(records []*core.Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	return sys.retrySave("stats", func() error {
+		return sys.manager.hub.RunInTransaction(func(txApp core.App) error {
+			for _, record := range records {
+				// records saved before a failed attempt was rolled back must be inserted again
+				record.MarkAsNew()
+				if err := txApp.Save(record); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// retrySave runs save until it succeeds, waiting with backoff between the attempts
+func (sys *System) retrySave(collection string, save func() error) error {
+	delay := saveRetryDelay
+	for attempt := 0; ; attempt++ {
+		err := save()
+		if err == nil {
+			return nil
+		}
+		if attempt >= sys.manager.saveRetries {
+			return &saveError{err: err}
+		}
+		sys.manager.hub.Logger().Warn("Retrying failed save", "system", sys.Id, "collection", collection, "attempt", attempt+1, "err", err)
+		select {
+		case <-sys.ctx.Done():
+			return &saveError{err: err}
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
 func (sys *System) handlePaused() {
 	if sys.WsConn == nil {
 		// if the system is paused and there's no websocket connection, remove the system
@@ -129,6 +235,12 @@ func (sys *System) createRecords(data *system.CombinedData) (*core.Record, error
 	}
 	hub := sys.manager.hub
 
+	// Stats records are saved together in a single transaction once all are created,
+	// and the last check times only advance after they were saved
+	var statsRecords []*core.Record
+	lastPingTime, lastDnsTime, lastHttpTime, lastSpeedtestTime := sys.lastPingTime, sys.lastDnsTime, sys.lastHttpTime, sys.lastSpeedtestTime
+	lastTracerouteTime, lastSnmpTime := sys.lastTracerouteTime, sys.lastSnmpTime
+
 	// Create ping_stats records if we have ping data and it's new
 	if data.Stats.PingResults != nil && len(data.Stats.PingResults) > 0 {
 		// Check if we have new ping data by comparing LastChecked times
@@ -156,17 +268,25 @@ func (sys *System) createRecords(data *system.CombinedData) (*core.Record, error
 				pingStatsRecord.Set("min_rtt", result.MinRtt)
 				pingStatsRecord.Set("max_rtt", result.MaxRtt)
 				pingStatsRecord.Set("avg_rtt", result.AvgRtt)
+				pingStatsRecord.Set("quality_index", result.QualityIndex())
+				if result.Mtu > 0 {
+					pingStatsRecord.Set("mtu", result.Mtu)
+				}
+				if result.SmoothedAvgRtt > 0 {
+					pingStatsRecord.Set("smoothed_avg_rtt", result.SmoothedAvgRtt)
+				}
+				pingStatsRecord.Set("address_family", result.AddressFamily)
+				pingStatsRecord.Set("std_dev_rtt", result.StdDevRtt)
+				pingStatsRecord.Set("error_code", result.ErrorCode)
 				// No type field needed - we're storing all raw data
 
-				if err := hub.Save(pingStatsRecord); err != nil {
-					return nil, err
-				}
+				statsRecords = append(statsRecords, pingStatsRecord)
 			}
 
 			// Update the last ping time to the most recent LastChecked time
 			for _, result := range data.Stats.PingResults {
-				if result.LastChecked.After(sys.lastPingTime) {
-					sys.lastPingTime = result.LastChecked
+				if result.LastChecked.After(lastPingTime) {
+					lastPingTime = result.LastChecked
 				}
 			}
 		}
@@ -201,16 +321,23 @@ func (sys *System) createRecords(data *system.CombinedData) (*core.Record, error
 				dnsStatsRecord.Set("status", result.Status)
 				dnsStatsRecord.Set("lookup_time", result.LookupTime)
 				dnsStatsRecord.Set("error_code", result.ErrorCode)
-
-				if err := hub.Save(dnsStatsRecord); err != nil {
-					return nil, err
+				if len(result.Answers) > 0 {
+					dnsStatsRecord.Set("answers", result.Answers)
 				}
+				dnsStatsRecord.Set("ttl", result.TTL)
+				dnsStatsRecord.Set("authenticated", result.Authenticated)
+				if len(result.ServerAnswers) > 0 {
+					dnsStatsRecord.Set("server_answers", result.ServerAnswers)
+				}
+				dnsStatsRecord.Set("source_ip", result.SourceIP)
+
+				statsRecords = append(statsRecords, dnsStatsRecord)
 			}
 
 			// Update the last DNS time to the most recent LastChecked time
 			for _, result := range data.Stats.DnsResults {
-				if result.LastChecked.After(sys.lastDnsTime) {
-					sys.lastDnsTime = result.LastChecked
+				if result.LastChecked.After(lastDnsTime) {
+					lastDnsTime = result.LastChecked
 				}
 			}
 		}
@@ -243,17 +370,44 @@ func (sys *System) createRecords(data *system.CombinedData) (*core.Record, error
 				httpStatsRecord.Set("response_time", result.ResponseTime)
 				httpStatsRecord.Set("status_code", result.StatusCode)
 				httpStatsRecord.Set("error_code", result.ErrorCode)
+				if result.SmoothedResponseTime > 0 {
+					httpStatsRecord.Set("smoothed_response_time", result.SmoothedResponseTime)
+				}
+				httpStatsRecord.Set("tcp_retransmits", result.TcpRetransmits)
+				if result.TcpRttVar > 0 {
+					httpStatsRecord.Set("tcp_rtt_var", result.TcpRttVar)
+				}
+				httpStatsRecord.Set("dns_time", result.DNSTime)
+				httpStatsRecord.Set("connect_time", result.ConnectTime)
+				httpStatsRecord.Set("tls_time", result.TLSTime)
+				httpStatsRecord.Set("ttfb", result.TTFB)
+				httpStatsRecord.Set("total_time", result.TotalTime)
+				if result.CertExpiryDays != nil {
+					httpStatsRecord.Set("cert_expiry_days", *result.CertExpiryDays)
+				}
+				httpStatsRecord.Set("redirect_count", result.RedirectCount)
+				httpStatsRecord.Set("final_url", result.FinalURL)
+				if result.ThroughputMbps > 0 {
+					httpStatsRecord.Set("throughput_mbps", result.ThroughputMbps)
+				}
+				httpStatsRecord.Set("connection_reused", result.ConnectionReused)
+				if result.Proxy != "" {
+					httpStatsRecord.Set("proxy", result.Proxy)
+				}
+				if result.OcspStatus != "" {
+					httpStatsRecord.Set("ocsp_stapled", result.OcspStatus != "none")
+					httpStatsRecord.Set("ocsp_status", result.OcspStatus)
+					httpStatsRecord.Set("sct_present", result.SctPresent)
+				}
 				// No type field needed - we're storing all raw data
 
-				if err := hub.Save(httpStatsRecord); err != nil {
-					return nil, err
-				}
+				statsRecords = append(statsRecords, httpStatsRecord)
 			}
 
 			// Update the last HTTP time to the most recent LastChecked time
 			for _, result := range data.Stats.HttpResults {
-				if result.LastChecked.After(sys.lastHttpTime) {
-					sys.lastHttpTime = result.LastChecked
+				if result.LastChecked.After(lastHttpTime) {
+					lastHttpTime = result.LastChecked
 				}
 			}
 		}
@@ -317,25 +471,124 @@ func (sys *System) createRecords(data *system.CombinedData) (*core.Record, error
 					speedtestStatsRecord.Set("server_host", result.ServerHost)
 					speedtestStatsRecord.Set("server_ip", result.ServerIP)
 
-					if err := hub.Save(speedtestStatsRecord); err != nil {
-						return nil, err
-					}
+					statsRecords = append(statsRecords, speedtestStatsRecord)
 				}
 
 				// Update the last speedtest time to the most recent LastChecked time
 				for _, result := range validResults {
-					if result.LastChecked.After(sys.lastSpeedtestTime) {
-						sys.lastSpeedtestTime = result.LastChecked
+					if result.LastChecked.After(lastSpeedtestTime) {
+						lastSpeedtestTime = result.LastChecked
 					}
 				}
 			}
 		}
 	}
 
+	// Create traceroute_stats records if we have traceroute data and it's new
+	if len(data.Stats.TracerouteResults) > 0 {
+		var hasNewData bool
+		for _, result := range data.Stats.TracerouteResults {
+			if result.LastChecked.After(sys.lastTracerouteTime) {
+				hasNewData = true
+				break
+			}
+		}
+
+		if hasNewData {
+			sys.manager.hub.Logger().Debug("Creating traceroute records", "count", len(data.Stats.TracerouteResults))
+			tracerouteStatsCollection, err := hub.FindCollectionByNameOrId("traceroute_stats")
+			if err != nil {
+				return nil, err
+			}
+
+			// Create a separate record for each traceroute result, with the loss and
+			// latency of the last hop as the ones of the whole path
+			for host, result := range data.Stats.TracerouteResults {
+				tracerouteStatsRecord := core.NewRecord(tracerouteStatsCollection)
+				tracerouteStatsRecord.Set("system", systemRecord.Id)
+				tracerouteStatsRecord.Set("host", host)
+				tracerouteStatsRecord.Set("status", result.Status)
+				tracerouteStatsRecord.Set("tool", result.Tool)
+				tracerouteStatsRecord.Set("error_code", result.ErrorCode)
+				tracerouteStatsRecord.Set("hop_count", len(result.Hops))
+				if len(result.Hops) > 0 {
+					last := result.Hops[len(result.Hops)-1]
+					tracerouteStatsRecord.Set("hops", result.Hops)
+					tracerouteStatsRecord.Set("loss", last.Loss)
+					tracerouteStatsRecord.Set("avg_rtt", last.AvgRtt)
+				}
+
+				statsRecords = append(statsRecords, tracerouteStatsRecord)
+			}
+
+			// Update the last traceroute time to the most recent LastChecked time
+			for _, result := range data.Stats.TracerouteResults {
+				if result.LastChecked.After(lastTracerouteTime) {
+					lastTracerouteTime = result.LastChecked
+				}
+			}
+		}
+	}
+
+	// Create snmp_stats records if we have SNMP data and it's new
+	if len(data.Stats.SnmpResults) > 0 {
+		var hasNewData bool
+		for _, result := range data.Stats.SnmpResults {
+			if result.LastChecked.After(sys.lastSnmpTime) {
+				hasNewData = true
+				break
+			}
+		}
+
+		if hasNewData {
+			sys.manager.hub.Logger().Debug("Creating SNMP records", "count", len(data.Stats.SnmpResults))
+			snmpStatsCollection, err := hub.FindCollectionByNameOrId("snmp_stats")
+			if err != nil {
+				return nil, err
+			}
+
+			// Create a separate record for each polled device
+			for host, result := range data.Stats.SnmpResults {
+				snmpStatsRecord := core.NewRecord(snmpStatsCollection)
+				snmpStatsRecord.Set("system", systemRecord.Id)
+				snmpStatsRecord.Set("host", host)
+				snmpStatsRecord.Set("status", result.Status)
+				snmpStatsRecord.Set("error_code", result.ErrorCode)
+				snmpStatsRecord.Set("poll_time", result.PollTime)
+				if len(result.Values) > 0 {
+					snmpStatsRecord.Set("values", result.Values)
+				}
+
+				statsRecords = append(statsRecords, snmpStatsRecord)
+			}
+
+			// Update the last SNMP time to the most recent LastChecked time
+			for _, result := range data.Stats.SnmpResults {
+				if result.LastChecked.After(lastSnmpTime) {
+					lastSnmpTime = result.LastChecked
+				}
+			}
+		}
+	}
+
+	if err := sys.saveAllWithRetry(statsRecords); err != nil {
+		return nil, err
+	}
+	sys.lastPingTime, sys.lastDnsTime, sys.lastHttpTime, sys.lastSpeedtestTime = lastPingTime, lastDnsTime, lastHttpTime, lastSpeedtestTime
+	sys.lastTracerouteTime, sys.lastSnmpTime = lastTracerouteTime, lastSnmpTime
+
 	// update system record (do this last because it triggers alerts and we need above records to be inserted first)
 	systemRecord.Set("status", up)
+	data.Info.Schedulers = sys.schedulers
+	if sys.WsConn != nil {
+		data.Info.WsRtt = float64(sys.WsConn.RTT().Microseconds()) / 1000
+	}
 	systemRecord.Set("info", data.Info)
-	if err := hub.SaveNoValidate(systemRecord); err != nil {
+	if dropped := uint64(systemRecord.GetInt("dropped_results")); data.Stats.DroppedResults > dropped {
+		hub.Logger().Warn("Agent dropped results that weren't collected in time", "system", systemRecord.Id, "dropped", data.Stats.DroppedResults-dropped)
+	}
+	systemRecord.Set("dropped_results", data.Stats.DroppedResults)
+	if err := sys.saveWithRetry(systemRecord, hub.SaveNoValidate); err != nil {
 		return nil, err
 	}
 
@@ -348,6 +601,39 @@ func (sys *System) createRecords(data *system.CombinedData) (*core.Record, error
 	return systemRecord, nil
 }
 
+// latencyPercentiles returns the 95th and 99th percentile of a latency column over the latest
+// records of a stats collection, counting only the records matching the condition
+func (sys *System) latencyPercentiles(collection, column, condition string) (float64, float64) {
+	var rows []struct {
+		Latency float64 `db:"latency"`
+	}
+	err := sys.manager.hub.DB().NewQuery(fmt.Sprintf(`
+		SELECT %[2]s AS latency
+		FROM (
+			SELECT *
+			FROM %[1]s
+			WHERE system = {:system}
+			ORDER BY created DESC
+			LIMIT {:samples}
+		)
+		WHERE %[3]s
+	`, collection, column, condition)).Bind(dbx.Params{
+		"system":  sys.Id,
+		"samples": sys.manager.AverageSamples(collection),
+	}).All(&rows)
+	if err != nil || len(rows) == 0 {
+		return 0, 0
+	}
+
+	latencies := make([]float64, len(rows))
+	for i, row := range rows {
+		latencies[i] = row.Latency
+	}
+	p95 := math.Round(system.Percentile(latencies, 95)*100) / 100
+	p99 := math.Round(system.Percentile(latencies, 99)*100) / 100
+	return p95, p99
+}
+
 // getRecord retrieves the system record from the database.
 // If the record is not found, it removes the system from the manager.
 func (sys *System) getRecord() (*core.Record, error) {
@@ -370,6 +656,10 @@ func (sys *System) setDown(originalError error) error {
 	if err != nil {
 		return err
 	}
+	// intermittent hosts are expected to be offline outside their active schedule
+	if sys.outsideActiveSchedule(record) {
+		return sys.pauseForSchedule(record)
+	}
 	if originalError != nil {
 		sys.manager.hub.Logger().Error("System down", "system", record.GetString("name"), "err", originalError)
 	}
@@ -377,6 +667,150 @@ func (sys *System) setDown(originalError error) error {
 	return sys.manager.hub.SaveNoValidate(record)
 }
 
+// setMaintenance applies a maintenance announcement from the agent.
+// Entering maintenance pauses the system so it is not marked down and its alerts
+// are deactivated. Leaving maintenance resumes monitoring, but only if the system
+// was paused by maintenance rather than from the hub.
+func (sys *System) setMaintenance(request common.MaintenanceRequest) error {
+	if !request.Enabled {
+		return sys.endMaintenance()
+	}
+	record, err := sys.getRecord()
+	if err != nil {
+		return err
+	}
+	record.Set("maintenance", true)
+	if request.Until > 0 {
+		record.Set("maintenance_until", time.Unix(request.Until, 0).UTC())
+	} else {
+		record.Set("maintenance_until", "")
+	}
+	record.Set("status", paused)
+	sys.manager.hub.Logger().Info("System entered maintenance", "system", record.GetString("name"), "until", record.GetString("maintenance_until"))
+	return sys.manager.hub.SaveNoValidate(record)
+}
+
+// AgentUpdate is the state of the last self-update of a system's agent, stored in agent_update
+type AgentUpdate struct {
+	common.UpdateStatus
+	Updated time.Time `json:"updated"`
+}
+
+// handleUpdateStatus stores the progress of a self-update reported by the agent, so the
+// UI can show whether it succeeded or why it was rolled back
+func (sys *System) handleUpdateStatus(status common.UpdateStatus) error {
+	record, err := sys.getRecord()
+	if err != nil {
+		return err
+	}
+	record.Set("agent_update", AgentUpdate{UpdateStatus: status, Updated: time.Now().UTC()})
+	name := record.GetString("name")
+	switch status.Status {
+	case common.UpdateFailed:
+		sys.manager.hub.Logger().Warn("Agent update failed", "system", name, "version", status.Version, "err", status.Error)
+	case common.UpdateSucceeded:
+		sys.manager.hub.Logger().Info("Agent updated", "system", name, "version", status.Version)
+	}
+	return sys.manager.hub.SaveNoValidate(record)
+}
+
+// ipHistorySize is the number of public IP changes kept in a system's ip_history
+const ipHistorySize = 20
+
+// IPHistoryEntry is a change of a system's public IP, stored in ip_history
+type IPHistoryEntry struct {
+	Old  string    `json:"old"`
+	New  string    `json:"new"`
+	Time time.Time `json:"time"`
+}
+
+// handleIPChange adds a public IP change reported by the agent to the system's ip_history,
+// keeping the latest ipHistorySize changes, and sends an alert about it
+func (sys *System) handleIPChange(change common.IPChange) error {
+	record, err := sys.getRecord()
+	if err != nil {
+		return err
+	}
+	var history []IPHistoryEntry
+	_ = record.UnmarshalJSONField("ip_history", &history)
+	entry := IPHistoryEntry{Old: change.Old, New: change.New, Time: time.Unix(change.Time, 0).UTC()}
+	// an agent reconnecting may report the same change again
+	if len(history) > 0 && history[len(history)-1] == entry {
+		return nil
+	}
+	history = append(history, entry)
+	if len(history) > ipHistorySize {
+		history = history[len(history)-ipHistorySize:]
+	}
+	record.Set("ip_history", history)
+	if err := sys.manager.hub.SaveNoValidate(record); err != nil {
+		return err
+	}
+	sys.manager.hub.Logger().Info("Public IP changed", "system", record.GetString("name"), "old", change.Old, "new", change.New)
+	return sys.manager.hub.HandleIPChangeAlert(record, change.Old, change.New)
+}
+
+// handleHeartbeat keeps the scheduler health reported by the agent. The system record is
+// saved right away only if a scheduler became active or inactive or its error changed,
+// new run times are saved with the next update.
+func (sys *System) handleHeartbeat(heartbeat common.Heartbeat) error {
+	changed := !schedulersEqual(sys.schedulers, heartbeat.Schedulers)
+	sys.schedulers = heartbeat.Schedulers
+	if !changed {
+		return nil
+	}
+	record, err := sys.getRecord()
+	if err != nil {
+		return err
+	}
+	var info system.Info
+	if err := record.UnmarshalJSONField("info", &info); err != nil {
+		return err
+	}
+	info.Schedulers = heartbeat.Schedulers
+	record.Set("info", info)
+	for _, scheduler := range heartbeat.Schedulers {
+		if scheduler.LastError != "" {
+			sys.manager.hub.Logger().Warn("Agent failed to schedule checks", "system", record.GetString("name"), "service", scheduler.Service, "err", scheduler.LastError)
+		}
+		if scheduler.Unavailable != "" {
+			sys.manager.hub.Logger().Warn("Agent can't run checks", "system", record.GetString("name"), "service", scheduler.Service, "reason", scheduler.Unavailable)
+		}
+	}
+	return sys.manager.hub.SaveNoValidate(record)
+}
+
+// schedulersEqual reports whether two heartbeats have the same schedulers with the same state, ignoring run times
+func schedulersEqual(a, b []system.SchedulerStatus) bool {
+	return slices.EqualFunc(a, b, func(x, y system.SchedulerStatus) bool {
+		return x.Service == y.Service && x.Active == y.Active && x.LastError == y.LastError && x.Unavailable == y.Unavailable
+	})
+}
+
+// endMaintenance resumes monitoring of a system paused by maintenance.
+func (sys *System) endMaintenance() error {
+	record, err := sys.getRecord()
+	if err != nil {
+		return err
+	}
+	if !record.GetBool("maintenance") {
+		return nil
+	}
+	sys.manager.hub.Logger().Info("System left maintenance", "system", record.GetString("name"))
+	record.Set("status", pending)
+	return sys.manager.hub.SaveNoValidate(record)
+}
+
+// maintenanceExpired returns true if the system is in maintenance and its expiry has passed.
+func (sys *System) maintenanceExpired() bool {
+	record, err := sys.manager.hub.FindRecordById("systems", sys.Id)
+	if err != nil || !record.GetBool("maintenance") {
+		return false
+	}
+	until := record.GetDateTime("maintenance_until")
+	return !until.IsZero() && until.Time().Before(time.Now())
+}
+
 func (sys *System) getContext() (context.Context, context.CancelFunc) {
 	if sys.ctx == nil {
 		sys.ctx, sys.cancel = context.WithCancel(context.Background())
@@ -425,7 +859,7 @@ func (sys *System) updateCurrentAverages() error {
 
 	sys.manager.hub.Logger().Debug("Calculating current averages", "system", sys.Id)
 
-	// Calculate averages from the last 10 records of each stats table
+	// Calculate averages from the latest records of each stats table, see AverageSamples
 	averages := struct {
 		AP  float64 `json:"ap"`  // Average ping latency
 		APL float64 `json:"apl"` // Average ping packet loss
@@ -435,13 +869,19 @@ func (sys *System) updateCurrentAverages() error {
 		AHF float64 `json:"ahf"` // Average HTTP failure rate
 		ADL float64 `json:"adl"` // Average download speed
 		AUL float64 `json:"aul"` // Average upload speed
+		PP95 float64 `json:"pp95"` // 95th percentile ping latency
+		PP99 float64 `json:"pp99"` // 99th percentile ping latency
+		DP95 float64 `json:"dp95"` // 95th percentile DNS lookup time
+		DP99 float64 `json:"dp99"` // 99th percentile DNS lookup time
+		HP95 float64 `json:"hp95"` // 95th percentile HTTP response time
+		HP99 float64 `json:"hp99"` // 99th percentile HTTP response time
 		LastUpdated string `json:"last_updated"`
 	}{}
 
 	// Get current time for last_updated
 	averages.LastUpdated = time.Now().UTC().Format(time.RFC3339)
 
-	// Calculate ping averages from last 10 records
+	// Calculate ping averages from the latest records
 	pingQuery := sys.manager.hub.DB().NewQuery(`
 		SELECT AVG(avg_rtt) as avg_latency, AVG(packet_loss) as avg_packet_loss
 		FROM (
@@ -449,10 +889,11 @@ func (sys *System) updateCurrentAverages() error {
 			FROM ping_stats 
 			WHERE system = {:system}
 			ORDER BY created DESC
-			LIMIT 10
+			LIMIT {:samples}
 		)
 	`).Bind(dbx.Params{
 		"system": sys.Id,
+		"samples": sys.manager.AverageSamples("ping_stats"),
 	})
 
 	pingResult := struct {
@@ -469,7 +910,7 @@ func (sys *System) updateCurrentAverages() error {
 		}
 	}
 
-	// Calculate DNS averages from last 10 records
+	// Calculate DNS averages from the latest records
 	dnsQuery := sys.manager.hub.DB().NewQuery(`
 		SELECT AVG(lookup_time) as avg_lookup_time,
 		       (COUNT(CASE WHEN status != 'success' THEN 1 END) * 100.0 / COUNT(*)) as failure_rate
@@ -478,10 +919,11 @@ func (sys *System) updateCurrentAverages() error {
 			FROM dns_stats 
 			WHERE system = {:system}
 			ORDER BY created DESC
-			LIMIT 10
+			LIMIT {:samples}
 		)
 	`).Bind(dbx.Params{
 		"system": sys.Id,
+		"samples": sys.manager.AverageSamples("dns_stats"),
 	})
 
 	dnsResult := struct {
@@ -498,7 +940,7 @@ func (sys *System) updateCurrentAverages() error {
 		}
 	}
 
-	// Calculate HTTP averages from last 10 records
+	// Calculate HTTP averages from the latest records
 	httpQuery := sys.manager.hub.DB().NewQuery(`
 		SELECT AVG(response_time) as avg_response_time,
 		       (COUNT(CASE WHEN status != 'success' THEN 1 END) * 100.0 / COUNT(*)) as failure_rate
@@ -507,10 +949,11 @@ func (sys *System) updateCurrentAverages() error {
 			FROM http_stats 
 			WHERE system = {:system}
 			ORDER BY created DESC
-			LIMIT 10
+			LIMIT {:samples}
 		)
 	`).Bind(dbx.Params{
 		"system": sys.Id,
+		"samples": sys.manager.AverageSamples("http_stats"),
 	})
 
 	httpResult := struct {
@@ -527,18 +970,19 @@ func (sys *System) updateCurrentAverages() error {
 		}
 	}
 
-	// Calculate speedtest averages from last 10 records
+	// Calculate speedtest averages from the latest records
 	speedtestQuery := sys.manager.hub.DB().NewQuery(`
-		SELECT AVG(download_speed) as avg_download, AVG(upload_speed) as avg_upload
+		SELECT AVG(download_speed) as avg_download, AVG(NULLIF(upload_speed, 0)) as avg_upload
 		FROM (
 			SELECT download_speed, upload_speed
 			FROM speedtest_stats 
 			WHERE system = {:system} AND status = 'success'
 			ORDER BY created DESC
-			LIMIT 10
+			LIMIT {:samples}
 		)
 	`).Bind(dbx.Params{
 		"system": sys.Id,
+		"samples": sys.manager.AverageSamples("speedtest_stats"),
 	})
 
 	speedtestResult := struct {
@@ -555,11 +999,17 @@ func (sys *System) updateCurrentAverages() error {
 		}
 	}
 
+	// Tail latencies of the same records, leaving out failed checks
+	averages.PP95, averages.PP99 = sys.latencyPercentiles("ping_stats", "avg_rtt", "avg_rtt > 0")
+	averages.DP95, averages.DP99 = sys.latencyPercentiles("dns_stats", "lookup_time", "status = 'success' AND lookup_time > 0")
+	averages.HP95, averages.HP99 = sys.latencyPercentiles("http_stats", "response_time", "status = 'success' AND response_time > 0")
+
 	sys.manager.hub.Logger().Debug("Calculated averages", "system", sys.Id,
 		"ping", averages.AP, "ping_loss", averages.APL,
 		"dns", averages.AD, "dns_failure", averages.ADF,
 		"http", averages.AH, "http_failure", averages.AHF,
-		"download", averages.ADL, "upload", averages.AUL)
+		"download", averages.ADL, "upload", averages.AUL,
+		"ping_p95", averages.PP95, "dns_p95", averages.DP95, "http_p95", averages.HP95)
 
 	// Update the system record with current averages
 	systemCollection, err := sys.manager.hub.FindCollectionByNameOrId("systems")
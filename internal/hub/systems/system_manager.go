@@ -1,10 +1,15 @@
 package systems
 
 import (
+	"beszel/internal/common"
 	"beszel/internal/entities/system"
 	"beszel/internal/hub/ws"
 	"errors"
 	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/blang/semver"
@@ -22,19 +27,61 @@ const (
 	// interval is the default update interval in milliseconds (60 seconds)
 	interval int = 60_000
 	// interval int = 10_000 // Debug interval for faster updates
+
+	// defaultSaveRetries is how many times a failed save of agent data is retried
+	defaultSaveRetries = 3
+
+	// defaultAverageSamples is how many of the latest stats records averages are calculated from
+	defaultAverageSamples = 10
 )
 
+// averageSamplesEnv maps the stats collections to the variable setting their averaging window
+var averageSamplesEnv = map[string]string{
+	"ping_stats":      "BESZEL_HUB_AVERAGE_SAMPLES_PING",
+	"dns_stats":       "BESZEL_HUB_AVERAGE_SAMPLES_DNS",
+	"http_stats":      "BESZEL_HUB_AVERAGE_SAMPLES_HTTP",
+	"speedtest_stats": "BESZEL_HUB_AVERAGE_SAMPLES_SPEEDTEST",
+}
+
+// saveRetryDelay is the wait before the first save retry, doubled for each further retry
+var saveRetryDelay = 100 * time.Millisecond
+
 var (
 	// errSystemExists is returned when attempting to add a system that already exists
 	errSystemExists = errors.New("system exists")
+	// ErrSystemNotFound is returned when a system is not in the store
+	ErrSystemNotFound = errors.New("system not found")
+	// ErrSystemNotConnected is returned when a system has no WebSocket connection to send requests over
+	ErrSystemNotConnected = errors.New("system not connected")
+	// ErrUnknownService is returned when on-demand checks are requested for an unknown service
+	ErrUnknownService = errors.New("unknown service")
+	// ErrInvalidStatus is returned when systems are set to a status other than paused or pending
+	ErrInvalidStatus = errors.New("invalid status")
 )
 
+// saveError is a failure to save data fetched from the agent. Unlike a fetch error,
+// it doesn't mean the system is down.
+type saveError struct {
+	err error
+}
+
+func (e *saveError) Error() string {
+	return "save failed: " + e.err.Error()
+}
+
+func (e *saveError) Unwrap() error {
+	return e.err
+}
+
 // SystemManager manages a collection of monitored systems and their connections.
 // It handles system lifecycle, status updates, and maintains WebSocket connections.
 type SystemManager struct {
-	hub        hubLike                       // Hub interface for database and alert operations
-	systems    *store.Store[string, *System] // Thread-safe store of active systems
-	configSent map[string]bool               // Track which systems have received monitoring config
+	hub         hubLike                       // Hub interface for database and alert operations
+	systems     *store.Store[string, *System] // Thread-safe store of active systems
+	configSent  map[string]bool               // Track which systems have received monitoring config
+	saveRetries int                           // Retries of failed saves before an update gives up
+	// Number of latest records of each stats collection averages are calculated from
+	averageSamples map[string]int
 }
 
 // hubLike defines the interface requirements for the hub dependency.
@@ -43,20 +90,66 @@ type hubLike interface {
 	core.App
 	HandleSystemAlerts(systemRecord *core.Record, data *system.CombinedData) error
 	HandleStatusAlerts(status string, systemRecord *core.Record) error
+	HandleIPChangeAlert(systemRecord *core.Record, oldIP, newIP string) error
 	SendMonitoringConfigToAgent(systemRecord *core.Record) error
 }
 
 // NewSystemManager creates a new SystemManager instance with the provided hub.
 func NewSystemManager(hub hubLike) *SystemManager {
 	sm := &SystemManager{
-		hub:        hub,
-		systems:    store.New(map[string]*System{}),
-		configSent: make(map[string]bool),
+		hub:            hub,
+		systems:        store.New(map[string]*System{}),
+		configSent:     make(map[string]bool),
+		saveRetries:    saveRetriesFromEnv(),
+		averageSamples: averageSamplesFromEnv(),
 	}
 	sm.bindEventHooks()
 	return sm
 }
 
+// saveRetriesFromEnv reads BESZEL_HUB_SAVE_RETRIES, the number of times a failed save of
+// agent data is retried. 0 disables retries.
+func saveRetriesFromEnv() int {
+	value, exists := os.LookupEnv("BESZEL_HUB_SAVE_RETRIES")
+	if !exists {
+		return defaultSaveRetries
+	}
+	retries, err := strconv.Atoi(value)
+	if err != nil || retries < 0 {
+		slog.Warn("Invalid BESZEL_HUB_SAVE_RETRIES, using default", "value", value, "default", defaultSaveRetries)
+		return defaultSaveRetries
+	}
+	return retries
+}
+
+// averageSamplesFromEnv reads the averaging window of each stats collection from
+// BESZEL_HUB_AVERAGE_SAMPLES_<TYPE>, the number of latest records averages are calculated from
+func averageSamplesFromEnv() map[string]int {
+	samples := make(map[string]int, len(averageSamplesEnv))
+	for collection, key := range averageSamplesEnv {
+		samples[collection] = defaultAverageSamples
+		value, exists := os.LookupEnv(key)
+		if !exists {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			slog.Warn("Invalid "+key+", using default", "value", value, "default", defaultAverageSamples)
+			continue
+		}
+		samples[collection] = n
+	}
+	return samples
+}
+
+// AverageSamples returns how many of the latest records of a stats collection averages are calculated from
+func (sm *SystemManager) AverageSamples(collection string) int {
+	if n, ok := sm.averageSamples[collection]; ok {
+		return n
+	}
+	return defaultAverageSamples
+}
+
 // Initialize sets up the system manager by binding event hooks and starting existing systems.
 // It begins monitoring all non-paused systems from the database.
 // Systems are started with staggered delays to prevent overwhelming the hub during startup.
@@ -132,10 +225,17 @@ func (sm *SystemManager) onRecordAfterCreateSuccess(e *core.RecordEvent) error {
 }
 
 // onRecordUpdate is called before a system record is updated in the database.
-// It clears system info when the status is changed to paused.
+// It clears system info when the status is changed to paused, and clears
+// maintenance mode and schedule pauses when the system is no longer paused.
 func (sm *SystemManager) onRecordUpdate(e *core.RecordEvent) error {
 	if e.Record.GetString("status") == paused {
 		e.Record.Set("info", system.Info{})
+	} else {
+		if e.Record.GetBool("maintenance") {
+			e.Record.Set("maintenance", false)
+			e.Record.Set("maintenance_until", "")
+		}
+		e.Record.Set("schedule_paused", false)
 	}
 	return e.Next()
 }
@@ -313,6 +413,104 @@ func (sm *SystemManager) GetSystem(systemID string) (*System, bool) {
 	return sm.systems.GetOk(systemID)
 }
 
+// RunCheckNow asks the agent of a system to run the checks of a service immediately.
+// The results are stored with the next regular update.
+func (sm *SystemManager) RunCheckNow(systemID, service string) error {
+	if !slices.Contains(common.Services, service) {
+		return ErrUnknownService
+	}
+	system, ok := sm.systems.GetOk(systemID)
+	if !ok {
+		return ErrSystemNotFound
+	}
+	if system.WsConn == nil || !system.WsConn.IsConnected() {
+		return ErrSystemNotConnected
+	}
+	return system.WsConn.RunCheckNow(service)
+}
+
+// MeasureAgentLatency pings the agents connected over WebSocket. The round trip times are
+// stored in the system info with the next update, separately from the monitored targets.
+func (sm *SystemManager) MeasureAgentLatency() {
+	for _, system := range sm.systems.Values() {
+		if system.WsConn == nil || !system.WsConn.IsConnected() {
+			continue
+		}
+		if err := system.WsConn.MeasureRTT(); err != nil {
+			sm.hub.Logger().Debug("Failed to ping agent", "system", system.Id, "err", err)
+		}
+	}
+}
+
+// UpdateAgent asks the agent of a system to update its binary to version, or to the latest
+// release if version is empty. The agent reports the progress, see System.handleUpdateStatus.
+func (sm *SystemManager) UpdateAgent(systemID, version string) error {
+	system, ok := sm.systems.GetOk(systemID)
+	if !ok {
+		return ErrSystemNotFound
+	}
+	if system.WsConn == nil || !system.WsConn.IsConnected() {
+		return ErrSystemNotConnected
+	}
+	return system.WsConn.SelfUpdate(version)
+}
+
+// StatusResult is the outcome of setting the status of one system with SetStatus
+type StatusResult struct {
+	Id      string `json:"id"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// SetStatus pauses or resumes the systems with the given IDs, saving them in one transaction.
+// Each saved system goes through onRecordAfterUpdateSuccess once the transaction is committed.
+// Systems that don't exist are reported as failed without holding back the others.
+// If a save fails, nothing is saved and every system that would have changed is reported as failed.
+func (sm *SystemManager) SetStatus(systemIDs []string, status string) ([]StatusResult, error) {
+	if status != paused && status != pending {
+		return nil, ErrInvalidStatus
+	}
+
+	results := make([]StatusResult, len(systemIDs))
+	for i, systemID := range systemIDs {
+		results[i].Id = systemID
+	}
+	changed := make([]int, 0, len(systemIDs))
+	processed := 0
+	err := sm.hub.RunInTransaction(func(txApp core.App) error {
+		for i, systemID := range systemIDs {
+			processed = i + 1
+			record, err := txApp.FindRecordById("systems", systemID)
+			if err != nil {
+				results[i].Error = ErrSystemNotFound.Error()
+				continue
+			}
+			results[i].Success = true
+			if record.GetString("status") == status {
+				continue
+			}
+			changed = append(changed, i)
+			record.Set("status", status)
+			if err := txApp.Save(record); err != nil {
+				return fmt.Errorf("failed to save system %s: %w", systemID, err)
+			}
+		}
+		return nil
+	})
+	// nothing was saved if the transaction failed, so the changed systems were
+	// rolled back and the ones after the failing system were never looked at
+	if err != nil {
+		for _, i := range changed {
+			results[i].Success = false
+			results[i].Error = err.Error()
+		}
+		for i := processed; i < len(results); i++ {
+			results[i].Error = err.Error()
+		}
+	}
+	return results, nil
+}
+
 // HasConfigBeenSent checks if monitoring config has been sent to a system
 func (sm *SystemManager) HasConfigBeenSent(systemID string) bool {
 	return sm.configSent[systemID]
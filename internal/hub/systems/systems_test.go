@@ -4,14 +4,17 @@
 package systems_test
 
 import (
+	"beszel/internal/common"
 	"beszel/internal/entities/system"
 	"beszel/internal/hub/systems"
 	"beszel/internal/tests"
+	"errors"
 	"fmt"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/pocketbase/pocketbase/core"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -394,3 +397,575 @@ func testOld(t *testing.T, hub *tests.TestHub) {
 		assert.NoError(t, err)
 	})
 }
+
+func TestSystemMaintenance(t *testing.T) {
+	hub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer hub.Cleanup()
+	sm := hub.GetSystemManager()
+
+	user, err := tests.CreateUser(hub, "test@test.com", "testtesttest")
+	require.NoError(t, err)
+
+	record, err := tests.CreateRecord(hub, "systems", map[string]any{
+		"name":  "maintenance-system",
+		"host":  "maintenance-host",
+		"users": []string{user.Id},
+	})
+	require.NoError(t, err)
+
+	statusAlert, err := tests.CreateRecord(hub, "alerts", map[string]any{
+		"name":   "Status",
+		"system": record.Id,
+		"user":   user.Id,
+		"min":    1,
+	})
+	require.NoError(t, err)
+
+	require.True(t, sm.SetSystemStatusInDB(record.Id, "up"))
+	assert.Equal(t, "up", sm.GetSystemStatusFromStore(record.Id))
+
+	// mock agent announces maintenance for the next hour
+	until := time.Now().Add(time.Hour).Truncate(time.Second)
+	err = sm.HandleMaintenanceRequest(record.Id, common.MaintenanceRequest{Enabled: true, Until: until.Unix()})
+	require.NoError(t, err)
+
+	record, err = hub.FindRecordById("systems", record.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "paused", record.GetString("status"), "System should be paused during maintenance")
+	assert.True(t, record.GetBool("maintenance"))
+	assert.True(t, until.Equal(record.GetDateTime("maintenance_until").Time()))
+	assert.Equal(t, "paused", sm.GetSystemStatusFromStore(record.Id))
+
+	// agent goes offline during maintenance
+	require.NoError(t, sm.SetSystemDown(record.Id))
+	time.Sleep(10 * time.Millisecond) // Allow goroutines to execute
+
+	record, err = hub.FindRecordById("systems", record.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "paused", record.GetString("status"), "System should not be marked down during maintenance")
+	statusAlert, err = hub.FindRecordById("alerts", statusAlert.Id)
+	require.NoError(t, err)
+	assert.False(t, statusAlert.GetBool("triggered"), "Down alert should not be triggered during maintenance")
+
+	// mock agent leaves maintenance
+	err = sm.HandleMaintenanceRequest(record.Id, common.MaintenanceRequest{Enabled: false})
+	require.NoError(t, err)
+
+	record, err = hub.FindRecordById("systems", record.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "pending", record.GetString("status"), "System should resume after maintenance")
+	assert.False(t, record.GetBool("maintenance"))
+	assert.True(t, record.GetDateTime("maintenance_until").IsZero())
+
+	// leaving maintenance does not resume a system paused from the hub
+	require.True(t, sm.SetSystemStatusInDB(record.Id, "paused"))
+	err = sm.HandleMaintenanceRequest(record.Id, common.MaintenanceRequest{Enabled: false})
+	require.NoError(t, err)
+
+	record, err = hub.FindRecordById("systems", record.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "paused", record.GetString("status"), "Hub-side pause should not be resumed by the agent")
+
+	_ = sm.RemoveSystem(record.Id)
+}
+
+func TestSystemHeartbeat(t *testing.T) {
+	hub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer hub.Cleanup()
+	sm := hub.GetSystemManager()
+
+	user, err := tests.CreateUser(hub, "test@test.com", "testtesttest")
+	require.NoError(t, err)
+	record, err := tests.CreateRecord(hub, "systems", map[string]any{
+		"name":  "heartbeat-system",
+		"host":  "heartbeat-host",
+		"users": []string{user.Id},
+	})
+	require.NoError(t, err)
+	defer sm.RemoveSystem(record.Id)
+	require.True(t, sm.SetSystemStatusInDB(record.Id, "up"))
+
+	getInfo := func() system.Info {
+		record, err := hub.FindRecordById("systems", record.Id)
+		require.NoError(t, err)
+		var info system.Info
+		require.NoError(t, record.UnmarshalJSONField("info", &info))
+		return info
+	}
+
+	// a failing scheduler is saved right away
+	heartbeat := common.Heartbeat{Schedulers: []system.SchedulerStatus{
+		{Service: common.ServicePing, Active: true, LastRun: 100},
+		{Service: common.ServiceDns, LastError: "expected exactly 5 fields, found 1: [bogus]"},
+	}}
+	require.NoError(t, sm.HandleHeartbeat(record.Id, heartbeat))
+	assert.Equal(t, heartbeat.Schedulers, getInfo().Schedulers)
+
+	// new run times wait for the next update
+	heartbeat = common.Heartbeat{Schedulers: []system.SchedulerStatus{
+		{Service: common.ServicePing, Active: true, LastRun: 160},
+		{Service: common.ServiceDns, LastError: "expected exactly 5 fields, found 1: [bogus]"},
+	}}
+	require.NoError(t, sm.HandleHeartbeat(record.Id, heartbeat))
+	assert.EqualValues(t, 100, getInfo().Schedulers[0].LastRun)
+
+	// which keeps the latest heartbeat in the agent's info
+	require.NoError(t, sm.UpdateSystemWithData(record.Id, &system.CombinedData{Info: system.Info{Hostname: "heartbeat-host"}}))
+	info := getInfo()
+	assert.Equal(t, "heartbeat-host", info.Hostname)
+	assert.Equal(t, heartbeat.Schedulers, info.Schedulers)
+}
+
+func TestSystemUpdateStatus(t *testing.T) {
+	hub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer hub.Cleanup()
+	sm := hub.GetSystemManager()
+
+	user, err := tests.CreateUser(hub, "test@test.com", "testtesttest")
+	require.NoError(t, err)
+	record, err := tests.CreateRecord(hub, "systems", map[string]any{
+		"name":  "update-system",
+		"host":  "update-host",
+		"users": []string{user.Id},
+	})
+	require.NoError(t, err)
+	defer sm.RemoveSystem(record.Id)
+	require.True(t, sm.SetSystemStatusInDB(record.Id, "up"))
+
+	// agents can only be updated over WebSocket
+	assert.ErrorIs(t, sm.UpdateAgent(record.Id, "1.2.3"), systems.ErrSystemNotConnected)
+	assert.ErrorIs(t, sm.UpdateAgent("missing", ""), systems.ErrSystemNotFound)
+
+	getUpdate := func() map[string]any {
+		record, err := hub.FindRecordById("systems", record.Id)
+		require.NoError(t, err)
+		var update map[string]any
+		require.NoError(t, record.UnmarshalJSONField("agent_update", &update))
+		return update
+	}
+
+	require.NoError(t, sm.HandleUpdateStatus(record.Id, common.UpdateStatus{Status: common.UpdateRunning, Version: "1.2.3"}))
+	update := getUpdate()
+	assert.Equal(t, "updating", update["status"])
+	assert.Equal(t, "1.2.3", update["version"])
+	assert.NotEmpty(t, update["updated"])
+
+	// the reason of a rollback is kept for the UI
+	require.NoError(t, sm.HandleUpdateStatus(record.Id, common.UpdateStatus{Status: common.UpdateFailed, Version: "1.2.3", Error: "new binary failed to run, restored the previous version"}))
+	update = getUpdate()
+	assert.Equal(t, "failed", update["status"])
+	assert.Equal(t, "new binary failed to run, restored the previous version", update["error"])
+}
+
+func TestSystemIPChange(t *testing.T) {
+	hub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer hub.Cleanup()
+	sm := hub.GetSystemManager()
+
+	user, err := tests.CreateUser(hub, "test@test.com", "testtesttest")
+	require.NoError(t, err)
+	record, err := tests.CreateRecord(hub, "systems", map[string]any{
+		"name":  "ip-system",
+		"host":  "ip-host",
+		"users": []string{user.Id},
+	})
+	require.NoError(t, err)
+	defer sm.RemoveSystem(record.Id)
+	require.True(t, sm.SetSystemStatusInDB(record.Id, "up"))
+
+	getHistory := func() []systems.IPHistoryEntry {
+		record, err := hub.FindRecordById("systems", record.Id)
+		require.NoError(t, err)
+		var history []systems.IPHistoryEntry
+		require.NoError(t, record.UnmarshalJSONField("ip_history", &history))
+		return history
+	}
+
+	change := common.IPChange{Old: "203.0.113.7", New: "203.0.113.8", Time: 1700000000}
+	require.NoError(t, sm.HandleIPChange(record.Id, change))
+	assert.Equal(t, []systems.IPHistoryEntry{{Old: "203.0.113.7", New: "203.0.113.8", Time: time.Unix(1700000000, 0).UTC()}}, getHistory())
+
+	// a change reported again is stored once
+	require.NoError(t, sm.HandleIPChange(record.Id, change))
+	assert.Len(t, getHistory(), 1)
+
+	// only the latest changes are kept
+	for i := range 25 {
+		require.NoError(t, sm.HandleIPChange(record.Id, common.IPChange{Old: "203.0.113.8", New: fmt.Sprintf("198.51.100.%d", i), Time: 1700000001 + int64(i)}))
+	}
+	history := getHistory()
+	assert.Len(t, history, 20)
+	assert.Equal(t, "198.51.100.24", history[19].New)
+	assert.Equal(t, "198.51.100.5", history[0].New)
+}
+
+func TestSystemActiveSchedule(t *testing.T) {
+	hub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer hub.Cleanup()
+	sm := hub.GetSystemManager()
+
+	user, err := tests.CreateUser(hub, "test@test.com", "testtesttest")
+	require.NoError(t, err)
+
+	// a window that never includes the current hour
+	inactiveSchedule := fmt.Sprintf("* %d * * *", (time.Now().Hour()+12)%24)
+	record, err := tests.CreateRecord(hub, "systems", map[string]any{
+		"name":            "laptop",
+		"host":            "laptop-host",
+		"users":           []string{user.Id},
+		"active_schedule": inactiveSchedule,
+	})
+	require.NoError(t, err)
+
+	statusAlert, err := tests.CreateRecord(hub, "alerts", map[string]any{
+		"name":   "Status",
+		"system": record.Id,
+		"user":   user.Id,
+		"min":    1,
+	})
+	require.NoError(t, err)
+
+	require.True(t, sm.SetSystemStatusInDB(record.Id, "up"))
+
+	// agent goes offline outside its active schedule
+	require.NoError(t, sm.SetSystemDown(record.Id))
+	time.Sleep(10 * time.Millisecond) // Allow goroutines to execute
+
+	record, err = hub.FindRecordById("systems", record.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "paused", record.GetString("status"), "System should be paused outside its active schedule")
+	assert.True(t, record.GetBool("schedule_paused"))
+	assert.Equal(t, "paused", sm.GetSystemStatusFromStore(record.Id))
+	statusAlert, err = hub.FindRecordById("alerts", statusAlert.Id)
+	require.NoError(t, err)
+	assert.False(t, statusAlert.GetBool("triggered"), "Down alert should not be triggered outside the active schedule")
+
+	// monitoring resumes once the schedule is active
+	_, err = hub.DB().NewQuery("UPDATE systems SET active_schedule = '* * * * *' WHERE id = {:id}").Bind(map[string]any{
+		"id": record.Id,
+	}).Execute()
+	require.NoError(t, err)
+	require.NoError(t, sm.UpdateSystem(record.Id))
+
+	record, err = hub.FindRecordById("systems", record.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "pending", record.GetString("status"), "System should resume in its active schedule")
+	assert.False(t, record.GetBool("schedule_paused"))
+
+	// inside the schedule, or with an invalid schedule, the system goes down as usual
+	for _, schedule := range []string{"* * * * *", "not a schedule"} {
+		_, err = hub.DB().NewQuery("UPDATE systems SET active_schedule = {:schedule} WHERE id = {:id}").Bind(map[string]any{
+			"schedule": schedule,
+			"id":       record.Id,
+		}).Execute()
+		require.NoError(t, err)
+		require.True(t, sm.SetSystemStatusInDB(record.Id, "up"))
+		require.NoError(t, sm.SetSystemDown(record.Id))
+
+		record, err = hub.FindRecordById("systems", record.Id)
+		require.NoError(t, err)
+		assert.Equal(t, "down", record.GetString("status"), schedule)
+	}
+
+	_ = sm.RemoveSystem(record.Id)
+}
+
+func TestSystemSaveRetry(t *testing.T) {
+	t.Setenv("BESZEL_HUB_SAVE_RETRIES", "2")
+	hub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer hub.Cleanup()
+	sm := hub.GetSystemManager()
+
+	user, err := tests.CreateUser(hub, "test@test.com", "testtesttest")
+	require.NoError(t, err)
+	record, err := tests.CreateRecord(hub, "systems", map[string]any{
+		"name":  "test-system",
+		"host":  "localhost",
+		"users": []string{user.Id},
+	})
+	require.NoError(t, err)
+	require.True(t, sm.SetSystemStatusInDB(record.Id, "up"))
+
+	// fail the given number of ping_stats saves as if the database was locked
+	var failures int
+	hub.OnRecordCreate("ping_stats").BindFunc(func(e *core.RecordEvent) error {
+		if failures > 0 {
+			failures--
+			return errors.New("database is locked")
+		}
+		return e.Next()
+	})
+	countPingStats := func() int64 {
+		count, err := hub.CountRecords("ping_stats")
+		require.NoError(t, err)
+		return count
+	}
+	newData := func() *system.CombinedData {
+		return &system.CombinedData{Stats: system.Stats{PingResults: map[string]*system.PingResult{
+			"1.1.1.1": {Host: "1.1.1.1", AvgRtt: 12.5, LastChecked: time.Now()},
+		}}}
+	}
+
+	t.Run("transient failure succeeds on retry", func(t *testing.T) {
+		failures = 2
+		require.NoError(t, sm.UpdateSystemWithData(record.Id, newData()))
+
+		assert.Equal(t, int64(1), countPingStats())
+		record, err := hub.FindRecordById("systems", record.Id)
+		require.NoError(t, err)
+		assert.Equal(t, "up", record.GetString("status"))
+	})
+
+	t.Run("persistent failure doesn't mark the system down", func(t *testing.T) {
+		failures = 3
+		err := sm.UpdateSystemWithData(record.Id, newData())
+		assert.ErrorContains(t, err, "database is locked")
+
+		assert.Equal(t, int64(1), countPingStats())
+		record, err := hub.FindRecordById("systems", record.Id)
+		require.NoError(t, err)
+		assert.Equal(t, "up", record.GetString("status"))
+	})
+
+	t.Run("fetch failure marks the system down", func(t *testing.T) {
+		require.NoError(t, sm.SetSystemDown(record.Id))
+		record, err := hub.FindRecordById("systems", record.Id)
+		require.NoError(t, err)
+		assert.Equal(t, "down", record.GetString("status"))
+	})
+
+	_ = sm.RemoveSystem(record.Id)
+}
+
+func TestSystemTracerouteRecords(t *testing.T) {
+	hub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer hub.Cleanup()
+	sm := hub.GetSystemManager()
+
+	user, err := tests.CreateUser(hub, "test@test.com", "testtesttest")
+	require.NoError(t, err)
+	record, err := tests.CreateRecord(hub, "systems", map[string]any{
+		"name":  "traceroute-system",
+		"host":  "localhost",
+		"users": []string{user.Id},
+	})
+	require.NoError(t, err)
+	require.True(t, sm.SetSystemStatusInDB(record.Id, "up"))
+	defer sm.RemoveSystem(record.Id)
+
+	checked := time.Now()
+	data := &system.CombinedData{Stats: system.Stats{TracerouteResults: map[string]*system.TracerouteResult{
+		"192.0.2.1": {
+			Host:   "192.0.2.1",
+			Status: "success",
+			Tool:   "mtr",
+			Hops: []system.TracerouteHop{
+				{Hop: 1, Host: "10.0.0.1", Sent: 5, AvgRtt: 0.5},
+				{Hop: 2, Host: "192.0.2.1", Sent: 5, Loss: 20, AvgRtt: 9.5},
+			},
+			LastChecked: checked,
+		},
+		"192.0.2.2": {Host: "192.0.2.2", Status: "error", ErrorCode: "mtr or traceroute not found", LastChecked: checked},
+	}}}
+	require.NoError(t, sm.UpdateSystemWithData(record.Id, data))
+
+	traced, err := hub.FindFirstRecordByFilter("traceroute_stats", "system = {:system} && host = '192.0.2.1'", map[string]any{"system": record.Id})
+	require.NoError(t, err)
+	assert.Equal(t, "success", traced.GetString("status"))
+	assert.Equal(t, "mtr", traced.GetString("tool"))
+	assert.Equal(t, 2, traced.GetInt("hop_count"))
+	assert.Equal(t, 20.0, traced.GetFloat("loss"))
+	assert.Equal(t, 9.5, traced.GetFloat("avg_rtt"))
+	var hops []system.TracerouteHop
+	require.NoError(t, traced.UnmarshalJSONField("hops", &hops))
+	assert.Equal(t, data.Stats.TracerouteResults["192.0.2.1"].Hops, hops)
+
+	failed, err := hub.FindFirstRecordByFilter("traceroute_stats", "system = {:system} && host = '192.0.2.2'", map[string]any{"system": record.Id})
+	require.NoError(t, err)
+	assert.Equal(t, "error", failed.GetString("status"))
+	assert.Equal(t, "mtr or traceroute not found", failed.GetString("error_code"))
+	assert.Zero(t, failed.GetInt("hop_count"))
+
+	// results the hub already stored aren't stored again
+	require.NoError(t, sm.UpdateSystemWithData(record.Id, data))
+	count, err := hub.CountRecords("traceroute_stats")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestSystemRunCheckNow(t *testing.T) {
+	hub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer hub.Cleanup()
+	sm := hub.GetSystemManager()
+
+	user, err := tests.CreateUser(hub, "test@test.com", "testtesttest")
+	require.NoError(t, err)
+
+	record, err := tests.CreateRecord(hub, "systems", map[string]any{
+		"name":  "run-now-system",
+		"host":  "run-now-host",
+		"users": []string{user.Id},
+	})
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, sm.RunCheckNow(record.Id, "portscan"), systems.ErrUnknownService)
+	assert.ErrorIs(t, sm.RunCheckNow("missing", common.ServicePing), systems.ErrSystemNotFound)
+	// the agent hasn't connected yet, so there is no connection to send the request over
+	assert.ErrorIs(t, sm.RunCheckNow(record.Id, common.ServicePing), systems.ErrSystemNotConnected)
+
+	_ = sm.RemoveSystem(record.Id)
+}
+
+func TestSystemSetStatus(t *testing.T) {
+	hub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer hub.Cleanup()
+	sm := hub.GetSystemManager()
+
+	user, err := tests.CreateUser(hub, "test@test.com", "testtesttest")
+	require.NoError(t, err)
+
+	var ids []string
+	for _, name := range []string{"bulk-1", "bulk-2"} {
+		record, err := tests.CreateRecord(hub, "systems", map[string]any{
+			"name":  name,
+			"host":  name + "-host",
+			"users": []string{user.Id},
+		})
+		require.NoError(t, err)
+		ids = append(ids, record.Id)
+	}
+	require.True(t, sm.SetSystemStatusInDB(ids[0], "up"))
+
+	_, err = sm.SetStatus(ids, "down")
+	assert.ErrorIs(t, err, systems.ErrInvalidStatus)
+
+	results, err := sm.SetStatus(append(ids, "missing"), "paused")
+	require.NoError(t, err)
+	assert.Equal(t, []systems.StatusResult{
+		{Id: ids[0], Success: true},
+		{Id: ids[1], Success: true},
+		{Id: "missing", Error: systems.ErrSystemNotFound.Error()},
+	}, results)
+	for _, id := range ids {
+		record, err := hub.FindRecordById("systems", id)
+		require.NoError(t, err)
+		assert.Equal(t, "paused", record.GetString("status"))
+		// the lifecycle hook ran for each system, so its updates only keep the connection alive
+		assert.Equal(t, "paused", sm.GetSystemStatusFromStore(id))
+	}
+
+	results, err = sm.SetStatus(ids, "pending")
+	require.NoError(t, err)
+	for i, id := range ids {
+		assert.True(t, results[i].Success)
+		record, err := hub.FindRecordById("systems", id)
+		require.NoError(t, err)
+		assert.Equal(t, "pending", record.GetString("status"))
+		assert.Equal(t, "pending", sm.GetSystemStatusFromStore(id))
+	}
+
+	for _, id := range ids {
+		_ = sm.RemoveSystem(id)
+	}
+}
+
+func TestSystemSetStatusSaveFailure(t *testing.T) {
+	hub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer hub.Cleanup()
+	sm := hub.GetSystemManager()
+
+	user, err := tests.CreateUser(hub, "test@test.com", "testtesttest")
+	require.NoError(t, err)
+
+	var ids []string
+	for _, name := range []string{"bulk-1", "bulk-2", "bulk-3"} {
+		record, err := tests.CreateRecord(hub, "systems", map[string]any{
+			"name":  name,
+			"host":  name + "-host",
+			"users": []string{user.Id},
+		})
+		require.NoError(t, err)
+		ids = append(ids, record.Id)
+	}
+
+	hub.OnRecordUpdate("systems").BindFunc(func(e *core.RecordEvent) error {
+		if e.Record.Id == ids[1] {
+			return errors.New("save failed")
+		}
+		return e.Next()
+	})
+
+	results, err := sm.SetStatus(ids, "paused")
+	require.NoError(t, err)
+	require.Len(t, results, len(ids))
+	for i, id := range ids {
+		// the first system was rolled back and the last one was never saved
+		assert.Equal(t, id, results[i].Id)
+		assert.False(t, results[i].Success)
+		assert.Contains(t, results[i].Error, "save failed")
+		record, err := hub.FindRecordById("systems", id)
+		require.NoError(t, err)
+		assert.NotEqual(t, "paused", record.GetString("status"))
+	}
+
+	for _, id := range ids {
+		_ = sm.RemoveSystem(id)
+	}
+}
+
+// BenchmarkSaveStatsRecords compares saving the ping stats of 50 targets in a single
+// transaction with saving each record on its own
+func BenchmarkSaveStatsRecords(b *testing.B) {
+	const targets = 50
+	hub, err := tests.NewTestHub(b.TempDir())
+	require.NoError(b, err)
+	defer hub.Cleanup()
+	sm := hub.GetSystemManager()
+
+	user, err := tests.CreateUser(hub, "test@test.com", "testtesttest")
+	require.NoError(b, err)
+	record, err := tests.CreateRecord(hub, "systems", map[string]any{
+		"name":  "test-system",
+		"host":  "localhost",
+		"users": []string{user.Id},
+	})
+	require.NoError(b, err)
+	defer sm.RemoveSystem(record.Id)
+
+	collection, err := hub.FindCollectionByNameOrId("ping_stats")
+	require.NoError(b, err)
+	newRecords := func() []*core.Record {
+		records := make([]*core.Record, targets)
+		for i := range records {
+			records[i] = core.NewRecord(collection)
+			records[i].Set("system", record.Id)
+			records[i].Set("host", fmt.Sprintf("10.0.0.%d", i))
+			records[i].Set("avg_rtt", 12.5)
+		}
+		return records
+	}
+
+	b.Run("transaction", func(b *testing.B) {
+		for b.Loop() {
+			require.NoError(b, sm.SaveStatsRecords(record.Id, newRecords()))
+		}
+	})
+
+	b.Run("individual", func(b *testing.B) {
+		for b.Loop() {
+			for _, record := range newRecords() {
+				require.NoError(b, hub.Save(record))
+			}
+		}
+	})
+}
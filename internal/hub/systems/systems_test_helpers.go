@@ -4,9 +4,13 @@
 package systems
 
 import (
+	"beszel/internal/common"
 	entities "beszel/internal/entities/system"
 	"context"
+	"errors"
 	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
 )
 
 // TESTING ONLY: GetSystemCount returns the number of systems in the store
@@ -101,3 +105,80 @@ func (sm *SystemManager) SetSystemStatusInDB(systemID string, status string) boo
 
 	return true
 }
+
+// TESTING ONLY: HandleMaintenanceRequest applies a maintenance announcement as if sent by the agent
+func (sm *SystemManager) HandleMaintenanceRequest(systemID string, request common.MaintenanceRequest) error {
+	sys, ok := sm.systems.GetOk(systemID)
+	if !ok {
+		return fmt.Errorf("no system")
+	}
+	return sys.setMaintenance(request)
+}
+
+// TESTING ONLY: HandleUpdateStatus applies the progress of an agent self-update as if sent by the agent
+func (sm *SystemManager) HandleUpdateStatus(systemID string, status common.UpdateStatus) error {
+	sys, ok := sm.systems.GetOk(systemID)
+	if !ok {
+		return fmt.Errorf("no system")
+	}
+	return sys.handleUpdateStatus(status)
+}
+
+// TESTING ONLY: HandleIPChange applies a public IP change as if sent by the agent
+func (sm *SystemManager) HandleIPChange(systemID string, change common.IPChange) error {
+	sys, ok := sm.systems.GetOk(systemID)
+	if !ok {
+		return fmt.Errorf("no system")
+	}
+	return sys.handleIPChange(change)
+}
+
+// TESTING ONLY: HandleHeartbeat applies a heartbeat as if sent by the agent
+func (sm *SystemManager) HandleHeartbeat(systemID string, heartbeat common.Heartbeat) error {
+	sys, ok := sm.systems.GetOk(systemID)
+	if !ok {
+		return fmt.Errorf("no system")
+	}
+	return sys.handleHeartbeat(heartbeat)
+}
+
+// TESTING ONLY: SetSystemDown marks a system down as if the agent stopped responding
+func (sm *SystemManager) SetSystemDown(systemID string) error {
+	sys, ok := sm.systems.GetOk(systemID)
+	if !ok {
+		return fmt.Errorf("no system")
+	}
+	return sys.setDown(errors.New("agent unreachable"))
+}
+
+// TESTING ONLY: UpdateSystem runs a single update of a system as if its update ticker fired
+func (sm *SystemManager) UpdateSystem(systemID string) error {
+	sys, ok := sm.systems.GetOk(systemID)
+	if !ok {
+		return fmt.Errorf("no system")
+	}
+	return sys.update()
+}
+
+// TESTING ONLY: UpdateSystemWithData stores data as if it was fetched from the agent,
+// handling errors like the updater does
+func (sm *SystemManager) UpdateSystemWithData(systemID string, data *entities.CombinedData) error {
+	sys, ok := sm.systems.GetOk(systemID)
+	if !ok {
+		return fmt.Errorf("no system")
+	}
+	_, err := sys.createRecords(data)
+	if err != nil {
+		sys.handleUpdateError(err)
+	}
+	return err
+}
+
+// TESTING ONLY: SaveStatsRecords saves new stats records of a system in a single transaction
+func (sm *SystemManager) SaveStatsRecords(systemID string, records []*core.Record) error {
+	sys, ok := sm.systems.GetOk(systemID)
+	if !ok {
+		return fmt.Errorf("no system")
+	}
+	return sys.saveAllWithRetry(records)
+}
@@ -0,0 +1,171 @@
+package tags
+
+import (
+	"beszel/internal/alerts"
+	"cmp"
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// defaultGroupAlertWindow is the time the speedtests of a group alert are averaged over if it has none
+const defaultGroupAlertWindow = time.Hour
+
+// groupAlertMetric describes a speedtest value group alerts can watch
+type groupAlertMetric struct {
+	column string
+	label  string
+	unit   string
+	above  bool   // whether the alert triggers above the threshold instead of below
+	where  string // condition on the speedtests averaged, besides being successful
+}
+
+var groupAlertMetrics = map[string]groupAlertMetric{
+	"download": {column: "download_speed", label: "download", unit: "Mbps"},
+	"upload":   {column: "upload_speed", label: "upload", unit: "Mbps", where: "s.upload_speed > 0"}, // download-only tests have no upload
+	"latency":  {column: "latency", label: "latency", unit: "ms", above: true},
+}
+
+// groupAlert is an alert stored in the group_alerts collection, evaluated once
+// for all systems with its tag
+type groupAlert struct {
+	Id        string
+	Name      string
+	Tag       string
+	Metric    string  // download, upload or latency
+	Threshold float64 // Mbps for speeds, ms for latency
+	Window    time.Duration
+	Triggered bool
+}
+
+// groupAverage is the speedtest average of the systems with a tag
+type groupAverage struct {
+	Value   float64 `db:"value"`
+	Systems int     `db:"systems"` // Systems with successful speedtests in the window
+}
+
+// ValidateGroupAlert requires requests creating a group alert to set a threshold. The collection
+// doesn't, as a required number field would reject a threshold of 0.
+func (m *Manager) ValidateGroupAlert(e *core.RecordRequestEvent) error {
+	info, err := e.RequestInfo()
+	if err != nil {
+		return apis.NewBadRequestError("", err)
+	}
+	if _, ok := info.Body["threshold"]; !ok {
+		return apis.NewBadRequestError("Missing threshold", nil)
+	}
+	return e.Next()
+}
+
+// CheckGroupAlerts sends an alert for each group alert whose average crossed its threshold,
+// and a resolved alert once it is back. Groups without speedtests in the window keep their state.
+func (m *Manager) CheckGroupAlerts() {
+	records, err := m.hub.FindAllRecords("group_alerts")
+	if err != nil {
+		m.hub.Logger().Error("Failed to get group alerts", "err", err)
+		return
+	}
+
+	now := time.Now().UTC()
+	for _, record := range records {
+		alert := groupAlert{
+			Id:        record.Id,
+			Name:      record.GetString("name"),
+			Tag:       record.GetString("tag"),
+			Metric:    record.GetString("metric"),
+			Threshold: record.GetFloat("threshold"),
+			Window:    time.Duration(record.GetInt("window_minutes")) * time.Minute,
+			Triggered: record.GetBool("triggered"),
+		}
+		if alert.Window <= 0 {
+			alert.Window = defaultGroupAlertWindow
+		}
+
+		average, err := m.groupAverage(alert, now)
+		if err != nil {
+			m.hub.Logger().Error("Failed to compute group alert", "alert", alert.Id, "err", err)
+			continue
+		}
+		if average.Systems == 0 {
+			continue
+		}
+
+		metric := groupAlertMetrics[alert.Metric]
+		triggered := average.Value < alert.Threshold
+		if metric.above {
+			triggered = average.Value > alert.Threshold
+		}
+		if triggered == alert.Triggered {
+			continue
+		}
+		record.Set("triggered", triggered)
+		if err := m.hub.SaveNoValidate(record); err != nil {
+			m.hub.Logger().Error("Failed to save group alert", "alert", alert.Id, "err", err)
+			continue
+		}
+		if err := m.sendGroupAlert(alert, average, triggered); err != nil {
+			m.hub.Logger().Error("Failed to send group alert", "alert", alert.Id, "err", err)
+		}
+	}
+}
+
+// groupAverage averages the successful speedtests of each system with the alert's tag in its window,
+// and then the systems, so systems testing more often don't outweigh the others
+func (m *Manager) groupAverage(alert groupAlert, now time.Time) (groupAverage, error) {
+	var average groupAverage
+	metric, ok := groupAlertMetrics[alert.Metric]
+	if !ok {
+		return average, fmt.Errorf("unknown group alert metric: %s", alert.Metric)
+	}
+	err := m.hub.DB().NewQuery(fmt.Sprintf(`
+		SELECT COALESCE(AVG(value), 0) AS value, COUNT(*) AS systems
+		FROM (
+			SELECT AVG(s.%s) AS value
+			FROM speedtest_stats s
+			JOIN systems ON systems.id = s.system
+			WHERE s.status = 'success' AND s.created >= {:since} AND %s AND %s
+			GROUP BY s.system
+		)
+	`, metric.column, cmp.Or(metric.where, "1 = 1"), hasTagCondition("systems.tags"))).Bind(dbx.Params{
+		"tag":   alert.Tag,
+		"since": now.Add(-alert.Window).Format(types.DefaultDateLayout),
+	}).One(&average)
+	return average, err
+}
+
+// sendGroupAlert sends one notification for all systems of a group alert
+func (m *Manager) sendGroupAlert(alert groupAlert, average groupAverage, triggered bool) error {
+	metric := groupAlertMetrics[alert.Metric]
+	direction := "below"
+	if metric.above {
+		direction = "above"
+	}
+
+	var title string
+	severity := alerts.SeverityNotice
+	if triggered {
+		severity = alerts.SeverityWarning
+		title = fmt.Sprintf("%s %s %s threshold", alert.Name, metric.label, direction)
+	} else {
+		title = fmt.Sprintf("%s %s recovered", alert.Name, metric.label)
+	}
+	message := fmt.Sprintf("Average %s of %d systems tagged %s over the last %d minutes is %.2f %s (threshold %.2f %s).",
+		metric.label, average.Systems, alert.Tag, int(alert.Window.Minutes()), average.Value, metric.unit, alert.Threshold, metric.unit)
+
+	return m.hub.SendAlert(alerts.AlertMessageData{
+		Type:     "GroupAlert",
+		Title:    title,
+		Message:  message,
+		Link:     m.hub.MakeLink(),
+		LinkText: "View systems",
+		Severity: severity,
+		Resolved: !triggered,
+		Key:      "group_alert:" + alert.Id,
+		System:   alert.Tag,
+		Metric:   &alerts.AlertMetric{Name: "Average " + metric.label, Value: average.Value, Threshold: alert.Threshold, Unit: metric.unit},
+	})
+}
@@ -0,0 +1,132 @@
+//go:build testing
+// +build testing
+
+package tags_test
+
+import (
+	"beszel/internal/alerts"
+	"beszel/internal/hub/tags"
+	"beszel/internal/tests"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// alertRecorder is a test hub that records sent alerts instead of delivering them
+type alertRecorder struct {
+	*tests.TestHub
+	sent []alerts.AlertMessageData
+}
+
+func (h *alertRecorder) SendAlert(data alerts.AlertMessageData) error {
+	h.sent = append(h.sent, data)
+	return nil
+}
+
+func TestCheckGroupAlerts(t *testing.T) {
+	testHub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer testHub.Cleanup()
+	hub := &alertRecorder{TestHub: testHub}
+	manager := tags.NewManager(hub)
+
+	systems := map[string]string{}
+	for name, systemTags := range map[string][]string{
+		"site-1": {"speed:2G"},
+		"site-2": {"speed:2G", "loc:lab"},
+		"site-3": {"speed:1G"},
+	} {
+		system, err := tests.CreateRecord(hub, "systems", map[string]any{"name": name, "host": name, "port": "45876", "tags": systemTags})
+		require.NoError(t, err)
+		systems[name] = system.Id
+	}
+
+	now := time.Now().UTC()
+	addSpeedtest := func(system, status string, download float64, age time.Duration) {
+		record, err := tests.CreateRecord(hub, "speedtest_stats", map[string]any{
+			"system":         systems[system],
+			"server_id":      "1",
+			"status":         status,
+			"download_speed": download,
+		})
+		require.NoError(t, err)
+		record.SetRaw("created", now.Add(-age).Format(types.DefaultDateLayout))
+		require.NoError(t, hub.SaveNoValidate(record))
+	}
+
+	alert, err := tests.CreateRecord(hub, "group_alerts", map[string]any{
+		"name":           "2G sites",
+		"tag":            "speed:2G",
+		"metric":         "download",
+		"threshold":      1500,
+		"window_minutes": 60,
+	})
+	require.NoError(t, err)
+
+	// no speedtests in the window, nothing to alert on
+	addSpeedtest("site-1", "success", 100, 2*time.Hour)
+	manager.CheckGroupAlerts()
+	assert.Empty(t, hub.sent)
+
+	// site-1 averages 1700, site-2 1000, failed tests and other tags don't count
+	addSpeedtest("site-1", "success", 1600, 10*time.Minute)
+	addSpeedtest("site-1", "success", 1800, 5*time.Minute)
+	addSpeedtest("site-1", "failed", 0, 5*time.Minute)
+	addSpeedtest("site-2", "success", 1000, 5*time.Minute)
+	addSpeedtest("site-3", "success", 10, 5*time.Minute)
+	manager.CheckGroupAlerts()
+	require.Len(t, hub.sent, 1)
+	sent := hub.sent[0]
+	assert.Equal(t, "2G sites download below threshold", sent.Title)
+	assert.Contains(t, sent.Message, "2 systems tagged speed:2G")
+	assert.False(t, sent.Resolved)
+	assert.Equal(t, "group_alert:"+alert.Id, sent.Key)
+	assert.InDelta(t, 1350, sent.Metric.Value, 0.001)
+
+	alert, err = hub.FindRecordById("group_alerts", alert.Id)
+	require.NoError(t, err)
+	assert.True(t, alert.GetBool("triggered"))
+
+	// still below, no repeated notification
+	manager.CheckGroupAlerts()
+	assert.Len(t, hub.sent, 1)
+
+	// recovered
+	addSpeedtest("site-2", "success", 2000, time.Minute)
+	manager.CheckGroupAlerts()
+	require.Len(t, hub.sent, 2)
+	assert.True(t, hub.sent[1].Resolved)
+	assert.Equal(t, "2G sites download recovered", hub.sent[1].Title)
+}
+
+func TestValidateGroupAlert(t *testing.T) {
+	hub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer hub.Cleanup()
+	manager := tags.NewManager(&alertRecorder{TestHub: hub})
+
+	validate := func(body string) error {
+		req := httptest.NewRequest(http.MethodPost, "/api/collections/group_alerts/records", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return manager.ValidateGroupAlert(&core.RecordRequestEvent{
+			RequestEvent: &core.RequestEvent{App: hub, Event: router.Event{Request: req, Response: httptest.NewRecorder()}},
+		})
+	}
+
+	assert.Error(t, validate(`{"name":"lab","tag":"loc:lab","metric":"latency"}`), "a threshold is required")
+	assert.NoError(t, validate(`{"name":"lab","tag":"loc:lab","metric":"latency","threshold":5}`))
+
+	// 0 is a valid threshold, which the collection accepts as well
+	assert.NoError(t, validate(`{"name":"lab","tag":"loc:lab","metric":"latency","threshold":0}`))
+	alert, err := tests.CreateRecord(hub, "group_alerts", map[string]any{"name": "lab", "tag": "loc:lab", "metric": "latency", "threshold": 0})
+	require.NoError(t, err)
+	assert.Zero(t, alert.GetFloat("threshold"))
+}
@@ -0,0 +1,99 @@
+// Package tags filters systems by the tags they are organized with, like "loc:lab",
+// and alerts on the aggregated stats of all systems with a tag.
+package tags
+
+import (
+	"beszel/internal/alerts"
+	"errors"
+	"net/http"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/search"
+)
+
+// maxTagLength is the longest tag that can be filtered by
+const maxTagLength = 100
+
+var ErrForbidden = errors.New("not allowed to list systems")
+
+// hubLike defines the hub functionality required by the tags manager
+type hubLike interface {
+	core.App
+	SendAlert(data alerts.AlertMessageData) error
+	MakeLink(parts ...string) string
+}
+
+type Manager struct {
+	hub hubLike
+}
+
+func NewManager(hub hubLike) *Manager {
+	return &Manager{hub: hub}
+}
+
+// hasTagCondition returns the SQL condition that the JSON array of strings in column contains
+// the tag bound to {:tag}, so the tag can't alter the query
+func hasTagCondition(column string) string {
+	return "EXISTS (SELECT 1 FROM json_each(" + column + ") WHERE json_each.value = {:tag})"
+}
+
+// GetSystems handles GET /api/beszel/systems?tag=loc:lab
+func (m *Manager) GetSystems(e *core.RequestEvent) error {
+	info, err := e.RequestInfo()
+	if err != nil {
+		return apis.NewBadRequestError("", err)
+	}
+	tag := e.Request.URL.Query().Get("tag")
+	if len(tag) > maxTagLength {
+		return apis.NewBadRequestError("Tag is too long", nil)
+	}
+
+	systems, err := m.FindSystems(tag, info)
+	switch {
+	case errors.Is(err, ErrForbidden):
+		return apis.NewForbiddenError("Forbidden", nil)
+	case err != nil:
+		return e.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return e.JSON(http.StatusOK, systems)
+}
+
+// FindSystems returns the systems with the tag that the list rule of the systems collection
+// allows, sorted by name. An empty tag returns all of them.
+func (m *Manager) FindSystems(tag string, info *core.RequestInfo) ([]*core.Record, error) {
+	collection, err := m.hub.FindCachedCollectionByNameOrId("systems")
+	if err != nil {
+		return nil, err
+	}
+
+	query := m.hub.RecordQuery(collection).OrderBy("systems.name ASC")
+	if tag != "" {
+		query.AndWhere(dbx.NewExp(hasTagCondition("[[systems.tags]]"), dbx.Params{"tag": tag}))
+	}
+
+	// same as the list API: a nil rule is for superusers only, an empty rule allows everyone
+	if !info.HasSuperuserAuth() {
+		if collection.ListRule == nil {
+			return nil, ErrForbidden
+		}
+		if *collection.ListRule != "" {
+			resolver := core.NewRecordFieldResolver(m.hub, collection, info, false)
+			expr, err := search.FilterData(*collection.ListRule).BuildExpr(resolver)
+			if err != nil {
+				return nil, err
+			}
+			if err := resolver.UpdateQuery(query); err != nil {
+				return nil, err
+			}
+			query.AndWhere(expr)
+		}
+	}
+
+	systems := []*core.Record{}
+	if err := query.All(&systems); err != nil {
+		return nil, err
+	}
+	return systems, nil
+}
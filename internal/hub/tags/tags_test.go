@@ -0,0 +1,54 @@
+//go:build testing
+// +build testing
+
+package tags_test
+
+import (
+	"beszel/internal/hub/tags"
+	"beszel/internal/tests"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindSystems(t *testing.T) {
+	hub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer hub.Cleanup()
+
+	user, err := tests.CreateUser(hub, "test@test.com", "testtesttest")
+	require.NoError(t, err)
+	for _, system := range []map[string]any{
+		{"name": "lab-2", "host": "127.0.0.2", "tags": []string{"loc:lab", "env:dev"}},
+		{"name": "lab-1", "host": "127.0.0.1", "tags": []string{"loc:lab"}},
+		{"name": "office", "host": "127.0.0.3", "tags": []string{"loc:office"}},
+		{"name": "untagged", "host": "127.0.0.4"},
+	} {
+		system["port"] = "45876"
+		_, err := tests.CreateRecord(hub, "systems", system)
+		require.NoError(t, err)
+	}
+
+	manager := tags.NewManager(hub)
+	auth := &core.RequestInfo{Auth: user}
+	names := func(tag string, info *core.RequestInfo) []string {
+		systems, err := manager.FindSystems(tag, info)
+		require.NoError(t, err)
+		names := []string{}
+		for _, system := range systems {
+			names = append(names, system.GetString("name"))
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"lab-1", "lab-2"}, names("loc:lab", auth))
+	assert.Equal(t, []string{"lab-2"}, names("env:dev", auth))
+	assert.Equal(t, []string{"lab-1", "lab-2", "office", "untagged"}, names("", auth))
+	// tags match exactly and can't alter the query
+	assert.Empty(t, names("loc", auth))
+	assert.Empty(t, names("' OR 1=1 --", auth))
+	// the list rule of systems needs an authenticated user
+	assert.Empty(t, names("loc:lab", &core.RequestInfo{}))
+}
@@ -10,12 +10,17 @@ import (
 	"github.com/spf13/cobra"
 )
 
-// Update updates beszel to the latest version
-func Update(_ *cobra.Command, _ []string) {
+// Update updates beszel to the latest version, including pre-releases
+// if the --prerelease or --channel flag is set
+func Update(cmd *cobra.Command, _ []string) {
+	prerelease, _ := cmd.Flags().GetBool("prerelease")
+	channel, _ := cmd.Flags().GetString("channel")
 	config := ghupdate.Config{
-		Repo:    "svenvg93/lightspeed", // Update this to your repository
-		Current: beszel.Version,
-		Filters: []string{"beszel_"},
+		Repo:            "svenvg93/lightspeed", // Update this to your repository
+		Current:         beszel.Version,
+		Filters:         []string{"beszel_"},
+		AllowPrerelease: prerelease,
+		Channel:         channel,
 	}
 
 	ghupdate.PrintUpdateInfo("beszel", beszel.Version, "")
@@ -54,8 +59,8 @@ func Update(_ *cobra.Command, _ []string) {
 		os.Exit(1)
 	}
 
-	// Perform the update
-	err = ghupdate.UpdateBinary(asset, binaryPath)
+	// Perform the update, verifying the download against the release's checksum
+	err = ghupdate.UpdateBinary(asset, release.FindChecksum(asset), binaryPath)
 	if err != nil {
 		fmt.Printf("Please try rerunning with sudo. Error: %v\n", err)
 		os.Exit(1)
@@ -0,0 +1,45 @@
+package uptime
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRatio(t *testing.T) {
+	end := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+	start := end.Add(-10 * time.Hour)
+	at := func(status string, hoursBeforeEnd float64) transition {
+		created, err := types.ParseDateTime(end.Add(-time.Duration(hoursBeforeEnd * float64(time.Hour))))
+		require.NoError(t, err)
+		return transition{Status: status, Created: created}
+	}
+	percent := func(transitions []transition, current string) any {
+		if r := ratio(transitions, current, start, end); r != nil {
+			return *r
+		}
+		return nil
+	}
+
+	// without transitions the current status counts for the whole window
+	assert.Equal(t, 100.0, percent(nil, "up"))
+	assert.Equal(t, 0.0, percent(nil, "down"))
+	assert.Nil(t, percent(nil, "pending"))
+
+	// down for an hour in the window, the status before the first transition is its opposite
+	assert.Equal(t, 90.0, percent([]transition{at("down", 5), at("up", 4)}, "up"))
+	assert.Equal(t, 40.0, percent([]transition{at("up", 4)}, "up"))
+
+	// the last transition before the window sets the status at its start
+	assert.Equal(t, 20.0, percent([]transition{at("down", 20), at("up", 2)}, "up"))
+	assert.Equal(t, 0.0, percent([]transition{at("up", 30), at("down", 20)}, "paused"))
+
+	// still down at the end of the window
+	assert.Equal(t, 75.0, percent([]transition{at("up", 12), at("down", 2.5)}, "down"))
+
+	// an empty window has no uptime
+	assert.Nil(t, ratio(nil, "up", end, end))
+}
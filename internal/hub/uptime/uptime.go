@@ -0,0 +1,171 @@
+// Package uptime computes the uptime percentages of the systems over rolling windows.
+//
+// The alert manager logs every up and down transition of a system into the status_history
+// collection. The uptime of a window is the time the system was up divided by the time
+// since the start of the window, or since the system was created if that is later. The
+// status at the start of a window is that of the last transition before it. Without one,
+// it is the opposite of the first transition in the window, and without any transitions
+// the system's current status. Pending systems without transitions have no uptime, paused
+// periods count with the status the system had when it was paused.
+package uptime
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// historyRetention is how long transitions are kept, longer than the longest window
+const historyRetention = 90 * 24 * time.Hour
+
+// Windows are the periods uptime is computed for, keyed like the uptime field of systems
+var Windows = []struct {
+	Key      string
+	Duration time.Duration
+}{
+	{"24h", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+	{"30d", 30 * 24 * time.Hour},
+}
+
+// Uptime maps the window keys to the percentage of the window the system was up, null without data
+type Uptime map[string]*float64
+
+type Manager struct {
+	app core.App
+}
+
+// transition is a status_history record
+type transition struct {
+	Status  string         `db:"status"`
+	Created types.DateTime `db:"created"`
+}
+
+func NewManager(app core.App) *Manager {
+	return &Manager{app: app}
+}
+
+// Compute returns the uptime of a system at the given time
+func (m *Manager) Compute(system *core.Record, now time.Time) (Uptime, error) {
+	since := now.Add(-Windows[len(Windows)-1].Duration).UTC().Format(types.DefaultDateLayout)
+	params := dbx.Params{"system": system.Id, "since": since}
+
+	// the last transition before the longest window, then all in it
+	var transitions []transition
+	err := m.app.DB().NewQuery(`
+		SELECT status, created FROM status_history
+		WHERE system = {:system} AND created < {:since}
+		ORDER BY created DESC LIMIT 1
+	`).Bind(params).All(&transitions)
+	if err != nil {
+		return nil, err
+	}
+	var recent []transition
+	err = m.app.DB().NewQuery(`
+		SELECT status, created FROM status_history
+		WHERE system = {:system} AND created >= {:since}
+		ORDER BY created
+	`).Bind(params).All(&recent)
+	if err != nil {
+		return nil, err
+	}
+	transitions = append(transitions, recent...)
+
+	created := system.GetDateTime("created").Time()
+	uptime := make(Uptime, len(Windows))
+	for _, window := range Windows {
+		start := now.Add(-window.Duration)
+		if created.After(start) {
+			start = created
+		}
+		uptime[window.Key] = ratio(transitions, system.GetString("status"), start, now)
+	}
+	return uptime, nil
+}
+
+// ratio returns the percentage of the time from start to end the system was up, rounded to
+// three decimals. transitions are sorted by time, current is the system's current status.
+func ratio(transitions []transition, current string, start, end time.Time) *float64 {
+	if !end.After(start) {
+		return nil
+	}
+
+	// status at the start of the window
+	status := current
+	first := 0
+	for first < len(transitions) && !transitions[first].Created.Time().After(start) {
+		first++
+	}
+	switch {
+	case first > 0:
+		status = transitions[first-1].Status
+	case len(transitions) > 0 && transitions[0].Status == "up":
+		status = "down"
+	case len(transitions) > 0:
+		status = "up"
+	}
+	if status != "up" && status != "down" {
+		return nil
+	}
+
+	var up time.Duration
+	from := start
+	for _, t := range transitions[first:] {
+		at := t.Created.Time()
+		if at.After(end) {
+			break
+		}
+		if status == "up" {
+			up += at.Sub(from)
+		}
+		status, from = t.Status, at
+	}
+	if status == "up" {
+		up += end.Sub(from)
+	}
+
+	percent := math.Round(float64(up)/float64(end.Sub(start))*100000) / 1000
+	return &percent
+}
+
+// UpdateAll stores the current uptime on every system record and deletes transitions older
+// than historyRetention
+func (m *Manager) UpdateAll() {
+	now := time.Now().UTC()
+	systems, err := m.app.FindAllRecords("systems")
+	if err != nil {
+		m.app.Logger().Error("Failed to get systems for uptime", "err", err)
+		return
+	}
+	for _, system := range systems {
+		uptime, err := m.Compute(system, now)
+		if err != nil {
+			m.app.Logger().Error("Failed to compute uptime", "system", system.Id, "err", err)
+			continue
+		}
+		data, err := json.Marshal(uptime)
+		if err != nil {
+			continue
+		}
+		// a plain update, since saving the record runs the system hooks and changes its
+		// updated date, which recovery alerts fall back to for the time a system went down
+		_, err = m.app.DB().NewQuery("UPDATE systems SET uptime = {:uptime} WHERE id = {:id}").Bind(dbx.Params{
+			"uptime": string(data),
+			"id":     system.Id,
+		}).Execute()
+		if err != nil {
+			m.app.Logger().Error("Failed to save uptime", "system", system.Id, "err", err)
+		}
+	}
+
+	_, err = m.app.DB().NewQuery("DELETE FROM status_history WHERE created < {:cutoff}").Bind(dbx.Params{
+		"cutoff": now.Add(-historyRetention).Format(types.DefaultDateLayout),
+	}).Execute()
+	if err != nil {
+		m.app.Logger().Error("Failed to delete old status history", "err", err)
+	}
+}
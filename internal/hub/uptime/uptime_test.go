@@ -0,0 +1,79 @@
+//go:build testing
+// +build testing
+
+package uptime_test
+
+import (
+	"beszel/internal/hub/uptime"
+	"beszel/internal/tests"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateAll(t *testing.T) {
+	hub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer hub.Cleanup()
+
+	user, err := tests.CreateUser(hub, "test@test.com", "testtesttest")
+	require.NoError(t, err)
+	system, err := tests.CreateRecord(hub, "systems", map[string]any{
+		"name":  "uptime-system",
+		"host":  "localhost",
+		"port":  "45876",
+		"users": []string{user.Id},
+	})
+	require.NoError(t, err)
+
+	now := time.Now().UTC()
+	setCreated := func(collection, id string, age time.Duration) {
+		_, err := hub.DB().NewQuery("UPDATE " + collection + " SET created = {:created} WHERE id = {:id}").Bind(map[string]any{
+			"created": now.Add(-age).Format(types.DefaultDateLayout),
+			"id":      id,
+		}).Execute()
+		require.NoError(t, err)
+	}
+	setCreated("systems", system.Id, 60*24*time.Hour)
+
+	// transitions are logged as the status of the system changes
+	changeStatus := func(status string, age time.Duration) {
+		system, err = hub.FindRecordById("systems", system.Id)
+		require.NoError(t, err)
+		system.Set("status", status)
+		require.NoError(t, hub.Save(system))
+		records, err := hub.FindRecordsByFilter("status_history", "system = {:system}", "-created", 1, 0, map[string]any{"system": system.Id})
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+		record := records[0]
+		assert.Equal(t, status, record.GetString("status"))
+		setCreated("status_history", record.Id, age)
+	}
+	// down for a day 100 days ago, then for 12 hours three days ago and for an hour and a half today
+	changeStatus("down", 100*24*time.Hour)
+	changeStatus("up", 99*24*time.Hour)
+	changeStatus("down", 3*24*time.Hour)
+	changeStatus("up", 3*24*time.Hour-12*time.Hour)
+	changeStatus("down", 2*time.Hour)
+	changeStatus("up", 30*time.Minute)
+	_, err = hub.DB().NewQuery("UPDATE systems SET status = 'up' WHERE id = {:id}").Bind(map[string]any{"id": system.Id}).Execute()
+	require.NoError(t, err)
+
+	uptime.NewManager(hub).UpdateAll()
+
+	system, err = hub.FindRecordById("systems", system.Id)
+	require.NoError(t, err)
+	stored := uptime.Uptime{}
+	require.NoError(t, system.UnmarshalJSONField("uptime", &stored))
+	assert.InDelta(t, 93.75, *stored["24h"], 0.01)
+	assert.InDelta(t, 91.964, *stored["7d"], 0.01)
+	assert.InDelta(t, 98.125, *stored["30d"], 0.01)
+
+	// transitions past the retention are deleted
+	count, err := hub.CountRecords("status_history")
+	require.NoError(t, err)
+	assert.EqualValues(t, 4, count)
+}
@@ -3,7 +3,9 @@ package ws
 import (
 	"beszel/internal/common"
 	"beszel/internal/entities/system"
+	"encoding/binary"
 	"errors"
+	"sync/atomic"
 	"time"
 	"weak"
 
@@ -22,9 +24,16 @@ type Handler struct {
 
 // WsConn represents a WebSocket connection to an agent.
 type WsConn struct {
-	conn         *gws.Conn
-	responseChan chan *gws.Message
-	DownChan     chan struct{}
+	conn            *gws.Conn
+	responseChan    chan *gws.Message
+	DownChan        chan struct{}
+	MaintenanceChan chan common.MaintenanceRequest // Maintenance announcements from the agent
+	HeartbeatChan   chan common.Heartbeat          // Scheduler health reported by the agent
+	UpdateChan      chan common.UpdateStatus       // Progress of a self-update reported by the agent
+	IPChangeChan    chan common.IPChange           // Public IP changes reported by the agent
+	signingKey      []byte                         // Key to verify signed system data, nil if verification is off
+	configAck       atomic.Pointer[func(common.ConfigAck)]
+	rtt             atomic.Int64 // Round trip time of the latest answered ping in nanoseconds
 }
 
 // FingerprintRecord is fingerprints collection record data in the hub
@@ -43,16 +52,23 @@ func GetUpgrader() *gws.Upgrader {
 		return upgrader
 	}
 	handler := &Handler{}
-	upgrader = gws.NewUpgrader(handler, &gws.ServerOption{})
+	upgrader = gws.NewUpgrader(handler, &gws.ServerOption{
+		// agents offering permessage-deflate get compressed messages, older agents uncompressed ones
+		PermessageDeflate: gws.PermessageDeflate{Enabled: true},
+	})
 	return upgrader
 }
 
 // NewWsConnection creates a new WebSocket connection wrapper.
 func NewWsConnection(conn *gws.Conn) *WsConn {
 	return &WsConn{
-		conn:         conn,
-		responseChan: make(chan *gws.Message, 1),
-		DownChan:     make(chan struct{}, 1),
+		conn:            conn,
+		responseChan:    make(chan *gws.Message, 1),
+		DownChan:        make(chan struct{}, 1),
+		MaintenanceChan: make(chan common.MaintenanceRequest, 1),
+		HeartbeatChan:   make(chan common.Heartbeat, 1),
+		UpdateChan:      make(chan common.UpdateStatus, 1),
+		IPChangeChan:    make(chan common.IPChange, 1),
 	}
 }
 
@@ -72,6 +88,11 @@ func (h *Handler) OnMessage(conn *gws.Conn, message *gws.Message) {
 		_ = conn.WriteClose(1000, nil)
 		return
 	}
+	// messages initiated by the agent are not responses to a request
+	if isAgentMessage(message.Data.Bytes()) {
+		wsConn.(*WsConn).handleAgentMessage(message)
+		return
+	}
 	select {
 	case wsConn.(*WsConn).responseChan <- message:
 	default:
@@ -80,6 +101,103 @@ func (h *Handler) OnMessage(conn *gws.Conn, message *gws.Message) {
 	}
 }
 
+// OnPong records the round trip time of pings sent by MeasureRTT, whose payload is the time they were sent.
+func (h *Handler) OnPong(conn *gws.Conn, payload []byte) {
+	conn.SetDeadline(time.Now().Add(deadline))
+	if len(payload) != 8 {
+		return
+	}
+	wsConn, ok := conn.Session().Load("wsConn")
+	if !ok {
+		return
+	}
+	sent := time.Unix(0, int64(binary.BigEndian.Uint64(payload)))
+	if rtt := time.Since(sent); rtt >= 0 {
+		wsConn.(*WsConn).rtt.Store(int64(rtt))
+	}
+}
+
+// isAgentMessage reports whether the data is a tagged message initiated by the agent
+func isAgentMessage(data []byte) bool {
+	// CBOR major type 6 is a tagged item, responses are untagged maps
+	return len(data) > 0 && data[0]>>5 == 6
+}
+
+// handleAgentMessage decodes a message initiated by the agent and routes it by action.
+func (ws *WsConn) handleAgentMessage(message *gws.Message) {
+	defer message.Close()
+
+	var tag cbor.RawTag
+	if err := cbor.Unmarshal(message.Data.Bytes(), &tag); err != nil || tag.Number != common.AgentMessageTag {
+		return
+	}
+	var msg common.AgentMessage[cbor.RawMessage]
+	if err := cbor.Unmarshal(tag.Content, &msg); err != nil {
+		return
+	}
+
+	switch msg.Action {
+	case common.SetMaintenance:
+		var request common.MaintenanceRequest
+		if err := cbor.Unmarshal(msg.Data, &request); err != nil {
+			return
+		}
+		// only the latest announcement matters if the previous one was not handled yet
+		select {
+		case <-ws.MaintenanceChan:
+		default:
+		}
+		ws.MaintenanceChan <- request
+	case common.AcknowledgeConfig:
+		var ack common.ConfigAck
+		if err := cbor.Unmarshal(msg.Data, &ack); err != nil {
+			return
+		}
+		if handler := ws.configAck.Load(); handler != nil {
+			(*handler)(ack)
+		}
+	case common.ReportHeartbeat:
+		var heartbeat common.Heartbeat
+		if err := cbor.Unmarshal(msg.Data, &heartbeat); err != nil {
+			return
+		}
+		// only the latest heartbeat matters if the previous one was not handled yet
+		select {
+		case <-ws.HeartbeatChan:
+		default:
+		}
+		ws.HeartbeatChan <- heartbeat
+	case common.ReportUpdate:
+		var status common.UpdateStatus
+		if err := cbor.Unmarshal(msg.Data, &status); err != nil {
+			return
+		}
+		// only the latest state matters if the previous one was not handled yet
+		select {
+		case <-ws.UpdateChan:
+		default:
+		}
+		ws.UpdateChan <- status
+	case common.ReportIPChange:
+		var change common.IPChange
+		if err := cbor.Unmarshal(msg.Data, &change); err != nil {
+			return
+		}
+		// the latest change holds the current IP if the previous one was not handled yet
+		select {
+		case <-ws.IPChangeChan:
+		default:
+		}
+		ws.IPChangeChan <- change
+	}
+}
+
+// OnConfigAck sets the function receiving the agent's acknowledgements of monitoring configurations.
+// It is called from the connection's read loop, so it must not block.
+func (ws *WsConn) OnConfigAck(handler func(common.ConfigAck)) {
+	ws.configAck.Store(&handler)
+}
+
 // OnClose handles WebSocket connection closures and triggers system down status after delay.
 func (h *Handler) OnClose(conn *gws.Conn, err error) {
 	wsConn, ok := conn.Session().Load("wsConn")
@@ -111,6 +229,22 @@ func (ws *WsConn) Ping() error {
 	return ws.conn.WritePing(nil)
 }
 
+// MeasureRTT sends a ping carrying the current time. The agent echoes it in its pong,
+// which records the round trip time returned by RTT.
+func (ws *WsConn) MeasureRTT() error {
+	conn := ws.conn
+	if conn == nil {
+		return gws.ErrConnClosed
+	}
+	payload := binary.BigEndian.AppendUint64(nil, uint64(time.Now().UnixNano()))
+	return conn.WritePing(payload)
+}
+
+// RTT returns the round trip time of the latest ping answered by the agent, zero if none was answered.
+func (ws *WsConn) RTT() time.Duration {
+	return time.Duration(ws.rtt.Load())
+}
+
 // sendMessage encodes data to CBOR and sends it as a binary message to the agent.
 func (ws *WsConn) sendMessage(data common.HubRequest[any]) error {
 	if ws.conn == nil {
@@ -123,13 +257,23 @@ func (ws *WsConn) sendMessage(data common.HubRequest[any]) error {
 	return ws.conn.WriteMessage(gws.OpcodeBinary, bytes)
 }
 
+// SetSigningKey enables verification of system data signed by the agent.
+// Unsigned or tampered data is rejected once a key is set.
+func (ws *WsConn) SetSigningKey(key []byte) {
+	ws.signingKey = key
+}
+
 // RequestSystemData requests system metrics from the agent and unmarshals the response.
 func (ws *WsConn) RequestSystemData(data *system.CombinedData) error {
 	var message *gws.Message
 
-	ws.sendMessage(common.HubRequest[any]{
+	request := common.HubRequest[any]{
 		Action: common.GetData,
-	})
+	}
+	if ws.signingKey != nil {
+		request.Data = common.DataRequest{Signed: true}
+	}
+	ws.sendMessage(request)
 	select {
 	case <-time.After(10 * time.Second):
 		ws.Close(nil)
@@ -154,7 +298,22 @@ func (ws *WsConn) RequestSystemData(data *system.CombinedData) error {
 		data.Stats.SpeedtestResults = nil
 	}
 	
-	return cbor.Unmarshal(message.Data.Bytes(), data)
+	return decodeSystemData(message.Data.Bytes(), ws.signingKey, data)
+}
+
+// decodeSystemData unmarshals system data, verifying its signature first if a key is set.
+func decodeSystemData(payload []byte, signingKey []byte, data *system.CombinedData) error {
+	if signingKey == nil {
+		return cbor.Unmarshal(payload, data)
+	}
+	var signed common.SignedData
+	if err := cbor.Unmarshal(payload, &signed); err != nil {
+		return common.ErrInvalidSignature
+	}
+	if err := signed.Verify(signingKey); err != nil {
+		return err
+	}
+	return cbor.Unmarshal(signed.Data, data)
 }
 
 // SendMonitoringConfig sends unified monitoring configuration to the agent.
@@ -165,6 +324,24 @@ func (ws *WsConn) SendMonitoringConfig(config interface{}) error {
 	})
 }
 
+// RunCheckNow asks the agent to run the checks of a service immediately. The results
+// are collected with the next system data request, the agent sends no response.
+func (ws *WsConn) RunCheckNow(service string) error {
+	return ws.sendMessage(common.HubRequest[any]{
+		Action: common.RunCheckNow,
+		Data:   common.RunCheckRequest{Service: service},
+	})
+}
+
+// SelfUpdate asks the agent to update its binary to version, or to the latest release if
+// version is empty. The agent reports the progress with agent messages on UpdateChan.
+func (ws *WsConn) SelfUpdate(version string) error {
+	return ws.sendMessage(common.HubRequest[any]{
+		Action: common.SelfUpdate,
+		Data:   common.SelfUpdateRequest{Version: version},
+	})
+}
+
 // GetFingerprint authenticates with the agent using base64 key and returns the agent's fingerprint.
 func (ws *WsConn) GetFingerprint(token string, authKey string, systemID string, isUniversal bool, needSysInfo bool) (common.FingerprintResponse, error) {
 	var clientFingerprint common.FingerprintResponse
@@ -5,11 +5,18 @@ package ws
 
 import (
 	"beszel/internal/common"
+	"beszel/internal/entities/system"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/fxamacker/cbor/v2"
+	"github.com/lxzan/gws"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestGetUpgrader tests the singleton upgrader
@@ -88,7 +95,6 @@ func TestWsConn_SendMessage_CBOR(t *testing.T) {
 func TestWsConn_GetFingerprint_AuthKey(t *testing.T) {
 	// Test auth key
 	authKey := "base64:dGVzdC1hdXRoLWtleS1mb3ItdGVzdGluZw=="
-	token := "test-token"
 
 	// Test the fingerprint request structure
 	fpRequest := common.FingerprintRequest{
@@ -164,6 +170,7 @@ func TestCommonActions(t *testing.T) {
 	// Test that the actions we use exist and have expected values
 	assert.Equal(t, common.WebSocketAction(0), common.GetData, "GetData should be action 0")
 	assert.Equal(t, common.WebSocketAction(1), common.CheckFingerprint, "CheckFingerprint should be action 1")
+	assert.Equal(t, common.WebSocketAction(3), common.RunCheckNow, "RunCheckNow should be action 3")
 }
 
 // TestHandler tests that we can create a Handler
@@ -203,3 +210,140 @@ func TestWsConnChannelBehavior(t *testing.T) {
 		// Expected - channel should be empty
 	}
 }
+
+// TestWsConn_ConfigAck tests that configuration acknowledgements from the agent reach the handler
+func TestWsConn_Heartbeat(t *testing.T) {
+	wsConn := NewWsConnection(nil)
+	send := func(lastRun int64) {
+		data, err := cbor.Marshal(cbor.Tag{
+			Number: common.AgentMessageTag,
+			Content: common.AgentMessage[common.Heartbeat]{
+				Action: common.ReportHeartbeat,
+				Data:   common.Heartbeat{Schedulers: []system.SchedulerStatus{{Service: common.ServicePing, Active: true, LastRun: lastRun}}},
+			},
+		})
+		assert.NoError(t, err)
+		wsConn.handleAgentMessage(&gws.Message{Opcode: gws.OpcodeBinary, Data: bytes.NewBuffer(data)})
+	}
+
+	// only the latest heartbeat is kept until it is handled
+	send(100)
+	send(160)
+	select {
+	case heartbeat := <-wsConn.HeartbeatChan:
+		assert.Equal(t, []system.SchedulerStatus{{Service: common.ServicePing, Active: true, LastRun: 160}}, heartbeat.Schedulers)
+	default:
+		t.Fatal("heartbeat not received")
+	}
+	assert.Empty(t, wsConn.HeartbeatChan)
+}
+
+func TestWsConn_UpdateStatus(t *testing.T) {
+	wsConn := NewWsConnection(nil)
+	send := func(status common.UpdateStatus) {
+		data, err := cbor.Marshal(cbor.Tag{
+			Number:  common.AgentMessageTag,
+			Content: common.AgentMessage[common.UpdateStatus]{Action: common.ReportUpdate, Data: status},
+		})
+		assert.NoError(t, err)
+		wsConn.handleAgentMessage(&gws.Message{Opcode: gws.OpcodeBinary, Data: bytes.NewBuffer(data)})
+	}
+
+	// only the latest state is kept until it is handled
+	send(common.UpdateStatus{Status: common.UpdateRunning, Version: "1.2.3"})
+	send(common.UpdateStatus{Status: common.UpdateFailed, Version: "1.2.3", Error: "checksum mismatch"})
+	select {
+	case status := <-wsConn.UpdateChan:
+		assert.Equal(t, common.UpdateStatus{Status: common.UpdateFailed, Version: "1.2.3", Error: "checksum mismatch"}, status)
+	default:
+		t.Fatal("update status not received")
+	}
+	assert.Empty(t, wsConn.UpdateChan)
+}
+
+func TestWsConn_IPChange(t *testing.T) {
+	wsConn := NewWsConnection(nil)
+	send := func(change common.IPChange) {
+		data, err := cbor.Marshal(cbor.Tag{
+			Number:  common.AgentMessageTag,
+			Content: common.AgentMessage[common.IPChange]{Action: common.ReportIPChange, Data: change},
+		})
+		assert.NoError(t, err)
+		wsConn.handleAgentMessage(&gws.Message{Opcode: gws.OpcodeBinary, Data: bytes.NewBuffer(data)})
+	}
+
+	send(common.IPChange{Old: "203.0.113.7", New: "203.0.113.8", Time: 1700000000})
+	select {
+	case change := <-wsConn.IPChangeChan:
+		assert.Equal(t, common.IPChange{Old: "203.0.113.7", New: "203.0.113.8", Time: 1700000000}, change)
+	default:
+		t.Fatal("IP change not received")
+	}
+}
+
+func TestWsConn_ConfigAck(t *testing.T) {
+	wsConn := NewWsConnection(nil)
+	ack := common.ConfigAck{
+		Version:  7,
+		Applied:  3,
+		Total:    5,
+		Rejected: []common.RejectedTarget{{Service: common.ServiceDns, Target: "example.com@8.8.8.8:99999", Reason: `invalid port "99999"`}},
+	}
+	data, err := cbor.Marshal(cbor.Tag{
+		Number:  common.AgentMessageTag,
+		Content: common.AgentMessage[common.ConfigAck]{Action: common.AcknowledgeConfig, Data: ack},
+	})
+	assert.NoError(t, err)
+	assert.True(t, isAgentMessage(data))
+
+	// acknowledgements without a handler are dropped
+	wsConn.handleAgentMessage(&gws.Message{Opcode: gws.OpcodeBinary, Data: bytes.NewBuffer(data)})
+
+	var received []common.ConfigAck
+	wsConn.OnConfigAck(func(ack common.ConfigAck) { received = append(received, ack) })
+	wsConn.handleAgentMessage(&gws.Message{Opcode: gws.OpcodeBinary, Data: bytes.NewBuffer(data)})
+	assert.Equal(t, []common.ConfigAck{ack}, received)
+}
+
+// echoPingHandler answers pings with their payload, like the agent
+type echoPingHandler struct {
+	gws.BuiltinEventHandler
+}
+
+func (echoPingHandler) OnPing(conn *gws.Conn, payload []byte) {
+	_ = conn.WritePong(payload)
+}
+
+func TestWsConn_MeasureRTT(t *testing.T) {
+	wsConns := make(chan *WsConn, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := GetUpgrader().Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		wsConn := NewWsConnection(conn)
+		conn.Session().Store("wsConn", wsConn)
+		wsConns <- wsConn
+		conn.ReadLoop()
+	}))
+	defer server.Close()
+
+	client, _, err := gws.NewClient(echoPingHandler{}, &gws.ClientOption{Addr: "ws" + strings.TrimPrefix(server.URL, "http")})
+	require.NoError(t, err)
+	go client.ReadLoop()
+	defer client.NetConn().Close()
+
+	wsConn := <-wsConns
+	assert.Zero(t, wsConn.RTT(), "no ping answered yet")
+
+	// pongs without a timestamp, like answers to keepalive pings, are ignored
+	require.NoError(t, wsConn.Ping())
+	time.Sleep(50 * time.Millisecond)
+	assert.Zero(t, wsConn.RTT())
+
+	require.NoError(t, wsConn.MeasureRTT())
+	assert.Eventually(t, func() bool { return wsConn.RTT() > 0 }, time.Second, 5*time.Millisecond)
+	assert.Less(t, wsConn.RTT(), time.Second)
+
+	assert.ErrorIs(t, NewWsConnection(nil).MeasureRTT(), gws.ErrConnClosed)
+}
@@ -6,12 +6,41 @@ import (
 	"math"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase/core"
 )
 
+// statusCollections are the stats collections with a status field, whose
+// failed rows may be kept longer than successful ones
+var statusCollections = map[string]bool{
+	"dns_stats":        true,
+	"http_stats":       true,
+	"speedtest_stats":  true,
+	"traceroute_stats": true,
+	"snmp_stats":       true,
+}
+
+// failureStatuses are the statuses of failed checks, whose rows are kept for BESZEL_FAILURE_RETENTION_DAYS
+var failureStatuses = []string{"error", "timeout", "mismatch", "divergent", "implausible", "incomplete", "partial"}
+
+// failed is the condition of the rows of failed checks
+var failed = "status IN ('" + strings.Join(failureStatuses, "', '") + "')"
+
+// retentionOverrides maps the stats collections to the environment variable
+// overriding BESZEL_RETENTION_DAYS for them
+var retentionOverrides = map[string]string{
+	"ping_stats":       "BESZEL_RETENTION_DAYS_PING",
+	"dns_stats":        "BESZEL_RETENTION_DAYS_DNS",
+	"http_stats":       "BESZEL_RETENTION_DAYS_HTTP",
+	"speedtest_stats":  "BESZEL_RETENTION_DAYS_SPEEDTEST",
+	"traceroute_stats": "BESZEL_RETENTION_DAYS_TRACEROUTE",
+	"snmp_stats":       "BESZEL_RETENTION_DAYS_SNMP",
+	"system_averages":  "BESZEL_RETENTION_DAYS_AVERAGES",
+}
+
 type RecordManager struct {
 	app core.App
 }
@@ -40,25 +69,78 @@ func (rm *RecordManager) getRetentionPeriod() (time.Duration, error) {
 	return time.Duration(days) * 24 * time.Hour, nil
 }
 
+// getCollectionRetentionPeriod returns the retention period of a collection from its
+// override in retentionOverrides. Falls back to the base period if not set or invalid,
+// so a zero base period with no override means retention isn't configured.
+func (rm *RecordManager) getCollectionRetentionPeriod(collectionName string, basePeriod time.Duration) time.Duration {
+	key := retentionOverrides[collectionName]
+	retentionDays := os.Getenv(key)
+	if key == "" || retentionDays == "" {
+		return basePeriod
+	}
+
+	days, err := strconv.Atoi(retentionDays)
+	if err != nil || days <= 0 {
+		fmt.Printf("Invalid %s value: %s, using base retention\n", key, retentionDays)
+		return basePeriod
+	}
+
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// getFailureRetentionPeriod returns the retention period for error/timeout rows
+// from BESZEL_FAILURE_RETENTION_DAYS. Falls back to the base retention period
+// if not set, invalid, or shorter than the base period.
+func (rm *RecordManager) getFailureRetentionPeriod(basePeriod time.Duration) time.Duration {
+	retentionDays := os.Getenv("BESZEL_FAILURE_RETENTION_DAYS")
+	if retentionDays == "" {
+		return basePeriod
+	}
+
+	days, err := strconv.Atoi(retentionDays)
+	if err != nil || days <= 0 {
+		fmt.Printf("Invalid BESZEL_FAILURE_RETENTION_DAYS value: %s, using base retention\n", retentionDays)
+		return basePeriod
+	}
+
+	period := time.Duration(days) * 24 * time.Hour
+	if period < basePeriod {
+		return basePeriod
+	}
+	return period
+}
+
 // Delete old records based on retention policy
 func (rm *RecordManager) DeleteOldRecords() {
 	retentionPeriod, err := rm.getRetentionPeriod()
-	if err != nil {
-		// Log info message when retention is not configured
-		if err.Error() == "BESZEL_RETENTION_DAYS environment variable is required" {
-			fmt.Printf("Info: Data retention not configured, skipping cleanup operation\n")
-		} else {
-			fmt.Printf("Retention configuration error: %v\n", err)
-		}
+	if err != nil && err.Error() != "BESZEL_RETENTION_DAYS environment variable is required" {
+		fmt.Printf("Retention configuration error: %v\n", err)
 		return
 	}
-	cutoffDate := time.Now().UTC().Add(-retentionPeriod)
 
-	// Delete old records from all stats collections using optimized queries
-	collections := []string{"ping_stats", "dns_stats", "http_stats", "speedtest_stats", "system_averages"}
+	// Each collection may override the base retention period
+	collections := []string{"ping_stats", "dns_stats", "http_stats", "speedtest_stats", "traceroute_stats", "snmp_stats", "system_averages"}
+	periods := make(map[string]time.Duration, len(collections))
+	for _, collectionName := range collections {
+		if period := rm.getCollectionRetentionPeriod(collectionName, retentionPeriod); period > 0 {
+			periods[collectionName] = period
+		}
+	}
+	if len(periods) == 0 {
+		// Log info message when retention is not configured
+		fmt.Printf("Info: Data retention not configured, skipping cleanup operation\n")
+		return
+	}
 
+	now := time.Now().UTC()
 	for _, collectionName := range collections {
-		if err := rm.deleteOldRecordsFromCollection(collectionName, cutoffDate); err != nil {
+		period, ok := periods[collectionName]
+		if !ok {
+			continue
+		}
+		cutoffDate := now.Add(-period)
+		failureCutoffDate := now.Add(-rm.getFailureRetentionPeriod(period))
+		if err := rm.deleteOldRecordsFromCollection(collectionName, cutoffDate, failureCutoffDate); err != nil {
 			fmt.Printf("Error deleting old records from %s: %v\n", collectionName, err)
 		}
 	}
@@ -90,20 +172,42 @@ func deleteOldAlertsHistory(app core.App, countToKeep, countBeforeDeletion int)
 	return nil
 }
 
-// deleteOldRecordsFromCollection deletes old records from a specific collection using direct date comparison
-func (rm *RecordManager) deleteOldRecordsFromCollection(collectionName string, cutoffDate time.Time) error {
+// deleteOldRecordsFromCollection deletes old records from a specific collection using direct date comparison.
+// For collections with a status field, error/timeout rows are deleted using failureCutoffDate instead.
+func (rm *RecordManager) deleteOldRecordsFromCollection(collectionName string, cutoffDate, failureCutoffDate time.Time) error {
 	db := rm.app.DB()
 
-	// Use direct date comparison for better performance
-	query := fmt.Sprintf("DELETE FROM %s WHERE created < {:cutoffDate}", collectionName)
+	if !statusCollections[collectionName] {
+		// Use direct date comparison for better performance
+		query := fmt.Sprintf("DELETE FROM %s WHERE created < {:cutoffDate}", collectionName)
 
+		result, err := db.NewQuery(query).Bind(dbx.Params{"cutoffDate": cutoffDate}).Execute()
+		if err != nil {
+			return fmt.Errorf("failed to delete old records from %s: %w", collectionName, err)
+		}
+
+		rowsAffected, _ := result.RowsAffected()
+		fmt.Printf("Deleted %d old records from %s\n", rowsAffected, collectionName)
+		return nil
+	}
+
+	// Routine rows use the base retention period
+	query := fmt.Sprintf("DELETE FROM %s WHERE created < {:cutoffDate} AND NOT (%s)", collectionName, failed)
 	result, err := db.NewQuery(query).Bind(dbx.Params{"cutoffDate": cutoffDate}).Execute()
 	if err != nil {
 		return fmt.Errorf("failed to delete old records from %s: %w", collectionName, err)
 	}
-
 	rowsAffected, _ := result.RowsAffected()
-	fmt.Printf("Deleted %d old records from %s\n", rowsAffected, collectionName)
+
+	// Failed rows are kept for the extended retention period
+	query = fmt.Sprintf("DELETE FROM %s WHERE created < {:cutoffDate} AND %s", collectionName, failed)
+	result, err = db.NewQuery(query).Bind(dbx.Params{"cutoffDate": failureCutoffDate}).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to delete old failed records from %s: %w", collectionName, err)
+	}
+	failedRowsAffected, _ := result.RowsAffected()
+
+	fmt.Printf("Deleted %d old records and %d old failed records from %s\n", rowsAffected, failedRowsAffected, collectionName)
 
 	return nil
 }
@@ -187,7 +291,7 @@ func (rm *RecordManager) GetDatabaseStats() (map[string]interface{}, error) {
 	stats := make(map[string]interface{})
 
 	// Get record counts for each collection
-	collections := []string{"ping_stats", "dns_stats", "http_stats", "speedtest_stats", "alerts_history", "system_averages"}
+	collections := []string{"ping_stats", "dns_stats", "http_stats", "speedtest_stats", "traceroute_stats", "snmp_stats", "alerts_history", "system_averages"}
 
 	for _, collectionName := range collections {
 		var count int
@@ -6,7 +6,6 @@ package records_test
 import (
 	"beszel/internal/records"
 	"beszel/internal/tests"
-	"fmt"
 	"testing"
 	"time"
 
@@ -103,6 +102,249 @@ func TestDeleteOldRecords(t *testing.T) {
 	assert.Equal(t, alertsCountAfter, int64(200), "Alerts count should be equal to countToKeep (200)")
 }
 
+// TestDeleteOldRecordsStatusAware tests that failed rows are kept for the extended retention period
+func TestDeleteOldRecordsStatusAware(t *testing.T) {
+	t.Setenv("BESZEL_RETENTION_DAYS", "1")
+	t.Setenv("BESZEL_FAILURE_RETENTION_DAYS", "7")
+
+	hub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer hub.Cleanup()
+
+	rm := records.NewRecordManager(hub)
+
+	user, err := tests.CreateUser(hub, "test@example.com", "testtesttest")
+	require.NoError(t, err)
+
+	system, err := tests.CreateRecord(hub, "systems", map[string]any{
+		"name":   "test-system",
+		"host":   "localhost",
+		"status": "up",
+		"users":  []string{user.Id},
+	})
+	require.NoError(t, err)
+
+	now := time.Now().UTC()
+	createDnsStat := func(status string, age time.Duration) *core.Record {
+		record, err := tests.CreateRecord(hub, "dns_stats", map[string]any{
+			"system": system.Id,
+			"domain": "example.com",
+			"server": "1.1.1.1",
+			"status": status,
+		})
+		require.NoError(t, err)
+		// created is autodate field, so we need to set it manually
+		record.SetRaw("created", now.Add(-age).Format(types.DefaultDateLayout))
+		require.NoError(t, hub.SaveNoValidate(record))
+		return record
+	}
+
+	oldSuccess := createDnsStat("success", 3*24*time.Hour)
+	recentSuccess := createDnsStat("success", time.Hour)
+	oldError := createDnsStat("error", 3*24*time.Hour)
+	oldTimeout := createDnsStat("timeout", 3*24*time.Hour)
+	oldMismatch := createDnsStat("mismatch", 3*24*time.Hour)
+	expiredError := createDnsStat("error", 10*24*time.Hour)
+
+	rm.DeleteOldRecords()
+
+	exists := func(record *core.Record) bool {
+		_, err := hub.FindRecordById("dns_stats", record.Id)
+		return err == nil
+	}
+
+	assert.False(t, exists(oldSuccess), "Old successful rows should be deleted")
+	assert.True(t, exists(recentSuccess), "Recent successful rows should be kept")
+	assert.True(t, exists(oldError), "Old error rows within the failure window should be kept")
+	assert.True(t, exists(oldTimeout), "Old timeout rows within the failure window should be kept")
+	assert.True(t, exists(oldMismatch), "Old mismatch rows within the failure window should be kept")
+	assert.False(t, exists(expiredError), "Error rows older than the failure window should be deleted")
+}
+
+
+// TestDeleteOldRecordsPerCollection tests that collection overrides replace the base retention period
+func TestDeleteOldRecordsPerCollection(t *testing.T) {
+	hub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer hub.Cleanup()
+
+	rm := records.NewRecordManager(hub)
+
+	user, err := tests.CreateUser(hub, "test@example.com", "testtesttest")
+	require.NoError(t, err)
+
+	system, err := tests.CreateRecord(hub, "systems", map[string]any{
+		"name":   "test-system",
+		"host":   "localhost",
+		"status": "up",
+		"users":  []string{user.Id},
+	})
+	require.NoError(t, err)
+
+	now := time.Now().UTC()
+	createStat := func(t *testing.T, collection string, age time.Duration) *core.Record {
+		statsCollection, err := hub.FindCachedCollectionByNameOrId(collection)
+		require.NoError(t, err)
+		// only the fields retention looks at are set, so validation is skipped
+		record := core.NewRecord(statsCollection)
+		record.Set("system", system.Id)
+		record.Set("status", "success")
+		require.NoError(t, hub.SaveNoValidate(record))
+		// created is autodate field, so we need to set it manually
+		record.SetRaw("created", now.Add(-age).Format(types.DefaultDateLayout))
+		require.NoError(t, hub.SaveNoValidate(record))
+		return record
+	}
+	exists := func(record *core.Record) bool {
+		_, err := hub.FindRecordById(record.Collection().Name, record.Id)
+		return err == nil
+	}
+
+	t.Run("override without base retention", func(t *testing.T) {
+		t.Setenv("BESZEL_RETENTION_DAYS_PING", "2")
+
+		oldPing := createStat(t, "ping_stats", 3*24*time.Hour)
+		oldDns := createStat(t, "dns_stats", 3*24*time.Hour)
+
+		rm.DeleteOldRecords()
+
+		assert.False(t, exists(oldPing), "Ping rows older than the override should be deleted")
+		assert.True(t, exists(oldDns), "Collections without retention should be kept")
+	})
+
+	t.Run("override with base retention", func(t *testing.T) {
+		t.Setenv("BESZEL_RETENTION_DAYS", "1")
+		t.Setenv("BESZEL_RETENTION_DAYS_SPEEDTEST", "30")
+		t.Setenv("BESZEL_RETENTION_DAYS_HTTP", "invalid")
+
+		oldPing := createStat(t, "ping_stats", 3*24*time.Hour)
+		oldHttp := createStat(t, "http_stats", 3*24*time.Hour)
+		oldSpeedtest := createStat(t, "speedtest_stats", 3*24*time.Hour)
+		expiredSpeedtest := createStat(t, "speedtest_stats", 40*24*time.Hour)
+
+		rm.DeleteOldRecords()
+
+		assert.False(t, exists(oldPing), "Ping rows should use the base retention")
+		assert.False(t, exists(oldHttp), "Invalid overrides should fall back to the base retention")
+		assert.True(t, exists(oldSpeedtest), "Speedtest rows within the override should be kept")
+		assert.False(t, exists(expiredSpeedtest), "Speedtest rows older than the override should be deleted")
+	})
+}
+
+
+// TestRollupOldRecords tests that old stats are rolled up into hourly rows exactly once
+func TestRollupOldRecords(t *testing.T) {
+	t.Setenv("BESZEL_ROLLUP_AFTER_DAYS", "1")
+
+	hub, err := tests.NewTestHub(t.TempDir())
+	require.NoError(t, err)
+	defer hub.Cleanup()
+
+	rm := records.NewRecordManager(hub)
+
+	user, err := tests.CreateUser(hub, "test@example.com", "testtesttest")
+	require.NoError(t, err)
+
+	system, err := tests.CreateRecord(hub, "systems", map[string]any{
+		"name":   "test-system",
+		"host":   "localhost",
+		"status": "up",
+		"users":  []string{user.Id},
+	})
+	require.NoError(t, err)
+
+	now := time.Now().UTC()
+	hour := now.Add(-48 * time.Hour).Truncate(time.Hour)
+	createStat := func(collection string, created time.Time, fields map[string]any) *core.Record {
+		statsCollection, err := hub.FindCachedCollectionByNameOrId(collection)
+		require.NoError(t, err)
+		record := core.NewRecord(statsCollection)
+		record.Set("system", system.Id)
+		record.Load(fields)
+		require.NoError(t, hub.SaveNoValidate(record))
+		// created is autodate field, so we need to set it manually
+		record.SetRaw("created", created.Format(types.DefaultDateLayout))
+		require.NoError(t, hub.SaveNoValidate(record))
+		return record
+	}
+	hourlyRow := func(collection string) *core.Record {
+		rows, err := hub.FindAllRecords(collection)
+		require.NoError(t, err)
+		require.Len(t, rows, 1)
+		return rows[0]
+	}
+
+	createStat("ping_stats", hour.Add(10*time.Minute), map[string]any{"host": "1.1.1.1", "avg_rtt": 10, "min_rtt": 8, "max_rtt": 12, "packet_loss": 0})
+	createStat("ping_stats", hour.Add(20*time.Minute), map[string]any{"host": "1.1.1.1", "avg_rtt": 20, "min_rtt": 18, "max_rtt": 30, "packet_loss": 10})
+	createStat("ping_stats", hour.Add(30*time.Minute), map[string]any{"host": "1.1.1.1", "packet_loss": 100})
+	recentPing := createStat("ping_stats", now.Add(-time.Hour), map[string]any{"host": "1.1.1.1", "avg_rtt": 50})
+	createStat("dns_stats", hour.Add(10*time.Minute), map[string]any{"domain": "example.com", "server": "1.1.1.1", "type": "A", "status": "success", "lookup_time": 10})
+	createStat("dns_stats", hour.Add(20*time.Minute), map[string]any{"domain": "example.com", "server": "1.1.1.1", "type": "A", "status": "timeout", "lookup_time": 5000})
+	// lookups of the same domain on another server or of another type are rolled up apart
+	createStat("dns_stats", hour.Add(30*time.Minute), map[string]any{"domain": "example.com", "server": "8.8.8.8", "type": "A", "status": "success", "lookup_time": 30})
+	createStat("dns_stats", hour.Add(40*time.Minute), map[string]any{"domain": "example.com", "server": "1.1.1.1", "type": "AAAA", "status": "success", "lookup_time": 40})
+
+	rm.RollupOldRecords()
+
+	ping := hourlyRow("ping_stats_hourly")
+	assert.Equal(t, "1.1.1.1", ping.GetString("host"))
+	assert.Equal(t, hour, ping.GetDateTime("hour").Time())
+	assert.Equal(t, 3, ping.GetInt("count"))
+	assert.Equal(t, 2, ping.GetInt("samples"))
+	assert.InDelta(t, 15, ping.GetFloat("avg_rtt"), 0.001)
+	assert.InDelta(t, 8, ping.GetFloat("min_rtt"), 0.001)
+	assert.InDelta(t, 30, ping.GetFloat("max_rtt"), 0.001)
+	assert.InDelta(t, 110.0/3, ping.GetFloat("packet_loss"), 0.001)
+
+	dnsRows, err := hub.FindAllRecords("dns_stats_hourly")
+	require.NoError(t, err)
+	require.Len(t, dnsRows, 3)
+	dnsTargets := map[string]*core.Record{}
+	for _, row := range dnsRows {
+		dnsTargets[row.GetString("server")+" "+row.GetString("type")] = row
+	}
+	require.Contains(t, dnsTargets, "1.1.1.1 A")
+	dns := dnsTargets["1.1.1.1 A"]
+	assert.Equal(t, "example.com", dns.GetString("domain"))
+	assert.Equal(t, 2, dns.GetInt("count"))
+	assert.Equal(t, 1, dns.GetInt("failures"))
+	assert.InDelta(t, 10, dns.GetFloat("lookup_time"), 0.001)
+	require.Contains(t, dnsTargets, "8.8.8.8 A")
+	assert.InDelta(t, 30, dnsTargets["8.8.8.8 A"].GetFloat("lookup_time"), 0.001)
+	require.Contains(t, dnsTargets, "1.1.1.1 AAAA")
+	assert.InDelta(t, 40, dnsTargets["1.1.1.1 AAAA"].GetFloat("lookup_time"), 0.001)
+
+	// raw rows of rolled up hours are deleted, recent ones are kept
+	pings, err := hub.FindAllRecords("ping_stats")
+	require.NoError(t, err)
+	require.Len(t, pings, 1)
+	assert.Equal(t, recentPing.Id, pings[0].Id)
+
+	// failed checks are kept for the failure retention
+	dnsStats, err := hub.FindAllRecords("dns_stats")
+	require.NoError(t, err)
+	require.Len(t, dnsStats, 1)
+	assert.Equal(t, "timeout", dnsStats[0].GetString("status"))
+
+	// re-running doesn't count rows twice, kept failed rows included
+	rm.RollupOldRecords()
+	assert.Equal(t, 3, hourlyRow("ping_stats_hourly").GetInt("count"))
+	dns, err = hub.FindRecordById("dns_stats_hourly", dns.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 2, dns.GetInt("count"))
+	assert.Equal(t, 1, dns.GetInt("failures"))
+
+	// rows arriving late for a rolled up hour are merged into its row
+	createStat("ping_stats", hour.Add(40*time.Minute), map[string]any{"host": "1.1.1.1", "avg_rtt": 30, "min_rtt": 5, "max_rtt": 40, "packet_loss": 0})
+	rm.RollupOldRecords()
+	ping = hourlyRow("ping_stats_hourly")
+	assert.Equal(t, 4, ping.GetInt("count"))
+	assert.Equal(t, 3, ping.GetInt("samples"))
+	assert.InDelta(t, 20, ping.GetFloat("avg_rtt"), 0.001)
+	assert.InDelta(t, 5, ping.GetFloat("min_rtt"), 0.001)
+	assert.InDelta(t, 40, ping.GetFloat("max_rtt"), 0.001)
+	assert.InDelta(t, 27.5, ping.GetFloat("packet_loss"), 0.001)
+}
 
 // TestDeleteOldAlertsHistory tests the deleteOldAlertsHistory function
 func TestDeleteOldAlertsHistory(t *testing.T) {
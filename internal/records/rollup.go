@@ -0,0 +1,256 @@
+package records
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// How a column of an hourly row combines with the column of a later rollup of the same hour
+const (
+	mergeAvg = iota // average weighted by the column's weight
+	mergeMin
+	mergeMax
+	mergeSum
+)
+
+// rollupColumn is a column of an hourly collection and the aggregate of the raw rows filling it
+type rollupColumn struct {
+	name   string
+	expr   string // aggregate of the raw rows, never NULL
+	merge  int
+	weight string // column counting the rows the aggregate is over, empty for sums
+}
+
+// rollup describes how the rows of a stats collection are rolled up into its hourly collection
+type rollup struct {
+	collection string
+	targets    []string // columns the rows of a system are grouped by, identifying a target
+	samples    string   // condition of the rows the averages, minimums and maximums are over
+	columns    []rollupColumn
+}
+
+// Failed checks have no meaningful timings, so only successful ones are averaged
+const successful = "status = 'success'"
+
+// uploaded leaves out the speedtests that only measured the download, like the HTTP file provider
+const uploaded = successful + " AND upload_speed > 0"
+
+var rollups = []rollup{
+	{
+		collection: "ping_stats",
+		targets:    []string{"host"},
+		samples:    "packet_loss < 100",
+		columns: []rollupColumn{
+			sampleAvg("avg_rtt", "avg_rtt", "packet_loss < 100"),
+			sampleMin("min_rtt", "min_rtt", "packet_loss < 100"),
+			sampleMax("max_rtt", "max_rtt", "packet_loss < 100"),
+			{name: "packet_loss", expr: "AVG(packet_loss)", merge: mergeAvg, weight: "count"},
+		},
+	},
+	// lookups of a domain on different servers, of different types or from different
+	// source addresses are different targets
+	{
+		collection: "dns_stats",
+		targets:    []string{"domain", "server", "type", "source_ip"},
+		samples:    successful,
+		columns: []rollupColumn{
+			sampleAvg("lookup_time", "lookup_time", successful),
+			sampleMin("min_lookup_time", "lookup_time", successful),
+			sampleMax("max_lookup_time", "lookup_time", successful),
+			failures,
+		},
+	},
+	{
+		collection: "http_stats",
+		targets:    []string{"url"},
+		samples:    successful,
+		columns: []rollupColumn{
+			sampleAvg("response_time", "response_time", successful),
+			sampleMin("min_response_time", "response_time", successful),
+			sampleMax("max_response_time", "response_time", successful),
+			failures,
+		},
+	},
+	{
+		collection: "speedtest_stats",
+		targets:    []string{"server_id"},
+		samples:    successful,
+		columns: []rollupColumn{
+			sampleAvg("download_speed", "download_speed", successful),
+			sampleMin("min_download_speed", "download_speed", successful),
+			sampleMax("max_download_speed", "download_speed", successful),
+			sampleAvg("upload_speed", "upload_speed", uploaded),
+			sampleMin("min_upload_speed", "upload_speed", uploaded),
+			sampleMax("max_upload_speed", "upload_speed", uploaded),
+			sampleAvg("latency", "latency", successful),
+			failures,
+		},
+	},
+}
+
+// failures counts the failed checks
+var failures = rollupColumn{name: "failures", expr: "SUM(" + failed + ")", merge: mergeSum}
+
+func sampleAvg(name, column, condition string) rollupColumn {
+	return rollupColumn{name: name, expr: fmt.Sprintf("COALESCE(AVG(CASE WHEN %s THEN %s END), 0)", condition, column), merge: mergeAvg, weight: "samples"}
+}
+
+func sampleMin(name, column, condition string) rollupColumn {
+	return rollupColumn{name: name, expr: fmt.Sprintf("COALESCE(MIN(CASE WHEN %s THEN %s END), 0)", condition, column), merge: mergeMin, weight: "samples"}
+}
+
+func sampleMax(name, column, condition string) rollupColumn {
+	return rollupColumn{name: name, expr: fmt.Sprintf("COALESCE(MAX(CASE WHEN %s THEN %s END), 0)", condition, column), merge: mergeMax, weight: "samples"}
+}
+
+// mergeExpr returns the expression combining the column of an existing hourly row with the new one
+func (c rollupColumn) mergeExpr() string {
+	switch c.merge {
+	case mergeAvg:
+		return fmt.Sprintf("CASE WHEN [[%[2]s]] + excluded.[[%[2]s]] = 0 THEN 0 ELSE ([[%[1]s]] * [[%[2]s]] + excluded.[[%[1]s]] * excluded.[[%[2]s]]) / ([[%[2]s]] + excluded.[[%[2]s]]) END", c.name, c.weight)
+	case mergeMin, mergeMax:
+		fn := "MIN"
+		if c.merge == mergeMax {
+			fn = "MAX"
+		}
+		// a side without samples has no value to compare
+		return fmt.Sprintf("CASE WHEN excluded.[[%[2]s]] = 0 THEN [[%[1]s]] WHEN [[%[2]s]] = 0 THEN excluded.[[%[1]s]] ELSE %[3]s([[%[1]s]], excluded.[[%[1]s]]) END", c.name, c.weight, fn)
+	default:
+		return fmt.Sprintf("[[%[1]s]] + excluded.[[%[1]s]]", c.name)
+	}
+}
+
+// keepsFailed reports whether the failed rows of the collection are kept after being rolled up, for
+// the failure retention. They are marked as rolled up instead, so they're only counted once.
+func (r rollup) keepsFailed() bool {
+	return statusCollections[r.collection]
+}
+
+// query returns the statement rolling up the rows created in [{:from}, {:to}) into the hourly collection.
+// Rows of an hour that was rolled up before are merged into its existing row.
+func (r rollup) query() string {
+	hourly := r.collection + "_hourly"
+	targets := []string{"[[system]]"}
+	for _, target := range r.targets {
+		targets = append(targets, "[["+target+"]]")
+	}
+	// an hourly row is unique by system, target and hour
+	key := append(slices.Clone(targets), "[[hour]]")
+	columns := append(slices.Clone(key), "[[count]]", "[[samples]]")
+	exprs := append(slices.Clone(targets), "substr([[created]], 1, 13) || ':00:00.000Z' AS [[hour]]", "COUNT(*)", fmt.Sprintf("SUM(%s)", r.samples))
+	updates := []string{"[[count]] = [[count]] + excluded.[[count]]", "[[samples]] = [[samples]] + excluded.[[samples]]"}
+	for _, column := range r.columns {
+		columns = append(columns, "[["+column.name+"]]")
+		exprs = append(exprs, column.expr)
+		updates = append(updates, fmt.Sprintf("[[%s]] = %s", column.name, column.mergeExpr()))
+	}
+	columns = append(columns, "[[created]]", "[[updated]]")
+	exprs = append(exprs, "{:now}", "{:now}")
+	updates = append(updates, "[[updated]] = {:now}")
+
+	where := "[[created]] >= {:from} AND [[created]] < {:to}"
+	if r.keepsFailed() {
+		where += " AND NOT [[rolled_up]]"
+	}
+
+	// SQLite evaluates all SET expressions with the values of the row before the update,
+	// so the merges of the averages still see the old counts
+	return fmt.Sprintf(`
+		INSERT INTO {{%s}} (%s)
+		SELECT %s
+		FROM {{%s}}
+		WHERE %s
+		GROUP BY %[6]s
+		ON CONFLICT (%[6]s) DO UPDATE SET %[7]s
+	`, hourly, strings.Join(columns, ", "), strings.Join(exprs, ", "), r.collection, where, strings.Join(key, ", "), strings.Join(updates, ", "))
+}
+
+// getRollupAge returns the age after which stats rows are rolled up from
+// BESZEL_ROLLUP_AFTER_DAYS, or 0 if rollups aren't configured
+func (rm *RecordManager) getRollupAge() time.Duration {
+	rollupDays := os.Getenv("BESZEL_ROLLUP_AFTER_DAYS")
+	if rollupDays == "" {
+		return 0
+	}
+
+	days, err := strconv.Atoi(rollupDays)
+	if err != nil || days <= 0 {
+		fmt.Printf("Invalid BESZEL_ROLLUP_AFTER_DAYS value: %s, skipping rollup\n", rollupDays)
+		return 0
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// RollupOldRecords rolls up the stats rows older than BESZEL_ROLLUP_AFTER_DAYS into hourly
+// averages, minimums and maximums per system and target, then deletes the raw rows. Rows of
+// failed checks are kept for the failure retention.
+// Only whole hours are rolled up, and rows past the retention period are left for deletion.
+// Rolling up and deleting happen in one transaction, so re-running never counts a row twice.
+func (rm *RecordManager) RollupOldRecords() {
+	rollupAge := rm.getRollupAge()
+	if rollupAge == 0 {
+		return
+	}
+	retentionPeriod, _ := rm.getRetentionPeriod()
+
+	now := time.Now().UTC()
+	to := now.Add(-rollupAge).Truncate(time.Hour)
+	for _, r := range rollups {
+		from := time.Time{}
+		if period := rm.getCollectionRetentionPeriod(r.collection, retentionPeriod); period > 0 {
+			// the first whole hour within the retention period
+			from = now.Add(-period).Truncate(time.Hour).Add(time.Hour)
+		}
+		if !from.Before(to) {
+			continue
+		}
+		rolledUp, err := rm.rollupCollection(r, from, to, now)
+		if err != nil {
+			fmt.Printf("Error rolling up old records from %s: %v\n", r.collection, err)
+			continue
+		}
+		fmt.Printf("Rolled up %d old records from %s\n", rolledUp, r.collection)
+	}
+}
+
+// rollupCollection rolls up the rows of a collection created in [from, to) and deletes them, or
+// marks them as rolled up if they are kept, returning the number of rows rolled up
+func (rm *RecordManager) rollupCollection(r rollup, from, to, now time.Time) (int64, error) {
+	params := dbx.Params{
+		"from": from.Format(types.DefaultDateLayout),
+		"to":   to.Format(types.DefaultDateLayout),
+		"now":  now.Format(types.DefaultDateLayout),
+	}
+
+	var rolledUp int64
+	err := rm.app.RunInTransaction(func(txApp core.App) error {
+		if _, err := txApp.DB().NewQuery(r.query()).Bind(params).Execute(); err != nil {
+			return err
+		}
+		inRange := "[[created]] >= {:from} AND [[created]] < {:to}"
+		if r.keepsFailed() {
+			result, err := txApp.DB().NewQuery(fmt.Sprintf("UPDATE {{%s}} SET [[rolled_up]] = TRUE WHERE %s AND NOT [[rolled_up]] AND %s", r.collection, inRange, failed)).Bind(params).Execute()
+			if err != nil {
+				return err
+			}
+			rolledUp, _ = result.RowsAffected()
+			inRange += " AND NOT (" + failed + ")"
+		}
+		result, err := txApp.DB().NewQuery(fmt.Sprintf("DELETE FROM {{%s}} WHERE %s", r.collection, inRange)).Bind(params).Execute()
+		if err != nil {
+			return err
+		}
+		deleted, _ := result.RowsAffected()
+		rolledUp += deleted
+		return nil
+	})
+	return rolledUp, err
+}
@@ -0,0 +1,71 @@
+package migrations
+
+import (
+	"slices"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// quality index per ping_stats row
+		pingStats, err := app.FindCollectionByNameOrId("ping_stats")
+		if err != nil {
+			return err
+		}
+		pingStats.Fields.Add(&core.NumberField{
+			Id:   "quality_index_number_id",
+			Name: "quality_index",
+		})
+		if err := app.Save(pingStats); err != nil {
+			return err
+		}
+
+		// averaged quality index (collection may not exist on every install)
+		if averages, err := app.FindCollectionByNameOrId("system_averages"); err == nil {
+			averages.Fields.Add(&core.NumberField{
+				Id:   "ping_quality_number_id",
+				Name: "ping_quality",
+			})
+			if err := app.Save(averages); err != nil {
+				return err
+			}
+		}
+
+		// PingQuality alert type
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		if field, ok := alerts.Fields.GetByName("name").(*core.SelectField); ok && !slices.Contains(field.Values, "PingQuality") {
+			field.Values = append(field.Values, "PingQuality")
+		}
+		return app.Save(alerts)
+	}, func(app core.App) error {
+		pingStats, err := app.FindCollectionByNameOrId("ping_stats")
+		if err != nil {
+			return err
+		}
+		pingStats.Fields.RemoveByName("quality_index")
+		if err := app.Save(pingStats); err != nil {
+			return err
+		}
+
+		if averages, err := app.FindCollectionByNameOrId("system_averages"); err == nil {
+			averages.Fields.RemoveByName("ping_quality")
+			if err := app.Save(averages); err != nil {
+				return err
+			}
+		}
+
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		if field, ok := alerts.Fields.GetByName("name").(*core.SelectField); ok {
+			field.Values = slices.DeleteFunc(field.Values, func(v string) bool { return v == "PingQuality" })
+		}
+		return app.Save(alerts)
+	})
+}
@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// agent-initiated maintenance mode
+		systems, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+		systems.Fields.Add(&core.BoolField{
+			Id:   "maintenance_bool_id",
+			Name: "maintenance",
+		})
+		systems.Fields.Add(&core.DateField{
+			Id:   "maintenance_until_date_id",
+			Name: "maintenance_until",
+		})
+		return app.Save(systems)
+	}, func(app core.App) error {
+		systems, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+		systems.Fields.RemoveByName("maintenance")
+		systems.Fields.RemoveByName("maintenance_until")
+		return app.Save(systems)
+	})
+}
@@ -0,0 +1,98 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// service level objectives aggregated from per-target stats
+		systems, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+
+		slos := core.NewBaseCollection("slos", "slos_collection_id")
+		slos.ListRule = types.Pointer("@request.auth.id != \"\"")
+		slos.ViewRule = types.Pointer("@request.auth.id != \"\"")
+		slos.CreateRule = types.Pointer("@request.auth.id != \"\" && @request.auth.role = \"admin\"")
+		slos.UpdateRule = types.Pointer("@request.auth.id != \"\" && @request.auth.role = \"admin\"")
+		slos.DeleteRule = types.Pointer("@request.auth.id != \"\" && @request.auth.role = \"admin\"")
+		slos.Fields.Add(
+			&core.RelationField{
+				Id:            "slos_system_relation_id",
+				Name:          "system",
+				CollectionId:  systems.Id,
+				CascadeDelete: true,
+				MaxSelect:     1,
+				Required:      true,
+			},
+			&core.TextField{
+				Id:       "slos_name_text_id",
+				Name:     "name",
+				Max:      100,
+				Required: true,
+			},
+			&core.SelectField{
+				Id:        "slos_metric_select_id",
+				Name:      "metric",
+				Values:    []string{"http", "dns", "ping", "speedtest"},
+				MaxSelect: 1,
+				Required:  true,
+			},
+			&core.TextField{
+				Id:   "slos_target_text_id",
+				Name: "target",
+				Max:  500,
+			},
+			&core.NumberField{
+				Id:   "slos_max_latency_number_id",
+				Name: "max_latency",
+				Min:  types.Pointer(0.0),
+			},
+			&core.NumberField{
+				Id:      "slos_window_days_number_id",
+				Name:    "window_days",
+				Min:     types.Pointer(1.0),
+				OnlyInt: true,
+			},
+			&core.NumberField{
+				Id:       "slos_objective_number_id",
+				Name:     "objective",
+				Min:      types.Pointer(0.0),
+				Max:      types.Pointer(100.0),
+				Required: true,
+			},
+			&core.NumberField{
+				Id:   "slos_burn_rate_threshold_number_id",
+				Name: "burn_rate_threshold",
+				Min:  types.Pointer(0.0),
+			},
+			&core.BoolField{
+				Id:   "slos_triggered_bool_id",
+				Name: "triggered",
+			},
+			&core.AutodateField{
+				Id:       "slos_created_date_id",
+				Name:     "created",
+				OnCreate: true,
+			},
+			&core.AutodateField{
+				Id:       "slos_updated_date_id",
+				Name:     "updated",
+				OnCreate: true,
+				OnUpdate: true,
+			},
+		)
+		slos.AddIndex("idx_slos_system", false, "system", "")
+		return app.Save(slos)
+	}, func(app core.App) error {
+		slos, err := app.FindCollectionByNameOrId("slos")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(slos)
+	})
+}
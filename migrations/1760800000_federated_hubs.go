@@ -0,0 +1,57 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// remote hubs whose stats can be read through federation
+		adminRule := types.Pointer("@request.auth.id != \"\" && @request.auth.role = \"admin\"")
+		hubs := core.NewBaseCollection("federated_hubs", "federated_hubs_collection_id")
+		hubs.ListRule = types.Pointer("@request.auth.id != \"\"")
+		hubs.ViewRule = types.Pointer("@request.auth.id != \"\"")
+		hubs.CreateRule = adminRule
+		hubs.UpdateRule = adminRule
+		hubs.DeleteRule = adminRule
+		hubs.Fields.Add(
+			&core.TextField{
+				Id:       "federated_hubs_name_text_id",
+				Name:     "name",
+				Max:      100,
+				Required: true,
+			},
+			&core.URLField{
+				Id:       "federated_hubs_url_id",
+				Name:     "url",
+				Required: true,
+			},
+			&core.TextField{
+				Id:       "federated_hubs_token_text_id",
+				Name:     "token",
+				Hidden:   true,
+				Required: true,
+			},
+			&core.AutodateField{
+				Id:       "federated_hubs_created_date_id",
+				Name:     "created",
+				OnCreate: true,
+			},
+			&core.AutodateField{
+				Id:       "federated_hubs_updated_date_id",
+				Name:     "updated",
+				OnCreate: true,
+				OnUpdate: true,
+			},
+		)
+		return app.Save(hubs)
+	}, func(app core.App) error {
+		hubs, err := app.FindCollectionByNameOrId("federated_hubs")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(hubs)
+	})
+}
@@ -0,0 +1,54 @@
+package migrations
+
+import (
+	"slices"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// discovered path MTU of ping targets in mtu mode
+		pingStats, err := app.FindCollectionByNameOrId("ping_stats")
+		if err != nil {
+			return err
+		}
+		pingStats.Fields.Add(&core.NumberField{
+			Id:      "mtu_number_id",
+			Name:    "mtu",
+			OnlyInt: true,
+		})
+		if err := app.Save(pingStats); err != nil {
+			return err
+		}
+
+		// PingMtu alert type
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		if field, ok := alerts.Fields.GetByName("name").(*core.SelectField); ok && !slices.Contains(field.Values, "PingMtu") {
+			field.Values = append(field.Values, "PingMtu")
+		}
+		return app.Save(alerts)
+	}, func(app core.App) error {
+		pingStats, err := app.FindCollectionByNameOrId("ping_stats")
+		if err != nil {
+			return err
+		}
+		pingStats.Fields.RemoveByName("mtu")
+		if err := app.Save(pingStats); err != nil {
+			return err
+		}
+
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		if field, ok := alerts.Fields.GetByName("name").(*core.SelectField); ok {
+			field.Values = slices.DeleteFunc(field.Values, func(v string) bool { return v == "PingMtu" })
+		}
+		return app.Save(alerts)
+	})
+}
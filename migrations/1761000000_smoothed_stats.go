@@ -0,0 +1,49 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// smoothed values reported by agents alongside the raw values
+		pingStats, err := app.FindCollectionByNameOrId("ping_stats")
+		if err != nil {
+			return err
+		}
+		pingStats.Fields.Add(&core.NumberField{
+			Id:   "smoothed_avg_rtt_number_id",
+			Name: "smoothed_avg_rtt",
+		})
+		if err := app.Save(pingStats); err != nil {
+			return err
+		}
+
+		httpStats, err := app.FindCollectionByNameOrId("http_stats")
+		if err != nil {
+			return err
+		}
+		httpStats.Fields.Add(&core.NumberField{
+			Id:   "smoothed_response_time_number_id",
+			Name: "smoothed_response_time",
+		})
+		return app.Save(httpStats)
+	}, func(app core.App) error {
+		pingStats, err := app.FindCollectionByNameOrId("ping_stats")
+		if err != nil {
+			return err
+		}
+		pingStats.Fields.RemoveByName("smoothed_avg_rtt")
+		if err := app.Save(pingStats); err != nil {
+			return err
+		}
+
+		httpStats, err := app.FindCollectionByNameOrId("http_stats")
+		if err != nil {
+			return err
+		}
+		httpStats.Fields.RemoveByName("smoothed_response_time")
+		return app.Save(httpStats)
+	})
+}
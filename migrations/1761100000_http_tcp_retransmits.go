@@ -0,0 +1,54 @@
+package migrations
+
+import (
+	"slices"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// TCP segments retransmitted during HTTP checks
+		httpStats, err := app.FindCollectionByNameOrId("http_stats")
+		if err != nil {
+			return err
+		}
+		httpStats.Fields.Add(&core.NumberField{
+			Id:      "tcp_retransmits_number_id",
+			Name:    "tcp_retransmits",
+			OnlyInt: true,
+		})
+		if err := app.Save(httpStats); err != nil {
+			return err
+		}
+
+		// HTTPRetransmits alert type
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		if field, ok := alerts.Fields.GetByName("name").(*core.SelectField); ok && !slices.Contains(field.Values, "HTTPRetransmits") {
+			field.Values = append(field.Values, "HTTPRetransmits")
+		}
+		return app.Save(alerts)
+	}, func(app core.App) error {
+		httpStats, err := app.FindCollectionByNameOrId("http_stats")
+		if err != nil {
+			return err
+		}
+		httpStats.Fields.RemoveByName("tcp_retransmits")
+		if err := app.Save(httpStats); err != nil {
+			return err
+		}
+
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		if field, ok := alerts.Fields.GetByName("name").(*core.SelectField); ok {
+			field.Values = slices.DeleteFunc(field.Values, func(v string) bool { return v == "HTTPRetransmits" })
+		}
+		return app.Save(alerts)
+	})
+}
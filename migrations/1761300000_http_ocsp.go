@@ -0,0 +1,63 @@
+package migrations
+
+import (
+	"slices"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// OCSP stapling and certificate transparency status of HTTPS targets
+		httpStats, err := app.FindCollectionByNameOrId("http_stats")
+		if err != nil {
+			return err
+		}
+		httpStats.Fields.Add(&core.BoolField{
+			Id:   "ocsp_stapled_bool_id",
+			Name: "ocsp_stapled",
+		})
+		httpStats.Fields.Add(&core.TextField{
+			Id:   "ocsp_status_text_id",
+			Name: "ocsp_status",
+		})
+		httpStats.Fields.Add(&core.BoolField{
+			Id:   "sct_present_bool_id",
+			Name: "sct_present",
+		})
+		if err := app.Save(httpStats); err != nil {
+			return err
+		}
+
+		// HTTPOcspStapling alert type
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		if field, ok := alerts.Fields.GetByName("name").(*core.SelectField); ok && !slices.Contains(field.Values, "HTTPOcspStapling") {
+			field.Values = append(field.Values, "HTTPOcspStapling")
+		}
+		return app.Save(alerts)
+	}, func(app core.App) error {
+		httpStats, err := app.FindCollectionByNameOrId("http_stats")
+		if err != nil {
+			return err
+		}
+		httpStats.Fields.RemoveByName("ocsp_stapled")
+		httpStats.Fields.RemoveByName("ocsp_status")
+		httpStats.Fields.RemoveByName("sct_present")
+		if err := app.Save(httpStats); err != nil {
+			return err
+		}
+
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		if field, ok := alerts.Fields.GetByName("name").(*core.SelectField); ok {
+			field.Values = slices.DeleteFunc(field.Values, func(v string) bool { return v == "HTTPOcspStapling" })
+		}
+		return app.Save(alerts)
+	})
+}
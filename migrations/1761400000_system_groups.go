@@ -0,0 +1,65 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// named groups of systems, only visible to their owner
+		systems, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+
+		ownerRule := types.Pointer("@request.auth.id != \"\" && owner = @request.auth.id")
+		groups := core.NewBaseCollection("system_groups", "system_groups_collection_id")
+		groups.ListRule = ownerRule
+		groups.ViewRule = ownerRule
+		groups.CreateRule = types.Pointer("@request.auth.id != \"\" && @request.body.owner = @request.auth.id")
+		groups.UpdateRule = types.Pointer("@request.auth.id != \"\" && owner = @request.auth.id && (@request.body.owner:isset = false || @request.body.owner = @request.auth.id)")
+		groups.DeleteRule = ownerRule
+		groups.Fields.Add(
+			&core.TextField{
+				Id:       "system_groups_name_text_id",
+				Name:     "name",
+				Max:      100,
+				Required: true,
+			},
+			&core.RelationField{
+				Id:           "system_groups_systems_relation_id",
+				Name:         "systems",
+				CollectionId: systems.Id,
+				MaxSelect:    999,
+			},
+			&core.RelationField{
+				Id:            "system_groups_owner_relation_id",
+				Name:          "owner",
+				CollectionId:  "_pb_users_auth_",
+				CascadeDelete: true,
+				MaxSelect:     1,
+				Required:      true,
+			},
+			&core.AutodateField{
+				Id:       "system_groups_created_date_id",
+				Name:     "created",
+				OnCreate: true,
+			},
+			&core.AutodateField{
+				Id:       "system_groups_updated_date_id",
+				Name:     "updated",
+				OnCreate: true,
+				OnUpdate: true,
+			},
+		)
+		return app.Save(groups)
+	}, func(app core.App) error {
+		groups, err := app.FindCollectionByNameOrId("system_groups")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(groups)
+	})
+}
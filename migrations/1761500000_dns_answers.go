@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"slices"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// IP addresses of A and AAAA answers
+		dnsStats, err := app.FindCollectionByNameOrId("dns_stats")
+		if err != nil {
+			return err
+		}
+		dnsStats.Fields.Add(&core.JSONField{
+			Id:   "answers_json_id",
+			Name: "answers",
+		})
+		if err := app.Save(dnsStats); err != nil {
+			return err
+		}
+
+		// DNSAnswerOutOfRange alert type
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		if field, ok := alerts.Fields.GetByName("name").(*core.SelectField); ok && !slices.Contains(field.Values, "DNSAnswerOutOfRange") {
+			field.Values = append(field.Values, "DNSAnswerOutOfRange")
+		}
+		return app.Save(alerts)
+	}, func(app core.App) error {
+		dnsStats, err := app.FindCollectionByNameOrId("dns_stats")
+		if err != nil {
+			return err
+		}
+		dnsStats.Fields.RemoveByName("answers")
+		if err := app.Save(dnsStats); err != nil {
+			return err
+		}
+
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		if field, ok := alerts.Fields.GetByName("name").(*core.SelectField); ok {
+			field.Values = slices.DeleteFunc(field.Values, func(v string) bool { return v == "DNSAnswerOutOfRange" })
+		}
+		return app.Save(alerts)
+	})
+}
@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// cron windows in which intermittent systems are expected to be online
+		systems, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+		systems.Fields.Add(&core.TextField{
+			Id:   "active_schedule_text_id",
+			Name: "active_schedule",
+		})
+		systems.Fields.Add(&core.BoolField{
+			Id:   "schedule_paused_bool_id",
+			Name: "schedule_paused",
+		})
+		return app.Save(systems)
+	}, func(app core.App) error {
+		systems, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+		systems.Fields.RemoveByName("active_schedule")
+		systems.Fields.RemoveByName("schedule_paused")
+		return app.Save(systems)
+	})
+}
@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// address family ("ipv4" or "ipv6") of the pinged address
+		pingStats, err := app.FindCollectionByNameOrId("ping_stats")
+		if err != nil {
+			return err
+		}
+		pingStats.Fields.Add(&core.TextField{
+			Id:   "ping_address_family_text_id",
+			Name: "address_family",
+		})
+		return app.Save(pingStats)
+	}, func(app core.App) error {
+		pingStats, err := app.FindCollectionByNameOrId("ping_stats")
+		if err != nil {
+			return err
+		}
+		pingStats.Fields.RemoveByName("address_family")
+		return app.Save(pingStats)
+	})
+}
@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// standard deviation of the per-reply RTTs
+		pingStats, err := app.FindCollectionByNameOrId("ping_stats")
+		if err != nil {
+			return err
+		}
+		pingStats.Fields.Add(&core.NumberField{
+			Id:   "ping_std_dev_rtt_number_id",
+			Name: "std_dev_rtt",
+		})
+		return app.Save(pingStats)
+	}, func(app core.App) error {
+		pingStats, err := app.FindCollectionByNameOrId("ping_stats")
+		if err != nil {
+			return err
+		}
+		pingStats.Fields.RemoveByName("std_dev_rtt")
+		return app.Save(pingStats)
+	})
+}
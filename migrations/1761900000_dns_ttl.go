@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// minimum TTL of the answer records in seconds
+		dnsStats, err := app.FindCollectionByNameOrId("dns_stats")
+		if err != nil {
+			return err
+		}
+		dnsStats.Fields.Add(&core.NumberField{
+			Id:      "dns_ttl_number_id",
+			Name:    "ttl",
+			OnlyInt: true,
+		})
+		return app.Save(dnsStats)
+	}, func(app core.App) error {
+		dnsStats, err := app.FindCollectionByNameOrId("dns_stats")
+		if err != nil {
+			return err
+		}
+		dnsStats.Fields.RemoveByName("ttl")
+		return app.Save(dnsStats)
+	})
+}
@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// whether the resolver validated the answer with DNSSEC (AD bit)
+		dnsStats, err := app.FindCollectionByNameOrId("dns_stats")
+		if err != nil {
+			return err
+		}
+		dnsStats.Fields.Add(&core.BoolField{
+			Id:   "dns_authenticated_bool_id",
+			Name: "authenticated",
+		})
+		return app.Save(dnsStats)
+	}, func(app core.App) error {
+		dnsStats, err := app.FindCollectionByNameOrId("dns_stats")
+		if err != nil {
+			return err
+		}
+		dnsStats.Fields.RemoveByName("authenticated")
+		return app.Save(dnsStats)
+	})
+}
@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// httpTimingFields are the request phases of HTTP checks in milliseconds
+var httpTimingFields = []string{"dns_time", "connect_time", "tls_time", "ttfb", "total_time"}
+
+func init() {
+	m.Register(func(app core.App) error {
+		httpStats, err := app.FindCollectionByNameOrId("http_stats")
+		if err != nil {
+			return err
+		}
+		for _, name := range httpTimingFields {
+			httpStats.Fields.Add(&core.NumberField{
+				Id:   "http_" + name + "_number_id",
+				Name: name,
+			})
+		}
+		return app.Save(httpStats)
+	}, func(app core.App) error {
+		httpStats, err := app.FindCollectionByNameOrId("http_stats")
+		if err != nil {
+			return err
+		}
+		for _, name := range httpTimingFields {
+			httpStats.Fields.RemoveByName(name)
+		}
+		return app.Save(httpStats)
+	})
+}
@@ -0,0 +1,54 @@
+package migrations
+
+import (
+	"slices"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// whole days until the leaf certificate of HTTPS targets expires
+		httpStats, err := app.FindCollectionByNameOrId("http_stats")
+		if err != nil {
+			return err
+		}
+		httpStats.Fields.Add(&core.NumberField{
+			Id:      "cert_expiry_days_number_id",
+			Name:    "cert_expiry_days",
+			OnlyInt: true,
+		})
+		if err := app.Save(httpStats); err != nil {
+			return err
+		}
+
+		// SSLCertExpiry alert type
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		if field, ok := alerts.Fields.GetByName("name").(*core.SelectField); ok && !slices.Contains(field.Values, "SSLCertExpiry") {
+			field.Values = append(field.Values, "SSLCertExpiry")
+		}
+		return app.Save(alerts)
+	}, func(app core.App) error {
+		httpStats, err := app.FindCollectionByNameOrId("http_stats")
+		if err != nil {
+			return err
+		}
+		httpStats.Fields.RemoveByName("cert_expiry_days")
+		if err := app.Save(httpStats); err != nil {
+			return err
+		}
+
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		if field, ok := alerts.Fields.GetByName("name").(*core.SelectField); ok {
+			field.Values = slices.DeleteFunc(field.Values, func(v string) bool { return v == "SSLCertExpiry" })
+		}
+		return app.Save(alerts)
+	})
+}
@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// redirects followed by HTTP checks and the URL they ended at
+		httpStats, err := app.FindCollectionByNameOrId("http_stats")
+		if err != nil {
+			return err
+		}
+		httpStats.Fields.Add(&core.NumberField{
+			Id:      "redirect_count_number_id",
+			Name:    "redirect_count",
+			OnlyInt: true,
+		})
+		httpStats.Fields.Add(&core.TextField{
+			Id:   "final_url_text_id",
+			Name: "final_url",
+		})
+		return app.Save(httpStats)
+	}, func(app core.App) error {
+		httpStats, err := app.FindCollectionByNameOrId("http_stats")
+		if err != nil {
+			return err
+		}
+		httpStats.Fields.RemoveByName("redirect_count")
+		httpStats.Fields.RemoveByName("final_url")
+		return app.Save(httpStats)
+	})
+}
@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// minutes repeated trigger notifications of an alert are held back, and when the last one was sent
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		alerts.Fields.Add(&core.NumberField{
+			Id:      "cooldown_number_id",
+			Name:    "cooldown",
+			OnlyInt: true,
+		})
+		alerts.Fields.Add(&core.DateField{
+			Id:   "last_notified_date_id",
+			Name: "last_notified",
+		})
+		return app.Save(alerts)
+	}, func(app core.App) error {
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		alerts.Fields.RemoveByName("cooldown")
+		alerts.Fields.RemoveByName("last_notified")
+		return app.Save(alerts)
+	})
+}
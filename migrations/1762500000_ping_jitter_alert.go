@@ -0,0 +1,49 @@
+package migrations
+
+import (
+	"slices"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// averaged ping jitter (collection may not exist on every install)
+		if averages, err := app.FindCollectionByNameOrId("system_averages"); err == nil {
+			averages.Fields.Add(&core.NumberField{
+				Id:   "ping_jitter_number_id",
+				Name: "ping_jitter",
+			})
+			if err := app.Save(averages); err != nil {
+				return err
+			}
+		}
+
+		// PingJitter alert type
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		if field, ok := alerts.Fields.GetByName("name").(*core.SelectField); ok && !slices.Contains(field.Values, "PingJitter") {
+			field.Values = append(field.Values, "PingJitter")
+		}
+		return app.Save(alerts)
+	}, func(app core.App) error {
+		if averages, err := app.FindCollectionByNameOrId("system_averages"); err == nil {
+			averages.Fields.RemoveByName("ping_jitter")
+			if err := app.Save(averages); err != nil {
+				return err
+			}
+		}
+
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		if field, ok := alerts.Fields.GetByName("name").(*core.SelectField); ok {
+			field.Values = slices.DeleteFunc(field.Values, func(v string) bool { return v == "PingJitter" })
+		}
+		return app.Save(alerts)
+	})
+}
@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// whether an alert is evaluated on the average of all targets or per target, empty means average
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		alerts.Fields.Add(&core.SelectField{
+			Id:        "aggregation_select_id",
+			Name:      "aggregation",
+			MaxSelect: 1,
+			Values:    []string{"avg", "max", "any"},
+		})
+		return app.Save(alerts)
+	}, func(app core.App) error {
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		alerts.Fields.RemoveByName("aggregation")
+		return app.Save(alerts)
+	})
+}
@@ -0,0 +1,49 @@
+package migrations
+
+import (
+	"slices"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// averaged share of 4xx and 5xx HTTP responses (collection may not exist on every install)
+		if averages, err := app.FindCollectionByNameOrId("system_averages"); err == nil {
+			averages.Fields.Add(&core.NumberField{
+				Id:   "http_error_rate_number_id",
+				Name: "http_error_rate",
+			})
+			if err := app.Save(averages); err != nil {
+				return err
+			}
+		}
+
+		// HTTPErrorRate alert type
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		if field, ok := alerts.Fields.GetByName("name").(*core.SelectField); ok && !slices.Contains(field.Values, "HTTPErrorRate") {
+			field.Values = append(field.Values, "HTTPErrorRate")
+		}
+		return app.Save(alerts)
+	}, func(app core.App) error {
+		if averages, err := app.FindCollectionByNameOrId("system_averages"); err == nil {
+			averages.Fields.RemoveByName("http_error_rate")
+			if err := app.Save(averages); err != nil {
+				return err
+			}
+		}
+
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		if field, ok := alerts.Fields.GetByName("name").(*core.SelectField); ok {
+			field.Values = slices.DeleteFunc(field.Values, func(v string) bool { return v == "HTTPErrorRate" })
+		}
+		return app.Save(alerts)
+	})
+}
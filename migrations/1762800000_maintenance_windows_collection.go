@@ -0,0 +1,77 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// periods alert notifications of a system are held back in, either from start to end
+		// or recurring at the times of a cron schedule for duration minutes
+		systems, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+
+		adminRule := types.Pointer("@request.auth.id != \"\" && @request.auth.role = \"admin\"")
+		windows := core.NewBaseCollection("maintenance_windows", "maintenance_windows_collection_id")
+		windows.ListRule = types.Pointer("@request.auth.id != \"\"")
+		windows.ViewRule = types.Pointer("@request.auth.id != \"\"")
+		windows.CreateRule = adminRule
+		windows.UpdateRule = adminRule
+		windows.DeleteRule = adminRule
+		windows.Fields.Add(
+			&core.RelationField{
+				Id:            "maintenance_windows_system_relation_id",
+				Name:          "system",
+				CollectionId:  systems.Id,
+				CascadeDelete: true,
+				MaxSelect:     1,
+				Required:      true,
+			},
+			&core.DateField{
+				Id:   "maintenance_windows_start_date_id",
+				Name: "start",
+			},
+			&core.DateField{
+				Id:   "maintenance_windows_end_date_id",
+				Name: "end",
+			},
+			&core.TextField{
+				Id:   "maintenance_windows_schedule_text_id",
+				Name: "schedule",
+				Max:  200,
+			},
+			&core.NumberField{
+				Id:      "maintenance_windows_duration_number_id",
+				Name:    "duration",
+				OnlyInt: true,
+			},
+			&core.TextField{
+				Id:   "maintenance_windows_note_text_id",
+				Name: "note",
+				Max:  200,
+			},
+			&core.AutodateField{
+				Id:       "maintenance_windows_created_date_id",
+				Name:     "created",
+				OnCreate: true,
+			},
+			&core.AutodateField{
+				Id:       "maintenance_windows_updated_date_id",
+				Name:     "updated",
+				OnCreate: true,
+				OnUpdate: true,
+			},
+		)
+		return app.Save(windows)
+	}, func(app core.App) error {
+		windows, err := app.FindCollectionByNameOrId("maintenance_windows")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(windows)
+	})
+}
@@ -0,0 +1,108 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// hourlyStats describes a collection old stats rows are rolled up into
+type hourlyStats struct {
+	name   string   // collection name
+	target string   // text column of the target the rows are grouped by
+	values []string // number columns of the aggregates
+}
+
+var hourlyStatsCollections = []hourlyStats{
+	{name: "ping_stats_hourly", target: "host", values: []string{"avg_rtt", "min_rtt", "max_rtt", "packet_loss"}},
+	{name: "dns_stats_hourly", target: "domain", values: []string{"lookup_time", "min_lookup_time", "max_lookup_time", "failures"}},
+	{name: "http_stats_hourly", target: "url", values: []string{"response_time", "min_response_time", "max_response_time", "failures"}},
+	{name: "speedtest_stats_hourly", target: "server_id", values: []string{
+		"download_speed", "min_download_speed", "max_download_speed",
+		"upload_speed", "min_upload_speed", "max_upload_speed",
+		"latency", "failures",
+	}},
+}
+
+func init() {
+	m.Register(func(app core.App) error {
+		// hourly aggregates of the stats rows older than BESZEL_ROLLUP_AFTER_DAYS
+		systems, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+
+		for _, stats := range hourlyStatsCollections {
+			collection := core.NewBaseCollection(stats.name, stats.name+"_collection_id")
+			collection.ListRule = types.Pointer("@request.auth.id != \"\"")
+			collection.ViewRule = types.Pointer("@request.auth.id != \"\"")
+			collection.Fields.Add(
+				&core.RelationField{
+					Id:            stats.name + "_system_relation_id",
+					Name:          "system",
+					CollectionId:  systems.Id,
+					CascadeDelete: true,
+					MaxSelect:     1,
+					Required:      true,
+				},
+				&core.TextField{
+					Id:   stats.name + "_" + stats.target + "_text_id",
+					Name: stats.target,
+				},
+				&core.DateField{
+					Id:       stats.name + "_hour_date_id",
+					Name:     "hour",
+					Required: true,
+				},
+				// rows rolled up into the hour
+				&core.NumberField{
+					Id:      stats.name + "_count_number_id",
+					Name:    "count",
+					OnlyInt: true,
+				},
+				// rows the averages are over
+				&core.NumberField{
+					Id:      stats.name + "_samples_number_id",
+					Name:    "samples",
+					OnlyInt: true,
+				},
+			)
+			for _, value := range stats.values {
+				collection.Fields.Add(&core.NumberField{
+					Id:   stats.name + "_" + value + "_number_id",
+					Name: value,
+				})
+			}
+			collection.Fields.Add(
+				&core.AutodateField{
+					Id:       stats.name + "_created_date_id",
+					Name:     "created",
+					OnCreate: true,
+				},
+				&core.AutodateField{
+					Id:       stats.name + "_updated_date_id",
+					Name:     "updated",
+					OnCreate: true,
+					OnUpdate: true,
+				},
+			)
+			// the rollup merges rows of the same hour into a single record
+			collection.AddIndex("idx_"+stats.name+"_hour", true, "system, "+stats.target+", hour", "")
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(app core.App) error {
+		for _, stats := range hourlyStatsCollections {
+			collection, err := app.FindCollectionByNameOrId(stats.name)
+			if err != nil {
+				continue
+			}
+			if err := app.Delete(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
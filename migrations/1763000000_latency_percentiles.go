@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// latencyPercentileFields are the 95th and 99th percentiles stored alongside the averages
+var latencyPercentileFields = []string{"ping_p95", "ping_p99", "dns_p95", "dns_p99", "http_p95", "http_p99"}
+
+func init() {
+	m.Register(func(app core.App) error {
+		// tail latencies of the averaged records (collection may not exist on every install)
+		averages, err := app.FindCollectionByNameOrId("system_averages")
+		if err != nil {
+			return nil
+		}
+		for _, name := range latencyPercentileFields {
+			averages.Fields.Add(&core.NumberField{
+				Id:   name + "_number_id",
+				Name: name,
+			})
+		}
+		return app.Save(averages)
+	}, func(app core.App) error {
+		averages, err := app.FindCollectionByNameOrId("system_averages")
+		if err != nil {
+			return nil
+		}
+		for _, name := range latencyPercentileFields {
+			averages.Fields.RemoveByName(name)
+		}
+		return app.Save(averages)
+	})
+}
@@ -0,0 +1,75 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// alerts on the speedtest average of all systems with a tag
+		groupAlerts := core.NewBaseCollection("group_alerts", "group_alerts_collection_id")
+		groupAlerts.ListRule = types.Pointer("@request.auth.id != \"\"")
+		groupAlerts.ViewRule = types.Pointer("@request.auth.id != \"\"")
+		groupAlerts.CreateRule = types.Pointer("@request.auth.id != \"\" && @request.auth.role = \"admin\"")
+		groupAlerts.UpdateRule = types.Pointer("@request.auth.id != \"\" && @request.auth.role = \"admin\"")
+		groupAlerts.DeleteRule = types.Pointer("@request.auth.id != \"\" && @request.auth.role = \"admin\"")
+		groupAlerts.Fields.Add(
+			&core.TextField{
+				Id:       "group_alerts_name_text_id",
+				Name:     "name",
+				Max:      100,
+				Required: true,
+			},
+			&core.TextField{
+				Id:       "group_alerts_tag_text_id",
+				Name:     "tag",
+				Max:      100,
+				Required: true,
+			},
+			&core.SelectField{
+				Id:        "group_alerts_metric_select_id",
+				Name:      "metric",
+				Values:    []string{"download", "upload", "latency"},
+				MaxSelect: 1,
+				Required:  true,
+			},
+			&core.NumberField{
+				Id:       "group_alerts_threshold_number_id",
+				Name:     "threshold",
+				Min:      types.Pointer(0.0),
+				Required: true,
+			},
+			&core.NumberField{
+				Id:      "group_alerts_window_minutes_number_id",
+				Name:    "window_minutes",
+				Min:     types.Pointer(1.0),
+				OnlyInt: true,
+			},
+			&core.BoolField{
+				Id:   "group_alerts_triggered_bool_id",
+				Name: "triggered",
+			},
+			&core.AutodateField{
+				Id:       "group_alerts_created_date_id",
+				Name:     "created",
+				OnCreate: true,
+			},
+			&core.AutodateField{
+				Id:       "group_alerts_updated_date_id",
+				Name:     "updated",
+				OnCreate: true,
+				OnUpdate: true,
+			},
+		)
+		groupAlerts.AddIndex("idx_group_alerts_tag", false, "tag", "")
+		return app.Save(groupAlerts)
+	}, func(app core.App) error {
+		groupAlerts, err := app.FindCollectionByNameOrId("group_alerts")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(groupAlerts)
+	})
+}
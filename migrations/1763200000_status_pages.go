@@ -0,0 +1,75 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// public read-only status pages of a set of systems, shared through their token
+		systems, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+
+		ownerRule := types.Pointer("@request.auth.id != \"\" && owner = @request.auth.id")
+		pages := core.NewBaseCollection("status_pages", "status_pages_collection_id")
+		pages.ListRule = ownerRule
+		pages.ViewRule = ownerRule
+		pages.CreateRule = types.Pointer("@request.auth.id != \"\" && @request.body.owner = @request.auth.id")
+		pages.UpdateRule = types.Pointer("@request.auth.id != \"\" && owner = @request.auth.id && (@request.body.owner:isset = false || @request.body.owner = @request.auth.id)")
+		pages.DeleteRule = ownerRule
+		pages.Fields.Add(
+			&core.TextField{
+				Id:       "status_pages_name_text_id",
+				Name:     "name",
+				Max:      100,
+				Required: true,
+			},
+			&core.TextField{
+				Id:                  "status_pages_token_text_id",
+				Name:                "token",
+				Min:                 24,
+				Max:                 64,
+				Pattern:             "^[a-zA-Z0-9_-]+$",
+				AutogeneratePattern: "[a-zA-Z0-9]{32}",
+				Required:            true,
+			},
+			&core.RelationField{
+				Id:           "status_pages_systems_relation_id",
+				Name:         "systems",
+				CollectionId: systems.Id,
+				MaxSelect:    999,
+			},
+			&core.RelationField{
+				Id:            "status_pages_owner_relation_id",
+				Name:          "owner",
+				CollectionId:  "_pb_users_auth_",
+				CascadeDelete: true,
+				MaxSelect:     1,
+				Required:      true,
+			},
+			&core.AutodateField{
+				Id:       "status_pages_created_date_id",
+				Name:     "created",
+				OnCreate: true,
+			},
+			&core.AutodateField{
+				Id:       "status_pages_updated_date_id",
+				Name:     "updated",
+				OnCreate: true,
+				OnUpdate: true,
+			},
+		)
+		pages.AddIndex("idx_status_pages_token", true, "token", "")
+		return app.Save(pages)
+	}, func(app core.App) error {
+		pages, err := app.FindCollectionByNameOrId("status_pages")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(pages)
+	})
+}
@@ -0,0 +1,66 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// up and down transitions of the systems, the source of their uptime
+		systems, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+
+		history := core.NewBaseCollection("status_history", "status_history_collection_id")
+		history.ListRule = types.Pointer("@request.auth.id != \"\"")
+		history.ViewRule = types.Pointer("@request.auth.id != \"\"")
+		history.Fields.Add(
+			&core.RelationField{
+				Id:            "status_history_system_relation_id",
+				Name:          "system",
+				CollectionId:  systems.Id,
+				CascadeDelete: true,
+				MaxSelect:     1,
+				Required:      true,
+			},
+			&core.SelectField{
+				Id:        "status_history_status_select_id",
+				Name:      "status",
+				Values:    []string{"up", "down"},
+				MaxSelect: 1,
+				Required:  true,
+			},
+			&core.AutodateField{
+				Id:       "status_history_created_date_id",
+				Name:     "created",
+				OnCreate: true,
+			},
+		)
+		history.AddIndex("idx_status_history_system_created", false, "system, created", "")
+		if err := app.Save(history); err != nil {
+			return err
+		}
+
+		// uptime percentages over rolling windows, like {"24h": 99.95, "7d": 99.9, "30d": 99.8}
+		systems.Fields.Add(&core.JSONField{
+			Id:   "uptime_json_id",
+			Name: "uptime",
+		})
+		return app.Save(systems)
+	}, func(app core.App) error {
+		if systems, err := app.FindCollectionByNameOrId("systems"); err == nil {
+			systems.Fields.RemoveByName("uptime")
+			if err := app.Save(systems); err != nil {
+				return err
+			}
+		}
+		history, err := app.FindCollectionByNameOrId("status_history")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(history)
+	})
+}
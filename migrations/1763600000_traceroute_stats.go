@@ -0,0 +1,110 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// paths to traceroute targets measured by the agent
+		systems, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+
+		collection := core.NewBaseCollection("traceroute_stats", "traceroute_stats_collection_id")
+		collection.ListRule = types.Pointer("@request.auth.id != \"\"")
+		collection.ViewRule = types.Pointer("@request.auth.id != \"\"")
+		collection.Fields.Add(
+			&core.RelationField{
+				Id:            "traceroute_stats_system_relation_id",
+				Name:          "system",
+				CollectionId:  systems.Id,
+				CascadeDelete: true,
+				MaxSelect:     1,
+				Required:      true,
+			},
+			&core.TextField{
+				Id:   "traceroute_stats_host_text_id",
+				Name: "host",
+			},
+			// success if the target replied, incomplete if it didn't, or error
+			&core.TextField{
+				Id:   "traceroute_stats_status_text_id",
+				Name: "status",
+			},
+			// mtr or traceroute
+			&core.TextField{
+				Id:   "traceroute_stats_tool_text_id",
+				Name: "tool",
+			},
+			&core.TextField{
+				Id:   "traceroute_stats_error_code_text_id",
+				Name: "error_code",
+			},
+			&core.NumberField{
+				Id:      "traceroute_stats_hop_count_number_id",
+				Name:    "hop_count",
+				OnlyInt: true,
+			},
+			// address, loss and latencies of each hop
+			&core.JSONField{
+				Id:   "traceroute_stats_hops_json_id",
+				Name: "hops",
+			},
+			// loss and latency of the last hop
+			&core.NumberField{
+				Id:   "traceroute_stats_loss_number_id",
+				Name: "loss",
+			},
+			&core.NumberField{
+				Id:   "traceroute_stats_avg_rtt_number_id",
+				Name: "avg_rtt",
+			},
+			&core.AutodateField{
+				Id:       "traceroute_stats_created_date_id",
+				Name:     "created",
+				OnCreate: true,
+			},
+			&core.AutodateField{
+				Id:       "traceroute_stats_updated_date_id",
+				Name:     "updated",
+				OnCreate: true,
+				OnUpdate: true,
+			},
+		)
+		collection.AddIndex("idx_traceroute_stats_system_created", false, "system, created", "")
+		collection.AddIndex("idx_traceroute_stats_created", false, "created", "")
+		if err := app.Save(collection); err != nil {
+			return err
+		}
+
+		monitoringConfig, err := app.FindCollectionByNameOrId("monitoring_config")
+		if err != nil {
+			return err
+		}
+		monitoringConfig.Fields.Add(&core.JSONField{
+			Id:      "traceroute",
+			Name:    "traceroute",
+			MaxSize: 2000000,
+		})
+		return app.Save(monitoringConfig)
+	}, func(app core.App) error {
+		monitoringConfig, err := app.FindCollectionByNameOrId("monitoring_config")
+		if err != nil {
+			return err
+		}
+		monitoringConfig.Fields.RemoveByName("traceroute")
+		if err := app.Save(monitoringConfig); err != nil {
+			return err
+		}
+
+		collection, err := app.FindCollectionByNameOrId("traceroute_stats")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(collection)
+	})
+}
@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// whether a check used a connection kept alive from an earlier one,
+		// in which case it has no DNS, connect or TLS time
+		httpStats, err := app.FindCollectionByNameOrId("http_stats")
+		if err != nil {
+			return err
+		}
+		httpStats.Fields.Add(&core.BoolField{
+			Id:   "connection_reused_bool_id",
+			Name: "connection_reused",
+		})
+		return app.Save(httpStats)
+	}, func(app core.App) error {
+		httpStats, err := app.FindCollectionByNameOrId("http_stats")
+		if err != nil {
+			return err
+		}
+		httpStats.Fields.RemoveByName("connection_reused")
+		return app.Save(httpStats)
+	})
+}
@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// answers of each server of a resolver comparison, to show how they diverge
+		dnsStats, err := app.FindCollectionByNameOrId("dns_stats")
+		if err != nil {
+			return err
+		}
+		dnsStats.Fields.Add(&core.JSONField{
+			Id:   "server_answers_json_id",
+			Name: "server_answers",
+		})
+		return app.Save(dnsStats)
+	}, func(app core.App) error {
+		dnsStats, err := app.FindCollectionByNameOrId("dns_stats")
+		if err != nil {
+			return err
+		}
+		dnsStats.Fields.RemoveByName("server_answers")
+		return app.Save(dnsStats)
+	})
+}
@@ -0,0 +1,62 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// download and upload speed of the system's internet plan in Mbps
+		systems, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+		systems.Fields.Add(
+			&core.NumberField{
+				Id:   "plan_download_number_id",
+				Name: "plan_download",
+				Min:  types.Pointer(0.0),
+			},
+			&core.NumberField{
+				Id:   "plan_upload_number_id",
+				Name: "plan_upload",
+				Min:  types.Pointer(0.0),
+			},
+		)
+		if err := app.Save(systems); err != nil {
+			return err
+		}
+
+		// whether the threshold of a speedtest alert is a speed or a percentage of the plan, empty means a speed
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		alerts.Fields.Add(&core.SelectField{
+			Id:        "threshold_mode_select_id",
+			Name:      "threshold_mode",
+			MaxSelect: 1,
+			Values:    []string{"absolute", "percent_of_plan"},
+		})
+		return app.Save(alerts)
+	}, func(app core.App) error {
+		alerts, err := app.FindCollectionByNameOrId("alerts")
+		if err != nil {
+			return err
+		}
+		alerts.Fields.RemoveByName("threshold_mode")
+		if err := app.Save(alerts); err != nil {
+			return err
+		}
+
+		systems, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+		systems.Fields.RemoveByName("plan_download")
+		systems.Fields.RemoveByName("plan_upload")
+		return app.Save(systems)
+	})
+}
@@ -0,0 +1,96 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// values and counter rates of the devices polled over SNMP by the agent
+		systems, err := app.FindCollectionByNameOrId("systems")
+		if err != nil {
+			return err
+		}
+
+		collection := core.NewBaseCollection("snmp_stats", "snmp_stats_collection_id")
+		collection.ListRule = types.Pointer("@request.auth.id != \"\"")
+		collection.ViewRule = types.Pointer("@request.auth.id != \"\"")
+		collection.Fields.Add(
+			&core.RelationField{
+				Id:            "snmp_stats_system_relation_id",
+				Name:          "system",
+				CollectionId:  systems.Id,
+				CascadeDelete: true,
+				MaxSelect:     1,
+				Required:      true,
+			},
+			&core.TextField{
+				Id:   "snmp_stats_host_text_id",
+				Name: "host",
+			},
+			// success if every OID had a value, partial if some didn't, or error
+			&core.TextField{
+				Id:   "snmp_stats_status_text_id",
+				Name: "status",
+			},
+			&core.TextField{
+				Id:   "snmp_stats_error_code_text_id",
+				Name: "error_code",
+			},
+			// milliseconds the device took to answer
+			&core.NumberField{
+				Id:   "snmp_stats_poll_time_number_id",
+				Name: "poll_time",
+			},
+			// OID, name, type, value and rate of each polled value
+			&core.JSONField{
+				Id:   "snmp_stats_values_json_id",
+				Name: "values",
+			},
+			&core.AutodateField{
+				Id:       "snmp_stats_created_date_id",
+				Name:     "created",
+				OnCreate: true,
+			},
+			&core.AutodateField{
+				Id:       "snmp_stats_updated_date_id",
+				Name:     "updated",
+				OnCreate: true,
+				OnUpdate: true,
+			},
+		)
+		collection.AddIndex("idx_snmp_stats_system_created", false, "system, created", "")
+		collection.AddIndex("idx_snmp_stats_created", false, "created", "")
+		if err := app.Save(collection); err != nil {
+			return err
+		}
+
+		monitoringConfig, err := app.FindCollectionByNameOrId("monitoring_config")
+		if err != nil {
+			return err
+		}
+		monitoringConfig.Fields.Add(&core.JSONField{
+			Id:      "snmp",
+			Name:    "snmp",
+			MaxSize: 2000000,
+		})
+		return app.Save(monitoringConfig)
+	}, func(app core.App) error {
+		monitoringConfig, err := app.FindCollectionByNameOrId("monitoring_config")
+		if err != nil {
+			return err
+		}
+		monitoringConfig.Fields.RemoveByName("snmp")
+		if err := app.Save(monitoringConfig); err != nil {
+			return err
+		}
+
+		collection, err := app.FindCollectionByNameOrId("snmp_stats")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(collection)
+	})
+}
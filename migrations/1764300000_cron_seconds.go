@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// intervals of the monitoring configuration are cron expressions with a leading seconds field
+		monitoringConfig, err := app.FindCollectionByNameOrId("monitoring_config")
+		if err != nil {
+			return err
+		}
+		monitoringConfig.Fields.Add(&core.BoolField{
+			Id:   "cron_seconds_bool_id",
+			Name: "cron_seconds",
+		})
+		return app.Save(monitoringConfig)
+	}, func(app core.App) error {
+		monitoringConfig, err := app.FindCollectionByNameOrId("monitoring_config")
+		if err != nil {
+			return err
+		}
+		monitoringConfig.Fields.RemoveByName("cron_seconds")
+		return app.Save(monitoringConfig)
+	})
+}
@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// scheduled checks of each target start at a phase offset instead of all at once
+		monitoringConfig, err := app.FindCollectionByNameOrId("monitoring_config")
+		if err != nil {
+			return err
+		}
+		monitoringConfig.Fields.Add(&core.BoolField{
+			Id:   "jitter_bool_id",
+			Name: "jitter",
+		})
+		return app.Save(monitoringConfig)
+	}, func(app core.App) error {
+		monitoringConfig, err := app.FindCollectionByNameOrId("monitoring_config")
+		if err != nil {
+			return err
+		}
+		monitoringConfig.Fields.RemoveByName("jitter")
+		return app.Save(monitoringConfig)
+	})
+}
@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// services of a system paused on their own, the others keep running
+		monitoringConfig, err := app.FindCollectionByNameOrId("monitoring_config")
+		if err != nil {
+			return err
+		}
+		monitoringConfig.Fields.Add(&core.SelectField{
+			Id:        "paused_select_id",
+			Name:      "paused",
+			MaxSelect: 6,
+			Values:    []string{"ping", "dns", "http", "speedtest", "traceroute", "snmp"},
+		})
+		return app.Save(monitoringConfig)
+	}, func(app core.App) error {
+		monitoringConfig, err := app.FindCollectionByNameOrId("monitoring_config")
+		if err != nil {
+			return err
+		}
+		monitoringConfig.Fields.RemoveByName("paused")
+		return app.Save(monitoringConfig)
+	})
+}
@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// address a lookup was sent from, telling apart the paths of the same lookup
+		dnsStats, err := app.FindCollectionByNameOrId("dns_stats")
+		if err != nil {
+			return err
+		}
+		dnsStats.Fields.Add(&core.TextField{
+			Id:   "source_ip_text_id",
+			Name: "source_ip",
+		})
+		return app.Save(dnsStats)
+	}, func(app core.App) error {
+		dnsStats, err := app.FindCollectionByNameOrId("dns_stats")
+		if err != nil {
+			return err
+		}
+		dnsStats.Fields.RemoveByName("source_ip")
+		return app.Save(dnsStats)
+	})
+}
@@ -0,0 +1,70 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// dnsHourlyTargets are the columns of dns_stats besides domain telling its targets apart
+var dnsHourlyTargets = []string{"server", "type", "source_ip"}
+
+func init() {
+	m.Register(func(app core.App) error {
+		// record type of a lookup, which the hub sent without a column to store it in
+		dnsStats, err := app.FindCollectionByNameOrId("dns_stats")
+		if err != nil {
+			return err
+		}
+		dnsStats.Fields.Add(&core.TextField{
+			Id:   "dns_type_text_id",
+			Name: "type",
+		})
+		if err := app.Save(dnsStats); err != nil {
+			return err
+		}
+
+		// hourly DNS rows of the same domain on different servers, of different types or from
+		// different source addresses are kept apart. Earlier rows keep empty values.
+		hourly, err := app.FindCollectionByNameOrId("dns_stats_hourly")
+		if err != nil {
+			return err
+		}
+		for _, target := range dnsHourlyTargets {
+			hourly.Fields.Add(&core.TextField{
+				Id:   "dns_stats_hourly_" + target + "_text_id",
+				Name: target,
+			})
+		}
+		hourly.RemoveIndex("idx_dns_stats_hourly_hour")
+		hourly.AddIndex("idx_dns_stats_hourly_hour", true, "system, domain, server, type, source_ip, hour", "")
+		return app.Save(hourly)
+	}, func(app core.App) error {
+		hourly, err := app.FindCollectionByNameOrId("dns_stats_hourly")
+		if err != nil {
+			return err
+		}
+		// rows of the same domain and hour can't be merged back, so all but one of them are dropped
+		if _, err := app.DB().NewQuery(`
+			DELETE FROM {{dns_stats_hourly}} WHERE [[id]] NOT IN (
+				SELECT MIN([[id]]) FROM {{dns_stats_hourly}} GROUP BY [[system]], [[domain]], [[hour]]
+			)
+		`).Execute(); err != nil {
+			return err
+		}
+		hourly.RemoveIndex("idx_dns_stats_hourly_hour")
+		hourly.AddIndex("idx_dns_stats_hourly_hour", true, "system, domain, hour", "")
+		for _, target := range dnsHourlyTargets {
+			hourly.Fields.RemoveByName(target)
+		}
+		if err := app.Save(hourly); err != nil {
+			return err
+		}
+
+		dnsStats, err := app.FindCollectionByNameOrId("dns_stats")
+		if err != nil {
+			return err
+		}
+		dnsStats.Fields.RemoveByName("type")
+		return app.Save(dnsStats)
+	})
+}
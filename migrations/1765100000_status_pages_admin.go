@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// status pages make systems public, so like other shared settings only admins manage them
+		pages, err := app.FindCollectionByNameOrId("status_pages")
+		if err != nil {
+			return err
+		}
+		pages.CreateRule = types.Pointer("@request.auth.id != \"\" && @request.auth.role = \"admin\" && @request.body.owner = @request.auth.id")
+		pages.UpdateRule = types.Pointer("@request.auth.id != \"\" && @request.auth.role = \"admin\" && owner = @request.auth.id && (@request.body.owner:isset = false || @request.body.owner = @request.auth.id)")
+		return app.Save(pages)
+	}, func(app core.App) error {
+		pages, err := app.FindCollectionByNameOrId("status_pages")
+		if err != nil {
+			return err
+		}
+		pages.CreateRule = types.Pointer("@request.auth.id != \"\" && @request.body.owner = @request.auth.id")
+		pages.UpdateRule = types.Pointer("@request.auth.id != \"\" && owner = @request.auth.id && (@request.body.owner:isset = false || @request.body.owner = @request.auth.id)")
+		return app.Save(pages)
+	})
+}
@@ -0,0 +1,43 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// rolledUpCollections are the rolled up stats collections whose failed rows outlive their rollup
+var rolledUpCollections = []string{"dns_stats", "http_stats", "speedtest_stats"}
+
+func init() {
+	m.Register(func(app core.App) error {
+		// failed rows are kept for the failure retention after their hour was rolled up, the flag
+		// keeps later rollups from counting them again
+		for _, name := range rolledUpCollections {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+			collection.Fields.Add(&core.BoolField{
+				Id:     name + "_rolled_up_bool_id",
+				Name:   "rolled_up",
+				Hidden: true,
+			})
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(app core.App) error {
+		for _, name := range rolledUpCollections {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+			collection.Fields.RemoveByName("rolled_up")
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// a required number field rejects 0, which is a valid threshold, so the hub checks it is set instead
+		return setGroupAlertThresholdRequired(app, false)
+	}, func(app core.App) error {
+		return setGroupAlertThresholdRequired(app, true)
+	})
+}
+
+func setGroupAlertThresholdRequired(app core.App, required bool) error {
+	groupAlerts, err := app.FindCollectionByNameOrId("group_alerts")
+	if err != nil {
+		return err
+	}
+	threshold, ok := groupAlerts.Fields.GetByName("threshold").(*core.NumberField)
+	if !ok {
+		return nil
+	}
+	threshold.Required = required
+	return app.Save(groupAlerts)
+}
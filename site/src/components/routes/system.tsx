@@ -9,7 +9,7 @@ import { SystemRecord, PingStatsRecord, DnsStatsRecord, HttpStatsRecord, Speedte
 import React, { lazy, useEffect, useMemo, useState } from "react"
 import { Card, CardHeader, CardTitle, CardDescription } from "../ui/card"
 import { useStore } from "@nanostores/react"
-import { GlobeIcon, MonitorIcon, EthernetPortIcon, LayoutGridIcon, Building2Icon, RouteIcon, TagsIcon } from "lucide-react"
+import { GlobeIcon, MonitorIcon, EthernetPortIcon, LayoutGridIcon, Building2Icon, RouteIcon, TagsIcon, ActivityIcon } from "lucide-react"
 import { Rows } from "../ui/icons"
 import {
 	cn,
@@ -152,7 +152,7 @@ export default function SystemDetail({ name }: { name: string }) {
 				id: system.id,
 				created: getPbTimestamp(chartTime, undefined),
 			}),
-			fields: "domain,server,type,status,lookup_time,error_code,created",
+			fields: "domain,server,type,status,lookup_time,error_code,answers,server_answers,ttl,created",
 			sort: "created",
 		}).then((records) => {
 			setDnsStats(records)
@@ -334,6 +334,9 @@ export default function SystemDetail({ name }: { name: string }) {
 					status: record.status,
 					lookup_time: record.lookup_time,
 					error_code: record.error_code,
+					answers: record.answers,
+					server_answers: record.server_answers,
+					ttl: record.ttl,
 				}
 				
 				prevDnsTimestamp = timestamp
@@ -753,6 +756,12 @@ export default function SystemDetail({ name }: { name: string }) {
 				label: t`ASN`,
 				hide: !system.info.asn,
 			},
+			{
+				value: system.info.rtt ? `${system.info.rtt.toFixed(1)} ms` : undefined,
+				Icon: ActivityIcon,
+				label: t`Hub latency`,
+				hide: !system.info.rtt,
+			},
 			{
 				value: system.tags && system.tags.length > 0 ? system.tags.join(", ") : undefined,
 				Icon: TagsIcon,
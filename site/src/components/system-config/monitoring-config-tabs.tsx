@@ -11,6 +11,10 @@ export interface PingTarget {
   friendly_name?: string
   count: number
   timeout: number
+  mode?: "" | "mtu"
+  address_family?: "" | "auto" | "ipv4" | "ipv6"
+  packet_size?: number
+  interval_ms?: number
 }
 
 export interface DnsTarget {
@@ -20,18 +24,50 @@ export interface DnsTarget {
   timeout: number
   friendly_name?: string
   protocol?: "udp" | "tcp" | "doh" | "dot"
+  allowed_cidrs?: string[]
+  expected_values?: string[]
+  dnssec?: boolean
+  client_subnet?: string
+  source_ip?: string
+  servers?: string[]
 }
 
 export interface HttpTarget {
   url: string
   friendly_name?: string
   timeout: number
+  server_name?: string
+  host?: string
+  check_ocsp?: boolean
+  method?: "GET" | "HEAD" | "POST" | "PUT" | "PATCH" | "DELETE" | "OPTIONS"
+  headers?: Record<string, string>
+  body?: string
+  expected_status_codes?: number[]
+  body_match?: string
+  follow_redirects?: boolean
+  measure_throughput?: boolean
+  max_download_bytes?: number
+  reuse_connection?: boolean
+  proxy_url?: string
 }
 
+const HTTP_METHODS = ["GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"] as const
+
 export interface SpeedtestTarget {
   server_id: string
+  server_host?: string
   friendly_name?: string
   timeout: number
+  min_speed?: number
+  max_speed?: number
+  min_download?: number
+  max_download?: number
+  min_upload?: number
+  max_upload?: number
+  provider?: "ookla" | "cloudflare" | "librespeed" | "http"
+  url?: string
+  retries?: number
+  monthly_byte_budget?: number
 }
 
 export function ExpectedPerformanceTab({
@@ -230,7 +266,7 @@ export function PingConfigTab({
     })
   }
 
-  const updateTargetNumber = (index: number, field: 'count' | 'timeout', value: number) => {
+  const updateTargetNumber = (index: number, field: 'count' | 'timeout' | 'packet_size' | 'interval_ms', value: number) => {
     setPingConfig({
       ...pingConfig,
       targets: pingConfig.targets.map((target, i) => 
@@ -337,6 +373,27 @@ export function PingConfigTab({
                         onChange={(e) => updateTargetNumber(index, 'timeout', parseInt(e.target.value) || 1)}
                       />
                     </div>
+                    <div className="space-y-2">
+                      <Label>Packet Size (bytes, Optional)</Label>
+                      <Input
+                        type="number"
+                        min="28"
+                        max="65507"
+                        placeholder="56"
+                        value={target.packet_size || ''}
+                        onChange={(e) => updateTargetNumber(index, 'packet_size', parseInt(e.target.value) || 0)}
+                      />
+                    </div>
+                    <div className="space-y-2">
+                      <Label>Packet Interval (ms, Optional)</Label>
+                      <Input
+                        type="number"
+                        min="10"
+                        placeholder="1000"
+                        value={target.interval_ms || ''}
+                        onChange={(e) => updateTargetNumber(index, 'interval_ms', parseInt(e.target.value) || 0)}
+                      />
+                    </div>
                   </div>
                 </CardContent>
               </Card>
@@ -380,7 +437,7 @@ export function DnsConfigTab({
     })
   }
 
-  const updateTargetString = (index: number, field: 'domain' | 'server' | 'friendly_name', value: string) => {
+  const updateTargetString = (index: number, field: 'domain' | 'server' | 'friendly_name' | 'source_ip', value: string) => {
     setDnsConfig({
       ...dnsConfig,
       targets: dnsConfig.targets.map((target, i) => 
@@ -402,6 +459,18 @@ export function DnsConfigTab({
     })
   }
 
+  const updateTargetServers = (index: number, value: string) => {
+    const servers = value.split(',').map((server) => server.trim()).filter(Boolean)
+    setDnsConfig({
+      ...dnsConfig,
+      targets: dnsConfig.targets.map((target, i) => 
+        i === index 
+          ? { ...target, servers: servers.length > 0 ? servers : undefined }
+          : target
+      )
+    })
+  }
+
   const updateTargetProtocol = (index: number, value: "udp" | "tcp" | "doh" | "dot") => {
     setDnsConfig({
       ...dnsConfig,
@@ -549,6 +618,28 @@ export function DnsConfigTab({
                         onChange={(e) => updateTargetNumber(index, 'timeout', parseInt(e.target.value) || 1)}
                       />
                     </div>
+                    <div className="space-y-2">
+                      <Label>Source IP (Optional)</Label>
+                      <Input
+                        placeholder="192.168.1.2"
+                        value={target.source_ip || ''}
+                        onChange={(e) => updateTargetString(index, 'source_ip', e.target.value)}
+                      />
+                      <p className="text-sm text-muted-foreground">
+                        Local address to send queries from, it must be assigned to the agent
+                      </p>
+                    </div>
+                    <div className="space-y-2">
+                      <Label>Compare Servers (Optional)</Label>
+                      <Input
+                        placeholder="192.168.1.1, 8.8.8.8"
+                        defaultValue={target.servers?.join(', ') || ''}
+                        onBlur={(e) => updateTargetServers(index, e.target.value)}
+                      />
+                      <p className="text-sm text-muted-foreground">
+                        Query the domain on each of these servers instead of the DNS server and flag differing answers
+                      </p>
+                    </div>
                   </div>
                 </CardContent>
               </Card>
@@ -589,7 +680,7 @@ export function HttpConfigTab({
     })
   }
 
-  const updateTargetString = (index: number, field: 'url' | 'friendly_name', value: string) => {
+  const updateTargetString = (index: number, field: 'url' | 'friendly_name' | 'method' | 'body' | 'body_match' | 'proxy_url', value: string) => {
     setHttpConfig({
       ...httpConfig,
       targets: httpConfig.targets.map((target, i) => 
@@ -600,7 +691,7 @@ export function HttpConfigTab({
     })
   }
 
-  const updateTargetNumber = (index: number, field: 'timeout', value: number) => {
+  const updateTargetNumber = (index: number, field: 'timeout' | 'max_download_bytes', value: number) => {
     setHttpConfig({
       ...httpConfig,
       targets: httpConfig.targets.map((target, i) => 
@@ -611,6 +702,54 @@ export function HttpConfigTab({
     })
   }
 
+  const updateMeasureThroughput = (index: number, value: boolean) => {
+    setHttpConfig({
+      ...httpConfig,
+      targets: httpConfig.targets.map((target, i) => 
+        i === index 
+          ? { ...target, measure_throughput: value }
+          : target
+      )
+    })
+  }
+
+  const updateReuseConnection = (index: number, value: boolean) => {
+    setHttpConfig({
+      ...httpConfig,
+      targets: httpConfig.targets.map((target, i) => 
+        i === index 
+          ? { ...target, reuse_connection: value }
+          : target
+      )
+    })
+  }
+
+  const updateFollowRedirects = (index: number, value: boolean) => {
+    setHttpConfig({
+      ...httpConfig,
+      targets: httpConfig.targets.map((target, i) => 
+        i === index 
+          ? { ...target, follow_redirects: value }
+          : target
+      )
+    })
+  }
+
+  const updateExpectedStatusCodes = (index: number, value: string) => {
+    const codes = value
+      .split(',')
+      .map((code) => parseInt(code.trim()))
+      .filter((code) => !isNaN(code))
+    setHttpConfig({
+      ...httpConfig,
+      targets: httpConfig.targets.map((target, i) => 
+        i === index 
+          ? { ...target, expected_status_codes: codes.length > 0 ? codes : undefined }
+          : target
+      )
+    })
+  }
+
   return (
     <div className="space-y-6">
       {/* Check Interval at the top */}
@@ -698,6 +837,114 @@ export function HttpConfigTab({
                         onChange={(e) => updateTargetNumber(index, 'timeout', parseInt(e.target.value) || 1)}
                       />
                     </div>
+                    <div className="space-y-2">
+                      <Label>Method</Label>
+                      <Select value={target.method || 'GET'} onValueChange={(value) => updateTargetString(index, 'method', value)}>
+                        <SelectTrigger>
+                          <SelectValue />
+                        </SelectTrigger>
+                        <SelectContent>
+                          {HTTP_METHODS.map((method) => (
+                            <SelectItem key={method} value={method}>
+                              {method}
+                            </SelectItem>
+                          ))}
+                        </SelectContent>
+                      </Select>
+                    </div>
+                    <div className="space-y-2">
+                      <Label>Request Body (Optional)</Label>
+                      <Input
+                        placeholder='{"status": "check"}'
+                        value={target.body || ''}
+                        onChange={(e) => updateTargetString(index, 'body', e.target.value)}
+                      />
+                    </div>
+                    <div className="space-y-2">
+                      <Label>Follow Redirects</Label>
+                      <Select
+                        value={target.follow_redirects === false ? 'no' : 'yes'}
+                        onValueChange={(value) => updateFollowRedirects(index, value === 'yes')}
+                      >
+                        <SelectTrigger>
+                          <SelectValue />
+                        </SelectTrigger>
+                        <SelectContent>
+                          <SelectItem value="yes">Yes</SelectItem>
+                          <SelectItem value="no">No, check the redirect response</SelectItem>
+                        </SelectContent>
+                      </Select>
+                    </div>
+                    <div className="space-y-2">
+                      <Label>Expected Status Codes (Optional)</Label>
+                      <Input
+                        placeholder="200, 204"
+                        defaultValue={target.expected_status_codes?.join(', ') || ''}
+                        onBlur={(e) => updateExpectedStatusCodes(index, e.target.value)}
+                      />
+                    </div>
+                    <div className="space-y-2">
+                      <Label>Body Match (Optional)</Label>
+                      <Input
+                        placeholder='"status":\s*"ok"'
+                        value={target.body_match || ''}
+                        onChange={(e) => updateTargetString(index, 'body_match', e.target.value)}
+                      />
+                    </div>
+                    <div className="space-y-2">
+                      <Label>Measure Throughput</Label>
+                      <Select
+                        value={target.measure_throughput ? 'yes' : 'no'}
+                        onValueChange={(value) => updateMeasureThroughput(index, value === 'yes')}
+                      >
+                        <SelectTrigger>
+                          <SelectValue />
+                        </SelectTrigger>
+                        <SelectContent>
+                          <SelectItem value="no">No</SelectItem>
+                          <SelectItem value="yes">Yes, download the body and record its speed</SelectItem>
+                        </SelectContent>
+                      </Select>
+                    </div>
+                    {target.measure_throughput && (
+                      <div className="space-y-2">
+                        <Label>Max Download (MB)</Label>
+                        <Input
+                          type="number"
+                          min="1"
+                          max="1024"
+                          placeholder="100"
+                          value={target.max_download_bytes ? target.max_download_bytes / (1 << 20) : ''}
+                          onChange={(e) => updateTargetNumber(index, 'max_download_bytes', Math.round((parseFloat(e.target.value) || 0) * (1 << 20)))}
+                        />
+                      </div>
+                    )}
+                    <div className="space-y-2">
+                      <Label>Connection</Label>
+                      <Select
+                        value={target.reuse_connection ? 'reuse' : 'new'}
+                        onValueChange={(value) => updateReuseConnection(index, value === 'reuse')}
+                      >
+                        <SelectTrigger>
+                          <SelectValue />
+                        </SelectTrigger>
+                        <SelectContent>
+                          <SelectItem value="new">New for each check, timings include DNS, TCP and TLS setup</SelectItem>
+                          <SelectItem value="reuse">Reused, timings after the first check measure the request only</SelectItem>
+                        </SelectContent>
+                      </Select>
+                    </div>
+                    <div className="space-y-2">
+                      <Label>Proxy URL (Optional)</Label>
+                      <Input
+                        placeholder="http://proxy.example.com:3128"
+                        value={target.proxy_url || ''}
+                        onChange={(e) => updateTargetString(index, 'proxy_url', e.target.value)}
+                      />
+                      <p className="text-sm text-muted-foreground">
+                        http, https or socks5 proxy, otherwise the agent's HTTP_PROXY and HTTPS_PROXY variables apply
+                      </p>
+                    </div>
                   </div>
                 </CardContent>
               </Card>
@@ -738,7 +985,7 @@ export function SpeedtestConfigTab({
     })
   }
 
-  const updateTargetString = (index: number, field: 'server_id' | 'friendly_name', value: string) => {
+  const updateTargetString = (index: number, field: 'server_id' | 'server_host' | 'friendly_name' | 'provider' | 'url', value: string) => {
     setSpeedtestConfig({
       ...speedtestConfig,
       targets: speedtestConfig.targets.map((target, i) => 
@@ -749,7 +996,7 @@ export function SpeedtestConfigTab({
     })
   }
 
-  const updateTargetNumber = (index: number, field: 'timeout', value: number) => {
+  const updateTargetNumber = (index: number, field: 'timeout' | 'min_speed' | 'max_speed' | 'min_download' | 'max_download' | 'min_upload' | 'max_upload' | 'retries' | 'monthly_byte_budget', value: number) => {
     setSpeedtestConfig({
       ...speedtestConfig,
       targets: speedtestConfig.targets.map((target, i) => 
@@ -823,13 +1070,49 @@ export function SpeedtestConfigTab({
                   </div>
                   <div className="grid grid-cols-2 gap-4">
                     <div className="space-y-2">
-                      <Label>Server ID</Label>
-                      <Input
-                        placeholder="12345"
-                        value={target.server_id}
-                        onChange={(e) => updateTargetString(index, 'server_id', e.target.value)}
-                      />
+                      <Label>Provider</Label>
+                      <Select value={target.provider || 'ookla'} onValueChange={(value) => updateTargetString(index, 'provider', value)}>
+                        <SelectTrigger>
+                          <SelectValue />
+                        </SelectTrigger>
+                        <SelectContent>
+                          <SelectItem value="ookla">Ookla (speedtest CLI)</SelectItem>
+                          <SelectItem value="cloudflare">Cloudflare</SelectItem>
+                          <SelectItem value="librespeed">LibreSpeed</SelectItem>
+                          <SelectItem value="http">HTTP file download</SelectItem>
+                        </SelectContent>
+                      </Select>
                     </div>
+                    {(target.provider === 'librespeed' || target.provider === 'http') && (
+                      <div className="space-y-2">
+                        <Label>{target.provider === 'http' ? 'File URL' : 'Server URL'}</Label>
+                        <Input
+                          placeholder={target.provider === 'http' ? 'https://example.com/100MB.bin' : 'https://librespeed.example.com'}
+                          value={target.url || ''}
+                          onChange={(e) => updateTargetString(index, 'url', e.target.value)}
+                        />
+                      </div>
+                    )}
+                    {(!target.provider || target.provider === 'ookla') && (
+                      <>
+                        <div className="space-y-2">
+                          <Label>Server ID (Optional)</Label>
+                          <Input
+                            placeholder="Auto-select"
+                            value={target.server_id}
+                            onChange={(e) => updateTargetString(index, 'server_id', e.target.value)}
+                          />
+                        </div>
+                        <div className="space-y-2">
+                          <Label>Server Host (Optional)</Label>
+                          <Input
+                            placeholder="speedtest.example.com:8080"
+                            value={target.server_host || ''}
+                            onChange={(e) => updateTargetString(index, 'server_host', e.target.value)}
+                          />
+                        </div>
+                      </>
+                    )}
                     <div className="space-y-2">
                       <Label>Friendly Name (Optional)</Label>
                       <Input
@@ -847,6 +1130,86 @@ export function SpeedtestConfigTab({
                         onChange={(e) => updateTargetNumber(index, 'timeout', parseInt(e.target.value) || 1)}
                       />
                     </div>
+                    <div className="space-y-2">
+                      <Label>Retries</Label>
+                      <Input
+                        type="number"
+                        min="0"
+                        max="5"
+                        value={target.retries ?? 1}
+                        onChange={(e) => updateTargetNumber(index, 'retries', Math.min(5, Math.max(0, parseInt(e.target.value) || 0)))}
+                      />
+                    </div>
+                    <div className="space-y-2">
+                      <Label>Monthly Data Budget (GB, Optional)</Label>
+                      <Input
+                        type="number"
+                        min="0"
+                        placeholder="Unlimited"
+                        value={target.monthly_byte_budget ? target.monthly_byte_budget / 1e9 : ''}
+                        onChange={(e) => updateTargetNumber(index, 'monthly_byte_budget', Math.round((parseFloat(e.target.value) || 0) * 1e9))}
+                      />
+                    </div>
+                    <div className="space-y-2">
+                      <Label>Min Plausible Speed (Mbps, Optional)</Label>
+                      <Input
+                        type="number"
+                        min="0"
+                        placeholder="0"
+                        value={target.min_speed || ''}
+                        onChange={(e) => updateTargetNumber(index, 'min_speed', parseFloat(e.target.value) || 0)}
+                      />
+                    </div>
+                    <div className="space-y-2">
+                      <Label>Max Plausible Speed (Mbps, Optional)</Label>
+                      <Input
+                        type="number"
+                        min="0"
+                        placeholder="0"
+                        value={target.max_speed || ''}
+                        onChange={(e) => updateTargetNumber(index, 'max_speed', parseFloat(e.target.value) || 0)}
+                      />
+                    </div>
+                    <div className="space-y-2">
+                      <Label>Min Plausible Download (Mbps, Optional)</Label>
+                      <Input
+                        type="number"
+                        min="0"
+                        placeholder="Min plausible speed"
+                        value={target.min_download || ''}
+                        onChange={(e) => updateTargetNumber(index, 'min_download', parseFloat(e.target.value) || 0)}
+                      />
+                    </div>
+                    <div className="space-y-2">
+                      <Label>Max Plausible Download (Mbps, Optional)</Label>
+                      <Input
+                        type="number"
+                        min="0"
+                        placeholder="Max plausible speed"
+                        value={target.max_download || ''}
+                        onChange={(e) => updateTargetNumber(index, 'max_download', parseFloat(e.target.value) || 0)}
+                      />
+                    </div>
+                    <div className="space-y-2">
+                      <Label>Min Plausible Upload (Mbps, Optional)</Label>
+                      <Input
+                        type="number"
+                        min="0"
+                        placeholder="Min plausible speed"
+                        value={target.min_upload || ''}
+                        onChange={(e) => updateTargetNumber(index, 'min_upload', parseFloat(e.target.value) || 0)}
+                      />
+                    </div>
+                    <div className="space-y-2">
+                      <Label>Max Plausible Upload (Mbps, Optional)</Label>
+                      <Input
+                        type="number"
+                        min="0"
+                        placeholder="Max plausible speed"
+                        value={target.max_upload || ''}
+                        onChange={(e) => updateTargetNumber(index, 'max_upload', parseFloat(e.target.value) || 0)}
+                      />
+                    </div>
                   </div>
                 </CardContent>
               </Card>
@@ -403,6 +403,36 @@ export const alertInfo: Record<string, AlertInfo> = {
 		step: 1,
 		desc: () => t`Triggers when average latency across all ping targets exceeds threshold`,
 	},
+	PingJitter: {
+		name: () => t`Ping Jitter`,
+		unit: " ms",
+		icon: ActivityIcon,
+		max: 500,
+		min: 1,
+		start: 30,
+		step: 1,
+		desc: () => t`Triggers when average jitter across all ping targets exceeds threshold`,
+	},
+	PingQuality: {
+		name: () => t`Ping Link Quality`,
+		unit: "",
+		icon: ActivityIcon,
+		max: 100,
+		min: 0,
+		start: 70,
+		step: 1,
+		desc: () => t`Triggers when the average link quality index (0-100, from latency, jitter and loss) drops below threshold`,
+	},
+	PingMtu: {
+		name: () => t`Ping Path MTU`,
+		unit: " bytes",
+		icon: ActivityIcon,
+		max: 1500,
+		min: 576,
+		start: 1500,
+		step: 1,
+		desc: () => t`Triggers when the smallest path MTU discovered by ping targets in MTU mode drops below threshold`,
+	},
 	DNSTime: {
 		name: () => t`DNS Lookup Time`,
 		unit: " ms",
@@ -423,6 +453,16 @@ export const alertInfo: Record<string, AlertInfo> = {
 		step: 1,
 		desc: () => t`Triggers when DNS lookup failure rate exceeds threshold`,
 	},
+	DNSAnswerOutOfRange: {
+		name: () => t`DNS Answer Out of Range`,
+		unit: "",
+		icon: GlobeIcon,
+		max: 100,
+		min: 0,
+		start: 0,
+		step: 1,
+		desc: () => t`Triggers when more DNS answers than threshold fall outside the allowed CIDRs of their target`,
+	},
 	HTTPResponseTime: {
 		name: () => t`HTTP Response Time`,
 		unit: " ms",
@@ -433,6 +473,36 @@ export const alertInfo: Record<string, AlertInfo> = {
 		step: 1,
 		desc: () => t`Triggers when average HTTP response time exceeds threshold`,
 	},
+	HTTPRetransmits: {
+		name: () => t`HTTP TCP Retransmits`,
+		unit: "",
+		icon: GlobeIcon,
+		max: 100,
+		min: 0,
+		start: 5,
+		step: 1,
+		desc: () => t`Triggers when HTTP checks retransmit more TCP segments than threshold (Linux agents only)`,
+	},
+	HTTPOcspStapling: {
+		name: () => t`HTTP OCSP Stapling`,
+		unit: "",
+		icon: GlobeIcon,
+		max: 100,
+		min: 0,
+		start: 0,
+		step: 1,
+		desc: () => t`Triggers when more HTTPS targets with OCSP checks than threshold lack a good stapled OCSP response`,
+	},
+	SSLCertExpiry: {
+		name: () => t`SSL Certificate Expiry`,
+		unit: " days",
+		icon: GlobeIcon,
+		max: 90,
+		min: 1,
+		start: 14,
+		step: 1,
+		desc: () => t`Triggers when a certificate of the HTTPS targets expires in fewer days than threshold`,
+	},
 	HTTPFailures: {
 		name: () => t`HTTP Failures`,
 		unit: "%",
@@ -443,6 +513,16 @@ export const alertInfo: Record<string, AlertInfo> = {
 		step: 1,
 		desc: () => t`Triggers when HTTP request failure rate exceeds threshold`,
 	},
+	HTTPErrorRate: {
+		name: () => t`HTTP Error Responses`,
+		unit: "%",
+		icon: GlobeIcon,
+		max: 100,
+		min: 0,
+		start: 10,
+		step: 1,
+		desc: () => t`Triggers when the share of 4xx and 5xx HTTP responses exceeds threshold`,
+	},
 	SpeedtestDownload: {
 		name: () => t`Speedtest Download`,
 		unit: " Mbps",
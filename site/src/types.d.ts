@@ -27,6 +27,13 @@ export interface SystemRecord extends RecordModel {
 	host: string
 	status: "up" | "down" | "paused" | "pending"
 	info: SystemInfo
+	/** results dropped by the agent because they weren't collected in time */
+	dropped_results?: number
+	/** cron windows in which the system is expected to be online, e.g. "* 8-18 * * 1-5" */
+	active_schedule?: string
+	/** download and upload speed of the internet plan in Mbps, for percent of plan speedtest alerts */
+	plan_download?: number
+	plan_upload?: number
 	averages?: {
 		ap?: number   // Average ping latency
 		apl?: number  // Average ping packet loss
@@ -36,6 +43,12 @@ export interface SystemRecord extends RecordModel {
 		ahf?: number  // Average HTTP failure rate
 		adl?: number  // Average download
 		aul?: number  // Average upload
+		pp95?: number // 95th percentile ping latency
+		pp99?: number // 99th percentile ping latency
+		dp95?: number // 95th percentile DNS lookup time
+		dp99?: number // 99th percentile DNS lookup time
+		hp95?: number // 95th percentile HTTP response time
+		hp99?: number // 99th percentile HTTP response time
 	}
 	current_averages?: {
 		ap?: number   // Average ping latency
@@ -46,6 +59,12 @@ export interface SystemRecord extends RecordModel {
 		ahf?: number  // Average HTTP failure rate
 		adl?: number  // Average download
 		aul?: number  // Average upload
+		pp95?: number // 95th percentile ping latency
+		pp99?: number // 99th percentile ping latency
+		dp95?: number // 95th percentile DNS lookup time
+		dp99?: number // 99th percentile DNS lookup time
+		hp95?: number // 95th percentile HTTP response time
+		hp99?: number // 99th percentile HTTP response time
 	}
 	expected_performance?: {
 		ping_latency?: number      // Expected ping latency in ms
@@ -55,6 +74,25 @@ export interface SystemRecord extends RecordModel {
 		upload_speed?: number      // Expected upload speed in Mbps
 	}
 	tags?: string[]  // Array of tags for filtering and organization
+	/** percentage of the window the system was up, null without data */
+	uptime?: {
+		"24h"?: number | null
+		"7d"?: number | null
+		"30d"?: number | null
+	}
+	/** latest changes of the public ip, oldest first */
+	ip_history?: {
+		old: string
+		new: string
+		time: string
+	}[]
+	/** last self-update of the agent requested from the hub */
+	agent_update?: {
+		status: "updating" | "updated" | "current" | "failed"
+		version?: string
+		error?: string
+		updated: string
+	}
 	v: string
 	
 	// Unified monitoring configuration
@@ -64,8 +102,13 @@ export interface SystemRecord extends RecordModel {
 			dns: boolean
 			http?: boolean
 			speedtest?: boolean
+			traceroute?: boolean
+			snmp?: boolean
 		}
 		global_interval?: string | number // Default interval for all monitoring types
+		cron_seconds?: boolean // Intervals are cron expressions with a leading seconds field
+		jitter?: boolean // Spread scheduled checks of targets over the first half of the interval, results arrive later than scheduled
+		paused?: string[] // Services paused on the hub, disabled while keeping their targets
 		ping?: {
 			targets: {
 				host: string
@@ -96,6 +139,10 @@ export interface SystemRecord extends RecordModel {
 				timeout: number
 				expected_status?: number[]
 				headers?: Record<string, string>
+				measure_throughput?: boolean // Download the body to measure its speed
+				max_download_bytes?: number // Bytes read when measuring throughput
+				reuse_connection?: boolean // Keep the connection alive between checks
+				proxy_url?: string // http, https or socks5 proxy for the check
 			}[]
 			interval?: string | number // Override global interval
 			expected_response_time?: number // Expected HTTP response time in ms
@@ -108,6 +155,33 @@ export interface SystemRecord extends RecordModel {
 			}[]
 			interval?: string | number // Override global interval
 		}
+		traceroute?: {
+			targets: {
+				host: string
+				count?: number // Probes per hop
+				max_hops?: number
+				timeout?: number // Seconds to wait for each probe
+				tool?: "" | "mtr" | "traceroute" // Empty uses mtr if installed
+			}[]
+			interval?: string | number // Override global interval
+		}
+		snmp?: {
+			targets: {
+				host: string
+				port?: number // Default 161
+				version?: "1" | "2c" | "3" // Default 2c
+				timeout?: number // Seconds to wait for the reply
+				community?: string // v1 and v2c, default public
+				username?: string // v3
+				auth_protocol?: "" | "MD5" | "SHA" | "SHA224" | "SHA256" | "SHA384" | "SHA512"
+				auth_password?: string
+				priv_protocol?: "" | "DES" | "AES" | "AES192" | "AES256" | "AES192C" | "AES256C"
+				priv_password?: string
+				oids?: string[] // Numeric OIDs to poll
+				interfaces?: number[] // Interface indexes whose IF-MIB counters are polled
+			}[]
+			interval?: string | number // Override global interval
+		}
 	}
 }
 
@@ -123,6 +197,34 @@ export interface SystemInfo {
 	isp?: string
 	/** autonomous system number */
 	asn?: string
+	/** scheduler health from the agent's latest heartbeat */
+	sched?: SchedulerStatus[]
+	/** network interfaces that are up, without loopback */
+	ni?: NetworkInterface[]
+	/** round trip time of the hub's websocket ping to the agent in ms */
+	rtt?: number
+}
+
+export interface NetworkInterface {
+	/** name */
+	n: string
+	/** link speed in Mbps, missing if unknown */
+	s?: number
+	/** whether the interface is virtual */
+	v?: boolean
+}
+
+export interface SchedulerStatus {
+	/** service: ping, dns, http, speedtest, traceroute or snmp */
+	s: string
+	/** whether the cron job is scheduled */
+	a: boolean
+	/** last run, unix seconds */
+	r?: number
+	/** why the job couldn't be scheduled */
+	e?: string
+	/** why the checks can't run, like a tool that isn't installed */
+	u?: string
 }
 
 
@@ -137,10 +239,44 @@ export interface AlertRecord extends RecordModel {
 	system: string
 	name: string
 	triggered: boolean
+	/** minutes repeated trigger notifications are held back */
+	cooldown?: number
+	last_notified?: string
+	/** avg evaluates the average of all targets, max and any the worst single target */
+	aggregation?: "" | "avg" | "max" | "any"
+	/** percent_of_plan compares speedtest speeds as a percentage of the system's plan */
+	threshold_mode?: "" | "absolute" | "percent_of_plan"
 	sysname?: string
 	// user: string
 }
 
+export interface MaintenanceWindow {
+	id?: string
+	system: string
+	/** fixed windows, UTC */
+	start?: string
+	end?: string
+	/** recurring windows: cron expression of the start times in UTC and minutes each lasts */
+	schedule?: string
+	duration?: number
+	note?: string
+	active: boolean
+}
+
+/** response of POST /api/beszel/alerts/{id}/simulate, nothing is saved or sent */
+export interface AlertSimulation {
+	name: string
+	/** value compared to the threshold, a percentage of the plan in percent_of_plan mode */
+	value: number
+	unit: string
+	threshold: number
+	triggered: boolean
+	/** the value triggers or resolves the alert, which sends a notification */
+	state_change: boolean
+	subject: string
+	body: string
+}
+
 export interface AlertsHistoryRecord extends RecordModel {
 	alert: string
 	user: string
@@ -164,10 +300,34 @@ export interface ChartTimeData {
 	}
 }
 
+export interface NotificationChannel {
+	type: "discord" | "slack" | "telegram"
+	webhook_url?: string
+	bot_token?: string
+	chat_id?: string
+}
+
+export interface AlertWebhook {
+	url: string
+	/** Go text/template rendering the JSON payload */
+	template?: string
+}
+
 export interface UserSettings {
 	chartTime: ChartTimes
 	emails?: string[]
 	webhooks?: string[]
+	channels?: NotificationChannel[]
+	alert_webhook?: AlertWebhook
+	/** alert types the user gets notified of by name, false turns a type off */
+	alerts?: Record<string, boolean>
+	/** daily time range without notifications, like 22:00 to 07:00 */
+	quietHours?: {
+		start: string
+		end: string
+		/** IANA time zone, UTC if empty */
+		tz?: string
+	}
 	unitTemp?: Unit
 	unitNet?: Unit
 	unitDisk?: Unit
@@ -194,6 +354,10 @@ export interface PingStatsRecord extends RecordModel {
 	min_rtt: number
 	max_rtt: number
 	avg_rtt: number
+	address_family?: "ipv4" | "ipv6" | ""
+	std_dev_rtt?: number
+	/** why the target couldn't be pinged, empty if fping ran */
+	error_code?: string
 	created: string | number
 }
 
@@ -205,6 +369,13 @@ export interface DnsStatsRecord extends RecordModel {
 	status: string
 	lookup_time: number
 	error_code: string
+	answers?: string[] | null
+	ttl?: number
+	authenticated?: boolean
+	/** answers of each server of a resolver comparison */
+	server_answers?: Record<string, string[]> | null
+	/** address the lookup was sent from, empty if the OS chose it */
+	source_ip?: string
 	created: string | number
 }
 
@@ -215,6 +386,22 @@ export interface HttpStatsRecord extends RecordModel {
 	response_time: number
 	status_code: number
 	error_code: string
+	dns_time?: number
+	connect_time?: number
+	tls_time?: number
+	ttfb?: number
+	total_time?: number
+	cert_expiry_days?: number
+	redirect_count?: number
+	final_url?: string
+	/** download speed of the body, only for targets measuring throughput */
+	throughput_mbps?: number
+	/** the check used a kept-alive connection, so it has no dns, connect or tls time */
+	connection_reused?: boolean
+	/** proxy the check went through, empty for a direct connection */
+	proxy?: string
+	/** variance of the connection's round trip time in ms as smoothed by the kernel, linux agents only */
+	tcp_rtt_var?: number
 	created: string | number
 }
 
@@ -233,6 +420,53 @@ export interface SpeedtestStatsRecord extends RecordModel {
 	created: string | number
 }
 
+export interface TracerouteHop {
+	hop: number
+	/** address that replied, missing if no probe got a reply */
+	host?: string
+	/** percentage of unanswered probes */
+	loss: number
+	sent: number
+	avg_rtt?: number
+	best_rtt?: number
+	worst_rtt?: number
+}
+
+export interface TracerouteStatsRecord extends RecordModel {
+	system: string
+	host: string
+	status: "success" | "incomplete" | "error"
+	tool: "mtr" | "traceroute" | ""
+	error_code: string
+	hop_count: number
+	hops?: TracerouteHop[] | null
+	/** loss and latency of the last hop */
+	loss: number
+	avg_rtt: number
+	created: string | number
+}
+
+export interface SnmpValue {
+	oid: string
+	/** name of interface counters, like if2_in_octets */
+	name?: string
+	type: "counter32" | "counter64" | "gauge32" | "integer" | "timeticks"
+	value: number
+	/** change per second of counters since the previous poll */
+	rate?: number
+}
+
+export interface SnmpStatsRecord extends RecordModel {
+	system: string
+	host: string
+	status: "success" | "partial" | "error"
+	error_code: string
+	/** milliseconds the device took to answer */
+	poll_time: number
+	values?: SnmpValue[] | null
+	created: string | number
+}
+
 type ChartDataPing = {
 	created: number | null
 } & {